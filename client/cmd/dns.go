@@ -0,0 +1,157 @@
+package cmd
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+	"google.golang.org/grpc/status"
+
+	"github.com/netbirdio/netbird/client/proto"
+)
+
+var dnsCmd = &cobra.Command{
+	Use:   "dns",
+	Short: "Manage the NetBird DNS of this peer",
+	Long:  `Commands to control how this peer applies the DNS configuration from management.`,
+}
+
+var dnsFreezeCmd = &cobra.Command{
+	Use:     "freeze",
+	Short:   "Hold back DNS config updates",
+	Long:    "Hold back the DNS config updates from management, e.g. during a rollout of bulk changes. The peer keeps its current DNS config until unfrozen.",
+	Example: "  netbird dns freeze",
+	Args:    cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, _ []string) error {
+		return setDNSFreeze(cmd, true)
+	},
+}
+
+var dnsUnfreezeCmd = &cobra.Command{
+	Use:     "unfreeze",
+	Short:   "Resume applying DNS config updates",
+	Long:    "Apply the latest DNS config update held back while frozen and resume applying the updates from management.",
+	Example: "  netbird dns unfreeze",
+	Args:    cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, _ []string) error {
+		return setDNSFreeze(cmd, false)
+	},
+}
+
+var dnsBypassCmd = &cobra.Command{
+	Use:   "bypass on|off",
+	Short: "Bypass NetBird DNS",
+	Long: "Point the host back at its original nameservers while NetBird DNS misbehaves, without stopping the client. " +
+		"NetBird keeps receiving DNS config updates and applies them to the host again once the bypass is turned off or the client reconnects.",
+	Example:   "  netbird dns bypass on\n  netbird dns bypass off",
+	Args:      cobra.MatchAll(cobra.ExactArgs(1), cobra.OnlyValidArgs),
+	ValidArgs: []string{"on", "off"},
+	RunE:      setDNSBypass,
+}
+
+var dnsDoctorCmd = &cobra.Command{
+	Use:   "doctor",
+	Short: "Check every configured nameserver",
+	Long: "Send a sample query to every nameserver of the configured nameserver groups and the fallback servers, " +
+		"reporting reachability, latency and the answer. The live DNS config and status are left untouched.",
+	Example: "  netbird dns doctor",
+	Args:    cobra.NoArgs,
+	RunE:    runDNSDoctor,
+}
+
+func setDNSFreeze(cmd *cobra.Command, frozen bool) error {
+	conn, err := getClient(cmd)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	client := proto.NewDaemonServiceClient(conn)
+	if _, err := client.SetDNSFreeze(cmd.Context(), &proto.SetDNSFreezeRequest{Frozen: frozen}); err != nil {
+		return fmt.Errorf("failed to set dns freeze: %v", status.Convert(err).Message())
+	}
+
+	if frozen {
+		cmd.Println("DNS config updates frozen")
+	} else {
+		cmd.Println("DNS config updates unfrozen")
+	}
+	return nil
+}
+
+func setDNSBypass(cmd *cobra.Command, args []string) error {
+	bypassed := args[0] == "on"
+
+	conn, err := getClient(cmd)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	client := proto.NewDaemonServiceClient(conn)
+	if _, err := client.SetDNSBypass(cmd.Context(), &proto.SetDNSBypassRequest{Bypassed: bypassed}); err != nil {
+		return fmt.Errorf("failed to set dns bypass: %v", status.Convert(err).Message())
+	}
+
+	if bypassed {
+		cmd.Println("DNS bypass on, the host uses its original nameservers")
+	} else {
+		cmd.Println("DNS bypass off, the host uses NetBird DNS")
+	}
+	return nil
+}
+
+func runDNSDoctor(cmd *cobra.Command, _ []string) error {
+	conn, err := getClient(cmd)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	client := proto.NewDaemonServiceClient(conn)
+	resp, err := client.RunDNSDiagnostics(cmd.Context(), &proto.RunDNSDiagnosticsRequest{})
+	if err != nil {
+		return fmt.Errorf("failed to run dns diagnostics: %v", status.Convert(err).Message())
+	}
+
+	if len(resp.GetGroups()) == 0 {
+		cmd.Println("No nameservers configured")
+		return nil
+	}
+	for _, group := range resp.GetGroups() {
+		cmd.Println(dnsDoctorGroupTitle(group))
+		for _, server := range group.GetServers() {
+			cmd.Println("  " + dnsDoctorServerLine(server))
+		}
+	}
+	cmd.Printf("Checked in %s\n", resp.GetDuration().AsDuration().Round(time.Millisecond))
+	return nil
+}
+
+func dnsDoctorGroupTitle(group *proto.DNSGroupDiagnostics) string {
+	switch {
+	case group.GetFallback():
+		return "Fallback servers:"
+	case group.GetPrimary():
+		return fmt.Sprintf("Group %s (primary):", group.GetId())
+	default:
+		return fmt.Sprintf("Group %s (%s):", group.GetId(), strings.Join(group.GetDomains(), ", "))
+	}
+}
+
+func dnsDoctorServerLine(server *proto.DNSUpstreamDiagnostics) string {
+	switch {
+	case !server.GetReachable():
+		return fmt.Sprintf("%s unreachable: %s", server.GetServer(), server.GetError())
+	case server.GetError() != "":
+		return fmt.Sprintf("%s failed %s: %s", server.GetServer(), server.GetQuery(), server.GetError())
+	}
+
+	line := fmt.Sprintf("%s answered %s over %s with %s in %s", server.GetServer(), server.GetQuery(),
+		server.GetProtocol(), server.GetRcode(), server.GetLatency().AsDuration().Round(time.Millisecond))
+	if len(server.GetAnswers()) > 0 {
+		line += ": " + strings.Join(server.GetAnswers(), "; ")
+	}
+	return line
+}
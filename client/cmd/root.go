@@ -171,12 +171,15 @@ func init() {
 	rootCmd.AddCommand(debugCmd)
 	rootCmd.AddCommand(profileCmd)
 	rootCmd.AddCommand(exposeCmd)
+	rootCmd.AddCommand(dnsCmd)
 
 	networksCMD.AddCommand(routesListCmd)
 	networksCMD.AddCommand(routesSelectCmd, routesDeselectCmd)
 
 	forwardingRulesCmd.AddCommand(forwardingRulesListCmd)
 
+	dnsCmd.AddCommand(dnsFreezeCmd, dnsUnfreezeCmd, dnsBypassCmd, dnsDoctorCmd)
+
 	debugCmd.AddCommand(debugBundleCmd)
 	debugCmd.AddCommand(logCmd)
 	logCmd.AddCommand(logLevelCmd)
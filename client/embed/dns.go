@@ -0,0 +1,98 @@
+package embed
+
+import (
+	"context"
+	"net"
+	"net/netip"
+
+	"github.com/netbirdio/netbird/client/internal/dns"
+	"github.com/netbirdio/netbird/client/internal/dns/types"
+	"github.com/netbirdio/netbird/client/internal/statemanager"
+)
+
+// DNSHostConfig describes the NetBird resolver a DNSHostManager should point the host at.
+type DNSHostConfig = dns.HostDNSConfig
+
+// DNSDomainConfig is a single domain entry of a DNSHostConfig.
+type DNSDomainConfig = dns.DomainConfig
+
+// DNSQueryInfo describes a query answered by the client's DNS server.
+type DNSQueryInfo = dns.QueryInfo
+
+// DNSHostManager replaces the auto-detected host DNS integration, e.g. for a
+// container-specific resolv.conf strategy. It is not used on Android and iOS.
+type DNSHostManager interface {
+	// ApplyDNSConfig points the host at the NetBird resolver. It is called on
+	// every effective config change and must be idempotent.
+	ApplyDNSConfig(config DNSHostConfig) error
+	// RestoreHostDNS reverts every change made by ApplyDNSConfig.
+	RestoreHostDNS() error
+	// SupportCustomPort reports whether the host can use a resolver on a port other than 53.
+	SupportCustomPort() bool
+	// GetOriginalNameservers returns the host resolvers in place before NetBird
+	// took over, used as fallback upstreams. May return nil.
+	GetOriginalNameservers() []netip.Addr
+	// String names the implementation in logs.
+	String() string
+}
+
+// DNSAuditSink receives one call per query answered by the client's DNS server.
+// It is called synchronously on the query path and must not block.
+type DNSAuditSink interface {
+	OnAnswered(info DNSQueryInfo, handlerID string, rcode int)
+}
+
+// ExportDNSConfig returns a versioned JSON snapshot of the applied DNS configuration.
+func (c *Client) ExportDNSConfig() ([]byte, error) {
+	engine, err := c.getEngine()
+	if err != nil {
+		return nil, err
+	}
+	return engine.ExportDNSConfig()
+}
+
+// DNSResolver returns a resolver sending lookups through the client's DNS
+// server in process, so names resolve as on a NetBird host, custom zones and
+// DNS routes included, without going through the OS. Lookups fail while the
+// client isn't running.
+func (c *Client) DNSResolver() *net.Resolver {
+	return &net.Resolver{
+		PreferGo: true,
+		Dial: func(ctx context.Context, network, address string) (net.Conn, error) {
+			engine, err := c.getEngine()
+			if err != nil {
+				return nil, err
+			}
+			return engine.DialDNS(ctx, network, address)
+		},
+	}
+}
+
+// ImportDNSConfig applies a snapshot produced by ExportDNSConfig. It fails
+// while DNS updates are frozen.
+func (c *Client) ImportDNSConfig(data []byte) error {
+	engine, err := c.getEngine()
+	if err != nil {
+		return err
+	}
+	return engine.ImportDNSConfig(data)
+}
+
+// dnsHostManagerAdapter adapts a DNSHostManager to dns.HostManager. Embedders
+// have no access to the state manager, so unclean-shutdown recovery is theirs.
+type dnsHostManagerAdapter struct {
+	DNSHostManager
+}
+
+func (a dnsHostManagerAdapter) ApplyDNSConfig(config dns.HostDNSConfig, _ *statemanager.Manager) error {
+	return a.DNSHostManager.ApplyDNSConfig(config)
+}
+
+// dnsAuditSinkAdapter adapts a DNSAuditSink to dns.AuditSink.
+type dnsAuditSinkAdapter struct {
+	sink DNSAuditSink
+}
+
+func (a dnsAuditSinkAdapter) OnAnswered(info dns.QueryInfo, handlerID types.HandlerID, rcode int) {
+	a.sink.OnAnswered(info, string(handlerID), rcode)
+}
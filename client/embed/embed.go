@@ -53,6 +53,10 @@ type Client struct {
 	jwtToken   string
 	connect    *internal.ConnectClient
 	recorder   *peer.Status
+
+	dnsHostManager      DNSHostManager
+	dnsAuditSink        DNSAuditSink
+	dnsAuditFullAnswers bool
 }
 
 // Options configures a new Client.
@@ -103,6 +107,13 @@ type Options struct {
 	DNSLabels []string
 	// Performance configures the tunnel's buffer pool cap and batch size.
 	Performance Performance
+	// DNSHostManager, if set, replaces the auto-detected host DNS integration.
+	DNSHostManager DNSHostManager
+	// DNSAuditSink, if set, is notified of every query answered by the DNS server.
+	DNSAuditSink DNSAuditSink
+	// DNSAuditFullAnswers passes the full answer records to DNSAuditSink
+	// instead of a summary of record counts and types.
+	DNSAuditFullAnswers bool
 }
 
 // Performance configures the embedded client's tunnel memory/throughput knobs.
@@ -233,6 +244,10 @@ func New(opts Options) (*Client, error) {
 		jwtToken:   opts.JWTToken,
 		config:     config,
 		recorder:   peer.NewRecorder(config.ManagementURL.String()),
+
+		dnsHostManager:      opts.DNSHostManager,
+		dnsAuditSink:        opts.DNSAuditSink,
+		dnsAuditFullAnswers: opts.DNSAuditFullAnswers,
 	}, nil
 }
 
@@ -266,6 +281,12 @@ func (c *Client) Start(startCtx context.Context) error {
 	}
 	client := internal.NewConnectClient(ctx, c.config, c.recorder)
 	client.SetSyncResponsePersistence(true)
+	if c.dnsHostManager != nil {
+		client.SetDNSHostManager(dnsHostManagerAdapter{c.dnsHostManager})
+	}
+	if c.dnsAuditSink != nil {
+		client.SetDNSAuditSink(dnsAuditSinkAdapter{c.dnsAuditSink}, c.dnsAuditFullAnswers)
+	}
 
 	// either startup error (permanent backoff err) or nil err (successful engine up)
 	// TODO: make after-startup backoff err available
@@ -5,6 +5,8 @@ import (
 	"crypto/tls"
 	"crypto/x509"
 	"fmt"
+	"net"
+	"net/netip"
 	"runtime"
 	"time"
 
@@ -18,6 +20,12 @@ import (
 	"github.com/netbirdio/netbird/util/embeddedroots"
 )
 
+// HostResolver resolves the host part of a dial address, see WithHostResolver.
+type HostResolver func(ctx context.Context, host string) ([]netip.Addr, error)
+
+// Dialer connects to a dial address, see WithDialer.
+type Dialer func(ctx context.Context, addr string) (net.Conn, error)
+
 // Backoff returns a backoff configuration for gRPC calls
 func Backoff(ctx context.Context) backoff.BackOff {
 	b := backoff.NewExponentialBackOff()
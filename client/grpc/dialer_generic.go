@@ -4,6 +4,7 @@ package grpc
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"net"
 	"os/user"
@@ -19,25 +20,72 @@ import (
 )
 
 func WithCustomDialer(_ bool, _ string) grpc.DialOption {
+	return grpc.WithContextDialer(dial)
+}
+
+// WithHostResolver replaces the dialer of WithCustomDialer with one that
+// resolves the target host through resolve instead of the system resolver and
+// dials the returned addresses in order until one connects. It must come
+// after WithCustomDialer in the dial options.
+func WithHostResolver(resolve HostResolver) grpc.DialOption {
 	return grpc.WithContextDialer(func(ctx context.Context, addr string) (net.Conn, error) {
-		if runtime.GOOS == "linux" {
-			currentUser, err := user.Current()
-			if err != nil {
-				return nil, status.Errorf(codes.FailedPrecondition, "failed to get current user: %v", err)
-			}
+		host, port, err := net.SplitHostPort(addr)
+		if err != nil {
+			return nil, fmt.Errorf("split host and port: %w", err)
+		}
+
+		addrs, err := resolve(ctx, host)
+		if err != nil {
+			return nil, fmt.Errorf("resolve %s: %w", host, err)
+		}
+		if len(addrs) == 0 {
+			return nil, fmt.Errorf("resolve %s: no addresses", host)
+		}
 
-			// the custom dialer requires root permissions which are not required for use cases run as non-root
-			if currentUser.Uid != "0" {
-				log.Debug("Not running as root, using standard dialer")
-				dialer := &net.Dialer{}
-				return dialer.DialContext(ctx, "tcp", addr)
+		var errs []error
+		for _, ip := range addrs {
+			conn, err := dial(ctx, net.JoinHostPort(ip.String(), port))
+			if err == nil {
+				return conn, nil
+			}
+			errs = append(errs, err)
+			if ctx.Err() != nil {
+				break
 			}
 		}
+		return nil, errors.Join(errs...)
+	})
+}
+
+// WithDialer replaces the dialer of WithCustomDialer with dialer, e.g. one
+// connecting through a SOCKS5 or HTTP CONNECT proxy. It must come after
+// WithCustomDialer and WithHostResolver in the dial options, the proxy
+// resolving the target host. A nil dialer keeps the default one.
+func WithDialer(dialer Dialer) grpc.DialOption {
+	if dialer == nil {
+		return grpc.EmptyDialOption{}
+	}
+	return grpc.WithContextDialer(dialer)
+}
 
-		conn, err := nbnet.NewDialer().DialContext(ctx, "tcp", addr)
+func dial(ctx context.Context, addr string) (net.Conn, error) {
+	if runtime.GOOS == "linux" {
+		currentUser, err := user.Current()
 		if err != nil {
-			return nil, fmt.Errorf("nbnet.NewDialer().DialContext: %w", err)
+			return nil, status.Errorf(codes.FailedPrecondition, "failed to get current user: %v", err)
 		}
-		return conn, nil
-	})
+
+		// the custom dialer requires root permissions which are not required for use cases run as non-root
+		if currentUser.Uid != "0" {
+			log.Debug("Not running as root, using standard dialer")
+			dialer := &net.Dialer{}
+			return dialer.DialContext(ctx, "tcp", addr)
+		}
+	}
+
+	conn, err := nbnet.NewDialer().DialContext(ctx, "tcp", addr)
+	if err != nil {
+		return nil, fmt.Errorf("nbnet.NewDialer().DialContext: %w", err)
+	}
+	return conn, nil
 }
@@ -11,3 +11,15 @@ import (
 func WithCustomDialer(tlsEnabled bool, component string) grpc.DialOption {
 	return client.WithWebSocketDialer(tlsEnabled, component)
 }
+
+// WithHostResolver is a no-op for WASM/JS environments, the browser resolves
+// the WebSocket endpoint.
+func WithHostResolver(_ HostResolver) grpc.DialOption {
+	return grpc.EmptyDialOption{}
+}
+
+// WithDialer is a no-op for WASM/JS environments, the connection goes
+// through the browser's WebSocket.
+func WithDialer(_ Dialer) grpc.DialOption {
+	return grpc.EmptyDialOption{}
+}
@@ -15,6 +15,7 @@ import (
 	"time"
 
 	"github.com/cenkalti/backoff/v4"
+	"github.com/prometheus/client_golang/prometheus"
 	log "github.com/sirupsen/logrus"
 
 	"golang.zx2c4.com/wireguard/wgctrl/wgtypes"
@@ -23,6 +24,7 @@ import (
 
 	"github.com/netbirdio/netbird/client/iface/wgaddr"
 
+	nbgrpc "github.com/netbirdio/netbird/client/grpc"
 	"github.com/netbirdio/netbird/client/iface"
 	"github.com/netbirdio/netbird/client/iface/device"
 	"github.com/netbirdio/netbird/client/iface/netstack"
@@ -69,6 +71,17 @@ type ConnectClient struct {
 	updateManager *updater.Manager
 
 	persistSyncResponse bool
+
+	dnsHostManager      dns.HostManager
+	dnsAuditSink        dns.AuditSink
+	dnsAuditFullAnswers bool
+	dnsEventSink        dns.ServiceEventSink
+	dnsMetrics          prometheus.Registerer
+
+	// bootstrapResolver resolves the management host through the host's
+	// original nameservers, so reconnects don't depend on NetBird DNS. It
+	// outlives engines to keep their nameservers and answers.
+	bootstrapResolver *dns.BootstrapResolver
 }
 
 func NewConnectClient(
@@ -81,12 +94,13 @@ func NewConnectClient(
 	// racing the run loop's startup. Callers therefore need not cancel before Stop.
 	runCtx, runCancel := context.WithCancel(ctx)
 	return &ConnectClient{
-		ctx:            runCtx,
-		runCancel:      runCancel,
-		runExited:      make(chan struct{}),
-		config:         config,
-		statusRecorder: statusRecorder,
-		engineMutex:    sync.Mutex{},
+		ctx:               runCtx,
+		runCancel:         runCancel,
+		runExited:         make(chan struct{}),
+		config:            config,
+		statusRecorder:    statusRecorder,
+		engineMutex:       sync.Mutex{},
+		bootstrapResolver: dns.NewBootstrapResolver(),
 	}
 }
 
@@ -94,6 +108,41 @@ func (c *ConnectClient) SetUpdateManager(um *updater.Manager) {
 	c.updateManager = um
 }
 
+// SetDNSHostManager replaces the auto-detected host DNS manager of engines
+// started after this call. It has no effect on Android and iOS.
+func (c *ConnectClient) SetDNSHostManager(manager dns.HostManager) {
+	c.engineMutex.Lock()
+	defer c.engineMutex.Unlock()
+	c.dnsHostManager = manager
+}
+
+// SetDNSAuditSink registers a sink notified of every query answered by the DNS
+// server of engines started after this call. It has no effect on Android and iOS.
+func (c *ConnectClient) SetDNSAuditSink(sink dns.AuditSink, fullAnswers bool) {
+	c.engineMutex.Lock()
+	defer c.engineMutex.Unlock()
+	c.dnsAuditSink = sink
+	c.dnsAuditFullAnswers = fullAnswers
+}
+
+// SetDNSServiceEventSink registers a sink notified of the state transitions of
+// the DNS server of engines started after this call. It has no effect on Android
+// and iOS.
+func (c *ConnectClient) SetDNSServiceEventSink(sink dns.ServiceEventSink) {
+	c.engineMutex.Lock()
+	defer c.engineMutex.Unlock()
+	c.dnsEventSink = sink
+}
+
+// SetDNSMetricsRegisterer registers the Prometheus collectors of the DNS server
+// of engines started after this call with reg. Collectors registered by earlier
+// engines are reused. It has no effect on Android and iOS.
+func (c *ConnectClient) SetDNSMetricsRegisterer(reg prometheus.Registerer) {
+	c.engineMutex.Lock()
+	defer c.engineMutex.Unlock()
+	c.dnsMetrics = reg
+}
+
 // Run with main logic.
 func (c *ConnectClient) Run(runningChan chan struct{}, logPath string) error {
 	if androidRunOverride != nil {
@@ -278,7 +327,8 @@ func (c *ConnectClient) run(mobileDependency MobileDependency, runningChan chan
 		}()
 
 		log.Debugf("connecting to the Management service %s", c.config.ManagementURL.Host)
-		mgmClient, err := mgm.NewClient(engineCtx, c.config.ManagementURL.Host, myPrivateKey, mgmTlsEnabled)
+		mgmClient, err := mgm.NewClient(engineCtx, c.config.ManagementURL.Host, myPrivateKey, mgmTlsEnabled,
+			nbgrpc.WithHostResolver(c.bootstrapResolver.LookupHost))
 		if err != nil {
 			// On daemon shutdown / Down() the parent context is cancelled
 			// and the dial fails with "context canceled". Wrapping that
@@ -389,6 +439,15 @@ func (c *ConnectClient) run(mobileDependency MobileDependency, runningChan chan
 			engineConfig.StateDir = filepath.Dir(path)
 		}
 
+		c.engineMutex.Lock()
+		engineConfig.DNSHostManager = c.dnsHostManager
+		engineConfig.DNSAuditSink = c.dnsAuditSink
+		engineConfig.DNSAuditFullAnswers = c.dnsAuditFullAnswers
+		engineConfig.DNSServiceEventSink = c.dnsEventSink
+		engineConfig.DNSMetricsRegisterer = c.dnsMetrics
+		engineConfig.DNSBootstrapResolver = c.bootstrapResolver
+		c.engineMutex.Unlock()
+
 		relayManager := relayClient.NewManager(engineCtx, relayURLs, myPrivateKey.PublicKey().String(), engineConfig.MTU)
 		c.statusRecorder.SetRelayMgr(relayManager)
 		if len(relayURLs) > 0 {
@@ -604,6 +663,52 @@ func createEngineConfig(key wgtypes.Key, config *profilemanager.Config, peerConf
 		SSHKey:                        []byte(config.SSHKey),
 		NATExternalIPs:                config.NATExternalIPs,
 		CustomDNSAddress:              config.CustomDNSAddress,
+		DNSMirroredZones:              config.DNSMirroredZones,
+		DNSZoneNotify:                 config.DNSZoneNotify,
+		DNSAnswerLoopback:             config.DNSAnswerLoopback,
+		DNSSortAnswers:                config.DNSSortAnswers,
+		DNSUnmatchedAction:            config.DNSUnmatchedAction,
+		DNSPrivateReverse:             config.DNSPrivateReverse,
+		DNSDnstapOutput:               config.DNSDnstapOutput,
+		DNSUpstreamPoolSize:           config.DNSUpstreamPoolSize,
+		DNSUpstreamIdleTimeout:        config.DNSUpstreamIdleTimeout,
+		DNSReverseCacheSize:           config.DNSReverseCacheSize,
+		DNSDisablePeerReverse:         config.DNSDisablePeerReverse,
+		DNSResponseCacheSize:          config.DNSResponseCacheSize,
+		DNSNoCacheGroups:              config.DNSNoCacheGroups,
+		DNSCacheTTLPolicies:           config.DNSCacheTTLPolicies,
+		DNSPersistResponseCache:       config.DNSPersistResponseCache,
+		DNSSwapQueueSize:              config.DNSSwapQueueSize,
+		DNSSwapQueueTimeout:           config.DNSSwapQueueTimeout,
+		DNSSuppressAAAADomains:        config.DNSSuppressAAAADomains,
+		DNSSealedZones:                config.DNSSealedZones,
+		DNSDefaultRecordTTL:           config.DNSDefaultRecordTTL,
+		DNSRewriteRules:               config.DNSRewriteRules,
+		DNSUpstreamMaxInflight:        config.DNSUpstreamMaxInflight,
+		DNSGroupMaxInflight:           config.DNSGroupMaxInflight,
+		DNSEDNSAllowlist:              config.DNSEDNSAllowlist,
+		DNSGroupEDNSAllowlist:         config.DNSGroupEDNSAllowlist,
+		DNSGroupSelectionPolicy:       config.DNSGroupSelectionPolicy,
+		DNSGroupsDownPolicy:           config.DNSGroupsDownPolicy,
+		DNSStripDNSSEC:                config.DNSStripDNSSEC,
+		DNSMaxUDPResponseSize:         config.DNSMaxUDPResponseSize,
+		DNSTimePolicies:               config.DNSTimePolicies,
+		DNSDoHPort:                    config.DNSDoHPort,
+		DNSDoHCertFile:                config.DNSDoHCertFile,
+		DNSDoHKeyFile:                 config.DNSDoHKeyFile,
+		DNSExpandSearchDomains:        config.DNSExpandSearchDomains,
+		DNSProbeInterval:              config.DNSProbeInterval,
+		DNSCaptivePortalPolicy:        config.DNSCaptivePortalPolicy,
+		DNSCaptivePortalDomains:       config.DNSCaptivePortalDomains,
+		DNSCaptivePortalAddresses:     config.DNSCaptivePortalAddresses,
+		DNSPostureRemediationAddress:  config.DNSPostureRemediationAddress,
+		DNSPostureRemediationDomains:  config.DNSPostureRemediationDomains,
+		DNSPostureChecks:              config.DNSPostureChecks,
+		DNSServiceIP:                  config.DNSServiceIP,
+		DNSConfigOverrideFile:         config.DNSConfigOverrideFile,
+		DNSMgmtCachePinned:            config.DNSMgmtCachePinned,
+		DNSNameCaseFolding:            config.DNSNameCaseFolding,
+		DNSRejectZoneOverlap:          config.DNSRejectZoneOverlap,
 		RosenpassEnabled:              config.RosenpassEnabled,
 		RosenpassPermissive:           config.RosenpassPermissive,
 		ServerSSHAllowed:              util.ReturnBoolWithDefaultTrue(config.ServerSSHAllowed),
@@ -1478,6 +1478,9 @@ func anonymizeBundleGenerators(servers []*mgmProto.NameServer, anonymizer *anony
 		if addr, err := netip.ParseAddr(server.IP); err == nil {
 			server.IP = anonymizer.AnonymizeIP(addr).String()
 		}
+		if server.Hostname != "" {
+			server.Hostname = anonymizer.AnonymizeDomain(server.Hostname)
+		}
 	}
 }
 
@@ -0,0 +1,236 @@
+package dns
+
+import (
+	"net/netip"
+	"slices"
+
+	"github.com/miekg/dns"
+)
+
+// RFC 6724 scopes, as used by rules 2 and 8.
+const (
+	scopeLinkLocal = 0x2
+	scopeSiteLocal = 0x5
+	scopeGlobal    = 0xe
+)
+
+var siteLocalPrefix = netip.MustParsePrefix("fec0::/10")
+
+// policyEntry is a row of the RFC 6724 default policy table.
+type policyEntry struct {
+	prefix     netip.Prefix
+	precedence int
+	label      int
+}
+
+// defaultPolicyTable is the RFC 6724 section 2.1 policy table, most specific
+// prefix first. IPv4 addresses are looked up in their IPv4-mapped form.
+var defaultPolicyTable = []policyEntry{
+	{netip.MustParsePrefix("::1/128"), 50, 0},
+	{netip.MustParsePrefix("::ffff:0:0/96"), 35, 4},
+	{netip.MustParsePrefix("::/96"), 1, 3},
+	{netip.MustParsePrefix("2001::/32"), 5, 5},
+	{netip.MustParsePrefix("2002::/16"), 30, 2},
+	{netip.MustParsePrefix("3ffe::/16"), 1, 12},
+	{netip.MustParsePrefix("fec0::/10"), 1, 11},
+	{netip.MustParsePrefix("fc00::/7"), 3, 13},
+	{netip.MustParsePrefix("::/0"), 40, 1},
+}
+
+// SetAnswerSortSource enables sorting of A and AAAA answers by RFC 6724
+// destination address selection, relative to the addresses returned by
+// source. Records are only reordered, never dropped. Pass nil to disable.
+func (c *HandlerChain) SetAnswerSortSource(source func() []netip.Addr) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.sortSource = source
+}
+
+// sortAnswers returns msg with its address records ordered by preference
+// for sources. Other records keep their position, so CNAME chains stay
+// intact. msg itself is not modified as handlers may hand out cached
+// responses.
+func sortAnswers(msg *dns.Msg, sources []netip.Addr) *dns.Msg {
+	var positions []int
+	var dests []addrRecord
+	for i, rr := range msg.Answer {
+		if addr, ok := rrAddr(rr); ok {
+			positions = append(positions, i)
+			dests = append(dests, addrRecord{rr: rr, attrs: newAddrAttrs(addr, sources)})
+		}
+	}
+	if len(dests) < 2 {
+		return msg
+	}
+
+	slices.SortStableFunc(dests, func(a, b addrRecord) int {
+		return compareDestinations(a.attrs, b.attrs)
+	})
+
+	sorted := *msg
+	sorted.Answer = slices.Clone(msg.Answer)
+	for i, pos := range positions {
+		sorted.Answer[pos] = dests[i].rr
+	}
+	return &sorted
+}
+
+type addrRecord struct {
+	rr    dns.RR
+	attrs addrAttrs
+}
+
+// addrAttrs caches the RFC 6724 properties of a destination and the source
+// address that would be used to reach it.
+type addrAttrs struct {
+	dst        netip.Addr
+	src        netip.Addr
+	dstScope   int
+	srcScope   int
+	precedence int
+	dstLabel   int
+	srcLabel   int
+}
+
+func newAddrAttrs(dst netip.Addr, sources []netip.Addr) addrAttrs {
+	attrs := addrAttrs{dst: dst, dstScope: addrScope(dst)}
+	attrs.precedence, attrs.dstLabel = classify(dst)
+	for _, src := range sources {
+		if src.Is4() == dst.Is4() {
+			attrs.src = src
+			attrs.srcScope = addrScope(src)
+			_, attrs.srcLabel = classify(src)
+			break
+		}
+	}
+	return attrs
+}
+
+// compareDestinations orders a before b when it is the preferred destination.
+// Rules 3, 4 and 7 need source address state the resolver doesn't have and
+// are skipped; rule 10 is the stable sort.
+func compareDestinations(a, b addrAttrs) int {
+	// Rule 1: avoid unusable destinations.
+	if c := preferTrue(a.src.IsValid(), b.src.IsValid()); c != 0 {
+		return c
+	}
+	if !a.src.IsValid() {
+		return 0
+	}
+
+	// Rule 2: prefer matching scope.
+	if c := preferTrue(a.dstScope == a.srcScope, b.dstScope == b.srcScope); c != 0 {
+		return c
+	}
+
+	// Rule 5: prefer matching label.
+	if c := preferTrue(a.dstLabel == a.srcLabel, b.dstLabel == b.srcLabel); c != 0 {
+		return c
+	}
+
+	// Rule 6: prefer higher precedence.
+	if a.precedence != b.precedence {
+		return b.precedence - a.precedence
+	}
+
+	// Rule 8: prefer smaller scope.
+	if a.dstScope != b.dstScope {
+		return a.dstScope - b.dstScope
+	}
+
+	// Rule 9: use longest matching prefix.
+	if a.dst.Is4() == b.dst.Is4() {
+		return commonPrefixLen(b.src, b.dst) - commonPrefixLen(a.src, a.dst)
+	}
+	return 0
+}
+
+func preferTrue(a, b bool) int {
+	switch {
+	case a && !b:
+		return -1
+	case !a && b:
+		return 1
+	}
+	return 0
+}
+
+func rrAddr(rr dns.RR) (netip.Addr, bool) {
+	switch r := rr.(type) {
+	case *dns.A:
+		addr, ok := netip.AddrFromSlice(r.A)
+		return addr.Unmap(), ok
+	case *dns.AAAA:
+		return netip.AddrFromSlice(r.AAAA)
+	}
+	return netip.Addr{}, false
+}
+
+func classify(addr netip.Addr) (precedence, label int) {
+	lookup := addr
+	if addr.Is4() {
+		lookup = netip.AddrFrom16(addr.As16())
+	}
+	for _, p := range defaultPolicyTable {
+		if p.prefix.Contains(lookup) {
+			return p.precedence, p.label
+		}
+	}
+	return 40, 1
+}
+
+// addrScope returns the RFC 6724 scope of addr. IPv4 loopback and
+// link-local addresses are link-local, everything else IPv4 is global.
+func addrScope(addr netip.Addr) int {
+	switch {
+	case addr.IsMulticast() && addr.Is6():
+		return int(addr.As16()[1] & 0xf)
+	case addr.IsLoopback(), addr.IsLinkLocalUnicast():
+		return scopeLinkLocal
+	case addr.Is6() && siteLocalPrefix.Contains(addr):
+		return scopeSiteLocal
+	}
+	return scopeGlobal
+}
+
+// commonPrefixLen returns the number of leading bits a and b share.
+func commonPrefixLen(a, b netip.Addr) int {
+	as, bs := a.AsSlice(), b.AsSlice()
+	if len(as) != len(bs) {
+		return 0
+	}
+	bits := 0
+	for i := range as {
+		x := as[i] ^ bs[i]
+		if x == 0 {
+			bits += 8
+			continue
+		}
+		for x&0x80 == 0 {
+			bits++
+			x <<= 1
+		}
+		break
+	}
+	return bits
+}
+
+// enableAnswerSorting sorts address answers relative to the peer's tunnel
+// addresses.
+func (s *DefaultServer) enableAnswerSorting() {
+	if s.wgInterface == nil {
+		return
+	}
+	wgInterface := s.wgInterface
+	s.handlerChain.SetAnswerSortSource(func() []netip.Addr {
+		addr := wgInterface.Address()
+		var sources []netip.Addr
+		if addr.IP.IsValid() {
+			sources = append(sources, addr.IP)
+		}
+		if addr.HasIPv6() {
+			sources = append(sources, addr.IPv6)
+		}
+		return sources
+	})
+}
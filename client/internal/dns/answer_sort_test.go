@@ -0,0 +1,132 @@
+package dns
+
+import (
+	"net/netip"
+	"testing"
+
+	"github.com/miekg/dns"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/netbirdio/netbird/client/internal/dns/test"
+)
+
+func addrRR(t *testing.T, addr string) dns.RR {
+	t.Helper()
+	ip := netip.MustParseAddr(addr)
+	hdr := dns.RR_Header{Name: "host.example.com.", Class: dns.ClassINET, Ttl: 60}
+	if ip.Is4() {
+		hdr.Rrtype = dns.TypeA
+		return &dns.A{Hdr: hdr, A: ip.AsSlice()}
+	}
+	hdr.Rrtype = dns.TypeAAAA
+	return &dns.AAAA{Hdr: hdr, AAAA: ip.AsSlice()}
+}
+
+func answerStrings(rrs []dns.RR) []string {
+	out := make([]string, 0, len(rrs))
+	for _, rr := range rrs {
+		switch r := rr.(type) {
+		case *dns.A:
+			out = append(out, r.A.String())
+		case *dns.AAAA:
+			out = append(out, r.AAAA.String())
+		case *dns.CNAME:
+			out = append(out, "CNAME "+r.Target)
+		}
+	}
+	return out
+}
+
+func TestSortAnswers(t *testing.T) {
+	v4Source := []netip.Addr{netip.MustParseAddr("100.66.100.1")}
+	dualSource := []netip.Addr{netip.MustParseAddr("100.66.100.1"), netip.MustParseAddr("fd00:1234::1")}
+
+	tests := []struct {
+		name    string
+		sources []netip.Addr
+		answers []string
+		want    []string
+	}{
+		{
+			name:    "longest prefix first, unreachable family last",
+			sources: v4Source,
+			answers: []string{"2001:db8::1", "8.8.8.8", "100.66.5.5"},
+			want:    []string{"100.66.5.5", "8.8.8.8", "2001:db8::1"},
+		},
+		{
+			name:    "matching label and precedence",
+			sources: dualSource,
+			answers: []string{"2001:db8::1", "fd00:1234::5", "192.168.1.1"},
+			want:    []string{"192.168.1.1", "fd00:1234::5", "2001:db8::1"},
+		},
+		{
+			name:    "ULA preferred over public IPv6 from a ULA source",
+			sources: []netip.Addr{netip.MustParseAddr("fd00:1234::1")},
+			answers: []string{"2001:db8::1", "fd12::1", "10.0.0.1"},
+			want:    []string{"fd12::1", "2001:db8::1", "10.0.0.1"},
+		},
+		{
+			name:    "link-local scope mismatch",
+			sources: v4Source,
+			answers: []string{"fe80::1", "169.254.1.1", "10.0.0.1"},
+			want:    []string{"10.0.0.1", "169.254.1.1", "fe80::1"},
+		},
+		{
+			name:    "no sources keeps order",
+			answers: []string{"2001:db8::1", "8.8.8.8", "10.0.0.1"},
+			want:    []string{"2001:db8::1", "8.8.8.8", "10.0.0.1"},
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			msg := new(dns.Msg)
+			for _, a := range tc.answers {
+				msg.Answer = append(msg.Answer, addrRR(t, a))
+			}
+			sorted := sortAnswers(msg, tc.sources)
+			assert.Equal(t, tc.want, answerStrings(sorted.Answer))
+			assert.Equal(t, tc.answers, answerStrings(msg.Answer), "input must not be modified")
+		})
+	}
+}
+
+func TestSortAnswers_KeepsOtherRecordsInPlace(t *testing.T) {
+	msg := new(dns.Msg)
+	msg.Answer = []dns.RR{
+		&dns.CNAME{Hdr: dns.RR_Header{Name: "www.example.com.", Rrtype: dns.TypeCNAME, Class: dns.ClassINET, Ttl: 60}, Target: "host.example.com."},
+		addrRR(t, "2001:db8::1"),
+		addrRR(t, "198.51.100.1"),
+	}
+
+	sorted := sortAnswers(msg, []netip.Addr{netip.MustParseAddr("100.66.100.1")})
+	assert.Equal(t, []string{"CNAME host.example.com.", "198.51.100.1", "2001:db8::1"}, answerStrings(sorted.Answer))
+}
+
+func TestHandlerChain_AnswerSorting(t *testing.T) {
+	chain := NewHandlerChain()
+	answers := []string{"2001:db8::1", "203.0.113.7", "fd00:1234::5", "192.168.1.1", "100.66.5.5"}
+	chain.AddHandler("example.com.", dns.HandlerFunc(func(w dns.ResponseWriter, r *dns.Msg) {
+		resp := new(dns.Msg).SetReply(r)
+		for _, a := range answers {
+			resp.Answer = append(resp.Answer, addrRR(t, a))
+		}
+		_ = w.WriteMsg(resp)
+	}), PriorityUpstream)
+
+	query := func() []string {
+		w := &test.MockResponseWriter{}
+		chain.ServeDNS(w, new(dns.Msg).SetQuestion("example.com.", dns.TypeA))
+		resp := w.GetLastResponse()
+		require.NotNil(t, resp)
+		return answerStrings(resp.Answer)
+	}
+
+	assert.Equal(t, answers, query(), "sorting is opt-in")
+
+	chain.SetAnswerSortSource(func() []netip.Addr {
+		return []netip.Addr{netip.MustParseAddr("100.66.100.1"), netip.MustParseAddr("fd00:1234::1")}
+	})
+	assert.Equal(t, []string{"100.66.5.5", "203.0.113.7", "192.168.1.1", "fd00:1234::5", "2001:db8::1"}, query())
+}
@@ -0,0 +1,107 @@
+package dns
+
+import (
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/miekg/dns"
+
+	"github.com/netbirdio/netbird/client/internal/dns/resutil"
+	"github.com/netbirdio/netbird/client/internal/dns/types"
+)
+
+// QueryInfo describes a query answered by the handler chain, as passed to an AuditSink.
+type QueryInfo struct {
+	// RequestID is the chain-generated ID also used in trace logs.
+	RequestID string
+	// Client is the remote address of the querying client, empty for in-process queries.
+	Client string
+	// Name is the lowercased query name.
+	Name string
+	// Type is the query type, e.g. "A" or "AAAA".
+	Type string
+	// HandlerType is the tier of the answering handler, e.g. "local" or "upstream".
+	HandlerType string
+	// Pattern is the chain pattern the answering handler was registered for.
+	Pattern string
+	// Answer summarizes the answer section: record count and types, or the
+	// full records when the sink was registered with full answers enabled.
+	Answer string
+}
+
+// AuditSink receives one call per query answered by the handler chain.
+// Implementations are called synchronously on the query path and must not block.
+type AuditSink interface {
+	OnAnswered(info QueryInfo, handlerID types.HandlerID, rcode int)
+}
+
+type auditConfig struct {
+	sink        AuditSink
+	fullAnswers bool
+}
+
+// SetAuditSink installs sink to be notified of every answered query. With
+// fullAnswers false only a summary of the answer section is passed on.
+// Pass nil to disable auditing.
+func (c *HandlerChain) SetAuditSink(sink AuditSink, fullAnswers bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if sink == nil {
+		c.audit = nil
+		return
+	}
+	c.audit = &auditConfig{sink: sink, fullAnswers: fullAnswers}
+}
+
+// notify reports an answered query to the sink. Safe to call on a nil config.
+func (a *auditConfig) notify(info QueryInfo, entry HandlerEntry, resp *dns.Msg) {
+	if a == nil || resp == nil {
+		return
+	}
+
+	info.HandlerType = handlerType(entry.Priority)
+	info.Pattern = entry.OrigPattern
+	if a.fullAnswers {
+		info.Answer = resutil.FormatAnswers(resp.Answer)
+	} else {
+		info.Answer = summarizeAnswers(resp.Answer)
+	}
+
+	a.sink.OnAnswered(info, handlerID(entry), resp.Rcode)
+}
+
+// handlerID returns the ID of the handler, falling back to its pattern for
+// handlers that don't carry one.
+func handlerID(entry HandlerEntry) types.HandlerID {
+	if h, ok := entry.Handler.(interface{ ID() types.HandlerID }); ok {
+		return h.ID()
+	}
+	return types.HandlerID(entry.OrigPattern)
+}
+
+// handlerType maps a chain priority to the handler tier it belongs to.
+func handlerType(priority int) string {
+	if tier, ok := TierOf(priority); ok {
+		return tier.Name
+	}
+	return "priority-" + strconv.Itoa(priority)
+}
+
+// summarizeAnswers returns the record count and the distinct record types,
+// e.g. "2 [CNAME A]", without any record data.
+func summarizeAnswers(answers []dns.RR) string {
+	if len(answers) == 0 {
+		return "0"
+	}
+
+	var rrTypes []string
+	for _, rr := range answers {
+		t := dns.TypeToString[rr.Header().Rrtype]
+		if !slices.Contains(rrTypes, t) {
+			rrTypes = append(rrTypes, t)
+		}
+	}
+	return strconv.Itoa(len(answers)) + " [" + strings.Join(rrTypes, " ") + "]"
+}
@@ -0,0 +1,195 @@
+package dns
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/netip"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/miekg/dns"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	// bootstrapTimeout bounds a single query to an original nameserver.
+	bootstrapTimeout = 3 * time.Second
+	// bootstrapMinTTL and bootstrapMaxTTL clamp how long an answer is used
+	// before it is resolved again. Expired answers are still used while no
+	// nameserver answers.
+	bootstrapMinTTL = 30 * time.Second
+	bootstrapMaxTTL = time.Hour
+)
+
+type bootstrapEntry struct {
+	addrs   []netip.Addr
+	expires time.Time
+}
+
+// BootstrapResolver resolves the hosts NetBird has to reach before its own
+// DNS works, like the management server. It queries the host's original
+// nameservers directly, never the NetBird listener, and keeps the answers so
+// a reconnect still reaches the host while no nameserver answers.
+//
+// Until a DNS server reported the original nameservers, the system resolver
+// is used: NetBird hasn't configured the host DNS yet, so it can't loop back.
+// It is also the last resort when none of the reported nameservers answers.
+type BootstrapResolver struct {
+	mu      sync.Mutex
+	servers []netip.AddrPort
+	cache   map[string]bootstrapEntry
+
+	// lookupSystem resolves through the system resolver. Overridden in tests.
+	lookupSystem func(ctx context.Context, host string) ([]netip.Addr, error)
+}
+
+// NewBootstrapResolver returns a resolver using the system resolver until
+// SetNameservers is called.
+func NewBootstrapResolver() *BootstrapResolver {
+	return &BootstrapResolver{
+		cache: make(map[string]bootstrapEntry),
+		lookupSystem: func(ctx context.Context, host string) ([]netip.Addr, error) {
+			return net.DefaultResolver.LookupNetIP(ctx, "ip", host)
+		},
+	}
+}
+
+// SetNameservers sets the host's original nameservers queried from now on.
+// An empty list keeps the previous nameservers.
+func (b *BootstrapResolver) SetNameservers(servers []netip.AddrPort) {
+	if len(servers) == 0 {
+		return
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.servers = slices.Clone(servers)
+}
+
+// LookupHost returns the addresses of host. IP literals are returned as is.
+// When resolving fails, the last answer for host is returned even if it
+// expired.
+func (b *BootstrapResolver) LookupHost(ctx context.Context, host string) ([]netip.Addr, error) {
+	if ip, err := netip.ParseAddr(host); err == nil {
+		return []netip.Addr{ip}, nil
+	}
+	name := strings.ToLower(dns.Fqdn(host))
+
+	b.mu.Lock()
+	cached, found := b.cache[name]
+	servers := b.servers
+	b.mu.Unlock()
+
+	if found && time.Now().Before(cached.expires) {
+		return cached.addrs, nil
+	}
+
+	addrs, ttl, err := b.resolve(ctx, servers, host, name)
+	if err == nil && len(addrs) > 0 {
+		b.mu.Lock()
+		b.cache[name] = bootstrapEntry{addrs: addrs, expires: time.Now().Add(ttl)}
+		b.mu.Unlock()
+		return addrs, nil
+	}
+	if err == nil {
+		err = errors.New("no A/AAAA records")
+	}
+
+	if found {
+		log.Warnf("failed to resolve %s, using last known addresses %v: %v", host, cached.addrs, err)
+		return cached.addrs, nil
+	}
+	return nil, err
+}
+
+// resolve queries the nameservers in order until one answers. The system
+// resolver is used when none are known, or when none of them answers: the
+// reported nameservers may be gone, e.g. after the host switched networks
+// while the engine was down.
+func (b *BootstrapResolver) resolve(ctx context.Context, servers []netip.AddrPort, host, name string) ([]netip.Addr, time.Duration, error) {
+	if len(servers) == 0 {
+		return b.resolveSystem(ctx, host)
+	}
+
+	var errs []error
+	for _, server := range servers {
+		addrs, ttl, err := queryAddrs(ctx, server, name)
+		if err == nil {
+			return addrs, ttl, nil
+		}
+		errs = append(errs, fmt.Errorf("%s: %w", server, err))
+		if ctx.Err() != nil {
+			return nil, 0, errors.Join(errs...)
+		}
+	}
+
+	addrs, ttl, err := b.resolveSystem(ctx, host)
+	if err == nil {
+		log.Debugf("original nameservers failed to resolve %s, used the system resolver: %v", host, errors.Join(errs...))
+		return addrs, ttl, nil
+	}
+	return nil, 0, errors.Join(append(errs, err)...)
+}
+
+// resolveSystem resolves host through the system resolver.
+func (b *BootstrapResolver) resolveSystem(ctx context.Context, host string) ([]netip.Addr, time.Duration, error) {
+	addrs, err := b.lookupSystem(ctx, host)
+	if err != nil {
+		return nil, 0, fmt.Errorf("system resolver: %w", err)
+	}
+	for i, addr := range addrs {
+		addrs[i] = addr.Unmap()
+	}
+	return addrs, bootstrapMinTTL, nil
+}
+
+// queryAddrs asks server for the A and AAAA records of name and returns them
+// with the lowest record TTL, clamped to the bootstrap TTL bounds.
+func queryAddrs(ctx context.Context, server netip.AddrPort, name string) ([]netip.Addr, time.Duration, error) {
+	client := &dns.Client{Timeout: bootstrapTimeout}
+
+	var addrs []netip.Addr
+	ttl := bootstrapMaxTTL
+	for _, qtype := range []uint16{dns.TypeA, dns.TypeAAAA} {
+		r := new(dns.Msg).SetQuestion(name, qtype)
+		r.SetEdns0(dns.DefaultMsgSize, false)
+
+		rm, _, err := ExchangeWithFallback(ctx, client, r, server.String())
+		if err != nil {
+			return nil, 0, err
+		}
+		if rm.Rcode != dns.RcodeSuccess && rm.Rcode != dns.RcodeNameError {
+			return nil, 0, fmt.Errorf("answered %s", dns.RcodeToString[rm.Rcode])
+		}
+
+		for _, rr := range rm.Answer {
+			var ip net.IP
+			switch rr := rr.(type) {
+			case *dns.A:
+				ip = rr.A
+			case *dns.AAAA:
+				ip = rr.AAAA
+			default:
+				continue
+			}
+			addr, ok := netip.AddrFromSlice(ip)
+			if !ok {
+				continue
+			}
+			addrs = append(addrs, addr.Unmap())
+			ttl = min(ttl, time.Duration(rr.Header().Ttl)*time.Second)
+		}
+	}
+	return addrs, max(ttl, bootstrapMinTTL), nil
+}
+
+// setBootstrapNameservers reports the original nameservers to the bootstrap
+// resolver, if one is configured.
+func (s *DefaultServer) setBootstrapNameservers(servers []netip.AddrPort) {
+	if s.bootstrapResolver != nil {
+		s.bootstrapResolver.SetNameservers(servers)
+	}
+}
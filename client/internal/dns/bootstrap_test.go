@@ -0,0 +1,146 @@
+package dns
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/netip"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/miekg/dns"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// startBootstrapNameserver serves A records of mgmt.example.com and returns
+// the server and its address.
+func startBootstrapNameserver(t *testing.T) (*dns.Server, netip.AddrPort) {
+	t.Helper()
+
+	pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+	require.NoError(t, err)
+	server := &dns.Server{PacketConn: pc, Net: "udp", Handler: dns.HandlerFunc(func(w dns.ResponseWriter, r *dns.Msg) {
+		m := new(dns.Msg).SetReply(r)
+		if r.Question[0].Name == "mgmt.example.com." && r.Question[0].Qtype == dns.TypeA {
+			m.Answer = append(m.Answer, &dns.A{
+				Hdr: dns.RR_Header{Name: r.Question[0].Name, Rrtype: dns.TypeA, Class: dns.ClassINET, Ttl: 60},
+				A:   net.ParseIP("198.51.100.10"),
+			})
+		}
+		_ = w.WriteMsg(m)
+	})}
+	go func() { _ = server.ActivateAndServe() }()
+	t.Cleanup(func() { _ = server.Shutdown() })
+
+	return server, netip.MustParseAddrPort(pc.LocalAddr().String())
+}
+
+// TestBootstrapResolver_NetBirdDNSDown simulates a management reconnect while
+// the system resolver points at a NetBird listener that stopped answering.
+func TestBootstrapResolver_NetBirdDNSDown(t *testing.T) {
+	nameserver, addr := startBootstrapNameserver(t)
+
+	var systemLookups atomic.Int32
+	resolver := NewBootstrapResolver()
+	resolver.lookupSystem = func(context.Context, string) ([]netip.Addr, error) {
+		systemLookups.Add(1)
+		return nil, errors.New("read udp 100.64.0.1:53: i/o timeout")
+	}
+
+	// The DNS server of the previous engine reported the original nameservers.
+	resolver.SetNameservers([]netip.AddrPort{addr})
+
+	want := []netip.Addr{netip.MustParseAddr("198.51.100.10")}
+	addrs, err := resolver.LookupHost(context.Background(), "mgmt.example.com")
+	require.NoError(t, err)
+	assert.Equal(t, want, addrs)
+	assert.Zero(t, systemLookups.Load(), "the system resolver must be bypassed")
+
+	// The original nameserver goes away too: the system resolver is tried
+	// last and the expired answer keeps management reachable.
+	require.NoError(t, nameserver.Shutdown())
+	resolver.mu.Lock()
+	entry := resolver.cache["mgmt.example.com."]
+	entry.expires = time.Now().Add(-time.Second)
+	resolver.cache["mgmt.example.com."] = entry
+	resolver.mu.Unlock()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	addrs, err = resolver.LookupHost(ctx, "mgmt.example.com")
+	require.NoError(t, err)
+	assert.Equal(t, want, addrs)
+	assert.Equal(t, int32(1), systemLookups.Load())
+}
+
+// TestBootstrapResolver_DeadNameservers covers reported nameservers that no
+// longer answer, e.g. after the host changed networks while NetBird was down.
+func TestBootstrapResolver_DeadNameservers(t *testing.T) {
+	pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+	require.NoError(t, err)
+	dead := netip.MustParseAddrPort(pc.LocalAddr().String())
+	require.NoError(t, pc.Close())
+
+	resolver := NewBootstrapResolver()
+	resolver.lookupSystem = func(_ context.Context, host string) ([]netip.Addr, error) {
+		if host != "mgmt.example.com" {
+			return nil, errors.New("not found")
+		}
+		return []netip.Addr{netip.MustParseAddr("198.51.100.30")}, nil
+	}
+	resolver.SetNameservers([]netip.AddrPort{dead})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*bootstrapTimeout)
+	defer cancel()
+	addrs, err := resolver.LookupHost(ctx, "mgmt.example.com")
+	require.NoError(t, err)
+	assert.Equal(t, []netip.Addr{netip.MustParseAddr("198.51.100.30")}, addrs)
+
+	_, err = resolver.LookupHost(ctx, "unknown.example.com")
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), dead.String(), "the nameserver error is kept")
+	assert.Contains(t, err.Error(), "system resolver")
+}
+
+func TestBootstrapResolver_SystemResolverUntilNameserversKnown(t *testing.T) {
+	resolver := NewBootstrapResolver()
+	resolver.lookupSystem = func(_ context.Context, host string) ([]netip.Addr, error) {
+		if host != "mgmt.example.com" {
+			return nil, errors.New("not found")
+		}
+		return []netip.Addr{netip.MustParseAddr("::ffff:198.51.100.20")}, nil
+	}
+
+	addrs, err := resolver.LookupHost(context.Background(), "mgmt.example.com")
+	require.NoError(t, err)
+	assert.Equal(t, []netip.Addr{netip.MustParseAddr("198.51.100.20")}, addrs)
+
+	_, err = resolver.LookupHost(context.Background(), "unknown.example.com")
+	assert.Error(t, err)
+
+	addrs, err = resolver.LookupHost(context.Background(), "2001:db8::1")
+	require.NoError(t, err)
+	assert.Equal(t, []netip.Addr{netip.MustParseAddr("2001:db8::1")}, addrs)
+}
+
+func TestBootstrapResolver_CachesAnswers(t *testing.T) {
+	_, addr := startBootstrapNameserver(t)
+
+	resolver := NewBootstrapResolver()
+	resolver.SetNameservers([]netip.AddrPort{addr})
+
+	_, err := resolver.LookupHost(context.Background(), "mgmt.example.com")
+	require.NoError(t, err)
+
+	resolver.mu.Lock()
+	entry, ok := resolver.cache["mgmt.example.com."]
+	resolver.mu.Unlock()
+	require.True(t, ok)
+	assert.WithinDuration(t, time.Now().Add(60*time.Second), entry.expires, 5*time.Second)
+
+	// Answers without records fail without caching.
+	_, err = resolver.LookupHost(context.Background(), "missing.example.com")
+	assert.Error(t, err)
+}
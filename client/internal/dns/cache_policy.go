@@ -0,0 +1,139 @@
+package dns
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/miekg/dns"
+	log "github.com/sirupsen/logrus"
+)
+
+// CacheTTLPolicy bounds how long the response cache keeps the answers to one
+// query type in a zone. Without bounds the TTLs of the answers are honored.
+type CacheTTLPolicy struct {
+	// Zone is the fully qualified, lowercased zone, "." for all names.
+	Zone string
+	// Qtype is the query type, zero for all of them.
+	Qtype uint16
+	// NoCache keeps the answers out of the cache.
+	NoCache bool
+	// MinTTL and MaxTTL bound the time answers are cached for and the TTLs
+	// they are served with. Zero leaves a bound unset. MinTTL may keep
+	// answers longer than responseCacheMaxTTL.
+	MinTTL time.Duration
+	MaxTTL time.Duration
+}
+
+// bound returns ttl within the bounds of the policy.
+func (p CacheTTLPolicy) bound(ttl time.Duration) time.Duration {
+	if p.MaxTTL > 0 {
+		ttl = min(ttl, p.MaxTTL)
+	}
+	return max(ttl, p.MinTTL)
+}
+
+// boundRecords bounds the TTLs of the records of msg like bound.
+func (p CacheTTLPolicy) boundRecords(msg *dns.Msg) {
+	if p.MinTTL == 0 && p.MaxTTL == 0 {
+		return
+	}
+	for _, rrs := range [][]dns.RR{msg.Answer, msg.Ns, msg.Extra} {
+		for _, rr := range rrs {
+			hdr := rr.Header()
+			hdr.Ttl = uint32(p.bound(time.Duration(hdr.Ttl)*time.Second) / time.Second)
+		}
+	}
+}
+
+// cacheTTLPolicyFor returns the most specific of policies for q: the one
+// with the longest zone containing its name, preferring one for its type
+// over one for all types. Of policies for the same zone and type the last
+// one applies. The zero policy honors the TTLs.
+func cacheTTLPolicyFor(policies []CacheTTLPolicy, q dns.Question) CacheTTLPolicy {
+	var (
+		best   CacheTTLPolicy
+		labels = -1
+	)
+	name := strings.ToLower(q.Name)
+	for _, p := range policies {
+		if p.Qtype != 0 && p.Qtype != q.Qtype || !dns.IsSubDomain(p.Zone, name) {
+			continue
+		}
+		n := dns.CountLabel(p.Zone)
+		if n > labels || n == labels && (p.Qtype != 0 || best.Qtype == 0) {
+			best, labels = p, n
+		}
+	}
+	return best
+}
+
+// ParseCacheTTLPolicies parses policy specs in format "zone types policy",
+// e.g. "example.com NS,SOA min=1h" or ". TXT no-cache". Types are "*" or a
+// comma separated list of query types. The policy is "honor", "no-cache" or
+// a comma separated list of "min=duration" and "max=duration". Invalid specs
+// are logged and skipped.
+func ParseCacheTTLPolicies(specs []string) []CacheTTLPolicy {
+	var policies []CacheTTLPolicy
+	for _, spec := range specs {
+		parsed, err := parseCacheTTLPolicy(spec)
+		if err != nil {
+			log.Warnf("invalid DNS cache TTL policy %q: %v", spec, err)
+			continue
+		}
+		policies = append(policies, parsed...)
+	}
+	return policies
+}
+
+func parseCacheTTLPolicy(spec string) ([]CacheTTLPolicy, error) {
+	fields := strings.Fields(spec)
+	if len(fields) != 3 {
+		return nil, fmt.Errorf("expected zone, types and policy")
+	}
+
+	var policy CacheTTLPolicy
+	policy.Zone = strings.ToLower(dns.Fqdn(fields[0]))
+	if _, ok := dns.IsDomainName(policy.Zone); !ok {
+		return nil, fmt.Errorf("invalid zone %q", fields[0])
+	}
+
+	switch fields[2] {
+	case "honor":
+	case "no-cache":
+		policy.NoCache = true
+	default:
+		for _, bound := range strings.Split(fields[2], ",") {
+			name, value, _ := strings.Cut(bound, "=")
+			d, err := time.ParseDuration(value)
+			if err != nil || d < 0 {
+				return nil, fmt.Errorf("invalid TTL bound %q", bound)
+			}
+			switch name {
+			case "min":
+				policy.MinTTL = d
+			case "max":
+				policy.MaxTTL = d
+			default:
+				return nil, fmt.Errorf("unknown policy %q, expected honor, no-cache, min= or max=", bound)
+			}
+		}
+		if policy.MaxTTL > 0 && policy.MinTTL > policy.MaxTTL {
+			return nil, fmt.Errorf("min TTL %s above max TTL %s", policy.MinTTL, policy.MaxTTL)
+		}
+	}
+
+	if fields[1] == "*" {
+		return []CacheTTLPolicy{policy}, nil
+	}
+	var policies []CacheTTLPolicy
+	for _, name := range strings.Split(fields[1], ",") {
+		qtype, ok := dns.StringToType[strings.ToUpper(name)]
+		if !ok {
+			return nil, fmt.Errorf("unknown query type %q", name)
+		}
+		policy.Qtype = qtype
+		policies = append(policies, policy)
+	}
+	return policies, nil
+}
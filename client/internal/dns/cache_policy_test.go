@@ -0,0 +1,115 @@
+package dns
+
+import (
+	"testing"
+	"time"
+
+	"github.com/miekg/dns"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseCacheTTLPolicies(t *testing.T) {
+	policies := ParseCacheTTLPolicies([]string{
+		"Example.com NS,soa min=1h",
+		". TXT no-cache",
+		"corp.example.com * max=30s,min=5s",
+		"static.example.com A honor",
+		"example.com A min=1h,max=1m",
+		"example.com BOGUS no-cache",
+		"example.com A forever",
+		"example.com A",
+	})
+
+	assert.Equal(t, []CacheTTLPolicy{
+		{Zone: "example.com.", Qtype: dns.TypeNS, MinTTL: time.Hour},
+		{Zone: "example.com.", Qtype: dns.TypeSOA, MinTTL: time.Hour},
+		{Zone: ".", Qtype: dns.TypeTXT, NoCache: true},
+		{Zone: "corp.example.com.", MinTTL: 5 * time.Second, MaxTTL: 30 * time.Second},
+		{Zone: "static.example.com.", Qtype: dns.TypeA},
+	}, policies)
+}
+
+func TestCacheTTLPolicyFor(t *testing.T) {
+	policies := ParseCacheTTLPolicies([]string{
+		". TXT no-cache",
+		"example.com * max=1m",
+		"example.com NS min=1h",
+		"corp.example.com A honor",
+	})
+	question := func(name string, qtype uint16) dns.Question {
+		return dns.Question{Name: name, Qtype: qtype, Qclass: dns.ClassINET}
+	}
+
+	assert.True(t, cacheTTLPolicyFor(policies, question("other.org.", dns.TypeTXT)).NoCache)
+	assert.Equal(t, CacheTTLPolicy{}, cacheTTLPolicyFor(policies, question("other.org.", dns.TypeA)))
+	assert.Equal(t, time.Hour, cacheTTLPolicyFor(policies, question("Example.com.", dns.TypeNS)).MinTTL, "the type-specific policy wins")
+	assert.Equal(t, time.Minute, cacheTTLPolicyFor(policies, question("www.example.com.", dns.TypeTXT)).MaxTTL, "the longer zone wins")
+	assert.Equal(t, CacheTTLPolicy{Zone: "corp.example.com.", Qtype: dns.TypeA}, cacheTTLPolicyFor(policies, question("host.corp.example.com.", dns.TypeA)))
+	assert.Equal(t, time.Minute, cacheTTLPolicyFor(policies, question("host.corp.example.com.", dns.TypeAAAA)).MaxTTL)
+}
+
+func TestCacheTTL_Policy(t *testing.T) {
+	q := new(dns.Msg).SetQuestion("host.example.com.", dns.TypeA)
+	positive := new(dns.Msg).SetReply(q)
+	positive.Answer = []dns.RR{cacheTestA("host.example.com.", 300)}
+	negative := new(dns.Msg).SetRcode(q, dns.RcodeNameError)
+	negative.Ns = []dns.RR{cacheTestSOA(3600, 120)}
+	servfail := new(dns.Msg).SetRcode(q, dns.RcodeServerFailure)
+
+	tests := []struct {
+		name   string
+		msg    *dns.Msg
+		policy CacheTTLPolicy
+		want   time.Duration
+	}{
+		{name: "honor", msg: positive, want: 300 * time.Second},
+		{name: "no-cache", msg: positive, policy: CacheTTLPolicy{NoCache: true}},
+		{name: "min raises", msg: positive, policy: CacheTTLPolicy{MinTTL: 2 * time.Hour}, want: 2 * time.Hour},
+		{name: "max lowers", msg: positive, policy: CacheTTLPolicy{MaxTTL: time.Minute}, want: time.Minute},
+		{name: "negative max", msg: negative, policy: CacheTTLPolicy{MaxTTL: time.Minute}, want: time.Minute},
+		{name: "uncacheable ignores min", msg: servfail, policy: CacheTTLPolicy{MinTTL: time.Hour}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, cacheTTL(tt.msg, tt.policy))
+		})
+	}
+}
+
+func TestResponseCache_TTLPolicies(t *testing.T) {
+	cache := newResponseCache(16)
+	cache.policies = ParseCacheTTLPolicies([]string{
+		"example.com A min=10m",
+		"example.com TXT no-cache",
+		"other.org * max=10s",
+	})
+	answer := func(name string, rr dns.RR) *dns.Msg {
+		m := new(dns.Msg).SetReply(new(dns.Msg).SetQuestion(name, rr.Header().Rrtype))
+		m.Answer = []dns.RR{rr}
+		return m
+	}
+	txt := func(name string) dns.RR {
+		return &dns.TXT{Hdr: dns.RR_Header{Name: name, Rrtype: dns.TypeTXT, Class: dns.ClassINET, Ttl: 60}, Txt: []string{"v"}}
+	}
+
+	cache.store(answer("host.example.com.", cacheTestA("host.example.com.", 60)))
+	cache.store(answer("host.example.com.", txt("host.example.com.")))
+	cache.store(answer("host.other.org.", cacheTestA("host.other.org.", 60)))
+	cache.store(answer("host.other.org.", txt("host.other.org.")))
+
+	resp := cache.lookup(new(dns.Msg).SetQuestion("host.example.com.", dns.TypeA))
+	require.NotNil(t, resp)
+	assert.Equal(t, uint32(600), resp.Answer[0].Header().Ttl, "the served TTL matches the time the answer is kept")
+	assert.Nil(t, cache.lookup(new(dns.Msg).SetQuestion("host.example.com.", dns.TypeTXT)))
+
+	for _, qtype := range []uint16{dns.TypeA, dns.TypeTXT} {
+		resp = cache.lookup(new(dns.Msg).SetQuestion("host.other.org.", qtype))
+		require.NotNil(t, resp)
+		assert.Equal(t, uint32(10), resp.Answer[0].Header().Ttl)
+	}
+
+	key := newStaleKey(dns.Question{Name: "host.example.com.", Qtype: dns.TypeA, Qclass: dns.ClassINET})
+	entry := cache.entries[key].Value.(*responseCacheEntry)
+	assert.WithinDuration(t, time.Now().Add(10*time.Minute), entry.expires, time.Second)
+}
@@ -0,0 +1,183 @@
+package dns
+
+import (
+	"fmt"
+	"net/netip"
+	"strings"
+	"sync/atomic"
+
+	"github.com/miekg/dns"
+	log "github.com/sirupsen/logrus"
+
+	"github.com/netbirdio/netbird/client/internal/dns/resutil"
+	"github.com/netbirdio/netbird/client/internal/dns/types"
+)
+
+// captivePortalTTL is the TTL of fixed captive-portal answers.
+const captivePortalTTL = 60
+
+// CaptivePortalPolicy selects how captive-portal-detection domains are answered.
+type CaptivePortalPolicy string
+
+const (
+	// CaptivePortalPassthrough forwards detection queries to the nameservers
+	// the host used before NetBird took over DNS.
+	CaptivePortalPassthrough CaptivePortalPolicy = "passthrough"
+	// CaptivePortalFixed answers detection queries with fixed addresses.
+	CaptivePortalFixed CaptivePortalPolicy = "fixed"
+)
+
+// DefaultCaptivePortalDomains are the connectivity-check domains probed by
+// common operating systems and browsers.
+var DefaultCaptivePortalDomains = []string{
+	"captive.apple.com",
+	"connectivitycheck.gstatic.com",
+	"clients3.google.com",
+	"www.msftconnecttest.com",
+	"www.msftncsi.com",
+	"dns.msftncsi.com",
+	"connectivity-check.ubuntu.com",
+	"nmcheck.gnome.org",
+	"detectportal.firefox.com",
+}
+
+// CaptivePortalConfig short-circuits captive-portal-detection domains so the
+// OS sign-in detection behaves the same on and off the mesh.
+type CaptivePortalConfig struct {
+	Policy CaptivePortalPolicy
+	// Domains are matched exactly. Empty uses DefaultCaptivePortalDomains.
+	Domains []string
+	// Addresses answer A and AAAA queries with CaptivePortalFixed.
+	Addresses []netip.Addr
+}
+
+// ParseCaptivePortalConfig builds a CaptivePortalConfig from its string
+// form. An empty policy disables the feature and returns nil.
+func ParseCaptivePortalConfig(policy string, domains, addresses []string) (*CaptivePortalConfig, error) {
+	if policy == "" {
+		return nil, nil
+	}
+
+	config := &CaptivePortalConfig{Policy: CaptivePortalPolicy(strings.ToLower(policy)), Domains: domains}
+	switch config.Policy {
+	case CaptivePortalPassthrough:
+	case CaptivePortalFixed:
+		for _, a := range addresses {
+			addr, err := netip.ParseAddr(a)
+			if err != nil {
+				return nil, fmt.Errorf("parse captive portal address %q: %w", a, err)
+			}
+			config.Addresses = append(config.Addresses, addr.Unmap())
+		}
+		if len(config.Addresses) == 0 {
+			return nil, fmt.Errorf("captive portal policy %q requires at least one address", policy)
+		}
+	default:
+		return nil, fmt.Errorf("unknown captive portal policy %q", policy)
+	}
+	return config, nil
+}
+
+// captivePortalResolver answers the configured detection domains according
+// to the policy, ahead of DNS routes and nameserver groups.
+type captivePortalResolver struct {
+	config CaptivePortalConfig
+	// passthrough is the handler for the host's original nameservers, nil
+	// while none is known.
+	passthrough atomic.Pointer[handlerWithStop]
+}
+
+func newCaptivePortalResolver(config CaptivePortalConfig) *captivePortalResolver {
+	if len(config.Domains) == 0 {
+		config.Domains = DefaultCaptivePortalDomains
+	}
+	return &captivePortalResolver{config: config}
+}
+
+// patterns returns the handler chain patterns the resolver is registered for.
+func (c *captivePortalResolver) patterns() []string {
+	patterns := make([]string, 0, len(c.config.Domains))
+	for _, d := range c.config.Domains {
+		patterns = append(patterns, strings.ToLower(dns.Fqdn(d)))
+	}
+	return patterns
+}
+
+// setPassthrough swaps the handler used by CaptivePortalPassthrough.
+func (c *captivePortalResolver) setPassthrough(h handlerWithStop) {
+	if h == nil {
+		c.passthrough.Store(nil)
+		return
+	}
+	c.passthrough.Store(&h)
+}
+
+func (c *captivePortalResolver) String() string {
+	return fmt.Sprintf("CaptivePortalResolver (%s)", c.config.Policy)
+}
+
+func (c *captivePortalResolver) ID() types.HandlerID {
+	return "captive-portal"
+}
+
+func (c *captivePortalResolver) Stop() {
+	// the passthrough handler is owned by the server
+}
+
+func (c *captivePortalResolver) ServeDNS(w dns.ResponseWriter, r *dns.Msg) {
+	if len(r.Question) == 0 {
+		return
+	}
+	resutil.SetMeta(w, "captive_portal", string(c.config.Policy))
+
+	if c.config.Policy == CaptivePortalFixed {
+		c.writeFixed(w, r)
+		return
+	}
+
+	if h := c.passthrough.Load(); h != nil {
+		(*h).ServeDNS(w, r)
+		return
+	}
+
+	// No original nameservers known: let lower-priority handlers answer.
+	resp := new(dns.Msg)
+	resp.SetRcode(r, dns.RcodeNameError)
+	resp.MsgHdr.Zero = true
+	if err := w.WriteMsg(resp); err != nil {
+		log.Errorf("failed to write captive portal continue signal: %v", err)
+	}
+}
+
+func (c *captivePortalResolver) writeFixed(w dns.ResponseWriter, r *dns.Msg) {
+	q := r.Question[0]
+	resp := new(dns.Msg)
+	resp.SetReply(r)
+	resp.Authoritative = true
+
+	hdr := dns.RR_Header{Name: q.Name, Rrtype: q.Qtype, Class: dns.ClassINET, Ttl: captivePortalTTL}
+	for _, addr := range c.config.Addresses {
+		switch {
+		case q.Qtype == dns.TypeA && addr.Is4():
+			resp.Answer = append(resp.Answer, &dns.A{Hdr: hdr, A: addr.AsSlice()})
+		case q.Qtype == dns.TypeAAAA && addr.Is6():
+			resp.Answer = append(resp.Answer, &dns.AAAA{Hdr: hdr, AAAA: addr.AsSlice()})
+		}
+	}
+
+	if err := w.WriteMsg(resp); err != nil {
+		log.Errorf("failed to write captive portal response for %s: %v", q.Name, err)
+	}
+}
+
+// enableCaptivePortal registers the captive-portal resolver for the
+// configured detection domains.
+func (s *DefaultServer) enableCaptivePortal(config CaptivePortalConfig) {
+	resolver := newCaptivePortalResolver(config)
+
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	s.captivePortal = resolver
+	resolver.setPassthrough(s.fallbackHandler)
+	s.registerHandler(resolver.patterns(), resolver, PriorityCaptivePortal)
+}
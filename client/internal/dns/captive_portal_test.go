@@ -0,0 +1,108 @@
+package dns
+
+import (
+	"net"
+	"net/netip"
+	"testing"
+
+	"github.com/miekg/dns"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/netbirdio/netbird/client/internal/dns/test"
+	"github.com/netbirdio/netbird/client/internal/dns/types"
+	"github.com/netbirdio/netbird/shared/management/domain"
+)
+
+// staticAnswerHandler answers every A query with addr.
+type staticAnswerHandler struct {
+	addr string
+}
+
+func (h *staticAnswerHandler) ServeDNS(w dns.ResponseWriter, r *dns.Msg) {
+	resp := new(dns.Msg).SetReply(r)
+	resp.Answer = append(resp.Answer, &dns.A{
+		Hdr: dns.RR_Header{Name: r.Question[0].Name, Rrtype: dns.TypeA, Class: dns.ClassINET, Ttl: 60},
+		A:   net.ParseIP(h.addr),
+	})
+	_ = w.WriteMsg(resp)
+}
+func (h *staticAnswerHandler) Stop()               {}
+func (h *staticAnswerHandler) ID() types.HandlerID { return types.HandlerID("static-" + h.addr) }
+
+func TestParseCaptivePortalConfig(t *testing.T) {
+	config, err := ParseCaptivePortalConfig("", nil, nil)
+	require.NoError(t, err)
+	assert.Nil(t, config, "empty policy disables the feature")
+
+	config, err = ParseCaptivePortalConfig("Passthrough", []string{"check.example.com"}, nil)
+	require.NoError(t, err)
+	assert.Equal(t, &CaptivePortalConfig{Policy: CaptivePortalPassthrough, Domains: []string{"check.example.com"}}, config)
+
+	config, err = ParseCaptivePortalConfig("fixed", nil, []string{"192.0.2.1", "2001:db8::1"})
+	require.NoError(t, err)
+	assert.Equal(t, []netip.Addr{netip.MustParseAddr("192.0.2.1"), netip.MustParseAddr("2001:db8::1")}, config.Addresses)
+
+	_, err = ParseCaptivePortalConfig("fixed", nil, nil)
+	assert.Error(t, err, "fixed policy without addresses")
+	_, err = ParseCaptivePortalConfig("fixed", nil, []string{"not-an-ip"})
+	assert.Error(t, err)
+	_, err = ParseCaptivePortalConfig("block", nil, nil)
+	assert.Error(t, err)
+}
+
+func captivePortalQuery(t *testing.T, server *DefaultServer, name string, qtype uint16) *dns.Msg {
+	t.Helper()
+	w := &test.MockResponseWriter{}
+	server.handlerChain.ServeDNS(w, new(dns.Msg).SetQuestion(name, qtype))
+	resp := w.GetLastResponse()
+	require.NotNil(t, resp)
+	return resp
+}
+
+func TestCaptivePortal_FixedAnswer(t *testing.T) {
+	server := newTestServer(nil)
+	// A DNS route for the detection domain must not win over the policy.
+	server.RegisterHandler(domain.List{"captive.apple.com"}, &staticAnswerHandler{addr: "10.0.0.1"}, PriorityDNSRoute)
+	server.enableCaptivePortal(CaptivePortalConfig{
+		Policy:    CaptivePortalFixed,
+		Addresses: []netip.Addr{netip.MustParseAddr("192.0.2.1")},
+	})
+
+	resp := captivePortalQuery(t, server, "captive.apple.com.", dns.TypeA)
+	require.Len(t, resp.Answer, 1)
+	assert.Equal(t, "192.0.2.1", resp.Answer[0].(*dns.A).A.String())
+
+	resp = captivePortalQuery(t, server, "captive.apple.com.", dns.TypeAAAA)
+	assert.Equal(t, dns.RcodeSuccess, resp.Rcode)
+	assert.Empty(t, resp.Answer, "no IPv6 address configured")
+
+	// Only the listed names are matched, not their subdomains.
+	resp = captivePortalQuery(t, server, "www.captive.apple.com.", dns.TypeA)
+	assert.Equal(t, dns.RcodeRefused, resp.Rcode)
+}
+
+func TestCaptivePortal_Passthrough(t *testing.T) {
+	server := newTestServer(nil)
+	server.registerHandler([]string{"."}, &staticAnswerHandler{addr: "10.0.0.1"}, PriorityUpstream)
+	server.enableCaptivePortal(CaptivePortalConfig{
+		Policy:  CaptivePortalPassthrough,
+		Domains: []string{"check.example.com"},
+	})
+
+	// Without original nameservers the query continues down the chain.
+	resp := captivePortalQuery(t, server, "check.example.com.", dns.TypeA)
+	require.Len(t, resp.Answer, 1)
+	assert.Equal(t, "10.0.0.1", resp.Answer[0].(*dns.A).A.String())
+
+	server.fallbackHandler = &staticAnswerHandler{addr: "198.51.100.1"}
+	server.captivePortal.setPassthrough(server.fallbackHandler)
+	resp = captivePortalQuery(t, server, "check.example.com.", dns.TypeA)
+	require.Len(t, resp.Answer, 1)
+	assert.Equal(t, "198.51.100.1", resp.Answer[0].(*dns.A).A.String(), "detection queries go to the original nameservers")
+
+	server.clearFallback()
+	resp = captivePortalQuery(t, server, "check.example.com.", dns.TypeA)
+	require.Len(t, resp.Answer, 1)
+	assert.Equal(t, "10.0.0.1", resp.Answer[0].(*dns.A).A.String())
+}
@@ -0,0 +1,96 @@
+package dns
+
+import (
+	"net/netip"
+
+	"github.com/miekg/dns"
+)
+
+// clientSubnetPolicy is how the EDNS0 client subnet option (RFC 7871) of
+// the queries forwarded to an upstream is treated. The zero value strips
+// it, so client addresses only reach upstreams the operator opted in for.
+type clientSubnetPolicy struct {
+	// forward lets the option of client queries through.
+	forward bool
+	// fallback, if valid, is sent for queries without the option.
+	fallback netip.Prefix
+}
+
+// apply enforces the policy on the query r, which must carry an OPT
+// record. It reports whether it added the fallback subnet, which the
+// client then must not see in the response.
+func (p clientSubnetPolicy) apply(r *dns.Msg) bool {
+	opt := r.IsEdns0()
+	if opt == nil {
+		return false
+	}
+
+	hasSubnet := false
+	kept := opt.Option[:0]
+	for _, o := range opt.Option {
+		if o.Option() == dns.EDNS0SUBNET {
+			if !p.forward {
+				continue
+			}
+			hasSubnet = true
+		}
+		kept = append(kept, o)
+	}
+	clear(opt.Option[len(kept):])
+	opt.Option = kept
+
+	if hasSubnet || !p.fallback.IsValid() {
+		return false
+	}
+	opt.Option = append(opt.Option, newClientSubnet(p.fallback))
+	return true
+}
+
+// newClientSubnet returns the client subnet option for prefix.
+func newClientSubnet(prefix netip.Prefix) *dns.EDNS0_SUBNET {
+	prefix = prefix.Masked()
+	family := uint16(1)
+	if prefix.Addr().Is6() {
+		family = 2
+	}
+	return &dns.EDNS0_SUBNET{
+		Code:          dns.EDNS0SUBNET,
+		Family:        family,
+		SourceNetmask: uint8(prefix.Bits()),
+		Address:       prefix.Addr().AsSlice(),
+	}
+}
+
+// hasClientSubnet reports whether msg carries the client subnet option.
+func hasClientSubnet(msg *dns.Msg) bool {
+	opt := msg.IsEdns0()
+	if opt == nil {
+		return false
+	}
+	for _, o := range opt.Option {
+		if o.Option() == dns.EDNS0SUBNET {
+			return true
+		}
+	}
+	return false
+}
+
+// stripClientSubnet removes the client subnet option from msg.
+func stripClientSubnet(msg *dns.Msg) {
+	clientSubnetPolicy{}.apply(msg)
+}
+
+// setClientSubnet applies the client subnet policy of a nameserver group
+// to the queries forwarded to servers. Called only while the handler is
+// built.
+func (u *upstreamResolverBase) setClientSubnet(servers []netip.AddrPort, forward bool, fallback netip.Prefix) {
+	if !forward && !fallback.IsValid() {
+		return
+	}
+	if u.clientSubnets == nil {
+		u.clientSubnets = make(map[netip.AddrPort]clientSubnetPolicy, len(servers))
+	}
+	for _, s := range servers {
+		u.clientSubnets[s] = clientSubnetPolicy{forward: forward, fallback: fallback}
+	}
+}
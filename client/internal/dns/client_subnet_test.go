@@ -0,0 +1,120 @@
+package dns
+
+import (
+	"context"
+	"net/netip"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/miekg/dns"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/netbirdio/netbird/client/internal/dns/test"
+)
+
+// clientSubnetClient records the client subnet of the forwarded query and
+// answers with a client subnet with a scope, as ECS-aware upstreams do.
+type clientSubnetClient struct {
+	mu   sync.Mutex
+	sent *dns.EDNS0_SUBNET
+}
+
+func (c *clientSubnetClient) exchange(_ context.Context, _ string, r *dns.Msg) (*dns.Msg, time.Duration, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.sent = clientSubnetOf(r)
+
+	m := buildMockResponse(dns.RcodeSuccess, "192.0.2.100")
+	m.SetEdns0(dns.DefaultMsgSize, false)
+	if c.sent != nil {
+		ecs := *c.sent
+		ecs.SourceScope = ecs.SourceNetmask
+		m.IsEdns0().Option = []dns.EDNS0{&ecs}
+	}
+	return m, time.Millisecond, nil
+}
+
+func clientSubnetOf(m *dns.Msg) *dns.EDNS0_SUBNET {
+	opt := m.IsEdns0()
+	if opt == nil {
+		return nil
+	}
+	for _, o := range opt.Option {
+		if ecs, ok := o.(*dns.EDNS0_SUBNET); ok {
+			return ecs
+		}
+	}
+	return nil
+}
+
+func subnetString(ecs *dns.EDNS0_SUBNET) string {
+	if ecs == nil {
+		return ""
+	}
+	addr, _ := netip.AddrFromSlice(ecs.Address)
+	return netip.PrefixFrom(addr.Unmap(), int(ecs.SourceNetmask)).String()
+}
+
+func TestUpstreamResolver_ClientSubnet(t *testing.T) {
+	upstream := netip.MustParseAddrPort("192.0.2.1:53")
+	fallback := netip.MustParsePrefix("10.1.2.3/16")
+
+	tests := []struct {
+		name         string
+		forward      bool
+		fallback     netip.Prefix
+		clientSubnet string
+		wantSent     string
+		wantReturned string
+	}{
+		{name: "not opted in", clientSubnet: "198.51.100.0/24"},
+		{name: "forwarded", forward: true, clientSubnet: "198.51.100.0/24", wantSent: "198.51.100.0/24", wantReturned: "198.51.100.0/24"},
+		{name: "fallback", fallback: fallback, wantSent: "10.1.0.0/16"},
+		{name: "client subnet wins", forward: true, fallback: fallback, clientSubnet: "198.51.100.0/24", wantSent: "198.51.100.0/24", wantReturned: "198.51.100.0/24"},
+		{name: "fallback replaces unforwarded", fallback: fallback, clientSubnet: "198.51.100.0/24", wantSent: "10.1.0.0/16"},
+		{name: "ipv6 fallback", fallback: netip.MustParsePrefix("2001:db8:1::/48"), wantSent: "2001:db8:1::/48"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+
+			client := &clientSubnetClient{}
+			resolver := &upstreamResolverBase{
+				ctx:             ctx,
+				upstreamClient:  client,
+				upstreamTimeout: UpstreamTimeout,
+			}
+			resolver.addRace([]netip.AddrPort{upstream})
+			resolver.setClientSubnet([]netip.AddrPort{upstream}, tt.forward, tt.fallback)
+
+			q := new(dns.Msg).SetQuestion("example.com.", dns.TypeA)
+			q.SetEdns0(dns.DefaultMsgSize, false)
+			if tt.clientSubnet != "" {
+				q.IsEdns0().Option = []dns.EDNS0{newClientSubnet(netip.MustParsePrefix(tt.clientSubnet))}
+			}
+
+			w := &test.MockResponseWriter{}
+			resolver.ServeDNS(w, q)
+			resp := w.GetLastResponse()
+			require.NotNil(t, resp)
+
+			client.mu.Lock()
+			defer client.mu.Unlock()
+			assert.Equal(t, tt.wantSent, subnetString(client.sent), "client subnet sent to the upstream")
+			assert.Equal(t, tt.wantReturned, subnetString(clientSubnetOf(resp)), "client subnet returned to the client")
+			assert.Equal(t, tt.clientSubnet, subnetString(clientSubnetOf(q)), "the client request must not be modified")
+		})
+	}
+}
+
+func TestCacheable_ClientSubnet(t *testing.T) {
+	q := new(dns.Msg).SetQuestion("example.com.", dns.TypeA)
+	q.SetEdns0(dns.DefaultMsgSize, false)
+	assert.True(t, cacheable(q))
+
+	q.IsEdns0().Option = []dns.EDNS0{newClientSubnet(netip.MustParsePrefix("198.51.100.0/24"))}
+	assert.False(t, cacheable(q), "answers tailored to a client subnet aren't shared")
+}
@@ -0,0 +1,123 @@
+package dns
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+
+	log "github.com/sirupsen/logrus"
+
+	nbdns "github.com/netbirdio/netbird/dns"
+)
+
+// overrideFile is the format of a local DNS config override file.
+type overrideFile struct {
+	// Serial is compared against management update serials: updates up to
+	// and including it are held back, a higher one replaces the override.
+	// Zero keeps the override until it is cleared.
+	Serial uint64       `json:"serial"`
+	Config nbdns.Config `json:"config"`
+}
+
+// configOverride is a locally loaded DNS config superseding management.
+type configOverride struct {
+	path   string
+	serial uint64
+	// mgmt is the latest management update, applied again when the
+	// override is cleared. Nil if none was received yet.
+	mgmt *pendingDNSUpdate
+}
+
+// supersededBy reports whether a management update with serial replaces
+// the override.
+func (o *configOverride) supersededBy(serial uint64) bool {
+	return o.serial != 0 && serial > o.serial
+}
+
+// LoadConfigOverride applies the DNS config in the JSON file at path in
+// place of the management one, e.g. to test nameserver groups on a single
+// peer. Management updates are held back until ClearConfigOverride or an
+// update with a serial above the one in the file. Loading is refused while
+// updates are frozen.
+func (s *DefaultServer) LoadConfigOverride(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("read dns config override: %w", err)
+	}
+	var file overrideFile
+	if err := json.Unmarshal(data, &file); err != nil {
+		return fmt.Errorf("unmarshal dns config override: %w", err)
+	}
+
+	s.mux.Lock()
+	defer s.mux.Unlock()
+
+	if s.frozen {
+		return fmt.Errorf("dns updates are frozen")
+	}
+	if s.override == nil && file.Serial != 0 && file.Serial < s.updateSerial {
+		return fmt.Errorf("dns config override serial %d is behind the last applied update %d", file.Serial, s.updateSerial)
+	}
+
+	override := &configOverride{path: path, serial: file.Serial}
+	if s.override != nil {
+		override.mgmt = s.override.mgmt
+	} else if s.updateSerial != 0 {
+		override.mgmt = &pendingDNSUpdate{serial: s.updateSerial, config: s.appliedConfig}
+	}
+
+	err = s.applyConfiguration(file.Serial, file.Config)
+	if err != nil && !onlyHostConfigFailed(err) {
+		return fmt.Errorf("apply configuration: %w", err)
+	}
+	s.appliedConfig = file.Config
+	hash, hashErr := s.hashUpdate(file.Config)
+	s.setPreviousConfigHash(hash, errors.Join(hashErr, err))
+
+	log.Infof("DNS config override loaded from %s with serial %d", path, file.Serial)
+	s.override = override
+	s.setOverrideStatus(path)
+	if err != nil {
+		return fmt.Errorf("apply configuration: %w", err)
+	}
+	return nil
+}
+
+// ClearConfigOverride drops the override loaded by LoadConfigOverride and
+// applies the latest management update again. Clearing is refused while
+// updates are frozen.
+func (s *DefaultServer) ClearConfigOverride() error {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+
+	if s.override == nil {
+		return nil
+	}
+	if s.frozen {
+		return fmt.Errorf("dns updates are frozen")
+	}
+
+	mgmt := s.override.mgmt
+	s.dropOverride()
+	if mgmt == nil {
+		return nil
+	}
+	if s.ctx.Err() != nil {
+		return s.ctx.Err()
+	}
+	return s.applyUpdate(mgmt.serial, mgmt.config)
+}
+
+// dropOverride forgets the active override. Must be called with s.mux held.
+func (s *DefaultServer) dropOverride() {
+	log.Infof("DNS config override from %s cleared", s.override.path)
+	s.override = nil
+	s.setOverrideStatus("")
+}
+
+func (s *DefaultServer) setOverrideStatus(path string) {
+	if s.statusRecorder != nil {
+		s.statusRecorder.UpdateDNSConfigOverride(path)
+	}
+}
@@ -0,0 +1,116 @@
+package dns
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/miekg/dns"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	nbdns "github.com/netbirdio/netbird/dns"
+)
+
+func zoneConfig(zone string) nbdns.Config {
+	return nbdns.Config{
+		ServiceEnable: true,
+		CustomZones: []nbdns.CustomZone{{
+			Domain: zone,
+			Records: []nbdns.SimpleRecord{
+				{Name: "peer." + zone, Type: int(dns.TypeA), Class: nbdns.DefaultClass, TTL: 300, RData: "100.64.0.1"},
+			},
+		}},
+	}
+}
+
+func writeOverride(t *testing.T, serial uint64, config nbdns.Config) string {
+	t.Helper()
+	data, err := json.Marshal(overrideFile{Serial: serial, Config: config})
+	require.NoError(t, err)
+	path := filepath.Join(t.TempDir(), "dns-override.json")
+	require.NoError(t, os.WriteFile(path, data, 0o600))
+	return path
+}
+
+func TestDefaultServer_ConfigOverridePrecedence(t *testing.T) {
+	t.Run("held back until cleared", func(t *testing.T) {
+		server := newTestServer(nil)
+		require.NoError(t, server.UpdateDNSServer(1, zoneConfig("mgmt.cloud.")))
+
+		path := writeOverride(t, 5, zoneConfig("override.cloud."))
+		require.NoError(t, server.LoadConfigOverride(path))
+		assert.Equal(t, zoneConfig("override.cloud."), server.appliedConfig)
+		assert.Equal(t, path, server.statusRecorder.GetDNSConfigOverride(), "override should be flagged in status")
+
+		require.NoError(t, server.UpdateDNSServer(3, zoneConfig("second.cloud.")))
+		require.NoError(t, server.UpdateDNSServer(5, zoneConfig("third.cloud.")))
+		assert.Equal(t, zoneConfig("override.cloud."), server.appliedConfig, "updates up to the override serial must not replace it")
+
+		require.NoError(t, server.ClearConfigOverride())
+		assert.Equal(t, zoneConfig("third.cloud."), server.appliedConfig, "clearing should apply the latest management update")
+		assert.Equal(t, uint64(5), server.updateSerial)
+		assert.Empty(t, server.statusRecorder.GetDNSConfigOverride())
+
+		require.NoError(t, server.ClearConfigOverride(), "clearing twice should be a no-op")
+	})
+
+	t.Run("cleared without management updates", func(t *testing.T) {
+		server := newTestServer(nil)
+		require.NoError(t, server.UpdateDNSServer(1, zoneConfig("mgmt.cloud.")))
+
+		require.NoError(t, server.LoadConfigOverride(writeOverride(t, 5, zoneConfig("override.cloud."))))
+		require.NoError(t, server.ClearConfigOverride())
+		assert.Equal(t, zoneConfig("mgmt.cloud."), server.appliedConfig, "the config from before the override should be restored")
+	})
+
+	t.Run("superseded by a newer serial", func(t *testing.T) {
+		server := newTestServer(nil)
+		require.NoError(t, server.LoadConfigOverride(writeOverride(t, 5, zoneConfig("override.cloud."))))
+
+		require.NoError(t, server.UpdateDNSServer(6, zoneConfig("newer.cloud.")))
+		assert.Equal(t, zoneConfig("newer.cloud."), server.appliedConfig)
+		assert.Equal(t, uint64(6), server.updateSerial)
+		assert.Empty(t, server.statusRecorder.GetDNSConfigOverride(), "a superseded override should no longer be flagged")
+		assert.Nil(t, server.override)
+	})
+
+	t.Run("zero serial is kept until cleared", func(t *testing.T) {
+		server := newTestServer(nil)
+		require.NoError(t, server.LoadConfigOverride(writeOverride(t, 0, zoneConfig("override.cloud."))))
+
+		require.NoError(t, server.UpdateDNSServer(100, zoneConfig("mgmt.cloud.")))
+		assert.Equal(t, zoneConfig("override.cloud."), server.appliedConfig)
+
+		require.NoError(t, server.ClearConfigOverride())
+		assert.Equal(t, zoneConfig("mgmt.cloud."), server.appliedConfig)
+	})
+
+	t.Run("stale override serial", func(t *testing.T) {
+		server := newTestServer(nil)
+		require.NoError(t, server.UpdateDNSServer(10, zoneConfig("mgmt.cloud.")))
+
+		assert.Error(t, server.LoadConfigOverride(writeOverride(t, 5, zoneConfig("override.cloud."))))
+		assert.Equal(t, zoneConfig("mgmt.cloud."), server.appliedConfig)
+		assert.Nil(t, server.override)
+	})
+
+	t.Run("frozen", func(t *testing.T) {
+		server := newTestServer(nil)
+		server.Freeze()
+		assert.Error(t, server.LoadConfigOverride(writeOverride(t, 5, zoneConfig("override.cloud."))), "overrides must not bypass the freeze")
+		assert.Nil(t, server.override)
+	})
+}
+
+func TestDefaultServer_LoadConfigOverrideInvalidFile(t *testing.T) {
+	server := newTestServer(nil)
+
+	assert.Error(t, server.LoadConfigOverride(filepath.Join(t.TempDir(), "missing.json")))
+
+	path := filepath.Join(t.TempDir(), "invalid.json")
+	require.NoError(t, os.WriteFile(path, []byte("not json"), 0o600))
+	assert.Error(t, server.LoadConfigOverride(path))
+	assert.Nil(t, server.override)
+}
@@ -0,0 +1,203 @@
+package dns
+
+import (
+	"context"
+	"net/netip"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/miekg/dns"
+	log "github.com/sirupsen/logrus"
+
+	nbdns "github.com/netbirdio/netbird/dns"
+	"github.com/netbirdio/netbird/shared/management/domain"
+)
+
+const (
+	// diagnosticsParallelism bounds the nameservers probed at once.
+	diagnosticsParallelism = 8
+	// diagnosticsProbeName is resolved through primary and fallback
+	// nameservers, which have no match domain to query.
+	diagnosticsProbeName = "netbird.io."
+)
+
+// DiagnosticsReport is the outcome of probing every configured nameserver,
+// see DefaultServer.RunDiagnostics.
+type DiagnosticsReport struct {
+	Started  time.Time
+	Duration time.Duration
+	// Groups are the nameserver groups in configuration order, followed by
+	// the fallback servers if any.
+	Groups []NSGroupDiagnostics
+}
+
+// NSGroupDiagnostics holds the probes of the nameservers of one group.
+type NSGroupDiagnostics struct {
+	// ID matches peer.NSGroupState.ID, empty for the fallback servers.
+	ID       string
+	Domains  []string
+	Primary  bool
+	Fallback bool
+	Servers  []UpstreamDiagnostics
+}
+
+// UpstreamDiagnostics is the outcome of a sample query to one nameserver.
+type UpstreamDiagnostics struct {
+	Server netip.AddrPort
+	// Query is the sample query, e.g. "example.com. SOA".
+	Query string
+	// Reachable is set if the nameserver answered, whatever the rcode.
+	Reachable bool
+	Latency   time.Duration
+	Protocol  string
+	Rcode     string
+	// Answers are the answer records of the sample query.
+	Answers []string
+	Error   string
+}
+
+// Healthy reports whether every probed nameserver of the group answered
+// without a failure.
+func (g NSGroupDiagnostics) Healthy() bool {
+	for _, server := range g.Servers {
+		if server.Error != "" {
+			return false
+		}
+	}
+	return true
+}
+
+// diagnosticsProbe is one nameserver to query with its group's throwaway
+// resolver.
+type diagnosticsProbe struct {
+	resolver *upstreamResolverBase
+	server   netip.AddrPort
+	question dns.Question
+	result   *UpstreamDiagnostics
+}
+
+// RunDiagnostics sends a sample query to every nameserver of the configured
+// groups and to the fallback servers, at most diagnosticsParallelism at a
+// time. The queries go through resolvers built for the probes only, so the
+// registered handlers, the upstream health and the status are left as they
+// are.
+func (s *DefaultServer) RunDiagnostics(ctx context.Context) DiagnosticsReport {
+	report := DiagnosticsReport{Started: time.Now()}
+
+	var probes []*diagnosticsProbe
+	var resolvers []*upstreamResolverBase
+	addGroup := func(group NSGroupDiagnostics, nsGroup *nbdns.NameServerGroup, servers []netip.AddrPort, question dns.Question) {
+		handler, err := newUpstreamResolver(ctx, s.wgInterface, s.statusRecorder, s.hostsDNSHolder, domain.Domain(question.Name))
+		if err != nil {
+			log.Errorf("failed to create diagnostics resolver for %v: %v", group.Domains, err)
+			return
+		}
+		resolver := handler.upstreamResolverBase
+		resolver.selectedRoutes = s.selectedRoutes
+		resolvers = append(resolvers, resolver)
+		if nsGroup != nil {
+			resolver.setEDNSAllowlist(servers, s.ednsAllowlistFor(nsGroup))
+			resolver.setQueryTimeout(servers, nsGroup.QueryTimeout)
+			if nsGroup.AuthoritativeOnly {
+				resolver.setNonRecursive(servers)
+			}
+			if doq := nameServersOfType(nsGroup.NameServers, servers, nbdns.DOQNameServerType); len(doq) > 0 {
+				resolver.setDoQ(doq)
+			}
+			if dot := nameServersOfType(nsGroup.NameServers, servers, nbdns.DOTNameServerType); len(dot) > 0 {
+				resolver.setDoT(dot, nameServerHostnames(nsGroup.NameServers))
+			}
+			if tcp := nameServersOfType(nsGroup.NameServers, servers, nbdns.TCPNameServerType); len(tcp) > 0 {
+				resolver.setTCP(tcp)
+			}
+		}
+
+		group.Servers = make([]UpstreamDiagnostics, len(servers))
+		report.Groups = append(report.Groups, group)
+		results := report.Groups[len(report.Groups)-1].Servers
+		for i, server := range servers {
+			probes = append(probes, &diagnosticsProbe{resolver: resolver, server: server, question: question, result: &results[i]})
+		}
+	}
+
+	s.mux.Lock()
+	for _, nsGroup := range s.nsGroups {
+		servers := s.usableNameServers(nsGroup.NameServers)
+		if len(servers) == 0 {
+			continue
+		}
+		addGroup(NSGroupDiagnostics{
+			ID:      string(generateGroupKey(nsGroup)),
+			Domains: nsGroup.Domains,
+			Primary: nsGroup.Primary,
+		}, nsGroup, servers, probeQuestion(nsGroup))
+	}
+	if s.hostManager != nil {
+		if servers := s.fallbackServers(); len(servers) > 0 {
+			addGroup(NSGroupDiagnostics{Fallback: true}, nil, servers,
+				dns.Question{Name: diagnosticsProbeName, Qtype: dns.TypeA, Qclass: dns.ClassINET})
+		}
+	}
+	s.mux.Unlock()
+
+	defer func() {
+		for _, resolver := range resolvers {
+			resolver.Stop()
+		}
+	}()
+
+	var wg sync.WaitGroup
+	sem := make(chan struct{}, diagnosticsParallelism)
+	for _, probe := range probes {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func() {
+			defer wg.Done()
+			defer func() { <-sem }()
+			probe.run(ctx)
+		}()
+	}
+	wg.Wait()
+
+	report.Duration = time.Since(report.Started)
+	return report
+}
+
+// probeQuestion returns the sample query sent to the nameservers of group:
+// the SOA of its first match domain, or diagnosticsProbeName for groups
+// without one.
+func probeQuestion(group *nbdns.NameServerGroup) dns.Question {
+	if len(group.Domains) > 0 {
+		return dns.Question{Name: dns.Fqdn(group.Domains[0]), Qtype: dns.TypeSOA, Qclass: dns.ClassINET}
+	}
+	return dns.Question{Name: diagnosticsProbeName, Qtype: dns.TypeA, Qclass: dns.ClassINET}
+}
+
+func (p *diagnosticsProbe) run(ctx context.Context) {
+	r := new(dns.Msg)
+	r.Id = dns.Id()
+	r.RecursionDesired = true
+	r.Question = []dns.Question{p.question}
+
+	*p.result = UpstreamDiagnostics{
+		Server: p.server,
+		Query:  p.question.Name + " " + dns.TypeToString[p.question.Qtype],
+	}
+
+	start := time.Now()
+	res, failure := p.resolver.queryUpstream(ctx, r, p.server, p.resolver.timeoutFor(p.server, p.resolver.upstreamTimeout))
+	p.result.Latency = time.Since(start)
+
+	if failure != nil {
+		p.result.Reachable = !failure.network
+		p.result.Error = failure.reason
+		return
+	}
+	p.result.Reachable = true
+	p.result.Protocol = res.protocol
+	p.result.Rcode = dns.RcodeToString[res.msg.Rcode]
+	for _, rr := range res.msg.Answer {
+		p.result.Answers = append(p.result.Answers, strings.ReplaceAll(rr.String(), "\t", " "))
+	}
+}
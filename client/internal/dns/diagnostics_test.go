@@ -0,0 +1,130 @@
+package dns
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/netip"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/miekg/dns"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	nbdns "github.com/netbirdio/netbird/dns"
+)
+
+// startDiagnosticsNameserver serves SOA records of every zone, or answers
+// with rcode if it isn't zero. It tracks the most queries handled at once.
+func startDiagnosticsNameserver(t *testing.T, rcode int, maxInflight *atomic.Int32) netip.AddrPort {
+	t.Helper()
+
+	var inflight atomic.Int32
+	pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+	require.NoError(t, err)
+	server := &dns.Server{PacketConn: pc, Net: "udp", Handler: dns.HandlerFunc(func(w dns.ResponseWriter, r *dns.Msg) {
+		if maxInflight != nil {
+			n := inflight.Add(1)
+			defer inflight.Add(-1)
+			for {
+				current := maxInflight.Load()
+				if n <= current || maxInflight.CompareAndSwap(current, n) {
+					break
+				}
+			}
+			time.Sleep(20 * time.Millisecond)
+		}
+
+		m := new(dns.Msg).SetRcode(r, rcode)
+		if rcode == dns.RcodeSuccess && r.Question[0].Qtype == dns.TypeSOA {
+			m.Answer = append(m.Answer, &dns.SOA{
+				Hdr:    dns.RR_Header{Name: r.Question[0].Name, Rrtype: dns.TypeSOA, Class: dns.ClassINET, Ttl: 60},
+				Ns:     "ns1." + r.Question[0].Name,
+				Mbox:   "admin." + r.Question[0].Name,
+				Serial: 1,
+			})
+		}
+		_ = w.WriteMsg(m)
+	})}
+	go func() { _ = server.ActivateAndServe() }()
+	t.Cleanup(func() { _ = server.Shutdown() })
+
+	return netip.MustParseAddrPort(pc.LocalAddr().String())
+}
+
+// diagnosticsService is a mockService that isn't on the loopback address
+// the test nameservers listen on.
+type diagnosticsService struct {
+	mockService
+}
+
+func (s *diagnosticsService) RuntimeIP() netip.Addr { return netip.MustParseAddr("192.0.2.254") }
+
+func nameServerAt(addr netip.AddrPort) nbdns.NameServer {
+	return nbdns.NameServer{IP: addr.Addr(), NSType: nbdns.UDPNameServerType, Port: int(addr.Port())}
+}
+
+func TestDefaultServer_RunDiagnostics(t *testing.T) {
+	good := startDiagnosticsNameserver(t, dns.RcodeSuccess, nil)
+	failing := startDiagnosticsNameserver(t, dns.RcodeServerFailure, nil)
+
+	server := newTestServer(nil)
+	server.service = &diagnosticsService{}
+	server.nsGroups = []*nbdns.NameServerGroup{
+		{Domains: []string{"corp.example.com"}, NameServers: []nbdns.NameServer{nameServerAt(good), nameServerAt(failing)}},
+		{Domains: []string{"lab.example.com"}, NameServers: []nbdns.NameServer{nameServerAt(good)}},
+	}
+	server.dnsMuxHandlers = []handlerWrapper{{domain: "corp.example.com", handler: &healthStubHandler{}, priority: PriorityUpstream}}
+
+	report := server.RunDiagnostics(context.Background())
+	require.Len(t, report.Groups, 2)
+
+	corp := report.Groups[0]
+	assert.Equal(t, []string{"corp.example.com"}, corp.Domains)
+	assert.Equal(t, string(generateGroupKey(server.nsGroups[0])), corp.ID)
+	assert.False(t, corp.Healthy())
+	require.Len(t, corp.Servers, 2)
+
+	assert.Equal(t, good, corp.Servers[0].Server)
+	assert.Equal(t, "corp.example.com. SOA", corp.Servers[0].Query)
+	assert.True(t, corp.Servers[0].Reachable)
+	assert.Empty(t, corp.Servers[0].Error)
+	assert.Equal(t, "NOERROR", corp.Servers[0].Rcode)
+	require.Len(t, corp.Servers[0].Answers, 1)
+	assert.Contains(t, corp.Servers[0].Answers[0], "ns1.corp.example.com.")
+	assert.Positive(t, corp.Servers[0].Latency)
+
+	assert.Equal(t, failing, corp.Servers[1].Server)
+	assert.True(t, corp.Servers[1].Reachable, "a SERVFAIL answer means the server is reachable")
+	assert.Equal(t, "SERVFAIL", corp.Servers[1].Error)
+
+	assert.True(t, report.Groups[1].Healthy())
+
+	assert.Len(t, server.dnsMuxHandlers, 1, "the registered handlers are left alone")
+	assert.Empty(t, server.statusRecorder.GetDNSStates(), "the status is left alone")
+	assert.False(t, server.upstreamHistory.failing(failing))
+}
+
+func TestDefaultServer_RunDiagnosticsParallelism(t *testing.T) {
+	var maxInflight atomic.Int32
+	addr := startDiagnosticsNameserver(t, dns.RcodeSuccess, &maxInflight)
+
+	server := newTestServer(nil)
+	server.service = &diagnosticsService{}
+	for i := range 3 * diagnosticsParallelism {
+		server.nsGroups = append(server.nsGroups, &nbdns.NameServerGroup{
+			Domains:     []string{fmt.Sprintf("zone%d.example.com", i)},
+			NameServers: []nbdns.NameServer{nameServerAt(addr)},
+		})
+	}
+
+	report := server.RunDiagnostics(context.Background())
+	require.Len(t, report.Groups, 3*diagnosticsParallelism)
+	for _, group := range report.Groups {
+		assert.True(t, group.Healthy(), "group %v", group.Domains)
+	}
+	assert.LessOrEqual(t, maxInflight.Load(), int32(diagnosticsParallelism))
+	assert.Greater(t, maxInflight.Load(), int32(1), "servers are probed concurrently")
+}
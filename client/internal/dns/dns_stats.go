@@ -0,0 +1,136 @@
+package dns
+
+import (
+	"net/netip"
+	"slices"
+	"sync/atomic"
+	"time"
+
+	"github.com/netbirdio/netbird/client/internal/dns/types"
+)
+
+// DnsStats is a point-in-time view of the DNS service, for status pages
+// polling it instead of subscribing to service events.
+type DnsStats struct {
+	// Groups are the nameserver groups of the last health evaluation.
+	Groups []GroupStats
+	// Handlers are the handlers of the chain, from the highest priority
+	// down.
+	Handlers []HandlerStats
+}
+
+// GroupStats is the state of a nameserver group.
+type GroupStats struct {
+	ID      string
+	Domains []string
+	Servers []netip.AddrPort
+	Enabled bool
+	// LastError is the most recent query failure of one of the servers,
+	// empty if none failed yet.
+	LastError string
+	// LastProbe is when one of the servers last answered or failed a
+	// query, zero if none was queried yet.
+	LastProbe time.Time
+}
+
+// HandlerStats counts the queries a handler answered since it was
+// registered. Queries it passed on to the next handler aren't counted.
+type HandlerStats struct {
+	Domain   string
+	Priority int
+	// ID is the handler's ID, empty for handlers without one.
+	ID        string
+	Queries   uint64
+	LastQuery time.Time
+}
+
+// handlerCounter counts the queries answered by a handler entry without
+// locking, as it is updated on every query.
+type handlerCounter struct {
+	queries   atomic.Uint64
+	lastQuery atomic.Int64
+}
+
+func (h *handlerCounter) record(now time.Time) {
+	if h == nil {
+		return
+	}
+	h.queries.Add(1)
+	h.lastQuery.Store(now.UnixNano())
+}
+
+// HandlerStats returns the query counters of the registered handlers, from
+// the highest priority down.
+func (c *HandlerChain) HandlerStats() []HandlerStats {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	stats := make([]HandlerStats, 0, len(c.handlers))
+	for _, entry := range c.handlers {
+		hs := HandlerStats{
+			Domain:   entry.OrigPattern,
+			Priority: entry.Priority,
+		}
+		if h, ok := entry.Handler.(interface{ ID() types.HandlerID }); ok {
+			hs.ID = string(h.ID())
+		}
+		if entry.counter != nil {
+			hs.Queries = entry.counter.queries.Load()
+			if last := entry.counter.lastQuery.Load(); last != 0 {
+				hs.LastQuery = time.Unix(0, last)
+			}
+		}
+		stats = append(stats, hs)
+	}
+	return stats
+}
+
+// DnsStats returns the state of the nameserver groups, as of the last
+// health evaluation, and the query counters of the handlers. It only copies
+// state kept up to date anyway, so it is cheap to poll.
+func (s *DefaultServer) DnsStats() DnsStats {
+	stats := DnsStats{Handlers: s.handlerChain.HandlerStats()}
+	if s.statusRecorder == nil {
+		return stats
+	}
+	states := s.statusRecorder.GetDNSStates()
+	if len(states) == 0 {
+		return stats
+	}
+
+	s.mux.Lock()
+	health := s.collectUpstreamHealth()
+	s.mux.Unlock()
+
+	stats.Groups = make([]GroupStats, 0, len(states))
+	for _, state := range states {
+		group := GroupStats{
+			ID:      state.ID,
+			Domains: slices.Clone(state.Domains),
+			Servers: slices.Clone(state.Servers),
+			Enabled: state.Enabled,
+		}
+		var lastFail time.Time
+		for _, server := range state.Servers {
+			h, ok := health[server]
+			if !ok {
+				continue
+			}
+			if h.LastOk.After(group.LastProbe) {
+				group.LastProbe = h.LastOk
+			}
+			if h.LastFail.After(lastFail) {
+				lastFail = h.LastFail
+				group.LastError = h.LastErr
+			}
+		}
+		if lastFail.After(group.LastProbe) {
+			group.LastProbe = lastFail
+		}
+		if group.LastError == "" && state.Error != nil {
+			group.LastError = state.Error.Error()
+		}
+		stats.Groups = append(stats.Groups, group)
+	}
+	return stats
+}
@@ -0,0 +1,88 @@
+package dns
+
+import (
+	"errors"
+	"net/netip"
+	"testing"
+	"time"
+
+	"github.com/miekg/dns"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/netbirdio/netbird/client/internal/dns/test"
+	"github.com/netbirdio/netbird/client/internal/peer"
+)
+
+func TestHandlerChain_HandlerStats(t *testing.T) {
+	chain := NewHandlerChain()
+	chain.AddHandler("example.com.", dns.HandlerFunc(func(w dns.ResponseWriter, r *dns.Msg) {
+		resp := new(dns.Msg).SetRcode(r, dns.RcodeNameError)
+		resp.MsgHdr.Zero = true
+		_ = w.WriteMsg(resp)
+	}), PriorityLocal)
+	chain.AddHandler(".", dualStackUpstream, PriorityUpstream)
+
+	start := time.Now()
+	for _, name := range []string{"app.example.com.", "other.test.", "other.test."} {
+		chain.ServeDNS(&test.MockResponseWriter{}, new(dns.Msg).SetQuestion(name, dns.TypeA))
+	}
+
+	stats := chain.HandlerStats()
+	require.Len(t, stats, 2)
+	assert.Equal(t, "example.com.", stats[0].Domain)
+	assert.Equal(t, PriorityLocal, stats[0].Priority)
+	assert.Zero(t, stats[0].Queries, "queries passed on aren't counted")
+	assert.True(t, stats[0].LastQuery.IsZero())
+
+	assert.Equal(t, ".", stats[1].Domain)
+	assert.Equal(t, uint64(3), stats[1].Queries)
+	assert.False(t, stats[1].LastQuery.Before(start))
+
+	chain.AddHandler(".", dualStackUpstream, PriorityUpstream)
+	assert.Zero(t, chain.HandlerStats()[1].Queries, "a replaced handler starts counting anew")
+}
+
+func TestDefaultServer_DnsStats(t *testing.T) {
+	server := newTestServer(nil)
+	server.registerHandler([]string{"."}, dualStackUpstream, PriorityUpstream)
+
+	first := netip.MustParseAddrPort("100.64.0.1:53")
+	second := netip.MustParseAddrPort("100.64.0.2:53")
+	idle := netip.MustParseAddrPort("100.64.0.3:53")
+	okAt := time.Now().Add(-time.Minute)
+	failAt := time.Now().Add(-time.Second)
+	server.dnsMuxHandlers = []handlerWrapper{{
+		domain:   "example.com",
+		priority: PriorityUpstream,
+		handler: &healthStubHandler{health: map[netip.AddrPort]UpstreamHealth{
+			first:  {LastOk: okAt},
+			second: {LastFail: failAt, LastErr: "i/o timeout"},
+		}},
+	}}
+	server.statusRecorder.UpdateDNSStates([]peer.NSGroupState{
+		{ID: "group-a", Servers: []netip.AddrPort{first, second}, Domains: []string{"example.com"}, Enabled: true},
+		{ID: "group-b", Servers: []netip.AddrPort{idle}, Domains: []string{"example.org"}, Error: errors.New("no reachable nameserver")},
+	})
+
+	server.handlerChain.ServeDNS(&test.MockResponseWriter{}, new(dns.Msg).SetQuestion("example.net.", dns.TypeA))
+
+	stats := server.DnsStats()
+	require.Len(t, stats.Groups, 2)
+
+	a := stats.Groups[0]
+	assert.Equal(t, "group-a", a.ID)
+	assert.Equal(t, []string{"example.com"}, a.Domains)
+	assert.Equal(t, []netip.AddrPort{first, second}, a.Servers)
+	assert.True(t, a.Enabled)
+	assert.Equal(t, "i/o timeout", a.LastError)
+	assert.True(t, a.LastProbe.Equal(failAt), "the last probe is the latest answer or failure")
+
+	b := stats.Groups[1]
+	assert.False(t, b.Enabled)
+	assert.Equal(t, "no reachable nameserver", b.LastError)
+	assert.True(t, b.LastProbe.IsZero())
+
+	require.Len(t, stats.Handlers, 1)
+	assert.Equal(t, uint64(1), stats.Handlers[0].Queries)
+}
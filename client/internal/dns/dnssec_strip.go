@@ -0,0 +1,70 @@
+package dns
+
+import (
+	"github.com/miekg/dns"
+)
+
+// SetDNSSECStripping removes DNSSEC records (RRSIG, NSEC and NSEC3) from the
+// responses to client queries without the DO bit, for stub resolvers that
+// choke on records they didn't ask for. Clients setting DO get responses as
+// is, and the upstream query, and so any validation upstream, is unchanged.
+func (c *HandlerChain) SetDNSSECStripping(enable bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.stripDNSSEC = enable
+}
+
+// wantsDNSSEC reports whether r has the DO bit set.
+func wantsDNSSEC(r *dns.Msg) bool {
+	opt := r.IsEdns0()
+	return opt != nil && opt.Do()
+}
+
+// isDNSSECRecord reports whether rr is a DNSSEC record that RFC 4035 section
+// 3.2.1 leaves out of responses to queries without DO. Records of the type
+// asked for are kept.
+func isDNSSECRecord(rr dns.RR, qtype uint16) bool {
+	rtype := rr.Header().Rrtype
+	switch rtype {
+	case dns.TypeRRSIG, dns.TypeNSEC, dns.TypeNSEC3:
+		return rtype != qtype
+	default:
+		return false
+	}
+}
+
+// stripDNSSEC returns msg without DNSSEC records. msg itself is not modified
+// as handlers may hand out cached responses; it is returned as is if it has
+// none.
+func stripDNSSEC(msg *dns.Msg) *dns.Msg {
+	var qtype uint16
+	if len(msg.Question) > 0 {
+		qtype = msg.Question[0].Qtype
+	}
+	has := func(rrs []dns.RR) bool {
+		for _, rr := range rrs {
+			if isDNSSECRecord(rr, qtype) {
+				return true
+			}
+		}
+		return false
+	}
+	if !has(msg.Answer) && !has(msg.Ns) && !has(msg.Extra) {
+		return msg
+	}
+
+	filter := func(rrs []dns.RR) []dns.RR {
+		var kept []dns.RR
+		for _, rr := range rrs {
+			if !isDNSSECRecord(rr, qtype) {
+				kept = append(kept, rr)
+			}
+		}
+		return kept
+	}
+	out := msg.Copy()
+	out.Answer = filter(out.Answer)
+	out.Ns = filter(out.Ns)
+	out.Extra = filter(out.Extra)
+	return out
+}
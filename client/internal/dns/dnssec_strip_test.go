@@ -0,0 +1,91 @@
+package dns
+
+import (
+	"testing"
+
+	"github.com/miekg/dns"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/netbirdio/netbird/client/internal/dns/test"
+)
+
+func mustRR(t *testing.T, s string) dns.RR {
+	t.Helper()
+	rr, err := dns.NewRR(s)
+	require.NoError(t, err)
+	return rr
+}
+
+func TestHandlerChain_StripDNSSEC(t *testing.T) {
+	signed := &dns.Msg{
+		Answer: []dns.RR{
+			mustRR(t, "secure.example.com. 300 IN A 10.1.2.3"),
+			mustRR(t, "secure.example.com. 300 IN RRSIG A 13 3 300 20300101000000 20200101000000 12345 example.com. c2lnbmF0dXJl"),
+		},
+		Ns: []dns.RR{
+			mustRR(t, "example.com. 300 IN NSEC z.example.com. A RRSIG NSEC"),
+			mustRR(t, "example.com. 300 IN NSEC3 1 0 0 - 2T7B4G4VSA5SMI47K61MV5BV1A22BOJR A RRSIG"),
+		},
+	}
+	// The upstream answers every query with the same cached message.
+	upstream := dns.HandlerFunc(func(w dns.ResponseWriter, r *dns.Msg) {
+		resp := *signed
+		resp.SetReply(r)
+		_ = w.WriteMsg(&resp)
+	})
+
+	chain := NewHandlerChain()
+	chain.AddHandler("secure.example.com.", upstream, PriorityUpstream)
+	chain.SetDNSSECStripping(true)
+
+	query := func(qtype uint16, edns, do bool) *dns.Msg {
+		t.Helper()
+		r := new(dns.Msg).SetQuestion("secure.example.com.", qtype)
+		if edns {
+			r.SetEdns0(dns.DefaultMsgSize, do)
+		}
+		w := &test.MockResponseWriter{}
+		chain.ServeDNS(w, r)
+		resp := w.GetLastResponse()
+		require.NotNil(t, resp)
+		return resp
+	}
+	types := func(rrs []dns.RR) []uint16 {
+		var out []uint16
+		for _, rr := range rrs {
+			out = append(out, rr.Header().Rrtype)
+		}
+		return out
+	}
+
+	for name, edns := range map[string]bool{"no EDNS": false, "EDNS without DO": true} {
+		t.Run(name, func(t *testing.T) {
+			resp := query(dns.TypeA, edns, false)
+			assert.Equal(t, []uint16{dns.TypeA}, types(resp.Answer))
+			assert.Empty(t, resp.Ns)
+		})
+	}
+
+	t.Run("DO keeps DNSSEC records", func(t *testing.T) {
+		resp := query(dns.TypeA, true, true)
+		assert.Equal(t, []uint16{dns.TypeA, dns.TypeRRSIG}, types(resp.Answer))
+		assert.Equal(t, []uint16{dns.TypeNSEC, dns.TypeNSEC3}, types(resp.Ns))
+	})
+
+	t.Run("queried type is kept", func(t *testing.T) {
+		resp := query(dns.TypeRRSIG, false, false)
+		assert.Equal(t, []uint16{dns.TypeA, dns.TypeRRSIG}, types(resp.Answer))
+		assert.Empty(t, resp.Ns)
+	})
+
+	assert.Len(t, signed.Answer, 2, "the handler's message must not be modified")
+	assert.Len(t, signed.Ns, 2)
+
+	t.Run("disabled", func(t *testing.T) {
+		chain.SetDNSSECStripping(false)
+		resp := query(dns.TypeA, false, false)
+		assert.Equal(t, []uint16{dns.TypeA, dns.TypeRRSIG}, types(resp.Answer))
+		assert.Len(t, resp.Ns, 2)
+	})
+}
@@ -0,0 +1,427 @@
+package dns
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/miekg/dns"
+	log "github.com/sirupsen/logrus"
+	"google.golang.org/protobuf/encoding/protowire"
+
+	"github.com/netbirdio/netbird/version"
+)
+
+const (
+	// dnstapContentType is the Frame Streams content type of dnstap payloads.
+	dnstapContentType = "protobuf:dnstap.Dnstap"
+	// dnstapQueueSize bounds the frames waiting for the collector. Frames
+	// are dropped while the queue is full.
+	dnstapQueueSize = 1024
+	// dnstapReconnectInterval is the wait before reconnecting to the collector.
+	dnstapReconnectInterval = 5 * time.Second
+	// dnstapHandshakeTimeout bounds the Frame Streams handshake and shutdown.
+	dnstapHandshakeTimeout = 5 * time.Second
+)
+
+// Frame Streams control frame and field types.
+const (
+	fstrmControlAccept    = 0x01
+	fstrmControlStart     = 0x02
+	fstrmControlStop      = 0x03
+	fstrmControlReady     = 0x04
+	fstrmControlFinish    = 0x05
+	fstrmFieldContentType = 0x01
+	fstrmMaxControlLength = 512
+)
+
+// dnstap.proto enum values and field numbers.
+const (
+	dnstapTypeMessage           = 1
+	dnstapMessageClientQuery    = 5
+	dnstapMessageClientResponse = 6
+	dnstapSocketFamilyINET      = 1
+	dnstapSocketFamilyINET6     = 2
+	dnstapSocketProtocolUDP     = 1
+	dnstapSocketProtocolTCP     = 2
+
+	dnstapFieldIdentity = 1
+	dnstapFieldVersion  = 2
+	dnstapFieldMessage  = 14
+	dnstapFieldType     = 15
+
+	dnstapMsgFieldType             = 1
+	dnstapMsgFieldSocketFamily     = 2
+	dnstapMsgFieldSocketProtocol   = 3
+	dnstapMsgFieldQueryAddress     = 4
+	dnstapMsgFieldResponseAddress  = 5
+	dnstapMsgFieldQueryPort        = 6
+	dnstapMsgFieldResponsePort     = 7
+	dnstapMsgFieldQueryTimeSec     = 8
+	dnstapMsgFieldQueryTimeNsec    = 9
+	dnstapMsgFieldQueryMessage     = 10
+	dnstapMsgFieldResponseTimeSec  = 12
+	dnstapMsgFieldResponseTimeNsec = 13
+	dnstapMsgFieldResponseMessage  = 14
+)
+
+// queryTap receives every client query answered by the handler chain.
+// Implementations are called on the query path and must not block.
+type queryTap interface {
+	tap(w dns.ResponseWriter, query, response *dns.Msg, queryTime, responseTime time.Time)
+}
+
+// setQueryTap installs t to receive answered client queries, nil disables it.
+func (c *HandlerChain) setQueryTap(t queryTap) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.queryTap = t
+}
+
+// parseDnstapOutput splits a destination in format unix:///path or
+// tcp://host:port into network and address.
+func parseDnstapOutput(output string) (string, string, error) {
+	network, address, ok := strings.Cut(output, "://")
+	if !ok || address == "" {
+		return "", "", fmt.Errorf("invalid dnstap output %q, expected unix:///path or tcp://host:port", output)
+	}
+	switch network {
+	case "unix":
+	case "tcp":
+		if _, _, err := net.SplitHostPort(address); err != nil {
+			return "", "", fmt.Errorf("invalid dnstap output %q: %w", output, err)
+		}
+	default:
+		return "", "", fmt.Errorf("unsupported dnstap output network %q", network)
+	}
+	return network, address, nil
+}
+
+// dnstapOutput streams client queries and their responses in dnstap format
+// over a bidirectional Frame Streams connection to a collector. Frames are
+// queued and dropped when the queue is full, so a slow or absent collector
+// never delays answers.
+type dnstapOutput struct {
+	network  string
+	address  string
+	identity []byte
+	version  []byte
+	queue    chan []byte
+	dropped  atomic.Uint64
+}
+
+// newDnstapOutput creates an output for the destination output. identity
+// names this peer in the events, empty uses the OS hostname.
+func newDnstapOutput(output, identity string) (*dnstapOutput, error) {
+	network, address, err := parseDnstapOutput(output)
+	if err != nil {
+		return nil, err
+	}
+	if identity == "" {
+		identity, _ = os.Hostname()
+	}
+	return &dnstapOutput{
+		network:  network,
+		address:  address,
+		identity: []byte(identity),
+		version:  []byte("netbird " + version.NetbirdVersion()),
+		queue:    make(chan []byte, dnstapQueueSize),
+	}, nil
+}
+
+func (d *dnstapOutput) tap(w dns.ResponseWriter, query, response *dns.Msg, queryTime, responseTime time.Time) {
+	msg := dnstapMessage{queryTime: queryTime}
+	msg.setAddresses(w.RemoteAddr(), w.LocalAddr())
+
+	var err error
+	if msg.queryMessage, err = query.Pack(); err != nil {
+		log.Tracef("dnstap: pack query: %v", err)
+		return
+	}
+	d.enqueue(msg.marshal(d.identity, d.version, dnstapMessageClientQuery))
+
+	if response == nil {
+		return
+	}
+	msg.responseTime = responseTime
+	if msg.responseMessage, err = response.Pack(); err != nil {
+		log.Tracef("dnstap: pack response: %v", err)
+		return
+	}
+	d.enqueue(msg.marshal(d.identity, d.version, dnstapMessageClientResponse))
+}
+
+func (d *dnstapOutput) enqueue(frame []byte) {
+	select {
+	case d.queue <- frame:
+	default:
+		d.dropped.Add(1)
+	}
+}
+
+// run connects to the collector and writes queued frames until ctx is done,
+// reconnecting after failures.
+func (d *dnstapOutput) run(ctx context.Context) {
+	for {
+		err := d.stream(ctx)
+		if ctx.Err() != nil {
+			return
+		}
+		log.Warnf("dnstap output to %s://%s: %v", d.network, d.address, err)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(dnstapReconnectInterval):
+		}
+	}
+}
+
+// stream runs one collector connection.
+func (d *dnstapOutput) stream(ctx context.Context) error {
+	dialer := net.Dialer{Timeout: dnstapHandshakeTimeout}
+	conn, err := dialer.DialContext(ctx, d.network, d.address)
+	if err != nil {
+		return fmt.Errorf("dial: %w", err)
+	}
+	defer func() {
+		if err := conn.Close(); err != nil {
+			log.Debugf("dnstap: close connection: %v", err)
+		}
+	}()
+
+	reader := bufio.NewReader(conn)
+	if err := d.handshake(conn, reader); err != nil {
+		return fmt.Errorf("handshake: %w", err)
+	}
+	log.Infof("streaming dnstap to %s://%s", d.network, d.address)
+
+	writer := bufio.NewWriter(conn)
+	for {
+		var frame []byte
+		select {
+		case <-ctx.Done():
+			return d.shutdown(conn, reader, writer)
+		case frame = <-d.queue:
+		}
+
+		if err := writeDataFrame(writer, frame); err != nil {
+			return fmt.Errorf("write frame: %w", err)
+		}
+		// Batch whatever else is already queued before flushing.
+		for pending := len(d.queue); pending > 0; pending-- {
+			if err := writeDataFrame(writer, <-d.queue); err != nil {
+				return fmt.Errorf("write frame: %w", err)
+			}
+		}
+		if err := writer.Flush(); err != nil {
+			return fmt.Errorf("flush: %w", err)
+		}
+
+		if dropped := d.dropped.Swap(0); dropped > 0 {
+			log.Debugf("dnstap: dropped %d frames while the queue was full", dropped)
+		}
+	}
+}
+
+func (d *dnstapOutput) handshake(conn net.Conn, reader *bufio.Reader) error {
+	if err := conn.SetDeadline(time.Now().Add(dnstapHandshakeTimeout)); err != nil {
+		return fmt.Errorf("set deadline: %w", err)
+	}
+	if err := writeControlFrame(conn, fstrmControlReady); err != nil {
+		return err
+	}
+	if err := readControlFrame(reader, fstrmControlAccept); err != nil {
+		return err
+	}
+	if err := writeControlFrame(conn, fstrmControlStart); err != nil {
+		return err
+	}
+	return conn.SetDeadline(time.Time{})
+}
+
+// shutdown flushes pending frames and ends the stream with STOP/FINISH.
+func (d *dnstapOutput) shutdown(conn net.Conn, reader *bufio.Reader, writer *bufio.Writer) error {
+	if err := conn.SetDeadline(time.Now().Add(dnstapHandshakeTimeout)); err != nil {
+		return fmt.Errorf("set deadline: %w", err)
+	}
+	if err := writer.Flush(); err != nil {
+		return fmt.Errorf("flush: %w", err)
+	}
+	if err := writeControlFrame(conn, fstrmControlStop); err != nil {
+		return err
+	}
+	return readControlFrame(reader, fstrmControlFinish)
+}
+
+func writeDataFrame(w io.Writer, frame []byte) error {
+	var length [4]byte
+	binary.BigEndian.PutUint32(length[:], uint32(len(frame)))
+	if _, err := w.Write(length[:]); err != nil {
+		return err
+	}
+	_, err := w.Write(frame)
+	return err
+}
+
+// writeControlFrame writes a control frame, with the dnstap content type for
+// READY and START.
+func writeControlFrame(w io.Writer, controlType uint32) error {
+	payload := binary.BigEndian.AppendUint32(nil, controlType)
+	if controlType == fstrmControlReady || controlType == fstrmControlStart {
+		payload = binary.BigEndian.AppendUint32(payload, fstrmFieldContentType)
+		payload = binary.BigEndian.AppendUint32(payload, uint32(len(dnstapContentType)))
+		payload = append(payload, dnstapContentType...)
+	}
+
+	frame := binary.BigEndian.AppendUint32(nil, 0)
+	frame = binary.BigEndian.AppendUint32(frame, uint32(len(payload)))
+	frame = append(frame, payload...)
+	if _, err := w.Write(frame); err != nil {
+		return fmt.Errorf("write control frame %d: %w", controlType, err)
+	}
+	return nil
+}
+
+// readControlFrame reads a control frame and checks its type. The content
+// type fields of ACCEPT are not checked, a collector accepting the READY
+// accepts dnstap.
+func readControlFrame(r io.Reader, want uint32) error {
+	var header [8]byte
+	if _, err := io.ReadFull(r, header[:]); err != nil {
+		return fmt.Errorf("read control frame: %w", err)
+	}
+	if escape := binary.BigEndian.Uint32(header[:4]); escape != 0 {
+		return errors.New("expected control frame, got data frame")
+	}
+	length := binary.BigEndian.Uint32(header[4:])
+	if length < 4 || length > fstrmMaxControlLength {
+		return fmt.Errorf("invalid control frame length %d", length)
+	}
+	payload := make([]byte, length)
+	if _, err := io.ReadFull(r, payload); err != nil {
+		return fmt.Errorf("read control frame: %w", err)
+	}
+	if got := binary.BigEndian.Uint32(payload[:4]); got != want {
+		return fmt.Errorf("expected control frame %d, got %d", want, got)
+	}
+	return nil
+}
+
+// dnstapMessage holds the fields of a dnstap Message shared by the query and
+// the response event of an exchange.
+type dnstapMessage struct {
+	family          uint64
+	protocol        uint64
+	queryAddress    []byte
+	queryPort       uint32
+	responseAddress []byte
+	responsePort    uint32
+	queryTime       time.Time
+	queryMessage    []byte
+	responseTime    time.Time
+	responseMessage []byte
+}
+
+// setAddresses fills the socket fields from the client and server addresses.
+func (m *dnstapMessage) setAddresses(client, server net.Addr) {
+	m.protocol = dnstapSocketProtocolUDP
+	var ip net.IP
+	switch a := client.(type) {
+	case *net.UDPAddr:
+		ip, m.queryPort = a.IP, uint32(a.Port)
+	case *net.TCPAddr:
+		ip, m.queryPort = a.IP, uint32(a.Port)
+		m.protocol = dnstapSocketProtocolTCP
+	}
+	if ip4 := ip.To4(); ip4 != nil {
+		m.family, m.queryAddress = dnstapSocketFamilyINET, ip4
+	} else if ip != nil {
+		m.family, m.queryAddress = dnstapSocketFamilyINET6, ip
+	}
+
+	switch a := server.(type) {
+	case *net.UDPAddr:
+		m.responseAddress, m.responsePort = a.IP, uint32(a.Port)
+	case *net.TCPAddr:
+		m.responseAddress, m.responsePort = a.IP, uint32(a.Port)
+	}
+	if ip4 := net.IP(m.responseAddress).To4(); ip4 != nil && m.family == dnstapSocketFamilyINET {
+		m.responseAddress = ip4
+	}
+}
+
+// marshal encodes a Dnstap protobuf wrapping the message as messageType.
+func (m *dnstapMessage) marshal(identity, version []byte, messageType uint64) []byte {
+	var msg []byte
+	msg = protowire.AppendTag(msg, dnstapMsgFieldType, protowire.VarintType)
+	msg = protowire.AppendVarint(msg, messageType)
+	if m.family != 0 {
+		msg = protowire.AppendTag(msg, dnstapMsgFieldSocketFamily, protowire.VarintType)
+		msg = protowire.AppendVarint(msg, m.family)
+		msg = protowire.AppendTag(msg, dnstapMsgFieldSocketProtocol, protowire.VarintType)
+		msg = protowire.AppendVarint(msg, m.protocol)
+		msg = protowire.AppendTag(msg, dnstapMsgFieldQueryAddress, protowire.BytesType)
+		msg = protowire.AppendBytes(msg, m.queryAddress)
+		msg = protowire.AppendTag(msg, dnstapMsgFieldQueryPort, protowire.VarintType)
+		msg = protowire.AppendVarint(msg, uint64(m.queryPort))
+	}
+	if len(m.responseAddress) > 0 {
+		msg = protowire.AppendTag(msg, dnstapMsgFieldResponseAddress, protowire.BytesType)
+		msg = protowire.AppendBytes(msg, m.responseAddress)
+		msg = protowire.AppendTag(msg, dnstapMsgFieldResponsePort, protowire.VarintType)
+		msg = protowire.AppendVarint(msg, uint64(m.responsePort))
+	}
+	msg = protowire.AppendTag(msg, dnstapMsgFieldQueryTimeSec, protowire.VarintType)
+	msg = protowire.AppendVarint(msg, uint64(m.queryTime.Unix()))
+	msg = protowire.AppendTag(msg, dnstapMsgFieldQueryTimeNsec, protowire.Fixed32Type)
+	msg = protowire.AppendFixed32(msg, uint32(m.queryTime.Nanosecond()))
+	msg = protowire.AppendTag(msg, dnstapMsgFieldQueryMessage, protowire.BytesType)
+	msg = protowire.AppendBytes(msg, m.queryMessage)
+	if messageType == dnstapMessageClientResponse {
+		msg = protowire.AppendTag(msg, dnstapMsgFieldResponseTimeSec, protowire.VarintType)
+		msg = protowire.AppendVarint(msg, uint64(m.responseTime.Unix()))
+		msg = protowire.AppendTag(msg, dnstapMsgFieldResponseTimeNsec, protowire.Fixed32Type)
+		msg = protowire.AppendFixed32(msg, uint32(m.responseTime.Nanosecond()))
+		msg = protowire.AppendTag(msg, dnstapMsgFieldResponseMessage, protowire.BytesType)
+		msg = protowire.AppendBytes(msg, m.responseMessage)
+	}
+
+	var frame []byte
+	if len(identity) > 0 {
+		frame = protowire.AppendTag(frame, dnstapFieldIdentity, protowire.BytesType)
+		frame = protowire.AppendBytes(frame, identity)
+	}
+	if len(version) > 0 {
+		frame = protowire.AppendTag(frame, dnstapFieldVersion, protowire.BytesType)
+		frame = protowire.AppendBytes(frame, version)
+	}
+	frame = protowire.AppendTag(frame, dnstapFieldMessage, protowire.BytesType)
+	frame = protowire.AppendBytes(frame, msg)
+	frame = protowire.AppendTag(frame, dnstapFieldType, protowire.VarintType)
+	return protowire.AppendVarint(frame, dnstapTypeMessage)
+}
+
+// startDnstap streams answered client queries to the configured dnstap
+// collector.
+func (s *DefaultServer) startDnstap() {
+	if s.dnstap == nil {
+		return
+	}
+
+	s.handlerChain.setQueryTap(s.dnstap)
+	output := s.dnstap
+	s.shutdownWg.Add(1)
+	go func() {
+		defer s.shutdownWg.Done()
+		output.run(s.ctx)
+	}()
+}
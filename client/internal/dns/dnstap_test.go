@@ -0,0 +1,249 @@
+package dns
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"io"
+	"net"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/miekg/dns"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/protobuf/encoding/protowire"
+
+	"github.com/netbirdio/netbird/client/internal/dns/test"
+)
+
+type addrResponseWriter struct {
+	test.MockResponseWriter
+	local, remote net.Addr
+}
+
+func (w *addrResponseWriter) LocalAddr() net.Addr  { return w.local }
+func (w *addrResponseWriter) RemoteAddr() net.Addr { return w.remote }
+
+// dnstapCollector accepts one Frame Streams connection and records the
+// data frames it receives.
+type dnstapCollector struct {
+	t        *testing.T
+	listener net.Listener
+	frames   chan []byte
+	finished chan struct{}
+}
+
+func newDnstapCollector(t *testing.T) *dnstapCollector {
+	t.Helper()
+	listener, err := net.Listen("unix", filepath.Join(t.TempDir(), "dnstap.sock"))
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = listener.Close() })
+
+	c := &dnstapCollector{t: t, listener: listener, frames: make(chan []byte, 10), finished: make(chan struct{})}
+	go c.serve()
+	return c
+}
+
+func (c *dnstapCollector) serve() {
+	defer close(c.finished)
+	conn, err := c.listener.Accept()
+	if err != nil {
+		return
+	}
+	defer conn.Close()
+	reader := bufio.NewReader(conn)
+
+	if typ, contentType := c.readControl(reader); typ != fstrmControlReady || contentType != dnstapContentType {
+		c.t.Errorf("expected READY with %s, got %d %q", dnstapContentType, typ, contentType)
+		return
+	}
+	accept := binary.BigEndian.AppendUint32(nil, 0)
+	accept = binary.BigEndian.AppendUint32(accept, 4)
+	accept = binary.BigEndian.AppendUint32(accept, fstrmControlAccept)
+	_, _ = conn.Write(accept)
+	if typ, _ := c.readControl(reader); typ != fstrmControlStart {
+		c.t.Errorf("expected START, got %d", typ)
+		return
+	}
+
+	for {
+		var length [4]byte
+		if _, err := io.ReadFull(reader, length[:]); err != nil {
+			return
+		}
+		if n := binary.BigEndian.Uint32(length[:]); n > 0 {
+			frame := make([]byte, n)
+			if _, err := io.ReadFull(reader, frame); err != nil {
+				return
+			}
+			c.frames <- frame
+			continue
+		}
+		// escape: control frame, only STOP is expected
+		var header [4]byte
+		_, _ = io.ReadFull(reader, header[:])
+		payload := make([]byte, binary.BigEndian.Uint32(header[:]))
+		_, _ = io.ReadFull(reader, payload)
+		if binary.BigEndian.Uint32(payload) == fstrmControlStop {
+			finish := binary.BigEndian.AppendUint32(nil, 0)
+			finish = binary.BigEndian.AppendUint32(finish, 4)
+			finish = binary.BigEndian.AppendUint32(finish, fstrmControlFinish)
+			_, _ = conn.Write(finish)
+			return
+		}
+	}
+}
+
+func (c *dnstapCollector) readControl(r io.Reader) (uint32, string) {
+	var header [8]byte
+	if _, err := io.ReadFull(r, header[:]); err != nil {
+		return 0, ""
+	}
+	payload := make([]byte, binary.BigEndian.Uint32(header[4:]))
+	if _, err := io.ReadFull(r, payload); err != nil {
+		return 0, ""
+	}
+	var contentType string
+	if len(payload) > 12 {
+		contentType = string(payload[12:])
+	}
+	return binary.BigEndian.Uint32(payload), contentType
+}
+
+func (c *dnstapCollector) next() []byte {
+	c.t.Helper()
+	select {
+	case frame := <-c.frames:
+		return frame
+	case <-time.After(5 * time.Second):
+		c.t.Fatal("no dnstap frame received")
+		return nil
+	}
+}
+
+// decodeFields returns the top-level fields of a protobuf message by number.
+func decodeFields(t *testing.T, b []byte) map[protowire.Number][]byte {
+	t.Helper()
+	fields := make(map[protowire.Number][]byte)
+	for len(b) > 0 {
+		num, typ, n := protowire.ConsumeTag(b)
+		require.GreaterOrEqual(t, n, 0)
+		b = b[n:]
+		switch typ {
+		case protowire.BytesType:
+			v, n := protowire.ConsumeBytes(b)
+			require.GreaterOrEqual(t, n, 0)
+			fields[num] = v
+			b = b[n:]
+		case protowire.VarintType:
+			v, n := protowire.ConsumeVarint(b)
+			require.GreaterOrEqual(t, n, 0)
+			fields[num] = protowire.AppendVarint(nil, v)
+			b = b[n:]
+		default:
+			n := protowire.ConsumeFieldValue(num, typ, b)
+			require.GreaterOrEqual(t, n, 0)
+			fields[num] = b[:n]
+			b = b[n:]
+		}
+	}
+	return fields
+}
+
+func varintField(t *testing.T, fields map[protowire.Number][]byte, num protowire.Number) uint64 {
+	t.Helper()
+	v, n := protowire.ConsumeVarint(fields[num])
+	require.GreaterOrEqual(t, n, 0, "field %d", num)
+	return v
+}
+
+func TestDnstapOutput(t *testing.T) {
+	collector := newDnstapCollector(t)
+	output, err := newDnstapOutput("unix://"+collector.listener.Addr().String(), "peer-a")
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		output.run(ctx)
+	}()
+
+	chain := NewHandlerChain()
+	chain.setQueryTap(output)
+	chain.AddHandler("example.com.", dns.HandlerFunc(func(w dns.ResponseWriter, r *dns.Msg) {
+		resp := new(dns.Msg).SetReply(r)
+		resp.Answer = append(resp.Answer, &dns.A{
+			Hdr: dns.RR_Header{Name: r.Question[0].Name, Rrtype: dns.TypeA, Class: dns.ClassINET, Ttl: 60},
+			A:   net.ParseIP("192.0.2.1"),
+		})
+		_ = w.WriteMsg(resp)
+	}), PriorityUpstream)
+
+	w := &addrResponseWriter{
+		remote: &net.UDPAddr{IP: net.ParseIP("100.64.0.5"), Port: 40000},
+		local:  &net.UDPAddr{IP: net.ParseIP("100.64.0.1"), Port: 53},
+	}
+	query := new(dns.Msg).SetQuestion("example.com.", dns.TypeA)
+	chain.ServeDNS(w, query)
+
+	// In-process queries without a client are not tapped.
+	chain.ServeDNS(&test.MockResponseWriter{}, new(dns.Msg).SetQuestion("example.com.", dns.TypeAAAA))
+
+	for _, want := range []uint64{dnstapMessageClientQuery, dnstapMessageClientResponse} {
+		frame := decodeFields(t, collector.next())
+		assert.Equal(t, "peer-a", string(frame[dnstapFieldIdentity]))
+		assert.Equal(t, uint64(dnstapTypeMessage), varintField(t, frame, dnstapFieldType))
+
+		msg := decodeFields(t, frame[dnstapFieldMessage])
+		assert.Equal(t, want, varintField(t, msg, dnstapMsgFieldType))
+		assert.Equal(t, uint64(dnstapSocketFamilyINET), varintField(t, msg, dnstapMsgFieldSocketFamily))
+		assert.Equal(t, uint64(dnstapSocketProtocolUDP), varintField(t, msg, dnstapMsgFieldSocketProtocol))
+		assert.Equal(t, net.ParseIP("100.64.0.5").To4(), net.IP(msg[dnstapMsgFieldQueryAddress]))
+		assert.Equal(t, uint64(40000), varintField(t, msg, dnstapMsgFieldQueryPort))
+		assert.Equal(t, net.ParseIP("100.64.0.1").To4(), net.IP(msg[dnstapMsgFieldResponseAddress]))
+
+		packed := new(dns.Msg)
+		require.NoError(t, packed.Unpack(msg[dnstapMsgFieldQueryMessage]))
+		assert.Equal(t, query.Question, packed.Question)
+
+		if want == dnstapMessageClientResponse {
+			resp := new(dns.Msg)
+			require.NoError(t, resp.Unpack(msg[dnstapMsgFieldResponseMessage]))
+			require.Len(t, resp.Answer, 1)
+			assert.Equal(t, "192.0.2.1", resp.Answer[0].(*dns.A).A.String())
+		} else {
+			assert.NotContains(t, msg, protowire.Number(dnstapMsgFieldResponseMessage))
+		}
+	}
+
+	cancel()
+	wg.Wait()
+	select {
+	case <-collector.finished:
+	case <-time.After(5 * time.Second):
+		t.Fatal("stream was not stopped")
+	}
+	assert.Empty(t, collector.frames)
+}
+
+func TestParseDnstapOutput(t *testing.T) {
+	network, address, err := parseDnstapOutput("unix:///run/dnstap.sock")
+	require.NoError(t, err)
+	assert.Equal(t, "unix", network)
+	assert.Equal(t, "/run/dnstap.sock", address)
+
+	network, address, err = parseDnstapOutput("tcp://127.0.0.1:6000")
+	require.NoError(t, err)
+	assert.Equal(t, "tcp", network)
+	assert.Equal(t, "127.0.0.1:6000", address)
+
+	for _, invalid := range []string{"", "/run/dnstap.sock", "tcp://127.0.0.1", "udp://127.0.0.1:6000"} {
+		_, _, err := parseDnstapOutput(invalid)
+		assert.Error(t, err, invalid)
+	}
+}
@@ -0,0 +1,342 @@
+package dns
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"math/big"
+	"mime"
+	"net"
+	"net/http"
+	"net/netip"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/miekg/dns"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	// dohPath is the URI path of the DoH endpoint, the one RFC 8484 uses in
+	// its examples and clients default to.
+	dohPath        = "/dns-query"
+	dohContentType = "application/dns-message"
+
+	dohReadHeaderTimeout = 5 * time.Second
+	dohIdleTimeout       = 30 * time.Second
+	dohShutdownTimeout   = 2 * time.Second
+	// dohCertValidity is how long the self-signed certificate is valid. It's
+	// generated on every start, so it only has to outlive one run.
+	dohCertValidity = 365 * 24 * time.Hour
+)
+
+// dohListener serves DNS over HTTPS (RFC 8484) queries on the interface
+// address through the handler chain, for peers in netstack mode whose
+// applications can't reach the DNS service otherwise. It serves TLS with
+// the configured certificate, or a self-signed one for the interface
+// address that clients have to trust by its fingerprint.
+type dohListener struct {
+	handler dns.Handler
+	wgIface WGIface
+	port    uint16
+	// certFile and keyFile are the PEM certificate and key to serve, empty
+	// to serve a self-signed one.
+	certFile string
+	keyFile  string
+}
+
+func newDoHListener(handler dns.Handler, wgIface WGIface, port uint16, certFile, keyFile string) *dohListener {
+	return &dohListener{
+		handler:  handler,
+		wgIface:  wgIface,
+		port:     port,
+		certFile: certFile,
+		keyFile:  keyFile,
+	}
+}
+
+// tlsConfig returns the TLS config to serve on addr with: the configured
+// certificate, or else a self-signed one for addr.
+func (l *dohListener) tlsConfig(addr netip.Addr) (*tls.Config, error) {
+	var cert tls.Certificate
+	if l.certFile != "" || l.keyFile != "" {
+		loaded, err := tls.LoadX509KeyPair(l.certFile, l.keyFile)
+		if err != nil {
+			return nil, fmt.Errorf("load certificate: %w", err)
+		}
+		cert = loaded
+	} else {
+		generated, err := selfSignedDoHCert(addr, time.Now())
+		if err != nil {
+			return nil, fmt.Errorf("generate self-signed certificate: %w", err)
+		}
+		fingerprint := sha256.Sum256(generated.Certificate[0])
+		log.Infof("DNS over HTTPS serves a self-signed certificate with SHA-256 fingerprint %s", hex.EncodeToString(fingerprint[:]))
+		cert = generated
+	}
+
+	return &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		// RFC 8484 requires TLS 1.2 or later
+		MinVersion: tls.VersionTLS12,
+	}, nil
+}
+
+// selfSignedDoHCert returns a certificate for addr signed by its own key,
+// valid from now.
+func selfSignedDoHCert(addr netip.Addr, now time.Time) (tls.Certificate, error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return tls.Certificate{}, fmt.Errorf("generate key: %w", err)
+	}
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return tls.Certificate{}, fmt.Errorf("generate serial number: %w", err)
+	}
+
+	template := &x509.Certificate{
+		SerialNumber: serial,
+		Subject:      pkix.Name{CommonName: addr.String()},
+		// tolerate clocks of clients running a bit behind
+		NotBefore:             now.Add(-time.Hour),
+		NotAfter:              now.Add(dohCertValidity),
+		KeyUsage:              x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		BasicConstraintsValid: true,
+		IPAddresses:           []net.IP{addr.AsSlice()},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		return tls.Certificate{}, fmt.Errorf("create certificate: %w", err)
+	}
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}, nil
+}
+
+// run serves queries until ctx is done.
+func (l *dohListener) run(ctx context.Context) {
+	addr := netip.AddrPortFrom(l.wgIface.Address().IP, l.port)
+	tlsConfig, err := l.tlsConfig(addr.Addr())
+	if err != nil {
+		log.Errorf("DNS over HTTPS listener on %s: %v", addr, err)
+		return
+	}
+	ln, err := l.listen(ctx, addr)
+	if err != nil {
+		log.Errorf("DNS over HTTPS listener on %s: %v", addr, err)
+		return
+	}
+
+	srv := &http.Server{
+		Handler:           l,
+		TLSConfig:         tlsConfig,
+		ReadHeaderTimeout: dohReadHeaderTimeout,
+		IdleTimeout:       dohIdleTimeout,
+		BaseContext:       func(net.Listener) context.Context { return ctx },
+	}
+	go func() {
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), dohShutdownTimeout)
+		defer cancel()
+		if err := srv.Shutdown(shutdownCtx); err != nil {
+			log.Debugf("shutdown DNS over HTTPS listener: %v", err)
+		}
+	}()
+
+	log.Infof("DNS over HTTPS listening on https://%s%s", addr, dohPath)
+	if err := srv.ServeTLS(ln, "", ""); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		log.Errorf("DNS over HTTPS listener on %s: %v", addr, err)
+	}
+}
+
+// listen binds addr on the netstack in netstack mode, on the host otherwise.
+func (l *dohListener) listen(ctx context.Context, addr netip.AddrPort) (net.Listener, error) {
+	if tnet := l.wgIface.GetNet(); tnet != nil {
+		ln, err := tnet.ListenTCPAddrPort(addr)
+		if err != nil {
+			return nil, fmt.Errorf("listen on netstack: %w", err)
+		}
+		return ln, nil
+	}
+
+	var lc net.ListenConfig
+	ln, err := lc.Listen(ctx, "tcp", addr.String())
+	if err != nil {
+		return nil, fmt.Errorf("listen: %w", err)
+	}
+	return ln, nil
+}
+
+// ServeHTTP answers a DoH query, sent either base64url encoded in the "dns"
+// parameter of a GET or as the body of a POST.
+func (l *dohListener) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != dohPath {
+		http.NotFound(w, r)
+		return
+	}
+
+	var wire []byte
+	switch r.Method {
+	case http.MethodGet:
+		param := r.URL.Query().Get("dns")
+		if param == "" {
+			http.Error(w, "missing dns parameter", http.StatusBadRequest)
+			return
+		}
+		// RFC 8484 forbids padding, some clients send it anyway
+		decoded, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(param, "="))
+		if err != nil {
+			http.Error(w, "invalid dns parameter", http.StatusBadRequest)
+			return
+		}
+		wire = decoded
+	case http.MethodPost:
+		if mediaType, _, err := mime.ParseMediaType(r.Header.Get("Content-Type")); err != nil || mediaType != dohContentType {
+			http.Error(w, "unsupported content type", http.StatusUnsupportedMediaType)
+			return
+		}
+		body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, dns.MaxMsgSize))
+		if err != nil {
+			var tooLarge *http.MaxBytesError
+			if errors.As(err, &tooLarge) {
+				http.Error(w, "query too large", http.StatusRequestEntityTooLarge)
+				return
+			}
+			http.Error(w, "read query", http.StatusBadRequest)
+			return
+		}
+		wire = body
+	default:
+		w.Header().Set("Allow", "GET, POST")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	query := new(dns.Msg)
+	if err := query.Unpack(wire); err != nil || len(query.Question) == 0 {
+		http.Error(w, "invalid dns query", http.StatusBadRequest)
+		return
+	}
+
+	rw := newDoHResponseWriter(r)
+	l.handler.ServeDNS(rw, query)
+	resp := rw.response
+	if resp == nil {
+		resp = new(dns.Msg).SetRcode(query, dns.RcodeServerFailure)
+	}
+
+	packed, err := resp.Pack()
+	if err != nil {
+		log.Debugf("pack DNS over HTTPS response for %s: %v", query.Question[0].Name, err)
+		http.Error(w, "pack dns response", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", dohContentType)
+	w.Header().Set("Content-Length", strconv.Itoa(len(packed)))
+	if maxAge, ok := dohMaxAge(resp); ok {
+		w.Header().Set("Cache-Control", "max-age="+strconv.FormatUint(uint64(maxAge), 10))
+	}
+	if _, err := w.Write(packed); err != nil {
+		log.Debugf("write DNS over HTTPS response: %v", err)
+	}
+}
+
+// dohMaxAge returns the freshness lifetime of resp for HTTP caches, the
+// smallest TTL of its records (RFC 8484, section 5.1). It reports false for
+// responses without records.
+func dohMaxAge(resp *dns.Msg) (uint32, bool) {
+	maxAge := uint32(math.MaxUint32)
+	found := false
+	for _, section := range [][]dns.RR{resp.Answer, resp.Ns, resp.Extra} {
+		for _, rr := range section {
+			if rr.Header().Rrtype == dns.TypeOPT {
+				continue
+			}
+			maxAge = min(maxAge, rr.Header().Ttl)
+			found = true
+		}
+	}
+	return maxAge, found
+}
+
+// dohResponseWriter captures the response of a DoH query. Its addresses
+// are TCP ones, so handlers don't truncate responses to the UDP size.
+type dohResponseWriter struct {
+	localAddr  net.Addr
+	remoteAddr net.Addr
+	response   *dns.Msg
+}
+
+func newDoHResponseWriter(r *http.Request) *dohResponseWriter {
+	w := &dohResponseWriter{
+		localAddr:  &net.TCPAddr{},
+		remoteAddr: &net.TCPAddr{},
+	}
+	if local, ok := r.Context().Value(http.LocalAddrContextKey).(net.Addr); ok {
+		if addrPort, err := netip.ParseAddrPort(local.String()); err == nil {
+			w.localAddr = net.TCPAddrFromAddrPort(addrPort)
+		}
+	}
+	if addrPort, err := netip.ParseAddrPort(r.RemoteAddr); err == nil {
+		w.remoteAddr = net.TCPAddrFromAddrPort(addrPort)
+	}
+	return w
+}
+
+func (w *dohResponseWriter) LocalAddr() net.Addr  { return w.localAddr }
+func (w *dohResponseWriter) RemoteAddr() net.Addr { return w.remoteAddr }
+
+func (w *dohResponseWriter) WriteMsg(m *dns.Msg) error {
+	w.response = m
+	return nil
+}
+
+// Write unpacks raw DNS bytes for handlers that call Write instead of
+// WriteMsg.
+func (w *dohResponseWriter) Write(p []byte) (int, error) {
+	msg := new(dns.Msg)
+	if err := msg.Unpack(p); err != nil {
+		return 0, err
+	}
+	w.response = msg
+	return len(p), nil
+}
+
+func (w *dohResponseWriter) Close() error      { return nil }
+func (w *dohResponseWriter) TsigStatus() error { return nil }
+
+// TsigTimersOnly is part of dns.ResponseWriter.
+func (w *dohResponseWriter) TsigTimersOnly(bool) {
+	// no-op: DoH queries carry no TSIG state.
+}
+
+// Hijack is part of dns.ResponseWriter.
+func (w *dohResponseWriter) Hijack() {
+	// no-op: the HTTP server owns the connection.
+}
+
+// startDoH starts the DNS over HTTPS listener, if configured.
+func (s *DefaultServer) startDoH() {
+	if s.doh == nil {
+		return
+	}
+
+	listener := s.doh
+	s.shutdownWg.Add(1)
+	go func() {
+		defer s.shutdownWg.Done()
+		listener.run(s.ctx)
+	}()
+}
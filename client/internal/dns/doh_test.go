@@ -0,0 +1,176 @@
+package dns
+
+import (
+	"bytes"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/miekg/dns"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestDoHListener(t *testing.T) *dohListener {
+	t.Helper()
+
+	chain := NewHandlerChain()
+	chain.AddHandler("example.com.", dns.HandlerFunc(func(w dns.ResponseWriter, r *dns.Msg) {
+		_, isTCP := w.RemoteAddr().(*net.TCPAddr)
+		assert.True(t, isTCP, "DoH queries should look like TCP to handlers")
+
+		resp := new(dns.Msg).SetReply(r)
+		resp.Answer = append(resp.Answer,
+			&dns.A{Hdr: dns.RR_Header{Name: r.Question[0].Name, Rrtype: dns.TypeA, Class: dns.ClassINET, Ttl: 300}, A: net.IPv4(10, 0, 0, 1)},
+			&dns.A{Hdr: dns.RR_Header{Name: r.Question[0].Name, Rrtype: dns.TypeA, Class: dns.ClassINET, Ttl: 60}, A: net.IPv4(10, 0, 0, 2)},
+		)
+		_ = w.WriteMsg(resp)
+	}), PriorityUpstream)
+	return newDoHListener(chain, nil, 0, "", "")
+}
+
+func packTestQuery(t *testing.T, name string) []byte {
+	t.Helper()
+
+	query := new(dns.Msg).SetQuestion(name, dns.TypeA)
+	query.Id = 0
+	wire, err := query.Pack()
+	require.NoError(t, err)
+	return wire
+}
+
+func requireDoHAnswer(t *testing.T, rec *httptest.ResponseRecorder) *dns.Msg {
+	t.Helper()
+
+	require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+	assert.Equal(t, dohContentType, rec.Header().Get("Content-Type"))
+	resp := new(dns.Msg)
+	require.NoError(t, resp.Unpack(rec.Body.Bytes()))
+	return resp
+}
+
+func TestDoHListener_Get(t *testing.T) {
+	l := newTestDoHListener(t)
+
+	param := base64.RawURLEncoding.EncodeToString(packTestQuery(t, "app.example.com."))
+	rec := httptest.NewRecorder()
+	l.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, dohPath+"?dns="+param, nil))
+
+	resp := requireDoHAnswer(t, rec)
+	assert.Equal(t, dns.RcodeSuccess, resp.Rcode)
+	assert.Len(t, resp.Answer, 2)
+	assert.Equal(t, "max-age=60", rec.Header().Get("Cache-Control"), "max-age should be the smallest TTL")
+}
+
+func TestDoHListener_Post(t *testing.T) {
+	l := newTestDoHListener(t)
+
+	req := httptest.NewRequest(http.MethodPost, dohPath, bytes.NewReader(packTestQuery(t, "app.example.com.")))
+	req.Header.Set("Content-Type", dohContentType)
+	rec := httptest.NewRecorder()
+	l.ServeHTTP(rec, req)
+
+	resp := requireDoHAnswer(t, rec)
+	assert.Equal(t, dns.RcodeSuccess, resp.Rcode)
+	assert.Len(t, resp.Answer, 2)
+}
+
+func TestDoHListener_Unhandled(t *testing.T) {
+	l := newTestDoHListener(t)
+
+	param := base64.RawURLEncoding.EncodeToString(packTestQuery(t, "other.test."))
+	rec := httptest.NewRecorder()
+	l.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, dohPath+"?dns="+param, nil))
+
+	resp := requireDoHAnswer(t, rec)
+	assert.NotEqual(t, dns.RcodeSuccess, resp.Rcode)
+	assert.Empty(t, rec.Header().Get("Cache-Control"))
+}
+
+func TestDoHListener_BadRequests(t *testing.T) {
+	l := newTestDoHListener(t)
+	query := packTestQuery(t, "app.example.com.")
+
+	tests := []struct {
+		name        string
+		method      string
+		target      string
+		contentType string
+		body        []byte
+		want        int
+	}{
+		{name: "wrong path", method: http.MethodGet, target: "/resolve?dns=" + base64.RawURLEncoding.EncodeToString(query), want: http.StatusNotFound},
+		{name: "missing parameter", method: http.MethodGet, target: dohPath, want: http.StatusBadRequest},
+		{name: "invalid base64", method: http.MethodGet, target: dohPath + "?dns=!!", want: http.StatusBadRequest},
+		{name: "invalid message", method: http.MethodGet, target: dohPath + "?dns=" + base64.RawURLEncoding.EncodeToString([]byte{1, 2, 3}), want: http.StatusBadRequest},
+		{name: "wrong content type", method: http.MethodPost, target: dohPath, contentType: "text/plain", body: query, want: http.StatusUnsupportedMediaType},
+		{name: "too large", method: http.MethodPost, target: dohPath, contentType: dohContentType, body: make([]byte, dns.MaxMsgSize+1), want: http.StatusRequestEntityTooLarge},
+		{name: "wrong method", method: http.MethodPut, target: dohPath, contentType: dohContentType, body: query, want: http.StatusMethodNotAllowed},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, tt.target, bytes.NewReader(tt.body))
+			if tt.contentType != "" {
+				req.Header.Set("Content-Type", tt.contentType)
+			}
+			rec := httptest.NewRecorder()
+			l.ServeHTTP(rec, req)
+			assert.Equal(t, tt.want, rec.Code)
+		})
+	}
+}
+
+func TestDoHListener_TLS(t *testing.T) {
+	l := newTestDoHListener(t)
+	addr := netip.MustParseAddr("127.0.0.1")
+
+	tlsConfig, err := l.tlsConfig(addr)
+	require.NoError(t, err)
+	cert, err := x509.ParseCertificate(tlsConfig.Certificates[0].Certificate[0])
+	require.NoError(t, err)
+	require.NoError(t, cert.VerifyHostname(addr.String()), "the self-signed certificate is for the interface address")
+
+	srv := httptest.NewUnstartedServer(l)
+	srv.TLS = tlsConfig
+	srv.StartTLS()
+	defer srv.Close()
+
+	roots := x509.NewCertPool()
+	roots.AddCert(cert)
+	client := &http.Client{Transport: &http.Transport{TLSClientConfig: &tls.Config{RootCAs: roots}}}
+	resp, err := client.Post(srv.URL+dohPath, dohContentType, bytes.NewReader(packTestQuery(t, "app.example.com.")))
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, dohContentType, resp.Header.Get("Content-Type"))
+}
+
+func TestDoHListener_TLSConfiguredCert(t *testing.T) {
+	dir := t.TempDir()
+	generated, err := selfSignedDoHCert(netip.MustParseAddr("100.64.0.1"), time.Now())
+	require.NoError(t, err)
+	keyDER, err := x509.MarshalPKCS8PrivateKey(generated.PrivateKey)
+	require.NoError(t, err)
+	certFile, keyFile := filepath.Join(dir, "cert.pem"), filepath.Join(dir, "key.pem")
+	require.NoError(t, os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: generated.Certificate[0]}), 0o600))
+	require.NoError(t, os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: keyDER}), 0o600))
+
+	l := newDoHListener(NewHandlerChain(), nil, 0, certFile, keyFile)
+	tlsConfig, err := l.tlsConfig(netip.MustParseAddr("100.64.0.1"))
+	require.NoError(t, err)
+	assert.Equal(t, generated.Certificate, tlsConfig.Certificates[0].Certificate)
+
+	l = newDoHListener(NewHandlerChain(), nil, 0, filepath.Join(dir, "missing.pem"), keyFile)
+	_, err = l.tlsConfig(netip.MustParseAddr("100.64.0.1"))
+	assert.Error(t, err)
+}
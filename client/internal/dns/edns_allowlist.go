@@ -0,0 +1,156 @@
+package dns
+
+import (
+	"net/netip"
+	"strconv"
+	"strings"
+
+	"github.com/miekg/dns"
+	log "github.com/sirupsen/logrus"
+
+	nbdns "github.com/netbirdio/netbird/dns"
+)
+
+// ednsOptionNames are the EDNS0 option names accepted besides numeric codes.
+var ednsOptionNames = map[string]uint16{
+	"nsid":      dns.EDNS0NSID,
+	"ecs":       dns.EDNS0SUBNET,
+	"subnet":    dns.EDNS0SUBNET,
+	"expire":    dns.EDNS0EXPIRE,
+	"cookie":    dns.EDNS0COOKIE,
+	"keepalive": dns.EDNS0TCPKEEPALIVE,
+	"padding":   dns.EDNS0PADDING,
+	"ede":       dns.EDNS0EDE,
+}
+
+// EDNSAllowlist is a set of EDNS0 option codes let through to and from
+// upstream nameservers. A nil allowlist lets every option through, an empty
+// one none.
+type EDNSAllowlist map[uint16]struct{}
+
+// ParseEDNSAllowlist parses EDNS0 option names, e.g. "ecs", "cookie" or
+// "padding", or numeric codes. Invalid entries are logged and skipped. It
+// returns nil, allowing every option, if names is empty.
+func ParseEDNSAllowlist(names []string) EDNSAllowlist {
+	if len(names) == 0 {
+		return nil
+	}
+	return parseEDNSOptions(names)
+}
+
+// parseEDNSOptions is ParseEDNSAllowlist returning an empty allowlist, not
+// nil, if names has no valid entry.
+func parseEDNSOptions(names []string) EDNSAllowlist {
+	allow := make(EDNSAllowlist)
+	for _, name := range names {
+		name = strings.ToLower(strings.TrimSpace(name))
+		if name == "" {
+			continue
+		}
+		if code, ok := ednsOptionNames[name]; ok {
+			allow[code] = struct{}{}
+			continue
+		}
+		code, err := strconv.ParseUint(name, 10, 16)
+		if err != nil {
+			log.Warnf("invalid EDNS0 option %q, expected a name or a code", name)
+			continue
+		}
+		allow[uint16(code)] = struct{}{}
+	}
+	return allow
+}
+
+// ParseGroupEDNSAllowlists parses per-group allowlist specs in format
+// key=options, options being a comma separated list for ParseEDNSAllowlist,
+// empty to strip every option. Keys are matched like those of
+// ParseInflightLimits. Invalid specs are logged and skipped.
+func ParseGroupEDNSAllowlists(specs []string) map[string]EDNSAllowlist {
+	allowlists := make(map[string]EDNSAllowlist)
+	for _, spec := range specs {
+		key, options, ok := strings.Cut(spec, "=")
+		key = strings.TrimSpace(key)
+		if !ok || key == "" {
+			log.Warnf("invalid EDNS0 allowlist %q, expected domain=options or ip=options", spec)
+			continue
+		}
+		allowlists[normalizeInflightKey(key)] = parseEDNSOptions(strings.Split(options, ","))
+	}
+	return allowlists
+}
+
+// allows reports whether the option code may pass.
+func (a EDNSAllowlist) allows(code uint16) bool {
+	if a == nil {
+		return true
+	}
+	_, ok := a[code]
+	return ok
+}
+
+// filter removes the options of msg that aren't allowed. The OPT record
+// itself, carrying the UDP size and the DO bit, is kept.
+func (a EDNSAllowlist) filter(msg *dns.Msg) {
+	if a == nil {
+		return
+	}
+	opt := msg.IsEdns0()
+	if opt == nil {
+		return
+	}
+	kept := opt.Option[:0]
+	for _, o := range opt.Option {
+		if a.allows(o.Option()) {
+			kept = append(kept, o)
+		}
+	}
+	clear(opt.Option[len(kept):])
+	opt.Option = kept
+}
+
+// intersect returns the options allowed by both a and b.
+func (a EDNSAllowlist) intersect(b EDNSAllowlist) EDNSAllowlist {
+	switch {
+	case a == nil:
+		return b
+	case b == nil:
+		return a
+	}
+	out := make(EDNSAllowlist)
+	for code := range a {
+		if _, ok := b[code]; ok {
+			out[code] = struct{}{}
+		}
+	}
+	return out
+}
+
+// ednsAllowlistFor returns the allowlist of group: the intersection of the
+// matching per-group allowlists, or the default one.
+func (s *DefaultServer) ednsAllowlistFor(group *nbdns.NameServerGroup) EDNSAllowlist {
+	var allow EDNSAllowlist
+	for _, key := range groupKeys(group) {
+		if a, ok := s.groupEDNSAllowlists[key]; ok {
+			allow = allow.intersect(a)
+		}
+	}
+	if allow != nil {
+		return allow
+	}
+	return s.ednsAllowlist
+}
+
+// setEDNSAllowlist filters the EDNS0 options of the queries forwarded to
+// servers and of their responses through allow. Called only while the
+// handler is built.
+func (u *upstreamResolverBase) setEDNSAllowlist(servers []netip.AddrPort, allow EDNSAllowlist) {
+	if allow == nil {
+		return
+	}
+	if u.ednsAllowlists == nil {
+		u.ednsAllowlists = make(map[netip.AddrPort]EDNSAllowlist, len(servers))
+	}
+	for _, s := range servers {
+		u.ednsAllowlists[s] = allow
+	}
+}
@@ -0,0 +1,134 @@
+package dns
+
+import (
+	"context"
+	"net/netip"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/miekg/dns"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/netbirdio/netbird/client/internal/dns/test"
+	nbdns "github.com/netbirdio/netbird/dns"
+)
+
+// ednsEchoClient records the EDNS0 options of the forwarded query and
+// answers with the options returned by response.
+type ednsEchoClient struct {
+	mu       sync.Mutex
+	sent     []uint16
+	response func() []dns.EDNS0
+}
+
+func (c *ednsEchoClient) exchange(_ context.Context, _ string, r *dns.Msg) (*dns.Msg, time.Duration, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.sent = optionCodes(r)
+
+	m := buildMockResponse(dns.RcodeSuccess, "192.0.2.100")
+	m.SetEdns0(dns.DefaultMsgSize, false)
+	m.IsEdns0().Option = c.response()
+	return m, time.Millisecond, nil
+}
+
+func optionCodes(m *dns.Msg) []uint16 {
+	opt := m.IsEdns0()
+	if opt == nil {
+		return nil
+	}
+	codes := []uint16{}
+	for _, o := range opt.Option {
+		codes = append(codes, o.Option())
+	}
+	return codes
+}
+
+func TestUpstreamResolver_EDNSAllowlist(t *testing.T) {
+	upstream := netip.MustParseAddrPort("192.0.2.1:53")
+	options := func() []dns.EDNS0 {
+		return []dns.EDNS0{
+			&dns.EDNS0_NSID{Code: dns.EDNS0NSID, Nsid: "6e62"},
+			&dns.EDNS0_SUBNET{Code: dns.EDNS0SUBNET, Family: 1, SourceNetmask: 24, Address: netip.MustParseAddr("198.51.100.0").AsSlice()},
+			&dns.EDNS0_COOKIE{Code: dns.EDNS0COOKIE, Cookie: "0102030405060708"},
+			&dns.EDNS0_PADDING{Padding: make([]byte, 8)},
+		}
+	}
+	all := []uint16{dns.EDNS0NSID, dns.EDNS0SUBNET, dns.EDNS0COOKIE, dns.EDNS0PADDING}
+
+	tests := []struct {
+		name  string
+		allow EDNSAllowlist
+		want  []uint16
+	}{
+		{"no allowlist", nil, all},
+		{"allowlist", ParseEDNSAllowlist([]string{"ecs", "cookie"}), []uint16{dns.EDNS0SUBNET, dns.EDNS0COOKIE}},
+		{"numeric code", ParseEDNSAllowlist([]string{"12"}), []uint16{dns.EDNS0PADDING}},
+		{"empty allowlist", EDNSAllowlist{}, []uint16{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+
+			client := &ednsEchoClient{response: options}
+			resolver := &upstreamResolverBase{
+				ctx:             ctx,
+				upstreamClient:  client,
+				upstreamTimeout: UpstreamTimeout,
+			}
+			resolver.addRace([]netip.AddrPort{upstream})
+			resolver.setEDNSAllowlist([]netip.AddrPort{upstream}, tt.allow)
+			// the client subnet is stripped unless the group forwards it
+			resolver.setClientSubnet([]netip.AddrPort{upstream}, true, netip.Prefix{})
+
+			q := new(dns.Msg).SetQuestion("example.com.", dns.TypeA)
+			q.SetEdns0(dns.DefaultMsgSize, true)
+			opt := q.IsEdns0()
+			opt.Option = options()
+
+			w := &test.MockResponseWriter{}
+			resolver.ServeDNS(w, q)
+			resp := w.GetLastResponse()
+			require.NotNil(t, resp)
+			require.NotNil(t, resp.IsEdns0(), "the OPT record is kept")
+
+			client.mu.Lock()
+			defer client.mu.Unlock()
+			assert.Equal(t, tt.want, client.sent, "options forwarded to the upstream")
+			assert.Equal(t, tt.want, optionCodes(resp), "options returned to the client")
+			assert.Equal(t, all, optionCodes(q), "the client request must not be modified")
+		})
+	}
+}
+
+func TestDefaultServer_EDNSAllowlistFor(t *testing.T) {
+	server := newTestServer(nil)
+	server.ednsAllowlist = ParseEDNSAllowlist([]string{"ecs", "cookie", "padding"})
+	server.groupEDNSAllowlists = ParseGroupEDNSAllowlists([]string{
+		"Corp.Example.com.=cookie,padding",
+		"192.0.2.53=padding,nsid",
+		".=",
+		"invalid",
+	})
+	require.Len(t, server.groupEDNSAllowlists, 3)
+
+	group := func(primary bool, ip string, domains ...string) *nbdns.NameServerGroup {
+		return &nbdns.NameServerGroup{
+			Primary:     primary,
+			Domains:     domains,
+			NameServers: []nbdns.NameServer{{IP: netip.MustParseAddr(ip), NSType: nbdns.UDPNameServerType, Port: 53}},
+		}
+	}
+
+	assert.Equal(t, server.ednsAllowlist, server.ednsAllowlistFor(group(false, "192.0.2.1", "other.example.com")), "groups without a key use the default")
+	assert.Equal(t, ParseEDNSAllowlist([]string{"cookie", "padding"}), server.ednsAllowlistFor(group(false, "192.0.2.1", "corp.example.com")))
+	assert.Equal(t, ParseEDNSAllowlist([]string{"padding"}), server.ednsAllowlistFor(group(false, "192.0.2.53", "corp.example.com")),
+		"several matching keys allow the options common to all")
+	assert.Equal(t, EDNSAllowlist{}, server.ednsAllowlistFor(group(true, "192.0.2.1")), "an empty entry strips every option")
+
+	server.ednsAllowlist = nil
+	assert.Nil(t, server.ednsAllowlistFor(group(false, "192.0.2.1", "other.example.com")), "nil lets every option through")
+}
@@ -0,0 +1,315 @@
+package dns
+
+import (
+	"net/netip"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/miekg/dns"
+	log "github.com/sirupsen/logrus"
+
+	"github.com/netbirdio/netbird/client/internal/dns/resutil"
+	"github.com/netbirdio/netbird/client/internal/peer"
+	nbdns "github.com/netbirdio/netbird/dns"
+)
+
+const (
+	// maxStaleAnswers bounds the answers a handler keeps for serving stale,
+	// so a burst of random names can't grow it without limit.
+	maxStaleAnswers = 4096
+	// staleAnswerTTL is the TTL stale answers are served with (RFC 8767).
+	staleAnswerTTL = 30
+	// groupsDownProbeInterval is how often a handler whose groups are all
+	// deactivated re-asks its upstreams while it answers queries itself, so
+	// the health projection sees them recover.
+	groupsDownProbeInterval = 5 * time.Second
+)
+
+// GroupsDownPolicy is how queries for a domain are answered while every
+// nameserver group serving it is deactivated.
+type GroupsDownPolicy int
+
+const (
+	// GroupsDownQuery keeps forwarding the queries to the deactivated
+	// groups, answering SERVFAIL when they fail. The default.
+	GroupsDownQuery GroupsDownPolicy = iota
+	// GroupsDownServeStale answers with the last answer the groups gave for
+	// the question, with a short TTL. Questions without one are forwarded.
+	GroupsDownServeStale
+	// GroupsDownServfail answers SERVFAIL without contacting the groups.
+	GroupsDownServfail
+	// GroupsDownFallThrough passes the queries on to the next handler, e.g.
+	// the primary nameservers or the host's original ones.
+	GroupsDownFallThrough
+)
+
+func (p GroupsDownPolicy) String() string {
+	switch p {
+	case GroupsDownServeStale:
+		return "stale"
+	case GroupsDownServfail:
+		return "servfail"
+	case GroupsDownFallThrough:
+		return "fallthrough"
+	default:
+		return "query"
+	}
+}
+
+func parseGroupsDownPolicy(name string) (GroupsDownPolicy, bool) {
+	switch strings.ToLower(strings.TrimSpace(name)) {
+	case "query":
+		return GroupsDownQuery, true
+	case "stale":
+		return GroupsDownServeStale, true
+	case "servfail":
+		return GroupsDownServfail, true
+	case "fallthrough":
+		return GroupsDownFallThrough, true
+	default:
+		return GroupsDownQuery, false
+	}
+}
+
+// ParseGroupsDownPolicies parses per-domain policy specs in format
+// domain=policy, policy being "query", "stale", "servfail" or "fallthrough".
+// The domain is a match domain of nameserver groups or "." for the primary
+// ones. Invalid specs are logged and skipped.
+func ParseGroupsDownPolicies(specs []string) map[string]GroupsDownPolicy {
+	policies := make(map[string]GroupsDownPolicy)
+	for _, spec := range specs {
+		key, name, ok := strings.Cut(spec, "=")
+		key = strings.TrimSpace(key)
+		policy, valid := parseGroupsDownPolicy(name)
+		if !ok || key == "" || !valid {
+			log.Warnf("invalid groups down policy %q, expected domain=query|stale|servfail|fallthrough", spec)
+			continue
+		}
+		if _, err := netip.ParseAddr(key); err == nil {
+			log.Warnf("invalid groups down policy %q, the key must be a domain", spec)
+			continue
+		}
+		policies[normalizeInflightKey(key)] = policy
+	}
+	return policies
+}
+
+// groupsDownPolicyFor returns the policy configured for the handler of the
+// match domain d.
+func (s *DefaultServer) groupsDownPolicyFor(d string) GroupsDownPolicy {
+	return s.groupsDownPolicies[normalizeInflightKey(d)]
+}
+
+// groupsDownSetter is implemented by the handlers that apply a
+// GroupsDownPolicy.
+type groupsDownSetter interface {
+	setGroupsDown(down bool)
+}
+
+// groupsDownHandlers returns the handlers of the current nameserver groups
+// by match domain. Caller must hold s.mux.
+func (s *DefaultServer) groupsDownHandlers() map[string]groupsDownSetter {
+	handlers := make(map[string]groupsDownSetter)
+	for _, entry := range s.dnsMuxHandlers {
+		if setter, ok := entry.handler.(groupsDownSetter); ok {
+			handlers[entry.domain] = setter
+		}
+	}
+	return handlers
+}
+
+// applyGroupsDown tells every handler in handlers whether all groups
+// serving its domain are deactivated according to states.
+func applyGroupsDown(handlers map[string]groupsDownSetter, groups []*nbdns.NameServerGroup, states []peer.NSGroupState) {
+	if len(handlers) == 0 {
+		return
+	}
+	enabled := make(map[nsGroupID]bool, len(states))
+	for _, state := range states {
+		enabled[nsGroupID(state.ID)] = state.Enabled
+	}
+
+	down := make(map[string]bool)
+	for _, group := range groups {
+		on, ok := enabled[generateGroupKey(group)]
+		if !ok {
+			continue
+		}
+		domains := group.Domains
+		if group.Primary {
+			domains = []string{nbdns.RootZone}
+		}
+		for _, d := range domains {
+			allDown, seen := down[d]
+			down[d] = (allDown || !seen) && !on
+		}
+	}
+	for d, handler := range handlers {
+		handler.setGroupsDown(down[d])
+	}
+}
+
+// staleKey identifies a question answers are kept for.
+type staleKey struct {
+	name   string
+	qtype  uint16
+	qclass uint16
+}
+
+func newStaleKey(q dns.Question) staleKey {
+	return staleKey{name: strings.ToLower(q.Name), qtype: q.Qtype, qclass: q.Qclass}
+}
+
+// groupsDownState holds the GroupsDownPolicy of a handler and whether its
+// groups are all deactivated.
+type groupsDownState struct {
+	policy  GroupsDownPolicy
+	down    atomic.Bool
+	probing atomic.Bool
+	// probeInterval is the minimum time between two background probes.
+	probeInterval time.Duration
+	// probeStarted, if set, is called when a background probe starts.
+	probeStarted func()
+
+	mu      sync.Mutex
+	answers map[staleKey]*dns.Msg
+}
+
+// setGroupsDownPolicy sets how the handler answers while all of its groups
+// are deactivated. Called only while the handler is built.
+func (u *upstreamResolverBase) setGroupsDownPolicy(policy GroupsDownPolicy) {
+	if policy == GroupsDownQuery {
+		u.groupsDown = nil
+		return
+	}
+	u.groupsDown = &groupsDownState{policy: policy, probeInterval: groupsDownProbeInterval}
+}
+
+// setGroupsDown records whether all groups of the handler are deactivated.
+func (u *upstreamResolverBase) setGroupsDown(down bool) {
+	g := u.groupsDown
+	if g == nil {
+		return
+	}
+	if g.down.Swap(down) == down {
+		return
+	}
+	if down {
+		log.Infof("all nameserver groups for domain=%s deactivated, answering with policy %s", u.domain.SafeString(), g.policy)
+	} else {
+		log.Infof("nameserver groups for domain=%s reactivated", u.domain.SafeString())
+	}
+}
+
+// rememberAnswer keeps rm as the stale answer to its question when the
+// handler serves stale.
+func (u *upstreamResolverBase) rememberAnswer(rm *dns.Msg) {
+	g := u.groupsDown
+	if g == nil || g.policy != GroupsDownServeStale || len(rm.Question) == 0 {
+		return
+	}
+	if rm.Rcode != dns.RcodeSuccess && rm.Rcode != dns.RcodeNameError {
+		return
+	}
+	key := newStaleKey(rm.Question[0])
+	answer := rm.Copy()
+	resutil.StripOPT(answer)
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if g.answers == nil {
+		g.answers = make(map[staleKey]*dns.Msg)
+	}
+	if _, ok := g.answers[key]; !ok && len(g.answers) >= maxStaleAnswers {
+		return
+	}
+	g.answers[key] = answer
+}
+
+// staleAnswer returns the kept answer to the question of r, adjusted to
+// reply to r, or nil if there is none.
+func (g *groupsDownState) staleAnswer(r *dns.Msg) *dns.Msg {
+	g.mu.Lock()
+	kept, ok := g.answers[newStaleKey(r.Question[0])]
+	g.mu.Unlock()
+	if !ok {
+		return nil
+	}
+
+	resp := kept.Copy()
+	resp.Id = r.Id
+	resp.Question = r.Question
+	for _, rrs := range [][]dns.RR{resp.Answer, resp.Ns, resp.Extra} {
+		for _, rr := range rrs {
+			rr.Header().Ttl = min(rr.Header().Ttl, staleAnswerTTL)
+		}
+	}
+	resutil.SetEDE(resp, r, dns.ExtendedErrorCodeStaleAnswer)
+	return resp
+}
+
+// answerGroupsDown answers r according to the handler's policy if all of its
+// groups are deactivated, and reports whether it did.
+func (u *upstreamResolverBase) answerGroupsDown(w dns.ResponseWriter, r *dns.Msg, logger *log.Entry) bool {
+	g := u.groupsDown
+	if g == nil || !g.down.Load() {
+		return false
+	}
+
+	var resp *dns.Msg
+	switch g.policy {
+	case GroupsDownServeStale:
+		if resp = g.staleAnswer(r); resp == nil {
+			return false
+		}
+	case GroupsDownServfail:
+		resp = new(dns.Msg)
+		resp.SetRcode(r, dns.RcodeServerFailure)
+	case GroupsDownFallThrough:
+		resp = new(dns.Msg)
+		resp.SetRcode(r, dns.RcodeNameError)
+		resp.MsgHdr.Zero = true
+	default:
+		return false
+	}
+
+	u.probeGroupsDown(r)
+	resutil.SetMeta(w, "groups_down", g.policy.String())
+	if err := w.WriteMsg(resp); err != nil {
+		logger.Errorf("failed to write groups down response for domain=%s: %v", r.Question[0].Name, err)
+	}
+	return true
+}
+
+// probeGroupsDown re-asks the upstreams the question in r in the background,
+// at most once per probe interval, so their recovery is noticed
+// while the handler doesn't forward queries to them.
+func (u *upstreamResolverBase) probeGroupsDown(r *dns.Msg) {
+	g := u.groupsDown
+	if !g.probing.CompareAndSwap(false, true) {
+		return
+	}
+	if g.probeStarted != nil {
+		g.probeStarted()
+	}
+
+	probe := r.Copy()
+	go func() {
+		defer g.probing.Store(false)
+		for _, upstream := range u.flatUpstreams() {
+			if u.ctx.Err() != nil {
+				return
+			}
+			if _, failure := u.queryUpstream(u.ctx, probe.Copy(), upstream, u.timeoutFor(upstream, u.upstreamTimeout)); failure == nil {
+				break
+			}
+		}
+
+		select {
+		case <-u.ctx.Done():
+		case <-time.After(g.probeInterval):
+		}
+	}()
+}
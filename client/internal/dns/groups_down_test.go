@@ -0,0 +1,258 @@
+package dns
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/netip"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/miekg/dns"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/netbirdio/netbird/client/internal/dns/test"
+	"github.com/netbirdio/netbird/client/internal/peer"
+	nbdns "github.com/netbirdio/netbird/dns"
+	"github.com/netbirdio/netbird/route"
+)
+
+// switchableClient answers every query with an A record until it's told to
+// fail, then times out. While blocked, queries wait until release is closed.
+type switchableClient struct {
+	failing atomic.Bool
+	queries atomic.Int32
+	blocked atomic.Bool
+	release chan struct{}
+}
+
+func (c *switchableClient) exchange(ctx context.Context, _ string, r *dns.Msg) (*dns.Msg, time.Duration, error) {
+	c.queries.Add(1)
+	if c.blocked.Load() {
+		select {
+		case <-c.release:
+		case <-ctx.Done():
+			return nil, 0, ctx.Err()
+		}
+	}
+	if c.failing.Load() {
+		return nil, 0, &net.OpError{Op: "read", Err: fmt.Errorf("i/o timeout")}
+	}
+	resp := new(dns.Msg).SetReply(r)
+	resp.Answer = []dns.RR{&dns.A{
+		Hdr: dns.RR_Header{Name: r.Question[0].Name, Rrtype: dns.TypeA, Class: dns.ClassINET, Ttl: 300},
+		A:   net.ParseIP("192.0.2.100"),
+	}}
+	return resp, time.Millisecond, nil
+}
+
+func TestParseGroupsDownPolicies(t *testing.T) {
+	policies := ParseGroupsDownPolicies([]string{
+		"Corp.Example.com.=stale",
+		"internal.example = SERVFAIL",
+		".=fallthrough",
+		"example.org=query",
+		"192.0.2.1=servfail",
+		"bogus",
+		"example.net=retry",
+		"=stale",
+	})
+	assert.Equal(t, map[string]GroupsDownPolicy{
+		"corp.example.com": GroupsDownServeStale,
+		"internal.example": GroupsDownServfail,
+		".":                GroupsDownFallThrough,
+		"example.org":      GroupsDownQuery,
+	}, policies)
+}
+
+type recordingGroupsDownSetter struct {
+	down *bool
+}
+
+func (s *recordingGroupsDownSetter) setGroupsDown(down bool) {
+	s.down = &down
+}
+
+func TestApplyGroupsDown(t *testing.T) {
+	group := func(ip string, primary bool, domains ...string) *nbdns.NameServerGroup {
+		return &nbdns.NameServerGroup{
+			Primary:     primary,
+			Domains:     domains,
+			NameServers: []nbdns.NameServer{{IP: netip.MustParseAddr(ip), NSType: nbdns.UDPNameServerType, Port: 53}},
+		}
+	}
+	first := group("192.0.2.1", false, "corp.example.com", "example.org")
+	second := group("192.0.2.2", false, "corp.example.com")
+	primary := group("192.0.2.3", true)
+	groups := []*nbdns.NameServerGroup{first, second, primary}
+	state := func(g *nbdns.NameServerGroup, enabled bool) peer.NSGroupState {
+		return peer.NSGroupState{ID: string(generateGroupKey(g)), Enabled: enabled}
+	}
+
+	corp := &recordingGroupsDownSetter{}
+	org := &recordingGroupsDownSetter{}
+	root := &recordingGroupsDownSetter{}
+	handlers := map[string]groupsDownSetter{"corp.example.com": corp, "example.org": org, nbdns.RootZone: root}
+
+	applyGroupsDown(handlers, groups, []peer.NSGroupState{state(first, false), state(second, true), state(primary, true)})
+	require.NotNil(t, corp.down)
+	assert.False(t, *corp.down, "a domain with an active group isn't down")
+	require.NotNil(t, org.down)
+	assert.True(t, *org.down, "the only group of the domain is deactivated")
+	require.NotNil(t, root.down)
+	assert.False(t, *root.down)
+
+	applyGroupsDown(handlers, groups, []peer.NSGroupState{state(first, false), state(second, false), state(primary, false)})
+	assert.True(t, *corp.down, "every group of the domain is deactivated")
+	assert.True(t, *root.down)
+
+	applyGroupsDown(handlers, groups, []peer.NSGroupState{state(first, true), state(second, false), state(primary, true)})
+	assert.False(t, *corp.down, "a reactivated group brings the domain back")
+	assert.False(t, *org.down)
+}
+
+func TestUpstreamResolver_GroupsDownPolicies(t *testing.T) {
+	first := netip.MustParseAddrPort("192.0.2.1:53")
+	second := netip.MustParseAddrPort("192.0.2.2:53")
+	groups := []*nbdns.NameServerGroup{
+		{Domains: []string{"corp.example.com"}, NameServers: []nbdns.NameServer{{IP: first.Addr(), NSType: nbdns.UDPNameServerType, Port: int(first.Port())}}},
+		{Domains: []string{"corp.example.com"}, NameServers: []nbdns.NameServer{{IP: second.Addr(), NSType: nbdns.UDPNameServerType, Port: int(second.Port())}}},
+	}
+
+	// setup builds the handler serving both groups with policy configured
+	// for their domain, has it answer cached.corp.example.com and then
+	// lets the health projection deactivate the groups after their
+	// upstreams failed.
+	setup := func(t *testing.T, policy GroupsDownPolicy) (*upstreamResolverBase, *switchableClient) {
+		t.Helper()
+		server := newTestServer(nil)
+		server.selectedRoutes = func() route.HAMap { return nil }
+		server.activeRoutes = func() route.HAMap { return nil }
+		server.warningDelayBase = defaultWarningDelayBase
+		server.groupsDownPolicies = ParseGroupsDownPolicies([]string{"corp.example.com=" + policy.String()})
+
+		updates, err := server.buildUpstreamHandlerUpdate(groups)
+		require.NoError(t, err)
+		require.Len(t, updates, 1)
+		resolver, ok := updates[0].handler.(*upstreamResolver)
+		require.True(t, ok)
+		handler := resolver.upstreamResolverBase
+		t.Cleanup(handler.Stop)
+		if policy == GroupsDownQuery {
+			require.Nil(t, handler.groupsDown)
+		} else {
+			require.NotNil(t, handler.groupsDown)
+			require.Equal(t, policy, handler.groupsDown.policy)
+		}
+
+		client := &switchableClient{release: make(chan struct{})}
+		handler.upstreamClient = client
+		handler.upstreamTimeout = 100 * time.Millisecond
+
+		server.mux.Lock()
+		server.dnsMuxHandlers = updates
+		server.updateNSGroupStates(groups)
+		server.mux.Unlock()
+
+		resp := serveGroupsDownQuery(t, handler, "cached.corp.example.com.")
+		require.Equal(t, dns.RcodeSuccess, resp.Rcode)
+		server.refreshHealth()
+		for _, state := range server.statusRecorder.GetDNSStates() {
+			require.True(t, state.Enabled)
+		}
+
+		client.failing.Store(true)
+		resp = serveGroupsDownQuery(t, handler, "other.corp.example.com.")
+		require.Equal(t, dns.RcodeServerFailure, resp.Rcode)
+		server.refreshHealth()
+		for _, state := range server.statusRecorder.GetDNSStates() {
+			require.False(t, state.Enabled, "group %s must be deactivated", state.ID)
+		}
+		return handler, client
+	}
+
+	t.Run("query", func(t *testing.T) {
+		handler, client := setup(t, GroupsDownQuery)
+		queries := client.queries.Load()
+
+		resp := serveGroupsDownQuery(t, handler, "cached.corp.example.com.")
+		assert.Equal(t, dns.RcodeServerFailure, resp.Rcode)
+		assert.Equal(t, queries+2, client.queries.Load(), "both groups are still queried")
+	})
+
+	t.Run("stale", func(t *testing.T) {
+		handler, client := setup(t, GroupsDownServeStale)
+
+		resp := serveGroupsDownQuery(t, handler, "cached.corp.example.com.")
+		assert.Equal(t, dns.RcodeSuccess, resp.Rcode)
+		require.Len(t, resp.Answer, 1)
+		assert.Contains(t, resp.Answer[0].String(), "192.0.2.100")
+		assert.Equal(t, uint32(staleAnswerTTL), resp.Answer[0].Header().Ttl)
+		assert.False(t, resp.MsgHdr.Zero)
+
+		queries := client.queries.Load()
+		resp = serveGroupsDownQuery(t, handler, "other.corp.example.com.")
+		assert.Equal(t, dns.RcodeServerFailure, resp.Rcode, "questions without a stale answer are forwarded")
+		assert.Greater(t, client.queries.Load(), queries)
+	})
+
+	t.Run("servfail", func(t *testing.T) {
+		handler, client := setup(t, GroupsDownServfail)
+		handler.groupsDown.probeInterval = time.Hour
+		var probes atomic.Int32
+		handler.groupsDown.probeStarted = func() { probes.Add(1) }
+		queries := client.queries.Load()
+
+		// The upstreams don't answer until released, so the response must
+		// not wait for them.
+		client.blocked.Store(true)
+		resp := serveGroupsDownQuery(t, handler, "cached.corp.example.com.")
+		assert.Equal(t, dns.RcodeServerFailure, resp.Rcode)
+		assert.False(t, resp.MsgHdr.Zero)
+		require.Equal(t, int32(1), probes.Load(), "the upstreams are probed in the background")
+		close(client.release)
+
+		// The upstreams are probed in the background, once per interval.
+		require.Eventually(t, func() bool { return client.queries.Load() == queries+2 }, time.Second, 5*time.Millisecond)
+		serveGroupsDownQuery(t, handler, "cached.corp.example.com.")
+		assert.Equal(t, int32(1), probes.Load(), "probes are rate limited")
+	})
+
+	t.Run("fallthrough", func(t *testing.T) {
+		handler, _ := setup(t, GroupsDownFallThrough)
+
+		resp := serveGroupsDownQuery(t, handler, "cached.corp.example.com.")
+		assert.Equal(t, dns.RcodeNameError, resp.Rcode)
+		assert.True(t, resp.MsgHdr.Zero, "the chain must continue with the next handler")
+	})
+
+	t.Run("recovery", func(t *testing.T) {
+		handler, client := setup(t, GroupsDownServfail)
+
+		client.failing.Store(false)
+		serveGroupsDownQuery(t, handler, "cached.corp.example.com.")
+		require.Eventually(t, func() bool {
+			for _, h := range handler.UpstreamHealth() {
+				if h.LastOk.After(h.LastFail) {
+					return true
+				}
+			}
+			return false
+		}, time.Second, 5*time.Millisecond, "the probe records the recovered upstream")
+
+		handler.setGroupsDown(false)
+		resp := serveGroupsDownQuery(t, handler, "cached.corp.example.com.")
+		assert.Equal(t, dns.RcodeSuccess, resp.Rcode)
+	})
+}
+
+func serveGroupsDownQuery(t *testing.T, handler *upstreamResolverBase, name string) *dns.Msg {
+	t.Helper()
+	var resp *dns.Msg
+	w := &test.MockResponseWriter{WriteMsgFunc: func(m *dns.Msg) error { resp = m; return nil }}
+	handler.ServeDNS(w, new(dns.Msg).SetQuestion(name, dns.TypeA))
+	require.NotNil(t, resp)
+	return resp
+}
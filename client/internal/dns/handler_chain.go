@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"math"
 	"net"
+	"net/netip"
 	"slices"
 	"strconv"
 	"strings"
@@ -18,12 +19,34 @@ import (
 )
 
 const (
-	PriorityMgmtCache = 150
-	PriorityDNSRoute  = 100
-	PriorityLocal     = 75
-	PriorityUpstream  = 50
-	PriorityDefault   = 1
-	PriorityFallback  = -100
+	PriorityMgmtCache          = 150
+	PriorityPostureRemediation = 140
+	PriorityTimePolicy         = 130
+	PriorityCaptivePortal      = 120
+	PriorityDNSRoute           = 100
+	PriorityLocal              = 75
+	PriorityPeerReverse        = 72
+	PriorityLoopback           = 70
+	PrioritySearchDomain       = 65
+	PriorityMirror             = 60
+	PrioritySuppressAAAA       = 58
+	PriorityReverseCache       = 55
+	PriorityUpstream           = 50
+	PriorityDefault            = 1
+	PriorityFallback           = -100
+	PriorityPrivateReverse     = -150
+	PriorityUnmatched          = -200
+)
+
+const (
+	// maxNameOctets and maxNameLabels are the DNS limits for a name in wire
+	// format (RFC 1035 section 2.3.4), including the root label.
+	maxNameOctets = 255
+	maxNameLabels = 127
+	// maxNamePresentationLen bounds the presentation form, where every
+	// octet may be escaped as \DDD. Longer names are rejected without
+	// parsing them.
+	maxNamePresentationLen = 4 * maxNameOctets
 )
 
 type SubdomainMatcher interface {
@@ -38,12 +61,47 @@ type HandlerEntry struct {
 	OrigPattern     string
 	IsWildcard      bool
 	MatchSubdomains bool
+	// QTypes are the query types the handler is tried for, every type if
+	// empty. Queries of other types go on to the next handler.
+	QTypes []uint16
+	// counter counts the queries the handler answered, see HandlerStats.
+	counter *handlerCounter
 }
 
 // HandlerChain represents a prioritized chain of DNS handlers
 type HandlerChain struct {
 	mu       sync.RWMutex
 	handlers []HandlerEntry
+	// index matches query names against handlers. Reset whenever handlers
+	// change and rebuilt by the next query.
+	index *handlerIndex
+	// audit, when non-nil, is notified of every answered query.
+	audit *auditConfig
+	// sortSource, when non-nil, returns the addresses address answers are
+	// sorted relative to. See SetAnswerSortSource.
+	sortSource func() []netip.Addr
+	// queryTap, when non-nil, receives every answered client query.
+	queryTap queryTap
+	// swap holds client queries back while the handler set is replaced.
+	swap *swapBuffer
+	// rewriter, when non-nil, rewrites upstream answers to client queries.
+	// See SetRewriteRules.
+	rewriter *answerRewriter
+	// stripDNSSEC removes DNSSEC records from responses to client queries
+	// without DO. See SetDNSSECStripping.
+	stripDNSSEC bool
+	// maxUDPSize caps the responses to client queries over UDP, see
+	// SetUDPResponseSize. Zero disables the cap.
+	maxUDPSize int
+	// matchStats accumulates the time spent selecting handlers.
+	matchStats matchStats
+	// names normalizes handler patterns and query names alike, see
+	// SetNamePolicy.
+	names NamePolicy
+	// metrics, when non-nil, counts the answered queries.
+	metrics *dnsMetrics
+	// queryLog logs every query at info level, see SetQueryLogging.
+	queryLog bool
 }
 
 // ResponseWriterChain wraps a dns.ResponseWriter to track if handler wants to continue chain
@@ -52,6 +110,11 @@ type ResponseWriterChain struct {
 	origPattern    string
 	requestID      string
 	shouldContinue bool
+	continueReason resutil.Negative
+	sortSource     func() []netip.Addr
+	rewriter       *answerRewriter
+	stripDNSSEC    bool
+	udpLimit       int
 	response       *dns.Msg
 	meta           map[string]string
 }
@@ -70,11 +133,29 @@ func (w *ResponseWriterChain) SetMeta(key, value string) {
 }
 
 func (w *ResponseWriterChain) WriteMsg(m *dns.Msg) error {
-	// Check if this is a continue signal (NXDOMAIN with Zero bit set)
-	if m.Rcode == dns.RcodeNameError && m.MsgHdr.Zero {
-		w.shouldContinue = true
-		return nil
+	// Check if this is a continue signal: a negative answer (NXDOMAIN or
+	// NODATA) with the Zero bit set. Handlers decide per zone which of the
+	// two they pass on; any other response with the Zero bit is final.
+	if m.MsgHdr.Zero {
+		if kind := resutil.ClassifyNegative(m); kind != resutil.NotNegative {
+			w.shouldContinue = true
+			w.continueReason = kind
+			return nil
+		}
 	}
+	if w.rewriter != nil {
+		var rule *rewriteRule
+		if m, rule = w.rewriter.rewrite(m); rule != nil {
+			w.SetMeta("rewrite", rule.Pattern)
+		}
+	}
+	if w.sortSource != nil {
+		m = sortAnswers(m, w.sortSource())
+	}
+	if w.stripDNSSEC {
+		m = stripDNSSEC(m)
+	}
+	m = truncateUDPResponse(m, w.udpLimit)
 	w.response = m
 	if m.MsgHdr.Truncated {
 		w.SetMeta("truncated", "true")
@@ -85,6 +166,7 @@ func (w *ResponseWriterChain) WriteMsg(m *dns.Msg) error {
 func NewHandlerChain() *HandlerChain {
 	return &HandlerChain{
 		handlers: make([]HandlerEntry, 0),
+		swap:     newSwapBuffer(),
 	}
 }
 
@@ -93,20 +175,23 @@ func (w *ResponseWriterChain) GetOrigPattern() string {
 	return w.origPattern
 }
 
-// AddHandler adds a new handler to the chain, replacing any existing handler with the same pattern and priority
-func (c *HandlerChain) AddHandler(pattern string, handler dns.Handler, priority int) {
+// AddHandler adds a new handler to the chain, replacing any existing handler with the same pattern, priority
+// and query types. With qtypes the handler is only tried for queries of these types, and before the handlers
+// of the same pattern and priority without query types.
+func (c *HandlerChain) AddHandler(pattern string, handler dns.Handler, priority int, qtypes ...uint16) {
 	c.mu.Lock()
 	defer c.mu.Unlock()
 
-	pattern = strings.ToLower(dns.Fqdn(pattern))
+	qtypes = normalizeQTypes(qtypes)
+	pattern = c.names.Normalize(pattern)
 	origPattern := pattern
 	isWildcard := strings.HasPrefix(pattern, "*.")
 	if isWildcard {
 		pattern = pattern[2:]
 	}
 
-	// First remove any existing handler with same pattern (case-insensitive) and priority
-	c.removeEntry(origPattern, priority)
+	// First remove any existing handler with same pattern, priority and query types
+	c.removeEntry(origPattern, priority, qtypes)
 
 	// Check if handler implements SubdomainMatcher interface
 	matchSubdomains := false
@@ -114,8 +199,8 @@ func (c *HandlerChain) AddHandler(pattern string, handler dns.Handler, priority
 		matchSubdomains = matcher.MatchSubdomains()
 	}
 
-	log.Debugf("adding handler pattern: domain=%s original: domain=%s wildcard=%v match_subdomain=%v priority=%d",
-		pattern, origPattern, isWildcard, matchSubdomains, priority)
+	log.Debugf("adding handler pattern: domain=%s original: domain=%s wildcard=%v match_subdomain=%v priority=%d qtypes=[%s]",
+		pattern, origPattern, isWildcard, matchSubdomains, priority, qtypesKey(qtypes))
 
 	entry := HandlerEntry{
 		Handler:         handler,
@@ -124,10 +209,13 @@ func (c *HandlerChain) AddHandler(pattern string, handler dns.Handler, priority
 		OrigPattern:     origPattern,
 		IsWildcard:      isWildcard,
 		MatchSubdomains: matchSubdomains,
+		QTypes:          qtypes,
+		counter:         &handlerCounter{},
 	}
 
 	pos := c.findHandlerPosition(entry)
 	c.handlers = append(c.handlers[:pos], append([]HandlerEntry{entry}, c.handlers[pos:]...)...)
+	c.index = nil
 
 	c.logHandlers()
 }
@@ -147,6 +235,10 @@ func (c *HandlerChain) findHandlerPosition(newEntry HandlerEntry) int {
 			if newDots > existingDots {
 				return i
 			}
+			// query type specific handlers before those for every type
+			if newDots == existingDots && len(newEntry.QTypes) > 0 && len(h.QTypes) == 0 {
+				return i
+			}
 		}
 	}
 
@@ -154,23 +246,22 @@ func (c *HandlerChain) findHandlerPosition(newEntry HandlerEntry) int {
 	return len(c.handlers)
 }
 
-// RemoveHandler removes a handler for the given pattern and priority
-func (c *HandlerChain) RemoveHandler(pattern string, priority int) {
+// RemoveHandler removes a handler for the given pattern, priority and query types
+func (c *HandlerChain) RemoveHandler(pattern string, priority int, qtypes ...uint16) {
 	c.mu.Lock()
 	defer c.mu.Unlock()
 
-	pattern = dns.Fqdn(pattern)
-
-	c.removeEntry(pattern, priority)
+	c.removeEntry(c.names.Normalize(pattern), priority, normalizeQTypes(qtypes))
 }
 
-func (c *HandlerChain) removeEntry(pattern string, priority int) {
-	// Find and remove handlers matching both original pattern (case-insensitive) and priority
+func (c *HandlerChain) removeEntry(pattern string, priority int, qtypes []uint16) {
+	// Find and remove handlers matching the normalized original pattern, priority and query types
 	for i := len(c.handlers) - 1; i >= 0; i-- {
 		entry := c.handlers[i]
-		if strings.EqualFold(entry.OrigPattern, pattern) && entry.Priority == priority {
+		if entry.OrigPattern == pattern && entry.Priority == priority && slices.Equal(entry.QTypes, qtypes) {
 			log.Debugf("removing handler pattern: domain=%s priority=%d", entry.OrigPattern, priority)
 			c.handlers = append(c.handlers[:i], c.handlers[i+1:]...)
+			c.index = nil
 			c.logHandlers()
 			break
 		}
@@ -189,21 +280,62 @@ func (c *HandlerChain) logHandlers() {
 		b.WriteString("  - pattern: domain=" + h.Pattern + " original: domain=" + h.OrigPattern +
 			" wildcard=" + strconv.FormatBool(h.IsWildcard) +
 			" match_subdomain=" + strconv.FormatBool(h.MatchSubdomains) +
-			" priority=" + strconv.Itoa(h.Priority) + "\n")
+			" priority=" + strconv.Itoa(h.Priority) +
+			" qtypes=[" + qtypesKey(h.QTypes) + "]\n")
 	}
 	log.Trace(strings.TrimSuffix(b.String(), "\n"))
 }
 
 func (c *HandlerChain) ServeDNS(w dns.ResponseWriter, r *dns.Msg) {
+	if !c.swap.wait() {
+		c.answerSwapPending(w, r)
+		return
+	}
 	c.dispatch(w, r, math.MaxInt)
 }
 
+// SetSwapQueue bounds the queries held back during a handler swap to size,
+// each waiting at most timeout. Zero values use the defaults, a negative
+// size serves queries with the partial handler set instead.
+func (c *HandlerChain) SetSwapQueue(size int, timeout time.Duration) {
+	c.swap.configure(size, timeout)
+}
+
+// BeginSwap holds client queries back until EndSwap, so removing and adding
+// handlers looks atomic to them. Queries beyond the queue bound or waiting
+// longer than its timeout are answered with SERVFAIL.
+func (c *HandlerChain) BeginSwap() {
+	c.swap.begin()
+}
+
+// EndSwap serves the queries held back since BeginSwap with the new handlers.
+func (c *HandlerChain) EndSwap() {
+	c.swap.end()
+}
+
+// answerSwapPending answers a query that couldn't wait for a handler swap.
+func (c *HandlerChain) answerSwapPending(w dns.ResponseWriter, r *dns.Msg) {
+	if len(r.Question) > 0 {
+		log.Debugf("handler swap in progress, answering SERVFAIL for %s", r.Question[0].Name)
+	}
+	resp := &dns.Msg{}
+	resp.SetRcode(r, dns.RcodeServerFailure)
+	resutil.SetEDE(resp, r, dns.ExtendedErrorCodeNotReady)
+	if err := w.WriteMsg(resp); err != nil {
+		log.Errorf("failed to write DNS response: %v", err)
+	}
+}
+
 // dispatch routes a DNS request through the chain, skipping handlers with
 // priority > maxPriority. Shared by ServeDNS and ResolveInternal.
 func (c *HandlerChain) dispatch(w dns.ResponseWriter, r *dns.Msg, maxPriority int) {
 	if len(r.Question) == 0 {
 		return
 	}
+	if !validQuestionName(r.Question[0].Name) {
+		c.answerFormErr(w, r)
+		return
+	}
 
 	startTime := time.Now()
 	requestID := resutil.GenerateRequestID()
@@ -211,26 +343,56 @@ func (c *HandlerChain) dispatch(w dns.ResponseWriter, r *dns.Msg, maxPriority in
 		"request_id": requestID,
 		"dns_id":     fmt.Sprintf("%04x", r.Id),
 	}
+	var client string
 	if addr := w.RemoteAddr(); addr != nil {
-		fields["client"] = addr.String()
+		client = addr.String()
+		fields["client"] = client
 	}
 	logger := log.WithFields(fields)
 
-	question := r.Question[0]
-	qname := strings.ToLower(question.Name)
+	// matchTime sums the time spent finding handlers, from matchStart until
+	// one is found and again after each that passes the query on.
+	matchStart := time.Now()
+	var matchTime time.Duration
 
 	c.mu.RLock()
-	handlers := slices.Clone(c.handlers)
+	names := c.names
+	index := c.index
+	audit := c.audit
+	sortSource := c.sortSource
+	tap := c.queryTap
+	rewriter := c.rewriter
+	strip := c.stripDNSSEC && !wantsDNSSEC(r)
+	maxUDPSize := c.maxUDPSize
+	metrics := c.metrics
+	queryLog := c.queryLog
 	c.mu.RUnlock()
+	if index == nil {
+		index = c.buildIndex()
+	}
 
-	// Try handlers in priority order
-	for _, entry := range handlers {
-		if entry.Priority > maxPriority {
-			continue
-		}
-		if !c.isHandlerMatch(qname, entry) {
+	question := r.Question[0]
+	qname := names.Normalize(question.Name)
+
+	// Internal lookups, like those of rewrite targets, are never rewritten
+	// or stripped.
+	if _, internal := w.(*internalResponseWriter); internal {
+		rewriter = nil
+		strip = false
+	}
+
+	var udpLimit int
+	if addr := w.RemoteAddr(); addr != nil && addr.Network() == "udp" {
+		udpLimit = udpResponseLimit(r, maxUDPSize)
+	}
+
+	// Try matching handlers in priority order
+	for _, i := range index.match(qname) {
+		entry := index.handlers[i]
+		if entry.Priority > maxPriority || !entry.matchesType(question.Qtype) {
 			continue
 		}
+		matchTime += time.Since(matchStart)
 
 		handlerName := entry.OrigPattern
 		if s, ok := entry.Handler.(interface{ String() string }); ok {
@@ -245,29 +407,103 @@ func (c *HandlerChain) dispatch(w dns.ResponseWriter, r *dns.Msg, maxPriority in
 			ResponseWriter: w,
 			origPattern:    entry.OrigPattern,
 			requestID:      requestID,
+			sortSource:     sortSource,
+			stripDNSSEC:    strip,
+			udpLimit:       udpLimit,
+		}
+		if entry.Priority <= PriorityUpstream {
+			chainWriter.rewriter = rewriter
 		}
 		entry.Handler.ServeDNS(chainWriter, r)
 
 		// If handler wants to continue, try next handler
 		if chainWriter.shouldContinue {
 			if entry.Priority != PriorityMgmtCache {
-				logger.Tracef("handler requested continue for domain=%s", qname)
+				logger.Tracef("handler requested continue for domain=%s reason=%s", qname, chainWriter.continueReason)
 			}
+			matchStart = time.Now()
 			continue
 		}
+		c.matchStats.record(matchTime)
+		entry.counter.record(time.Now())
 
 		c.logResponse(logger, chainWriter, qname, startTime)
+		if queryLog {
+			logQuery(logger, question, qname, entry, handlerName, chainWriter, startTime)
+		}
+		if chainWriter.response != nil {
+			metrics.recordQuery(entry.OrigPattern, chainWriter.response.Rcode)
+		}
+		if audit != nil {
+			audit.notify(QueryInfo{
+				RequestID: requestID,
+				Client:    client,
+				Name:      qname,
+				Type:      dns.TypeToString[question.Qtype],
+			}, entry, chainWriter.response)
+		}
+		if tap != nil && client != "" {
+			tap.tap(w, r, chainWriter.response, startTime, time.Now())
+		}
 		return
 	}
 
 	// No handler matched or all handlers passed
+	c.matchStats.record(matchTime + time.Since(matchStart))
 	logger.Tracef("no handler found for domain=%s type=%s class=%s",
 		qname, dns.TypeToString[question.Qtype], dns.ClassToString[question.Qclass])
+	if queryLog {
+		logUnansweredQuery(logger, question, qname, startTime)
+	}
 	resp := &dns.Msg{}
 	resp.SetRcode(r, dns.RcodeRefused)
+	resutil.SetEDE(resp, r, dns.ExtendedErrorCodeNotAuthoritative)
 	if err := w.WriteMsg(resp); err != nil {
 		logger.Errorf("failed to write DNS response: %v", err)
 	}
+	metrics.recordQuery("", resp.Rcode)
+	if tap != nil && client != "" {
+		tap.tap(w, r, resp, startTime, time.Now())
+	}
+}
+
+// buildIndex returns the handler index, building it if the handlers changed
+// since it was last built.
+func (c *HandlerChain) buildIndex() *handlerIndex {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.index == nil {
+		c.index = newHandlerIndex(c.handlers)
+	}
+	return c.index
+}
+
+// validQuestionName reports whether name is within the DNS length and label
+// limits, so it is safe to normalize and match against handlers.
+func validQuestionName(name string) bool {
+	if len(name) > maxNamePresentationLen {
+		return false
+	}
+	// Packing enforces the label and wire length limits. dns.IsDomainName
+	// doesn't count the root label and lets 256 octet names pass.
+	var buf [maxNameOctets]byte
+	if _, err := dns.PackDomainName(dns.Fqdn(name), buf[:], 0, nil, false); err != nil {
+		return false
+	}
+	return dns.CountLabel(name) <= maxNameLabels
+}
+
+// answerFormErr answers a query whose name exceeds the DNS limits. The
+// question isn't echoed, as the name can't be packed.
+func (c *HandlerChain) answerFormErr(w dns.ResponseWriter, r *dns.Msg) {
+	log.Debugf("rejecting query with an invalid name of %d characters", len(r.Question[0].Name))
+	resp := &dns.Msg{}
+	resp.SetRcode(r, dns.RcodeFormatError)
+	resp.Question = nil
+	if err := w.WriteMsg(resp); err != nil {
+		log.Errorf("failed to write DNS response: %v", err)
+	}
 }
 
 func (c *HandlerChain) logResponse(logger *log.Entry, cw *ResponseWriterChain, qname string, startTime time.Time) {
@@ -334,6 +570,23 @@ func (c *HandlerChain) HasRootHandlerAtOrBelow(maxPriority int) bool {
 	return false
 }
 
+// RootHandlers returns the "." handlers, from the highest priority down.
+func (c *HandlerChain) RootHandlers() []HandlerEntry {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	var entries []HandlerEntry
+	for _, h := range c.handlers {
+		if h.Pattern == "." {
+			entries = append(entries, h)
+		}
+	}
+	return entries
+}
+
+// isHandlerMatch reports whether entry matches qname, normalized by the
+// chain's NamePolicy. Queries are matched through handlerIndex, which must
+// agree with it.
 func (c *HandlerChain) isHandlerMatch(qname string, entry HandlerEntry) bool {
 	switch {
 	case entry.Pattern == ".":
@@ -345,9 +598,9 @@ func (c *HandlerChain) isHandlerMatch(qname string, entry HandlerEntry) bool {
 		// If handler wants subdomain matching, allow suffix match
 		// Otherwise require exact match
 		if entry.MatchSubdomains {
-			return strings.EqualFold(qname, entry.Pattern) || strings.HasSuffix(qname, "."+entry.Pattern)
+			return qname == entry.Pattern || strings.HasSuffix(qname, "."+entry.Pattern)
 		} else {
-			return strings.EqualFold(qname, entry.Pattern)
+			return qname == entry.Pattern
 		}
 	}
 }
@@ -3,6 +3,7 @@ package dns_test
 import (
 	"context"
 	"net"
+	"strings"
 	"testing"
 	"time"
 
@@ -12,7 +13,9 @@ import (
 	"github.com/stretchr/testify/require"
 
 	nbdns "github.com/netbirdio/netbird/client/internal/dns"
+	"github.com/netbirdio/netbird/client/internal/dns/resutil"
 	"github.com/netbirdio/netbird/client/internal/dns/test"
+	"github.com/netbirdio/netbird/client/internal/dns/types"
 )
 
 // TestHandlerChain_ServeDNS_Priorities tests that handlers are executed in priority order
@@ -1267,3 +1270,228 @@ func TestHandlerChain_HasRootHandlerAtOrBelow(t *testing.T) {
 	chain.RemoveHandler(".", nbdns.PriorityFallback)
 	assert.False(t, chain.HasRootHandlerAtOrBelow(nbdns.PriorityUpstream))
 }
+
+// recordingAuditSink collects audit notifications for assertions.
+type recordingAuditSink struct {
+	infos []nbdns.QueryInfo
+	ids   []types.HandlerID
+	codes []int
+}
+
+func (s *recordingAuditSink) OnAnswered(info nbdns.QueryInfo, handlerID types.HandlerID, rcode int) {
+	s.infos = append(s.infos, info)
+	s.ids = append(s.ids, handlerID)
+	s.codes = append(s.codes, rcode)
+}
+
+func TestHandlerChain_AuditSink(t *testing.T) {
+	r := new(dns.Msg)
+	r.SetQuestion("Example.COM.", dns.TypeA)
+
+	t.Run("summary only by default", func(t *testing.T) {
+		chain := nbdns.NewHandlerChain()
+		chain.AddHandler("example.com.", &answeringHandler{name: "upstream", ip: "10.0.0.1"}, nbdns.PriorityUpstream)
+
+		sink := &recordingAuditSink{}
+		chain.SetAuditSink(sink, false)
+
+		chain.ServeDNS(&test.MockResponseWriter{}, r)
+
+		require.Len(t, sink.infos, 1)
+		info := sink.infos[0]
+		assert.Equal(t, "example.com.", info.Name)
+		assert.Equal(t, "A", info.Type)
+		assert.Equal(t, "upstream", info.HandlerType)
+		assert.Equal(t, "example.com.", info.Pattern)
+		assert.Equal(t, "1 [A]", info.Answer)
+		assert.NotContains(t, info.Answer, "10.0.0.1", "answer data must not leak without full answers")
+		assert.NotEmpty(t, info.RequestID)
+		assert.Equal(t, types.HandlerID("example.com."), sink.ids[0], "handlers without ID fall back to their pattern")
+		assert.Equal(t, dns.RcodeSuccess, sink.codes[0])
+	})
+
+	t.Run("full answers when configured", func(t *testing.T) {
+		chain := nbdns.NewHandlerChain()
+		chain.AddHandler("example.com.", &answeringHandler{name: "local", ip: "10.0.0.2"}, nbdns.PriorityLocal)
+
+		sink := &recordingAuditSink{}
+		chain.SetAuditSink(sink, true)
+
+		chain.ServeDNS(&test.MockResponseWriter{}, r)
+
+		require.Len(t, sink.infos, 1)
+		assert.Equal(t, "local", sink.infos[0].HandlerType)
+		assert.Contains(t, sink.infos[0].Answer, "10.0.0.2")
+	})
+
+	t.Run("continuing handlers are not reported", func(t *testing.T) {
+		chain := nbdns.NewHandlerChain()
+		chain.AddHandler("example.com.", &answeringHandler{name: "fallback", ip: "10.0.0.3"}, nbdns.PriorityFallback)
+		passHandler := &nbdns.MockSubdomainHandler{Subdomains: true}
+		passHandler.On("ServeDNS", mock.Anything, r).Run(func(args mock.Arguments) {
+			resp := new(dns.Msg)
+			resp.SetRcode(r, dns.RcodeNameError)
+			resp.MsgHdr.Zero = true
+			_ = args.Get(0).(dns.ResponseWriter).WriteMsg(resp)
+		}).Once()
+		chain.AddHandler("example.com.", passHandler, nbdns.PriorityLocal)
+
+		sink := &recordingAuditSink{}
+		chain.SetAuditSink(sink, false)
+
+		chain.ServeDNS(&test.MockResponseWriter{}, r)
+
+		require.Len(t, sink.infos, 1)
+		assert.Equal(t, "fallback", sink.infos[0].HandlerType)
+	})
+
+	t.Run("nil sink disables auditing", func(t *testing.T) {
+		chain := nbdns.NewHandlerChain()
+		chain.AddHandler("example.com.", &answeringHandler{name: "upstream", ip: "10.0.0.1"}, nbdns.PriorityUpstream)
+
+		sink := &recordingAuditSink{}
+		chain.SetAuditSink(sink, false)
+		chain.SetAuditSink(nil, false)
+
+		chain.ServeDNS(&test.MockResponseWriter{}, r)
+		assert.Empty(t, sink.infos)
+	})
+}
+
+// negativeHandler answers with an empty answer section and the given rcode,
+// optionally flagged as a continue signal.
+type negativeHandler struct {
+	rcode  int
+	signal bool
+}
+
+func (h *negativeHandler) ServeDNS(w dns.ResponseWriter, r *dns.Msg) {
+	resp := &dns.Msg{}
+	resp.SetRcode(r, h.rcode)
+	resp.MsgHdr.Zero = h.signal
+	_ = w.WriteMsg(resp)
+}
+
+func TestHandlerChain_NegativeFallthrough(t *testing.T) {
+	tests := []struct {
+		name           string
+		rcode          int
+		continueSignal bool
+		wantFallback   bool
+	}{
+		{name: "NXDOMAIN with continue signal falls through", rcode: dns.RcodeNameError, continueSignal: true, wantFallback: true},
+		{name: "NODATA with continue signal falls through", rcode: dns.RcodeSuccess, continueSignal: true, wantFallback: true},
+		{name: "NXDOMAIN without continue signal is final", rcode: dns.RcodeNameError, wantFallback: false},
+		{name: "NODATA without continue signal is final", rcode: dns.RcodeSuccess, wantFallback: false},
+		{name: "SERVFAIL with Zero bit is final", rcode: dns.RcodeServerFailure, continueSignal: true, wantFallback: false},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			chain := nbdns.NewHandlerChain()
+			chain.AddHandler("example.com.", &negativeHandler{rcode: tc.rcode, signal: tc.continueSignal}, nbdns.PriorityLocal)
+			chain.AddHandler("example.com.", &answeringHandler{name: "fallback", ip: "10.0.0.9"}, nbdns.PriorityFallback)
+
+			r := new(dns.Msg)
+			r.SetQuestion("example.com.", dns.TypeAAAA)
+
+			w := &test.MockResponseWriter{}
+			chain.ServeDNS(w, r)
+
+			resp := w.GetLastResponse()
+			require.NotNil(t, resp)
+			if tc.wantFallback {
+				assert.Len(t, resp.Answer, 1, "fallback handler should have answered")
+				return
+			}
+			assert.Equal(t, tc.rcode, resp.Rcode)
+			assert.Empty(t, resp.Answer)
+		})
+	}
+}
+
+// TestHandlerChain_RefusedCarriesEDE verifies that a query no handler accepts
+// is refused with an Extended DNS Error, and only toward EDNS0 clients.
+func TestHandlerChain_RefusedCarriesEDE(t *testing.T) {
+	chain := nbdns.NewHandlerChain()
+
+	t.Run("edns0 client", func(t *testing.T) {
+		r := new(dns.Msg).SetQuestion("unhandled.example.com.", dns.TypeA)
+		r.SetEdns0(dns.DefaultMsgSize, false)
+		w := &test.MockResponseWriter{}
+		chain.ServeDNS(w, r)
+
+		resp := w.GetLastResponse()
+		require.NotNil(t, resp)
+		assert.Equal(t, dns.RcodeRefused, resp.Rcode)
+		ede, ok := resutil.ExtractEDE(resp)
+		require.True(t, ok, "refused response should carry an EDE")
+		assert.Equal(t, dns.ExtendedErrorCodeNotAuthoritative, ede.InfoCode)
+	})
+
+	t.Run("client without edns0", func(t *testing.T) {
+		r := new(dns.Msg).SetQuestion("unhandled.example.com.", dns.TypeA)
+		w := &test.MockResponseWriter{}
+		chain.ServeDNS(w, r)
+
+		resp := w.GetLastResponse()
+		require.NotNil(t, resp)
+		assert.Equal(t, dns.RcodeRefused, resp.Rcode)
+		assert.Nil(t, resp.IsEdns0(), "OPT must not be sent to a non-EDNS0 client")
+	})
+}
+
+// TestHandlerChain_RejectsOversizedNames verifies that names beyond the DNS
+// limits are answered with FORMERR before any handler is consulted, and that
+// names right at the limits are still served.
+func TestHandlerChain_RejectsOversizedNames(t *testing.T) {
+	label63 := strings.Repeat("a", 63)
+
+	var served []string
+	chain := nbdns.NewHandlerChain()
+	chain.AddHandler(".", dns.HandlerFunc(func(w dns.ResponseWriter, r *dns.Msg) {
+		served = append(served, r.Question[0].Name)
+		_ = w.WriteMsg(new(dns.Msg).SetReply(r))
+	}), nbdns.PriorityDefault)
+
+	tests := []struct {
+		name  string
+		qname string
+		valid bool
+	}{
+		{name: "255 octets", qname: strings.Repeat(label63+".", 3) + strings.Repeat("b", 61) + ".", valid: true},
+		{name: "127 labels", qname: strings.Repeat("a.", 127), valid: true},
+		{name: "256 octets", qname: strings.Repeat(label63+".", 3) + strings.Repeat("b", 62) + "."},
+		{name: "128 labels", qname: strings.Repeat("a.", 128)},
+		{name: "label over 63 octets", qname: strings.Repeat("a", 64) + ".example.com."},
+		{name: "escaped octets over the limit", qname: strings.Repeat(`\000`, 64) + ".example.com."},
+		{name: "deeply nested", qname: strings.Repeat("x.", 100_000)},
+		{name: "megabyte name", qname: strings.Repeat("a", 1<<20) + "."},
+		{name: "punycode label over the limit", qname: "xn--" + strings.Repeat("a", 100) + ".example.com."},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			served = nil
+			w := &test.MockResponseWriter{}
+
+			start := time.Now()
+			chain.ServeDNS(w, &dns.Msg{
+				MsgHdr:   dns.MsgHdr{Id: dns.Id(), RecursionDesired: true},
+				Question: []dns.Question{{Name: tc.qname, Qtype: dns.TypeA, Qclass: dns.ClassINET}},
+			})
+			assert.Less(t, time.Since(start), time.Second)
+
+			resp := w.GetLastResponse()
+			require.NotNil(t, resp)
+			if tc.valid {
+				assert.Equal(t, dns.RcodeSuccess, resp.Rcode)
+				assert.Equal(t, []string{tc.qname}, served)
+				return
+			}
+			assert.Equal(t, dns.RcodeFormatError, resp.Rcode)
+			assert.Empty(t, served, "no handler may see an invalid name")
+			_, err := resp.Pack()
+			assert.NoError(t, err, "the FORMERR response must be packable")
+		})
+	}
+}
@@ -0,0 +1,97 @@
+package dns
+
+import (
+	"slices"
+	"strings"
+)
+
+// handlerIndex finds the handlers matching a name in O(labels) instead of
+// testing every handler. It is built from a snapshot of the chain and never
+// modified, so queries use it without holding the chain lock.
+//
+// Names are split on every dot, escaped or not, so the index matches exactly
+// the names isHandlerMatch's suffix comparison does.
+type handlerIndex struct {
+	// handlers is the chain in priority order. Matches are positions in it.
+	handlers []HandlerEntry
+	// root holds the handlers of the "." pattern, matching every name.
+	root []int
+	// labels is the trie of the other patterns, keyed by their labels from
+	// the rightmost one.
+	labels indexNode
+}
+
+type indexNode struct {
+	children map[string]*indexNode
+	// self are the handlers matching the node's name itself.
+	self []int
+	// below are the handlers matching the names below the node's name:
+	// wildcards and those matching subdomains.
+	below []int
+}
+
+func newHandlerIndex(handlers []HandlerEntry) *handlerIndex {
+	idx := &handlerIndex{handlers: slices.Clone(handlers)}
+	for i, entry := range idx.handlers {
+		if entry.Pattern == "." {
+			idx.root = append(idx.root, i)
+			continue
+		}
+
+		node := &idx.labels
+		rest := entry.Pattern
+		for {
+			dot := strings.LastIndexByte(rest, '.')
+			node = node.child(rest[dot+1:])
+			if dot < 0 {
+				break
+			}
+			rest = rest[:dot]
+		}
+
+		if !entry.IsWildcard {
+			node.self = append(node.self, i)
+		}
+		if entry.IsWildcard || entry.MatchSubdomains {
+			node.below = append(node.below, i)
+		}
+	}
+	return idx
+}
+
+func (n *indexNode) child(label string) *indexNode {
+	if n.children == nil {
+		n.children = make(map[string]*indexNode)
+	}
+	c, ok := n.children[label]
+	if !ok {
+		c = &indexNode{}
+		n.children[label] = c
+	}
+	return c
+}
+
+// match returns the positions of the handlers matching the normalized qname,
+// in chain order.
+func (idx *handlerIndex) match(qname string) []int {
+	matches := slices.Clone(idx.root)
+
+	node := &idx.labels
+	rest := qname
+	for {
+		dot := strings.LastIndexByte(rest, '.')
+		node = node.children[rest[dot+1:]]
+		if node == nil {
+			break
+		}
+		if dot < 0 {
+			matches = append(matches, node.self...)
+			break
+		}
+		matches = append(matches, node.below...)
+		rest = rest[:dot]
+	}
+
+	slices.Sort(matches)
+	return matches
+}
@@ -0,0 +1,165 @@
+package dns
+
+import (
+	"fmt"
+	"math/rand"
+	"strings"
+	"testing"
+
+	"github.com/miekg/dns"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// linearMatch is the matching the chain did before handlerIndex: testing
+// every handler in order.
+func linearMatch(c *HandlerChain, qname string) []int {
+	var matches []int
+	for i, entry := range c.handlers {
+		if c.isHandlerMatch(qname, entry) {
+			matches = append(matches, i)
+		}
+	}
+	return matches
+}
+
+func TestHandlerIndex_MatchesLinearScan(t *testing.T) {
+	exact := &MockHandler{}
+	subdomains := &MockSubdomainHandler{Subdomains: true}
+
+	chain := NewHandlerChain()
+	for _, h := range []struct {
+		pattern  string
+		handler  dns.Handler
+		priority int
+	}{
+		{".", subdomains, PriorityDefault},
+		{".", exact, PriorityFallback},
+		{"*.", exact, PriorityMirror},
+		{"example.com.", subdomains, PriorityUpstream},
+		{"example.com.", exact, PriorityDNSRoute},
+		{"*.example.com.", exact, PriorityLocal},
+		{"sub.example.com.", subdomains, PriorityUpstream},
+		{"Mixed.Case.Example.COM", exact, PriorityLocal},
+		{"xn--bcher-kva.example.", subdomains, PriorityUpstream},
+		{`a\.b.example.com.`, exact, PriorityUpstream},
+		{"b.example.com.", subdomains, PriorityMirror},
+		{"com.", exact, PriorityLoopback},
+		{"100.64.in-addr.arpa.", subdomains, PriorityReverseCache},
+	} {
+		chain.AddHandler(h.pattern, h.handler, h.priority)
+	}
+	chain.RemoveHandler("b.example.com.", PriorityMirror)
+
+	index := newHandlerIndex(chain.handlers)
+	for _, qname := range []string{
+		".",
+		"",
+		"com.",
+		"com",
+		"example.com.",
+		"example.com",
+		"www.example.com.",
+		"sub.example.com.",
+		"deep.sub.example.com.",
+		"mixed.case.example.com.",
+		"xn--bcher-kva.example.",
+		"www.xn--bcher-kva.example.",
+		`a\.b.example.com.`,
+		"b.example.com.",
+		"a..example.com.",
+		".example.com.",
+		"1.2.100.64.in-addr.arpa.",
+		"other.org.",
+	} {
+		assert.Equal(t, linearMatch(chain, qname), nilIfEmpty(index.match(qname)), "query %q", qname)
+	}
+}
+
+func TestHandlerIndex_MatchesLinearScanRandom(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	labels := []string{"", "a", "b", "example", "com", `x\.y`}
+	name := func() string {
+		parts := make([]string, rng.Intn(4))
+		for i := range parts {
+			parts[i] = labels[rng.Intn(len(labels))]
+		}
+		return strings.Join(parts, ".") + "."
+	}
+	priorities := []int{PriorityDNSRoute, PriorityLocal, PriorityUpstream, PriorityDefault}
+
+	for round := range 50 {
+		chain := NewHandlerChain()
+		for range 20 {
+			pattern := name()
+			if rng.Intn(4) == 0 {
+				pattern = "*." + pattern
+			}
+			handler := &MockSubdomainHandler{Subdomains: rng.Intn(2) == 0}
+			chain.AddHandler(pattern, handler, priorities[rng.Intn(len(priorities))])
+		}
+
+		index := newHandlerIndex(chain.handlers)
+		for range 50 {
+			qname := name()
+			if rng.Intn(5) == 0 {
+				qname = strings.TrimSuffix(qname, ".")
+			}
+			require.Equal(t, linearMatch(chain, qname), nilIfEmpty(index.match(qname)), "round %d, query %q", round, qname)
+		}
+	}
+}
+
+func TestHandlerChain_IndexRebuiltOnChange(t *testing.T) {
+	chain := NewHandlerChain()
+	chain.AddHandler("example.com.", dualStackUpstream, PriorityUpstream)
+
+	_, err := chain.ResolveInternal(t.Context(), new(dns.Msg).SetQuestion("example.com.", dns.TypeA), PriorityUpstream)
+	require.NoError(t, err)
+	require.NotNil(t, chain.index)
+
+	chain.AddHandler("example.org.", dualStackUpstream, PriorityUpstream)
+	assert.Nil(t, chain.index, "adding a handler resets the index")
+	_, err = chain.ResolveInternal(t.Context(), new(dns.Msg).SetQuestion("example.org.", dns.TypeA), PriorityUpstream)
+	require.NoError(t, err)
+
+	chain.RemoveHandler("example.com.", PriorityUpstream)
+	assert.Nil(t, chain.index, "removing a handler resets the index")
+	_, err = chain.ResolveInternal(t.Context(), new(dns.Msg).SetQuestion("example.com.", dns.TypeA), PriorityUpstream)
+	assert.Error(t, err)
+}
+
+// BenchmarkHandlerIndex compares the index with the linear scan it replaced
+// for chains with many conditional forwarding zones.
+func BenchmarkHandlerIndex(b *testing.B) {
+	subdomains := &MockSubdomainHandler{Subdomains: true}
+	for _, zones := range []int{10, 100, 500, 1000} {
+		chain := NewHandlerChain()
+		for i := range zones {
+			chain.AddHandler(fmt.Sprintf("zone%d.example.com.", i), subdomains, PriorityUpstream)
+		}
+		chain.AddHandler(".", subdomains, PriorityDefault)
+		index := newHandlerIndex(chain.handlers)
+		qname := fmt.Sprintf("host.zone%d.example.com.", zones-1)
+
+		b.Run(fmt.Sprintf("zones=%d/index", zones), func(b *testing.B) {
+			b.ReportAllocs()
+			for b.Loop() {
+				index.match(qname)
+			}
+		})
+		b.Run(fmt.Sprintf("zones=%d/linear", zones), func(b *testing.B) {
+			b.ReportAllocs()
+			for b.Loop() {
+				linearMatch(chain, qname)
+			}
+		})
+	}
+}
+
+func nilIfEmpty(s []int) []int {
+	if len(s) == 0 {
+		return nil
+	}
+	return s
+}
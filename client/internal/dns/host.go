@@ -5,8 +5,10 @@ import (
 	"net/netip"
 	"strings"
 
+	"github.com/hashicorp/go-multierror"
 	"github.com/miekg/dns"
 
+	nberrors "github.com/netbirdio/netbird/client/errors"
 	"github.com/netbirdio/netbird/client/internal/statemanager"
 	nbdns "github.com/netbirdio/netbird/dns"
 )
@@ -22,6 +24,71 @@ type hostManager interface {
 	getOriginalNameservers() []netip.Addr
 }
 
+// restoreStep is one host setting reverted by restoreHostDNS.
+type restoreStep struct {
+	name    string
+	restore func() error
+}
+
+// restoreSteps runs every step, including the ones after a failure, so one
+// setting failing to revert doesn't leave the others applied. The returned
+// error names each step that failed.
+func restoreSteps(steps ...restoreStep) error {
+	var merr *multierror.Error
+	for _, step := range steps {
+		if err := step.restore(); err != nil {
+			merr = multierror.Append(merr, fmt.Errorf("restore %s: %w", step.name, err))
+		}
+	}
+	return nberrors.FormatErrorOrNil(merr)
+}
+
+// HostManager lets embedders supply their own host DNS integration, e.g. for an
+// unsupported OS or a container-specific resolv.conf strategy. Install it with
+// DefaultServer.SetHostManager; it replaces the auto-detected manager.
+type HostManager interface {
+	// ApplyDNSConfig points the host at the NetBird resolver described by config.
+	// It is called on every effective config change and must be idempotent.
+	// stateManager may be nil; implementations that modify host state should
+	// record it there so it can be reverted after an unclean shutdown.
+	ApplyDNSConfig(config HostDNSConfig, stateManager *statemanager.Manager) error
+	// RestoreHostDNS reverts every change made by ApplyDNSConfig.
+	RestoreHostDNS() error
+	// SupportCustomPort reports whether the host can use a resolver on a port
+	// other than 53. When false, the DNS service listens on port 53.
+	SupportCustomPort() bool
+	// GetOriginalNameservers returns the host resolvers in place before NetBird
+	// took over, used as fallback upstreams. May return nil.
+	GetOriginalNameservers() []netip.Addr
+	// String names the implementation in logs.
+	String() string
+}
+
+// customHostManager adapts an embedder-supplied HostManager to hostManager.
+type customHostManager struct {
+	HostManager
+}
+
+func (c customHostManager) applyDNSConfig(config HostDNSConfig, stateManager *statemanager.Manager) error {
+	return c.ApplyDNSConfig(config, stateManager)
+}
+
+func (c customHostManager) restoreHostDNS() error {
+	return c.RestoreHostDNS()
+}
+
+func (c customHostManager) supportCustomPort() bool {
+	return c.SupportCustomPort()
+}
+
+func (c customHostManager) string() string {
+	return c.String()
+}
+
+func (c customHostManager) getOriginalNameservers() []netip.Addr {
+	return c.GetOriginalNameservers()
+}
+
 type SystemDNSSettings struct {
 	Domains    []string
 	ServerIP   netip.Addr
@@ -41,6 +108,17 @@ type DomainConfig struct {
 	MatchOnly bool   `json:"matchOnly"`
 }
 
+// enabledDomains returns the domains host managers apply, skipping disabled ones.
+func enabledDomains(domains []DomainConfig) []DomainConfig {
+	var enabled []DomainConfig
+	for _, d := range domains {
+		if !d.Disabled {
+			enabled = append(enabled, d)
+		}
+	}
+	return enabled
+}
+
 type mockHostConfigurator struct {
 	applyDNSConfigFunc            func(config HostDNSConfig, stateManager *statemanager.Manager) error
 	restoreHostDNSFunc            func() error
@@ -134,23 +134,27 @@ func (s *systemConfigurator) string() string {
 
 func (s *systemConfigurator) restoreHostDNS() error {
 	keys := s.getRemovableKeysWithDefaults()
+	steps := make([]restoreStep, 0, len(keys))
 	for _, key := range keys {
 		keyType := "search"
 		if strings.Contains(key, matchSuffix) {
 			keyType = "match"
 		}
-		log.Infof("removing %s domains from system", keyType)
-		err := s.removeKeyFromSystemConfig(key)
-		if err != nil {
-			log.Errorf("failed to remove %s domains from system: %s", keyType, err)
-		}
+		steps = append(steps, restoreStep{
+			name: fmt.Sprintf("%s domains (%s)", keyType, key),
+			restore: func() error {
+				log.Infof("removing %s domains from system", keyType)
+				return s.removeKeyFromSystemConfig(key)
+			},
+		})
 	}
+	err := restoreSteps(steps...)
 
 	if err := s.flushDNSCache(); err != nil {
 		log.Errorf("failed to flush DNS cache: %v", err)
 	}
 
-	return nil
+	return err
 }
 
 func (s *systemConfigurator) getRemovableKeysWithDefaults() []string {
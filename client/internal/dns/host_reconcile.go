@@ -0,0 +1,132 @@
+package dns
+
+import (
+	"os"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	// envHostReconcileInterval enables the host DNS drift reconciler with a
+	// Go duration check interval (e.g. "1m"). Unset or invalid disables it.
+	envHostReconcileInterval = "NB_DNS_HOST_RECONCILE_INTERVAL"
+	// minHostReconcileInterval bounds how often the host DNS state is read.
+	minHostReconcileInterval = 10 * time.Second
+	// maxHostReconcileBackoff caps the wait between consecutive corrections
+	// when another tool keeps overwriting the host config.
+	maxHostReconcileBackoff = 30 * time.Minute
+)
+
+// driftDetector is implemented by host managers that can tell whether the
+// host DNS settings still match what they applied.
+type driftDetector interface {
+	hasDrift(config HostDNSConfig) (bool, error)
+}
+
+// hostReconcileState debounces drift corrections. Accessed under s.mux.
+type hostReconcileState struct {
+	// pending is set when the previous check saw drift. Drift must persist
+	// across two checks before it is corrected, so a tool briefly rewriting
+	// the config isn't raced.
+	pending bool
+	// backoff grows with every correction that didn't stick and resets once
+	// a check finds the host config intact.
+	backoff time.Duration
+	nextFix time.Time
+}
+
+// hostReconcileIntervalFromEnv returns the reconcile interval, zero when the
+// reconciler is disabled.
+func hostReconcileIntervalFromEnv() time.Duration {
+	val := os.Getenv(envHostReconcileInterval)
+	if val == "" {
+		return 0
+	}
+	d, err := time.ParseDuration(val)
+	if err != nil || d <= 0 {
+		log.Warnf("invalid %s value %q, host DNS reconciler disabled", envHostReconcileInterval, val)
+		return 0
+	}
+	if d < minHostReconcileInterval {
+		log.Warnf("%s %v is below the minimum, using %v", envHostReconcileInterval, d, minHostReconcileInterval)
+		return minHostReconcileInterval
+	}
+	return d
+}
+
+// startHostReconciler periodically reapplies the host DNS config when it
+// drifted, e.g. after NetworkManager or another VPN overwrote it. Only host
+// managers implementing driftDetector are supported; resolv.conf is already
+// guarded by the file repair watcher.
+func (s *DefaultServer) startHostReconciler() {
+	if s.reconcileInterval <= 0 {
+		return
+	}
+	if _, ok := s.hostManager.(driftDetector); !ok {
+		log.Infof("host DNS reconciler not supported by the %s host manager", s.hostManager.string())
+		return
+	}
+
+	log.Infof("host DNS reconciler enabled, checking every %v", s.reconcileInterval)
+	s.shutdownWg.Add(1)
+	go func() {
+		defer s.shutdownWg.Done()
+		ticker := time.NewTicker(s.reconcileInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-s.ctx.Done():
+				return
+			case now := <-ticker.C:
+				s.reconcileHostDNS(now)
+			}
+		}
+	}()
+}
+
+// reconcileHostDNS runs one drift check and reports whether the host config
+// was reapplied.
+func (s *DefaultServer) reconcileHostDNS(now time.Time) bool {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+
+	if s.disableSys || s.batchMode || s.bypassed || s.ctx.Err() != nil {
+		return false
+	}
+	detector, ok := s.hostManager.(driftDetector)
+	if !ok {
+		return false
+	}
+
+	drifted, err := detector.hasDrift(s.currentConfig)
+	if err != nil {
+		log.Debugf("check host DNS drift: %v", err)
+		return false
+	}
+
+	state := &s.reconcileState
+	if !drifted {
+		*state = hostReconcileState{}
+		return false
+	}
+	if !state.pending {
+		state.pending = true
+		log.Debugf("host DNS config drifted, confirming on next check")
+		return false
+	}
+	if now.Before(state.nextFix) {
+		log.Debugf("host DNS config drifted, next correction at %s", state.nextFix.Format(time.RFC3339))
+		return false
+	}
+
+	log.Infof("host DNS config was changed externally, reapplying it via %s", s.hostManager.string())
+	// Force applyHostConfig past its unchanged-config shortcut.
+	s.currentConfigHash = ^uint64(0)
+	s.applyHostConfig()
+
+	state.pending = false
+	state.backoff = min(max(2*state.backoff, s.reconcileInterval), maxHostReconcileBackoff)
+	state.nextFix = now.Add(state.backoff)
+	return true
+}
@@ -0,0 +1,102 @@
+package dns
+
+import (
+	"net/netip"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/netbirdio/netbird/client/internal/statemanager"
+)
+
+// driftingHostManager simulates a host whose DNS config another tool can
+// overwrite: applying the config clears the drift.
+type driftingHostManager struct {
+	noopHostConfigurator
+	drifted bool
+	applied int
+}
+
+func (m *driftingHostManager) applyDNSConfig(HostDNSConfig, *statemanager.Manager) error {
+	m.applied++
+	m.drifted = false
+	return nil
+}
+
+func (m *driftingHostManager) hasDrift(HostDNSConfig) (bool, error) {
+	return m.drifted, nil
+}
+
+func newReconcileTestServer(manager hostManager) *DefaultServer {
+	server := newTestServer(manager)
+	server.currentConfig = HostDNSConfig{ServerIP: netip.MustParseAddr("127.0.0.1"), ServerPort: 53}
+	server.reconcileInterval = time.Minute
+	return server
+}
+
+func TestReconcileHostDNS_ReappliesAfterConfirmedDrift(t *testing.T) {
+	manager := &driftingHostManager{}
+	server := newReconcileTestServer(manager)
+	now := time.Now()
+
+	assert.False(t, server.reconcileHostDNS(now), "no drift, nothing to do")
+
+	manager.drifted = true
+	assert.False(t, server.reconcileHostDNS(now), "first drift observation only arms the debounce")
+	assert.Equal(t, 0, manager.applied)
+
+	assert.True(t, server.reconcileHostDNS(now.Add(time.Minute)), "persistent drift should be corrected")
+	assert.Equal(t, 1, manager.applied)
+	assert.False(t, manager.drifted)
+}
+
+func TestReconcileHostDNS_BacksOffWhenDriftRecurs(t *testing.T) {
+	manager := &driftingHostManager{drifted: true}
+	server := newReconcileTestServer(manager)
+	now := time.Now()
+
+	server.reconcileHostDNS(now)
+	assert.True(t, server.reconcileHostDNS(now.Add(time.Second)))
+
+	// Another tool overwrites the config right away.
+	manager.drifted = true
+	server.reconcileHostDNS(now.Add(2 * time.Second))
+	assert.False(t, server.reconcileHostDNS(now.Add(3*time.Second)), "correction must wait for the backoff")
+	assert.Equal(t, 1, manager.applied)
+
+	assert.True(t, server.reconcileHostDNS(now.Add(2*time.Minute)), "correction should resume after the backoff")
+	assert.Equal(t, 2, manager.applied)
+	assert.Equal(t, 2*time.Minute, server.reconcileState.backoff, "backoff should double on recurring drift")
+
+	// A clean check resets the backoff.
+	server.reconcileHostDNS(now.Add(3 * time.Minute))
+	assert.Zero(t, server.reconcileState.backoff)
+}
+
+func TestReconcileHostDNS_RespectsDisableSys(t *testing.T) {
+	manager := &driftingHostManager{drifted: true}
+	server := newReconcileTestServer(manager)
+	server.disableSys = true
+	now := time.Now()
+
+	server.reconcileHostDNS(now)
+	assert.False(t, server.reconcileHostDNS(now.Add(time.Minute)))
+	assert.Equal(t, 0, manager.applied)
+}
+
+func TestStartHostReconciler_RequiresDriftDetector(t *testing.T) {
+	server := newReconcileTestServer(&noopHostConfigurator{})
+	server.startHostReconciler()
+
+	done := make(chan struct{})
+	go func() {
+		server.shutdownWg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("reconciler must not start for host managers without drift detection")
+	}
+}
@@ -505,17 +505,16 @@ func (r *registryConfigurator) getInterfaceRegistryKey() (registry.Key, error) {
 }
 
 func (r *registryConfigurator) restoreHostDNS() error {
-	if err := r.removeDNSMatchPolicies(); err != nil {
-		log.Errorf("remove dns match policies: %s", err)
-	}
-
-	if err := r.deleteInterfaceRegistryKeyProperty(interfaceConfigSearchListKey); err != nil {
-		return fmt.Errorf("remove interface registry key: %w", err)
-	}
+	err := restoreSteps(
+		restoreStep{name: "dns match policies", restore: r.removeDNSMatchPolicies},
+		restoreStep{name: "interface search list", restore: func() error {
+			return r.deleteInterfaceRegistryKeyProperty(interfaceConfigSearchListKey)
+		}},
+	)
 
 	go r.flushDNSCache()
 
-	return nil
+	return err
 }
 
 func (r *registryConfigurator) removeDNSMatchPolicies() error {
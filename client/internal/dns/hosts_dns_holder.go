@@ -33,7 +33,6 @@ func (h *hostsDNSHolder) get() map[netip.AddrPort]struct{} {
 	return l
 }
 
-//nolint:unused
 func (h *hostsDNSHolder) contains(upstream netip.AddrPort) bool {
 	h.mutex.RLock()
 	defer h.mutex.RUnlock()
@@ -0,0 +1,100 @@
+package local
+
+import (
+	"net"
+	"net/netip"
+	"slices"
+
+	"github.com/miekg/dns"
+	log "github.com/sirupsen/logrus"
+)
+
+// dns64PrefixLengths are the NAT64 prefix lengths RFC 6052 defines an
+// address format for.
+var dns64PrefixLengths = []int{32, 40, 48, 56, 64, 96}
+
+// SetDNS64Prefix makes the resolver answer AAAA questions for names of its
+// zones that only have A records with addresses synthesized from the A
+// records and prefix (RFC 6147). An invalid prefix disables the synthesis.
+// Safe to call multiple times; the latest value wins.
+func (d *Resolver) SetDNS64Prefix(prefix netip.Prefix) {
+	if prefix.IsValid() && (!prefix.Addr().Is6() || prefix.Addr().Is4In6() || !slices.Contains(dns64PrefixLengths, prefix.Bits())) {
+		log.Warnf("unsupported DNS64 prefix %s, the length must be one of %v: disabling DNS64", prefix, dns64PrefixLengths)
+		prefix = netip.Prefix{}
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.dns64Prefix = prefix.Masked()
+}
+
+// synthesizeAAAA replaces result, the answer to an AAAA question, with AAAA
+// records synthesized from the A records of the name if DNS64 is enabled,
+// the name belongs to one of our zones and it has no AAAA record. Answers
+// resolved outside our zones are left alone, their resolver does DNS64.
+func (d *Resolver) synthesizeAAAA(logger *log.Entry, question dns.Question, client netip.Addr, result lookupResult) lookupResult {
+	if question.Qtype != dns.TypeAAAA || result.rcode != dns.RcodeSuccess || result.hasExternalData {
+		return result
+	}
+	if slices.ContainsFunc(result.records, func(rr dns.RR) bool { return rr.Header().Rrtype == dns.TypeAAAA }) {
+		return result
+	}
+
+	d.mu.RLock()
+	prefix := d.dns64Prefix
+	_, served := d.findZone(question.Name)
+	d.mu.RUnlock()
+	if !prefix.IsValid() || !served {
+		return result
+	}
+
+	aQuestion := question
+	aQuestion.Qtype = dns.TypeA
+	aResult := d.lookup(logger, aQuestion, client)
+	if aResult.rcode != dns.RcodeSuccess || aResult.hasExternalData {
+		return result
+	}
+	d.warmLazyPeers(aQuestion, aResult.records)
+	records := d.filterDisconnectedPeerAnswers(logger, aQuestion, aResult.records)
+
+	synthesized := make([]dns.RR, 0, len(records))
+	var found bool
+	for _, rr := range records {
+		a, ok := rr.(*dns.A)
+		if !ok {
+			// the CNAME chain leading to the A records
+			synthesized = append(synthesized, rr)
+			continue
+		}
+		v4, ok := netip.AddrFromSlice(a.A.To4())
+		if !ok {
+			continue
+		}
+		hdr := a.Hdr
+		hdr.Rrtype = dns.TypeAAAA
+		synthesized = append(synthesized, &dns.AAAA{Hdr: hdr, AAAA: net.IP(embedIPv4(prefix, v4).AsSlice())})
+		found = true
+	}
+	if !found {
+		return result
+	}
+
+	logger.Tracef("synthesized DNS64 answer for %s with prefix %s", question.Name, prefix)
+	return lookupResult{records: synthesized, rcode: dns.RcodeSuccess}
+}
+
+// embedIPv4 builds the IPv4-embedded IPv6 address of v4 within prefix,
+// following the address format of RFC 6052 section 2.2: bits 64 to 71 are
+// skipped and stay zero.
+func embedIPv4(prefix netip.Prefix, v4 netip.Addr) netip.Addr {
+	out := prefix.Addr().As16()
+	pos := prefix.Bits() / 8
+	for _, b := range v4.As4() {
+		if pos == 8 {
+			pos++
+		}
+		out[pos] = b
+		pos++
+	}
+	return netip.AddrFrom16(out)
+}
@@ -0,0 +1,104 @@
+package local
+
+import (
+	"context"
+	"net/netip"
+	"testing"
+
+	"github.com/miekg/dns"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/netbirdio/netbird/client/internal/dns/test"
+	nbdns "github.com/netbirdio/netbird/dns"
+)
+
+func TestEmbedIPv4(t *testing.T) {
+	v4 := netip.MustParseAddr("192.0.2.33")
+	// the examples of RFC 6052 section 2.4
+	tests := []struct {
+		prefix string
+		want   string
+	}{
+		{prefix: "2001:db8::/32", want: "2001:db8:c000:221::"},
+		{prefix: "2001:db8:100::/40", want: "2001:db8:1c0:2:21::"},
+		{prefix: "2001:db8:122::/48", want: "2001:db8:122:c000:2:2100::"},
+		{prefix: "2001:db8:122:300::/56", want: "2001:db8:122:3c0:0:221::"},
+		{prefix: "2001:db8:122:344::/64", want: "2001:db8:122:344:c0:2:2100:0"},
+		{prefix: "2001:db8:122:344::/96", want: "2001:db8:122:344::192.0.2.33"},
+		{prefix: "64:ff9b::/96", want: "64:ff9b::192.0.2.33"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.prefix, func(t *testing.T) {
+			assert.Equal(t, netip.MustParseAddr(tt.want), embedIPv4(netip.MustParsePrefix(tt.prefix), v4))
+		})
+	}
+}
+
+func TestLocalResolver_DNS64(t *testing.T) {
+	record := func(name string, qtype uint16, rdata string) nbdns.SimpleRecord {
+		return nbdns.SimpleRecord{Name: name, Type: int(qtype), Class: nbdns.DefaultClass, TTL: 300, RData: rdata}
+	}
+	resolver := NewResolver()
+	resolver.resolver = &mockResolver{lookupFunc: func(context.Context, string, string) ([]netip.Addr, error) {
+		return []netip.Addr{netip.MustParseAddr("2001:db8::1")}, nil
+	}}
+	resolver.Update([]nbdns.CustomZone{{
+		Domain: "example.internal.",
+		Records: []nbdns.SimpleRecord{
+			record("v4only.example.internal.", dns.TypeA, "10.0.0.1"),
+			record("dual.example.internal.", dns.TypeA, "10.0.0.2"),
+			record("dual.example.internal.", dns.TypeAAAA, "fd00::2"),
+			record("alias.example.internal.", dns.TypeCNAME, "v4only.example.internal."),
+			record("outside.example.internal.", dns.TypeCNAME, "host.example.com."),
+		},
+	}})
+	resolver.UpdateSourceRecords(SourceStaticHosts, []nbdns.SimpleRecord{record("static.host.", dns.TypeA, "10.0.0.3")})
+
+	query := func(name string) *dns.Msg {
+		var resp *dns.Msg
+		resolver.ServeDNS(&test.MockResponseWriter{
+			WriteMsgFunc: func(m *dns.Msg) error {
+				resp = m
+				return nil
+			},
+		}, new(dns.Msg).SetQuestion(name, dns.TypeAAAA))
+		require.NotNil(t, resp)
+		return resp
+	}
+	addrs := func(resp *dns.Msg) []string {
+		var out []string
+		for _, rr := range resp.Answer {
+			if aaaa, ok := rr.(*dns.AAAA); ok {
+				out = append(out, aaaa.AAAA.String())
+			}
+		}
+		return out
+	}
+
+	assert.Empty(t, query("v4only.example.internal.").Answer, "disabled by default")
+
+	resolver.SetDNS64Prefix(nbdns.DefaultDNS64Prefix)
+
+	resp := query("v4only.example.internal.")
+	assert.Equal(t, dns.RcodeSuccess, resp.Rcode)
+	assert.Equal(t, []string{"64:ff9b::a00:1"}, addrs(resp))
+	assert.Equal(t, uint32(300), resp.Answer[0].Header().Ttl)
+
+	assert.Equal(t, []string{"fd00::2"}, addrs(query("dual.example.internal.")), "a real AAAA record wins")
+
+	resp = query("alias.example.internal.")
+	require.Len(t, resp.Answer, 2)
+	assert.Equal(t, dns.TypeCNAME, resp.Answer[0].Header().Rrtype)
+	assert.Equal(t, []string{"64:ff9b::a00:1"}, addrs(resp), "the CNAME target is synthesized")
+
+	assert.Equal(t, []string{"2001:db8::1"}, addrs(query("outside.example.internal.")), "targets resolved elsewhere are left alone")
+	assert.Empty(t, query("static.host.").Answer, "names outside our zones aren't synthesized")
+	assert.Equal(t, dns.RcodeNameError, query("missing.example.internal.").Rcode)
+
+	resolver.SetDNS64Prefix(netip.MustParsePrefix("2001:db8::/33"))
+	assert.Empty(t, query("v4only.example.internal.").Answer, "unsupported prefix lengths disable DNS64")
+
+	resolver.SetDNS64Prefix(netip.Prefix{})
+	assert.Empty(t, query("v4only.example.internal.").Answer)
+}
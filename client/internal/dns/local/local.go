@@ -76,13 +76,50 @@ func lazyWarmupTimeoutFromEnv() time.Duration {
 	return d
 }
 
+// zoneConfig holds the per-zone settings that affect how misses are answered.
+type zoneConfig struct {
+	// nonAuthoritative marks user-created zones whose NXDOMAIN falls through
+	// to lower-priority handlers.
+	nonAuthoritative bool
+	// noDataFallthrough additionally lets NODATA fall through for
+	// non-authoritative zones.
+	noDataFallthrough bool
+}
+
+// Source tags the records and zones loaded from one origin, so origins can
+// be updated, listed and flushed without touching each other's records.
+type Source string
+
+// SourceManagement tags the custom zones received from management. Update,
+// ApplyDelta and RegisterRecord act on it.
+const SourceManagement Source = "management"
+
+// SourceStaticHosts tags the static host entries received from management.
+// They carry records only, no zones.
+const SourceStaticHosts Source = "static-hosts"
+
 type Resolver struct {
 	mu      sync.RWMutex
 	records map[dns.Question][]dns.RR
-	domains map[domain.Domain]struct{}
-	// zones maps zone domain -> NonAuthoritative (true = non-authoritative, user-created zone)
-	zones    map[domain.Domain]bool
-	resolver resolver
+	// domains counts the registered records per owner name, so a name stays
+	// known (NODATA instead of NXDOMAIN) until its last record is removed.
+	domains map[domain.Domain]int
+	// applied is the set of records currently registered per source, in
+	// management's representation. UpdateSource diffs the incoming zones
+	// against it so only changed records are touched.
+	applied map[Source]map[nbdns.SimpleRecord]struct{}
+	// refs counts the sources holding a record. A record is served once,
+	// however many sources hold it, until the last one removes it.
+	refs map[nbdns.SimpleRecord]int
+	// sourceZones holds the zones of each source, zones the merged view
+	// used for lookups: zone domain -> per-zone settings
+	sourceZones map[Source]map[domain.Domain]zoneConfig
+	zones       map[domain.Domain]zoneConfig
+	// sourceViews holds the subnet views of each source's zones, views the
+	// merged list used for lookups, most specific subnet first.
+	sourceViews map[Source][]subnetView
+	views       []subnetView
+	resolver    resolver
 	// peerConn, when non-nil, is consulted on every A/AAAA answer to
 	// drop records pointing at disconnected peers. nil disables the
 	// filter and preserves the legacy "return whatever is registered"
@@ -94,6 +131,9 @@ type Resolver struct {
 	// warmupTimeout is the per-query budget for the lazy-connection warm-up
 	// wait, resolved from the environment once at construction time.
 	warmupTimeout time.Duration
+	// dns64Prefix, when valid, is the NAT64 prefix AAAA answers are
+	// synthesized with for names of our zones that only have A records.
+	dns64Prefix netip.Prefix
 
 	ctx    context.Context
 	cancel context.CancelFunc
@@ -103,8 +143,12 @@ func NewResolver() *Resolver {
 	ctx, cancel := context.WithCancel(context.Background())
 	return &Resolver{
 		records:       make(map[dns.Question][]dns.RR),
-		domains:       make(map[domain.Domain]struct{}),
-		zones:         make(map[domain.Domain]bool),
+		domains:       make(map[domain.Domain]int),
+		applied:       make(map[Source]map[nbdns.SimpleRecord]struct{}),
+		refs:          make(map[nbdns.SimpleRecord]int),
+		sourceZones:   make(map[Source]map[domain.Domain]zoneConfig),
+		zones:         make(map[domain.Domain]zoneConfig),
+		sourceViews:   make(map[Source][]subnetView),
 		warmupTimeout: lazyWarmupTimeoutFromEnv(),
 		ctx:           ctx,
 		cancel:        cancel,
@@ -147,7 +191,12 @@ func (d *Resolver) Stop() {
 
 	clear(d.records)
 	clear(d.domains)
+	clear(d.applied)
+	clear(d.refs)
+	clear(d.sourceZones)
 	clear(d.zones)
+	clear(d.sourceViews)
+	d.views = nil
 }
 
 // ID returns the unique handler ID
@@ -173,17 +222,26 @@ func (d *Resolver) ServeDNS(w dns.ResponseWriter, r *dns.Msg) {
 	replyMessage.SetReply(r)
 	replyMessage.RecursionAvailable = true
 
-	result := d.lookupRecords(logger, question)
+	client := clientSubnetAddr(w, r)
+	result := d.lookup(logger, question, client)
 	// Warm before filtering: activation flips a lazily-idle target to connected,
 	// which then lets it survive the disconnected-peer filter below.
 	d.warmLazyPeers(question, result.records)
 	result.records = d.filterDisconnectedPeerAnswers(logger, question, result.records)
+	result = d.synthesizeAAAA(logger, question, client, result)
 	replyMessage.Authoritative = !result.hasExternalData
 	replyMessage.Answer = result.records
 	replyMessage.Rcode = d.determineRcode(question, result)
+	if result.hasEDE && replyMessage.Rcode == dns.RcodeServerFailure {
+		resutil.SetEDE(replyMessage, r, result.ede)
+	}
+	switch question.Qtype {
+	case dns.TypeSRV, dns.TypeSVCB, dns.TypeHTTPS:
+		replyMessage.Extra = d.targetAddresses(logger, question.Qclass, result.records)
+	}
 
-	if replyMessage.Rcode == dns.RcodeNameError && d.shouldFallthrough(question.Name) {
-		d.continueToNext(logger, w, r)
+	if d.shouldFallthrough(question.Name, resutil.ClassifyNegative(replyMessage)) {
+		d.continueToNext(logger, w, r, replyMessage.Rcode)
 		return
 	}
 
@@ -211,35 +269,48 @@ func (d *Resolver) determineRcode(question dns.Question, result lookupResult) in
 }
 
 // findZone finds the matching zone for a query name using reverse suffix lookup.
-// Returns (nonAuthoritative, found). This is O(k) where k = number of labels in qname.
-func (d *Resolver) findZone(qname string) (nonAuthoritative bool, found bool) {
+// This is O(k) where k = number of labels in qname.
+func (d *Resolver) findZone(qname string) (zoneConfig, bool) {
 	qname = strings.ToLower(dns.Fqdn(qname))
 	for {
-		if nonAuth, ok := d.zones[domain.Domain(qname)]; ok {
-			return nonAuth, true
+		if cfg, ok := d.zones[domain.Domain(qname)]; ok {
+			return cfg, true
 		}
 		// Move to parent domain
 		idx := strings.Index(qname, ".")
 		if idx == -1 || idx == len(qname)-1 {
-			return false, false
+			return zoneConfig{}, false
 		}
 		qname = qname[idx+1:]
 	}
 }
 
-// shouldFallthrough checks if the query should fallthrough to the next handler.
-// Returns true if the queried name belongs to a non-authoritative zone.
-func (d *Resolver) shouldFallthrough(qname string) bool {
+// shouldFallthrough checks if a negative answer should fall through to the
+// next handler. NXDOMAIN falls through for non-authoritative zones; NODATA
+// only when the zone opted in, since the name itself is handled here and
+// passing it on would leak it to other resolvers.
+func (d *Resolver) shouldFallthrough(qname string, kind resutil.Negative) bool {
 	d.mu.RLock()
 	defer d.mu.RUnlock()
 
-	nonAuth, found := d.findZone(qname)
-	return found && nonAuth
+	cfg, found := d.findZone(qname)
+	if !found || !cfg.nonAuthoritative {
+		return false
+	}
+
+	switch kind {
+	case resutil.NXDomain:
+		return true
+	case resutil.NoData:
+		return cfg.noDataFallthrough
+	default:
+		return false
+	}
 }
 
-func (d *Resolver) continueToNext(logger *log.Entry, w dns.ResponseWriter, r *dns.Msg) {
+func (d *Resolver) continueToNext(logger *log.Entry, w dns.ResponseWriter, r *dns.Msg, rcode int) {
 	resp := &dns.Msg{}
-	resp.SetRcode(r, dns.RcodeNameError)
+	resp.SetRcode(r, rcode)
 	resp.MsgHdr.Zero = true
 	if err := w.WriteMsg(resp); err != nil {
 		logger.Warnf("failed to write continue signal: %v", err)
@@ -271,11 +342,29 @@ func (d *Resolver) isInManagedZone(name string) bool {
 	return found
 }
 
+// InZone reports whether name falls within one of the resolver's zones, so
+// only the resolver can answer it.
+func (d *Resolver) InZone(name string) bool {
+	return d.isInManagedZone(name)
+}
+
 // lookupResult contains the result of a DNS lookup operation.
 type lookupResult struct {
 	records         []dns.RR
 	rcode           int
 	hasExternalData bool
+	// ede is the Extended DNS Error code explaining a SERVFAIL, valid if hasEDE.
+	ede    uint16
+	hasEDE bool
+}
+
+// lookup answers question from the subnet view of client if one holds
+// records for it, from the zone records otherwise.
+func (d *Resolver) lookup(logger *log.Entry, question dns.Question, client netip.Addr) lookupResult {
+	if records, ok := d.lookupSubnetRecords(question, client); ok {
+		return lookupResult{records: records, rcode: dns.RcodeSuccess}
+	}
+	return d.lookupRecords(logger, question)
 }
 
 // lookupRecords fetches *all* DNS records matching the first question in r.
@@ -419,6 +508,8 @@ func (d *Resolver) buildChainResult(chain []dns.RR, target lookupResult) lookupR
 			records:         records,
 			rcode:           dns.RcodeServerFailure,
 			hasExternalData: true,
+			ede:             target.ede,
+			hasEDE:          target.hasEDE,
 		}
 	}
 
@@ -454,6 +545,50 @@ func (d *Resolver) resolveCNAMETarget(logger *log.Entry, targetName string, targ
 	return d.resolveExternal(logger, targetName, targetType)
 }
 
+// targetAddresses returns the local A/AAAA records of the SRV, SVCB and HTTPS
+// targets in answers, sent as additional data so clients can skip a follow-up
+// lookup. They go through the same peer warm-up and disconnected-peer filter
+// as a direct lookup of the target would.
+func (d *Resolver) targetAddresses(logger *log.Entry, qclass uint16, answers []dns.RR) []dns.RR {
+	var extra []dns.RR
+	seen := make(map[string]struct{})
+	for _, rr := range answers {
+		target := strings.ToLower(dns.Fqdn(recordTarget(rr)))
+		if _, dup := seen[target]; dup || target == "." {
+			continue
+		}
+		seen[target] = struct{}{}
+		for _, qtype := range []uint16{dns.TypeA, dns.TypeAAAA} {
+			q := dns.Question{Name: target, Qtype: qtype, Qclass: qclass}
+			records := d.getRecords(q)
+			d.warmLazyPeers(q, records)
+			extra = append(extra, d.filterDisconnectedPeerAnswers(logger, q, records)...)
+		}
+	}
+	return extra
+}
+
+// recordTarget returns the target name of an SRV, SVCB or HTTPS record, or "."
+// for other records. The "." target of a SVCB or HTTPS service record
+// (priority above 0) stands for the owner name.
+func recordTarget(rr dns.RR) string {
+	var svcb *dns.SVCB
+	switch r := rr.(type) {
+	case *dns.SRV:
+		return r.Target
+	case *dns.SVCB:
+		svcb = r
+	case *dns.HTTPS:
+		svcb = &r.SVCB
+	default:
+		return "."
+	}
+	if svcb.Target == "." && svcb.Priority > 0 {
+		return svcb.Hdr.Name
+	}
+	return svcb.Target
+}
+
 func (d *Resolver) getRecords(q dns.Question) []dns.RR {
 	d.mu.RLock()
 	defer d.mu.RUnlock()
@@ -487,7 +622,11 @@ func (d *Resolver) resolveExternal(logger *log.Entry, name string, qtype uint16)
 	result := resutil.LookupIP(ctx, resolver, network, name, qtype)
 	if result.Err != nil {
 		d.logDNSError(logger, name, qtype, result.Err)
-		return lookupResult{rcode: result.Rcode, hasExternalData: true}
+		res := lookupResult{rcode: result.Rcode, hasExternalData: true}
+		if result.Rcode == dns.RcodeServerFailure {
+			res.ede, res.hasEDE = externalFailureEDE(result.Err), true
+		}
+		return res
 	}
 
 	return lookupResult{
@@ -497,6 +636,16 @@ func (d *Resolver) resolveExternal(logger *log.Entry, name string, qtype uint16)
 	}
 }
 
+// externalFailureEDE picks the EDE code for a failed CNAME-target lookup:
+// No Reachable Authority when the resolver timed out, Network Error otherwise.
+func externalFailureEDE(err error) uint16 {
+	var dnsErr *net.DNSError
+	if errors.Is(err, context.DeadlineExceeded) || errors.As(err, &dnsErr) && dnsErr.IsTimeout {
+		return dns.ExtendedErrorCodeNoReachableAuthority
+	}
+	return dns.ExtendedErrorCodeNetworkError
+}
+
 // logDNSError logs DNS resolution errors for debugging.
 func (d *Resolver) logDNSError(logger *log.Entry, hostname string, qtype uint16, err error) {
 	qtypeName := dns.TypeToString[qtype]
@@ -588,12 +737,13 @@ func (d *Resolver) warmLazyPeers(question dns.Question, records []dns.RR) {
 	}
 	d.mu.RLock()
 	activator := d.peerActivator
-	var nonAuth, found bool
+	var cfg zoneConfig
+	var found bool
 	if activator != nil {
-		nonAuth, found = d.findZone(question.Name)
+		cfg, found = d.findZone(question.Name)
 	}
 	d.mu.RUnlock()
-	if activator == nil || !found || !nonAuth {
+	if activator == nil || !found || !cfg.nonAuthoritative {
 		return
 	}
 
@@ -626,40 +776,275 @@ func extractRecordAddr(rr dns.RR) (netip.Addr, bool) {
 	return netip.Addr{}, false
 }
 
-// Update replaces all zones and their records
+// Update replaces the management zones and their records, see UpdateSource.
 func (d *Resolver) Update(customZones []nbdns.CustomZone) {
+	d.UpdateSource(SourceManagement, customZones)
+}
+
+// UpdateSource replaces all zones and records of source, leaving those of
+// other sources in place. Records are diffed against the currently registered
+// set: unchanged records are left in place (keeping their rotation state),
+// only removed and added records are touched.
+func (d *Resolver) UpdateSource(source Source, customZones []nbdns.CustomZone) {
 	d.mu.Lock()
 	defer d.mu.Unlock()
 
-	clear(d.records)
-	clear(d.domains)
-	clear(d.zones)
-
+	zones := make(map[domain.Domain]zoneConfig, len(customZones))
+	desired := make(map[nbdns.SimpleRecord]struct{})
+	var ordered []nbdns.SimpleRecord
 	for _, zone := range customZones {
 		zoneDomain := domain.Domain(strings.ToLower(dns.Fqdn(zone.Domain)))
-		d.zones[zoneDomain] = zone.NonAuthoritative
+		zones[zoneDomain] = zoneConfig{
+			nonAuthoritative:  zone.NonAuthoritative,
+			noDataFallthrough: zone.NoDataFallthrough,
+		}
 
 		for _, rec := range zone.Records {
-			if err := d.registerRecord(rec); err != nil {
-				log.Warnf("failed to register the record (%s): %v", rec, err)
+			if _, ok := desired[rec]; ok {
+				continue
+			}
+			desired[rec] = struct{}{}
+			ordered = append(ordered, rec)
+		}
+	}
+	d.setSourceZones(source, zones)
+	d.setSourceViews(source, buildSubnetViews(customZones))
+	d.replaceRecords(source, desired, ordered)
+}
+
+// UpdateSourceRecords replaces all records of source like UpdateSource, for
+// sources that serve individual names rather than zones.
+func (d *Resolver) UpdateSourceRecords(source Source, records []nbdns.SimpleRecord) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	desired := make(map[nbdns.SimpleRecord]struct{}, len(records))
+	var ordered []nbdns.SimpleRecord
+	for _, rec := range records {
+		if _, ok := desired[rec]; ok {
+			continue
+		}
+		desired[rec] = struct{}{}
+		ordered = append(ordered, rec)
+	}
+	d.setSourceZones(source, nil)
+	d.setSourceViews(source, nil)
+	d.replaceRecords(source, desired, ordered)
+}
+
+// replaceRecords diffs the desired records of source against the applied
+// ones and registers the difference, with the lock already held.
+func (d *Resolver) replaceRecords(source Source, desired map[nbdns.SimpleRecord]struct{}, ordered []nbdns.SimpleRecord) {
+	applied := d.applied[source]
+	var removed []nbdns.SimpleRecord
+	for rec := range applied {
+		if _, ok := desired[rec]; !ok {
+			removed = append(removed, rec)
+		}
+	}
+
+	var added []nbdns.SimpleRecord
+	for _, rec := range ordered {
+		if _, ok := applied[rec]; !ok {
+			added = append(added, rec)
+		}
+	}
+
+	d.applyDelta(source, added, removed)
+
+	log.Debugf("local resolver update of %s: %d added, %d removed, %d unchanged",
+		source, len(added), len(removed), len(ordered)-len(added))
+}
+
+// FlushSource removes all zones and records of source. Records also held by
+// another source keep being served.
+func (d *Resolver) FlushSource(source Source) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	removed := make([]nbdns.SimpleRecord, 0, len(d.applied[source]))
+	for rec := range d.applied[source] {
+		removed = append(removed, rec)
+	}
+	d.applyDelta(source, nil, removed)
+	d.setSourceZones(source, nil)
+	d.setSourceViews(source, nil)
+
+	log.Debugf("local resolver flushed %d records of %s", len(removed), source)
+}
+
+// Records returns the records registered by source, sorted by their
+// presentation format.
+func (d *Resolver) Records(source Source) []nbdns.SimpleRecord {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+
+	records := make([]nbdns.SimpleRecord, 0, len(d.applied[source]))
+	for rec := range d.applied[source] {
+		records = append(records, rec)
+	}
+	slices.SortFunc(records, func(a, b nbdns.SimpleRecord) int {
+		return strings.Compare(a.String(), b.String())
+	})
+	return records
+}
+
+// Sources returns the sources that registered records or zones, sorted.
+func (d *Resolver) Sources() []Source {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+
+	var sources []Source
+	for source := range d.applied {
+		sources = append(sources, source)
+	}
+	for source := range d.sourceZones {
+		if _, ok := d.applied[source]; !ok {
+			sources = append(sources, source)
+		}
+	}
+	slices.Sort(sources)
+	return sources
+}
+
+// setSourceZones replaces the zones of source and rebuilds the merged zone
+// view with the lock already held. A zone defined by several sources is
+// non-authoritative only if all of them say so.
+func (d *Resolver) setSourceZones(source Source, zones map[domain.Domain]zoneConfig) {
+	if len(zones) == 0 {
+		delete(d.sourceZones, source)
+	} else {
+		d.sourceZones[source] = zones
+	}
+
+	clear(d.zones)
+	for _, sourceZones := range d.sourceZones {
+		for zone, cfg := range sourceZones {
+			existing, ok := d.zones[zone]
+			if !ok {
+				d.zones[zone] = cfg
+				continue
 			}
+			d.zones[zone] = zoneConfig{
+				nonAuthoritative:  existing.nonAuthoritative && cfg.nonAuthoritative,
+				noDataFallthrough: existing.noDataFallthrough && cfg.noDataFallthrough,
+			}
+		}
+	}
+}
+
+// ApplyDelta adds and removes individual management records without touching
+// the rest of the record set or the zone list. Removals run before additions,
+// so a changed record (e.g. a new TTL) can be expressed as a remove plus an add.
+func (d *Resolver) ApplyDelta(added, removed []nbdns.SimpleRecord) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	d.applyDelta(SourceManagement, added, removed)
+}
+
+// applyDelta performs the delta for source with the lock already held
+func (d *Resolver) applyDelta(source Source, added, removed []nbdns.SimpleRecord) {
+	for _, rec := range removed {
+		if err := d.unregisterRecord(source, rec); err != nil {
+			log.Warnf("failed to unregister the record (%s): %v", rec, err)
+		}
+	}
+
+	for _, rec := range added {
+		if err := d.registerRecord(source, rec); err != nil {
+			log.Warnf("failed to register the record (%s): %v", rec, err)
 		}
 	}
 }
 
-// RegisterRecord stores a new record by appending it to any existing list
+// RegisterRecord stores a new management record by appending it to any
+// existing list
 func (d *Resolver) RegisterRecord(record nbdns.SimpleRecord) error {
 	d.mu.Lock()
 	defer d.mu.Unlock()
 
-	return d.registerRecord(record)
+	return d.registerRecord(SourceManagement, record)
 }
 
 // registerRecord performs the registration with the lock already held
-func (d *Resolver) registerRecord(record nbdns.SimpleRecord) error {
+func (d *Resolver) registerRecord(source Source, record nbdns.SimpleRecord) error {
+	if _, ok := d.applied[source][record]; ok {
+		return nil
+	}
+
+	if d.refs[record] == 0 {
+		rr, q, err := parseRecord(record)
+		if err != nil {
+			return fmt.Errorf("register record: %w", err)
+		}
+
+		d.records[q] = append(d.records[q], rr)
+		d.domains[domain.Domain(q.Name)]++
+	}
+
+	if d.applied[source] == nil {
+		d.applied[source] = make(map[nbdns.SimpleRecord]struct{})
+	}
+	d.applied[source][record] = struct{}{}
+	d.refs[record]++
+
+	return nil
+}
+
+// unregisterRecord removes a single record of source with the lock already
+// held. Records that source didn't register are ignored, records other
+// sources still hold stay in place.
+func (d *Resolver) unregisterRecord(source Source, record nbdns.SimpleRecord) error {
+	if _, ok := d.applied[source][record]; !ok {
+		return nil
+	}
+	delete(d.applied[source], record)
+	if len(d.applied[source]) == 0 {
+		delete(d.applied, source)
+	}
+
+	d.refs[record]--
+	if d.refs[record] > 0 {
+		return nil
+	}
+	delete(d.refs, record)
+
+	rr, q, err := parseRecord(record)
+	if err != nil {
+		return fmt.Errorf("unregister record: %w", err)
+	}
+
+	records := d.records[q]
+	idx := slices.IndexFunc(records, func(existing dns.RR) bool {
+		return existing.Header().Ttl == rr.Header().Ttl && dns.IsDuplicate(existing, rr)
+	})
+	if idx == -1 {
+		return nil
+	}
+
+	records = slices.Delete(records, idx, idx+1)
+	if len(records) == 0 {
+		delete(d.records, q)
+	} else {
+		d.records[q] = records
+	}
+
+	name := domain.Domain(q.Name)
+	d.domains[name]--
+	if d.domains[name] <= 0 {
+		delete(d.domains, name)
+	}
+
+	return nil
+}
+
+// parseRecord converts a management record into its wire representation and
+// the question it answers.
+func parseRecord(record nbdns.SimpleRecord) (dns.RR, dns.Question, error) {
 	rr, err := dns.NewRR(record.String())
 	if err != nil {
-		return fmt.Errorf("register record: %w", err)
+		return nil, dns.Question{}, err
 	}
 
 	rr.Header().Rdlength = record.Len()
@@ -670,8 +1055,5 @@ func (d *Resolver) registerRecord(record nbdns.SimpleRecord) error {
 		Qclass: header.Class,
 	}
 
-	d.records[q] = append(d.records[q], rr)
-	d.domains[domain.Domain(q.Name)] = struct{}{}
-
-	return nil
+	return rr, q, nil
 }
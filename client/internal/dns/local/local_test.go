@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"net"
 	"net/netip"
+	"slices"
 	"strings"
 	"sync"
 	"testing"
@@ -14,6 +15,7 @@ import (
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 
+	"github.com/netbirdio/netbird/client/internal/dns/resutil"
 	"github.com/netbirdio/netbird/client/internal/dns/test"
 	nbdns "github.com/netbirdio/netbird/dns"
 )
@@ -239,6 +241,195 @@ func TestLocalResolver_MultipleRecords_SameQuestion(t *testing.T) {
 	assert.Contains(t, recordStrings[0]+recordStrings[1], record2.RData, "Second record data should be present")
 }
 
+// TestLocalResolver_SRVRecords verifies that weighted SRV records are served with
+// their priority, weight and port, and that in-zone targets are added as additional records
+func TestLocalResolver_SRVRecords(t *testing.T) {
+	resolver := NewResolver()
+
+	srvName := "_sip._tcp.example.com."
+	zones := []nbdns.CustomZone{{
+		Domain: "example.com.",
+		Records: []nbdns.SimpleRecord{
+			nbdns.NewSRVRecord(srvName, 300, 10, 60, 5060, "sip1.example.com"),
+			nbdns.NewSRVRecord(srvName, 300, 10, 40, 5060, "sip2.example.com."),
+			nbdns.NewSRVRecord(srvName, 300, 20, 0, 5070, "backup.other.com."),
+			{Name: "sip1.example.com.", Type: int(dns.TypeA), Class: nbdns.DefaultClass, TTL: 300, RData: "10.0.0.1"},
+			{Name: "sip2.example.com.", Type: int(dns.TypeAAAA), Class: nbdns.DefaultClass, TTL: 300, RData: "fd00::2"},
+		},
+	}}
+	resolver.Update(zones)
+
+	var resp *dns.Msg
+	w := &test.MockResponseWriter{
+		WriteMsgFunc: func(m *dns.Msg) error {
+			resp = m
+			return nil
+		},
+	}
+	resolver.ServeDNS(w, new(dns.Msg).SetQuestion(srvName, dns.TypeSRV))
+
+	require.NotNil(t, resp, "Response should be written")
+	assert.Equal(t, dns.RcodeSuccess, resp.Rcode)
+	require.Len(t, resp.Answer, 3)
+
+	got := make(map[string]*dns.SRV)
+	for _, rr := range resp.Answer {
+		srv, ok := rr.(*dns.SRV)
+		require.True(t, ok, "Answer should be SRV, got %T", rr)
+		got[srv.Target] = srv
+	}
+	require.Contains(t, got, "sip1.example.com.")
+	assert.Equal(t, uint16(10), got["sip1.example.com."].Priority)
+	assert.Equal(t, uint16(60), got["sip1.example.com."].Weight)
+	assert.Equal(t, uint16(5060), got["sip1.example.com."].Port)
+	require.Contains(t, got, "backup.other.com.")
+	assert.Equal(t, uint16(20), got["backup.other.com."].Priority)
+	assert.Equal(t, uint16(0), got["backup.other.com."].Weight)
+	assert.Equal(t, uint16(5070), got["backup.other.com."].Port)
+
+	require.Len(t, resp.Extra, 2, "Only in-zone targets should be added as additional records")
+	extra := []string{resp.Extra[0].String(), resp.Extra[1].String()}
+	assert.Contains(t, strings.Join(extra, " "), "10.0.0.1")
+	assert.Contains(t, strings.Join(extra, " "), "fd00::2")
+}
+
+// TestLocalResolver_SRVTargetsSkipDisconnectedPeers verifies that SRV additional
+// records are filtered like direct answers
+func TestLocalResolver_SRVTargetsSkipDisconnectedPeers(t *testing.T) {
+	resolver := NewResolver()
+	resolver.SetPeerConnectivity(mockPeerConnectivity{byIP: map[string]struct{ known, connected bool }{
+		"100.64.0.1": {known: true, connected: true},
+		"100.64.0.2": {known: true, connected: false},
+	}})
+
+	srvName := "_http._tcp.example.com."
+	resolver.Update([]nbdns.CustomZone{{
+		Domain: "example.com.",
+		Records: []nbdns.SimpleRecord{
+			nbdns.NewSRVRecord(srvName, 300, 10, 0, 80, "web.example.com."),
+			{Name: "web.example.com.", Type: int(dns.TypeA), Class: nbdns.DefaultClass, TTL: 300, RData: "100.64.0.1"},
+			{Name: "web.example.com.", Type: int(dns.TypeA), Class: nbdns.DefaultClass, TTL: 300, RData: "100.64.0.2"},
+		},
+	}})
+
+	var resp *dns.Msg
+	w := &test.MockResponseWriter{
+		WriteMsgFunc: func(m *dns.Msg) error {
+			resp = m
+			return nil
+		},
+	}
+	resolver.ServeDNS(w, new(dns.Msg).SetQuestion(srvName, dns.TypeSRV))
+
+	require.NotNil(t, resp, "Response should be written")
+	require.Len(t, resp.Answer, 1)
+	require.Len(t, resp.Extra, 1, "Disconnected peer should be dropped from additional records")
+	assert.Equal(t, "100.64.0.1", resp.Extra[0].(*dns.A).A.String())
+}
+
+// TestLocalResolver_HTTPSRecords verifies that HTTPS records are served with their
+// service parameters, that unknown parameters are echoed back verbatim and that
+// in-zone targets are added as additional records
+func TestLocalResolver_HTTPSRecords(t *testing.T) {
+	resolver := NewResolver()
+
+	name := "app.example.com."
+	resolver.Update([]nbdns.CustomZone{{
+		Domain: "example.com.",
+		Records: []nbdns.SimpleRecord{
+			nbdns.NewSVCBRecord(name, 300, dns.TypeHTTPS, 1, ".",
+				nbdns.SVCBParam{Key: "alpn", Value: "h2,h3"},
+				nbdns.SVCBParam{Key: "port", Value: "8443"},
+				nbdns.SVCBParam{Key: "ipv4hint", Value: "10.0.0.1"},
+				nbdns.SVCBParam{Key: "ipv6hint", Value: "fd00::1"},
+				nbdns.SVCBParam{Key: "key65000", Value: "opaque"},
+			),
+			nbdns.NewSVCBRecord(name, 300, dns.TypeHTTPS, 2, "alt.example.com", nbdns.SVCBParam{Key: "alpn", Value: "h2"}),
+			{Name: name, Type: int(dns.TypeA), Class: nbdns.DefaultClass, TTL: 300, RData: "10.0.0.1"},
+			{Name: "alt.example.com.", Type: int(dns.TypeAAAA), Class: nbdns.DefaultClass, TTL: 300, RData: "fd00::2"},
+		},
+	}})
+
+	var resp *dns.Msg
+	w := &test.MockResponseWriter{
+		WriteMsgFunc: func(m *dns.Msg) error {
+			resp = m
+			return nil
+		},
+	}
+	resolver.ServeDNS(w, new(dns.Msg).SetQuestion(name, dns.TypeHTTPS))
+
+	require.NotNil(t, resp, "Response should be written")
+	assert.Equal(t, dns.RcodeSuccess, resp.Rcode)
+	require.Len(t, resp.Answer, 2)
+
+	got := make(map[uint16]*dns.HTTPS)
+	for _, rr := range resp.Answer {
+		https, ok := rr.(*dns.HTTPS)
+		require.True(t, ok, "Answer should be HTTPS, got %T", rr)
+		got[https.Priority] = https
+	}
+	require.Contains(t, got, uint16(1))
+	assert.Equal(t, ".", got[1].Target)
+
+	params := make(map[string]string)
+	for _, kv := range got[1].Value {
+		params[kv.Key().String()] = kv.String()
+	}
+	assert.Equal(t, map[string]string{
+		"alpn":     "h2,h3",
+		"port":     "8443",
+		"ipv4hint": "10.0.0.1",
+		"ipv6hint": "fd00::1",
+		"key65000": "opaque",
+	}, params)
+
+	require.Contains(t, got, uint16(2))
+	assert.Equal(t, "alt.example.com.", got[2].Target)
+
+	require.Len(t, resp.Extra, 2, "Owner and alternative endpoint addresses should be added as additional records")
+	extra := []string{resp.Extra[0].String(), resp.Extra[1].String()}
+	assert.Contains(t, strings.Join(extra, " "), "10.0.0.1")
+	assert.Contains(t, strings.Join(extra, " "), "fd00::2")
+}
+
+// TestLocalResolver_SVCBRecordWire verifies that a SVCB record survives a wire
+// round trip, so the declared record length matches what is packed
+func TestLocalResolver_SVCBRecordWire(t *testing.T) {
+	resolver := NewResolver()
+
+	name := "_dns.resolver.example.com."
+	record := nbdns.NewSVCBRecord(name, 300, dns.TypeSVCB, 1, "doh.example.com",
+		nbdns.SVCBParam{Key: "alpn", Value: "h2"},
+		nbdns.SVCBParam{Key: "key65001"},
+	)
+	assert.NotZero(t, record.Len())
+	resolver.Update([]nbdns.CustomZone{{Domain: "example.com.", Records: []nbdns.SimpleRecord{record}}})
+
+	var resp *dns.Msg
+	w := &test.MockResponseWriter{
+		WriteMsgFunc: func(m *dns.Msg) error {
+			resp = m
+			return nil
+		},
+	}
+	resolver.ServeDNS(w, new(dns.Msg).SetQuestion(name, dns.TypeSVCB))
+
+	require.NotNil(t, resp, "Response should be written")
+	wire, err := resp.Pack()
+	require.NoError(t, err)
+
+	unpacked := new(dns.Msg)
+	require.NoError(t, unpacked.Unpack(wire))
+	require.Len(t, unpacked.Answer, 1)
+	svcb, ok := unpacked.Answer[0].(*dns.SVCB)
+	require.True(t, ok, "Answer should be SVCB, got %T", unpacked.Answer[0])
+	assert.Equal(t, "doh.example.com.", svcb.Target)
+	require.Len(t, svcb.Value, 2)
+	assert.Equal(t, "key65001", svcb.Value[1].Key().String())
+	assert.Equal(t, record.Len(), svcb.Hdr.Rdlength)
+}
+
 // TestLocalResolver_RecordRotation verifies that records are rotated in a round-robin fashion
 func TestLocalResolver_RecordRotation(t *testing.T) {
 	resolver := NewResolver()
@@ -875,6 +1066,33 @@ func TestLocalResolver_ExternalCNAMEResolution(t *testing.T) {
 		assert.Equal(t, "2606:2800:220:1:248:1893:25c8:1946", aaaa.AAAA.String())
 	})
 
+	t.Run("CNAME to external domain timing out carries EDE", func(t *testing.T) {
+		resolver := NewResolver()
+		resolver.resolver = &mockResolver{
+			lookupFunc: func(_ context.Context, _, host string) ([]netip.Addr, error) {
+				return nil, &net.DNSError{Err: "i/o timeout", Name: host, IsTimeout: true}
+			},
+		}
+
+		resolver.Update([]nbdns.CustomZone{{
+			Domain: "test.",
+			Records: []nbdns.SimpleRecord{
+				{Name: "alias.test.", Type: int(dns.TypeCNAME), Class: nbdns.DefaultClass, TTL: 300, RData: "external.example.com."},
+			},
+		}})
+
+		msg := new(dns.Msg).SetQuestion("alias.test.", dns.TypeA)
+		msg.SetEdns0(dns.DefaultMsgSize, false)
+		var resp *dns.Msg
+		resolver.ServeDNS(&test.MockResponseWriter{WriteMsgFunc: func(m *dns.Msg) error { resp = m; return nil }}, msg)
+
+		require.NotNil(t, resp)
+		assert.Equal(t, dns.RcodeServerFailure, resp.Rcode)
+		ede, ok := resutil.ExtractEDE(resp)
+		require.True(t, ok, "SERVFAIL from a failed CNAME target must carry an EDE")
+		assert.Equal(t, dns.ExtendedErrorCodeNoReachableAuthority, ede.InfoCode)
+	})
+
 	t.Run("concurrent external resolution", func(t *testing.T) {
 		resolver := NewResolver()
 		resolver.resolver = &mockResolver{
@@ -931,6 +1149,8 @@ func TestLocalResolver_ZoneManagement(t *testing.T) {
 		assert.True(t, resolver.isInManagedZone("other.example.com."))
 		assert.True(t, resolver.isInManagedZone("sub.test.local."))
 		assert.False(t, resolver.isInManagedZone("external.com."))
+		assert.True(t, resolver.InZone("other.example.com."))
+		assert.False(t, resolver.InZone("external.com."))
 	})
 
 	t.Run("isInManagedZone case insensitive", func(t *testing.T) {
@@ -1231,6 +1451,88 @@ func TestLocalResolver_Fallthrough(t *testing.T) {
 	}
 }
 
+// TestLocalResolver_FallthroughNoData verifies that NODATA and NXDOMAIN are
+// treated differently when deciding whether to fall through.
+func TestLocalResolver_FallthroughNoData(t *testing.T) {
+	record := nbdns.SimpleRecord{
+		Name:  "existing.custom.zone.",
+		Type:  int(dns.TypeA),
+		Class: nbdns.DefaultClass,
+		TTL:   300,
+		RData: "10.0.0.1",
+	}
+
+	testCases := []struct {
+		name              string
+		zone              nbdns.CustomZone
+		queryName         string
+		queryType         uint16
+		expectFallthrough bool
+		expectRcode       int
+	}{
+		{
+			name:              "NODATA in non-authoritative zone is answered locally by default",
+			zone:              nbdns.CustomZone{Domain: "custom.zone.", Records: []nbdns.SimpleRecord{record}, NonAuthoritative: true},
+			queryName:         "existing.custom.zone.",
+			queryType:         dns.TypeAAAA,
+			expectFallthrough: false,
+			expectRcode:       dns.RcodeSuccess,
+		},
+		{
+			name:              "NXDOMAIN in non-authoritative zone falls through by default",
+			zone:              nbdns.CustomZone{Domain: "custom.zone.", Records: []nbdns.SimpleRecord{record}, NonAuthoritative: true},
+			queryName:         "missing.custom.zone.",
+			queryType:         dns.TypeAAAA,
+			expectFallthrough: true,
+			expectRcode:       dns.RcodeNameError,
+		},
+		{
+			name: "NODATA falls through when the zone opts in",
+			zone: nbdns.CustomZone{
+				Domain: "custom.zone.", Records: []nbdns.SimpleRecord{record},
+				NonAuthoritative: true, NoDataFallthrough: true,
+			},
+			queryName:         "existing.custom.zone.",
+			queryType:         dns.TypeAAAA,
+			expectFallthrough: true,
+			expectRcode:       dns.RcodeSuccess,
+		},
+		{
+			name: "NODATA opt-in is ignored for authoritative zones",
+			zone: nbdns.CustomZone{
+				Domain: "custom.zone.", Records: []nbdns.SimpleRecord{record},
+				NoDataFallthrough: true,
+			},
+			queryName:         "existing.custom.zone.",
+			queryType:         dns.TypeAAAA,
+			expectFallthrough: false,
+			expectRcode:       dns.RcodeSuccess,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			resolver := NewResolver()
+			resolver.Update([]nbdns.CustomZone{tc.zone})
+
+			var responseMSG *dns.Msg
+			responseWriter := &test.MockResponseWriter{
+				WriteMsgFunc: func(m *dns.Msg) error {
+					responseMSG = m
+					return nil
+				},
+			}
+
+			resolver.ServeDNS(responseWriter, new(dns.Msg).SetQuestion(tc.queryName, tc.queryType))
+
+			require.NotNil(t, responseMSG, "Should have received a response")
+			assert.Equal(t, tc.expectFallthrough, responseMSG.MsgHdr.Zero, "Zero bit signals fallthrough")
+			assert.Equal(t, tc.expectRcode, responseMSG.Rcode)
+			assert.Empty(t, responseMSG.Answer)
+		})
+	}
+}
+
 // TestLocalResolver_AuthoritativeFlag tests the AA flag behavior
 func TestLocalResolver_AuthoritativeFlag(t *testing.T) {
 	t.Run("direct record lookup is authoritative", func(t *testing.T) {
@@ -2589,6 +2891,178 @@ func TestLocalResolver_MixedRecordTypes(t *testing.T) {
 	})
 }
 
+// TestLocalResolver_IncrementalUpdate verifies that Update only touches
+// records that changed and keeps the rest of the record set in place.
+func TestLocalResolver_IncrementalUpdate(t *testing.T) {
+	recA := nbdns.SimpleRecord{Name: "a.example.com.", Type: int(dns.TypeA), Class: nbdns.DefaultClass, TTL: 300, RData: "10.0.0.1"}
+	recB := nbdns.SimpleRecord{Name: "b.example.com.", Type: int(dns.TypeA), Class: nbdns.DefaultClass, TTL: 300, RData: "10.0.0.2"}
+	recB2 := nbdns.SimpleRecord{Name: "b.example.com.", Type: int(dns.TypeA), Class: nbdns.DefaultClass, TTL: 300, RData: "10.0.0.3"}
+	recBAAAA := nbdns.SimpleRecord{Name: "b.example.com.", Type: int(dns.TypeAAAA), Class: nbdns.DefaultClass, TTL: 300, RData: "fd00::2"}
+
+	qA := dns.Question{Name: "a.example.com.", Qtype: dns.TypeA, Qclass: dns.ClassINET}
+	qB := dns.Question{Name: "b.example.com.", Qtype: dns.TypeA, Qclass: dns.ClassINET}
+
+	t.Run("unchanged records are preserved", func(t *testing.T) {
+		resolver := NewResolver()
+		resolver.Update([]nbdns.CustomZone{{Domain: "example.com.", Records: []nbdns.SimpleRecord{recA, recB}}})
+
+		resolver.mu.RLock()
+		before := resolver.records[qA][0]
+		resolver.mu.RUnlock()
+
+		resolver.Update([]nbdns.CustomZone{{Domain: "example.com.", Records: []nbdns.SimpleRecord{recA, recB2}}})
+
+		resolver.mu.RLock()
+		defer resolver.mu.RUnlock()
+		require.Len(t, resolver.records[qA], 1)
+		assert.Same(t, before, resolver.records[qA][0], "unchanged record must not be re-created")
+		require.Len(t, resolver.records[qB], 1)
+		assert.Contains(t, resolver.records[qB][0].String(), recB2.RData)
+		assert.Len(t, resolver.applied[SourceManagement], 2)
+	})
+
+	t.Run("name stays known until its last record is removed", func(t *testing.T) {
+		resolver := NewResolver()
+		resolver.Update([]nbdns.CustomZone{{Domain: "example.com.", Records: []nbdns.SimpleRecord{recB, recBAAAA}}})
+
+		resolver.Update([]nbdns.CustomZone{{Domain: "example.com.", Records: []nbdns.SimpleRecord{recBAAAA}}})
+		assert.True(t, resolver.hasRecordsForDomain("b.example.com.", dns.TypeA), "AAAA record keeps the name known")
+		assert.False(t, resolver.hasRecord(qB))
+
+		resolver.Update([]nbdns.CustomZone{{Domain: "example.com."}})
+		assert.False(t, resolver.hasRecordsForDomain("b.example.com.", dns.TypeA))
+		assert.Empty(t, resolver.records)
+		assert.Empty(t, resolver.domains)
+	})
+
+	t.Run("TTL change replaces the record", func(t *testing.T) {
+		resolver := NewResolver()
+		resolver.Update([]nbdns.CustomZone{{Domain: "example.com.", Records: []nbdns.SimpleRecord{recA}}})
+
+		recATTL := recA
+		recATTL.TTL = 60
+		resolver.Update([]nbdns.CustomZone{{Domain: "example.com.", Records: []nbdns.SimpleRecord{recATTL}}})
+
+		records := resolver.getRecords(qA)
+		require.Len(t, records, 1)
+		assert.Equal(t, uint32(60), records[0].Header().Ttl)
+	})
+
+	t.Run("ApplyDelta adds and removes single records", func(t *testing.T) {
+		resolver := NewResolver()
+		resolver.Update([]nbdns.CustomZone{{Domain: "example.com.", Records: []nbdns.SimpleRecord{recA, recB}}})
+
+		resolver.ApplyDelta([]nbdns.SimpleRecord{recB2}, []nbdns.SimpleRecord{recB})
+
+		assert.Len(t, resolver.getRecords(qA), 1)
+		records := resolver.getRecords(qB)
+		require.Len(t, records, 1)
+		assert.Contains(t, records[0].String(), recB2.RData)
+		assert.True(t, resolver.isInManagedZone("a.example.com."), "zones must be untouched by a delta")
+	})
+
+	t.Run("removing an unknown record is a no-op", func(t *testing.T) {
+		resolver := NewResolver()
+		resolver.Update([]nbdns.CustomZone{{Domain: "example.com.", Records: []nbdns.SimpleRecord{recA}}})
+
+		resolver.ApplyDelta(nil, []nbdns.SimpleRecord{recB})
+
+		assert.Len(t, resolver.getRecords(qA), 1)
+		assert.Len(t, resolver.applied[SourceManagement], 1)
+	})
+}
+
+func TestLocalResolver_Sources(t *testing.T) {
+	const sourceMirror Source = "mirror"
+
+	recMgmt := nbdns.SimpleRecord{Name: "app.example.com.", Type: int(dns.TypeA), Class: nbdns.DefaultClass, TTL: 300, RData: "10.0.0.1"}
+	recMirror := nbdns.SimpleRecord{Name: "db.example.com.", Type: int(dns.TypeA), Class: nbdns.DefaultClass, TTL: 300, RData: "10.0.0.2"}
+	recShared := nbdns.SimpleRecord{Name: "shared.example.com.", Type: int(dns.TypeA), Class: nbdns.DefaultClass, TTL: 300, RData: "10.0.0.3"}
+
+	qMgmt := dns.Question{Name: "app.example.com.", Qtype: dns.TypeA, Qclass: dns.ClassINET}
+	qMirror := dns.Question{Name: "db.example.com.", Qtype: dns.TypeA, Qclass: dns.ClassINET}
+	qShared := dns.Question{Name: "shared.example.com.", Qtype: dns.TypeA, Qclass: dns.ClassINET}
+
+	newResolver := func() *Resolver {
+		resolver := NewResolver()
+		resolver.Update([]nbdns.CustomZone{{Domain: "example.com.", Records: []nbdns.SimpleRecord{recMgmt, recShared}}})
+		resolver.UpdateSource(sourceMirror, []nbdns.CustomZone{{Domain: "example.com.", NonAuthoritative: true, Records: []nbdns.SimpleRecord{recMirror, recShared}}})
+		return resolver
+	}
+
+	t.Run("sources coexist", func(t *testing.T) {
+		resolver := newResolver()
+
+		assert.Len(t, resolver.getRecords(qMgmt), 1)
+		assert.Len(t, resolver.getRecords(qMirror), 1)
+		assert.Len(t, resolver.getRecords(qShared), 1, "a record held by two sources is served once")
+
+		assert.Equal(t, []Source{SourceManagement, sourceMirror}, resolver.Sources())
+		assert.Equal(t, []nbdns.SimpleRecord{recMgmt, recShared}, resolver.Records(SourceManagement))
+		assert.Equal(t, []nbdns.SimpleRecord{recMirror, recShared}, resolver.Records(sourceMirror))
+		assert.False(t, resolver.shouldFallthrough("missing.example.com.", resutil.NXDomain),
+			"a zone stays authoritative while any source serves it authoritatively")
+	})
+
+	t.Run("update of one source keeps the others", func(t *testing.T) {
+		resolver := newResolver()
+
+		resolver.UpdateSource(sourceMirror, []nbdns.CustomZone{{Domain: "example.com.", NonAuthoritative: true}})
+
+		assert.Len(t, resolver.getRecords(qMgmt), 1)
+		assert.Empty(t, resolver.getRecords(qMirror))
+		assert.Len(t, resolver.getRecords(qShared), 1, "management still holds the shared record")
+
+		resolver.Update(nil)
+
+		assert.Empty(t, resolver.getRecords(qMgmt))
+		assert.Empty(t, resolver.getRecords(qShared))
+		assert.True(t, resolver.isInManagedZone("db.example.com."), "mirror zone must survive a management update")
+		assert.True(t, resolver.shouldFallthrough("missing.example.com.", resutil.NXDomain))
+	})
+
+	t.Run("flush removes only the flushed source", func(t *testing.T) {
+		resolver := newResolver()
+
+		resolver.FlushSource(SourceManagement)
+
+		assert.Empty(t, resolver.getRecords(qMgmt))
+		assert.Len(t, resolver.getRecords(qMirror), 1)
+		assert.Len(t, resolver.getRecords(qShared), 1, "mirror still holds the shared record")
+		assert.Empty(t, resolver.Records(SourceManagement))
+		assert.Equal(t, []Source{sourceMirror}, resolver.Sources())
+
+		resolver.FlushSource(sourceMirror)
+
+		assert.Empty(t, resolver.Sources())
+		assert.False(t, resolver.isInManagedZone("db.example.com."))
+		resolver.mu.RLock()
+		defer resolver.mu.RUnlock()
+		assert.Empty(t, resolver.records)
+		assert.Empty(t, resolver.domains)
+		assert.Empty(t, resolver.refs)
+	})
+
+	t.Run("record-only source adds no zones", func(t *testing.T) {
+		resolver := newResolver()
+		recHost := nbdns.SimpleRecord{Name: "host.example.org.", Type: int(dns.TypeA), Class: nbdns.DefaultClass, TTL: 300, RData: "10.0.0.4"}
+		qHost := dns.Question{Name: "host.example.org.", Qtype: dns.TypeA, Qclass: dns.ClassINET}
+
+		resolver.UpdateSourceRecords(SourceStaticHosts, []nbdns.SimpleRecord{recHost, recShared, recHost})
+
+		assert.Len(t, resolver.getRecords(qHost), 1)
+		assert.Len(t, resolver.getRecords(qShared), 1)
+		assert.Equal(t, []nbdns.SimpleRecord{recHost, recShared}, resolver.Records(SourceStaticHosts))
+		assert.False(t, resolver.isInManagedZone("other.example.org."))
+
+		resolver.UpdateSourceRecords(SourceStaticHosts, nil)
+
+		assert.Empty(t, resolver.getRecords(qHost))
+		assert.Len(t, resolver.getRecords(qShared), 1, "the other sources still hold the shared record")
+		assert.Equal(t, []Source{SourceManagement, sourceMirror}, resolver.Sources())
+	})
+}
+
 // BenchmarkFindZone_BestCase benchmarks zone lookup with immediate match (first label)
 func BenchmarkFindZone_BestCase(b *testing.B) {
 	resolver := NewResolver()
@@ -2601,7 +3075,7 @@ func BenchmarkFindZone_BestCase(b *testing.B) {
 
 	b.ResetTimer()
 	for i := 0; i < b.N; i++ {
-		resolver.shouldFallthrough("example.com.")
+		resolver.shouldFallthrough("example.com.", resutil.NXDomain)
 	}
 }
 
@@ -2624,7 +3098,7 @@ func BenchmarkFindZone_WorstCase(b *testing.B) {
 
 	b.ResetTimer()
 	for i := 0; i < b.N; i++ {
-		resolver.shouldFallthrough(qname)
+		resolver.shouldFallthrough(qname, resutil.NXDomain)
 	}
 }
 
@@ -2643,7 +3117,7 @@ func BenchmarkFindZone_TypicalCase(b *testing.B) {
 
 	b.ResetTimer()
 	for i := 0; i < b.N; i++ {
-		resolver.shouldFallthrough(qname)
+		resolver.shouldFallthrough(qname, resutil.NXDomain)
 	}
 }
 
@@ -2789,3 +3263,52 @@ func TestLocalResolver_FilterDisconnectedPeerAnswers(t *testing.T) {
 		})
 	}
 }
+
+// largeZone returns a zone with n A records plus the same zone with one
+// record changed, for comparing full and incremental updates.
+func largeZone(n int) (nbdns.CustomZone, nbdns.CustomZone) {
+	records := make([]nbdns.SimpleRecord, 0, n)
+	for i := 0; i < n; i++ {
+		records = append(records, nbdns.SimpleRecord{
+			Name:  fmt.Sprintf("host%d.example.com.", i),
+			Type:  int(dns.TypeA),
+			Class: nbdns.DefaultClass,
+			TTL:   300,
+			RData: fmt.Sprintf("10.%d.%d.%d", (i>>16)&0xff, (i>>8)&0xff, i&0xff),
+		})
+	}
+	base := nbdns.CustomZone{Domain: "example.com.", Records: records}
+
+	changed := base
+	changed.Records = slices.Clone(records)
+	changed.Records[n/2].RData = "192.168.0.1"
+
+	return base, changed
+}
+
+// BenchmarkUpdate_FullLoad benchmarks loading a large zone into an empty
+// resolver, which is the cost a full record-set replacement pays on every update.
+func BenchmarkUpdate_FullLoad(b *testing.B) {
+	base, _ := largeZone(10000)
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		resolver := NewResolver()
+		resolver.Update([]nbdns.CustomZone{base})
+	}
+}
+
+// BenchmarkUpdate_SingleRecordChange benchmarks an update of a large zone where
+// only one record differs from the previously applied set.
+func BenchmarkUpdate_SingleRecordChange(b *testing.B) {
+	base, changed := largeZone(10000)
+	resolver := NewResolver()
+	resolver.Update([]nbdns.CustomZone{base})
+
+	zones := [][]nbdns.CustomZone{{changed}, {base}}
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		resolver.Update(zones[i%2])
+	}
+}
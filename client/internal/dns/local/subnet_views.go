@@ -0,0 +1,116 @@
+package local
+
+import (
+	"net"
+	"net/netip"
+	"slices"
+
+	"github.com/miekg/dns"
+	log "github.com/sirupsen/logrus"
+
+	nbdns "github.com/netbirdio/netbird/dns"
+)
+
+// subnetView holds the records of a zone served to the clients within
+// prefix, in place of the zone's records of the same question.
+type subnetView struct {
+	prefix  netip.Prefix
+	records map[dns.Question][]dns.RR
+}
+
+// buildSubnetViews parses the subnet record sets of zones. Invalid subnets
+// and records are skipped.
+func buildSubnetViews(zones []nbdns.CustomZone) []subnetView {
+	var views []subnetView
+	for _, zone := range zones {
+		for _, set := range zone.SubnetRecords {
+			if !set.Subnet.IsValid() {
+				log.Warnf("invalid subnet of the subnet records of zone %s, skipping", zone.Domain)
+				continue
+			}
+			view := subnetView{prefix: set.Subnet.Masked(), records: make(map[dns.Question][]dns.RR)}
+			for _, rec := range set.Records {
+				rr, q, err := parseRecord(rec)
+				if err != nil {
+					log.Warnf("failed to parse the subnet record (%s) for %s: %v", rec, set.Subnet, err)
+					continue
+				}
+				view.records[q] = append(view.records[q], rr)
+			}
+			if len(view.records) > 0 {
+				views = append(views, view)
+			}
+		}
+	}
+	return views
+}
+
+// setSourceViews replaces the subnet views of source and rebuilds the merged
+// list, most specific subnet first, with the lock already held.
+func (d *Resolver) setSourceViews(source Source, views []subnetView) {
+	if len(views) == 0 {
+		delete(d.sourceViews, source)
+	} else {
+		d.sourceViews[source] = views
+	}
+
+	d.views = d.views[:0]
+	for _, sourceViews := range d.sourceViews {
+		d.views = append(d.views, sourceViews...)
+	}
+	slices.SortStableFunc(d.views, func(a, b subnetView) int {
+		return b.prefix.Bits() - a.prefix.Bits()
+	})
+}
+
+// lookupSubnetRecords returns the records for question of the most specific
+// subnet view containing client, false if none has records for it.
+func (d *Resolver) lookupSubnetRecords(question dns.Question, client netip.Addr) ([]dns.RR, bool) {
+	if !client.IsValid() {
+		return nil, false
+	}
+
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+
+	for _, view := range d.views {
+		if !view.prefix.Contains(client) {
+			continue
+		}
+		if records, ok := view.records[question]; ok {
+			return slices.Clone(records), true
+		}
+	}
+	return nil, false
+}
+
+// clientSubnetAddr returns the address the subnet views are matched against:
+// the EDNS Client Subnet address of r if it carries one, else the address r
+// was received from.
+func clientSubnetAddr(w dns.ResponseWriter, r *dns.Msg) netip.Addr {
+	if opt := r.IsEdns0(); opt != nil {
+		for _, option := range opt.Option {
+			ecs, ok := option.(*dns.EDNS0_SUBNET)
+			if !ok {
+				continue
+			}
+			addr, ok := netip.AddrFromSlice(ecs.Address)
+			if !ok {
+				return netip.Addr{}
+			}
+			prefix, err := addr.Unmap().Prefix(int(ecs.SourceNetmask))
+			if err != nil {
+				return netip.Addr{}
+			}
+			return prefix.Addr()
+		}
+	}
+
+	switch addr := w.RemoteAddr().(type) {
+	case *net.UDPAddr:
+		return addr.AddrPort().Addr().Unmap()
+	case *net.TCPAddr:
+		return addr.AddrPort().Addr().Unmap()
+	}
+	return netip.Addr{}
+}
@@ -0,0 +1,134 @@
+package local
+
+import (
+	"net"
+	"net/netip"
+	"testing"
+
+	"github.com/miekg/dns"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/netbirdio/netbird/client/internal/dns/test"
+	nbdns "github.com/netbirdio/netbird/dns"
+)
+
+type remoteAddrWriter struct {
+	test.MockResponseWriter
+	remote net.Addr
+}
+
+func (w *remoteAddrWriter) RemoteAddr() net.Addr { return w.remote }
+
+func subnetZone() nbdns.CustomZone {
+	record := func(name, ip string) nbdns.SimpleRecord {
+		return nbdns.SimpleRecord{Name: name, Type: int(dns.TypeA), Class: nbdns.DefaultClass, TTL: 300, RData: ip}
+	}
+	return nbdns.CustomZone{
+		Domain: "steer.internal.",
+		Records: []nbdns.SimpleRecord{
+			record("app.steer.internal.", "10.0.0.1"),
+			record("db.steer.internal.", "10.0.0.2"),
+		},
+		SubnetRecords: []nbdns.SubnetRecordSet{
+			{
+				Subnet:  netip.MustParsePrefix("192.168.0.0/16"),
+				Records: []nbdns.SimpleRecord{record("app.steer.internal.", "192.168.0.1")},
+			},
+			{
+				Subnet:  netip.MustParsePrefix("192.168.10.0/24"),
+				Records: []nbdns.SimpleRecord{record("app.steer.internal.", "192.168.10.1"), record("app.steer.internal.", "192.168.10.2")},
+			},
+			{
+				Subnet:  netip.MustParsePrefix("fd00:1::/64"),
+				Records: []nbdns.SimpleRecord{record("app.steer.internal.", "172.16.0.1")},
+			},
+		},
+	}
+}
+
+func TestLocalResolver_SubnetRecords(t *testing.T) {
+	resolver := NewResolver()
+	resolver.Update([]nbdns.CustomZone{subnetZone()})
+
+	serve := func(name string, remote string, ecs string) []string {
+		t.Helper()
+		r := new(dns.Msg).SetQuestion(name, dns.TypeA)
+		if ecs != "" {
+			prefix := netip.MustParsePrefix(ecs)
+			family := uint16(1)
+			if prefix.Addr().Is6() {
+				family = 2
+			}
+			r.SetEdns0(dns.DefaultMsgSize, false)
+			opt := r.IsEdns0()
+			opt.Option = append(opt.Option, &dns.EDNS0_SUBNET{
+				Code:          dns.EDNS0SUBNET,
+				Family:        family,
+				SourceNetmask: uint8(prefix.Bits()),
+				Address:       prefix.Addr().AsSlice(),
+			})
+		}
+
+		var resp *dns.Msg
+		w := &remoteAddrWriter{MockResponseWriter: test.MockResponseWriter{WriteMsgFunc: func(m *dns.Msg) error { resp = m; return nil }}}
+		if remote != "" {
+			w.remote = net.UDPAddrFromAddrPort(netip.MustParseAddrPort(remote))
+		}
+		resolver.ServeDNS(w, r)
+		require.NotNil(t, resp)
+		require.Equal(t, dns.RcodeSuccess, resp.Rcode)
+
+		var ips []string
+		for _, rr := range resp.Answer {
+			ips = append(ips, rr.(*dns.A).A.String())
+		}
+		return ips
+	}
+
+	tests := []struct {
+		name     string
+		qname    string
+		remote   string
+		ecs      string
+		expected []string
+	}{
+		{name: "source outside every subnet", qname: "app.steer.internal.", remote: "100.64.0.5:5353", expected: []string{"10.0.0.1"}},
+		{name: "no client address", qname: "app.steer.internal.", expected: []string{"10.0.0.1"}},
+		{name: "source in subnet", qname: "app.steer.internal.", remote: "192.168.3.4:5353", expected: []string{"192.168.0.1"}},
+		{name: "most specific subnet wins", qname: "app.steer.internal.", remote: "192.168.10.4:5353", expected: []string{"192.168.10.1", "192.168.10.2"}},
+		{name: "ECS takes precedence over source", qname: "app.steer.internal.", remote: "192.168.10.4:5353", ecs: "192.168.20.0/24", expected: []string{"192.168.0.1"}},
+		{name: "ECS outside every subnet", qname: "app.steer.internal.", remote: "192.168.10.4:5353", ecs: "203.0.113.0/24", expected: []string{"10.0.0.1"}},
+		{name: "IPv6 ECS outside every subnet", qname: "app.steer.internal.", ecs: "fd00:2::/64", expected: []string{"10.0.0.1"}},
+		{name: "IPv6 ECS in subnet", qname: "app.steer.internal.", ecs: "fd00:1::/64", expected: []string{"172.16.0.1"}},
+		{name: "name without subnet records", qname: "db.steer.internal.", remote: "192.168.10.4:5353", expected: []string{"10.0.0.2"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.ElementsMatch(t, tt.expected, serve(tt.qname, tt.remote, tt.ecs))
+		})
+	}
+
+	t.Run("update removes subnet records", func(t *testing.T) {
+		zone := subnetZone()
+		zone.SubnetRecords = nil
+		resolver.Update([]nbdns.CustomZone{zone})
+		assert.Equal(t, []string{"10.0.0.1"}, serve("app.steer.internal.", "192.168.10.4:5353", ""))
+	})
+}
+
+func TestLocalResolver_SubnetRecordsPerSource(t *testing.T) {
+	resolver := NewResolver()
+	resolver.UpdateSource("override", []nbdns.CustomZone{subnetZone()})
+	resolver.Update([]nbdns.CustomZone{{Domain: "other.internal."}})
+
+	client := netip.MustParseAddr("192.168.10.4")
+	question := dns.Question{Name: "app.steer.internal.", Qtype: dns.TypeA, Qclass: dns.ClassINET}
+	records, ok := resolver.lookupSubnetRecords(question, client)
+	require.True(t, ok, "updating another source keeps the subnet records")
+	assert.Len(t, records, 2)
+
+	resolver.FlushSource("override")
+	_, ok = resolver.lookupSubnetRecords(question, client)
+	assert.False(t, ok, "flushing the source drops its subnet records")
+}
@@ -0,0 +1,133 @@
+package dns
+
+import (
+	"net/netip"
+	"os"
+	"strings"
+
+	"github.com/miekg/dns"
+	log "github.com/sirupsen/logrus"
+
+	"github.com/netbirdio/netbird/client/iface/wgaddr"
+	"github.com/netbirdio/netbird/client/internal/dns/resutil"
+	"github.com/netbirdio/netbird/client/internal/dns/types"
+)
+
+// loopbackTTL is the TTL of answers synthesized by loopbackResolver.
+const loopbackTTL = 60
+
+var (
+	loopbackV4 = netip.MustParseAddr("127.0.0.1")
+	loopbackV6 = netip.IPv6Loopback()
+)
+
+// loopbackResolver answers "localhost", its subdomains (RFC 6761) and the
+// host's own name directly, the way a stub resolver does, so these names are
+// never forwarded to upstreams. The hostname resolves to the peer's tunnel
+// addresses, or to loopback when the interface has none.
+type loopbackResolver struct {
+	// hostname is the host's own name, lowercase and fully qualified. Empty
+	// when only localhost is answered.
+	hostname string
+	address  func() wgaddr.Address
+}
+
+func newLoopbackResolver(hostname string, address func() wgaddr.Address) *loopbackResolver {
+	if hostname != "" {
+		hostname = strings.ToLower(dns.Fqdn(hostname))
+	}
+	return &loopbackResolver{hostname: hostname, address: address}
+}
+
+// patterns returns the handler chain patterns the resolver is registered for.
+func (l *loopbackResolver) patterns() []string {
+	patterns := []string{"localhost.", "*.localhost."}
+	if l.hostname != "" && !dns.IsSubDomain("localhost.", l.hostname) {
+		patterns = append(patterns, l.hostname)
+	}
+	return patterns
+}
+
+func (l *loopbackResolver) String() string {
+	return "LoopbackResolver"
+}
+
+func (l *loopbackResolver) ID() types.HandlerID {
+	return "loopback"
+}
+
+func (l *loopbackResolver) Stop() {
+	// nothing to release
+}
+
+func (l *loopbackResolver) ServeDNS(w dns.ResponseWriter, r *dns.Msg) {
+	if len(r.Question) == 0 {
+		return
+	}
+	q := r.Question[0]
+
+	resp := new(dns.Msg)
+	resp.SetReply(r)
+	resp.Authoritative = true
+
+	var v4, v6 netip.Addr
+	name := strings.ToLower(q.Name)
+	if name == l.hostname {
+		v4, v6 = l.hostAddresses()
+	} else {
+		v4, v6 = loopbackV4, loopbackV6
+	}
+
+	hdr := dns.RR_Header{Name: q.Name, Class: dns.ClassINET, Ttl: loopbackTTL}
+	switch {
+	case q.Qclass != dns.ClassINET:
+	case q.Qtype == dns.TypeA && v4.IsValid():
+		hdr.Rrtype = dns.TypeA
+		resp.Answer = append(resp.Answer, &dns.A{Hdr: hdr, A: v4.AsSlice()})
+	case q.Qtype == dns.TypeAAAA && v6.IsValid():
+		hdr.Rrtype = dns.TypeAAAA
+		resp.Answer = append(resp.Answer, &dns.AAAA{Hdr: hdr, AAAA: v6.AsSlice()})
+	}
+
+	resutil.SetMeta(w, "loopback", "true")
+	if err := w.WriteMsg(resp); err != nil {
+		log.Errorf("failed to write loopback response for %s: %v", q.Name, err)
+	}
+}
+
+// hostAddresses returns the peer's tunnel addresses, falling back to
+// loopback while the interface has no IPv4 address.
+func (l *loopbackResolver) hostAddresses() (netip.Addr, netip.Addr) {
+	if l.address == nil {
+		return loopbackV4, loopbackV6
+	}
+	addr := l.address()
+	if !addr.IP.IsValid() {
+		return loopbackV4, loopbackV6
+	}
+	return addr.IP, addr.IPv6
+}
+
+// enableLoopbackAnswers registers the loopback resolver below the local
+// resolver, so a "localhost" custom zone pushed by management still wins.
+// An empty hostname uses the OS hostname.
+func (s *DefaultServer) enableLoopbackAnswers(hostname string) {
+	if hostname == "" {
+		name, err := os.Hostname()
+		if err != nil {
+			log.Warnf("failed to get hostname, answering only localhost directly: %v", err)
+		}
+		hostname = name
+	}
+
+	var address func() wgaddr.Address
+	if s.wgInterface != nil {
+		address = s.wgInterface.Address
+	}
+	resolver := newLoopbackResolver(hostname, address)
+
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	s.registerHandler(resolver.patterns(), resolver, PriorityLoopback)
+	log.Debugf("answering %v directly", resolver.patterns())
+}
@@ -0,0 +1,84 @@
+package dns
+
+import (
+	"testing"
+
+	"github.com/miekg/dns"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/netbirdio/netbird/client/internal/dns/test"
+	nbdns "github.com/netbirdio/netbird/dns"
+)
+
+func TestLoopbackResolver(t *testing.T) {
+	server := newTestServer(nil)
+	server.enableLoopbackAnswers("MyHost")
+
+	query := func(name string, qtype uint16) *dns.Msg {
+		t.Helper()
+		w := &test.MockResponseWriter{}
+		server.handlerChain.ServeDNS(w, new(dns.Msg).SetQuestion(name, qtype))
+		resp := w.GetLastResponse()
+		require.NotNil(t, resp)
+		return resp
+	}
+
+	tests := []struct {
+		name   string
+		qname  string
+		qtype  uint16
+		expect string
+	}{
+		{name: "localhost A", qname: "localhost.", qtype: dns.TypeA, expect: "127.0.0.1"},
+		{name: "localhost AAAA", qname: "localhost.", qtype: dns.TypeAAAA, expect: "::1"},
+		{name: "localhost subdomain", qname: "app.LocalHost.", qtype: dns.TypeA, expect: "127.0.0.1"},
+		{name: "localhost other type", qname: "localhost.", qtype: dns.TypeMX},
+		{name: "hostname A", qname: "myhost.", qtype: dns.TypeA, expect: "100.66.100.1"},
+		{name: "hostname AAAA without tunnel IPv6", qname: "myhost.", qtype: dns.TypeAAAA},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			resp := query(tc.qname, tc.qtype)
+			assert.Equal(t, dns.RcodeSuccess, resp.Rcode)
+			if tc.expect == "" {
+				assert.Empty(t, resp.Answer, "expected NODATA")
+				return
+			}
+			require.Len(t, resp.Answer, 1)
+			switch rr := resp.Answer[0].(type) {
+			case *dns.A:
+				assert.Equal(t, tc.expect, rr.A.String())
+			case *dns.AAAA:
+				assert.Equal(t, tc.expect, rr.AAAA.String())
+			default:
+				t.Fatalf("unexpected record %s", rr)
+			}
+		})
+	}
+
+	// Subdomains of the hostname aren't answered.
+	assert.Equal(t, dns.RcodeRefused, query("sub.myhost.", dns.TypeA).Rcode)
+}
+
+func TestLoopbackResolver_CustomZoneWins(t *testing.T) {
+	server := newTestServer(nil)
+	server.enableLoopbackAnswers("myhost")
+
+	require.NoError(t, server.UpdateDNSServer(1, nbdns.Config{
+		ServiceEnable: true,
+		CustomZones: []nbdns.CustomZone{{
+			Domain: "localhost.",
+			Records: []nbdns.SimpleRecord{
+				{Name: "dev.localhost.", Type: int(dns.TypeA), Class: nbdns.DefaultClass, TTL: 300, RData: "100.64.0.20"},
+			},
+		}},
+	}))
+
+	w := &test.MockResponseWriter{}
+	server.handlerChain.ServeDNS(w, new(dns.Msg).SetQuestion("dev.localhost.", dns.TypeA))
+	resp := w.GetLastResponse()
+	require.NotNil(t, resp)
+	require.Len(t, resp.Answer, 1)
+	assert.Equal(t, "100.64.0.20", resp.Answer[0].(*dns.A).A.String(), "a localhost custom zone must not be shadowed")
+}
@@ -0,0 +1,85 @@
+package dns
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+// MatchLatencyBuckets are the upper bounds of the MatchStats histogram.
+var MatchLatencyBuckets = [...]time.Duration{
+	time.Microsecond,
+	10 * time.Microsecond,
+	100 * time.Microsecond,
+	time.Millisecond,
+}
+
+// MatchStats summarizes the time the handler chain spent selecting the
+// handlers of queries, excluding the time the handlers took to answer.
+type MatchStats struct {
+	Queries uint64
+	Total   time.Duration
+	Max     time.Duration
+	// Buckets counts the queries per match time: Buckets[i] those below
+	// MatchLatencyBuckets[i] and not counted before, the last one those
+	// above every bound.
+	Buckets []uint64
+}
+
+// Mean returns the average match time per query.
+func (s MatchStats) Mean() time.Duration {
+	if s.Queries == 0 {
+		return 0
+	}
+	return s.Total / time.Duration(s.Queries)
+}
+
+// matchStats accumulates MatchStats without locking, as it is updated on
+// every query.
+type matchStats struct {
+	queries atomic.Uint64
+	total   atomic.Int64
+	max     atomic.Int64
+	buckets [len(MatchLatencyBuckets) + 1]atomic.Uint64
+}
+
+func (m *matchStats) record(d time.Duration) {
+	m.queries.Add(1)
+	m.total.Add(int64(d))
+	for {
+		current := m.max.Load()
+		if int64(d) <= current || m.max.CompareAndSwap(current, int64(d)) {
+			break
+		}
+	}
+
+	i := 0
+	for i < len(MatchLatencyBuckets) && d >= MatchLatencyBuckets[i] {
+		i++
+	}
+	m.buckets[i].Add(1)
+}
+
+func (m *matchStats) snapshot() MatchStats {
+	stats := MatchStats{
+		Queries: m.queries.Load(),
+		Total:   time.Duration(m.total.Load()),
+		Max:     time.Duration(m.max.Load()),
+		Buckets: make([]uint64, len(m.buckets)),
+	}
+	for i := range m.buckets {
+		stats.Buckets[i] = m.buckets[i].Load()
+	}
+	return stats
+}
+
+// MatchStats returns the time spent selecting handlers since the chain was
+// created, so operators can tell whether matching adds to query latency.
+func (c *HandlerChain) MatchStats() MatchStats {
+	return c.matchStats.snapshot()
+}
+
+// MatchStats returns the time the handler chain spent selecting handlers,
+// see HandlerChain.MatchStats.
+func (s *DefaultServer) MatchStats() MatchStats {
+	return s.handlerChain.MatchStats()
+}
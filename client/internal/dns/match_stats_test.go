@@ -0,0 +1,102 @@
+package dns
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/miekg/dns"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+
+	"github.com/netbirdio/netbird/client/internal/dns/test"
+)
+
+func TestMatchStats_Record(t *testing.T) {
+	var m matchStats
+	for _, d := range []time.Duration{
+		500 * time.Nanosecond,
+		time.Microsecond,
+		50 * time.Microsecond,
+		2 * time.Millisecond,
+		3 * time.Millisecond,
+	} {
+		m.record(d)
+	}
+
+	stats := m.snapshot()
+	assert.Equal(t, uint64(5), stats.Queries)
+	assert.Equal(t, 3*time.Millisecond, stats.Max)
+	assert.Equal(t, 5051500*time.Nanosecond, stats.Total)
+	assert.Equal(t, stats.Total/5, stats.Mean())
+	assert.Equal(t, []uint64{1, 1, 1, 0, 2}, stats.Buckets, "bounds are exclusive")
+
+	assert.Zero(t, MatchStats{}.Mean())
+}
+
+func TestHandlerChain_MatchStats(t *testing.T) {
+	chain := NewHandlerChain()
+	answering := &MockHandler{}
+	answering.On("ServeDNS", mock.Anything, mock.Anything).Run(func(args mock.Arguments) {
+		w := args.Get(0).(dns.ResponseWriter)
+		r := args.Get(1).(*dns.Msg)
+		resp := new(dns.Msg).SetReply(r)
+		_ = w.WriteMsg(resp)
+	})
+	chain.AddHandler("example.com.", answering, PriorityUpstream)
+
+	query := func(name string) {
+		w := &test.MockResponseWriter{}
+		chain.ServeDNS(w, new(dns.Msg).SetQuestion(name, dns.TypeA))
+		require.NotNil(t, w.GetLastResponse())
+	}
+	query("example.com.")
+	query("unmatched.test.")
+
+	stats := chain.MatchStats()
+	assert.Equal(t, uint64(2), stats.Queries, "answered and unmatched queries are counted")
+	var bucketed uint64
+	for _, n := range stats.Buckets {
+		bucketed += n
+	}
+	assert.Equal(t, stats.Queries, bucketed)
+	assert.LessOrEqual(t, stats.Max, stats.Total)
+}
+
+// BenchmarkHandlerChain_Match measures the chain's cost of selecting a
+// handler with many registered zones. The handlers answer immediately, so
+// the time is dominated by matching.
+func BenchmarkHandlerChain_Match(b *testing.B) {
+	answer := dns.HandlerFunc(func(w dns.ResponseWriter, r *dns.Msg) {
+		_ = w.WriteMsg(new(dns.Msg).SetReply(r))
+	})
+
+	for _, zones := range []int{10, 100, 500, 1000} {
+		chain := NewHandlerChain()
+		for i := range zones {
+			chain.AddHandler(fmt.Sprintf("zone%d.example.com.", i), answer, PriorityUpstream)
+		}
+		chain.AddHandler(".", answer, PriorityDefault)
+
+		for _, tc := range []struct {
+			name  string
+			qname string
+		}{
+			{"first", "zone0.example.com."},
+			{"last", fmt.Sprintf("zone%d.example.com.", zones-1)},
+			{"root", "unrelated.test."},
+		} {
+			r := new(dns.Msg).SetQuestion(tc.qname, dns.TypeA)
+			b.Run(fmt.Sprintf("zones=%d/%s", zones, tc.name), func(b *testing.B) {
+				w := &test.MockResponseWriter{}
+				b.ReportAllocs()
+				for b.Loop() {
+					chain.ServeDNS(w, r)
+				}
+				stats := chain.MatchStats()
+				b.ReportMetric(float64(stats.Mean().Nanoseconds()), "match-ns/op")
+			})
+		}
+	}
+}
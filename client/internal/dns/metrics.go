@@ -0,0 +1,131 @@
+package dns
+
+import (
+	"errors"
+	"time"
+
+	"github.com/miekg/dns"
+	"github.com/prometheus/client_golang/prometheus"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	metricsNamespace = "netbird"
+	metricsSubsystem = "dns"
+
+	// unmatchedDomain labels the queries no handler answered.
+	unmatchedDomain = "none"
+)
+
+// dnsMetrics holds the Prometheus collectors of the DNS server. A nil
+// *dnsMetrics records nothing.
+type dnsMetrics struct {
+	queries            *prometheus.CounterVec
+	upstreamLatency    *prometheus.HistogramVec
+	cacheLookups       *prometheus.CounterVec
+	groupDeactivations prometheus.Counter
+}
+
+// newDNSMetrics registers the DNS server collectors with reg. Collectors
+// already registered, e.g. by the DNS server of a previous engine, are
+// reused. A nil reg disables the metrics.
+func newDNSMetrics(reg prometheus.Registerer) *dnsMetrics {
+	if reg == nil {
+		return nil
+	}
+
+	return &dnsMetrics{
+		queries: registerCollector(reg, prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: metricsNamespace,
+			Subsystem: metricsSubsystem,
+			Name:      "queries_total",
+			Help:      "DNS queries answered, by the domain pattern of the answering handler and rcode.",
+		}, []string{"domain", "rcode"})),
+		upstreamLatency: registerCollector(reg, prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: metricsNamespace,
+			Subsystem: metricsSubsystem,
+			Name:      "upstream_duration_seconds",
+			Help:      "Time upstream nameservers took to answer, by handler domain.",
+			Buckets:   []float64{.001, .005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5},
+		}, []string{"domain"})),
+		cacheLookups: registerCollector(reg, prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: metricsNamespace,
+			Subsystem: metricsSubsystem,
+			Name:      "cache_lookups_total",
+			Help:      "Response cache lookups of upstream handlers, by result.",
+		}, []string{"result"})),
+		groupDeactivations: registerCollector(reg, prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: metricsNamespace,
+			Subsystem: metricsSubsystem,
+			Name:      "nameserver_group_deactivations_total",
+			Help:      "Nameserver groups deactivated because their upstreams failed.",
+		})),
+	}
+}
+
+// registerCollector registers c with reg, returning the collector already
+// registered in its place if there is one.
+func registerCollector[T prometheus.Collector](reg prometheus.Registerer, c T) T {
+	err := reg.Register(c)
+	if err == nil {
+		return c
+	}
+
+	var registered prometheus.AlreadyRegisteredError
+	if errors.As(err, &registered) {
+		if existing, ok := registered.ExistingCollector.(T); ok {
+			return existing
+		}
+	}
+	log.Warnf("failed to register DNS metric: %v", err)
+	return c
+}
+
+func (m *dnsMetrics) recordQuery(domain string, rcode int) {
+	if m == nil {
+		return
+	}
+	if domain == "" {
+		domain = unmatchedDomain
+	}
+	m.queries.WithLabelValues(domain, rcodeLabel(rcode)).Inc()
+}
+
+func (m *dnsMetrics) recordUpstreamLatency(domain string, d time.Duration) {
+	if m == nil {
+		return
+	}
+	m.upstreamLatency.WithLabelValues(domain).Observe(d.Seconds())
+}
+
+func (m *dnsMetrics) recordCacheLookup(hit bool) {
+	if m == nil {
+		return
+	}
+	result := "miss"
+	if hit {
+		result = "hit"
+	}
+	m.cacheLookups.WithLabelValues(result).Inc()
+}
+
+func (m *dnsMetrics) recordGroupDeactivation() {
+	if m == nil {
+		return
+	}
+	m.groupDeactivations.Inc()
+}
+
+func rcodeLabel(rcode int) string {
+	if s, ok := dns.RcodeToString[rcode]; ok {
+		return s
+	}
+	return "UNKNOWN"
+}
+
+// setMetrics makes the chain count the queries it answers in m.
+func (c *HandlerChain) setMetrics(m *dnsMetrics) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.metrics = m
+}
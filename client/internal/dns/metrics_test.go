@@ -0,0 +1,93 @@
+package dns
+
+import (
+	"context"
+	"net/netip"
+	"testing"
+	"time"
+
+	"github.com/miekg/dns"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/netbirdio/netbird/client/internal/dns/test"
+)
+
+func TestDNSMetrics_NilRegistererIsNoop(t *testing.T) {
+	m := newDNSMetrics(nil)
+	require.Nil(t, m)
+	assert.NotPanics(t, func() {
+		m.recordQuery("example.com.", dns.RcodeSuccess)
+		m.recordUpstreamLatency("example.com", time.Millisecond)
+		m.recordCacheLookup(true)
+		m.recordGroupDeactivation()
+	})
+}
+
+func TestDNSMetrics_ReusesRegisteredCollectors(t *testing.T) {
+	reg := prometheus.NewRegistry()
+	first := newDNSMetrics(reg)
+	second := newDNSMetrics(reg)
+
+	second.recordGroupDeactivation()
+	assert.Same(t, first.queries, second.queries, "a new server records to the collectors of the previous one")
+	assert.Equal(t, float64(1), testutil.ToFloat64(first.groupDeactivations))
+}
+
+func TestHandlerChain_CountsQueries(t *testing.T) {
+	m := newDNSMetrics(prometheus.NewRegistry())
+	chain := NewHandlerChain()
+	chain.setMetrics(m)
+	chain.AddHandler("example.com.", dns.HandlerFunc(func(w dns.ResponseWriter, r *dns.Msg) {
+		_ = w.WriteMsg(new(dns.Msg).SetReply(r))
+	}), PriorityUpstream)
+
+	for i := 0; i < 2; i++ {
+		chain.ServeDNS(&test.MockResponseWriter{}, new(dns.Msg).SetQuestion("host.example.com.", dns.TypeA))
+	}
+	chain.ServeDNS(&test.MockResponseWriter{}, new(dns.Msg).SetQuestion("other.test.", dns.TypeA))
+
+	assert.Equal(t, float64(2), testutil.ToFloat64(m.queries.WithLabelValues("example.com.", "NOERROR")))
+	assert.Equal(t, float64(1), testutil.ToFloat64(m.queries.WithLabelValues(unmatchedDomain, "REFUSED")))
+}
+
+func TestUpstreamResolver_RecordsMetrics(t *testing.T) {
+	upstream := netip.MustParseAddrPort("192.0.2.1:53")
+	m := newDNSMetrics(prometheus.NewRegistry())
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	resolver := &upstreamResolverBase{
+		ctx:             ctx,
+		cancel:          cancel,
+		upstreamClient:  &countingUpstream{},
+		upstreamTimeout: UpstreamTimeout,
+		domain:          "example.com",
+		metrics:         m,
+	}
+	resolver.addRace([]netip.AddrPort{upstream})
+	resolver.setResponseCache(16)
+
+	for i := 0; i < 2; i++ {
+		resolver.ServeDNS(&test.MockResponseWriter{}, new(dns.Msg).SetQuestion("host.example.com.", dns.TypeA))
+	}
+
+	assert.Equal(t, float64(1), testutil.ToFloat64(m.cacheLookups.WithLabelValues("miss")))
+	assert.Equal(t, float64(1), testutil.ToFloat64(m.cacheLookups.WithLabelValues("hit")))
+	assert.Equal(t, 1, testutil.CollectAndCount(m.upstreamLatency), "one upstream answer was timed")
+}
+
+func TestDefaultServer_CountsGroupDeactivations(t *testing.T) {
+	fx := newProjTestFixture(t)
+	fx.server.metrics = newDNSMetrics(prometheus.NewRegistry())
+
+	fx.setHealth(UpstreamHealth{LastFail: time.Now(), LastErr: "timeout"})
+	fx.tick()
+	fx.tick()
+	fx.setHealth(UpstreamHealth{LastOk: time.Now()})
+	fx.tick()
+
+	assert.Equal(t, float64(1), testutil.ToFloat64(fx.server.metrics.groupDeactivations))
+}
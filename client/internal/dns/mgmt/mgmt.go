@@ -8,6 +8,7 @@ import (
 	"net/url"
 	"os"
 	"slices"
+	"strconv"
 	"strings"
 	"sync"
 	"sync/atomic"
@@ -29,6 +30,8 @@ const (
 
 	// envMgmtCacheTTL overrides defaultTTL for integration/dev testing.
 	envMgmtCacheTTL = "NB_MGMT_CACHE_TTL"
+	// envMgmtCachePinned opts into pinned mode, see Resolver.SetPinned.
+	envMgmtCachePinned = "NB_MGMT_CACHE_PINNED"
 )
 
 // ChainResolver lets the cache refresh stale entries through the DNS handler
@@ -78,6 +81,11 @@ type Resolver struct {
 	refreshing map[dns.Question]*atomic.Bool
 
 	cacheTTL time.Duration
+
+	// pinned serves the records learned during login and server-domain
+	// updates as static answers: no stale-while-revalidate refresh through
+	// the upstream chain. Guarded by mutex.
+	pinned bool
 }
 
 // NewResolver creates a new management domains cache resolver.
@@ -87,6 +95,7 @@ func NewResolver() *Resolver {
 		refreshing:     make(map[dns.Question]*atomic.Bool),
 		failedResolves: make(map[domain.Domain]time.Time),
 		cacheTTL:       resolveCacheTTL(),
+		pinned:         resolvePinned(),
 	}
 }
 
@@ -106,6 +115,24 @@ func (m *Resolver) SetChainResolver(chain ChainResolver, maxPriority int) {
 	m.mutex.Unlock()
 }
 
+// SetPinned toggles pinned mode. Pinned records are only replaced when the
+// infrastructure endpoints are re-learned (login, server-domain updates), so
+// control-plane names keep resolving even while no upstream is reachable.
+// It applies to every name the resolver caches: the management host and the
+// signal, relay, STUN and TURN hosts.
+func (m *Resolver) SetPinned(pinned bool) {
+	m.mutex.Lock()
+	m.pinned = pinned
+	m.mutex.Unlock()
+}
+
+// Pinned reports whether the resolver serves its records as static answers.
+func (m *Resolver) Pinned() bool {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+	return m.pinned
+}
+
 // ServeDNS serves cached A/AAAA records. Stale entries are returned
 // immediately and refreshed asynchronously (stale-while-revalidate).
 func (m *Resolver) ServeDNS(w dns.ResponseWriter, r *dns.Msg) {
@@ -125,8 +152,9 @@ func (m *Resolver) ServeDNS(w dns.ResponseWriter, r *dns.Msg) {
 	m.mutex.RLock()
 	cached, found := m.records[question]
 	inflight := m.refreshing[question]
+	pinned := m.pinned
 	var shouldRefresh bool
-	if found {
+	if found && !pinned {
 		stale := time.Since(cached.cachedAt) > m.cacheTTL
 		inBackoff := !cached.lastFailedRefresh.IsZero() && time.Since(cached.lastFailedRefresh) < refreshBackoff
 		shouldRefresh = stale && !inBackoff
@@ -154,7 +182,11 @@ func (m *Resolver) ServeDNS(w dns.ResponseWriter, r *dns.Msg) {
 	resp.SetReply(r)
 	resp.Authoritative = false
 	resp.RecursionAvailable = true
-	resp.Answer = cloneRecordsWithTTL(cached.records, m.responseTTL(cached.cachedAt))
+	ttl := m.responseTTL(cached.cachedAt)
+	if pinned {
+		ttl = uint32(m.cacheTTL.Seconds())
+	}
+	resp.Answer = cloneRecordsWithTTL(cached.records, ttl)
 
 	log.Debugf("serving %d cached records for domain=%s", len(resp.Answer), question.Name)
 
@@ -777,3 +809,18 @@ func resolveCacheTTL() time.Duration {
 	}
 	return defaultTTL
 }
+
+// resolvePinned reads the pinned-mode opt-in env var; anything that doesn't
+// parse as true leaves pinned mode off.
+func resolvePinned() bool {
+	v := os.Getenv(envMgmtCachePinned)
+	if v == "" {
+		return false
+	}
+	pinned, err := strconv.ParseBool(v)
+	if err != nil {
+		log.Warnf("invalid %s value %q, pinned mgmt cache disabled", envMgmtCachePinned, v)
+		return false
+	}
+	return pinned
+}
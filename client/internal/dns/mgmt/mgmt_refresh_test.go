@@ -417,3 +417,30 @@ func TestResolver_AddDomain_UsesChainWhenRootRegistered(t *testing.T) {
 	assert.Equal(t, 1, chain.callCount("mgmt.example.com.", dns.TypeA))
 	assert.Equal(t, 1, chain.callCount("mgmt.example.com.", dns.TypeAAAA))
 }
+
+func TestResolver_PinnedSkipsRefresh(t *testing.T) {
+	r := NewResolver()
+	r.SetPinned(true)
+	chain := newFakeChain()
+	chain.setAnswer("mgmt.example.com.", dns.TypeA, "10.0.0.2")
+	r.SetChainResolver(chain, 50)
+
+	q := dns.Question{Name: "mgmt.example.com.", Qtype: dns.TypeA, Qclass: dns.ClassINET}
+	r.records[q] = &cachedRecord{
+		records: []dns.RR{&dns.A{
+			Hdr: dns.RR_Header{Name: q.Name, Rrtype: dns.TypeA, Class: dns.ClassINET, Ttl: 60},
+			A:   net.ParseIP("10.0.0.1").To4(),
+		}},
+		cachedAt: time.Now().Add(-2 * defaultTTL), // stale
+	}
+
+	resp := queryA(t, r, "mgmt.example.com.")
+	assert.Equal(t, "10.0.0.1", firstA(t, resp), "pinned entry must be served as-is")
+	assert.Equal(t, uint32(r.cacheTTL.Seconds()), resp.Answer[0].Header().Ttl, "pinned entry must not report an expired TTL")
+
+	// A scheduled refresh stays registered in refreshGroup until it finishes,
+	// so a Do on the same key either joins it or proves none was scheduled.
+	_, _, shared := r.refreshGroup.Do("mgmt.example.com.|A", func() (any, error) { return nil, nil })
+	assert.False(t, shared, "pinned entry must not schedule a refresh")
+	assert.Equal(t, 0, chain.callCount("mgmt.example.com.", dns.TypeA), "pinned entry must not trigger refresh")
+}
@@ -1,6 +1,7 @@
 package dns
 
 import (
+	"context"
 	"fmt"
 	"net/netip"
 	"net/url"
@@ -16,23 +17,38 @@ import (
 
 // MockServer is the mock instance of a dns server
 type MockServer struct {
-	InitializeFunc         func() error
-	StopFunc               func()
-	UpdateDNSServerFunc    func(serial uint64, update nbdns.Config) error
-	RegisterHandlerFunc    func(domain.List, dns.Handler, int)
-	DeregisterHandlerFunc  func(domain.List, int)
-	UpdateServerConfigFunc func(domains dnsconfig.ServerDomains) error
+	InitializeFunc          func() error
+	StopFunc                func()
+	UpdateDNSServerFunc     func(serial uint64, update nbdns.Config) error
+	RegisterHandlerFunc     func(domain.List, dns.Handler, int, ...uint16)
+	RegisterHandlerCtxFunc  func(context.Context, domain.List, dns.Handler, int, ...uint16)
+	DeregisterHandlerFunc   func(domain.List, int, ...uint16)
+	RegisterPassthroughFunc func(domain.List, int)
+	UpdateServerConfigFunc  func(domains dnsconfig.ServerDomains) error
+	DnsStatsFunc            func() DnsStats
+}
+
+func (m *MockServer) RegisterHandler(domains domain.List, handler dns.Handler, priority int, qtypes ...uint16) {
+	if m.RegisterHandlerFunc != nil {
+		m.RegisterHandlerFunc(domains, handler, priority, qtypes...)
+	}
 }
 
-func (m *MockServer) RegisterHandler(domains domain.List, handler dns.Handler, priority int) {
-	if m.RegisterHandlerFunc != nil {
-		m.RegisterHandlerFunc(domains, handler, priority)
+func (m *MockServer) RegisterHandlerContext(ctx context.Context, domains domain.List, handler dns.Handler, priority int, qtypes ...uint16) {
+	if m.RegisterHandlerCtxFunc != nil {
+		m.RegisterHandlerCtxFunc(ctx, domains, handler, priority, qtypes...)
 	}
 }
 
-func (m *MockServer) DeregisterHandler(domains domain.List, priority int) {
+func (m *MockServer) DeregisterHandler(domains domain.List, priority int, qtypes ...uint16) {
 	if m.DeregisterHandlerFunc != nil {
-		m.DeregisterHandlerFunc(domains, priority)
+		m.DeregisterHandlerFunc(domains, priority, qtypes...)
+	}
+}
+
+func (m *MockServer) RegisterPassthrough(domains domain.List, priority int) {
+	if m.RegisterPassthroughFunc != nil {
+		m.RegisterPassthroughFunc(domains, priority)
 	}
 }
 
@@ -112,3 +128,26 @@ func (m *MockServer) EndBatch() {
 func (m *MockServer) CancelBatch() {
 	// Mock implementation - no-op
 }
+
+// Freeze mock implementation of Freeze from Server interface
+func (m *MockServer) Freeze() {
+	// Mock implementation - no-op
+}
+
+// Unfreeze mock implementation of Unfreeze from Server interface
+func (m *MockServer) Unfreeze() error {
+	return nil
+}
+
+// BypassDNS mock implementation of BypassDNS from Server interface
+func (m *MockServer) BypassDNS(bool) error {
+	return nil
+}
+
+// DnsStats mock implementation of DnsStats from Server interface
+func (m *MockServer) DnsStats() DnsStats {
+	if m.DnsStatsFunc != nil {
+		return m.DnsStatsFunc()
+	}
+	return DnsStats{}
+}
@@ -0,0 +1,122 @@
+package dns
+
+import (
+	"net/netip"
+	"slices"
+
+	"github.com/netbirdio/netbird/client/internal/dns/types"
+)
+
+// MuxHandler describes a handler registered for a domain by a config update.
+type MuxHandler struct {
+	Domain   string
+	Priority int
+	// Upstreams are the nameservers the handler forwards to, empty for
+	// handlers answering locally.
+	Upstreams []netip.AddrPort
+}
+
+// MuxChange is the difference between the handlers registered before and
+// after a config update. A handler whose upstreams changed is reported as
+// removed and added.
+type MuxChange struct {
+	Added   []MuxHandler
+	Removed []MuxHandler
+}
+
+// upstreamLister is implemented by handlers that forward to nameservers.
+type upstreamLister interface {
+	flatUpstreams() []netip.AddrPort
+}
+
+// muxHandlerKey identifies a registration across updates. The handler ID
+// covers the upstream set, so a changed server list produces a new key.
+type muxHandlerKey struct {
+	domain   string
+	priority int
+	id       types.HandlerID
+}
+
+// SubscribeMuxChanges registers fn to be called after every config update
+// that changed the registered handlers, e.g. so the firewall can allow
+// traffic to newly configured nameservers. fn runs synchronously with the
+// server lock held and must not call back into the server. A nil fn is
+// ignored. The returned function removes the subscription.
+func (s *DefaultServer) SubscribeMuxChanges(fn func(MuxChange)) (unsubscribe func()) {
+	if fn == nil {
+		return func() {}
+	}
+
+	s.muxObserversMu.Lock()
+	defer s.muxObserversMu.Unlock()
+	if s.muxObservers == nil {
+		s.muxObservers = make(map[int]func(MuxChange))
+	}
+	id := s.nextMuxObserverID
+	s.nextMuxObserverID++
+	s.muxObservers[id] = fn
+
+	return func() {
+		s.muxObserversMu.Lock()
+		defer s.muxObserversMu.Unlock()
+		delete(s.muxObservers, id)
+	}
+}
+
+// notifyMuxChange reports the difference between the old and new handler
+// sets to subscribers. Must be called with s.mux held.
+func (s *DefaultServer) notifyMuxChange(old, updated []handlerWrapper) {
+	s.muxObserversMu.Lock()
+	observers := make([]func(MuxChange), 0, len(s.muxObservers))
+	for _, fn := range s.muxObservers {
+		observers = append(observers, fn)
+	}
+	s.muxObserversMu.Unlock()
+	if len(observers) == 0 {
+		return
+	}
+
+	change := diffMuxHandlers(old, updated)
+	if len(change.Added) == 0 && len(change.Removed) == 0 {
+		return
+	}
+	for _, fn := range observers {
+		fn(change)
+	}
+}
+
+func diffMuxHandlers(old, updated []handlerWrapper) MuxChange {
+	oldKeys := make(map[muxHandlerKey]struct{}, len(old))
+	for _, h := range old {
+		oldKeys[newMuxHandlerKey(h)] = struct{}{}
+	}
+	newKeys := make(map[muxHandlerKey]struct{}, len(updated))
+	for _, h := range updated {
+		newKeys[newMuxHandlerKey(h)] = struct{}{}
+	}
+
+	var change MuxChange
+	for _, h := range updated {
+		if _, ok := oldKeys[newMuxHandlerKey(h)]; !ok {
+			change.Added = append(change.Added, toMuxHandler(h))
+		}
+	}
+	for _, h := range old {
+		if _, ok := newKeys[newMuxHandlerKey(h)]; !ok {
+			change.Removed = append(change.Removed, toMuxHandler(h))
+		}
+	}
+	return change
+}
+
+func newMuxHandlerKey(h handlerWrapper) muxHandlerKey {
+	return muxHandlerKey{domain: h.domain, priority: h.priority, id: h.handler.ID()}
+}
+
+func toMuxHandler(h handlerWrapper) MuxHandler {
+	mh := MuxHandler{Domain: h.domain, Priority: h.priority}
+	if l, ok := h.handler.(upstreamLister); ok {
+		mh.Upstreams = slices.Clone(l.flatUpstreams())
+	}
+	return mh
+}
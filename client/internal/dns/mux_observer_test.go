@@ -0,0 +1,69 @@
+package dns
+
+import (
+	"net/netip"
+	"testing"
+
+	"github.com/miekg/dns"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	nbdns "github.com/netbirdio/netbird/dns"
+)
+
+func TestDefaultServer_SubscribeMuxChanges(t *testing.T) {
+	server := newTestServer(nil)
+
+	var changes []MuxChange
+	unsubscribe := server.SubscribeMuxChanges(func(c MuxChange) {
+		changes = append(changes, c)
+	})
+	assert.NotNil(t, server.SubscribeMuxChanges(nil), "nil subscriptions must be ignored")
+
+	zone := nbdns.CustomZone{
+		Domain: "netbird.cloud.",
+		Records: []nbdns.SimpleRecord{
+			{Name: "peer.netbird.cloud.", Type: int(dns.TypeA), Class: nbdns.DefaultClass, TTL: 300, RData: "100.64.0.1"},
+		},
+	}
+	nsGroup := func(ip string) *nbdns.NameServerGroup {
+		return &nbdns.NameServerGroup{
+			NameServers: []nbdns.NameServer{{IP: netip.MustParseAddr(ip), NSType: nbdns.UDPNameServerType, Port: 53}},
+			Domains:     []string{"corp.example.com"},
+			Enabled:     true,
+		}
+	}
+	configWith := func(groups ...*nbdns.NameServerGroup) nbdns.Config {
+		return nbdns.Config{
+			ServiceEnable:    true,
+			CustomZones:      []nbdns.CustomZone{zone},
+			NameServerGroups: groups,
+		}
+	}
+
+	require.NoError(t, server.UpdateDNSServer(1, configWith(nsGroup("192.0.2.1"))))
+	require.Len(t, changes, 1)
+	assert.ElementsMatch(t, []MuxHandler{
+		{Domain: "netbird.cloud.", Priority: PriorityLocal},
+		{Domain: "corp.example.com", Priority: PriorityUpstream, Upstreams: []netip.AddrPort{netip.MustParseAddrPort("192.0.2.1:53")}},
+	}, changes[0].Added)
+	assert.Empty(t, changes[0].Removed)
+
+	// Only the nameserver changes; the local zone stays registered.
+	require.NoError(t, server.UpdateDNSServer(2, configWith(nsGroup("192.0.2.2"))))
+	require.Len(t, changes, 2)
+	assert.Equal(t, []MuxHandler{
+		{Domain: "corp.example.com", Priority: PriorityUpstream, Upstreams: []netip.AddrPort{netip.MustParseAddrPort("192.0.2.2:53")}},
+	}, changes[1].Added)
+	assert.Equal(t, []MuxHandler{
+		{Domain: "corp.example.com", Priority: PriorityUpstream, Upstreams: []netip.AddrPort{netip.MustParseAddrPort("192.0.2.1:53")}},
+	}, changes[1].Removed)
+
+	// Unchanged handlers produce no notification.
+	require.NoError(t, server.UpdateDNSServer(3, configWith(nsGroup("192.0.2.2"))))
+	assert.Len(t, changes, 2)
+
+	unsubscribe()
+	require.NoError(t, server.UpdateDNSServer(4, configWith()))
+	assert.Len(t, changes, 2, "no callbacks after unsubscribe")
+}
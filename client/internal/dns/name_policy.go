@@ -0,0 +1,87 @@
+package dns
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/miekg/dns"
+)
+
+// CaseFolding selects how NamePolicy case-folds names.
+type CaseFolding int
+
+const (
+	// FoldASCII folds the ASCII letters A-Z to lowercase, the way DNS
+	// compares names (RFC 4343). Escaped octets are left alone. The default.
+	FoldASCII CaseFolding = iota
+	// FoldNone keeps names as given, so handlers only match queries
+	// spelling their domain with the same case.
+	FoldNone
+)
+
+// NamePolicy normalizes names to the form handlers are matched in. The
+// handler chain applies the same policy to the patterns handlers are added
+// and removed with and to the names of queries, so the two never disagree.
+// The zero value is fully qualified names folded with FoldASCII.
+type NamePolicy struct {
+	CaseFolding CaseFolding
+}
+
+// ParseNamePolicy returns the policy for the case folding "ascii" or "none".
+// An empty one folds ASCII like before.
+func ParseNamePolicy(caseFolding string) (NamePolicy, error) {
+	switch strings.ToLower(caseFolding) {
+	case "", "ascii":
+		return NamePolicy{CaseFolding: FoldASCII}, nil
+	case "none":
+		return NamePolicy{CaseFolding: FoldNone}, nil
+	default:
+		return NamePolicy{}, fmt.Errorf("unknown name case folding %q", caseFolding)
+	}
+}
+
+// Normalize returns name fully qualified, with a trailing dot, and
+// case-folded according to the policy.
+func (p NamePolicy) Normalize(name string) string {
+	name = dns.Fqdn(name)
+	if p.CaseFolding == FoldNone {
+		return name
+	}
+	return foldASCII(name)
+}
+
+// foldASCII returns s with A-Z lowercased, without copying s if it has none.
+func foldASCII(s string) string {
+	for i := 0; i < len(s); i++ {
+		if isUpperASCII(s[i]) {
+			b := []byte(s)
+			for j := i; j < len(b); j++ {
+				if isUpperASCII(b[j]) {
+					b[j] += 'a' - 'A'
+				}
+			}
+			return string(b)
+		}
+	}
+	return s
+}
+
+func isUpperASCII(c byte) bool {
+	return 'A' <= c && c <= 'Z'
+}
+
+// SetNamePolicy sets how handler patterns and query names are normalized
+// before they are matched. Handlers added before keep the patterns they were
+// normalized to, so it's set before any are added.
+func (c *HandlerChain) SetNamePolicy(policy NamePolicy) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.names = policy
+}
+
+// NormalizeName returns name in the form the chain matches handlers in.
+func (c *HandlerChain) NormalizeName(name string) string {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.names.Normalize(name)
+}
@@ -0,0 +1,133 @@
+package dns
+
+import (
+	"context"
+	"testing"
+
+	"github.com/miekg/dns"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+
+	"github.com/netbirdio/netbird/client/internal/dns/test"
+	"github.com/netbirdio/netbird/client/internal/peer"
+	"github.com/netbirdio/netbird/shared/management/domain"
+)
+
+func TestNamePolicy_Normalize(t *testing.T) {
+	tests := []struct {
+		name   string
+		folded string
+		kept   string
+	}{
+		{name: "example.com", folded: "example.com.", kept: "example.com."},
+		{name: "example.com.", folded: "example.com.", kept: "example.com."},
+		{name: "Example.COM", folded: "example.com.", kept: "Example.COM."},
+		{name: "WWW.Example.Com.", folded: "www.example.com.", kept: "WWW.Example.Com."},
+		{name: "*.Corp.Example", folded: "*.corp.example.", kept: "*.Corp.Example."},
+		{name: `A\065.example.`, folded: `a\065.example.`, kept: `A\065.example.`},
+		{name: "xn--BCHER-kva.example", folded: "xn--bcher-kva.example.", kept: "xn--BCHER-kva.example."},
+		{name: ".", folded: ".", kept: "."},
+		{name: "", folded: ".", kept: "."},
+	}
+	for _, tt := range tests {
+		assert.Equal(t, tt.folded, NamePolicy{}.Normalize(tt.name), "folded %q", tt.name)
+		assert.Equal(t, tt.kept, NamePolicy{CaseFolding: FoldNone}.Normalize(tt.name), "kept %q", tt.name)
+	}
+}
+
+func TestHandlerChain_NamePolicyRouting(t *testing.T) {
+	tests := []struct {
+		name    string
+		policy  NamePolicy
+		pattern string
+		query   string
+		match   bool
+	}{
+		{name: "mixed case pattern", pattern: "Corp.Example.COM", query: "corp.example.com.", match: true},
+		{name: "mixed case query", pattern: "corp.example.com.", query: "CORP.Example.com.", match: true},
+		{name: "query without trailing dot", pattern: "corp.example.com.", query: "Corp.Example.Com", match: true},
+		{name: "pattern without trailing dot", pattern: "corp.example.com", query: "corp.example.com.", match: true},
+		{name: "mixed case wildcard", pattern: "*.Corp.Example.com", query: "WWW.corp.EXAMPLE.com.", match: true},
+		{name: "other domain", pattern: "corp.example.com.", query: "example.com.", match: false},
+		{name: "case kept, same case", policy: NamePolicy{CaseFolding: FoldNone}, pattern: "Corp.Example.com", query: "Corp.Example.com.", match: true},
+		{name: "case kept, other case", policy: NamePolicy{CaseFolding: FoldNone}, pattern: "Corp.Example.com", query: "corp.example.com.", match: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			chain := NewHandlerChain()
+			chain.SetNamePolicy(tt.policy)
+
+			var called bool
+			handler := &MockHandler{}
+			handler.On("ServeDNS", mock.Anything, mock.Anything).Run(func(mock.Arguments) {
+				called = true
+			}).Return()
+			chain.AddHandler(tt.pattern, handler, PriorityUpstream)
+
+			pattern := chain.NormalizeName(tt.pattern)
+			assert.Equal(t, pattern, chain.handlers[0].OrigPattern, "the pattern is registered normalized")
+			if !tt.match {
+				assert.NotEqual(t, pattern, chain.NormalizeName(tt.query))
+			}
+
+			r := new(dns.Msg).SetQuestion(tt.query, dns.TypeA)
+			chain.ServeDNS(&test.MockResponseWriter{}, r)
+			assert.Equal(t, tt.match, called)
+		})
+	}
+}
+
+func TestHandlerChain_NamePolicyRemoval(t *testing.T) {
+	chain := NewHandlerChain()
+	chain.AddHandler("Corp.Example.com", &MockHandler{}, PriorityUpstream)
+	chain.RemoveHandler("corp.EXAMPLE.com.", PriorityUpstream)
+	assert.Empty(t, chain.handlers, "the handler is removed whichever way the pattern is written")
+
+	chain = NewHandlerChain()
+	chain.SetNamePolicy(NamePolicy{CaseFolding: FoldNone})
+	chain.AddHandler("Corp.Example.com", &MockHandler{}, PriorityUpstream)
+	chain.AddHandler("corp.example.com", &MockHandler{}, PriorityUpstream)
+	require.Len(t, chain.handlers, 2, "patterns differing in case are distinct")
+	chain.RemoveHandler("Corp.Example.com.", PriorityUpstream)
+	require.Len(t, chain.handlers, 1)
+	assert.Equal(t, "corp.example.com.", chain.handlers[0].OrigPattern)
+}
+
+func TestDefaultServer_ExtraHandlerKeyFollowsNamePolicy(t *testing.T) {
+	server := newTestServer(nil)
+	assert.Equal(t, server.extraHandlerKey("Corp.Example.com", PriorityDNSRoute), server.extraHandlerKey("corp.example.com.", PriorityDNSRoute))
+
+	assert.Equal(t, server.toZone("corp.example.com"), server.toZone("Corp.Example.com."))
+
+	server.handlerChain.SetNamePolicy(NamePolicy{CaseFolding: FoldNone})
+	assert.NotEqual(t, server.extraHandlerKey("Corp.Example.com", PriorityDNSRoute), server.extraHandlerKey("corp.example.com.", PriorityDNSRoute))
+	assert.Equal(t, domain.Domain("Corp.Example.com."), server.toZone("*.Corp.Example.com"), "host zones follow the policy too")
+}
+
+func TestParseNamePolicy(t *testing.T) {
+	for input, want := range map[string]CaseFolding{
+		"":      FoldASCII,
+		"ascii": FoldASCII,
+		"None":  FoldNone,
+	} {
+		policy, err := ParseNamePolicy(input)
+		require.NoError(t, err, input)
+		assert.Equal(t, want, policy.CaseFolding, input)
+	}
+	_, err := ParseNamePolicy("unicode")
+	assert.Error(t, err)
+}
+
+func TestNewDefaultServer_NamePolicy(t *testing.T) {
+	server, err := NewDefaultServer(context.Background(), DefaultServerConfig{
+		WgInterface:    &mocWGIface{},
+		StatusRecorder: peer.NewRecorder("mgm"),
+		NamePolicy:     NamePolicy{CaseFolding: FoldNone},
+	})
+	require.NoError(t, err)
+	t.Cleanup(server.ctxCancel)
+
+	assert.Equal(t, "Corp.Example.com.", server.handlerChain.NormalizeName("Corp.Example.com"))
+	assert.Equal(t, domain.Domain("Corp.Example.com."), server.toZone("Corp.Example.com"))
+}
@@ -0,0 +1,162 @@
+package dns
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"io"
+	"math"
+	"net"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/miekg/dns"
+	log "github.com/sirupsen/logrus"
+)
+
+// NetResolver returns a *net.Resolver sending its queries through the
+// handler chain in process, so lookups of Go code embedding NetBird resolve
+// like those of the host, without going through the OS or the network.
+// The hosts file and the search domains of the host still apply, as for
+// any pure Go resolver.
+func (s *DefaultServer) NetResolver() *net.Resolver {
+	return &net.Resolver{
+		PreferGo: true,
+		Dial:     s.DialResolver,
+	}
+}
+
+// DialResolver is a net.Resolver Dial function connecting to the handler
+// chain instead of address. The returned connection speaks DNS over TCP
+// framing, whatever network is asked for.
+func (s *DefaultServer) DialResolver(ctx context.Context, _, _ string) (net.Conn, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	return &chainConn{
+		resolve: func(ctx context.Context, r *dns.Msg) (*dns.Msg, error) {
+			return s.handlerChain.ResolveInternal(ctx, r, math.MaxInt)
+		},
+	}, nil
+}
+
+// chainAddr is the address of both ends of a chainConn.
+type chainAddr struct{}
+
+func (chainAddr) Network() string { return "netbird" }
+func (chainAddr) String() string  { return "handler-chain" }
+
+// chainConn is an in-memory DNS over TCP connection to the handler chain.
+// Each complete query written is resolved before Write returns, and its
+// response is read back with Read. It is not a net.PacketConn, so the Go
+// resolver uses TCP framing and never has to retry truncated answers.
+type chainConn struct {
+	resolve func(ctx context.Context, r *dns.Msg) (*dns.Msg, error)
+
+	mu       sync.Mutex
+	in       bytes.Buffer
+	out      bytes.Buffer
+	deadline time.Time
+	closed   bool
+}
+
+func (c *chainConn) Write(p []byte) (int, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.closed {
+		return 0, net.ErrClosed
+	}
+	if !c.deadline.IsZero() && !time.Now().Before(c.deadline) {
+		return 0, os.ErrDeadlineExceeded
+	}
+	c.in.Write(p)
+
+	for c.in.Len() >= 2 {
+		size := int(binary.BigEndian.Uint16(c.in.Bytes()))
+		if c.in.Len() < 2+size {
+			break
+		}
+		c.in.Next(2)
+		if err := c.serve(c.in.Next(size)); err != nil {
+			return 0, err
+		}
+	}
+	return len(p), nil
+}
+
+// serve resolves the packed query and queues its response. Queries the
+// chain fails to resolve are answered with SERVFAIL. Must be called with
+// c.mu held.
+func (c *chainConn) serve(packed []byte) error {
+	r := new(dns.Msg)
+	if err := r.Unpack(packed); err != nil {
+		return err
+	}
+
+	ctx := context.Background()
+	if !c.deadline.IsZero() {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithDeadline(ctx, c.deadline)
+		defer cancel()
+	}
+
+	resp, err := c.resolve(ctx, r)
+	if err != nil {
+		log.Debugf("in-process DNS query failed: %v", err)
+		resp = new(dns.Msg).SetRcode(r, dns.RcodeServerFailure)
+	}
+	data, err := resp.Pack()
+	if err != nil {
+		return err
+	}
+	if len(data) > math.MaxUint16 {
+		return errors.New("dns response exceeds the maximum message size")
+	}
+	c.out.Write(binary.BigEndian.AppendUint16(nil, uint16(len(data))))
+	c.out.Write(data)
+	return nil
+}
+
+// Read returns queued responses, io.EOF if none is left.
+func (c *chainConn) Read(p []byte) (int, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.closed {
+		return 0, net.ErrClosed
+	}
+	if c.out.Len() == 0 {
+		return 0, io.EOF
+	}
+	return c.out.Read(p)
+}
+
+func (c *chainConn) Close() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.closed = true
+	return nil
+}
+
+func (c *chainConn) LocalAddr() net.Addr  { return chainAddr{} }
+func (c *chainConn) RemoteAddr() net.Addr { return chainAddr{} }
+
+func (c *chainConn) SetDeadline(t time.Time) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.deadline = t
+	return nil
+}
+
+// SetReadDeadline is a no-op: reads never block.
+func (c *chainConn) SetReadDeadline(time.Time) error {
+	return nil
+}
+
+// SetWriteDeadline bounds the resolution of the queries written.
+func (c *chainConn) SetWriteDeadline(t time.Time) error {
+	return c.SetDeadline(t)
+}
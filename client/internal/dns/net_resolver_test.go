@@ -0,0 +1,97 @@
+package dns
+
+import (
+	"context"
+	"errors"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/miekg/dns"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	nbdns "github.com/netbirdio/netbird/dns"
+)
+
+func TestDefaultServer_NetResolver(t *testing.T) {
+	server := newTestServer(nil)
+	require.NoError(t, server.UpdateDNSServer(1, nbdns.Config{
+		ServiceEnable: true,
+		CustomZones: []nbdns.CustomZone{{
+			Domain: "netbird.cloud.",
+			Records: []nbdns.SimpleRecord{
+				{Name: "peer.netbird.cloud.", Type: int(dns.TypeA), Class: nbdns.DefaultClass, TTL: 300, RData: "100.64.0.1"},
+				{Name: "peer.netbird.cloud.", Type: int(dns.TypeAAAA), Class: nbdns.DefaultClass, TTL: 300, RData: "fd00::1"},
+				{Name: "alias.netbird.cloud.", Type: int(dns.TypeCNAME), Class: nbdns.DefaultClass, TTL: 300, RData: "peer.netbird.cloud."},
+			},
+		}},
+	}))
+
+	resolver := server.NetResolver()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	addrs, err := resolver.LookupHost(ctx, "peer.netbird.cloud.")
+	require.NoError(t, err)
+	assert.ElementsMatch(t, []string{"100.64.0.1", "fd00::1"}, addrs)
+
+	ips, err := resolver.LookupNetIP(ctx, "ip4", "alias.netbird.cloud.")
+	require.NoError(t, err)
+	require.Len(t, ips, 1, "the CNAME should be followed")
+	assert.Equal(t, "100.64.0.1", ips[0].String())
+
+	_, err = resolver.LookupHost(ctx, "missing.netbird.cloud.")
+	var dnsErr *net.DNSError
+	require.True(t, errors.As(err, &dnsErr), "unexpected error: %v", err)
+	assert.True(t, dnsErr.IsNotFound, "names missing from the zone are NXDOMAIN")
+
+	_, err = resolver.LookupHost(ctx, "unhandled.example.")
+	require.True(t, errors.As(err, &dnsErr), "unexpected error: %v", err)
+	assert.False(t, dnsErr.IsNotFound, "names no handler resolves fail with SERVFAIL")
+}
+
+func TestChainConn(t *testing.T) {
+	server := newTestServer(nil)
+	server.handlerChain.AddHandler("a.example.com.", dualStackUpstream, PriorityUpstream)
+	server.handlerChain.AddHandler("b.example.com.", dualStackUpstream, PriorityUpstream)
+
+	conn, err := server.DialResolver(context.Background(), "udp", "127.0.0.53:53")
+	require.NoError(t, err)
+	defer conn.Close()
+	_, isPacketConn := conn.(net.PacketConn)
+	assert.False(t, isPacketConn, "the connection must use TCP framing")
+
+	query := func(name string) []byte {
+		data, err := new(dns.Msg).SetQuestion(name, dns.TypeA).Pack()
+		require.NoError(t, err)
+		return append([]byte{byte(len(data) >> 8), byte(len(data))}, data...)
+	}
+	// two queries, the second one written in two parts
+	first, second := query("a.example.com."), query("b.example.com.")
+	_, err = conn.Write(append(first, second[:5]...))
+	require.NoError(t, err)
+	_, err = conn.Write(second[5:])
+	require.NoError(t, err)
+
+	for _, name := range []string{"a.example.com.", "b.example.com."} {
+		var size [2]byte
+		_, err = conn.Read(size[:])
+		require.NoError(t, err)
+		data := make([]byte, int(size[0])<<8|int(size[1]))
+		_, err = conn.Read(data)
+		require.NoError(t, err)
+
+		resp := new(dns.Msg)
+		require.NoError(t, resp.Unpack(data))
+		assert.Equal(t, name, resp.Question[0].Name)
+		require.Len(t, resp.Answer, 1)
+	}
+
+	_, err = conn.Read(make([]byte, 1))
+	assert.Error(t, err, "nothing is left to read")
+
+	require.NoError(t, conn.Close())
+	_, err = conn.Write(first)
+	assert.ErrorIs(t, err, net.ErrClosed)
+}
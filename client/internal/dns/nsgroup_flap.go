@@ -0,0 +1,106 @@
+package dns
+
+import (
+	"strconv"
+	"strings"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/netbirdio/netbird/client/proto"
+	nbdns "github.com/netbirdio/netbird/dns"
+)
+
+// defaultFlapDebounce is how long a nameserver group's enabled state has to
+// settle before its change is published, so a group flapping between
+// deactivated and reactivated yields a single event.
+const defaultFlapDebounce = 3 * time.Second
+
+// groupFlap is a not yet published change of a group's enabled state.
+type groupFlap struct {
+	domains []string
+	// wasEnabled is the state before the first change of the burst,
+	// enabled and err the state after the latest.
+	wasEnabled bool
+	enabled    bool
+	err        error
+	timer      *time.Timer
+}
+
+// queueGroupFlap records the deactivation or, with enabled, reactivation
+// of the group with id and (re)starts the debounce of its event. Caller
+// must hold healthProjectMu.
+func (s *DefaultServer) queueGroupFlap(id nsGroupID, group *nbdns.NameServerGroup, enabled bool, groupErr error) {
+	if s.flapDebounce <= 0 {
+		return
+	}
+	if s.groupFlaps == nil {
+		s.groupFlaps = make(map[nsGroupID]*groupFlap)
+	}
+
+	f, ok := s.groupFlaps[id]
+	if !ok {
+		f = &groupFlap{wasEnabled: !enabled}
+		s.groupFlaps[id] = f
+	} else {
+		f.timer.Stop()
+	}
+	f.domains = group.Domains
+	f.enabled = enabled
+	f.err = groupErr
+	f.timer = time.AfterFunc(s.flapDebounce, func() { s.publishGroupFlap(id, f) })
+}
+
+// publishGroupFlap publishes the settled change f of the group with id,
+// unless the group flapped back to where it started.
+func (s *DefaultServer) publishGroupFlap(id nsGroupID, f *groupFlap) {
+	s.healthProjectMu.Lock()
+	if s.groupFlaps[id] != f {
+		s.healthProjectMu.Unlock()
+		return
+	}
+	delete(s.groupFlaps, id)
+	enabled, groupErr := f.enabled, f.err
+	s.healthProjectMu.Unlock()
+
+	if enabled == f.wasEnabled {
+		log.Debugf("DNS health: group %s flapped back to enabled=%t, not publishing", id, enabled)
+		return
+	}
+
+	metadata := map[string]string{
+		"group":       string(id),
+		"domains":     strings.Join(f.domains, ","),
+		"was_enabled": strconv.FormatBool(f.wasEnabled),
+		"enabled":     strconv.FormatBool(enabled),
+	}
+	if groupErr != nil {
+		metadata["error"] = groupErr.Error()
+	}
+	if enabled {
+		s.statusRecorder.PublishEvent(
+			proto.SystemEvent_INFO,
+			proto.SystemEvent_DNS,
+			"Nameserver group reactivated",
+			"DNS resolution is no longer degraded.",
+			metadata,
+		)
+		return
+	}
+	s.statusRecorder.PublishEvent(
+		proto.SystemEvent_WARNING,
+		proto.SystemEvent_DNS,
+		"Nameserver group deactivated",
+		"DNS resolution is degraded: some DNS servers are not in use because they failed to answer.",
+		metadata,
+	)
+}
+
+// stopGroupFlaps drops the unpublished group changes. Caller must hold
+// healthProjectMu.
+func (s *DefaultServer) stopGroupFlaps() {
+	for _, f := range s.groupFlaps {
+		f.timer.Stop()
+	}
+	s.groupFlaps = nil
+}
@@ -0,0 +1,62 @@
+package dns
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/netbirdio/netbird/client/proto"
+)
+
+func TestDefaultServer_GroupFlapEvents(t *testing.T) {
+	fx := newProjTestFixture(t)
+	fx.server.flapDebounce = 50 * time.Millisecond
+	fail := UpstreamHealth{LastFail: time.Now(), LastErr: "timeout"}
+
+	nextEvent := func() *proto.SystemEvent {
+		t.Helper()
+		select {
+		case evt := <-fx.events:
+			return evt
+		case <-time.After(time.Second):
+			t.Fatal("no event published")
+			return nil
+		}
+	}
+
+	fx.setHealth(fail)
+	require.False(t, fx.tick()[0].Enabled)
+	evt := nextEvent()
+	assert.Equal(t, proto.SystemEvent_WARNING, evt.Severity)
+	assert.Equal(t, proto.SystemEvent_DNS, evt.Category)
+	assert.Equal(t, "Nameserver group deactivated", evt.Message)
+	assert.Equal(t, string(generateGroupKey(fx.group)), evt.Metadata["group"])
+	assert.Equal(t, "example.com", evt.Metadata["domains"])
+	assert.Equal(t, "true", evt.Metadata["was_enabled"])
+	assert.Equal(t, "false", evt.Metadata["enabled"])
+	assert.Contains(t, evt.Metadata["error"], "timeout")
+
+	// flapping back and forth within the debounce collapses into the
+	// final state
+	fx.setHealth(UpstreamHealth{LastOk: time.Now()})
+	require.True(t, fx.tick()[0].Enabled)
+	fx.setHealth(UpstreamHealth{LastFail: time.Now().Add(time.Millisecond), LastErr: "timeout"})
+	require.False(t, fx.tick()[0].Enabled)
+	fx.setHealth(UpstreamHealth{LastOk: time.Now().Add(2 * time.Millisecond)})
+	require.True(t, fx.tick()[0].Enabled)
+	evt = nextEvent()
+	assert.Equal(t, "Nameserver group reactivated", evt.Message)
+	assert.Equal(t, "false", evt.Metadata["was_enabled"])
+	assert.Equal(t, "true", evt.Metadata["enabled"])
+	assert.NotContains(t, evt.Metadata, "error")
+	fx.expectNoEvent("the burst yields a single event")
+
+	// a flap ending where it started isn't published
+	fx.setHealth(UpstreamHealth{LastFail: time.Now().Add(3 * time.Millisecond), LastErr: "timeout"})
+	require.False(t, fx.tick()[0].Enabled)
+	fx.setHealth(UpstreamHealth{LastOk: time.Now().Add(4 * time.Millisecond)})
+	require.True(t, fx.tick()[0].Enabled)
+	fx.expectNoEvent("the group flapped back")
+}
@@ -0,0 +1,142 @@
+package dns
+
+import (
+	"net/netip"
+	"time"
+
+	"github.com/miekg/dns"
+	log "github.com/sirupsen/logrus"
+
+	nbdns "github.com/netbirdio/netbird/dns"
+)
+
+const (
+	// minAvailabilityProbeInterval bounds how often deactivated groups are
+	// probed, so a probe round finishes before the next one starts.
+	minAvailabilityProbeInterval = 5 * time.Second
+	// groupProbeCooldown is how long a group isn't probed again after a
+	// probe started, whoever calls ProbeAvailability. It stays below
+	// minAvailabilityProbeInterval so the background prober never skips.
+	groupProbeCooldown = 2 * time.Second
+)
+
+// groupProbe is a deactivated nameserver group to probe.
+type groupProbe struct {
+	proj     *nsGroupProj
+	prober   availabilityProber
+	servers  []netip.AddrPort
+	question dns.Question
+}
+
+// setAvailabilityProbeInterval sets how often the deactivated groups are
+// probed in the background, zero or less disabling it.
+func (s *DefaultServer) setAvailabilityProbeInterval(interval time.Duration) {
+	if interval <= 0 {
+		return
+	}
+	if interval < minAvailabilityProbeInterval {
+		log.Warnf("DNS availability probe interval %v is below the minimum, using %v", interval, minAvailabilityProbeInterval)
+		interval = minAvailabilityProbeInterval
+	}
+	s.probeInterval = interval
+}
+
+// startAvailabilityProber periodically probes the deactivated nameserver
+// groups, so they are reactivated once their upstreams recover even if no
+// client query reaches them. Stopped with s.ctx.
+func (s *DefaultServer) startAvailabilityProber() {
+	if s.probeInterval <= 0 {
+		return
+	}
+
+	log.Infof("probing deactivated DNS nameserver groups every %v", s.probeInterval)
+	s.shutdownWg.Add(1)
+	go func() {
+		defer s.shutdownWg.Done()
+		ticker := time.NewTicker(s.probeInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-s.ctx.Done():
+				return
+			case <-ticker.C:
+				s.ProbeAvailability()
+			}
+		}
+	}()
+}
+
+// ProbeAvailability queries the upstreams of the deactivated nameserver
+// groups in the background. A group is reactivated by the next health
+// refresh once one of its upstreams answers.
+//
+// Calls coalesce per group: a group whose probe is still running, or
+// started less than groupProbeCooldown ago, isn't probed again. This
+// includes the probe of a group restored as deactivated.
+func (s *DefaultServer) ProbeAvailability() {
+	s.mux.Lock()
+	groups := s.nsGroups
+	probers := s.availabilityProbers()
+	s.mux.Unlock()
+
+	now := time.Now()
+	s.healthProjectMu.Lock()
+	var probes []groupProbe
+	for _, group := range groups {
+		p, ok := s.nsGroupProj[generateGroupKey(group)]
+		if !ok || !p.disabled {
+			continue
+		}
+		prober, ok := groupProber(group, probers)
+		if !ok {
+			continue
+		}
+		servers := s.usableNameServers(group.NameServers)
+		if len(servers) == 0 {
+			continue
+		}
+		if !claimGroupProbe(p, now) {
+			continue
+		}
+		probes = append(probes, groupProbe{proj: p, prober: prober, servers: servers, question: probeQuestion(group)})
+	}
+	s.healthProjectMu.Unlock()
+
+	for _, probe := range probes {
+		log.Debugf("DNS health: probing deactivated group [%s]", joinAddrPorts(probe.servers))
+		s.runGroupProbe(probe)
+	}
+}
+
+// claimGroupProbe reports whether the group of p may be probed now, and if
+// so marks its probe running. A group is probed at most once per
+// groupProbeCooldown and never twice at once. Caller must hold
+// healthProjectMu.
+func claimGroupProbe(p *nsGroupProj, now time.Time) bool {
+	if p.probing.Load() || now.Sub(p.lastProbe) < groupProbeCooldown {
+		return false
+	}
+	p.probing.Store(true)
+	p.lastProbe = now
+	return true
+}
+
+// runGroupProbe starts a probe claimed with claimGroupProbe. Its completion
+// releases the claim and requests a health refresh.
+func (s *DefaultServer) runGroupProbe(probe groupProbe) {
+	probe.prober.probeAvailability(probe.servers, probe.question, func() {
+		probe.proj.probing.Store(false)
+		s.requestHealthRefresh()
+	})
+}
+
+// groupProber returns the handler serving group among probers, which are
+// keyed by match domain.
+func groupProber(group *nbdns.NameServerGroup, probers map[string]availabilityProber) (availabilityProber, bool) {
+	d := nbdns.RootZone
+	if !group.Primary && len(group.Domains) > 0 {
+		d = group.Domains[0]
+	}
+	prober, ok := probers[d]
+	return prober, ok
+}
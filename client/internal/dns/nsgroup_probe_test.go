@@ -0,0 +1,161 @@
+package dns
+
+import (
+	"net/netip"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/miekg/dns"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	nbdns "github.com/netbirdio/netbird/dns"
+)
+
+func TestDefaultServer_ProbeAvailability(t *testing.T) {
+	fx := newProjTestFixture(t)
+	prober := &probingStub{healthStubHandler: fx.stub, probed: make(chan dns.Question, 1)}
+	fx.server.dnsMuxHandlers[0].handler = prober
+
+	fx.server.ProbeAvailability()
+	assert.Empty(t, prober.probed, "enabled groups aren't probed")
+
+	fx.setHealth(UpstreamHealth{LastFail: time.Now(), LastErr: "timeout"})
+	require.False(t, fx.tick()[0].Enabled)
+
+	fx.server.ProbeAvailability()
+	require.Len(t, prober.probed, 1, "the deactivated group is probed")
+	assert.Equal(t, dns.Question{Name: "example.com.", Qtype: dns.TypeSOA, Qclass: dns.ClassINET}, <-prober.probed)
+
+	fx.setHealth(UpstreamHealth{LastOk: time.Now()})
+	require.True(t, fx.tick()[0].Enabled, "the group is reactivated once its upstream answers")
+
+	fx.server.ProbeAvailability()
+	assert.Empty(t, prober.probed)
+}
+
+// blockingProber holds the availability probes until released.
+type blockingProber struct {
+	*healthStubHandler
+	probes  atomic.Int32
+	mu      sync.Mutex
+	pending []func()
+}
+
+func (p *blockingProber) probeAvailability(_ []netip.AddrPort, _ dns.Question, done func()) {
+	p.probes.Add(1)
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.pending = append(p.pending, done)
+}
+
+func (p *blockingProber) release() {
+	p.mu.Lock()
+	pending := p.pending
+	p.pending = nil
+	p.mu.Unlock()
+	for _, done := range pending {
+		done()
+	}
+}
+
+func TestDefaultServer_ProbeAvailabilityConcurrent(t *testing.T) {
+	fx := newProjTestFixture(t)
+	prober := &blockingProber{healthStubHandler: fx.stub}
+	fx.server.dnsMuxHandlers[0].handler = prober
+
+	fx.setHealth(UpstreamHealth{LastFail: time.Now(), LastErr: "timeout"})
+	require.False(t, fx.tick()[0].Enabled)
+
+	var wg sync.WaitGroup
+	for range 50 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			fx.server.ProbeAvailability()
+		}()
+	}
+	wg.Wait()
+	assert.Equal(t, int32(1), prober.probes.Load(), "concurrent calls share one probe")
+
+	// The probe finished, but the group was probed too recently.
+	prober.release()
+	fx.server.ProbeAvailability()
+	assert.Equal(t, int32(1), prober.probes.Load())
+
+	// Past the cooldown the group is probed again.
+	proj := fx.server.nsGroupProj[generateGroupKey(fx.group)]
+	proj.lastProbe = time.Now().Add(-groupProbeCooldown)
+	fx.server.ProbeAvailability()
+	assert.Equal(t, int32(2), prober.probes.Load())
+
+	// A running probe isn't started twice, even past the cooldown.
+	proj.lastProbe = time.Now().Add(-groupProbeCooldown)
+	fx.server.ProbeAvailability()
+	assert.Equal(t, int32(2), prober.probes.Load())
+	prober.release()
+}
+
+func TestDefaultServer_ProbeAvailabilityPerGroup(t *testing.T) {
+	fx := newProjTestFixture(t)
+	srv2 := netip.MustParseAddrPort("100.64.0.2:53")
+	group2 := &nbdns.NameServerGroup{
+		Domains:     []string{"example.org"},
+		NameServers: []nbdns.NameServer{{IP: srv2.Addr(), NSType: nbdns.UDPNameServerType, Port: int(srv2.Port())}},
+	}
+	first := &blockingProber{healthStubHandler: fx.stub}
+	second := &blockingProber{healthStubHandler: fx.stub}
+	fx.server.dnsMuxHandlers = []handlerWrapper{
+		{domain: "example.com", handler: first, priority: PriorityUpstream},
+		{domain: "example.org", handler: second, priority: PriorityUpstream},
+	}
+	fx.server.mux.Lock()
+	fx.server.updateNSGroupStates([]*nbdns.NameServerGroup{fx.group, group2})
+	fx.server.mux.Unlock()
+
+	failed := UpstreamHealth{LastFail: time.Now(), LastErr: "timeout"}
+	fx.stub.health = map[netip.AddrPort]UpstreamHealth{fx.srv: failed, srv2: failed}
+	states := fx.tick()
+	require.Len(t, states, 2)
+	require.False(t, states[0].Enabled)
+	require.False(t, states[1].Enabled)
+
+	var wg sync.WaitGroup
+	for range 50 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			fx.server.ProbeAvailability()
+		}()
+	}
+	wg.Wait()
+	assert.Equal(t, int32(1), first.probes.Load())
+	assert.Equal(t, int32(1), second.probes.Load())
+
+	// Rapid-fire calls within the cooldown don't probe either group again.
+	first.release()
+	second.release()
+	for range 10 {
+		fx.server.ProbeAvailability()
+	}
+	assert.Equal(t, int32(1), first.probes.Load())
+	assert.Equal(t, int32(1), second.probes.Load())
+}
+
+func TestDefaultServer_SetAvailabilityProbeInterval(t *testing.T) {
+	for _, tc := range []struct {
+		interval time.Duration
+		want     time.Duration
+	}{
+		{interval: 0, want: 0},
+		{interval: -time.Second, want: 0},
+		{interval: time.Second, want: minAvailabilityProbeInterval},
+		{interval: time.Minute, want: time.Minute},
+	} {
+		server := newTestServer(nil)
+		server.setAvailabilityProbeInterval(tc.interval)
+		assert.Equal(t, tc.want, server.probeInterval, "interval %v", tc.interval)
+	}
+}
@@ -0,0 +1,149 @@
+package dns
+
+import (
+	"net/netip"
+	"sync"
+	"time"
+
+	"github.com/miekg/dns"
+	log "github.com/sirupsen/logrus"
+
+	nbdns "github.com/netbirdio/netbird/dns"
+)
+
+// restoredGroupMaxAge bounds the age of the deactivations restored from the
+// previous run; older ones say nothing about the upstreams anymore.
+const restoredGroupMaxAge = time.Hour
+
+// DeactivatedGroupsState persists the nameserver groups deactivated because
+// their upstreams failed, so a restart doesn't send queries to them before
+// they are seen answering again.
+type DeactivatedGroupsState struct {
+	// Groups maps the IDs of the deactivated groups to when they were
+	// deactivated.
+	Groups map[string]time.Time `json:"groups"`
+}
+
+func (s *DeactivatedGroupsState) Name() string {
+	return "dns_deactivated_groups_state"
+}
+
+// availabilityProber is implemented by the handlers that can query their
+// upstreams without a client query.
+type availabilityProber interface {
+	probeAvailability(servers []netip.AddrPort, question dns.Question, done func())
+}
+
+// probeAvailability asks question to each of servers in the background,
+// recording the outcomes in the handler's upstream health. done is called
+// once every server answered or failed.
+func (u *upstreamResolverBase) probeAvailability(servers []netip.AddrPort, question dns.Question, done func()) {
+	r := new(dns.Msg)
+	r.Id = dns.Id()
+	r.RecursionDesired = true
+	r.Question = []dns.Question{question}
+
+	var wg sync.WaitGroup
+	for _, upstream := range servers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			u.queryUpstream(u.ctx, r.Copy(), upstream, u.timeoutFor(upstream, u.upstreamTimeout))
+		}()
+	}
+	go func() {
+		wg.Wait()
+		done()
+	}()
+}
+
+// availabilityProbers returns the handlers of the current nameserver groups
+// by match domain. Caller must hold s.mux.
+func (s *DefaultServer) availabilityProbers() map[string]availabilityProber {
+	probers := make(map[string]availabilityProber)
+	for _, entry := range s.dnsMuxHandlers {
+		if prober, ok := entry.handler.(availabilityProber); ok {
+			probers[entry.domain] = prober
+		}
+	}
+	return probers
+}
+
+// loadDeactivatedGroups restores the nameserver groups the previous run
+// stopped with deactivated. Caller must hold s.mux.
+func (s *DefaultServer) loadDeactivatedGroups() {
+	state := &DeactivatedGroupsState{}
+	s.stateManager.RegisterState(state)
+	if err := s.stateManager.LoadState(state); err != nil {
+		log.Warnf("failed to load deactivated DNS nameserver groups: %v", err)
+		return
+	}
+	loaded, ok := s.stateManager.GetState(state).(*DeactivatedGroupsState)
+	if !ok || loaded == nil {
+		return
+	}
+
+	now := time.Now()
+	s.healthProjectMu.Lock()
+	defer s.healthProjectMu.Unlock()
+	s.restoredGroups = make(map[nsGroupID]time.Time, len(loaded.Groups))
+	for id, since := range loaded.Groups {
+		if now.Sub(since) > restoredGroupMaxAge {
+			continue
+		}
+		s.restoredGroups[nsGroupID(id)] = since
+	}
+}
+
+// restoreGroup keeps the group with id deactivated if the previous run
+// stopped with it deactivated, and probes its upstreams right away so it
+// is re-enabled as soon as they answer rather than on client queries.
+// Caller must hold healthProjectMu.
+func (s *DefaultServer) restoreGroup(id nsGroupID, p *nsGroupProj, group *nbdns.NameServerGroup, servers []netip.AddrPort, probers map[string]availabilityProber) {
+	since, ok := s.restoredGroups[id]
+	if !ok {
+		return
+	}
+	delete(s.restoredGroups, id)
+	p.restored = true
+	p.disabled = true
+	s.deactivatedGroups[id] = since
+
+	prober, ok := groupProber(group, probers)
+	if !ok || !claimGroupProbe(p, time.Now()) {
+		return
+	}
+	log.Infof("DNS health: group [%s] was deactivated on shutdown, probing it before enabling it", joinAddrPorts(servers))
+	s.runGroupProbe(groupProbe{proj: p, prober: prober, servers: servers, question: probeQuestion(group)})
+}
+
+// recordGroupState tracks the deactivation of the group with id for
+// persisting. Caller must hold healthProjectMu.
+func (s *DefaultServer) recordGroupState(id nsGroupID, enabled bool, now time.Time) {
+	if enabled {
+		delete(s.deactivatedGroups, id)
+	} else {
+		s.deactivatedGroups[id] = now
+	}
+	s.deactivatedGroupsDirty = true
+}
+
+// persistDeactivatedGroups hands the deactivated groups to the state
+// manager if they changed since the last call.
+func (s *DefaultServer) persistDeactivatedGroups() {
+	s.healthProjectMu.Lock()
+	if !s.deactivatedGroupsDirty {
+		s.healthProjectMu.Unlock()
+		return
+	}
+	s.deactivatedGroupsDirty = false
+	state := &DeactivatedGroupsState{Groups: make(map[string]time.Time, len(s.deactivatedGroups))}
+	for id, since := range s.deactivatedGroups {
+		state.Groups[string(id)] = since
+	}
+	s.healthProjectMu.Unlock()
+
+	if err := s.stateManager.UpdateState(state); err != nil {
+		log.Warnf("failed to persist deactivated DNS nameserver groups: %v", err)
+	}
+}
@@ -0,0 +1,78 @@
+package dns
+
+import (
+	"context"
+	"net/netip"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/miekg/dns"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/netbirdio/netbird/client/internal/statemanager"
+)
+
+// probingStub records the availability probes of a restored group.
+type probingStub struct {
+	*healthStubHandler
+	probed chan dns.Question
+}
+
+func (p *probingStub) probeAvailability(_ []netip.AddrPort, question dns.Question, done func()) {
+	p.probed <- question
+	done()
+}
+
+func TestDefaultServer_DeactivatedGroupsRestored(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "state.json")
+
+	fx := newProjTestFixture(t)
+	fx.server.stateManager = statemanager.New(path)
+	fx.server.loadDeactivatedGroups()
+	fx.setHealth(UpstreamHealth{LastFail: time.Now(), LastErr: "timeout"})
+	states := fx.tick()
+	require.Len(t, states, 1)
+	require.False(t, states[0].Enabled)
+	require.NoError(t, fx.server.stateManager.PersistState(context.Background()))
+
+	restarted := newProjTestFixture(t)
+	restarted.server.stateManager = statemanager.New(path)
+	prober := &probingStub{healthStubHandler: restarted.stub, probed: make(chan dns.Question, 1)}
+	restarted.server.dnsMuxHandlers[0].handler = prober
+	restarted.server.loadDeactivatedGroups()
+
+	states = restarted.tick()
+	require.Len(t, states, 1)
+	assert.False(t, states[0].Enabled, "a restored group stays deactivated until its upstreams answer")
+	require.Len(t, prober.probed, 1, "the restored group is probed right away")
+	assert.Equal(t, dns.Question{Name: "example.com.", Qtype: dns.TypeSOA, Qclass: dns.ClassINET}, <-prober.probed)
+
+	assert.False(t, restarted.tick()[0].Enabled)
+	restarted.server.ProbeAvailability()
+	assert.Empty(t, prober.probed, "the group is probed once")
+
+	restarted.setHealth(UpstreamHealth{LastOk: time.Now()})
+	assert.True(t, restarted.tick()[0].Enabled)
+	persisted, ok := restarted.server.stateManager.GetState(&DeactivatedGroupsState{}).(*DeactivatedGroupsState)
+	require.True(t, ok)
+	assert.Empty(t, persisted.Groups, "the reactivation is persisted")
+}
+
+func TestDefaultServer_DeactivatedGroupsExpire(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "state.json")
+	manager := statemanager.New(path)
+	manager.RegisterState(&DeactivatedGroupsState{})
+	require.NoError(t, manager.UpdateState(&DeactivatedGroupsState{Groups: map[string]time.Time{
+		"recent": time.Now().Add(-time.Minute),
+		"old":    time.Now().Add(-2 * restoredGroupMaxAge),
+	}}))
+	require.NoError(t, manager.PersistState(context.Background()))
+
+	server := newTestServer(nil)
+	server.stateManager = statemanager.New(path)
+	server.loadDeactivatedGroups()
+	assert.Contains(t, server.restoredGroups, nsGroupID("recent"))
+	assert.NotContains(t, server.restoredGroups, nsGroupID("old"))
+}
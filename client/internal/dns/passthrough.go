@@ -0,0 +1,81 @@
+package dns
+
+import (
+	"sync/atomic"
+
+	"github.com/miekg/dns"
+	log "github.com/sirupsen/logrus"
+
+	"github.com/netbirdio/netbird/client/internal/dns/resutil"
+	"github.com/netbirdio/netbird/client/internal/dns/types"
+	"github.com/netbirdio/netbird/shared/management/domain"
+)
+
+// passthroughResolver forwards queries to the host's original nameservers.
+// Registered for a subdomain of a zone claimed by another handler, it
+// punches a hole in that zone: at the same priority the more specific
+// pattern is tried first.
+type passthroughResolver struct {
+	// upstream is the handler for the host's original nameservers, nil
+	// while none is known.
+	upstream atomic.Pointer[handlerWithStop]
+}
+
+// setUpstream swaps the handler queries are forwarded to.
+func (p *passthroughResolver) setUpstream(h handlerWithStop) {
+	if h == nil {
+		p.upstream.Store(nil)
+		return
+	}
+	p.upstream.Store(&h)
+}
+
+func (p *passthroughResolver) String() string {
+	return "PassthroughResolver"
+}
+
+func (p *passthroughResolver) ID() types.HandlerID {
+	return "passthrough"
+}
+
+func (p *passthroughResolver) Stop() {
+	// the upstream handler is owned by the server
+}
+
+func (p *passthroughResolver) ServeDNS(w dns.ResponseWriter, r *dns.Msg) {
+	if len(r.Question) == 0 {
+		return
+	}
+	resutil.SetMeta(w, "passthrough", "original_nameservers")
+
+	if h := p.upstream.Load(); h != nil {
+		(*h).ServeDNS(w, r)
+		return
+	}
+
+	// Passing the query on would hand it to the zone it is excluded from.
+	log.Debugf("no original nameservers to pass %s through to", r.Question[0].Name)
+	resp := new(dns.Msg)
+	resp.SetRcode(r, dns.RcodeServerFailure)
+	if err := w.WriteMsg(resp); err != nil {
+		log.Errorf("failed to write passthrough response: %v", err)
+	}
+}
+
+// RegisterPassthrough forwards queries for domains to the host's original
+// nameservers, excluding them from a zone claimed at the same priority for
+// a parent domain, e.g. PriorityLocal for a custom zone. Domains match
+// exactly, or with a "*." prefix their subdomains. Without original
+// nameservers the queries fail with SERVFAIL. Registrations follow
+// RegisterHandler, so DeregisterHandler with the same priority removes them.
+func (s *DefaultServer) RegisterPassthrough(domains domain.List, priority int) {
+	s.mux.Lock()
+	if s.passthrough == nil {
+		s.passthrough = &passthroughResolver{}
+		s.passthrough.setUpstream(s.fallbackHandler)
+	}
+	handler := s.passthrough
+	s.mux.Unlock()
+
+	s.RegisterHandler(domains, handler, priority)
+}
@@ -0,0 +1,42 @@
+package dns
+
+import (
+	"testing"
+
+	"github.com/miekg/dns"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/netbirdio/netbird/shared/management/domain"
+)
+
+func TestDefaultServer_RegisterPassthrough(t *testing.T) {
+	server := newZoneOverlapTestServer(t, false)
+	server.RegisterPassthrough(domain.List{"app.corp.example", "*.dev.corp.example"}, PriorityLocal)
+
+	resp := captivePortalQuery(t, server, "app.corp.example.", dns.TypeA)
+	assert.Equal(t, dns.RcodeServerFailure, resp.Rcode, "without original nameservers the zone doesn't answer either")
+
+	server.fallbackHandler = &staticAnswerHandler{addr: "198.51.100.1"}
+	server.passthrough.setUpstream(server.fallbackHandler)
+
+	for _, name := range []string{"app.corp.example.", "host.dev.corp.example."} {
+		resp = captivePortalQuery(t, server, name, dns.TypeA)
+		require.Len(t, resp.Answer, 1, name)
+		assert.Equal(t, "198.51.100.1", resp.Answer[0].(*dns.A).A.String(), "%s goes to the original nameservers", name)
+	}
+
+	resp = captivePortalQuery(t, server, "www.app.corp.example.", dns.TypeA)
+	assert.Equal(t, dns.RcodeNameError, resp.Rcode, "the rest of the zone is still answered locally")
+	assert.Empty(t, resp.Answer)
+
+	assert.Equal(t, []ZoneOverlap{
+		{Domain: "*.dev.corp.example", Zone: "corp.example.", Priority: PriorityLocal, Shadows: true},
+		{Domain: "app.corp.example", Zone: "corp.example.", Priority: PriorityLocal, Shadows: true},
+	}, server.ZoneOverlaps())
+
+	server.DeregisterHandler(domain.List{"app.corp.example"}, PriorityLocal)
+	resp = captivePortalQuery(t, server, "app.corp.example.", dns.TypeA)
+	require.Len(t, resp.Answer, 1)
+	assert.Equal(t, "100.64.0.10", resp.Answer[0].(*dns.A).A.String())
+}
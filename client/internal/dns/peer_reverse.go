@@ -0,0 +1,108 @@
+package dns
+
+import (
+	"net/netip"
+
+	"github.com/miekg/dns"
+	log "github.com/sirupsen/logrus"
+
+	"github.com/netbirdio/netbird/client/internal/dns/resutil"
+	"github.com/netbirdio/netbird/client/internal/dns/types"
+	"github.com/netbirdio/netbird/client/internal/peer"
+)
+
+// peerReverseTTL is the TTL of the PTR answers for peer addresses, short
+// so peers leaving the network aren't remembered for long.
+const peerReverseTTL = 60
+
+// peerReverseResolver answers PTR queries for addresses within the NetBird
+// network with the FQDN of the peer holding the address. Peers are looked
+// up in the status recorder on every query, so the answers follow peers
+// joining and leaving without re-registering. Everything else, including
+// addresses no peer holds, is passed on to the next handler.
+type peerReverseResolver struct {
+	wgInterface WGIface
+	status      *peer.Status
+}
+
+func (r *peerReverseResolver) String() string {
+	return "PeerReverseResolver"
+}
+
+func (r *peerReverseResolver) ID() types.HandlerID {
+	return "peer-reverse"
+}
+
+func (r *peerReverseResolver) MatchSubdomains() bool {
+	return true
+}
+
+func (r *peerReverseResolver) Stop() {
+	// nothing to release
+}
+
+func (r *peerReverseResolver) ServeDNS(w dns.ResponseWriter, req *dns.Msg) {
+	if len(req.Question) == 0 {
+		return
+	}
+
+	var fqdn string
+	if req.Question[0].Qtype == dns.TypePTR {
+		fqdn = r.lookup(req.Question[0].Name)
+	}
+
+	resp := new(dns.Msg)
+	if fqdn == "" {
+		resp.SetRcode(req, dns.RcodeNameError)
+		resp.MsgHdr.Zero = true
+	} else {
+		resp.SetReply(req)
+		resp.Authoritative = true
+		resp.Answer = []dns.RR{&dns.PTR{
+			Hdr: dns.RR_Header{Name: req.Question[0].Name, Rrtype: dns.TypePTR, Class: dns.ClassINET, Ttl: peerReverseTTL},
+			Ptr: dns.Fqdn(fqdn),
+		}}
+		resutil.SetMeta(w, "peer_reverse", "true")
+	}
+	if err := w.WriteMsg(resp); err != nil {
+		log.Errorf("failed to write peer reverse response for %s: %v", req.Question[0].Name, err)
+	}
+}
+
+// lookup returns the FQDN of the peer holding the address of the reverse
+// name qname, empty if the address is outside the NetBird network or no
+// peer holds it.
+func (r *peerReverseResolver) lookup(qname string) string {
+	s, ok := resutil.PTRQueryAddr(qname)
+	if !ok {
+		return ""
+	}
+	addr, err := netip.ParseAddr(s)
+	if err != nil {
+		return ""
+	}
+
+	local := r.wgInterface.Address()
+	if !local.Network.Contains(addr) && !(local.IPv6Net.IsValid() && local.IPv6Net.Contains(addr)) {
+		return ""
+	}
+	if addr == local.IP || addr == local.IPv6 {
+		return r.status.GetLocalPeerState().FQDN
+	}
+	state, ok := r.status.PeerStateByIP(addr.String())
+	if !ok {
+		return ""
+	}
+	return state.FQDN
+}
+
+// enablePeerReverse answers PTR queries for the addresses of the NetBird
+// network with the FQDNs of the peers.
+func (s *DefaultServer) enablePeerReverse() {
+	if s.wgInterface == nil || s.statusRecorder == nil {
+		return
+	}
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	s.registerHandler(reverseZones, &peerReverseResolver{wgInterface: s.wgInterface, status: s.statusRecorder}, PriorityPeerReverse)
+}
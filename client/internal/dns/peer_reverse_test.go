@@ -0,0 +1,57 @@
+package dns
+
+import (
+	"testing"
+
+	"github.com/miekg/dns"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/netbirdio/netbird/client/internal/dns/test"
+	"github.com/netbirdio/netbird/client/internal/peer"
+)
+
+func TestPeerReverseResolver(t *testing.T) {
+	status := peer.NewRecorder("mgm")
+	require.NoError(t, status.AddPeer("peer-key", "peer.netbird.cloud", "100.66.100.2", ""))
+	status.UpdateLocalPeerState(peer.LocalPeerState{IP: "100.66.100.1/24", FQDN: "self.netbird.cloud"})
+	resolver := &peerReverseResolver{wgInterface: &mocWGIface{}, status: status}
+
+	query := func(ip string, qtype uint16) *dns.Msg {
+		name, err := dns.ReverseAddr(ip)
+		require.NoError(t, err)
+		var resp *dns.Msg
+		resolver.ServeDNS(&test.MockResponseWriter{
+			WriteMsgFunc: func(m *dns.Msg) error {
+				resp = m
+				return nil
+			},
+		}, new(dns.Msg).SetQuestion(name, qtype))
+		require.NotNil(t, resp)
+		return resp
+	}
+	ptr := func(resp *dns.Msg) string {
+		require.Len(t, resp.Answer, 1)
+		return resp.Answer[0].(*dns.PTR).Ptr
+	}
+
+	assert.Equal(t, "peer.netbird.cloud.", ptr(query("100.66.100.2", dns.TypePTR)))
+	assert.Equal(t, "self.netbird.cloud.", ptr(query("100.66.100.1", dns.TypePTR)), "the own address is answered too")
+
+	for _, tc := range []struct {
+		ip    string
+		qtype uint16
+		why   string
+	}{
+		{ip: "100.66.100.3", qtype: dns.TypePTR, why: "no peer holds the address"},
+		{ip: "10.0.0.2", qtype: dns.TypePTR, why: "outside the network"},
+		{ip: "100.66.100.2", qtype: dns.TypeTXT, why: "not a PTR query"},
+	} {
+		resp := query(tc.ip, tc.qtype)
+		assert.Empty(t, resp.Answer, tc.why)
+		assert.True(t, resp.MsgHdr.Zero, "%s: passed on to the next handler", tc.why)
+	}
+
+	require.NoError(t, status.RemovePeer("peer-key"))
+	assert.True(t, query("100.66.100.2", dns.TypePTR).MsgHdr.Zero, "peers that left are no longer answered")
+}
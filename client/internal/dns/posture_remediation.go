@@ -0,0 +1,158 @@
+package dns
+
+import (
+	"fmt"
+	"net/netip"
+	"strings"
+	"sync/atomic"
+
+	"github.com/miekg/dns"
+	log "github.com/sirupsen/logrus"
+
+	"github.com/netbirdio/netbird/client/internal/dns/resutil"
+	"github.com/netbirdio/netbird/client/internal/dns/types"
+	nbdns "github.com/netbirdio/netbird/dns"
+)
+
+// postureRemediationTTL is the TTL of remediation answers, kept short so
+// clients stop using them soon after the peer passes its posture checks.
+const postureRemediationTTL = 30
+
+// PostureRemediationConfig redirects DNS to a remediation page while the
+// peer fails its posture checks.
+type PostureRemediationConfig struct {
+	// Address is the remediation page's address the Domains resolve to.
+	Address netip.Addr
+	// Domains and their subdomains resolve to Address while the peer is
+	// blocked. Every other name is answered with NXDOMAIN.
+	Domains []string
+}
+
+// ParsePostureRemediationConfig builds a PostureRemediationConfig from its
+// string form. An empty address disables the feature and returns nil.
+func ParsePostureRemediationConfig(address string, domains []string) (*PostureRemediationConfig, error) {
+	if address == "" {
+		return nil, nil
+	}
+
+	addr, err := netip.ParseAddr(address)
+	if err != nil {
+		return nil, fmt.Errorf("parse posture remediation address %q: %w", address, err)
+	}
+	if len(domains) == 0 {
+		return nil, fmt.Errorf("posture remediation address %s requires at least one domain", addr)
+	}
+
+	config := &PostureRemediationConfig{Address: addr.Unmap()}
+	for _, d := range domains {
+		config.Domains = append(config.Domains, strings.ToLower(dns.Fqdn(d)))
+	}
+	return config, nil
+}
+
+// postureRemediationHandler answers every query while the peer is blocked by
+// its posture checks: the remediation domains with the remediation address,
+// any other name with NXDOMAIN. Otherwise queries fall through to the next
+// handler.
+type postureRemediationHandler struct {
+	config  PostureRemediationConfig
+	blocked atomic.Bool
+}
+
+func (h *postureRemediationHandler) String() string {
+	return fmt.Sprintf("PostureRemediationHandler (%s)", h.config.Address)
+}
+
+func (h *postureRemediationHandler) ID() types.HandlerID {
+	return "posture-remediation"
+}
+
+func (h *postureRemediationHandler) MatchSubdomains() bool {
+	return true
+}
+
+func (h *postureRemediationHandler) Stop() {
+	// nothing to release
+}
+
+// isRemediationDomain reports whether qname is one of the remediation
+// domains or below one.
+func (h *postureRemediationHandler) isRemediationDomain(qname string) bool {
+	for _, d := range h.config.Domains {
+		if qname == d || strings.HasSuffix(qname, "."+d) {
+			return true
+		}
+	}
+	return false
+}
+
+func (h *postureRemediationHandler) ServeDNS(w dns.ResponseWriter, req *dns.Msg) {
+	if len(req.Question) == 0 {
+		return
+	}
+	q := req.Question[0]
+
+	resp := new(dns.Msg)
+	if !h.blocked.Load() {
+		resp.SetRcode(req, dns.RcodeNameError)
+		resp.MsgHdr.Zero = true
+		_ = w.WriteMsg(resp)
+		return
+	}
+
+	addr := h.config.Address
+	hdr := dns.RR_Header{Name: q.Name, Class: dns.ClassINET, Ttl: postureRemediationTTL}
+	switch {
+	case !h.isRemediationDomain(strings.ToLower(q.Name)):
+		resp.SetRcode(req, dns.RcodeNameError)
+		resutil.SetEDE(resp, req, dns.ExtendedErrorCodeBlocked)
+	case q.Qtype == dns.TypeA && addr.Is4():
+		resp.SetReply(req)
+		hdr.Rrtype = dns.TypeA
+		resp.Answer = append(resp.Answer, &dns.A{Hdr: hdr, A: addr.AsSlice()})
+	case q.Qtype == dns.TypeAAAA && addr.Is6():
+		resp.SetReply(req)
+		hdr.Rrtype = dns.TypeAAAA
+		resp.Answer = append(resp.Answer, &dns.AAAA{Hdr: hdr, AAAA: addr.AsSlice()})
+	default:
+		resp.SetReply(req)
+	}
+	resutil.SetMeta(w, "posture", "blocked")
+	if err := w.WriteMsg(resp); err != nil {
+		log.Errorf("failed to write posture remediation response for %s: %v", q.Name, err)
+	}
+}
+
+// enablePostureRemediation registers the remediation handler for every
+// name. It is registered above every handler answering client queries and
+// below the management cache only, so the client keeps reaching management
+// and learns when the peer passes its posture checks again.
+func (s *DefaultServer) enablePostureRemediation(config PostureRemediationConfig) {
+	handler := &postureRemediationHandler{config: config}
+
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	s.postureRemediation = handler
+	s.registerHandler([]string{nbdns.RootZone}, handler, PriorityPostureRemediation)
+}
+
+// SetPostureBlocked switches the remediation redirect on while the peer
+// fails its posture checks. It is a no-op without a PostureRemediation
+// config.
+func (s *DefaultServer) SetPostureBlocked(blocked bool) {
+	s.mux.Lock()
+	handler := s.postureRemediation
+	s.mux.Unlock()
+	if handler == nil {
+		return
+	}
+
+	if handler.blocked.Swap(blocked) == blocked {
+		return
+	}
+	if blocked {
+		log.Infof("peer fails its posture checks, redirecting %v to %s", handler.config.Domains, handler.config.Address)
+	} else {
+		log.Info("peer passes its posture checks, lifting the DNS remediation redirect")
+	}
+}
@@ -0,0 +1,94 @@
+package dns
+
+import (
+	"net/netip"
+	"testing"
+
+	"github.com/miekg/dns"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/netbirdio/netbird/client/internal/dns/test"
+)
+
+func TestParsePostureRemediationConfig(t *testing.T) {
+	config, err := ParsePostureRemediationConfig("", []string{"example.com"})
+	require.NoError(t, err)
+	assert.Nil(t, config, "an empty address disables the redirect")
+
+	config, err = ParsePostureRemediationConfig("::ffff:192.0.2.10", []string{"Remediate.Example.com", "portal.example."})
+	require.NoError(t, err)
+	assert.Equal(t, netip.MustParseAddr("192.0.2.10"), config.Address)
+	assert.Equal(t, []string{"remediate.example.com.", "portal.example."}, config.Domains)
+
+	_, err = ParsePostureRemediationConfig("not-an-ip", []string{"example.com"})
+	assert.Error(t, err)
+	_, err = ParsePostureRemediationConfig("192.0.2.10", nil)
+	assert.Error(t, err, "a redirect without domains blocks every name")
+}
+
+func TestDefaultServer_PostureRemediation(t *testing.T) {
+	server := newTestServer(nil)
+	config, err := ParsePostureRemediationConfig("192.0.2.10", []string{"remediate.example.com"})
+	require.NoError(t, err)
+	server.enablePostureRemediation(*config)
+	server.handlerChain.AddHandler("remediate.example.com.", dualStackUpstream, PriorityUpstream)
+	server.handlerChain.AddHandler("app.example.com.", dualStackUpstream, PriorityUpstream)
+
+	query := func(name string, qtype uint16) *dns.Msg {
+		r := new(dns.Msg).SetQuestion(name, qtype)
+		r.SetEdns0(dns.DefaultMsgSize, false)
+		w := &test.MockResponseWriter{}
+		server.handlerChain.ServeDNS(w, r)
+		resp := w.GetLastResponse()
+		require.NotNil(t, resp)
+		return resp
+	}
+	answer := func(resp *dns.Msg) string {
+		require.Equal(t, dns.RcodeSuccess, resp.Rcode)
+		require.Len(t, resp.Answer, 1)
+		switch rr := resp.Answer[0].(type) {
+		case *dns.A:
+			return rr.A.String()
+		case *dns.AAAA:
+			return rr.AAAA.String()
+		}
+		return ""
+	}
+
+	assert.Equal(t, "10.1.2.3", answer(query("app.example.com.", dns.TypeA)), "allowed peers resolve as usual")
+	assert.Equal(t, "10.1.2.3", answer(query("remediate.example.com.", dns.TypeA)))
+
+	server.SetPostureBlocked(true)
+	assert.Equal(t, "192.0.2.10", answer(query("remediate.example.com.", dns.TypeA)))
+	assert.Equal(t, "192.0.2.10", answer(query("www.Remediate.example.com.", dns.TypeA)), "subdomains are redirected too")
+
+	resp := query("remediate.example.com.", dns.TypeAAAA)
+	assert.Equal(t, dns.RcodeSuccess, resp.Rcode)
+	assert.Empty(t, resp.Answer, "AAAA is NODATA for an IPv4 remediation address")
+
+	resp = query("app.example.com.", dns.TypeA)
+	assert.Equal(t, dns.RcodeNameError, resp.Rcode, "other names are blocked")
+	assert.Empty(t, resp.Answer)
+	require.NotNil(t, resp.IsEdns0())
+	require.Len(t, resp.IsEdns0().Option, 1)
+	assert.Equal(t, dns.ExtendedErrorCodeBlocked, resp.IsEdns0().Option[0].(*dns.EDNS0_EDE).InfoCode)
+
+	resp = query("unhandled.test.", dns.TypeA)
+	assert.Equal(t, dns.RcodeNameError, resp.Rcode, "names without a handler are blocked as well")
+
+	server.SetPostureBlocked(false)
+	assert.Equal(t, "10.1.2.3", answer(query("app.example.com.", dns.TypeA)), "the redirect is lifted")
+	assert.Equal(t, "10.1.2.3", answer(query("remediate.example.com.", dns.TypeA)))
+}
+
+func TestDefaultServer_PostureRemediationDisabled(t *testing.T) {
+	server := newTestServer(nil)
+	server.handlerChain.AddHandler("app.example.com.", dualStackUpstream, PriorityUpstream)
+	server.SetPostureBlocked(true)
+
+	w := &test.MockResponseWriter{}
+	server.handlerChain.ServeDNS(w, new(dns.Msg).SetQuestion("app.example.com.", dns.TypeA))
+	require.NotNil(t, w.GetLastResponse())
+	assert.Equal(t, dns.RcodeSuccess, w.GetLastResponse().Rcode, "without a config the posture state is ignored")
+}
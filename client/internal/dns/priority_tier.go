@@ -0,0 +1,101 @@
+package dns
+
+import (
+	"fmt"
+)
+
+// PriorityTier is the band of handler chain priorities reserved for one kind
+// of handler. A tier's Max is the Priority* constant handlers of that kind
+// register with; the priorities below it, down to Min, are free for
+// sub-priorities ordering several handlers of the same kind. Tiers don't
+// overlap, so a sub-priority never ends up ranking with a different kind of
+// handler.
+type PriorityTier struct {
+	// Name identifies the tier, e.g. in audit records.
+	Name string
+	Min  int
+	Max  int
+}
+
+var (
+	TierMgmtCache      = PriorityTier{Name: "mgmt-cache", Min: PriorityPostureRemediation + 1, Max: PriorityMgmtCache}
+	TierPosture        = PriorityTier{Name: "posture-remediation", Min: PriorityTimePolicy + 1, Max: PriorityPostureRemediation}
+	TierTimePolicy     = PriorityTier{Name: "time-policy", Min: PriorityCaptivePortal + 1, Max: PriorityTimePolicy}
+	TierCaptivePortal  = PriorityTier{Name: "captive-portal", Min: PriorityDNSRoute + 1, Max: PriorityCaptivePortal}
+	TierDNSRoute       = PriorityTier{Name: "dns-route", Min: PriorityLocal + 1, Max: PriorityDNSRoute}
+	TierLocal          = PriorityTier{Name: "local", Min: PriorityPeerReverse + 1, Max: PriorityLocal}
+	TierPeerReverse    = PriorityTier{Name: "peer-reverse", Min: PriorityLoopback + 1, Max: PriorityPeerReverse}
+	TierLoopback       = PriorityTier{Name: "loopback", Min: PrioritySearchDomain + 1, Max: PriorityLoopback}
+	TierSearchDomain   = PriorityTier{Name: "search-domain", Min: PriorityMirror + 1, Max: PrioritySearchDomain}
+	TierMirror         = PriorityTier{Name: "mirror", Min: PrioritySuppressAAAA + 1, Max: PriorityMirror}
+	TierSuppressAAAA   = PriorityTier{Name: "suppress-aaaa", Min: PriorityReverseCache + 1, Max: PrioritySuppressAAAA}
+	TierReverseCache   = PriorityTier{Name: "reverse-cache", Min: PriorityUpstream + 1, Max: PriorityReverseCache}
+	TierUpstream       = PriorityTier{Name: "upstream", Min: PriorityDefault + 1, Max: PriorityUpstream}
+	TierDefault        = PriorityTier{Name: "default", Min: PriorityFallback + 1, Max: PriorityDefault}
+	TierFallback       = PriorityTier{Name: "fallback", Min: PriorityPrivateReverse + 1, Max: PriorityFallback}
+	TierPrivateReverse = PriorityTier{Name: "private-reverse", Min: PriorityUnmatched + 1, Max: PriorityPrivateReverse}
+	TierUnmatched      = PriorityTier{Name: "unmatched", Min: PriorityUnmatched, Max: PriorityUnmatched}
+)
+
+// PriorityTiers lists every tier from the highest to the lowest priority.
+var PriorityTiers = []PriorityTier{
+	TierMgmtCache,
+	TierPosture,
+	TierTimePolicy,
+	TierCaptivePortal,
+	TierDNSRoute,
+	TierLocal,
+	TierPeerReverse,
+	TierLoopback,
+	TierSearchDomain,
+	TierMirror,
+	TierSuppressAAAA,
+	TierReverseCache,
+	TierUpstream,
+	TierDefault,
+	TierFallback,
+	TierPrivateReverse,
+	TierUnmatched,
+}
+
+// TierOf returns the tier priority belongs to, false if it is outside every
+// tier.
+func TierOf(priority int) (PriorityTier, bool) {
+	for _, tier := range PriorityTiers {
+		if tier.Contains(priority) {
+			return tier, true
+		}
+	}
+	return PriorityTier{}, false
+}
+
+// Contains reports whether priority is within the tier.
+func (t PriorityTier) Contains(priority int) bool {
+	return priority >= t.Min && priority <= t.Max
+}
+
+// Validate returns an error if priority is outside the tier.
+func (t PriorityTier) Validate(priority int) error {
+	if !t.Contains(priority) {
+		return fmt.Errorf("priority %d is outside the %s tier [%d, %d]", priority, t.Name, t.Min, t.Max)
+	}
+	return nil
+}
+
+// Sub returns the priority offset places below the tier's base priority, so
+// the handler registered with it is tried after those with smaller offsets.
+// It fails if the offset is negative or leaves the tier.
+func (t PriorityTier) Sub(offset int) (int, error) {
+	if offset < 0 || offset > t.Max-t.Min {
+		return 0, fmt.Errorf("sub-priority %d exceeds the %s tier, which has %d", offset, t.Name, t.Max-t.Min+1)
+	}
+	return t.Max - offset, nil
+}
+
+// validatePriority returns an error if priority is outside every tier.
+func validatePriority(priority int) error {
+	if _, ok := TierOf(priority); !ok {
+		return fmt.Errorf("priority %d is outside every tier [%d, %d]", priority, PriorityUnmatched, PriorityMgmtCache)
+	}
+	return nil
+}
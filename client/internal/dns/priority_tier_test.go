@@ -0,0 +1,112 @@
+package dns
+
+import (
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/netbirdio/netbird/shared/management/domain"
+)
+
+func TestPriorityTiers_Contiguous(t *testing.T) {
+	require.NotEmpty(t, PriorityTiers)
+	assert.Equal(t, PriorityMgmtCache, PriorityTiers[0].Max, "the first tier holds the highest priority")
+	assert.Equal(t, PriorityUnmatched, PriorityTiers[len(PriorityTiers)-1].Min, "the last tier holds the lowest priority")
+
+	for i, tier := range PriorityTiers {
+		assert.LessOrEqual(t, tier.Min, tier.Max, tier.Name)
+		if i > 0 {
+			assert.Equal(t, PriorityTiers[i-1].Min-1, tier.Max, "%s must start right below %s", tier.Name, PriorityTiers[i-1].Name)
+		}
+	}
+}
+
+func TestPriorityTiers_Constants(t *testing.T) {
+	for priority, want := range map[int]PriorityTier{
+		PriorityMgmtCache:          TierMgmtCache,
+		PriorityPostureRemediation: TierPosture,
+		PriorityTimePolicy:         TierTimePolicy,
+		PriorityCaptivePortal:      TierCaptivePortal,
+		PriorityDNSRoute:           TierDNSRoute,
+		PriorityLocal:              TierLocal,
+		PriorityPeerReverse:        TierPeerReverse,
+		PriorityLoopback:           TierLoopback,
+		PrioritySearchDomain:       TierSearchDomain,
+		PriorityMirror:             TierMirror,
+		PrioritySuppressAAAA:       TierSuppressAAAA,
+		PriorityReverseCache:       TierReverseCache,
+		PriorityUpstream:           TierUpstream,
+		PriorityDefault:            TierDefault,
+		PriorityFallback:           TierFallback,
+		PriorityPrivateReverse:     TierPrivateReverse,
+		PriorityUnmatched:          TierUnmatched,
+	} {
+		tier, ok := TierOf(priority)
+		require.True(t, ok, "priority %d", priority)
+		assert.Equal(t, want, tier)
+		assert.Equal(t, priority, tier.Max, "the constant is the base priority of %s", tier.Name)
+		assert.Equal(t, tier.Name, handlerType(priority))
+	}
+}
+
+func TestPriorityTier_Boundaries(t *testing.T) {
+	for _, tier := range PriorityTiers {
+		t.Run(tier.Name, func(t *testing.T) {
+			for _, priority := range []int{tier.Min, tier.Max} {
+				assert.True(t, tier.Contains(priority))
+				assert.NoError(t, tier.Validate(priority))
+				got, ok := TierOf(priority)
+				require.True(t, ok)
+				assert.Equal(t, tier, got)
+			}
+			for _, priority := range []int{tier.Min - 1, tier.Max + 1} {
+				assert.False(t, tier.Contains(priority))
+				assert.Error(t, tier.Validate(priority))
+				if got, ok := TierOf(priority); ok {
+					assert.NotEqual(t, tier.Name, got.Name)
+				}
+			}
+		})
+	}
+
+	for _, priority := range []int{PriorityUnmatched - 1, PriorityMgmtCache + 1} {
+		_, ok := TierOf(priority)
+		assert.False(t, ok, "priority %d", priority)
+		assert.Error(t, validatePriority(priority))
+		assert.Equal(t, "priority-"+strconv.Itoa(priority), handlerType(priority))
+	}
+}
+
+func TestPriorityTier_Sub(t *testing.T) {
+	for _, tier := range PriorityTiers {
+		t.Run(tier.Name, func(t *testing.T) {
+			width := tier.Max - tier.Min
+
+			priority, err := tier.Sub(0)
+			require.NoError(t, err)
+			assert.Equal(t, tier.Max, priority)
+
+			priority, err = tier.Sub(width)
+			require.NoError(t, err)
+			assert.Equal(t, tier.Min, priority)
+
+			_, err = tier.Sub(width + 1)
+			assert.Error(t, err, "sub-priorities must not leak into the next tier")
+			_, err = tier.Sub(-1)
+			assert.Error(t, err, "sub-priorities must not leak into the previous tier")
+		})
+	}
+}
+
+func TestDefaultServer_RegisterHandlerRejectsInvalidPriority(t *testing.T) {
+	server := newTestServer(nil)
+
+	server.RegisterHandler(domain.List{"example.com"}, &mockHandler{Id: "h"}, PriorityMgmtCache+1)
+	assert.False(t, chainHasPattern(server, "example.com.", PriorityMgmtCache+1))
+	assert.Empty(t, server.extraHandlers, "rejected handlers must not be tracked")
+
+	server.RegisterHandler(domain.List{"example.com"}, &mockHandler{Id: "h"}, PriorityDNSRoute-1)
+	assert.True(t, chainHasPattern(server, "example.com.", PriorityDNSRoute-1), "sub-priorities within a tier are accepted")
+}
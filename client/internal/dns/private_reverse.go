@@ -0,0 +1,182 @@
+package dns
+
+import (
+	"fmt"
+	"net/netip"
+	"strings"
+
+	"github.com/miekg/dns"
+	log "github.com/sirupsen/logrus"
+
+	"github.com/netbirdio/netbird/client/internal/dns/resutil"
+	"github.com/netbirdio/netbird/client/internal/dns/types"
+)
+
+// PrivateReverseMode is how queries for the reverse zones of private
+// address ranges are handled, see ParsePrivateReverseMode.
+type PrivateReverseMode int
+
+const (
+	// PrivateReverseForward forwards them like every other query.
+	PrivateReverseForward PrivateReverseMode = iota
+	// PrivateReversePrivateUpstreams forwards them to private, loopback and
+	// link-local upstreams only and answers NXDOMAIN if there are none.
+	PrivateReversePrivateUpstreams
+	// PrivateReverseNXDomain answers them locally, with NXDOMAIN unless a
+	// custom zone, like the peers' reverse zone, or the reverse cache knows
+	// the name.
+	PrivateReverseNXDomain
+)
+
+// privateReverseNegativeTTL is the SOA minimum of the NXDOMAIN answers,
+// the time clients cache them.
+const privateReverseNegativeTTL = 300
+
+// privateReverseZones are the reverse zones of the private, shared and
+// link-local address ranges that RFC 6303 and RFC 7793 recommend answering
+// locally.
+var privateReverseZones = func() []string {
+	zones := []string{"10.in-addr.arpa.", "168.192.in-addr.arpa.", "254.169.in-addr.arpa."}
+	for octet := 16; octet <= 31; octet++ {
+		zones = append(zones, fmt.Sprintf("%d.172.in-addr.arpa.", octet))
+	}
+	for octet := 64; octet <= 127; octet++ {
+		zones = append(zones, fmt.Sprintf("%d.100.in-addr.arpa.", octet))
+	}
+	return append(zones, "d.f.ip6.arpa.", "8.e.f.ip6.arpa.", "9.e.f.ip6.arpa.", "a.e.f.ip6.arpa.", "b.e.f.ip6.arpa.")
+}()
+
+// ParsePrivateReverseMode returns the mode for "forward", "private" or
+// "nxdomain". An empty mode forwards like before.
+func ParsePrivateReverseMode(mode string) (PrivateReverseMode, error) {
+	switch strings.ToLower(mode) {
+	case "", "forward":
+		return PrivateReverseForward, nil
+	case "private":
+		return PrivateReversePrivateUpstreams, nil
+	case "nxdomain":
+		return PrivateReverseNXDomain, nil
+	default:
+		return PrivateReverseForward, fmt.Errorf("unknown private reverse zone mode %q", mode)
+	}
+}
+
+// privateReverseZone returns the private reverse zone qname is in, empty if
+// it isn't in one.
+func privateReverseZone(qname string) string {
+	qname = strings.ToLower(dns.Fqdn(qname))
+	if !strings.HasSuffix(qname, ".arpa.") {
+		return ""
+	}
+	for _, zone := range privateReverseZones {
+		if dns.IsSubDomain(zone, qname) {
+			return zone
+		}
+	}
+	return ""
+}
+
+// isPrivateUpstream reports whether private reverse queries may be sent to
+// an upstream at addr without leaking them to a public resolver.
+func isPrivateUpstream(addr netip.Addr) bool {
+	addr = addr.Unmap()
+	return isInternalAddr(addr) || addr.IsLoopback() || addr.IsLinkLocalUnicast()
+}
+
+// setPrivateReverse restricts the upstreams private reverse queries are
+// forwarded to. Called only while the handler is built, for handlers of the
+// root zone: nameserver groups with a reverse zone as match domain are
+// configured for them on purpose.
+func (u *upstreamResolverBase) setPrivateReverse(mode PrivateReverseMode) {
+	u.privateReverse = mode
+}
+
+// passesPrivateReverse reports whether r is a private reverse query the
+// handler must not forward to any of its upstreams.
+func (u *upstreamResolverBase) passesPrivateReverse(r *dns.Msg) bool {
+	if u.privateReverse == PrivateReverseForward || len(r.Question) == 0 || privateReverseZone(r.Question[0].Name) == "" {
+		return false
+	}
+	if u.privateReverse == PrivateReverseNXDomain {
+		return true
+	}
+	for _, upstream := range u.flatUpstreams() {
+		if isPrivateUpstream(upstream.Addr()) {
+			return false
+		}
+	}
+	return true
+}
+
+// privateReverseRace returns the upstreams of group a query for r may be
+// sent to: the private ones for private reverse queries, all otherwise.
+func (u *upstreamResolverBase) privateReverseRace(r *dns.Msg, group upstreamRace) upstreamRace {
+	if u.privateReverse != PrivateReversePrivateUpstreams || len(r.Question) == 0 || privateReverseZone(r.Question[0].Name) == "" {
+		return group
+	}
+	var private upstreamRace
+	for _, upstream := range group {
+		if isPrivateUpstream(upstream.Addr()) {
+			private = append(private, upstream)
+		}
+	}
+	return private
+}
+
+// privateReverseResolver answers the private reverse queries no other handler
+// answered with NXDOMAIN, as RFC 6303 recommends, so they never reach a
+// public resolver.
+type privateReverseResolver struct{}
+
+func (r *privateReverseResolver) String() string {
+	return "PrivateReverseResolver"
+}
+
+func (r *privateReverseResolver) ID() types.HandlerID {
+	return "private-reverse"
+}
+
+func (r *privateReverseResolver) MatchSubdomains() bool {
+	return true
+}
+
+func (r *privateReverseResolver) Stop() {
+	// nothing to release
+}
+
+func (r *privateReverseResolver) ServeDNS(w dns.ResponseWriter, req *dns.Msg) {
+	if len(req.Question) == 0 {
+		return
+	}
+	q := req.Question[0]
+
+	resp := new(dns.Msg)
+	resp.SetRcode(req, dns.RcodeNameError)
+	resp.Authoritative = true
+	if zone := privateReverseZone(q.Name); zone != "" {
+		resp.Ns = append(resp.Ns, &dns.SOA{
+			Hdr:     dns.RR_Header{Name: zone, Rrtype: dns.TypeSOA, Class: dns.ClassINET, Ttl: privateReverseNegativeTTL},
+			Ns:      zone,
+			Mbox:    "nobody.invalid.",
+			Serial:  1,
+			Refresh: 604800,
+			Retry:   86400,
+			Expire:  2419200,
+			Minttl:  privateReverseNegativeTTL,
+		})
+	}
+	resutil.SetMeta(w, "private_reverse", "true")
+	if err := w.WriteMsg(resp); err != nil {
+		log.Errorf("failed to write private reverse response for %s: %v", q.Name, err)
+	}
+}
+
+// enablePrivateReverse registers the resolver answering private reverse
+// queries below every other handler but the unmatched catch-all, so custom
+// zones, the reverse cache and the allowed upstreams are asked first.
+func (s *DefaultServer) enablePrivateReverse(mode PrivateReverseMode) {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	s.privateReverse = mode
+	s.registerHandler(privateReverseZones, &privateReverseResolver{}, PriorityPrivateReverse)
+}
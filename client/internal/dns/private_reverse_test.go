@@ -0,0 +1,137 @@
+package dns
+
+import (
+	"context"
+	"net/netip"
+	"slices"
+	"testing"
+
+	"github.com/miekg/dns"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/netbirdio/netbird/client/internal/dns/test"
+)
+
+func TestParsePrivateReverseMode(t *testing.T) {
+	for input, want := range map[string]PrivateReverseMode{
+		"":         PrivateReverseForward,
+		"forward":  PrivateReverseForward,
+		"Private":  PrivateReversePrivateUpstreams,
+		"nxdomain": PrivateReverseNXDomain,
+	} {
+		mode, err := ParsePrivateReverseMode(input)
+		require.NoError(t, err, input)
+		assert.Equal(t, want, mode, input)
+	}
+	_, err := ParsePrivateReverseMode("drop")
+	assert.Error(t, err)
+}
+
+func TestPrivateReverseZone(t *testing.T) {
+	for qname, want := range map[string]string{
+		"1.0.0.10.in-addr.arpa.":        "10.in-addr.arpa.",
+		"1.1.168.192.IN-ADDR.ARPA":      "168.192.in-addr.arpa.",
+		"5.4.20.172.in-addr.arpa.":      "20.172.in-addr.arpa.",
+		"5.4.32.172.in-addr.arpa.":      "",
+		"1.0.64.100.in-addr.arpa.":      "64.100.in-addr.arpa.",
+		"1.0.128.100.in-addr.arpa.":     "",
+		"1.1.254.169.in-addr.arpa.":     "254.169.in-addr.arpa.",
+		"8.8.8.8.in-addr.arpa.":         "",
+		"1.0.0.0.0.0.0.0.d.f.ip6.arpa.": "d.f.ip6.arpa.",
+		"0.8.e.f.ip6.arpa.":             "8.e.f.ip6.arpa.",
+		"0.c.e.f.ip6.arpa.":             "",
+		"10.in-addr.arpa.example.com.":  "",
+	} {
+		assert.Equal(t, want, privateReverseZone(qname), qname)
+	}
+}
+
+func TestDefaultServer_PrivateReverse(t *testing.T) {
+	public := netip.MustParseAddrPort("192.0.2.53:53")
+	private := netip.MustParseAddrPort("192.168.1.1:53")
+
+	tests := []struct {
+		name      string
+		mode      PrivateReverseMode
+		upstreams []netip.AddrPort
+		// queried are the upstreams a private reverse query is sent to.
+		queried []netip.AddrPort
+	}{
+		{name: "forward", mode: PrivateReverseForward, upstreams: []netip.AddrPort{public}, queried: []netip.AddrPort{public}},
+		{name: "private upstreams only", mode: PrivateReversePrivateUpstreams, upstreams: []netip.AddrPort{public, private}, queried: []netip.AddrPort{private}},
+		{name: "no private upstream", mode: PrivateReversePrivateUpstreams, upstreams: []netip.AddrPort{public}},
+		{name: "nxdomain", mode: PrivateReverseNXDomain, upstreams: []netip.AddrPort{private}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := newTestServer(nil)
+			if tt.mode != PrivateReverseForward {
+				server.enablePrivateReverse(tt.mode)
+			}
+
+			client := &scriptedUpstreamClient{calls: map[string]int{}}
+			resolver := &upstreamResolverBase{
+				ctx:             context.Background(),
+				upstreamClient:  client,
+				upstreamTimeout: UpstreamTimeout,
+			}
+			// one race per upstream, so every allowed upstream is queried
+			for _, upstream := range tt.upstreams {
+				resolver.addRace([]netip.AddrPort{upstream})
+			}
+			resolver.setPrivateReverse(tt.mode)
+			server.handlerChain.AddHandler(".", resolver, PriorityDefault)
+
+			query := func(name string) *dns.Msg {
+				w := &test.MockResponseWriter{}
+				server.handlerChain.ServeDNS(w, new(dns.Msg).SetQuestion(name, dns.TypePTR))
+				require.NotNil(t, w.GetLastResponse())
+				return w.GetLastResponse()
+			}
+
+			resp := query("1.0.0.10.in-addr.arpa.")
+			calls := client.takeCalls()
+			for _, upstream := range tt.upstreams {
+				assert.Equal(t, slices.Contains(tt.queried, upstream), calls[upstream.String()] > 0, "upstream %s", upstream)
+			}
+			if len(tt.queried) == 0 {
+				assert.Equal(t, dns.RcodeNameError, resp.Rcode)
+				assert.True(t, resp.Authoritative)
+				require.Len(t, resp.Ns, 1)
+				assert.Equal(t, "10.in-addr.arpa.", resp.Ns[0].Header().Name)
+			} else {
+				assert.Equal(t, dns.RcodeSuccess, resp.Rcode)
+			}
+
+			resp = query("8.8.8.8.in-addr.arpa.")
+			assert.Equal(t, dns.RcodeSuccess, resp.Rcode, "public reverse queries are forwarded")
+			assert.NotEmpty(t, client.takeCalls())
+		})
+	}
+}
+
+func TestDefaultServer_PrivateReverseLocalZone(t *testing.T) {
+	server := newTestServer(nil)
+	server.enablePrivateReverse(PrivateReverseNXDomain)
+	server.handlerChain.AddHandler("1.0.64.100.in-addr.arpa.", dns.HandlerFunc(func(w dns.ResponseWriter, r *dns.Msg) {
+		resp := new(dns.Msg).SetReply(r)
+		resp.Answer = append(resp.Answer, &dns.PTR{
+			Hdr: dns.RR_Header{Name: r.Question[0].Name, Rrtype: dns.TypePTR, Class: dns.ClassINET, Ttl: 300},
+			Ptr: "peer.netbird.cloud.",
+		})
+		_ = w.WriteMsg(resp)
+	}), PriorityLocal)
+
+	w := &test.MockResponseWriter{}
+	server.handlerChain.ServeDNS(w, new(dns.Msg).SetQuestion("1.0.64.100.in-addr.arpa.", dns.TypePTR))
+	require.NotNil(t, w.GetLastResponse())
+	require.Len(t, w.GetLastResponse().Answer, 1, "the peers' reverse zone answers first")
+	assert.Equal(t, "peer.netbird.cloud.", w.GetLastResponse().Answer[0].(*dns.PTR).Ptr)
+
+	w = &test.MockResponseWriter{}
+	server.handlerChain.ServeDNS(w, new(dns.Msg).SetQuestion("2.0.64.100.in-addr.arpa.", dns.TypePTR))
+	require.NotNil(t, w.GetLastResponse())
+	assert.Equal(t, dns.RcodeNameError, w.GetLastResponse().Rcode)
+}
@@ -0,0 +1,34 @@
+package dns
+
+import (
+	"slices"
+	"strings"
+
+	"github.com/miekg/dns"
+)
+
+// normalizeQTypes returns qtypes sorted and without duplicates, nil if it
+// is empty, so equal filters compare equal.
+func normalizeQTypes(qtypes []uint16) []uint16 {
+	if len(qtypes) == 0 {
+		return nil
+	}
+	normalized := slices.Clone(qtypes)
+	slices.Sort(normalized)
+	return slices.Compact(normalized)
+}
+
+// qtypesKey returns a comparable form of the normalized qtypes, empty for
+// no filter.
+func qtypesKey(qtypes []uint16) string {
+	names := make([]string, 0, len(qtypes))
+	for _, qtype := range qtypes {
+		names = append(names, dns.Type(qtype).String())
+	}
+	return strings.Join(names, ",")
+}
+
+// matchesType reports whether the entry handles queries of qtype.
+func (e HandlerEntry) matchesType(qtype uint16) bool {
+	return len(e.QTypes) == 0 || slices.Contains(e.QTypes, qtype)
+}
@@ -0,0 +1,90 @@
+package dns
+
+import (
+	"testing"
+
+	"github.com/miekg/dns"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/netbirdio/netbird/client/internal/dns/test"
+	"github.com/netbirdio/netbird/shared/management/domain"
+)
+
+// answeringHandler answers every query with addr.
+func answeringHandler(addr string) dns.Handler {
+	return dns.HandlerFunc(func(w dns.ResponseWriter, r *dns.Msg) {
+		msg := addressAnswer(r.Question[0].Name, 60, addr)
+		msg.SetReply(r)
+		_ = w.WriteMsg(msg)
+	})
+}
+
+// answeredBy returns the address the query for name of qtype was answered
+// with, empty if it wasn't answered.
+func answeredBy(t *testing.T, h dns.Handler, name string, qtype uint16) string {
+	t.Helper()
+
+	w := &test.MockResponseWriter{}
+	h.ServeDNS(w, new(dns.Msg).SetQuestion(name, qtype))
+	resp := w.GetLastResponse()
+	require.NotNil(t, resp)
+	if len(resp.Answer) == 0 {
+		return ""
+	}
+	return resp.Answer[0].(*dns.A).A.String()
+}
+
+func TestNormalizeQTypes(t *testing.T) {
+	assert.Nil(t, normalizeQTypes(nil))
+	assert.Nil(t, normalizeQTypes([]uint16{}))
+	assert.Equal(t, []uint16{dns.TypeA, dns.TypeAAAA}, normalizeQTypes([]uint16{dns.TypeAAAA, dns.TypeA, dns.TypeAAAA}))
+	assert.Equal(t, "A,AAAA", qtypesKey(normalizeQTypes([]uint16{dns.TypeAAAA, dns.TypeA})))
+	assert.Empty(t, qtypesKey(nil))
+}
+
+func TestHandlerChain_QTypeFilter(t *testing.T) {
+	chain := NewHandlerChain()
+	chain.AddHandler("example.com.", answeringHandler("10.0.0.1"), PriorityDNSRoute)
+	chain.AddHandler("example.com.", answeringHandler("10.0.0.6"), PriorityDNSRoute, dns.TypeAAAA, dns.TypeMX)
+	chain.AddHandler("example.com.", answeringHandler("10.0.0.99"), PriorityUpstream, dns.TypeTXT)
+
+	assert.Equal(t, "10.0.0.6", answeredBy(t, chain, "example.com.", dns.TypeAAAA), "type specific handlers go first")
+	assert.Equal(t, "10.0.0.6", answeredBy(t, chain, "example.com.", dns.TypeMX))
+	assert.Equal(t, "10.0.0.1", answeredBy(t, chain, "example.com.", dns.TypeA), "other types fall through")
+	assert.Equal(t, "10.0.0.1", answeredBy(t, chain, "example.com.", dns.TypeTXT), "the filter doesn't outrank priorities")
+
+	chain.AddHandler("example.com.", answeringHandler("10.0.0.7"), PriorityDNSRoute, dns.TypeMX, dns.TypeAAAA)
+	assert.Equal(t, "10.0.0.7", answeredBy(t, chain, "example.com.", dns.TypeAAAA), "the same filter replaces the handler")
+	assert.Equal(t, "10.0.0.1", answeredBy(t, chain, "example.com.", dns.TypeA))
+
+	chain.RemoveHandler("example.com.", PriorityDNSRoute)
+	assert.Equal(t, "10.0.0.7", answeredBy(t, chain, "example.com.", dns.TypeAAAA), "removing the domain handler keeps the typed one")
+	assert.Equal(t, "10.0.0.99", answeredBy(t, chain, "example.com.", dns.TypeTXT))
+
+	chain.RemoveHandler("example.com.", PriorityDNSRoute, dns.TypeAAAA, dns.TypeMX)
+	assert.Empty(t, answeredBy(t, chain, "example.com.", dns.TypeAAAA))
+}
+
+func TestDefaultServer_RegisterHandlerQTypes(t *testing.T) {
+	server := newTestServer(nil)
+	domains := domain.List{"example.com"}
+	server.RegisterHandler(domains, answeringHandler("10.0.0.4"), PriorityDNSRoute, dns.TypeA)
+	server.RegisterHandler(domains, answeringHandler("10.0.0.6"), PriorityDNSRoute, dns.TypeAAAA)
+	server.RegisterHandler(domains, answeringHandler("10.0.0.1"), PriorityDNSRoute)
+
+	assert.Len(t, server.extraHandlers, 3, "typed registrations don't replace each other")
+	assert.Equal(t, "10.0.0.4", answeredBy(t, server.handlerChain, "example.com.", dns.TypeA))
+	assert.Equal(t, "10.0.0.6", answeredBy(t, server.handlerChain, "example.com.", dns.TypeAAAA))
+	assert.Equal(t, "10.0.0.1", answeredBy(t, server.handlerChain, "example.com.", dns.TypeMX))
+
+	server.DeregisterHandler(domains, PriorityDNSRoute, dns.TypeAAAA)
+	assert.Equal(t, "10.0.0.1", answeredBy(t, server.handlerChain, "example.com.", dns.TypeAAAA))
+	assert.Equal(t, "10.0.0.4", answeredBy(t, server.handlerChain, "example.com.", dns.TypeA))
+	assert.Equal(t, 2, server.extraDomains[server.toZone("example.com")])
+
+	server.DeregisterHandler(domains, PriorityDNSRoute, dns.TypeA)
+	server.DeregisterHandler(domains, PriorityDNSRoute)
+	assert.Empty(t, server.extraHandlers)
+	assert.NotContains(t, server.extraDomains, server.toZone("example.com"))
+}
@@ -0,0 +1,66 @@
+package dns
+
+import (
+	"time"
+
+	"github.com/miekg/dns"
+	log "github.com/sirupsen/logrus"
+)
+
+// SetQueryLogging enables or disables logging every answered query at info
+// level, with the handler that answered it, its upstream and the latency.
+// Takes effect with the next query.
+func (c *HandlerChain) SetQueryLogging(enabled bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.queryLog = enabled
+}
+
+// logQuery logs a query answered by the handler of entry, which wrote cw.
+func logQuery(logger *log.Entry, question dns.Question, qname string, entry HandlerEntry, handlerName string, cw *ResponseWriterChain, startTime time.Time) {
+	rcode := "none"
+	if cw.response != nil {
+		rcode = dns.RcodeToString[cw.response.Rcode]
+	}
+	fields := log.Fields{
+		"qname":   qname,
+		"qtype":   dns.TypeToString[question.Qtype],
+		"handler": handlerName,
+		"kind":    handlerType(entry.Priority),
+		"pattern": entry.OrigPattern,
+		"rcode":   rcode,
+		"took":    time.Since(startTime),
+	}
+	if upstream := cw.meta["upstream"]; upstream != "" {
+		fields["upstream"] = upstream
+	}
+	if cw.meta["cache"] == "hit" {
+		fields["cached"] = true
+	}
+	logger.WithFields(fields).Info("DNS query answered")
+}
+
+// logUnansweredQuery logs a query no handler answered.
+func logUnansweredQuery(logger *log.Entry, question dns.Question, qname string, startTime time.Time) {
+	logger.WithFields(log.Fields{
+		"qname":   qname,
+		"qtype":   dns.TypeToString[question.Qtype],
+		"handler": "none",
+		"rcode":   dns.RcodeToString[dns.RcodeRefused],
+		"took":    time.Since(startTime),
+	}).Info("DNS query not handled")
+}
+
+// SetQueryLogging enables or disables logging every query answered by the
+// handler chain. See HandlerChain.SetQueryLogging.
+func (s *DefaultServer) SetQueryLogging(enabled bool) {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+
+	if enabled {
+		log.Info("DNS query logging enabled")
+	} else {
+		log.Info("DNS query logging disabled")
+	}
+	s.handlerChain.SetQueryLogging(enabled)
+}
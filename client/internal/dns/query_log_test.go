@@ -0,0 +1,67 @@
+package dns
+
+import (
+	"testing"
+
+	"github.com/miekg/dns"
+	log "github.com/sirupsen/logrus"
+	logtest "github.com/sirupsen/logrus/hooks/test"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/netbirdio/netbird/client/internal/dns/resutil"
+	"github.com/netbirdio/netbird/client/internal/dns/test"
+)
+
+func TestHandlerChain_QueryLogging(t *testing.T) {
+	hook := logtest.NewGlobal()
+	t.Cleanup(func() { log.StandardLogger().ReplaceHooks(make(log.LevelHooks)) })
+
+	chain := NewHandlerChain()
+	chain.AddHandler("example.com.", dns.HandlerFunc(func(w dns.ResponseWriter, r *dns.Msg) {
+		resutil.SetMeta(w, "upstream", "192.0.2.53:53")
+		resp := new(dns.Msg)
+		resp.SetRcode(r, dns.RcodeNameError)
+		_ = w.WriteMsg(resp)
+	}), PriorityUpstream)
+
+	query := func(name string) {
+		chain.ServeDNS(&test.MockResponseWriter{}, new(dns.Msg).SetQuestion(name, dns.TypeAAAA))
+	}
+	answered := func() []*log.Entry {
+		var entries []*log.Entry
+		for _, e := range hook.AllEntries() {
+			if e.Level == log.InfoLevel {
+				entries = append(entries, e)
+			}
+		}
+		hook.Reset()
+		return entries
+	}
+
+	query("host.example.com.")
+	assert.Empty(t, answered(), "disabled by default")
+
+	chain.SetQueryLogging(true)
+	query("host.example.com.")
+	entries := answered()
+	require.Len(t, entries, 1)
+	assert.Equal(t, "DNS query answered", entries[0].Message)
+	assert.Equal(t, "host.example.com.", entries[0].Data["qname"])
+	assert.Equal(t, "AAAA", entries[0].Data["qtype"])
+	assert.Equal(t, "upstream", entries[0].Data["kind"])
+	assert.Equal(t, "example.com.", entries[0].Data["pattern"])
+	assert.Equal(t, "192.0.2.53:53", entries[0].Data["upstream"])
+	assert.Equal(t, "NXDOMAIN", entries[0].Data["rcode"])
+	assert.Contains(t, entries[0].Data, "took")
+
+	query("other.test.")
+	entries = answered()
+	require.Len(t, entries, 1)
+	assert.Equal(t, "none", entries[0].Data["handler"])
+	assert.Equal(t, "REFUSED", entries[0].Data["rcode"])
+
+	chain.SetQueryLogging(false)
+	query("host.example.com.")
+	assert.Empty(t, answered())
+}
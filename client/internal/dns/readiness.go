@@ -0,0 +1,101 @@
+package dns
+
+import (
+	nbdns "github.com/netbirdio/netbird/dns"
+)
+
+// ReadinessState is how far the DNS server got in taking over the host's DNS.
+type ReadinessState string
+
+const (
+	// ReadinessNotListening: the DNS service doesn't listen for queries.
+	ReadinessNotListening ReadinessState = "not-listening"
+	// ReadinessListening: the DNS service answers queries, but the host
+	// isn't configured to send them to it, or none of the primary
+	// nameserver groups is active.
+	ReadinessListening ReadinessState = "listening"
+	// ReadinessConfigured: the host resolves through the DNS service.
+	ReadinessConfigured ReadinessState = "configured"
+)
+
+// Health is the readiness of the DNS server. Unlike ReadyListener, which
+// fires once, it reflects the current state and can be polled.
+type Health struct {
+	State ReadinessState
+	// Listening reports whether the DNS service listens for queries.
+	Listening bool
+	// HostConfigApplied reports whether the DNS config is applied to the
+	// host by a host manager other than the noop one.
+	HostConfigApplied bool
+	// HostManager names the host manager in use.
+	HostManager string
+	// HostConfigError is why the last host config couldn't be applied, nil
+	// if it was.
+	HostConfigError error
+	// Bypassed reports whether the DNS bypass restored the original
+	// nameservers of the host.
+	Bypassed bool
+	// PrimaryGroups counts the primary nameserver groups and
+	// ActivePrimaryGroups the ones not deactivated by health checks.
+	PrimaryGroups       int
+	ActivePrimaryGroups int
+}
+
+// IsReady reports whether the host resolves through the DNS server.
+func (s *DefaultServer) IsReady() bool {
+	return s.Health().State == ReadinessConfigured
+}
+
+// Health returns the readiness of the DNS server. It is configured once the
+// service listens, the host config is applied and, if there are primary
+// nameserver groups, at least one of them is active. With system DNS
+// disabled the host config is never applied, so it stays listening.
+func (s *DefaultServer) Health() Health {
+	s.mux.Lock()
+	h := Health{
+		Listening:         s.listening,
+		HostConfigApplied: s.hostConfigApplied && !s.isUsingNoopHostManager(),
+		HostManager:       s.hostManager.string(),
+		HostConfigError:   s.hostConfigErr,
+		Bypassed:          s.bypassed,
+	}
+	groups := s.nsGroups
+	s.mux.Unlock()
+
+	h.PrimaryGroups, h.ActivePrimaryGroups = s.countPrimaryGroups(groups)
+
+	switch {
+	case !h.Listening:
+		h.State = ReadinessNotListening
+	case !h.HostConfigApplied || h.Bypassed:
+		h.State = ReadinessListening
+	case h.PrimaryGroups > 0 && h.ActivePrimaryGroups == 0:
+		h.State = ReadinessListening
+	default:
+		h.State = ReadinessConfigured
+	}
+	return h
+}
+
+// countPrimaryGroups returns how many of groups are primary and how many of
+// those are active: they have usable nameservers and weren't deactivated by
+// the health projection.
+func (s *DefaultServer) countPrimaryGroups(groups []*nbdns.NameServerGroup) (primary, active int) {
+	s.healthProjectMu.Lock()
+	defer s.healthProjectMu.Unlock()
+
+	for _, group := range groups {
+		if !group.Primary {
+			continue
+		}
+		primary++
+		if len(s.usableNameServers(group.NameServers)) == 0 {
+			continue
+		}
+		if p, ok := s.nsGroupProj[generateGroupKey(group)]; ok && p.disabled {
+			continue
+		}
+		active++
+	}
+	return primary, active
+}
@@ -0,0 +1,67 @@
+package dns
+
+import (
+	"errors"
+	"net/netip"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/netbirdio/netbird/client/internal/statemanager"
+	nbdns "github.com/netbirdio/netbird/dns"
+)
+
+func TestDefaultServer_Health(t *testing.T) {
+	var applyErr error
+	server := newTestServer(&mockHostConfigurator{
+		applyDNSConfigFunc: func(HostDNSConfig, *statemanager.Manager) error { return applyErr },
+		restoreHostDNSFunc: func() error { return nil },
+	})
+
+	health := server.Health()
+	assert.Equal(t, ReadinessNotListening, health.State)
+	assert.False(t, server.IsReady())
+
+	server.setListening(true)
+	health = server.Health()
+	assert.Equal(t, ReadinessListening, health.State, "listening without a host config applied")
+	assert.False(t, health.HostConfigApplied)
+	assert.Equal(t, "mock", health.HostManager)
+
+	server.applyHostConfig()
+	health = server.Health()
+	assert.Equal(t, ReadinessConfigured, health.State)
+	assert.True(t, health.HostConfigApplied)
+	assert.True(t, server.IsReady())
+
+	group := &nbdns.NameServerGroup{
+		Primary:     true,
+		NameServers: []nbdns.NameServer{{IP: netip.MustParseAddr("100.64.0.1"), NSType: nbdns.UDPNameServerType, Port: 53}},
+	}
+	server.nsGroups = []*nbdns.NameServerGroup{group}
+	health = server.Health()
+	assert.Equal(t, 1, health.PrimaryGroups)
+	assert.Equal(t, 1, health.ActivePrimaryGroups)
+	assert.True(t, server.IsReady())
+
+	server.nsGroupProj = map[nsGroupID]*nsGroupProj{generateGroupKey(group): {disabled: true}}
+	health = server.Health()
+	assert.Equal(t, ReadinessListening, health.State, "all primary groups deactivated")
+	assert.Zero(t, health.ActivePrimaryGroups)
+	server.nsGroupProj = nil
+
+	applyErr = errors.New("dbus unavailable")
+	server.currentConfigHash = ^uint64(0)
+	server.applyHostConfig()
+	health = server.Health()
+	assert.ErrorIs(t, health.HostConfigError, applyErr)
+	assert.True(t, health.HostConfigApplied, "the previously applied config stays in place")
+
+	require.NoError(t, server.disableDNS())
+	health = server.Health()
+	assert.Equal(t, ReadinessNotListening, health.State)
+	assert.False(t, health.HostConfigApplied)
+	assert.NoError(t, health.HostConfigError)
+	assert.Equal(t, "noop", health.HostManager)
+}
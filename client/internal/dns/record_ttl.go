@@ -0,0 +1,47 @@
+package dns
+
+import (
+	"time"
+
+	nbdns "github.com/netbirdio/netbird/dns"
+)
+
+// defaultRecordTTL is the TTL in seconds custom zone records without one
+// are answered with.
+const defaultRecordTTL = 300
+
+// setDefaultRecordTTL sets the TTL custom zone records without one are
+// answered with. A negative ttl keeps their TTL at zero, so clients don't
+// cache them.
+func (s *DefaultServer) setDefaultRecordTTL(ttl time.Duration) {
+	if ttl < 0 {
+		s.defaultRecordTTL = 0
+		return
+	}
+	s.defaultRecordTTL = max(int(ttl/time.Second), 1)
+}
+
+// withDefaultTTL returns records with the zero and negative TTLs replaced by
+// ttl, or records itself if none needs it or ttl is zero. records is not
+// modified, it is shared with the config update.
+func withDefaultTTL(records []nbdns.SimpleRecord, ttl int) []nbdns.SimpleRecord {
+	if ttl <= 0 {
+		return records
+	}
+
+	var out []nbdns.SimpleRecord
+	for i, record := range records {
+		if record.TTL > 0 {
+			continue
+		}
+		if out == nil {
+			out = make([]nbdns.SimpleRecord, len(records))
+			copy(out, records)
+		}
+		out[i].TTL = ttl
+	}
+	if out == nil {
+		return records
+	}
+	return out
+}
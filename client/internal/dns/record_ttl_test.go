@@ -0,0 +1,98 @@
+package dns
+
+import (
+	"net/netip"
+	"testing"
+	"time"
+
+	"github.com/miekg/dns"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/netbirdio/netbird/client/internal/dns/test"
+	nbdns "github.com/netbirdio/netbird/dns"
+)
+
+func TestWithDefaultTTL(t *testing.T) {
+	records := []nbdns.SimpleRecord{
+		{Name: "a.example.com.", Type: int(dns.TypeA), Class: nbdns.DefaultClass, TTL: 0, RData: "10.0.0.1"},
+		{Name: "aaaa.example.com.", Type: int(dns.TypeAAAA), Class: nbdns.DefaultClass, TTL: -1, RData: "fd00::1"},
+		{Name: "cname.example.com.", Type: int(dns.TypeCNAME), Class: nbdns.DefaultClass, TTL: 0, RData: "a.example.com."},
+		nbdns.NewSRVRecord("_sip._tcp.example.com", 0, 10, 5, 5060, "a.example.com"),
+		{Name: "ttl.example.com.", Type: int(dns.TypeA), Class: nbdns.DefaultClass, TTL: 60, RData: "10.0.0.2"},
+	}
+
+	out := withDefaultTTL(records, 120)
+	require.Len(t, out, len(records))
+	for i, rec := range out[:4] {
+		assert.Equal(t, 120, rec.TTL, "%s gets the default TTL", dns.Type(rec.Type))
+		assert.Equal(t, records[i].RData, rec.RData)
+	}
+	assert.Equal(t, 60, out[4].TTL, "explicit TTLs are kept")
+	assert.Equal(t, 0, records[0].TTL, "the input must not be modified")
+
+	assert.Equal(t, records, withDefaultTTL(records, 0), "zero keeps the TTLs")
+	explicit := records[4:]
+	assert.Same(t, &explicit[0], &withDefaultTTL(explicit, 120)[0], "records without zero TTLs are returned as is")
+}
+
+func TestDefaultServer_SetDefaultRecordTTL(t *testing.T) {
+	server := newTestServer(nil)
+
+	server.setDefaultRecordTTL(10 * time.Minute)
+	assert.Equal(t, 600, server.defaultRecordTTL)
+
+	server.setDefaultRecordTTL(100 * time.Millisecond)
+	assert.Equal(t, 1, server.defaultRecordTTL, "sub-second TTLs are rounded up")
+
+	server.setDefaultRecordTTL(-1)
+	assert.Equal(t, 0, server.defaultRecordTTL, "negative opts into no caching")
+}
+
+func TestDefaultServer_DefaultRecordTTL(t *testing.T) {
+	zone := nbdns.CustomZone{
+		Domain: "example.com.",
+		Records: []nbdns.SimpleRecord{
+			{Name: "zero.example.com.", Type: int(dns.TypeA), Class: nbdns.DefaultClass, RData: "10.0.0.1"},
+			{Name: "set.example.com.", Type: int(dns.TypeA), Class: nbdns.DefaultClass, TTL: 30, RData: "10.0.0.2"},
+		},
+		SubnetRecords: []nbdns.SubnetRecordSet{{
+			Subnet:  netip.MustParsePrefix("10.0.0.0/8"),
+			Records: []nbdns.SimpleRecord{{Name: "zero.example.com.", Type: int(dns.TypeA), Class: nbdns.DefaultClass, RData: "10.9.9.9"}},
+		}},
+	}
+
+	ttlOf := func(server *DefaultServer, name string) uint32 {
+		t.Helper()
+		w := &test.MockResponseWriter{}
+		server.localResolver.ServeDNS(w, new(dns.Msg).SetQuestion(name, dns.TypeA))
+		resp := w.GetLastResponse()
+		require.NotNil(t, resp)
+		require.Len(t, resp.Answer, 1)
+		return resp.Answer[0].Header().Ttl
+	}
+
+	t.Run("default", func(t *testing.T) {
+		server := newTestServer(nil)
+		server.defaultRecordTTL = defaultRecordTTL
+		_, zones, err := server.buildLocalHandlerUpdate([]nbdns.CustomZone{zone})
+		require.NoError(t, err)
+		require.Len(t, zones, 1)
+		assert.Equal(t, defaultRecordTTL, zones[0].SubnetRecords[0].Records[0].TTL)
+		assert.Zero(t, zone.SubnetRecords[0].Records[0].TTL, "the update must not be modified")
+
+		server.localResolver.Update(zones)
+		assert.Equal(t, uint32(defaultRecordTTL), ttlOf(server, "zero.example.com."))
+		assert.Equal(t, uint32(30), ttlOf(server, "set.example.com."))
+	})
+
+	t.Run("no cache", func(t *testing.T) {
+		server := newTestServer(nil)
+		server.setDefaultRecordTTL(-1)
+		_, zones, err := server.buildLocalHandlerUpdate([]nbdns.CustomZone{zone})
+		require.NoError(t, err)
+
+		server.localResolver.Update(zones)
+		assert.Equal(t, uint32(0), ttlOf(server, "zero.example.com."))
+	})
+}
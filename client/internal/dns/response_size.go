@@ -0,0 +1,80 @@
+package dns
+
+import (
+	"github.com/miekg/dns"
+	log "github.com/sirupsen/logrus"
+)
+
+// mtuIface is implemented by WireGuard interfaces that report their MTU.
+type mtuIface interface {
+	MTU() uint16
+}
+
+// SetUDPResponseSize bounds the responses to client queries over UDP. A
+// response larger than the size the client advertised, capped at maxSize,
+// is truncated with TC set so the client retries over TCP instead of
+// receiving a response fragmented in the tunnel. Clients without EDNS0 are
+// held to 512 bytes. minSize is the smallest cap, raising a maxSize derived
+// from a small MTU, and never raises what the client advertised. A zero
+// maxSize disables the cap, a zero minSize uses 512 bytes.
+func (c *HandlerChain) SetUDPResponseSize(minSize, maxSize int) {
+	if minSize < dns.MinMsgSize {
+		minSize = dns.MinMsgSize
+	}
+	if maxSize != 0 && maxSize < minSize {
+		maxSize = minSize
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.maxUDPSize = maxSize
+}
+
+// udpResponseLimit returns the largest response to r the client gets over
+// UDP: the size it advertised, at least 512 bytes, capped at maxSize.
+func udpResponseLimit(r *dns.Msg, maxSize int) int {
+	limit := dns.MinMsgSize
+	if opt := r.IsEdns0(); opt != nil {
+		limit = max(int(opt.UDPSize()), dns.MinMsgSize)
+	}
+	if maxSize != 0 {
+		limit = min(limit, maxSize)
+	}
+	return limit
+}
+
+// truncateUDPResponse returns m truncated to limit bytes, with TC set if
+// records were dropped, or m itself if it fits. m is not modified, handlers
+// may hold on to it.
+func truncateUDPResponse(m *dns.Msg, limit int) *dns.Msg {
+	if limit <= 0 || m.Len() <= limit {
+		return m
+	}
+	m = m.Copy()
+	m.Truncate(limit)
+	return m
+}
+
+// defaultMaxUDPResponseSize derives the largest UDP response that fits the
+// tunnel MTU without fragmentation.
+func defaultMaxUDPResponseSize(wgIface WGIface) int {
+	mtu := currentMTU
+	if iface, ok := wgIface.(mtuIface); ok && iface.MTU() > 0 {
+		mtu = iface.MTU()
+	}
+	if mtu <= ipUDPHeaderSize {
+		return dns.MinMsgSize
+	}
+	return int(mtu - ipUDPHeaderSize)
+}
+
+// setUDPResponseSize bounds the UDP responses to clients, see
+// HandlerChain.SetUDPResponseSize. A zero maxSize derives the cap from the
+// tunnel MTU.
+func (s *DefaultServer) setUDPResponseSize(minSize, maxSize int) {
+	if maxSize == 0 {
+		maxSize = defaultMaxUDPResponseSize(s.wgInterface)
+	}
+	log.Debugf("limiting UDP DNS responses to %d bytes", maxSize)
+	s.handlerChain.SetUDPResponseSize(minSize, maxSize)
+}
@@ -0,0 +1,122 @@
+package dns
+
+import (
+	"fmt"
+	"net"
+	"testing"
+
+	"github.com/miekg/dns"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type mtuWGIface struct {
+	WGIface
+	mtu uint16
+}
+
+func (m mtuWGIface) MTU() uint16 { return m.mtu }
+
+func TestHandlerChain_UDPResponseSize(t *testing.T) {
+	// The handler answers with 40 AAAA records, about 1.1KB even with name
+	// compression, which truncation applies first.
+	handler := dns.HandlerFunc(func(w dns.ResponseWriter, r *dns.Msg) {
+		resp := new(dns.Msg).SetReply(r)
+		for i := 0; i < 40; i++ {
+			resp.Answer = append(resp.Answer, &dns.AAAA{
+				Hdr:  dns.RR_Header{Name: r.Question[0].Name, Rrtype: dns.TypeAAAA, Class: dns.ClassINET, Ttl: 300},
+				AAAA: net.ParseIP(fmt.Sprintf("fd00::%x", i+1)),
+			})
+		}
+		_ = w.WriteMsg(resp)
+	})
+
+	chain := NewHandlerChain()
+	chain.AddHandler("big.example.com.", handler, PriorityUpstream)
+	chain.SetUDPResponseSize(0, 1000)
+
+	query := func(network string, ednsSize uint16) *dns.Msg {
+		t.Helper()
+		r := new(dns.Msg).SetQuestion("big.example.com.", dns.TypeAAAA)
+		if ednsSize > 0 {
+			r.SetEdns0(ednsSize, false)
+		}
+		w := &addrResponseWriter{local: &net.UDPAddr{IP: net.IPv4(100, 64, 0, 1), Port: 53}}
+		if network == "tcp" {
+			w.remote = &net.TCPAddr{IP: net.IPv4(100, 64, 0, 2), Port: 40000}
+		} else {
+			w.remote = &net.UDPAddr{IP: net.IPv4(100, 64, 0, 2), Port: 40000}
+		}
+		chain.ServeDNS(w, r)
+		resp := w.GetLastResponse()
+		require.NotNil(t, resp)
+		return resp
+	}
+
+	tests := []struct {
+		network   string
+		ednsSize  uint16
+		limit     int
+		truncated bool
+	}{
+		{network: "udp", ednsSize: 0, limit: dns.MinMsgSize, truncated: true},
+		{network: "udp", ednsSize: 4096, limit: 1000, truncated: true},
+		{network: "udp", ednsSize: 800, limit: 800, truncated: true},
+		{network: "tcp", ednsSize: 0, truncated: false},
+	}
+	for _, tt := range tests {
+		t.Run(fmt.Sprintf("%s edns %d", tt.network, tt.ednsSize), func(t *testing.T) {
+			resp := query(tt.network, tt.ednsSize)
+			assert.Equal(t, tt.truncated, resp.Truncated)
+			if tt.truncated {
+				assert.LessOrEqual(t, resp.Len(), tt.limit)
+				assert.Less(t, len(resp.Answer), 40)
+			} else {
+				assert.Len(t, resp.Answer, 40)
+			}
+		})
+	}
+
+	t.Run("minimum raises a small cap", func(t *testing.T) {
+		chain.SetUDPResponseSize(1200, 600)
+		resp := query("udp", 4096)
+		assert.True(t, resp.Truncated)
+		assert.LessOrEqual(t, resp.Len(), 1200)
+		assert.Greater(t, resp.Len(), 600)
+	})
+
+	t.Run("advertised size is never exceeded", func(t *testing.T) {
+		chain.SetUDPResponseSize(2000, 0)
+		resp := query("udp", 600)
+		assert.True(t, resp.Truncated)
+		assert.LessOrEqual(t, resp.Len(), 600)
+	})
+}
+
+func TestUDPResponseLimit(t *testing.T) {
+	edns := func(size uint16) *dns.Msg {
+		r := new(dns.Msg).SetQuestion("example.com.", dns.TypeA)
+		r.SetEdns0(size, false)
+		return r
+	}
+	assert.Equal(t, dns.MinMsgSize, udpResponseLimit(new(dns.Msg).SetQuestion("example.com.", dns.TypeA), 1400))
+	assert.Equal(t, dns.MinMsgSize, udpResponseLimit(edns(100), 1400), "sizes below 512 mean 512")
+	assert.Equal(t, 800, udpResponseLimit(edns(800), 1400))
+	assert.Equal(t, 1400, udpResponseLimit(edns(4096), 1400))
+	assert.Equal(t, 4096, udpResponseLimit(edns(4096), 0))
+}
+
+func TestDefaultMaxUDPResponseSize(t *testing.T) {
+	assert.Equal(t, 1400-ipUDPHeaderSize, defaultMaxUDPResponseSize(mtuWGIface{mtu: 1400}))
+	assert.Equal(t, int(currentMTU-ipUDPHeaderSize), defaultMaxUDPResponseSize(mtuWGIface{}))
+	assert.Equal(t, dns.MinMsgSize, defaultMaxUDPResponseSize(mtuWGIface{mtu: ipUDPHeaderSize}))
+}
+
+func TestDefaultServer_SetUDPResponseSizeDefault(t *testing.T) {
+	server := &DefaultServer{wgInterface: mtuWGIface{mtu: 1400}, handlerChain: NewHandlerChain()}
+	server.setUDPResponseSize(0, 0)
+	assert.Equal(t, 1400-ipUDPHeaderSize, server.handlerChain.maxUDPSize, "a zero maximum follows the tunnel MTU")
+
+	server.setUDPResponseSize(0, 900)
+	assert.Equal(t, 900, server.handlerChain.maxUDPSize)
+}
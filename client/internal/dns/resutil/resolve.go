@@ -310,7 +310,7 @@ func lookupCNAME(ctx context.Context, r RecordResolver, name, fqdn string, ttl u
 }
 
 func lookupPTR(ctx context.Context, r RecordResolver, name, fqdn string, ttl uint32) ([]dns.RR, int) {
-	addr, ok := ptrQueryAddr(name)
+	addr, ok := PTRQueryAddr(name)
 	if !ok {
 		return nil, dns.RcodeSuccess
 	}
@@ -328,10 +328,10 @@ func lookupPTR(ctx context.Context, r RecordResolver, name, fqdn string, ttl uin
 	return rrs, dns.RcodeSuccess
 }
 
-// ptrQueryAddr converts a reverse-DNS query name (in-addr.arpa or ip6.arpa)
+// PTRQueryAddr converts a reverse-DNS query name (in-addr.arpa or ip6.arpa)
 // into the address string expected by net.Resolver.LookupAddr. It reports false
 // when the name is not a well-formed reverse name.
-func ptrQueryAddr(qname string) (string, bool) {
+func PTRQueryAddr(qname string) (string, bool) {
 	name := strings.TrimSuffix(strings.ToLower(dns.Fqdn(qname)), ".")
 
 	switch {
@@ -467,3 +467,56 @@ func ExtractEDE(msg *dns.Msg) (*dns.EDNS0_EDE, bool) {
 	}
 	return nil, false
 }
+
+// SetEDE attaches an Extended DNS Error (RFC 8914) option to resp. It is a
+// no-op when req didn't advertise EDNS0, since such a client must not receive
+// an OPT RR.
+func SetEDE(resp, req *dns.Msg, code uint16) {
+	reqOpt := req.IsEdns0()
+	if reqOpt == nil {
+		return
+	}
+	opt := resp.IsEdns0()
+	if opt == nil {
+		resp.SetEdns0(reqOpt.UDPSize(), reqOpt.Do())
+		opt = resp.IsEdns0()
+	}
+	opt.Option = append(opt.Option, &dns.EDNS0_EDE{InfoCode: code})
+}
+
+// Negative classifies a response per RFC 2308.
+type Negative int
+
+const (
+	// NotNegative is any response that isn't NXDOMAIN or NODATA.
+	NotNegative Negative = iota
+	// NXDomain means the name does not exist.
+	NXDomain
+	// NoData means the name exists but has no records of the queried type.
+	NoData
+)
+
+// String returns the lowercase name of the classification for logging.
+func (n Negative) String() string {
+	switch n {
+	case NXDomain:
+		return "nxdomain"
+	case NoData:
+		return "nodata"
+	default:
+		return "positive"
+	}
+}
+
+// ClassifyNegative reports whether msg is an NXDOMAIN, a NODATA (NOERROR with
+// an empty answer section) or neither.
+func ClassifyNegative(msg *dns.Msg) Negative {
+	switch {
+	case msg.Rcode == dns.RcodeNameError:
+		return NXDomain
+	case msg.Rcode == dns.RcodeSuccess && len(msg.Answer) == 0:
+		return NoData
+	default:
+		return NotNegative
+	}
+}
@@ -145,7 +145,7 @@ func TestPtrQueryAddr(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			got, ok := ptrQueryAddr(tt.qname)
+			got, ok := PTRQueryAddr(tt.qname)
 			assert.Equal(t, tt.wantOK, ok, "parse success mismatch")
 			if tt.wantOK {
 				assert.Equal(t, tt.want, got, "parsed address mismatch")
@@ -318,3 +318,69 @@ func TestExtractEDE(t *testing.T) {
 		assert.Equal(t, "upstream timeout", ede.ExtraText)
 	})
 }
+
+func TestSetEDE(t *testing.T) {
+	t.Run("request without edns", func(t *testing.T) {
+		resp := &dns.Msg{}
+		SetEDE(resp, &dns.Msg{}, dns.ExtendedErrorCodeNetworkError)
+		assert.Nil(t, resp.IsEdns0(), "no OPT toward a non-EDNS0 client")
+	})
+
+	t.Run("request with edns", func(t *testing.T) {
+		req := &dns.Msg{}
+		req.SetEdns0(1232, true)
+		resp := &dns.Msg{}
+		SetEDE(resp, req, dns.ExtendedErrorCodeNetworkError)
+
+		opt := resp.IsEdns0()
+		require.NotNil(t, opt, "OPT should be added")
+		assert.Equal(t, uint16(1232), opt.UDPSize())
+		assert.True(t, opt.Do(), "DO bit should be echoed")
+		ede, ok := ExtractEDE(resp)
+		require.True(t, ok)
+		assert.Equal(t, dns.ExtendedErrorCodeNetworkError, ede.InfoCode)
+	})
+
+	t.Run("response already has opt", func(t *testing.T) {
+		req := &dns.Msg{}
+		req.SetEdns0(4096, false)
+		resp := &dns.Msg{}
+		resp.SetEdns0(4096, false)
+		SetEDE(resp, req, dns.ExtendedErrorCodeNoReachableAuthority)
+
+		var opts int
+		for _, rr := range resp.Extra {
+			if _, ok := rr.(*dns.OPT); ok {
+				opts++
+			}
+		}
+		assert.Equal(t, 1, opts, "existing OPT should be reused")
+		ede, ok := ExtractEDE(resp)
+		require.True(t, ok)
+		assert.Equal(t, dns.ExtendedErrorCodeNoReachableAuthority, ede.InfoCode)
+	})
+}
+
+func TestClassifyNegative(t *testing.T) {
+	answer := &dns.A{Hdr: dns.RR_Header{Name: "a.example.", Rrtype: dns.TypeA, Class: dns.ClassINET}}
+
+	tests := []struct {
+		name   string
+		rcode  int
+		answer []dns.RR
+		want   Negative
+	}{
+		{name: "nxdomain", rcode: dns.RcodeNameError, want: NXDomain},
+		{name: "nodata", rcode: dns.RcodeSuccess, want: NoData},
+		{name: "positive", rcode: dns.RcodeSuccess, answer: []dns.RR{answer}, want: NotNegative},
+		{name: "servfail", rcode: dns.RcodeServerFailure, want: NotNegative},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			msg := &dns.Msg{Answer: tc.answer}
+			msg.Rcode = tc.rcode
+			assert.Equal(t, tc.want, ClassifyNegative(msg))
+		})
+	}
+}
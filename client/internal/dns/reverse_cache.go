@@ -0,0 +1,225 @@
+package dns
+
+import (
+	"container/list"
+	"fmt"
+	"net"
+	"net/netip"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/miekg/dns"
+	log "github.com/sirupsen/logrus"
+
+	"github.com/netbirdio/netbird/client/internal/dns/resutil"
+	"github.com/netbirdio/netbird/client/internal/dns/types"
+)
+
+const (
+	// reverseCacheMaxTTL caps how long a forward answer is used for PTR.
+	reverseCacheMaxTTL = time.Hour
+	// maxReverseCacheNames bounds the names remembered per address.
+	maxReverseCacheNames = 8
+)
+
+// reverseZones are the reverse-lookup zones the reverse cache is registered on.
+var reverseZones = []string{"in-addr.arpa.", "ip6.arpa."}
+
+// cgnatPrefix is the shared address space NetBird and other overlays use.
+var cgnatPrefix = netip.MustParsePrefix("100.64.0.0/10")
+
+type reverseCacheEntry struct {
+	// ptrName is the reverse name of the address, e.g. 1.0.0.10.in-addr.arpa.
+	ptrName string
+	// names maps every name that resolved to the address to its expiry.
+	names map[string]time.Time
+}
+
+// reverseCache remembers the addresses names of internal zones were resolved
+// to by upstream handlers, so PTR queries for them can be answered with the
+// forward-confirmed names. It keeps at most size addresses, evicting the
+// least recently resolved one.
+type reverseCache struct {
+	size int
+
+	mu      sync.Mutex
+	entries map[string]*list.Element
+	order   *list.List
+}
+
+func newReverseCache(size int) *reverseCache {
+	return &reverseCache{
+		size:    size,
+		entries: make(map[string]*list.Element),
+		order:   list.New(),
+	}
+}
+
+// record remembers the A and AAAA answers in msg owned by a name within zone.
+// Only private and shared addresses are remembered, so names of internal zones
+// never show up for public addresses.
+func (c *reverseCache) record(zone string, msg *dns.Msg) {
+	if zone == "" || zone == "." {
+		return
+	}
+	zone = dns.Fqdn(zone)
+
+	now := time.Now()
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for _, rr := range msg.Answer {
+		var ip net.IP
+		switch rr := rr.(type) {
+		case *dns.A:
+			ip = rr.A
+		case *dns.AAAA:
+			ip = rr.AAAA
+		default:
+			continue
+		}
+
+		name := strings.ToLower(rr.Header().Name)
+		if !dns.IsSubDomain(zone, name) {
+			continue
+		}
+		addr, ok := netip.AddrFromSlice(ip)
+		if !ok || !isInternalAddr(addr.Unmap()) {
+			continue
+		}
+
+		ttl := min(time.Duration(rr.Header().Ttl)*time.Second, reverseCacheMaxTTL)
+		if ttl <= 0 {
+			continue
+		}
+		c.add(addr.Unmap(), name, now.Add(ttl))
+	}
+}
+
+// add stores name for addr with the lock already held.
+func (c *reverseCache) add(addr netip.Addr, name string, expires time.Time) {
+	ptrName, err := dns.ReverseAddr(addr.String())
+	if err != nil {
+		return
+	}
+
+	if elem, ok := c.entries[ptrName]; ok {
+		c.order.MoveToFront(elem)
+		entry := elem.Value.(*reverseCacheEntry)
+		if _, known := entry.names[name]; !known && len(entry.names) >= maxReverseCacheNames {
+			return
+		}
+		entry.names[name] = expires
+		return
+	}
+
+	entry := &reverseCacheEntry{ptrName: ptrName, names: map[string]time.Time{name: expires}}
+	c.entries[ptrName] = c.order.PushFront(entry)
+	for c.order.Len() > c.size {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.entries, oldest.Value.(*reverseCacheEntry).ptrName)
+	}
+}
+
+// lookup returns PTR records for the reverse name qname built from the names
+// that haven't expired, nil if none are known.
+func (c *reverseCache) lookup(qname string) []dns.RR {
+	qname = strings.ToLower(dns.Fqdn(qname))
+	now := time.Now()
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	elem, ok := c.entries[qname]
+	if !ok {
+		return nil
+	}
+	entry := elem.Value.(*reverseCacheEntry)
+
+	var records []dns.RR
+	for name, expires := range entry.names {
+		if !now.Before(expires) {
+			delete(entry.names, name)
+			continue
+		}
+		records = append(records, &dns.PTR{
+			Hdr: dns.RR_Header{Name: qname, Rrtype: dns.TypePTR, Class: dns.ClassINET, Ttl: uint32(expires.Sub(now).Seconds())},
+			Ptr: name,
+		})
+	}
+	if len(entry.names) == 0 {
+		c.order.Remove(elem)
+		delete(c.entries, qname)
+	}
+	return records
+}
+
+func (c *reverseCache) len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.order.Len()
+}
+
+// isInternalAddr reports whether addr is private (RFC 1918, ULA) or in the
+// shared address space.
+func isInternalAddr(addr netip.Addr) bool {
+	return addr.IsPrivate() || cgnatPrefix.Contains(addr)
+}
+
+// reverseCacheResolver answers PTR queries from the reverse cache and passes
+// everything else on to the next handler.
+type reverseCacheResolver struct {
+	cache *reverseCache
+}
+
+func (r *reverseCacheResolver) String() string {
+	return fmt.Sprintf("ReverseCacheResolver [%d addresses]", r.cache.len())
+}
+
+func (r *reverseCacheResolver) ID() types.HandlerID {
+	return "reverse-cache"
+}
+
+func (r *reverseCacheResolver) MatchSubdomains() bool {
+	return true
+}
+
+func (r *reverseCacheResolver) Stop() {
+	// nothing to release
+}
+
+func (r *reverseCacheResolver) ServeDNS(w dns.ResponseWriter, req *dns.Msg) {
+	if len(req.Question) == 0 {
+		return
+	}
+
+	var records []dns.RR
+	if req.Question[0].Qtype == dns.TypePTR {
+		records = r.cache.lookup(req.Question[0].Name)
+	}
+
+	resp := new(dns.Msg)
+	if len(records) == 0 {
+		resp.SetRcode(req, dns.RcodeNameError)
+		resp.MsgHdr.Zero = true
+	} else {
+		resp.SetReply(req)
+		resp.Answer = records
+		resutil.SetMeta(w, "reverse_cache", "true")
+	}
+	if err := w.WriteMsg(resp); err != nil {
+		log.Errorf("failed to write reverse cache response for %s: %v", req.Question[0].Name, err)
+	}
+}
+
+// enableReverseCache makes upstream handlers of nameserver groups with match
+// domains remember their address answers, and answers PTR queries for those
+// addresses with the resolved names.
+func (s *DefaultServer) enableReverseCache(size int) {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	s.reverseCache = newReverseCache(size)
+	s.registerHandler(reverseZones, &reverseCacheResolver{cache: s.reverseCache}, PriorityReverseCache)
+}
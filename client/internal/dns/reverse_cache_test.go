@@ -0,0 +1,148 @@
+package dns
+
+import (
+	"context"
+	"net"
+	"net/netip"
+	"testing"
+	"time"
+
+	"github.com/miekg/dns"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/netbirdio/netbird/client/internal/dns/test"
+)
+
+func addressAnswer(name string, ttl uint32, ips ...string) *dns.Msg {
+	msg := new(dns.Msg).SetQuestion(name, dns.TypeA)
+	msg.Response = true
+	for _, ip := range ips {
+		parsed := net.ParseIP(ip)
+		if parsed.To4() != nil {
+			msg.Answer = append(msg.Answer, &dns.A{
+				Hdr: dns.RR_Header{Name: name, Rrtype: dns.TypeA, Class: dns.ClassINET, Ttl: ttl},
+				A:   parsed,
+			})
+			continue
+		}
+		msg.Answer = append(msg.Answer, &dns.AAAA{
+			Hdr:  dns.RR_Header{Name: name, Rrtype: dns.TypeAAAA, Class: dns.ClassINET, Ttl: ttl},
+			AAAA: parsed,
+		})
+	}
+	return msg
+}
+
+func ptrNames(records []dns.RR) []string {
+	var names []string
+	for _, rr := range records {
+		names = append(names, rr.(*dns.PTR).Ptr)
+	}
+	return names
+}
+
+func TestReverseCache_Record(t *testing.T) {
+	cache := newReverseCache(16)
+
+	cache.record("corp.example.com", addressAnswer("app.corp.example.com.", 300, "10.1.2.3", "fd00::3", "100.64.0.3", "203.0.113.3"))
+	cache.record("corp.example.com", addressAnswer("other.example.net.", 300, "10.1.2.4"))
+	cache.record(".", addressAnswer("root.example.org.", 300, "10.1.2.5"))
+	cache.record("corp.example.com", addressAnswer("zero.corp.example.com.", 0, "10.1.2.6"))
+
+	for _, ip := range []string{"10.1.2.3", "fd00::3", "100.64.0.3"} {
+		ptr, err := dns.ReverseAddr(ip)
+		require.NoError(t, err)
+		records := cache.lookup(ptr)
+		require.Len(t, records, 1, ip)
+		assert.Equal(t, "app.corp.example.com.", records[0].(*dns.PTR).Ptr)
+		assert.Equal(t, ptr, records[0].Header().Name)
+		assert.LessOrEqual(t, records[0].Header().Ttl, uint32(300))
+	}
+
+	for _, ip := range []string{"203.0.113.3", "10.1.2.4", "10.1.2.5", "10.1.2.6"} {
+		ptr, err := dns.ReverseAddr(ip)
+		require.NoError(t, err)
+		assert.Empty(t, cache.lookup(ptr), "%s must not be answered", ip)
+	}
+}
+
+func TestReverseCache_MultipleNames(t *testing.T) {
+	cache := newReverseCache(16)
+	cache.record("corp.example.com", addressAnswer("a.corp.example.com.", 300, "10.1.2.3"))
+	cache.record("corp.example.com", addressAnswer("b.corp.example.com.", 300, "10.1.2.3"))
+
+	assert.ElementsMatch(t, []string{"a.corp.example.com.", "b.corp.example.com."}, ptrNames(cache.lookup("3.2.1.10.in-addr.arpa.")))
+}
+
+func TestReverseCache_Bounded(t *testing.T) {
+	cache := newReverseCache(2)
+	cache.record("corp.example.com", addressAnswer("a.corp.example.com.", 300, "10.0.0.1"))
+	cache.record("corp.example.com", addressAnswer("b.corp.example.com.", 300, "10.0.0.2"))
+	// Using the first address again makes the second the least recent.
+	cache.record("corp.example.com", addressAnswer("a.corp.example.com.", 300, "10.0.0.1"))
+	cache.record("corp.example.com", addressAnswer("c.corp.example.com.", 300, "10.0.0.3"))
+
+	assert.Equal(t, 2, cache.len())
+	assert.NotEmpty(t, cache.lookup("1.0.0.10.in-addr.arpa."))
+	assert.Empty(t, cache.lookup("2.0.0.10.in-addr.arpa."))
+	assert.NotEmpty(t, cache.lookup("3.0.0.10.in-addr.arpa."))
+}
+
+func TestReverseCache_Expiry(t *testing.T) {
+	cache := newReverseCache(16)
+	cache.mu.Lock()
+	cache.add(netip.MustParseAddr("10.0.0.1"), "a.corp.example.com.", time.Now().Add(-time.Second))
+	cache.mu.Unlock()
+
+	assert.Empty(t, cache.lookup("1.0.0.10.in-addr.arpa."))
+	assert.Zero(t, cache.len(), "expired addresses are dropped on lookup")
+}
+
+func TestDefaultServer_ReverseCacheForwardToReverse(t *testing.T) {
+	server := newTestServer(nil)
+	server.enableReverseCache(16)
+
+	upstream := netip.MustParseAddrPort("192.0.2.1:53")
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	handler := &upstreamResolverBase{
+		ctx:    ctx,
+		domain: "corp.example.com",
+		upstreamClient: &mockUpstreamResolverPerServer{
+			responses: map[string]mockUpstreamResponse{
+				upstream.String(): {msg: addressAnswer("app.corp.example.com.", 300, "10.1.2.3")},
+			},
+			rtt: time.Millisecond,
+		},
+		upstreamTimeout: UpstreamTimeout,
+		reverseCache:    server.reverseCache,
+	}
+	handler.addRace([]netip.AddrPort{upstream})
+	server.handlerChain.AddHandler("corp.example.com.", handler, PriorityUpstream)
+
+	query := func(name string, qtype uint16) *dns.Msg {
+		t.Helper()
+		w := &test.MockResponseWriter{}
+		server.handlerChain.ServeDNS(w, new(dns.Msg).SetQuestion(name, qtype))
+		resp := w.GetLastResponse()
+		require.NotNil(t, resp)
+		return resp
+	}
+
+	// Before the forward lookup the reverse name is unknown.
+	resp := query("3.2.1.10.in-addr.arpa.", dns.TypePTR)
+	assert.Empty(t, resp.Answer)
+
+	resp = query("app.corp.example.com.", dns.TypeA)
+	require.Equal(t, dns.RcodeSuccess, resp.Rcode)
+	require.Len(t, resp.Answer, 1)
+
+	resp = query("3.2.1.10.in-addr.arpa.", dns.TypePTR)
+	require.Equal(t, dns.RcodeSuccess, resp.Rcode)
+	assert.Equal(t, []string{"app.corp.example.com."}, ptrNames(resp.Answer))
+
+	// Other record types of the reverse name aren't answered from the cache.
+	resp = query("3.2.1.10.in-addr.arpa.", dns.TypeTXT)
+	assert.Empty(t, resp.Answer)
+}
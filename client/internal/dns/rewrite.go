@@ -0,0 +1,234 @@
+package dns
+
+import (
+	"context"
+	"math"
+	"net/netip"
+	"strings"
+	"sync/atomic"
+
+	"github.com/miekg/dns"
+	log "github.com/sirupsen/logrus"
+
+	"github.com/netbirdio/netbird/shared/management/domain"
+)
+
+// rewriteTTL is the TTL of rewritten records when the upstream answer had
+// none to take it from.
+const rewriteTTL = 60
+
+// RewriteRule rewrites the upstream answers for names matching Pattern.
+// Exactly one of Addr and CNAME is set.
+type RewriteRule struct {
+	// Pattern is a name, e.g. "cdn.example.com", or a wildcard matching
+	// every subdomain, e.g. "*.cdn.example.com".
+	Pattern string
+	// Addr replaces the addresses of the answer: A queries are answered with
+	// it if it is IPv4, AAAA queries if it is IPv6, and the other address
+	// type with NODATA.
+	Addr netip.Addr
+	// CNAME replaces the answer with a CNAME to this name, followed by the
+	// records the name resolves to.
+	CNAME string
+}
+
+// RewriteStat counts the answers a rewrite rule rewrote.
+type RewriteStat struct {
+	Rule RewriteRule
+	Hits uint64
+}
+
+// ParseRewriteRules parses rule specs in format pattern=ip or pattern=name,
+// the latter rewriting to a CNAME. Invalid specs are logged and skipped.
+func ParseRewriteRules(specs []string) []RewriteRule {
+	var rules []RewriteRule
+	for _, spec := range specs {
+		pattern, target, ok := strings.Cut(spec, "=")
+		pattern, target = strings.TrimSpace(pattern), strings.TrimSpace(target)
+		if !ok || pattern == "" || target == "" {
+			log.Warnf("invalid rewrite rule %q, expected pattern=ip or pattern=name", spec)
+			continue
+		}
+		if !domain.IsValidDomain(strings.TrimSuffix(pattern, ".")) {
+			log.Warnf("invalid rewrite rule %q: invalid pattern", spec)
+			continue
+		}
+
+		rule := RewriteRule{Pattern: pattern}
+		if addr, err := netip.ParseAddr(target); err == nil {
+			rule.Addr = addr.Unmap()
+		} else if domain.IsValidDomainNoWildcard(strings.TrimSuffix(target, ".")) {
+			rule.CNAME = target
+		} else {
+			log.Warnf("invalid rewrite rule %q: target is neither an address nor a name", spec)
+			continue
+		}
+		rules = append(rules, rule)
+	}
+	return rules
+}
+
+type rewriteRule struct {
+	RewriteRule
+	// name is the pattern without the wildcard label, lowercase and fully
+	// qualified.
+	name     string
+	wildcard bool
+	cname    string
+	hits     atomic.Uint64
+}
+
+func (r *rewriteRule) matches(qname string) bool {
+	if r.wildcard {
+		return strings.HasSuffix(qname, "."+r.name)
+	}
+	return qname == r.name
+}
+
+// answerRewriter applies rewrite rules to upstream answers. Exact patterns
+// win over wildcards; otherwise the first matching rule applies.
+type answerRewriter struct {
+	rules []*rewriteRule
+	// resolve looks up the records of a CNAME target.
+	resolve func(ctx context.Context, r *dns.Msg) (*dns.Msg, error)
+}
+
+func newAnswerRewriter(rules []RewriteRule, resolve func(ctx context.Context, r *dns.Msg) (*dns.Msg, error)) *answerRewriter {
+	rw := &answerRewriter{resolve: resolve}
+	for _, rule := range rules {
+		r := &rewriteRule{RewriteRule: rule}
+		r.name = strings.ToLower(dns.Fqdn(rule.Pattern))
+		if strings.HasPrefix(r.name, "*.") {
+			r.name = r.name[2:]
+			r.wildcard = true
+		}
+		if rule.CNAME != "" {
+			r.cname = strings.ToLower(dns.Fqdn(rule.CNAME))
+		}
+		rw.rules = append(rw.rules, r)
+	}
+	return rw
+}
+
+func (rw *answerRewriter) match(qname string) *rewriteRule {
+	var wildcard *rewriteRule
+	for _, rule := range rw.rules {
+		if !rule.matches(qname) {
+			continue
+		}
+		if !rule.wildcard {
+			return rule
+		}
+		if wildcard == nil {
+			wildcard = rule
+		}
+	}
+	return wildcard
+}
+
+// rewrite returns the rewritten copy of the successful answer msg and the
+// rule that rewrote it, or msg and nil if no rule matches.
+func (rw *answerRewriter) rewrite(msg *dns.Msg) (*dns.Msg, *rewriteRule) {
+	if msg.Rcode != dns.RcodeSuccess || len(msg.Question) == 0 {
+		return msg, nil
+	}
+	q := msg.Question[0]
+	rule := rw.match(strings.ToLower(q.Name))
+	if rule == nil {
+		return msg, nil
+	}
+
+	ttl := uint32(math.MaxUint32)
+	for _, rr := range msg.Answer {
+		ttl = min(ttl, rr.Header().Ttl)
+	}
+	if ttl == math.MaxUint32 {
+		ttl = rewriteTTL
+	}
+
+	out := msg.Copy()
+	out.Answer = nil
+	out.Authoritative = false
+	hdr := dns.RR_Header{Name: q.Name, Class: dns.ClassINET, Ttl: ttl}
+
+	switch {
+	case rule.cname != "":
+		hdr.Rrtype = dns.TypeCNAME
+		out.Answer = append(out.Answer, &dns.CNAME{Hdr: hdr, Target: rule.cname})
+		if q.Qtype != dns.TypeCNAME {
+			out.Answer = append(out.Answer, rw.resolveTarget(rule.cname, q)...)
+		}
+	case q.Qtype == dns.TypeA && rule.Addr.Is4():
+		hdr.Rrtype = dns.TypeA
+		out.Answer = append(out.Answer, &dns.A{Hdr: hdr, A: rule.Addr.AsSlice()})
+	case q.Qtype == dns.TypeAAAA && rule.Addr.Is6():
+		hdr.Rrtype = dns.TypeAAAA
+		out.Answer = append(out.Answer, &dns.AAAA{Hdr: hdr, AAAA: rule.Addr.AsSlice()})
+	case q.Qtype == dns.TypeA || q.Qtype == dns.TypeAAAA:
+		// NODATA: the upstream addresses of the other type would bypass
+		// the rewrite.
+	default:
+		return msg, nil
+	}
+
+	rule.hits.Add(1)
+	return out, rule
+}
+
+// resolveTarget returns the records of type q.Qtype target resolves to, nil
+// if it can't be resolved. The client can still follow the CNAME then.
+func (rw *answerRewriter) resolveTarget(target string, q dns.Question) []dns.RR {
+	if rw.resolve == nil {
+		return nil
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), UpstreamTimeout)
+	defer cancel()
+
+	resp, err := rw.resolve(ctx, new(dns.Msg).SetQuestion(target, q.Qtype))
+	if err != nil {
+		log.Debugf("failed to resolve rewrite target %s of %s: %v", target, q.Name, err)
+		return nil
+	}
+	return resp.Answer
+}
+
+func (rw *answerRewriter) stats() []RewriteStat {
+	stats := make([]RewriteStat, 0, len(rw.rules))
+	for _, rule := range rw.rules {
+		stats = append(stats, RewriteStat{Rule: rule.RewriteRule, Hits: rule.hits.Load()})
+	}
+	return stats
+}
+
+// SetRewriteRules rewrites answers of upstream handlers (PriorityUpstream
+// and below) to client queries according to rules. CNAME targets are
+// resolved through the chain. Pass nil to disable.
+func (c *HandlerChain) SetRewriteRules(rules []RewriteRule) {
+	var rw *answerRewriter
+	if len(rules) > 0 {
+		rw = newAnswerRewriter(rules, func(ctx context.Context, r *dns.Msg) (*dns.Msg, error) {
+			return c.ResolveInternal(ctx, r, math.MaxInt)
+		})
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.rewriter = rw
+}
+
+// RewriteStats returns how many answers each rewrite rule rewrote.
+func (c *HandlerChain) RewriteStats() []RewriteStat {
+	c.mu.RLock()
+	rw := c.rewriter
+	c.mu.RUnlock()
+
+	if rw == nil {
+		return nil
+	}
+	return rw.stats()
+}
+
+// RewriteStats returns how many answers each rewrite rule rewrote.
+func (s *DefaultServer) RewriteStats() []RewriteStat {
+	return s.handlerChain.RewriteStats()
+}
@@ -0,0 +1,156 @@
+package dns
+
+import (
+	"net/netip"
+	"testing"
+
+	"github.com/miekg/dns"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/netbirdio/netbird/client/internal/dns/test"
+)
+
+func TestParseRewriteRules(t *testing.T) {
+	rules := ParseRewriteRules([]string{
+		"cdn.example.com=10.0.0.5",
+		" *.cdn.example.com = fd00::5 ",
+		"cdn.example.net=mirror.corp.internal",
+		"missing-target=",
+		"no-separator",
+		"bad pattern=10.0.0.1",
+		"cdn.example.org=not a target",
+	})
+
+	assert.Equal(t, []RewriteRule{
+		{Pattern: "cdn.example.com", Addr: netip.MustParseAddr("10.0.0.5")},
+		{Pattern: "*.cdn.example.com", Addr: netip.MustParseAddr("fd00::5")},
+		{Pattern: "cdn.example.net", CNAME: "mirror.corp.internal"},
+	}, rules)
+}
+
+func newRewriteTestChain(t *testing.T, rules ...string) (*HandlerChain, func(name string, qtype uint16) *dns.Msg) {
+	t.Helper()
+
+	chain := NewHandlerChain()
+	chain.AddHandler(".", dualStackUpstream, PriorityUpstream)
+	chain.SetRewriteRules(ParseRewriteRules(rules))
+
+	return chain, func(name string, qtype uint16) *dns.Msg {
+		t.Helper()
+		w := &test.MockResponseWriter{}
+		chain.ServeDNS(w, new(dns.Msg).SetQuestion(name, qtype))
+		resp := w.GetLastResponse()
+		require.NotNil(t, resp)
+		return resp
+	}
+}
+
+func rewriteHits(chain *HandlerChain) map[string]uint64 {
+	hits := make(map[string]uint64)
+	for _, stat := range chain.RewriteStats() {
+		hits[stat.Rule.Pattern] = stat.Hits
+	}
+	return hits
+}
+
+func TestRewrite_IPv4(t *testing.T) {
+	chain, query := newRewriteTestChain(t, "cdn.example.com=10.9.9.9")
+
+	resp := query("CDN.example.com.", dns.TypeA)
+	require.Equal(t, dns.RcodeSuccess, resp.Rcode)
+	require.Len(t, resp.Answer, 1)
+	assert.Equal(t, "10.9.9.9", resp.Answer[0].(*dns.A).A.String())
+	assert.Equal(t, "CDN.example.com.", resp.Answer[0].Header().Name)
+	assert.Equal(t, uint32(300), resp.Answer[0].Header().Ttl, "the upstream TTL is kept")
+
+	resp = query("cdn.example.com.", dns.TypeAAAA)
+	require.Equal(t, dns.RcodeSuccess, resp.Rcode)
+	assert.Empty(t, resp.Answer, "the upstream IPv6 address must not bypass the rewrite")
+
+	resp = query("cdn.example.com.", dns.TypeMX)
+	assert.Empty(t, resp.Answer)
+
+	resp = query("www.cdn.example.com.", dns.TypeA)
+	require.Len(t, resp.Answer, 1)
+	assert.Equal(t, "10.1.2.3", resp.Answer[0].(*dns.A).A.String(), "exact patterns don't match subdomains")
+
+	assert.Equal(t, map[string]uint64{"cdn.example.com": 2}, rewriteHits(chain))
+}
+
+func TestRewrite_IPv6Wildcard(t *testing.T) {
+	chain, query := newRewriteTestChain(t, "*.cdn.example.com=fd00::99", "www.cdn.example.com=10.9.9.9")
+
+	resp := query("img.cdn.example.com.", dns.TypeAAAA)
+	require.Len(t, resp.Answer, 1)
+	assert.Equal(t, "fd00::99", resp.Answer[0].(*dns.AAAA).AAAA.String())
+
+	resp = query("img.cdn.example.com.", dns.TypeA)
+	assert.Empty(t, resp.Answer)
+
+	resp = query("www.cdn.example.com.", dns.TypeA)
+	require.Len(t, resp.Answer, 1)
+	assert.Equal(t, "10.9.9.9", resp.Answer[0].(*dns.A).A.String(), "exact patterns win over wildcards")
+
+	resp = query("cdn.example.com.", dns.TypeAAAA)
+	require.Len(t, resp.Answer, 1)
+	assert.Equal(t, "fd00::3", resp.Answer[0].(*dns.AAAA).AAAA.String(), "wildcards don't match the apex")
+
+	assert.Equal(t, map[string]uint64{"*.cdn.example.com": 2, "www.cdn.example.com": 1}, rewriteHits(chain))
+}
+
+func TestRewrite_CNAME(t *testing.T) {
+	chain, query := newRewriteTestChain(t, "cdn.example.com=mirror.corp.internal")
+	chain.AddHandler("mirror.corp.internal.", dns.HandlerFunc(func(w dns.ResponseWriter, r *dns.Msg) {
+		resp := new(dns.Msg).SetReply(r)
+		if r.Question[0].Qtype == dns.TypeA {
+			resp.Answer = addressAnswer(r.Question[0].Name, 120, "10.50.0.1").Answer
+		}
+		_ = w.WriteMsg(resp)
+	}), PriorityLocal)
+
+	resp := query("cdn.example.com.", dns.TypeA)
+	require.Equal(t, dns.RcodeSuccess, resp.Rcode)
+	require.Len(t, resp.Answer, 2)
+	cname, ok := resp.Answer[0].(*dns.CNAME)
+	require.True(t, ok)
+	assert.Equal(t, "cdn.example.com.", cname.Hdr.Name)
+	assert.Equal(t, "mirror.corp.internal.", cname.Target)
+	assert.Equal(t, "10.50.0.1", resp.Answer[1].(*dns.A).A.String())
+
+	resp = query("cdn.example.com.", dns.TypeCNAME)
+	require.Len(t, resp.Answer, 1)
+	assert.Equal(t, "mirror.corp.internal.", resp.Answer[0].(*dns.CNAME).Target)
+
+	// Only upstream answers are rewritten, never the local ones.
+	resp = query("mirror.corp.internal.", dns.TypeA)
+	require.Len(t, resp.Answer, 1)
+	assert.Equal(t, "10.50.0.1", resp.Answer[0].(*dns.A).A.String())
+
+	assert.Equal(t, map[string]uint64{"cdn.example.com": 2}, rewriteHits(chain))
+}
+
+func TestRewrite_SkipsNonUpstreamAndFailures(t *testing.T) {
+	chain, query := newRewriteTestChain(t, "local.example.com=10.9.9.9", "gone.example.com=10.9.9.9")
+	chain.AddHandler("local.example.com.", dns.HandlerFunc(func(w dns.ResponseWriter, r *dns.Msg) {
+		resp := new(dns.Msg).SetReply(r)
+		resp.Answer = addressAnswer(r.Question[0].Name, 60, "100.64.0.1").Answer
+		_ = w.WriteMsg(resp)
+	}), PriorityLocal)
+	chain.AddHandler("gone.example.com.", dns.HandlerFunc(func(w dns.ResponseWriter, r *dns.Msg) {
+		_ = w.WriteMsg(new(dns.Msg).SetRcode(r, dns.RcodeNameError))
+	}), PriorityUpstream)
+
+	resp := query("local.example.com.", dns.TypeA)
+	require.Len(t, resp.Answer, 1)
+	assert.Equal(t, "100.64.0.1", resp.Answer[0].(*dns.A).A.String())
+
+	resp = query("gone.example.com.", dns.TypeA)
+	assert.Equal(t, dns.RcodeNameError, resp.Rcode)
+	assert.Empty(t, resp.Answer)
+
+	assert.Equal(t, map[string]uint64{"local.example.com": 0, "gone.example.com": 0}, rewriteHits(chain))
+
+	chain.SetRewriteRules(nil)
+	assert.Nil(t, chain.RewriteStats())
+}
@@ -0,0 +1,112 @@
+package dns
+
+import (
+	"fmt"
+
+	nbdns "github.com/netbirdio/netbird/dns"
+)
+
+// RootZoneSource is what registered a root zone handler.
+type RootZoneSource string
+
+const (
+	// RootZonePrimaryGroup is a primary nameserver group from management.
+	RootZonePrimaryGroup RootZoneSource = "primary-group"
+	// RootZoneHostFallback forwards to the host's original nameservers.
+	RootZoneHostFallback RootZoneSource = "host-fallback"
+	// RootZoneHostDNS forwards to the nameservers the OS reported through
+	// OnUpdatedHostDNSServer, queried outside the tunnel.
+	RootZoneHostDNS RootZoneSource = "host-dns"
+	// RootZoneCustomZone is a custom zone for the root served by the local
+	// resolver.
+	RootZoneCustomZone RootZoneSource = "custom-zone"
+	// RootZoneRegistered was registered through RegisterHandler.
+	RootZoneRegistered RootZoneSource = "registered"
+	// RootZoneBuiltin is one of the server's own handlers, like posture
+	// remediation or the unmatched catch-all. Tier tells which.
+	RootZoneBuiltin RootZoneSource = "builtin"
+)
+
+// RootZoneHandler is a handler registered for the root zone.
+type RootZoneHandler struct {
+	Priority int
+	// Tier is the name of the priority tier of Priority.
+	Tier   string
+	Source RootZoneSource
+	// Handler describes the handler, the upstreams for forwarders.
+	Handler string
+	// Owner is set on the handler queries reach first. The ones below only
+	// get the queries it passes on.
+	Owner bool
+}
+
+// RootZoneOwner returns the handlers registered for the root zone, from the
+// highest priority down, the first being the owner. Empty if nothing serves
+// the root zone.
+func (s *DefaultServer) RootZoneOwner() []RootZoneHandler {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+
+	entries := s.handlerChain.RootHandlers()
+	handlers := make([]RootZoneHandler, 0, len(entries))
+	for i, entry := range entries {
+		tier, _ := TierOf(entry.Priority)
+		handlers = append(handlers, RootZoneHandler{
+			Priority: entry.Priority,
+			Tier:     tier.Name,
+			Source:   s.rootZoneSource(entry),
+			Handler:  describeHandler(entry.Handler),
+			Owner:    i == 0,
+		})
+	}
+	return handlers
+}
+
+// rootZoneSource classifies a root zone handler of the chain. Must hold
+// s.mux.
+func (s *DefaultServer) rootZoneSource(entry HandlerEntry) RootZoneSource {
+	if s.fallbackHandler != nil && entry.Priority == PriorityFallback && sameHandler(entry.Handler, s.fallbackHandler) {
+		if s.fallbackFromHostDNS() {
+			return RootZoneHostDNS
+		}
+		return RootZoneHostFallback
+	}
+
+	for _, mux := range s.dnsMuxHandlers {
+		if mux.domain != nbdns.RootZone || mux.priority != entry.Priority || !sameHandler(mux.handler, entry.Handler) {
+			continue
+		}
+		if mux.handler == s.localResolver {
+			return RootZoneCustomZone
+		}
+		return RootZonePrimaryGroup
+	}
+
+	if _, ok := s.extraHandlers[extraHandlerKey{pattern: nbdns.RootZone, priority: entry.Priority}]; ok {
+		return RootZoneRegistered
+	}
+	return RootZoneBuiltin
+}
+
+// fallbackFromHostDNS reports whether the fallback handler forwards only to
+// nameservers reported by the OS. Must hold s.mux.
+func (s *DefaultServer) fallbackFromHostDNS() bool {
+	handler, ok := s.fallbackHandler.(*upstreamResolver)
+	if !ok || s.hostsDNSHolder == nil {
+		return false
+	}
+	upstreams := handler.flatUpstreams()
+	for _, upstream := range upstreams {
+		if !s.hostsDNSHolder.contains(upstream) {
+			return false
+		}
+	}
+	return len(upstreams) > 0
+}
+
+func describeHandler(handler any) string {
+	if stringer, ok := handler.(fmt.Stringer); ok {
+		return stringer.String()
+	}
+	return fmt.Sprintf("%T", handler)
+}
@@ -0,0 +1,80 @@
+package dns
+
+import (
+	"net/netip"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	nbdns "github.com/netbirdio/netbird/dns"
+	"github.com/netbirdio/netbird/shared/management/domain"
+)
+
+func TestDefaultServer_RootZoneOwner(t *testing.T) {
+	server := newTestServer(customHostManager{&recordingHostManager{}})
+	server.hostsDNSHolder = newHostsDNSHolder()
+
+	type owner struct {
+		Source   RootZoneSource
+		Priority int
+	}
+	owners := func() []owner {
+		t.Helper()
+		handlers := server.RootZoneOwner()
+		var out []owner
+		for i, h := range handlers {
+			assert.Equal(t, i == 0, h.Owner, "only the first handler owns the root zone")
+			tier, ok := TierOf(h.Priority)
+			require.True(t, ok)
+			assert.Equal(t, tier.Name, h.Tier)
+			out = append(out, owner{h.Source, h.Priority})
+		}
+		return out
+	}
+	primary := nbdns.Config{
+		ServiceEnable: true,
+		NameServerGroups: []*nbdns.NameServerGroup{{
+			Primary:     true,
+			NameServers: []nbdns.NameServer{{IP: netip.MustParseAddr("192.0.2.1"), NSType: nbdns.UDPNameServerType, Port: 53}},
+		}},
+	}
+
+	assert.Empty(t, owners(), "nothing serves the root zone yet")
+
+	server.mux.Lock()
+	server.registerFallback()
+	server.mux.Unlock()
+	assert.Equal(t, []owner{{RootZoneHostFallback, PriorityFallback}}, owners())
+
+	handlers := server.RootZoneOwner()
+	require.Len(t, handlers, 1)
+	assert.Equal(t, "fallback", handlers[0].Tier)
+	assert.Contains(t, handlers[0].Handler, "192.0.2.53:53")
+
+	require.NoError(t, server.UpdateDNSServer(1, primary))
+	assert.Equal(t, []owner{
+		{RootZonePrimaryGroup, TierDefault.Max},
+		{RootZoneHostFallback, PriorityFallback},
+	}, owners(), "the primary group takes over, the fallback stays below it")
+
+	root := domain.List{domain.Domain(nbdns.RootZone)}
+	server.RegisterHandler(root, &mockHandler{Id: "route"}, PriorityDNSRoute)
+	assert.Equal(t, []owner{
+		{RootZoneRegistered, PriorityDNSRoute},
+		{RootZonePrimaryGroup, TierDefault.Max},
+		{RootZoneHostFallback, PriorityFallback},
+	}, owners())
+
+	server.DeregisterHandler(root, PriorityDNSRoute)
+	require.NoError(t, server.UpdateDNSServer(2, nbdns.Config{ServiceEnable: true}))
+	assert.Equal(t, []owner{{RootZoneHostFallback, PriorityFallback}}, owners(), "removing the group hands the root zone back")
+
+	server.hostsDNSHolder.set([]netip.AddrPort{netip.MustParseAddrPort("192.0.2.53:53")})
+	assert.Equal(t, []owner{{RootZoneHostDNS, PriorityFallback}}, owners(), "the fallback forwards to the OS reported nameservers")
+
+	server.mux.Lock()
+	server.clearFallback()
+	server.mux.Unlock()
+	assert.Empty(t, owners())
+}
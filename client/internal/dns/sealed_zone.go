@@ -0,0 +1,78 @@
+package dns
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/miekg/dns"
+	log "github.com/sirupsen/logrus"
+
+	"github.com/netbirdio/netbird/client/internal/dns/resutil"
+	"github.com/netbirdio/netbird/client/internal/dns/types"
+)
+
+// sealedZoneResolver answers the queries of its zones every other handler
+// passed on with NXDOMAIN, so they never reach the host's original
+// nameservers. It is registered at PriorityFallback for the zones only and
+// ranks above the root zone's fallback handler, as the chain orders handlers
+// of the same priority by specificity.
+type sealedZoneResolver struct {
+	zones []string
+}
+
+func (r *sealedZoneResolver) String() string {
+	return fmt.Sprintf("SealedZoneResolver %v", r.zones)
+}
+
+func (r *sealedZoneResolver) ID() types.HandlerID {
+	return "sealed-zone"
+}
+
+func (r *sealedZoneResolver) MatchSubdomains() bool {
+	return true
+}
+
+func (r *sealedZoneResolver) Stop() {
+	// nothing to release
+}
+
+func (r *sealedZoneResolver) ServeDNS(w dns.ResponseWriter, req *dns.Msg) {
+	if len(req.Question) == 0 {
+		return
+	}
+
+	resp := new(dns.Msg)
+	resp.SetRcode(req, dns.RcodeNameError)
+	resutil.SetMeta(w, "sealed_zone", "true")
+	if err := w.WriteMsg(resp); err != nil {
+		log.Errorf("failed to write sealed zone response for %s: %v", req.Question[0].Name, err)
+	}
+}
+
+// enableSealedZones keeps the queries of zones and their subdomains from
+// the fallback to the host's original nameservers: names no custom zone or
+// nameserver group answers get NXDOMAIN instead. Other names still fall
+// back.
+func (s *DefaultServer) enableSealedZones(zones []string) {
+	var patterns []string
+	for _, z := range zones {
+		z = strings.TrimSpace(z)
+		if z == "" {
+			continue
+		}
+		z = strings.ToLower(dns.Fqdn(z))
+		if _, ok := dns.IsDomainName(z); !ok || z == "." {
+			log.Warnf("invalid zone %q to seal from the fallback nameservers, skipping", z)
+			continue
+		}
+		patterns = append(patterns, z)
+	}
+	if len(patterns) == 0 {
+		return
+	}
+
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	s.registerHandler(patterns, &sealedZoneResolver{zones: patterns}, PriorityFallback)
+	log.Debugf("not falling back to the original nameservers for %v", patterns)
+}
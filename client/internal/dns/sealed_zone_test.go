@@ -0,0 +1,56 @@
+package dns
+
+import (
+	"testing"
+
+	"github.com/miekg/dns"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/netbirdio/netbird/client/internal/dns/test"
+	nbdns "github.com/netbirdio/netbird/dns"
+)
+
+func TestSealedZones(t *testing.T) {
+	server := newTestServer(nil)
+	server.enableSealedZones([]string{"Sealed.Internal", ".", "not a domain..", ""})
+
+	require.NoError(t, server.UpdateDNSServer(1, nbdns.Config{
+		ServiceEnable: true,
+		CustomZones: []nbdns.CustomZone{{
+			Domain: "sealed.internal.",
+			Records: []nbdns.SimpleRecord{
+				{Name: "db.sealed.internal.", Type: int(dns.TypeA), Class: nbdns.DefaultClass, TTL: 300, RData: "10.0.0.10"},
+			},
+			NonAuthoritative: true,
+		}},
+	}))
+	// The original nameservers answer every name.
+	server.handlerChain.AddHandler(".", dualStackUpstream, PriorityFallback)
+
+	query := func(name string) *dns.Msg {
+		t.Helper()
+		w := &test.MockResponseWriter{}
+		server.handlerChain.ServeDNS(w, new(dns.Msg).SetQuestion(name, dns.TypeA))
+		resp := w.GetLastResponse()
+		require.NotNil(t, resp)
+		return resp
+	}
+
+	resp := query("db.sealed.internal.")
+	require.Len(t, resp.Answer, 1, "records of the sealed zone are answered")
+	assert.Equal(t, "10.0.0.10", resp.Answer[0].(*dns.A).A.String())
+
+	for _, name := range []string{"missing.sealed.internal.", "a.b.sealed.internal."} {
+		resp = query(name)
+		assert.Equal(t, dns.RcodeNameError, resp.Rcode, "%s must not fall back", name)
+		assert.Empty(t, resp.Answer)
+	}
+
+	resp = query("www.example.com.")
+	require.Len(t, resp.Answer, 1, "other names still fall back")
+	assert.Equal(t, "10.1.2.3", resp.Answer[0].(*dns.A).A.String())
+
+	resp = query("sealed.internal.example.com.")
+	require.Len(t, resp.Answer, 1, "names only ending in the zone's labels fall back")
+}
@@ -0,0 +1,191 @@
+package dns
+
+import (
+	"context"
+	"math"
+	"strings"
+	"sync/atomic"
+
+	"github.com/miekg/dns"
+	log "github.com/sirupsen/logrus"
+
+	"github.com/netbirdio/netbird/client/internal/dns/resutil"
+	"github.com/netbirdio/netbird/client/internal/dns/types"
+	nbdns "github.com/netbirdio/netbird/dns"
+)
+
+// searchDomainResolver answers single-label queries, e.g. "printer", with
+// the first search domain the name resolves in, e.g. "printer.corp.lan",
+// for clients that send bare names instead of expanding them themselves.
+// The answer is a CNAME from the bare name to the expanded one, followed by
+// the records of the expanded name. Queries for other names, and bare names
+// no search domain resolves, fall through.
+type searchDomainResolver struct {
+	// domains are the search domains, lowercase and fully qualified, in
+	// priority order.
+	domains atomic.Pointer[[]string]
+	// inZone reports whether a name belongs to a custom zone, which only
+	// local answers.
+	inZone func(name string) bool
+	// local answers names of custom zones.
+	local dns.Handler
+	// resolve looks up the other expanded names through the handler chain.
+	resolve func(ctx context.Context, r *dns.Msg) (*dns.Msg, error)
+}
+
+func newSearchDomainResolver(inZone func(string) bool, local dns.Handler, resolve func(context.Context, *dns.Msg) (*dns.Msg, error)) *searchDomainResolver {
+	return &searchDomainResolver{
+		inZone:  inZone,
+		local:   local,
+		resolve: resolve,
+	}
+}
+
+func (r *searchDomainResolver) String() string {
+	return "SearchDomainResolver"
+}
+
+func (r *searchDomainResolver) ID() types.HandlerID {
+	return "search-domain"
+}
+
+func (r *searchDomainResolver) MatchSubdomains() bool {
+	return true
+}
+
+func (r *searchDomainResolver) Stop() {
+	// nothing to release
+}
+
+// setDomains replaces the search domains, tried in the given order.
+func (r *searchDomainResolver) setDomains(domains []string) {
+	normalized := make([]string, 0, len(domains))
+	for _, d := range domains {
+		d = strings.ToLower(dns.Fqdn(strings.TrimSpace(d)))
+		if d == "." {
+			continue
+		}
+		normalized = append(normalized, d)
+	}
+	r.domains.Store(&normalized)
+}
+
+func (r *searchDomainResolver) ServeDNS(w dns.ResponseWriter, req *dns.Msg) {
+	if len(req.Question) == 0 {
+		return
+	}
+	q := req.Question[0]
+
+	var domains []string
+	if p := r.domains.Load(); p != nil {
+		domains = *p
+	}
+
+	var resp *dns.Msg
+	var expanded string
+	if dns.CountLabel(q.Name) == 1 {
+		resp, expanded = r.expand(req, domains)
+	}
+	if resp == nil {
+		resp = new(dns.Msg)
+		resp.SetRcode(req, dns.RcodeNameError)
+		resp.MsgHdr.Zero = true
+	} else {
+		resutil.SetMeta(w, "search_domain", expanded)
+	}
+	if err := w.WriteMsg(resp); err != nil {
+		log.Errorf("failed to write search domain response for %s: %v", q.Name, err)
+	}
+}
+
+// expand returns the answer to req of the first search domain its name
+// resolves in and the expanded name, nil if none does.
+func (r *searchDomainResolver) expand(req *dns.Msg, domains []string) (*dns.Msg, string) {
+	q := req.Question[0]
+	for _, d := range domains {
+		name := strings.ToLower(q.Name) + d
+		if _, ok := dns.IsDomainName(name); !ok {
+			continue
+		}
+
+		answer := r.lookup(new(dns.Msg).SetQuestion(name, q.Qtype))
+		if answer == nil || answer.Rcode != dns.RcodeSuccess || len(answer.Answer) == 0 {
+			continue
+		}
+
+		log.Tracef("expanded single-label query %s to %s", q.Name, name)
+		return searchDomainReply(req, name, answer), name
+	}
+	return nil, ""
+}
+
+// lookup resolves the expanded query. Names of custom zones are only
+// looked up locally: if the zone has no record for them they don't exist,
+// and forwarding them upstream would leak internal names.
+func (r *searchDomainResolver) lookup(query *dns.Msg) *dns.Msg {
+	name := query.Question[0].Name
+	if r.inZone != nil && r.inZone(name) {
+		if r.local == nil {
+			return nil
+		}
+		w := &internalResponseWriter{}
+		r.local.ServeDNS(w, query)
+		if w.response == nil || w.response.MsgHdr.Zero {
+			return nil
+		}
+		return w.response
+	}
+
+	if r.resolve == nil {
+		return nil
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), UpstreamTimeout)
+	defer cancel()
+
+	resp, err := r.resolve(ctx, query)
+	if err != nil {
+		log.Debugf("failed to resolve search domain expansion %s: %v", name, err)
+		return nil
+	}
+	return resp
+}
+
+// searchDomainReply answers req, a query for a bare name, with a CNAME to
+// name followed by answer, the records name resolved to.
+func searchDomainReply(req *dns.Msg, name string, answer *dns.Msg) *dns.Msg {
+	ttl := uint32(math.MaxUint32)
+	for _, rr := range answer.Answer {
+		ttl = min(ttl, rr.Header().Ttl)
+	}
+
+	resp := new(dns.Msg)
+	resp.SetReply(req)
+	resp.RecursionAvailable = answer.RecursionAvailable
+	resp.Answer = append(resp.Answer, &dns.CNAME{
+		Hdr:    dns.RR_Header{Name: req.Question[0].Name, Rrtype: dns.TypeCNAME, Class: dns.ClassINET, Ttl: ttl},
+		Target: name,
+	})
+	resp.Answer = append(resp.Answer, answer.Answer...)
+	return resp
+}
+
+// EnableSearchDomainExpansion answers single-label queries with the records
+// of the first search domain the name resolves in, see searchDomainResolver.
+// Names of custom zones are answered from the zones only. It is registered
+// below the local resolver and the loopback answers, so a bare name they
+// answer themselves is never expanded.
+func (s *DefaultServer) EnableSearchDomainExpansion() {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+
+	if s.searchDomainResolver != nil {
+		return
+	}
+	resolver := newSearchDomainResolver(s.localResolver.InZone, s.localResolver, func(ctx context.Context, r *dns.Msg) (*dns.Msg, error) {
+		return s.handlerChain.ResolveInternal(ctx, r, math.MaxInt)
+	})
+	resolver.setDomains(s.SearchDomains())
+	s.searchDomainResolver = resolver
+	s.registerHandler([]string{nbdns.RootZone}, resolver, PrioritySearchDomain)
+	log.Debug("expanding single-label queries with the search domains")
+}
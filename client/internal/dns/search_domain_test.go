@@ -0,0 +1,171 @@
+package dns
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+
+	"github.com/miekg/dns"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/netbirdio/netbird/client/internal/dns/test"
+	nbdns "github.com/netbirdio/netbird/dns"
+)
+
+// recordingUpstream answers every A query with 10.9.9.9 and remembers the
+// names it was asked for.
+type recordingUpstream struct {
+	mu    sync.Mutex
+	names []string
+}
+
+func (u *recordingUpstream) ServeDNS(w dns.ResponseWriter, r *dns.Msg) {
+	u.mu.Lock()
+	u.names = append(u.names, r.Question[0].Name)
+	u.mu.Unlock()
+
+	msg := addressAnswer(r.Question[0].Name, 300, "10.9.9.9")
+	msg.SetReply(r)
+	_ = w.WriteMsg(msg)
+}
+
+func (u *recordingUpstream) asked() []string {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	return append([]string(nil), u.names...)
+}
+
+func newSearchDomainTestServer(t *testing.T) (*DefaultServer, *recordingUpstream) {
+	t.Helper()
+
+	server := newTestServer(nil)
+	server.EnableSearchDomainExpansion()
+	upstream := &recordingUpstream{}
+	server.handlerChain.AddHandler(".", upstream, PriorityUpstream)
+
+	require.NoError(t, server.UpdateDNSServer(1, nbdns.Config{
+		ServiceEnable: true,
+		CustomZones: []nbdns.CustomZone{
+			{
+				Domain: "corp.lan.",
+				Records: []nbdns.SimpleRecord{
+					{Name: "printer.corp.lan.", Type: int(dns.TypeA), Class: nbdns.DefaultClass, TTL: 120, RData: "10.0.0.5"},
+				},
+			},
+			{
+				Domain:               "hidden.lan.",
+				SearchDomainDisabled: true,
+				Records: []nbdns.SimpleRecord{
+					{Name: "vault.hidden.lan.", Type: int(dns.TypeA), Class: nbdns.DefaultClass, TTL: 120, RData: "10.0.0.6"},
+				},
+			},
+		},
+	}))
+	return server, upstream
+}
+
+func querySearchDomainServer(t *testing.T, server *DefaultServer, name string) *dns.Msg {
+	t.Helper()
+
+	w := &test.MockResponseWriter{}
+	server.handlerChain.ServeDNS(w, new(dns.Msg).SetQuestion(name, dns.TypeA))
+	resp := w.GetLastResponse()
+	require.NotNil(t, resp)
+	return resp
+}
+
+func TestSearchDomain_ExpandsCustomZone(t *testing.T) {
+	server, upstream := newSearchDomainTestServer(t)
+
+	resp := querySearchDomainServer(t, server, "Printer.")
+	require.Equal(t, dns.RcodeSuccess, resp.Rcode)
+	require.Len(t, resp.Answer, 2)
+	cname, ok := resp.Answer[0].(*dns.CNAME)
+	require.True(t, ok, "the answer starts with a CNAME to the expanded name")
+	assert.Equal(t, "Printer.", cname.Hdr.Name)
+	assert.Equal(t, "printer.corp.lan.", cname.Target)
+	assert.Equal(t, uint32(120), cname.Hdr.Ttl)
+	assert.Equal(t, "10.0.0.5", resp.Answer[1].(*dns.A).A.String())
+	assert.Empty(t, upstream.asked())
+}
+
+func TestSearchDomain_CustomZoneNamesStayLocal(t *testing.T) {
+	server, upstream := newSearchDomainTestServer(t)
+
+	resp := querySearchDomainServer(t, server, "scanner.")
+	assert.Equal(t, []string{"scanner."}, upstream.asked(),
+		"the bare name falls through unchanged, the custom zone name is never forwarded")
+	require.Len(t, resp.Answer, 1)
+	assert.Equal(t, "scanner.", resp.Answer[0].Header().Name)
+}
+
+func TestSearchDomain_SkipsOtherNames(t *testing.T) {
+	server, upstream := newSearchDomainTestServer(t)
+
+	resp := querySearchDomainServer(t, server, "vault.")
+	require.Len(t, resp.Answer, 1, "zones without search domain aren't tried")
+	assert.Equal(t, "vault.", resp.Answer[0].Header().Name)
+
+	resp = querySearchDomainServer(t, server, "printer.example.com.")
+	require.Len(t, resp.Answer, 1, "names with dots aren't expanded")
+	assert.Equal(t, "printer.example.com.", resp.Answer[0].Header().Name)
+
+	assert.Equal(t, []string{"vault.", "printer.example.com."}, upstream.asked())
+}
+
+func TestSearchDomain_DisabledByDefault(t *testing.T) {
+	server := newTestServer(nil)
+	upstream := &recordingUpstream{}
+	server.handlerChain.AddHandler(".", upstream, PriorityUpstream)
+	require.NoError(t, server.UpdateDNSServer(1, nbdns.Config{
+		ServiceEnable: true,
+		CustomZones: []nbdns.CustomZone{{
+			Domain: "corp.lan.",
+			Records: []nbdns.SimpleRecord{
+				{Name: "printer.corp.lan.", Type: int(dns.TypeA), Class: nbdns.DefaultClass, TTL: 120, RData: "10.0.0.5"},
+			},
+		}},
+	}))
+
+	resp := querySearchDomainServer(t, server, "printer.")
+	require.Len(t, resp.Answer, 1)
+	assert.Equal(t, "printer.", resp.Answer[0].Header().Name)
+	assert.Equal(t, []string{"printer."}, upstream.asked())
+}
+
+func TestSearchDomainResolver_Order(t *testing.T) {
+	var asked []string
+	resolver := newSearchDomainResolver(nil, nil, func(_ context.Context, r *dns.Msg) (*dns.Msg, error) {
+		name := r.Question[0].Name
+		asked = append(asked, name)
+		switch name {
+		case "host.first.test.":
+			return nil, errors.New("timeout")
+		case "host.second.test.":
+			return new(dns.Msg).SetRcode(r, dns.RcodeNameError), nil
+		}
+		msg := addressAnswer(name, 30, "10.3.3.3")
+		msg.SetReply(r)
+		return msg, nil
+	})
+	resolver.setDomains([]string{"First.Test", "second.test.", "third.test", "fourth.test"})
+
+	w := &test.MockResponseWriter{}
+	resolver.ServeDNS(w, new(dns.Msg).SetQuestion("host.", dns.TypeA))
+	resp := w.GetLastResponse()
+	require.NotNil(t, resp)
+	assert.False(t, resp.MsgHdr.Zero)
+	require.Len(t, resp.Answer, 2)
+	assert.Equal(t, "host.third.test.", resp.Answer[0].(*dns.CNAME).Target, "the first search domain that resolves wins")
+	assert.Equal(t, []string{"host.first.test.", "host.second.test.", "host.third.test."}, asked)
+
+	asked = nil
+	resolver.setDomains(nil)
+	resolver.ServeDNS(w, new(dns.Msg).SetQuestion("host.", dns.TypeA))
+	resp = w.GetLastResponse()
+	require.NotNil(t, resp)
+	assert.True(t, resp.MsgHdr.Zero, "without search domains the query falls through")
+	assert.Empty(t, asked)
+}
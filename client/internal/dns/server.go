@@ -4,16 +4,20 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"math"
 	"net/netip"
 	"net/url"
 	"os"
+	"reflect"
 	"slices"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/miekg/dns"
 	"github.com/mitchellh/hashstructure/v2"
+	"github.com/prometheus/client_golang/prometheus"
 	log "github.com/sirupsen/logrus"
 	"golang.org/x/exp/maps"
 
@@ -23,6 +27,7 @@ import (
 	"github.com/netbirdio/netbird/client/internal/dns/mgmt"
 	"github.com/netbirdio/netbird/client/internal/dns/types"
 	"github.com/netbirdio/netbird/client/internal/listener"
+	"github.com/netbirdio/netbird/client/internal/netserial"
 	"github.com/netbirdio/netbird/client/internal/peer"
 	"github.com/netbirdio/netbird/client/internal/statemanager"
 	"github.com/netbirdio/netbird/client/proto"
@@ -48,6 +53,10 @@ const (
 	// envWarningDelay overrides defaultWarningDelayBase with a Go duration
 	// string (e.g. "90s", "2m"). Invalid or non-positive values are ignored.
 	envWarningDelay = "NB_DNS_HEALTH_WARNING_DELAY"
+	// hostRestoreAttempts is how often the host DNS settings are reverted
+	// before giving up and leaving them to the shutdown state cleanup.
+	hostRestoreAttempts   = 3
+	hostRestoreRetryDelay = 100 * time.Millisecond
 )
 
 // errNoUsableNameservers signals that a merged-domain group has no usable
@@ -67,11 +76,16 @@ type IosDnsManager interface {
 
 // Server is a dns server interface
 type Server interface {
-	RegisterHandler(domains domain.List, handler dns.Handler, priority int)
-	DeregisterHandler(domains domain.List, priority int)
+	RegisterHandler(domains domain.List, handler dns.Handler, priority int, qtypes ...uint16)
+	RegisterHandlerContext(ctx context.Context, domains domain.List, handler dns.Handler, priority int, qtypes ...uint16)
+	DeregisterHandler(domains domain.List, priority int, qtypes ...uint16)
+	RegisterPassthrough(domains domain.List, priority int)
 	BeginBatch()
 	EndBatch()
 	CancelBatch()
+	Freeze()
+	Unfreeze() error
+	BypassDNS(enable bool) error
 	Initialize() error
 	Stop()
 	DnsIP() netip.Addr
@@ -83,6 +97,7 @@ type Server interface {
 	SetRouteSources(selected, active func() route.HAMap)
 	SetFirewall(Firewall)
 	SetPeerActivator(local.PeerActivator)
+	DnsStats() DnsStats
 }
 
 type nsGroupsByDomain struct {
@@ -101,6 +116,17 @@ type nsHealthSnapshot struct {
 	merged   map[netip.AddrPort]UpstreamHealth
 	selected route.HAMap
 	active   route.HAMap
+	// inflight is the number of queries in flight per group.
+	inflight map[nsGroupID]int
+	// familyErrors are the errors of groups without a server reachable
+	// with the peer's address families.
+	familyErrors map[nsGroupID]error
+	// handlers are the nameserver group handlers by match domain, told
+	// when all groups of their domain are deactivated.
+	handlers map[string]groupsDownSetter
+	// probers are the nameserver group handlers by match domain, probing
+	// the upstreams of restored groups.
+	probers map[string]availabilityProber
 }
 
 // nsGroupProj holds per-group state for the emission rules.
@@ -114,6 +140,17 @@ type nsGroupProj struct {
 	// warningActive tracks whether we've already published a warning
 	// for the current streak, so recovery emits iff a warning did.
 	warningActive bool
+	// disabled is the Enabled flag last recorded for the group, inverted,
+	// so deactivation and reactivation events fire once per transition.
+	disabled bool
+	// restored is set for a group the previous run stopped with
+	// deactivated. It stays disabled until an upstream answers.
+	restored bool
+	// probing is set while an availability probe of the group runs. It is
+	// cleared by the probe's completion, without healthProjectMu.
+	probing atomic.Bool
+	// lastProbe is when the last availability probe of the group started.
+	lastProbe time.Time
 }
 
 // nsGroupVerdict is the outcome of evaluateNSGroupHealth.
@@ -131,6 +168,49 @@ const (
 	nsVerdictUnhealthy
 )
 
+// hashConfig hashes a DNS or host config for change detection. Slice order
+// and zero values don't affect the result.
+func hashConfig(config any) (uint64, error) {
+	return hashstructure.Hash(config, hashstructure.FormatV2, &hashstructure.HashOptions{
+		ZeroNil:         true,
+		IgnoreZeroValue: true,
+		SlicesAsSets:    true,
+		UseStringer:     true,
+	})
+}
+
+// extraHandlerKey identifies a RegisterHandler registration.
+type extraHandlerKey struct {
+	pattern  string
+	priority int
+	// qtypes is the query type filter, see qtypesKey.
+	qtypes string
+}
+
+// extraHandlerKey returns the key of the registration of d, normalized like
+// the handler chain does, so registrations the chain replaces share a key.
+func (s *DefaultServer) extraHandlerKey(d domain.Domain, priority int, qtypes ...uint16) extraHandlerKey {
+	return extraHandlerKey{
+		pattern:  s.handlerChain.NormalizeName(d.PunycodeString()),
+		priority: priority,
+		qtypes:   qtypesKey(normalizeQTypes(qtypes)),
+	}
+}
+
+// extraHandler is a handler registered through RegisterHandler.
+type extraHandler struct {
+	handler dns.Handler
+	// reg identifies the registering call, so the context of a
+	// RegisterHandlerContext call only releases the domains it still holds.
+	reg uint64
+}
+
+// pendingDNSUpdate is a management update received while the server was frozen.
+type pendingDNSUpdate struct {
+	serial uint64
+	config nbdns.Config
+}
+
 // DefaultServer dns server object
 type DefaultServer struct {
 	ctx        context.Context
@@ -138,11 +218,13 @@ type DefaultServer struct {
 	shutdownWg sync.WaitGroup
 	// disableSys disables system DNS management (e.g., /etc/resolv.conf updates) while keeping the DNS service running.
 	// This is different from ServiceEnable=false from management which completely disables the DNS service.
-	disableSys         bool
-	mux                sync.Mutex
-	service            service
-	dnsMuxHandlers     []handlerWrapper
-	localResolver      *local.Resolver
+	disableSys     bool
+	mux            sync.Mutex
+	service        service
+	dnsMuxHandlers []handlerWrapper
+	localResolver  *local.Resolver
+	// staticHosts serves the static hosts of localResolver by exact name.
+	staticHosts        *staticHostsHandler
 	wgInterface        WGIface
 	hostManager        hostManager
 	updateSerial       uint64
@@ -153,7 +235,60 @@ type DefaultServer struct {
 	extraDomains       map[domain.Domain]int
 	batchMode          bool
 
+	// hostDomains are the domains of the config last applied to the host,
+	// extra match domains included. Nil while the host isn't configured.
+	hostDomains []DomainConfig
+	// hostConfigApplied reports whether a host config was applied since the
+	// host DNS was last restored, and hostConfigErr why the last one failed.
+	hostConfigApplied bool
+	hostConfigErr     error
+
+	// hashUpdateFunc hashes management updates for change detection.
+	// Overridden in tests, nil uses hashConfig.
+	hashUpdateFunc func(update nbdns.Config) (uint64, error)
+
+	// extraHandlers tracks the handlers registered through RegisterHandler,
+	// so replacing one doesn't count its domain twice or touch handlers
+	// owned by updateMux.
+	extraHandlers map[extraHandlerKey]extraHandler
+	// extraHandlerSeq numbers the RegisterHandler calls.
+	extraHandlerSeq uint64
+	// handlerContextDone, if set, is called once the context of a
+	// RegisterHandlerContext call released its domains. Set in tests.
+	handlerContextDone func()
+
+	// appliedConfig is the last DNS config applied, kept for ExportConfig.
+	appliedConfig nbdns.Config
+
+	// frozen holds back management updates until Unfreeze. Only the most
+	// recent one is kept in pendingUpdate.
+	frozen        bool
+	pendingUpdate *pendingDNSUpdate
+
+	// override is the local config from LoadConfigOverride superseding
+	// management updates, nil when none is loaded.
+	override *configOverride
+
+	// bypassed keeps the host on its original nameservers until BypassDNS
+	// is called with false. The DNS service and handlers stay in place.
+	bypassed bool
+
 	mgmtCacheResolver *mgmt.Resolver
+	// zoneMirror serves MirroredZones, nil when none are configured.
+	zoneMirror *zoneMirror
+	// zoneNotifier notifies secondaries of custom zone changes, nil when
+	// none are configured.
+	zoneNotifier *zoneNotifier
+	// zoneSerials keeps the SOA serials of the authoritative local zones.
+	zoneSerials zoneSerials
+	// dnstap streams answered client queries, nil when no output is configured.
+	dnstap *dnstapOutput
+	// doh serves DNS over HTTPS queries, nil when no port is configured.
+	doh *dohListener
+
+	// customHostManager, when set, is used instead of the auto-detected
+	// host manager. See SetHostManager.
+	customHostManager HostManager
 
 	// permanent related properties
 	permanent      bool
@@ -163,6 +298,18 @@ type DefaultServer struct {
 	// PriorityFallback. Tracked so registerFallback can Stop() the previous
 	// instance instead of leaking its context.
 	fallbackHandler handlerWithStop
+	// captivePortal answers captive-portal-detection domains, nil when
+	// disabled. Its passthrough follows fallbackHandler.
+	captivePortal *captivePortalResolver
+	// passthrough forwards the domains excluded from claimed zones, nil
+	// until RegisterPassthrough. Its upstream follows fallbackHandler.
+	passthrough *passthroughResolver
+	// postureRemediation redirects DNS while the peer fails its posture
+	// checks, nil when disabled.
+	postureRemediation *postureRemediationHandler
+	// searchDomainResolver expands single-label queries with the search
+	// domains, nil when disabled.
+	searchDomainResolver *searchDomainResolver
 
 	// make sense on mobile only
 	searchDomainNotifier *notifier
@@ -180,6 +327,19 @@ type DefaultServer struct {
 	// nsGroupProj is the per-group state used by the emission rules.
 	// Accessed only under healthProjectMu.
 	nsGroupProj map[nsGroupID]*nsGroupProj
+	// deactivatedGroups holds when each deactivated group was deactivated,
+	// persisted as DeactivatedGroupsState, and deactivatedGroupsDirty
+	// whether it changed since. restoredGroups holds the groups the
+	// previous run stopped with deactivated until the projection first
+	// sees them. Accessed only under healthProjectMu.
+	deactivatedGroups      map[nsGroupID]time.Time
+	deactivatedGroupsDirty bool
+	restoredGroups         map[nsGroupID]time.Time
+	// groupFlaps holds the changes of the groups' enabled state not yet
+	// published through the status recorder, debounced by flapDebounce,
+	// zero disabling them. Accessed only under healthProjectMu.
+	groupFlaps   map[nsGroupID]*groupFlap
+	flapDebounce time.Duration
 	// warningDelayBase is the base grace window for health projection.
 	// Set at construction, mutated only by tests. Read by the
 	// refresher goroutine so never change it while one is running.
@@ -187,6 +347,104 @@ type DefaultServer struct {
 	// healthRefresh is buffered=1; writers coalesce, senders never block.
 	// See refreshHealth for the lock-order rationale.
 	healthRefresh chan struct{}
+
+	// reconcileInterval is the host DNS drift check interval, zero when
+	// the reconciler is disabled. See startHostReconciler.
+	reconcileInterval time.Duration
+	reconcileState    hostReconcileState
+
+	// probeInterval is how often the deactivated nameserver groups are
+	// probed, zero when they aren't. See startAvailabilityProber.
+	probeInterval time.Duration
+
+	// servfailHoldDown is applied to every upstream handler built from
+	// here on, see upstreamResolverBase.setServfailHoldDown.
+	servfailHoldDown time.Duration
+
+	// defaultRecordTTL replaces the zero TTLs of custom zone records, in
+	// seconds. Zero keeps them, see setDefaultRecordTTL.
+	defaultRecordTTL int
+	// upstreamHistory keeps the recent query outcomes of every upstream
+	// across handler rebuilds and restarts, see upstreamHistory.
+	upstreamHistory *upstreamHistory
+
+	// upstreamPoolSize and upstreamIdleTimeout configure the TCP connection
+	// pool of every upstream handler, see upstreamResolverBase.setConnPool.
+	upstreamPoolSize    int
+	upstreamIdleTimeout time.Duration
+
+	// upstreamMaxInflight and groupMaxInflight bound the queries in flight
+	// per nameserver group, see inflightLimitFor. inflightLimiters holds the
+	// limiter of every current group.
+	upstreamMaxInflight int
+	groupMaxInflight    map[string]int
+	inflightLimiters    map[nsGroupID]*inflightLimiter
+
+	// ednsAllowlist and groupEDNSAllowlists filter the EDNS0 options
+	// exchanged with upstreams, see ednsAllowlistFor.
+	ednsAllowlist       EDNSAllowlist
+	groupEDNSAllowlists map[string]EDNSAllowlist
+
+	// groupSelectionPolicies selects how the nameservers of the matching
+	// groups are queried, see selectionPolicyFor.
+	groupSelectionPolicies map[string]SelectionPolicy
+
+	// groupsDownPolicies selects how queries for the matching domains are
+	// answered while all of their groups are deactivated, see
+	// groupsDownPolicyFor.
+	groupsDownPolicies map[string]GroupsDownPolicy
+
+	// responseCacheSize is how many answers each upstream handler caches,
+	// zero disables the cache. noCacheGroups holds the keys of the groups
+	// whose answers aren't cached, see cacheDisabledFor.
+	responseCacheSize int
+	noCacheGroups     map[string]struct{}
+	// cacheTTLPolicies bound the TTLs the upstream handlers cache answers for.
+	cacheTTLPolicies []CacheTTLPolicy
+	// persistCache keeps the cached answers across restarts. restoredCache
+	// holds the ones loaded on start by match domain until the handlers for
+	// them are built, see warmResponseCache.
+	persistCache  bool
+	restoredCache map[string][]persistedAnswer
+
+	// metrics, when non-nil, holds the Prometheus collectors the server and
+	// its handlers record to.
+	metrics *dnsMetrics
+
+	// serverReachable filters the nameservers of a group by the peer's
+	// address families, nil keeps every nameserver. familyErrors holds the
+	// error of the groups left without servers by it, see reachableServers.
+	serverReachable func(netip.Addr) bool
+	familyErrors    map[nsGroupID]error
+
+	// privateReverse is handed to the root zone's upstream handlers, see
+	// setPrivateReverse.
+	privateReverse PrivateReverseMode
+
+	// bootstrapResolver is told the host's original nameservers whenever the
+	// fallback handler is registered, see BootstrapResolver.
+	bootstrapResolver *BootstrapResolver
+
+	// reverseCache is handed to upstream handlers of match domains, nil when
+	// reverse lookups of resolved addresses are disabled.
+	reverseCache *reverseCache
+
+	// rejectZoneOverlap refuses RegisterHandler domains that would shadow a
+	// local custom zone; zoneOverlaps records every overlap found.
+	rejectZoneOverlap bool
+	zoneOverlaps      map[extraHandlerKey]ZoneOverlap
+
+	// muxObservers are notified of handler changes, see SubscribeMuxChanges.
+	muxObserversMu    sync.Mutex
+	muxObservers      map[int]func(MuxChange)
+	nextMuxObserverID int
+
+	// eventSink is notified of state transitions, see SetServiceEventSink.
+	eventSinkMu sync.RWMutex
+	eventSink   ServiceEventSink
+	// listening tracks whether the DNS service listens, so listen events
+	// fire once per transition.
+	listening bool
 }
 
 type handlerWithStop interface {
@@ -203,6 +461,10 @@ type handlerWrapper struct {
 	domain   string
 	handler  handlerWithStop
 	priority int
+	// fingerprint identifies the configuration an upstream handler was
+	// built from, so updateMux can keep the registered handler when an
+	// update rebuilds it unchanged. Empty for other handlers.
+	fingerprint string
 }
 
 // DefaultServerConfig holds configuration parameters for NewDefaultServer
@@ -212,6 +474,207 @@ type DefaultServerConfig struct {
 	StatusRecorder *peer.Status
 	StateManager   *statemanager.Manager
 	DisableSys     bool
+
+	// ServiceIP is the fake resolver address answered on for a userspace
+	// bind interface. Unset, or used by a peer, selects one from the end of
+	// the NetBird network, see SelectServiceIP.
+	ServiceIP netip.Addr
+
+	// MgmtCachePinned serves the records of the infrastructure hosts as
+	// static answers, see mgmt.Resolver.SetPinned. These are the management
+	// host and the signal, relay, STUN and TURN hosts of the server domains;
+	// the flow receiver is never cached. NB_MGMT_CACHE_PINNED enables it as
+	// well.
+	MgmtCachePinned bool
+
+	// MirroredZones are answered from local copies synced from a co-located
+	// authoritative server, see MirroredZone.
+	MirroredZones []MirroredZone
+	// MirrorRefreshInterval is how often mirrored zones are transferred again.
+	// Zero uses the default of five minutes.
+	MirrorRefreshInterval time.Duration
+
+	// ZoneNotify are the secondaries sent a DNS NOTIFY when the records of
+	// a custom zone change, see ZoneNotify.
+	ZoneNotify []ZoneNotify
+
+	// DnstapOutput streams answered client queries in dnstap format to a
+	// collector at unix:///path or tcp://host:port. Empty disables it.
+	DnstapOutput string
+
+	// AnswerLoopback answers localhost, its subdomains and Hostname directly
+	// instead of forwarding them, see loopbackResolver.
+	AnswerLoopback bool
+	// Hostname is the host's own name answered with the peer's tunnel
+	// addresses when AnswerLoopback is set. Empty uses the OS hostname.
+	Hostname string
+
+	// SortAnswers orders A and AAAA answers by RFC 6724 destination address
+	// selection relative to the peer's tunnel addresses, for clients that
+	// don't do address selection themselves. Records are never dropped.
+	SortAnswers bool
+
+	// StripDNSSEC removes RRSIG, NSEC and NSEC3 records from responses to
+	// clients that didn't set the DO bit. See HandlerChain.SetDNSSECStripping.
+	StripDNSSEC bool
+
+	// NamePolicy selects how handler domains and query names are
+	// normalized before they are matched. See HandlerChain.SetNamePolicy.
+	NamePolicy NamePolicy
+
+	// MinUDPResponseSize and MaxUDPResponseSize bound the cap on responses
+	// to clients over UDP, larger ones are truncated with TC set so the
+	// client retries over TCP. A zero MaxUDPResponseSize uses the largest
+	// response fitting the tunnel MTU, a zero MinUDPResponseSize 512 bytes.
+	// See HandlerChain.SetUDPResponseSize.
+	MinUDPResponseSize int
+	MaxUDPResponseSize int
+
+	// CaptivePortal short-circuits captive-portal-detection domains, nil
+	// disables it. See CaptivePortalConfig.
+	CaptivePortal *CaptivePortalConfig
+
+	// PostureRemediation redirects DNS to a remediation page while the peer
+	// fails its posture checks, nil disables it. See SetPostureBlocked.
+	PostureRemediation *PostureRemediationConfig
+
+	// PrivateReverse keeps queries for the reverse zones of private address
+	// ranges from public upstreams, see PrivateReverseMode. The default
+	// forwards them like any other query.
+	PrivateReverse PrivateReverseMode
+
+	// UnmatchedRcode answers queries no handler answers with this rcode,
+	// see ParseUnmatchedAction. Zero keeps the handler chain's REFUSED
+	// without registering a catch-all handler.
+	UnmatchedRcode int
+
+	// RejectZoneOverlap refuses RegisterHandler registrations that would
+	// answer names of a custom zone served by the local resolver instead of
+	// it. Overlaps are logged and listed by ZoneOverlaps either way.
+	RejectZoneOverlap bool
+
+	// ServfailHoldDown answers retries of a question an upstream just failed
+	// with SERVFAIL for this long instead of contacting it again, while a
+	// background probe checks for recovery. Zero keeps the value from
+	// NB_DNS_SERVFAIL_HOLDDOWN, which is disabled when unset.
+	ServfailHoldDown time.Duration
+
+	// DefaultRecordTTL is the TTL custom zone records without one are
+	// answered with. Zero uses 5 minutes, a negative value answers them
+	// with TTL 0 so clients don't cache them.
+	DefaultRecordTTL time.Duration
+
+	// UpstreamPoolSize is how many idle TCP connections are kept per upstream
+	// for reuse by later queries. Zero uses the default, negative disables
+	// connection reuse.
+	UpstreamPoolSize int
+	// UpstreamIdleTimeout closes pooled upstream connections unused for this
+	// long. Zero uses the default.
+	UpstreamIdleTimeout time.Duration
+	// ResponseCacheSize makes every upstream handler cache up to this many
+	// answers for their TTL. Zero disables the cache.
+	ResponseCacheSize int
+	// NoCacheGroups keeps the answers of the groups with a match domain or
+	// nameserver address in its keys out of the cache, see
+	// ParseNoCacheGroups.
+	NoCacheGroups map[string]struct{}
+	// CacheTTLPolicies bound how long answers are cached per zone and query
+	// type, see ParseCacheTTLPolicies.
+	CacheTTLPolicies []CacheTTLPolicy
+	// PersistResponseCache keeps the cached answers in the state file, so
+	// the caches start warm after a restart. Answers expiring meanwhile are
+	// dropped.
+	PersistResponseCache bool
+
+	// MetricsRegisterer, if set, gets the Prometheus collectors of the DNS
+	// server: queries per handler domain, upstream latencies, cache lookups
+	// and nameserver group deactivations.
+	MetricsRegisterer prometheus.Registerer
+
+	// BootstrapResolver, if set, is updated with the host's original
+	// nameservers so control-plane hosts resolve without NetBird DNS.
+	BootstrapResolver *BootstrapResolver
+
+	// ReverseCacheSize enables answering PTR queries for addresses that names
+	// of nameserver group match domains resolved to, remembering up to this
+	// many addresses. Zero disables it.
+	ReverseCacheSize int
+	// DisablePeerReverse stops answering PTR queries for addresses of the
+	// NetBird network with the FQDNs of the peers holding them.
+	DisablePeerReverse bool
+
+	// SwapQueueSize is how many queries are queued while the handler set is
+	// replaced on a config update, waiting at most SwapQueueTimeout before
+	// being answered with SERVFAIL. Zero values use the defaults, a negative
+	// size disables queueing.
+	SwapQueueSize    int
+	SwapQueueTimeout time.Duration
+
+	// SuppressAAAADomains answers AAAA queries for these domains and their
+	// subdomains with NODATA, "." for every name. Custom zones, mirrored
+	// zones and DNS routes keep their AAAA records.
+	SuppressAAAADomains []string
+
+	// SealedZones never fall back to the host's original nameservers: names
+	// in them no custom zone or nameserver group answers get NXDOMAIN.
+	SealedZones []string
+
+	// RewriteRules rewrite the answers of upstream nameservers to client
+	// queries, see RewriteRule.
+	RewriteRules []RewriteRule
+
+	// TimePolicies let domains resolve only within daily schedules, see
+	// TimePolicy.
+	TimePolicies []TimePolicy
+
+	// UpstreamMaxInflight bounds the queries forwarded to a nameserver group
+	// at once. Zero uses the default, negative disables the limit.
+	UpstreamMaxInflight int
+	// GroupMaxInflight overrides UpstreamMaxInflight for the groups with a
+	// match domain or nameserver address in its keys, see
+	// ParseInflightLimits.
+	GroupMaxInflight map[string]int
+
+	// EDNSAllowlist restricts the EDNS0 options forwarded to upstream
+	// nameservers, and returned from them, to the allowed ones. Nil lets
+	// every option through.
+	EDNSAllowlist EDNSAllowlist
+	// GroupEDNSAllowlists overrides EDNSAllowlist for the groups with a
+	// match domain or nameserver address in its keys, see
+	// ParseGroupEDNSAllowlists.
+	GroupEDNSAllowlists map[string]EDNSAllowlist
+
+	// GroupSelectionPolicies selects how the nameservers of the groups with
+	// a match domain or nameserver address in its keys are queried, see
+	// ParseSelectionPolicies. Groups without one fail over.
+	GroupSelectionPolicies map[string]SelectionPolicy
+
+	// GroupsDownPolicies selects how queries for the match domains in its
+	// keys are answered while every nameserver group serving them is
+	// deactivated, see ParseGroupsDownPolicies. Domains without one keep
+	// querying the groups.
+	GroupsDownPolicies map[string]GroupsDownPolicy
+
+	// DoHPort, if not 0, serves DNS over HTTPS (RFC 8484) queries at
+	// /dns-query on this port of the interface address, through the same
+	// handler chain. It lets applications of peers in netstack mode query
+	// the DNS service.
+	DoHPort int
+	// DoHCertFile and DoHKeyFile are the PEM certificate and key the DoH
+	// listener serves. Without them it serves a self-signed certificate
+	// for the interface address, logging its fingerprint.
+	DoHCertFile string
+	DoHKeyFile  string
+
+	// ExpandSearchDomains answers single-label queries with the records of
+	// the first search domain the name resolves in, for clients that send
+	// bare names without expanding them.
+	ExpandSearchDomains bool
+
+	// ProbeInterval, if not 0, probes the nameservers of deactivated
+	// groups this often, reactivating a group once one of them answers
+	// instead of waiting for client queries to reach it.
+	ProbeInterval time.Duration
 }
 
 // NewDefaultServer returns a new dns server
@@ -227,12 +690,109 @@ func NewDefaultServer(ctx context.Context, config DefaultServerConfig) (*Default
 
 	var dnsService service
 	if config.WgInterface.IsUserspaceBind() {
-		dnsService = NewServiceViaMemory(config.WgInterface)
+		serviceIP := config.ServiceIP
+		if serviceIP.IsValid() && netstack.IsEnabled() {
+			// the netstack device answers DNS on its own fixed address
+			log.Warnf("ignoring DNS service address %s in netstack mode", serviceIP)
+			serviceIP = netip.Addr{}
+		}
+		dnsService = NewServiceViaMemoryWithIP(config.WgInterface, serviceIP)
 	} else {
 		dnsService = newServiceViaListener(config.WgInterface, addrPort, nil)
 	}
 
 	server := newDefaultServer(ctx, config.WgInterface, dnsService, config.StatusRecorder, config.StateManager, config.DisableSys)
+	// The policy applies to the handlers registered from here on.
+	server.handlerChain.SetNamePolicy(config.NamePolicy)
+	if config.MgmtCachePinned {
+		server.mgmtCacheResolver.SetPinned(true)
+	}
+	server.rejectZoneOverlap = config.RejectZoneOverlap
+	if config.CaptivePortal != nil {
+		server.enableCaptivePortal(*config.CaptivePortal)
+	}
+	if config.AnswerLoopback {
+		server.enableLoopbackAnswers(config.Hostname)
+	}
+	if config.ExpandSearchDomains {
+		server.EnableSearchDomainExpansion()
+	}
+	if config.UnmatchedRcode > 0 {
+		server.enableUnmatchedAction(config.UnmatchedRcode)
+	}
+	if config.PrivateReverse != PrivateReverseForward {
+		server.enablePrivateReverse(config.PrivateReverse)
+	}
+	if config.SortAnswers {
+		server.enableAnswerSorting()
+	}
+	if config.StripDNSSEC {
+		server.handlerChain.SetDNSSECStripping(true)
+	}
+	server.setUDPResponseSize(config.MinUDPResponseSize, config.MaxUDPResponseSize)
+	if len(config.SuppressAAAADomains) > 0 {
+		server.enableAAAASuppression(config.SuppressAAAADomains)
+	}
+	if len(config.SealedZones) > 0 {
+		server.enableSealedZones(config.SealedZones)
+	}
+	if len(config.RewriteRules) > 0 {
+		server.handlerChain.SetRewriteRules(config.RewriteRules)
+	}
+	if len(config.TimePolicies) > 0 {
+		server.enableTimePolicies(config.TimePolicies)
+	}
+	if config.PostureRemediation != nil {
+		server.enablePostureRemediation(*config.PostureRemediation)
+	}
+	if config.ReverseCacheSize > 0 {
+		server.enableReverseCache(config.ReverseCacheSize)
+	}
+	if !config.DisablePeerReverse {
+		server.enablePeerReverse()
+	}
+	server.setAvailabilityProbeInterval(config.ProbeInterval)
+	if config.ServfailHoldDown > 0 {
+		server.servfailHoldDown = config.ServfailHoldDown
+	}
+	if config.DefaultRecordTTL != 0 {
+		server.setDefaultRecordTTL(config.DefaultRecordTTL)
+	}
+	server.handlerChain.SetSwapQueue(config.SwapQueueSize, config.SwapQueueTimeout)
+	server.upstreamMaxInflight = config.UpstreamMaxInflight
+	server.groupMaxInflight = config.GroupMaxInflight
+	server.ednsAllowlist = config.EDNSAllowlist
+	server.groupEDNSAllowlists = config.GroupEDNSAllowlists
+	server.groupSelectionPolicies = config.GroupSelectionPolicies
+	server.groupsDownPolicies = config.GroupsDownPolicies
+	server.upstreamPoolSize = config.UpstreamPoolSize
+	server.upstreamIdleTimeout = config.UpstreamIdleTimeout
+	server.responseCacheSize = config.ResponseCacheSize
+	server.noCacheGroups = config.NoCacheGroups
+	server.cacheTTLPolicies = config.CacheTTLPolicies
+	server.persistCache = config.PersistResponseCache
+	server.metrics = newDNSMetrics(config.MetricsRegisterer)
+	server.handlerChain.setMetrics(server.metrics)
+	server.bootstrapResolver = config.BootstrapResolver
+	if len(config.MirroredZones) > 0 {
+		server.zoneMirror = newZoneMirror(config.MirroredZones, config.MirrorRefreshInterval)
+	}
+	if config.DnstapOutput != "" {
+		output, err := newDnstapOutput(config.DnstapOutput, config.Hostname)
+		if err != nil {
+			log.Warnf("dnstap output disabled: %v", err)
+		} else {
+			server.dnstap = output
+		}
+	}
+	if len(config.ZoneNotify) > 0 {
+		server.zoneNotifier = newZoneNotifier(config.ZoneNotify, &server.shutdownWg)
+	}
+	if config.DoHPort > 0 && config.DoHPort <= math.MaxUint16 {
+		server.doh = newDoHListener(server.handlerChain, config.WgInterface, uint16(config.DoHPort), config.DoHCertFile, config.DoHKeyFile)
+	} else if config.DoHPort != 0 {
+		log.Warnf("DNS over HTTPS disabled: invalid port %d", config.DoHPort)
+	}
 	return server, nil
 }
 
@@ -302,13 +862,21 @@ func newDefaultServer(
 		mgmtCacheResolver: mgmtCacheResolver,
 		currentConfigHash: ^uint64(0), // Initialize to max uint64 to ensure first config is always applied
 		warningDelayBase:  warningDelayBaseFromEnv(),
+		flapDebounce:      defaultFlapDebounce,
 		healthRefresh:     make(chan struct{}, 1),
+		reconcileInterval: hostReconcileIntervalFromEnv(),
+		servfailHoldDown:  servfailHoldDownFromEnv(),
+		defaultRecordTTL:  defaultRecordTTL,
+		upstreamHistory:   newUpstreamHistory(),
 	}
 	// Wire the local resolver against the peer status recorder so it can
 	// suppress A/AAAA answers that point at disconnected peers (typical
 	// case: synthesised private-service records pointing at an embedded
 	// proxy peer that just went offline).
 	defaultServer.localResolver.SetPeerConnectivity(localPeerConnectivity{statusRecorder})
+	defaultServer.staticHosts = &staticHostsHandler{resolver: defaultServer.localResolver}
+	defaultServer.serverReachable = defaultServer.familyReachable
+	defaultServer.setUDPResponseSize(0, 0)
 
 	// register with root zone, handler chain takes care of the routing
 	dnsService.RegisterMux(".", handlerChain)
@@ -339,23 +907,92 @@ func (s *DefaultServer) SetRouteSources(selected, active func() route.HAMap) {
 }
 
 // RegisterHandler registers a handler for the given domains with the given priority.
-// Any previously registered handler for the same domain and priority will be replaced.
-func (s *DefaultServer) RegisterHandler(domains domain.List, handler dns.Handler, priority int) {
+// A handler previously registered through RegisterHandler for the same domain and
+// priority is replaced, and stopped once it isn't registered for any other domain.
+// Re-registering a domain at the same priority doesn't add another reference to it.
+// Priorities outside every PriorityTier are rejected.
+//
+// With qtypes the handler only serves queries of these types, others fall through
+// to the next handler. It is tried before a handler of the same domain and priority
+// without qtypes, and registered alongside it rather than replacing it, so e.g. AAAA
+// queries of a domain can be forwarded elsewhere than its other queries.
+func (s *DefaultServer) RegisterHandler(domains domain.List, handler dns.Handler, priority int, qtypes ...uint16) {
+	s.registerExtraHandler(domains, handler, priority, normalizeQTypes(qtypes))
+}
+
+// RegisterHandlerContext registers a handler like RegisterHandler and deregisters
+// it like DeregisterHandler once ctx is done, e.g. to tie it to the lifecycle of a
+// route. Domains the registration no longer holds by then, because they were
+// deregistered or registered again in the meantime, are left alone.
+func (s *DefaultServer) RegisterHandlerContext(ctx context.Context, domains domain.List, handler dns.Handler, priority int, qtypes ...uint16) {
+	qtypes = normalizeQTypes(qtypes)
+	reg, registered := s.registerExtraHandler(domains, handler, priority, qtypes)
+	if len(registered) == 0 {
+		return
+	}
+	context.AfterFunc(ctx, func() {
+		s.releaseExtraHandler(registered, priority, qtypes, reg)
+		if s.handlerContextDone != nil {
+			s.handlerContextDone()
+		}
+	})
+}
+
+// registerExtraHandler registers handler through RegisterHandler for the
+// normalized qtypes. It returns the id of the registration and the domains
+// it registered.
+func (s *DefaultServer) registerExtraHandler(domains domain.List, handler dns.Handler, priority int, qtypes []uint16) (uint64, domain.List) {
+	if err := validatePriority(priority); err != nil {
+		log.Errorf("not registering handler %s for %v: %v", handler, domains, err)
+		return 0, nil
+	}
+
 	s.mux.Lock()
 	defer s.mux.Unlock()
 
-	s.registerHandler(domains.ToPunycodeList(), handler, priority)
+	if s.extraHandlers == nil {
+		s.extraHandlers = make(map[extraHandlerKey]extraHandler)
+	}
+
+	domains = s.checkZoneOverlaps(domains, priority, qtypes)
+	if len(domains) == 0 {
+		return 0, nil
+	}
+
+	s.extraHandlerSeq++
+	reg := s.extraHandlerSeq
 
+	var replaced []dns.Handler
 	// TODO: This will take over zones for non-wildcard domains, for which we might not have a handler in the chain
 	for _, domain := range domains {
-		s.extraDomains[toZone(domain)]++
+		key := s.extraHandlerKey(domain, priority, qtypes...)
+		prev, ok := s.extraHandlers[key]
+		s.extraHandlers[key] = extraHandler{handler: handler, reg: reg}
+		if ok {
+			if !sameHandler(prev.handler, handler) {
+				replaced = append(replaced, prev.handler)
+			}
+			continue
+		}
+		s.extraDomains[s.toZone(domain)]++
+	}
+
+	s.registerHandler(domains.ToPunycodeList(), handler, priority, qtypes...)
+	for _, old := range replaced {
+		s.stopReplacedHandler(old)
 	}
+
 	if !s.batchMode {
 		s.applyHostConfig()
 	}
+	return reg, domains
 }
 
-func (s *DefaultServer) registerHandler(domains []string, handler dns.Handler, priority int) {
+func (s *DefaultServer) registerHandler(domains []string, handler dns.Handler, priority int, qtypes ...uint16) {
+	if err := validatePriority(priority); err != nil {
+		log.Errorf("not registering handler %s for %v: %v", handler, domains, err)
+		return
+	}
 	log.Debugf("registering handler %s with priority %d for %v", handler, priority, domains)
 
 	for _, domain := range domains {
@@ -364,18 +1001,79 @@ func (s *DefaultServer) registerHandler(domains []string, handler dns.Handler, p
 			continue
 		}
 
-		s.handlerChain.AddHandler(domain, handler, priority)
+		s.handlerChain.AddHandler(domain, handler, priority, qtypes...)
+	}
+}
+
+// stopReplacedHandler stops a handler replaced through RegisterHandler unless
+// it is still registered there for another domain.
+func (s *DefaultServer) stopReplacedHandler(old dns.Handler) {
+	for _, h := range s.extraHandlers {
+		if sameHandler(h.handler, old) {
+			return
+		}
+	}
+	stopper, ok := old.(interface{ Stop() })
+	if !ok {
+		return
+	}
+	log.Debugf("stopping replaced handler %s", old)
+	stopper.Stop()
+}
+
+// sameHandler compares two handlers by identity. Handlers of non-comparable
+// types (e.g. dns.HandlerFunc) are never considered the same.
+func sameHandler(a, b dns.Handler) bool {
+	ta := reflect.TypeOf(a)
+	if ta == nil || ta != reflect.TypeOf(b) || !ta.Comparable() {
+		return false
 	}
+	return a == b
+}
+
+// DeregisterHandler deregisters the handler for the given domains with the given priority
+// and qtypes, those of a RegisterHandler call.
+func (s *DefaultServer) DeregisterHandler(domains domain.List, priority int, qtypes ...uint16) {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+
+	s.deregisterExtraHandler(domains, priority, normalizeQTypes(qtypes))
 }
 
-// DeregisterHandler deregisters the handler for the given domains with the given priority.
-func (s *DefaultServer) DeregisterHandler(domains domain.List, priority int) {
+// releaseExtraHandler deregisters the domains the registration reg still
+// holds, once the context of its RegisterHandlerContext call is done.
+func (s *DefaultServer) releaseExtraHandler(domains domain.List, priority int, qtypes []uint16, reg uint64) {
 	s.mux.Lock()
 	defer s.mux.Unlock()
 
-	s.deregisterHandler(domains.ToPunycodeList(), priority)
+	var held domain.List
+	for _, d := range domains {
+		if h, ok := s.extraHandlers[s.extraHandlerKey(d, priority, qtypes...)]; ok && h.reg == reg {
+			held = append(held, d)
+		}
+	}
+	if len(held) == 0 {
+		return
+	}
+	log.Debugf("handler context done, deregistering handler with priority %d for %v", priority, held)
+	s.deregisterExtraHandler(held, priority, qtypes)
+}
+
+// deregisterExtraHandler deregisters domains registered through
+// RegisterHandler. Domains that aren't registered there keep their
+// reference count, so a domain is released once however often it's
+// deregistered. Caller must hold s.mux.
+func (s *DefaultServer) deregisterExtraHandler(domains domain.List, priority int, qtypes []uint16) {
+	s.deregisterHandler(domains.ToPunycodeList(), priority, qtypes...)
 	for _, domain := range domains {
-		zone := toZone(domain)
+		key := s.extraHandlerKey(domain, priority, qtypes...)
+		_, registered := s.extraHandlers[key]
+		delete(s.extraHandlers, key)
+		delete(s.zoneOverlaps, key)
+		if !registered {
+			continue
+		}
+		zone := s.toZone(domain)
 		s.extraDomains[zone]--
 		if s.extraDomains[zone] <= 0 {
 			delete(s.extraDomains, zone)
@@ -416,7 +1114,95 @@ func (s *DefaultServer) CancelBatch() {
 	s.batchMode = false
 }
 
-func (s *DefaultServer) deregisterHandler(domains []string, priority int) {
+// Freeze stops applying DNS updates from management, e.g. during a bulk
+// rollout. Updates received while frozen are not applied; Unfreeze applies
+// the most recent one.
+func (s *DefaultServer) Freeze() {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	if s.frozen {
+		return
+	}
+	log.Infof("DNS updates frozen")
+	s.frozen = true
+	s.setFrozenStatus(true)
+}
+
+// Unfreeze resumes applying DNS updates and applies the latest update
+// received while frozen, if any.
+func (s *DefaultServer) Unfreeze() error {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	if !s.frozen {
+		return nil
+	}
+	log.Infof("DNS updates unfrozen")
+	s.frozen = false
+	s.setFrozenStatus(false)
+
+	pending := s.pendingUpdate
+	s.pendingUpdate = nil
+	if pending == nil {
+		return nil
+	}
+	if s.ctx.Err() != nil {
+		return s.ctx.Err()
+	}
+	return s.applyUpdate(pending.serial, pending.config)
+}
+
+func (s *DefaultServer) setFrozenStatus(frozen bool) {
+	if s.statusRecorder != nil {
+		s.statusRecorder.UpdateDNSFrozen(frozen)
+	}
+}
+
+// BypassDNS points the host back at its original nameservers when enable is
+// true, a safety valve for when NetBird DNS misbehaves. The DNS service,
+// its handlers and management updates keep running, but the host config
+// isn't applied again until BypassDNS is called with false. Unlike
+// disabling system DNS or Stop, it can be toggled at runtime.
+func (s *DefaultServer) BypassDNS(enable bool) error {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+
+	if s.bypassed == enable {
+		return nil
+	}
+
+	if !enable {
+		log.Infof("DNS bypass disabled, routing host DNS through NetBird again")
+		s.bypassed = false
+		s.setBypassedStatus(false)
+		s.emitEvent(ServiceEvent{Type: EventBypassReleased})
+		// Force applyHostConfig past its unchanged-config shortcut.
+		s.currentConfigHash = ^uint64(0)
+		s.applyHostConfig()
+		return nil
+	}
+
+	log.Warnf("DNS bypass enabled, restoring the original nameservers %v", s.hostManager.getOriginalNameservers())
+	if err := s.restoreHostDNS(); err != nil {
+		return fmt.Errorf("restore host DNS: %w", err)
+	}
+	s.hostDomains = nil
+	s.hostConfigApplied, s.hostConfigErr = false, nil
+	if err := s.stateManager.DeleteState(&ShutdownState{}); err != nil {
+		log.Errorf("failed to delete shutdown dns state: %v", err)
+	}
+	s.bypassed = true
+	s.setBypassedStatus(true)
+	s.emitEvent(ServiceEvent{Type: EventBypassEngaged})
+	return nil
+}
+
+func (s *DefaultServer) setBypassedStatus(bypassed bool) {
+	if s.statusRecorder != nil {
+		s.statusRecorder.UpdateDNSBypassed(bypassed)
+	}
+}
+
+func (s *DefaultServer) deregisterHandler(domains []string, priority int, qtypes ...uint16) {
 	log.Debugf("deregistering handler with priority %d for %v", priority, domains)
 
 	for _, domain := range domains {
@@ -425,7 +1211,7 @@ func (s *DefaultServer) deregisterHandler(domains []string, priority int) {
 			continue
 		}
 
-		s.handlerChain.RemoveHandler(domain, priority)
+		s.handlerChain.RemoveHandler(domain, priority, qtypes...)
 	}
 }
 
@@ -444,25 +1230,36 @@ func (s *DefaultServer) Initialize() (err error) {
 		if err != nil {
 			return fmt.Errorf("service listen: %w", err)
 		}
+		s.setListening(true)
 	}
 
 	s.stateManager.RegisterState(&ShutdownState{})
+	s.loadUpstreamHistory()
+	s.loadDeactivatedGroups()
+	s.loadResponseCache()
 
 	s.startHealthRefresher()
+	s.startAvailabilityProber()
+	s.startZoneMirror()
+	s.startDnstap()
+	s.startDoH()
 
 	// Keep using noop host manager if dns off requested or running in netstack mode.
-	// Netstack mode currently doesn't have a way to receive DNS requests.
+	// Netstack mode currently doesn't have a way to receive DNS requests from the
+	// host, applications can use the DoH listener if one is configured.
 	// TODO: Use listener on localhost in netstack mode when running as root.
 	if s.disableSys || netstack.IsEnabled() {
 		log.Info("system DNS is disabled, not setting up host manager")
 		return nil
 	}
 
-	hostManager, err := s.initialize()
+	hostManager, err := s.newHostManager()
 	if err != nil {
 		return fmt.Errorf("initialize: %w", err)
 	}
 	s.hostManager = hostManager
+	s.emitHostManagerEvent(EventHostManagerActivated)
+	s.startHostReconciler()
 	// On mobile-permanent setups the seeded host DNS list is the only
 	// source until the first network-map arrives; register it now so DNS
 	// works in that window. Desktop host managers register fallback when
@@ -476,11 +1273,24 @@ func (s *DefaultServer) Initialize() (err error) {
 // DnsIP returns the DNS resolver server IP address
 //
 // When kernel space interface used it return real DNS server listener IP address
-// For bind interface, fake DNS resolver address returned (second last IP address from Nebird network)
+// For bind interface, fake DNS resolver address returned (DefaultServerConfig.ServiceIP or by
+// default the second last IP address from Nebird network, see SelectServiceIP)
 func (s *DefaultServer) DnsIP() netip.Addr {
 	return s.service.RuntimeIP()
 }
 
+// PeerServicePort returns the port other peers reach the DNS service on at
+// the WireGuard address, for relaying their queries. It is 0 when the
+// service doesn't listen there, e.g. on a loopback address or on the virtual
+// address of a userspace interface.
+func (s *DefaultServer) PeerServicePort() uint16 {
+	svc, ok := s.service.(*serviceViaListener)
+	if !ok {
+		return 0
+	}
+	return svc.peerPort()
+}
+
 // SetFirewall sets the firewall used for DNS port DNAT rules.
 // This must be called before Initialize when using the listener-based service,
 // because the firewall is typically not available at construction time.
@@ -499,10 +1309,17 @@ func (s *DefaultServer) SetPeerActivator(a local.PeerActivator) {
 	s.localResolver.SetPeerActivator(a)
 }
 
+// SetAuditSink installs a sink notified of every query answered by the
+// handler chain. Pass nil to disable. See HandlerChain.SetAuditSink.
+func (s *DefaultServer) SetAuditSink(sink AuditSink, fullAnswers bool) {
+	s.handlerChain.SetAuditSink(sink, fullAnswers)
+}
+
 // Stop stops the server
 func (s *DefaultServer) Stop() {
 	s.ctxCancel()
 	s.shutdownWg.Wait()
+	s.persistResponseCache()
 
 	s.mux.Lock()
 	defer s.mux.Unlock()
@@ -513,11 +1330,24 @@ func (s *DefaultServer) Stop() {
 
 	clear(s.extraDomains)
 
+	// The engine's next server starts unfrozen and not bypassed, so the
+	// status must not keep reporting either state of this one.
+	if s.frozen {
+		s.frozen = false
+		s.pendingUpdate = nil
+		s.setFrozenStatus(false)
+	}
+	if s.bypassed {
+		s.bypassed = false
+		s.setBypassedStatus(false)
+	}
+
 	// Clear health projection state so a subsequent Start doesn't
 	// inherit sticky flags (notably everHealthy) that would bypass
 	// the grace window during the next peer handshake.
 	s.healthProjectMu.Lock()
 	s.nsGroupProj = nil
+	s.stopGroupFlaps()
 	s.healthProjectMu.Unlock()
 }
 
@@ -525,7 +1355,9 @@ func (s *DefaultServer) disableDNS() (retErr error) {
 	defer func() {
 		if err := s.service.Stop(); err != nil {
 			retErr = errors.Join(retErr, fmt.Errorf("stop DNS service: %w", err))
+			return
 		}
+		s.setListening(false)
 	}()
 
 	if s.isUsingNoopHostManager() {
@@ -537,17 +1369,39 @@ func (s *DefaultServer) disableDNS() (retErr error) {
 		s.clearFallback()
 	}
 
-	if err := s.hostManager.restoreHostDNS(); err != nil {
-		log.Errorf("failed to restore host DNS settings: %v", err)
+	if s.bypassed {
+		log.Debugf("host DNS already restored by the DNS bypass")
+	} else if err := s.restoreHostDNS(); err != nil {
+		log.Errorf("failed to restore host DNS settings, leaving them for cleanup on the next start: %v", err)
 	} else if err := s.stateManager.DeleteState(&ShutdownState{}); err != nil {
 		log.Errorf("failed to delete shutdown dns state: %v", err)
 	}
 
+	s.emitHostManagerEvent(EventHostManagerDeactivated)
 	s.hostManager = &noopHostConfigurator{}
+	s.hostDomains = nil
+	s.hostConfigApplied, s.hostConfigErr = false, nil
 
 	return nil
 }
 
+// restoreHostDNS reverts the host DNS settings, retrying while some of them
+// fail to revert. Host managers attempt every setting on each call, so a
+// retry picks up the ones left behind. Must be called with s.mux held.
+func (s *DefaultServer) restoreHostDNS() error {
+	var err error
+	for attempt := 1; attempt <= hostRestoreAttempts; attempt++ {
+		if err = s.hostManager.restoreHostDNS(); err == nil {
+			return nil
+		}
+		log.Warnf("restoring host DNS settings failed (attempt %d/%d): %v", attempt, hostRestoreAttempts, err)
+		if attempt < hostRestoreAttempts {
+			time.Sleep(hostRestoreRetryDelay)
+		}
+	}
+	return err
+}
+
 // OnUpdatedHostDNSServer updates the fallback DNS upstreams. Called by Android
 // outside the engine's sync mux when the OS reports a network change, so it
 // takes s.mux to serialize against host manager swaps in Initialize/enableDNS.
@@ -560,47 +1414,106 @@ func (s *DefaultServer) OnUpdatedHostDNSServer(hostsDnsList []netip.AddrPort) {
 	s.registerFallback()
 }
 
-// UpdateDNSServer processes an update received from the management service
+// UpdateDNSServer processes an update received from the management service.
+// Failures wrap ErrStaleSerial, a LocalHandlerError, an UpstreamHandlerError
+// or a HostConfigError, for callers to tell them apart with errors.Is and
+// errors.As.
 func (s *DefaultServer) UpdateDNSServer(serial uint64, update nbdns.Config) error {
 	if s.ctx.Err() != nil {
 		log.Infof("not updating DNS server as context is closed")
 		return s.ctx.Err()
 	}
 
-	if serial < s.updateSerial {
-		return fmt.Errorf("not applying dns update, error: "+
-			"network update is %d behind the last applied update", s.updateSerial-serial)
+	if netserial.Stale(serial, s.updateSerial) {
+		return fmt.Errorf("not applying dns update: %w: network update is %d behind the last applied update",
+			ErrStaleSerial, s.updateSerial-serial)
 	}
 
 	s.mux.Lock()
 	defer s.mux.Unlock()
 
-	hash, err := hashstructure.Hash(update, hashstructure.FormatV2, &hashstructure.HashOptions{
-		ZeroNil:         true,
-		IgnoreZeroValue: true,
-		SlicesAsSets:    true,
-		UseStringer:     true,
-	})
-	if err != nil {
-		log.Errorf("unable to hash the dns configuration update, got error: %s", err)
+	if s.frozen {
+		if s.pendingUpdate != nil && netserial.Stale(serial, s.pendingUpdate.serial) {
+			return fmt.Errorf("not holding dns update: %w: network update is %d behind the pending update",
+				ErrStaleSerial, s.pendingUpdate.serial-serial)
+		}
+		log.Debugf("DNS updates frozen, holding back update with serial %d", serial)
+		s.pendingUpdate = &pendingDNSUpdate{serial: serial, config: update}
+		return nil
+	}
+
+	return s.applyUpdate(serial, update)
+}
+
+// applyUpdate applies a management update unless it matches the last one
+// or a config override holds it back. Must be called with s.mux held.
+func (s *DefaultServer) applyUpdate(serial uint64, update nbdns.Config) error {
+	if s.override != nil {
+		if !s.override.supersededBy(serial) {
+			log.Debugf("DNS config override active, holding back update with serial %d", serial)
+			s.override.mgmt = &pendingDNSUpdate{serial: serial, config: update}
+			return nil
+		}
+		log.Infof("DNS update with serial %d supersedes the config override serial %d", serial, s.override.serial)
+		s.dropOverride()
 	}
 
-	if s.previousConfigHash == hash {
+	hash, hashErr := s.hashUpdate(update)
+	if hashErr != nil {
+		log.Warnf("unable to hash the dns configuration update, will apply it anyway: %v", hashErr)
+	} else if s.previousConfigHash == hash {
 		log.Debugf("not applying the dns configuration update as there is nothing new")
 		s.updateSerial = serial
 		return nil
 	}
 
-	if err := s.applyConfiguration(update); err != nil {
+	err := s.applyConfiguration(serial, update)
+	if err != nil && !onlyHostConfigFailed(err) {
 		return fmt.Errorf("apply configuration: %w", err)
 	}
 
+	// Only the host config failed: the update is in place, but its hash
+	// isn't recorded, so the next update applies the host config again.
 	s.updateSerial = serial
-	s.previousConfigHash = hash
+	s.appliedConfig = update
+	s.setPreviousConfigHash(hash, errors.Join(hashErr, err))
 
+	if err != nil {
+		return fmt.Errorf("apply configuration: %w", err)
+	}
 	return nil
 }
 
+func (s *DefaultServer) hashUpdate(update nbdns.Config) (uint64, error) {
+	if s.hashUpdateFunc != nil {
+		return s.hashUpdateFunc(update)
+	}
+	return hashConfig(update)
+}
+
+// setPreviousConfigHash records the hash of the applied management config.
+// When hashing or applying the host config failed, the hash is reset to the
+// max uint64 sentinel, so the next update is applied once instead of being
+// compared against a stale or bogus hash.
+func (s *DefaultServer) setPreviousConfigHash(hash uint64, err error) {
+	if err != nil {
+		s.previousConfigHash = ^uint64(0)
+		return
+	}
+	s.previousConfigHash = hash
+}
+
+// EffectiveSearchDomains returns the domains last applied to the host: the
+// configured domains plus the extra match-only domains of registered
+// handlers, without disabled ones. Unlike SearchDomains, which lists the
+// search line, it includes the match-only domains, so it shows what the host
+// resolves through NetBird. It is empty while the host DNS isn't configured.
+func (s *DefaultServer) EffectiveSearchDomains() []DomainConfig {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	return slices.Clone(s.hostDomains)
+}
+
 func (s *DefaultServer) SearchDomains() []string {
 	var searchDomains []string
 
@@ -639,7 +1552,80 @@ func (s *DefaultServer) UpdateServerConfig(domains dnsconfig.ServerDomains) erro
 	return nil
 }
 
-func (s *DefaultServer) applyConfiguration(update nbdns.Config) error {
+// SetCustomZones replaces the custom zones served by the local resolver.
+// Upstream handlers and the host DNS config are left untouched, and only
+// zones that were added or removed are re-registered in the handler chain.
+// The next management update replaces the zones again.
+func (s *DefaultServer) SetCustomZones(zones []nbdns.CustomZone) error {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+
+	localMuxUpdates, localZones, err := s.buildLocalHandlerUpdate(zones)
+	if err != nil {
+		return &LocalHandlerError{Err: err}
+	}
+	localZones = s.zoneSerials.withSOA(localZones, 0)
+
+	wanted := make(map[string]struct{}, len(localMuxUpdates))
+	for _, update := range localMuxUpdates {
+		wanted[update.domain] = struct{}{}
+	}
+
+	muxUpdates := make([]handlerWrapper, 0, len(s.dnsMuxHandlers)+len(localMuxUpdates))
+	registered := make(map[string]struct{})
+	for _, existing := range s.dnsMuxHandlers {
+		if existing.handler != s.localResolver {
+			muxUpdates = append(muxUpdates, existing)
+			continue
+		}
+		if _, ok := wanted[existing.domain]; !ok {
+			s.deregisterHandler([]string{existing.domain}, existing.priority)
+			continue
+		}
+		muxUpdates = append(muxUpdates, existing)
+		registered[existing.domain] = struct{}{}
+	}
+	for _, update := range localMuxUpdates {
+		if _, ok := registered[update.domain]; ok {
+			continue
+		}
+		s.registerHandler([]string{update.domain}, update.handler, update.priority)
+		muxUpdates = append(muxUpdates, update)
+		registered[update.domain] = struct{}{}
+	}
+
+	old := s.dnsMuxHandlers
+	s.dnsMuxHandlers = muxUpdates
+	s.notifyMuxChange(old, muxUpdates)
+
+	s.localResolver.Update(localZones)
+	if s.zoneNotifier != nil {
+		s.zoneNotifier.update(s.ctx, localZones)
+	}
+
+	// keep the applied config in sync so an identical management update
+	// isn't skipped as a no-op and restores its own zones
+	s.appliedConfig.CustomZones = zones
+	s.setPreviousConfigHash(s.hashUpdate(s.appliedConfig))
+
+	return nil
+}
+
+// dns64Prefix returns the NAT64 prefix the local resolver synthesizes AAAA
+// records with, an invalid prefix if update doesn't enable DNS64.
+func dns64Prefix(update nbdns.Config) netip.Prefix {
+	if !update.DNS64 {
+		return netip.Prefix{}
+	}
+	if !update.DNS64Prefix.IsValid() {
+		return nbdns.DefaultDNS64Prefix
+	}
+	return update.DNS64Prefix
+}
+
+// applyConfiguration applies update, serial is the serial of the network map
+// it came with, zero if none. Must be called with s.mux held.
+func (s *DefaultServer) applyConfiguration(serial uint64, update nbdns.Config) error {
 	// is the service should be Disabled, we stop the listener or fake resolver
 	if update.ServiceEnable {
 		if err := s.enableDNS(); err != nil {
@@ -653,29 +1639,38 @@ func (s *DefaultServer) applyConfiguration(update nbdns.Config) error {
 
 	localMuxUpdates, localZones, err := s.buildLocalHandlerUpdate(update.CustomZones)
 	if err != nil {
-		return fmt.Errorf("local handler updater: %w", err)
+		return &LocalHandlerError{Err: err}
 	}
+	localZones = s.zoneSerials.withSOA(localZones, serial)
 
 	upstreamMuxUpdates, err := s.buildUpstreamHandlerUpdate(update.NameServerGroups)
 	if err != nil {
-		return fmt.Errorf("upstream handler updater: %w", err)
+		return &UpstreamHandlerError{Err: err}
 	}
+	hostMuxUpdates, hostRecords := s.buildStaticHostsUpdate(update.StaticHosts)
 	muxUpdates := append(localMuxUpdates, upstreamMuxUpdates...) //nolint:gocritic
+	muxUpdates = append(muxUpdates, hostMuxUpdates...)
 
 	s.updateMux(muxUpdates)
 
 	s.localResolver.Update(localZones)
+	s.localResolver.UpdateSourceRecords(local.SourceStaticHosts, hostRecords)
+	s.localResolver.SetDNS64Prefix(dns64Prefix(update))
+	if s.zoneNotifier != nil {
+		s.zoneNotifier.update(s.ctx, localZones)
+	}
 
 	s.currentConfig = dnsConfigToHostDNSConfig(update, s.service.RuntimeIP(), s.service.RuntimePort())
 
 	if s.service.RuntimePort() != DefaultPort && !s.hostManager.supportCustomPort() {
-		log.Warnf("the DNS manager of this peer doesn't support custom port. Disabling primary DNS setup. " +
-			"Learn more at: https://docs.netbird.io/how-to/manage-dns-in-your-network#local-resolver")
+		log.Warnf("the DNS manager of this peer doesn't support custom port%s. Disabling primary DNS setup. "+
+			"Learn more at: https://docs.netbird.io/how-to/manage-dns-in-your-network#local-resolver", s.customPortReason())
 		s.currentConfig.RouteAll = false
 	}
 
 	// Always apply host config for management updates, regardless of batch mode
 	s.applyHostConfig()
+	hostErr := s.hostConfigErr
 
 	s.shutdownWg.Add(1)
 	go func() {
@@ -688,12 +1683,56 @@ func (s *DefaultServer) applyConfiguration(update nbdns.Config) error {
 	if s.searchDomainNotifier != nil {
 		s.searchDomainNotifier.onNewSearchDomains(s.SearchDomains())
 	}
+	if s.searchDomainResolver != nil {
+		s.searchDomainResolver.setDomains(s.SearchDomains())
+	}
 
 	s.updateNSGroupStates(update.NameServerGroups)
+	s.emitEvent(ServiceEvent{Type: EventConfigApplied, Serial: serial})
 
+	if hostErr != nil {
+		return &HostConfigError{Err: hostErr}
+	}
 	return nil
 }
 
+// customPortReason describes why the service listens on a custom port, for
+// the warning about disabling the primary DNS setup.
+func (s *DefaultServer) customPortReason() string {
+	var listenErr *ListenError
+	if !errors.As(s.service.DefaultPortError(), &listenErr) {
+		return ""
+	}
+	switch listenErr.Failure {
+	case ListenFailurePortInUse:
+		return fmt.Sprintf(" and port %d is taken by another process on %s", DefaultPort, listenErr.Addr.Addr())
+	case ListenFailurePermission:
+		return fmt.Sprintf(" and binding port %d was denied, grant the client CAP_NET_BIND_SERVICE to use it", DefaultPort)
+	default:
+		return fmt.Sprintf(" and port %d failed to bind: %v", DefaultPort, listenErr.Err)
+	}
+}
+
+// SetHostManager installs a custom host manager used by Initialize and when
+// DNS is re-enabled, instead of the one detected for the platform. Call it
+// before Initialize; it is ignored while system DNS is disabled. Pass nil to
+// restore auto-detection.
+func (s *DefaultServer) SetHostManager(manager HostManager) {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	s.customHostManager = manager
+}
+
+// newHostManager returns the custom host manager if one is set, otherwise
+// the platform one.
+func (s *DefaultServer) newHostManager() (hostManager, error) {
+	if s.customHostManager != nil {
+		log.Infof("using custom host manager %s", s.customHostManager)
+		return customHostManager{s.customHostManager}, nil
+	}
+	return s.initialize()
+}
+
 func (s *DefaultServer) isUsingNoopHostManager() bool {
 	_, isNoop := s.hostManager.(*noopHostConfigurator)
 	return isNoop
@@ -703,6 +1742,7 @@ func (s *DefaultServer) enableDNS() error {
 	if err := s.service.Listen(); err != nil {
 		return fmt.Errorf("start DNS service: %w", err)
 	}
+	s.setListening(true)
 
 	if !s.isUsingNoopHostManager() {
 		return nil
@@ -718,11 +1758,12 @@ func (s *DefaultServer) enableDNS() error {
 		return errors.New("DNS service runtime IP is invalid")
 	}
 
-	hostManager, err := s.initialize()
+	hostManager, err := s.newHostManager()
 	if err != nil {
 		return fmt.Errorf("initialize host manager: %w", err)
 	}
 	s.hostManager = hostManager
+	s.emitHostManagerEvent(EventHostManagerActivated)
 
 	return nil
 }
@@ -732,6 +1773,10 @@ func (s *DefaultServer) applyHostConfig() {
 	if s.ctx.Err() != nil {
 		return
 	}
+	if s.bypassed {
+		log.Debugf("not applying host config while DNS is bypassed")
+		return
+	}
 
 	config := s.currentConfig
 
@@ -754,12 +1799,7 @@ func (s *DefaultServer) applyHostConfig() {
 
 	log.Debugf("extra match domains: %v", maps.Keys(s.extraDomains))
 
-	hash, err := hashstructure.Hash(config, hashstructure.FormatV2, &hashstructure.HashOptions{
-		ZeroNil:         true,
-		IgnoreZeroValue: true,
-		SlicesAsSets:    true,
-		UseStringer:     true,
-	})
+	hash, err := hashConfig(config)
 	if err != nil {
 		log.Warnf("unable to hash the host dns configuration, will apply config anyway: %s", err)
 		// Fall through to apply config anyway (fail-safe approach)
@@ -771,8 +1811,11 @@ func (s *DefaultServer) applyHostConfig() {
 	log.Debugf("applying host config as there are changes")
 	if err := s.hostManager.applyDNSConfig(config, s.stateManager); err != nil {
 		log.Errorf("failed to apply DNS host manager update: %v", err)
+		s.hostConfigErr = err
 		return
 	}
+	s.hostDomains = enabledDomains(config.Domains)
+	s.hostConfigApplied, s.hostConfigErr = true, nil
 
 	// Only update hash if it was computed successfully and config was applied
 	if err == nil {
@@ -783,27 +1826,18 @@ func (s *DefaultServer) applyHostConfig() {
 }
 
 // registerFallback registers original nameservers as low-priority fallback handlers.
-// Replaces and Stop()s the previously-registered fallback handler so its
-// context is released rather than leaked until GC.
+// The previously-registered fallback handler is replaced in the chain and
+// Stop()ped afterwards, so its context is released rather than leaked until GC.
 func (s *DefaultServer) registerFallback() {
-	originalNameservers := s.hostManager.getOriginalNameservers()
-
-	serverIP := s.service.RuntimeIP()
-	var servers []netip.AddrPort
-	for _, ns := range originalNameservers {
-		if ns == serverIP {
-			log.Debugf("skipping original nameserver %s as it is the same as the server IP %s", ns, serverIP)
-			continue
-		}
-		servers = append(servers, netip.AddrPortFrom(ns, DefaultPort))
-	}
-
+	servers := s.fallbackServers()
 	if len(servers) == 0 {
 		log.Debugf("no fallback upstreams to register; clearing PriorityFallback handler")
 		s.clearFallback()
 		return
 	}
 
+	s.setBootstrapNameservers(servers)
+
 	log.Infof("registering original nameservers %v as upstream handlers with priority %d", servers, PriorityFallback)
 
 	handler, err := newUpstreamResolver(
@@ -818,21 +1852,54 @@ func (s *DefaultServer) registerFallback() {
 		return
 	}
 	handler.selectedRoutes = s.selectedRoutes
+	handler.setServfailHoldDown(s.servfailHoldDown)
+	handler.setUpstreamHistory(s.upstreamHistory)
+	handler.setConnPool(s.upstreamPoolSize, s.upstreamIdleTimeout)
+	handler.setPrivateReverse(s.privateReverse)
 	handler.addRace(servers)
+	handler.setEDNSAllowlist(servers, s.ednsAllowlist)
 
 	prev := s.fallbackHandler
 	s.fallbackHandler = handler
+	if s.captivePortal != nil {
+		s.captivePortal.setPassthrough(handler)
+	}
+	if s.passthrough != nil {
+		s.passthrough.setUpstream(handler)
+	}
 	s.registerHandler([]string{nbdns.RootZone}, handler, PriorityFallback)
-	if prev != nil {
+
+	if prev != nil && !sameHandler(prev, handler) {
 		prev.Stop()
 	}
 }
 
+// fallbackServers returns the host's original nameservers the fallback
+// handler forwards to, without our own DNS server.
+func (s *DefaultServer) fallbackServers() []netip.AddrPort {
+	serverIP := s.service.RuntimeIP()
+	var servers []netip.AddrPort
+	for _, ns := range s.hostManager.getOriginalNameservers() {
+		if ns == serverIP {
+			log.Debugf("skipping original nameserver %s as it is the same as the server IP %s", ns, serverIP)
+			continue
+		}
+		servers = append(servers, netip.AddrPortFrom(ns, DefaultPort))
+	}
+	return servers
+}
+
 func (s *DefaultServer) clearFallback() {
 	s.deregisterHandler([]string{nbdns.RootZone}, PriorityFallback)
 	if s.fallbackHandler != nil {
 		s.fallbackHandler.Stop()
 		s.fallbackHandler = nil
+		if s.captivePortal != nil {
+			s.captivePortal.setPassthrough(nil)
+		}
+		if s.passthrough != nil {
+			s.passthrough.setUpstream(nil)
+		}
 	}
 }
 
@@ -861,7 +1928,14 @@ func (s *DefaultServer) buildLocalHandlerUpdate(customZones []nbdns.CustomZone)
 			}
 			localRecords = append(localRecords, record)
 		}
-		customZone.Records = localRecords
+		customZone.Records = withDefaultTTL(localRecords, s.defaultRecordTTL)
+		if len(customZone.SubnetRecords) > 0 {
+			sets := make([]nbdns.SubnetRecordSet, len(customZone.SubnetRecords))
+			for i, set := range customZone.SubnetRecords {
+				sets[i] = nbdns.SubnetRecordSet{Subnet: set.Subnet, Records: withDefaultTTL(set.Records, s.defaultRecordTTL)}
+			}
+			customZone.SubnetRecords = sets
+		}
 		zones = append(zones, customZone)
 	}
 
@@ -889,14 +1963,16 @@ func (s *DefaultServer) buildUpstreamHandlerUpdate(nameServerGroups []*nbdns.Nam
 	}
 
 	groupedNS := groupNSGroupsByDomain(nameServerGroups)
+	limiters := make(map[nsGroupID]*inflightLimiter)
+	s.familyErrors = nil
 
 	for _, domainGroup := range groupedNS {
-		priority := PriorityUpstream
+		tier := TierUpstream
 		if domainGroup.domain == nbdns.RootZone {
-			priority = PriorityDefault
+			tier = TierDefault
 		}
 
-		update, err := s.buildMergedDomainHandler(domainGroup, priority)
+		update, err := s.buildMergedDomainHandler(domainGroup, tier.Max, limiters)
 		if err != nil {
 			if errors.Is(err, errNoUsableNameservers) {
 				log.Errorf("no usable nameservers for domain=%s", domainGroup.domain)
@@ -906,13 +1982,16 @@ func (s *DefaultServer) buildUpstreamHandlerUpdate(nameServerGroups []*nbdns.Nam
 		}
 		muxUpdates = append(muxUpdates, *update)
 	}
+	s.inflightLimiters = limiters
 
 	return muxUpdates, nil
 }
 
 // buildMergedDomainHandler merges every nameserver group that targets the
 // same domain into one handler whose inner groups are raced in parallel.
-func (s *DefaultServer) buildMergedDomainHandler(domainGroup nsGroupsByDomain, priority int) (*handlerWrapper, error) {
+// The in-flight limiters of the groups are taken from limiters, shared with
+// the handlers of their other domains.
+func (s *DefaultServer) buildMergedDomainHandler(domainGroup nsGroupsByDomain, priority int, limiters map[nsGroupID]*inflightLimiter) (*handlerWrapper, error) {
 	handler, err := newUpstreamResolver(
 		s.ctx,
 		s.wgInterface,
@@ -924,14 +2003,56 @@ func (s *DefaultServer) buildMergedDomainHandler(domainGroup nsGroupsByDomain, p
 		return nil, fmt.Errorf("create upstream resolver: %v", err)
 	}
 	handler.selectedRoutes = s.selectedRoutes
+	handler.setServfailHoldDown(s.servfailHoldDown)
+	handler.setUpstreamHistory(s.upstreamHistory)
+	handler.setConnPool(s.upstreamPoolSize, s.upstreamIdleTimeout)
+	handler.setGroupsDownPolicy(s.groupsDownPolicyFor(domainGroup.domain))
+	handler.setResponseCache(s.responseCacheSize)
+	handler.setCacheTTLPolicies(s.cacheTTLPolicies)
+	s.warmResponseCache(domainGroup.domain, handler)
+	handler.metrics = s.metrics
+	if domainGroup.domain != nbdns.RootZone {
+		handler.reverseCache = s.reverseCache
+	} else {
+		handler.setPrivateReverse(s.privateReverse)
+	}
 
+	// The server-wide settings the handler is built with are fixed at
+	// construction, so the groups, their servers and limiters make up the
+	// whole configuration.
+	var fingerprint strings.Builder
+	fmt.Fprintf(&fingerprint, "%s/%d", domainGroup.domain, priority)
 	for _, nsGroup := range domainGroup.groups {
 		servers := s.filterNameServers(nsGroup.NameServers)
 		if len(servers) == 0 {
 			log.Warnf("nameserver group for domain=%s yielded no usable servers, skipping", domainGroup.domain)
 			continue
 		}
-		handler.addRace(servers)
+		if servers = s.reachableServers(nsGroup, servers); len(servers) == 0 {
+			continue
+		}
+		limiter := s.inflightLimiterFor(nsGroup, limiters)
+		fmt.Fprintf(&fingerprint, "|%+v %v %p", *nsGroup, servers, limiter)
+		handler.addLimitedRace(servers, limiter)
+		handler.setRacePolicy(len(handler.upstreamServers)-1, s.selectionPolicyFor(nsGroup))
+		handler.setEDNSAllowlist(servers, s.ednsAllowlistFor(nsGroup))
+		handler.setClientSubnet(servers, nsGroup.ForwardClientSubnet, nsGroup.DefaultClientSubnet)
+		if nsGroup.AuthoritativeOnly {
+			handler.setNonRecursive(servers)
+		}
+		if s.cacheDisabledFor(nsGroup) {
+			handler.setNoCache(servers)
+		}
+		handler.setQueryTimeout(servers, nsGroup.QueryTimeout)
+		if doq := nameServersOfType(nsGroup.NameServers, servers, nbdns.DOQNameServerType); len(doq) > 0 {
+			handler.setDoQ(doq)
+		}
+		if dot := nameServersOfType(nsGroup.NameServers, servers, nbdns.DOTNameServerType); len(dot) > 0 {
+			handler.setDoT(dot, nameServerHostnames(nsGroup.NameServers))
+		}
+		if tcp := nameServersOfType(nsGroup.NameServers, servers, nbdns.TCPNameServerType); len(tcp) > 0 {
+			handler.setTCP(tcp)
+		}
 	}
 
 	if len(handler.upstreamServers) == 0 {
@@ -942,18 +2063,28 @@ func (s *DefaultServer) buildMergedDomainHandler(domainGroup nsGroupsByDomain, p
 	log.Debugf("creating merged handler for domain=%s with %d group(s) priority=%d", domainGroup.domain, len(handler.upstreamServers), priority)
 
 	return &handlerWrapper{
-		domain:   domainGroup.domain,
-		handler:  handler,
-		priority: priority,
+		domain:      domainGroup.domain,
+		handler:     handler,
+		priority:    priority,
+		fingerprint: fingerprint.String(),
 	}, nil
 }
 
 func (s *DefaultServer) filterNameServers(nameServers []nbdns.NameServer) []netip.AddrPort {
 	var out []netip.AddrPort
 	for _, ns := range nameServers {
-		if ns.NSType != nbdns.UDPNameServerType {
-			log.Warnf("skipping nameserver %s with type %s, this peer supports only %s",
-				ns.IP.String(), ns.NSType.String(), nbdns.UDPNameServerType.String())
+		if ns.NSType == nbdns.DOQNameServerType && !doqSupported() {
+			log.Warnf("skipping nameserver %s, DNS over QUIC is not supported on this platform", ns.IP.String())
+			continue
+		}
+		if ns.NSType == nbdns.DOTNameServerType && !dotSupported() {
+			log.Warnf("skipping nameserver %s, DNS over TLS is not supported on this platform", ns.IP.String())
+			continue
+		}
+		if !supportedNameServerType(ns.NSType) {
+			log.Warnf("skipping nameserver %s with type %s, this peer supports only %s, %s, %s and %s",
+				ns.IP.String(), ns.NSType.String(), nbdns.UDPNameServerType.String(),
+				nbdns.TCPNameServerType.String(), nbdns.DOQNameServerType.String(), nbdns.DOTNameServerType.String())
 			continue
 		}
 		if ns.IP == s.service.RuntimeIP() {
@@ -965,6 +2096,46 @@ func (s *DefaultServer) filterNameServers(nameServers []nbdns.NameServer) []neti
 	return out
 }
 
+func supportedNameServerType(t nbdns.NameServerType) bool {
+	switch t {
+	case nbdns.UDPNameServerType, nbdns.TCPNameServerType:
+		return true
+	case nbdns.DOQNameServerType:
+		return doqSupported()
+	case nbdns.DOTNameServerType:
+		return dotSupported()
+	default:
+		return false
+	}
+}
+
+// nameServerHostnames returns the configured hostnames of nameServers by
+// address.
+func nameServerHostnames(nameServers []nbdns.NameServer) map[netip.AddrPort]string {
+	var out map[netip.AddrPort]string
+	for _, ns := range nameServers {
+		if ns.Hostname == "" {
+			continue
+		}
+		if out == nil {
+			out = make(map[netip.AddrPort]string)
+		}
+		out[ns.AddrPort()] = ns.Hostname
+	}
+	return out
+}
+
+// nameServersOfType returns the filtered servers configured with nsType.
+func nameServersOfType(nameServers []nbdns.NameServer, filtered []netip.AddrPort, nsType nbdns.NameServerType) []netip.AddrPort {
+	var out []netip.AddrPort
+	for _, ns := range nameServers {
+		if ns.NSType == nsType && slices.Contains(filtered, ns.AddrPort()) {
+			out = append(out, ns.AddrPort())
+		}
+	}
+	return out
+}
+
 // usableNameServers returns the subset of nameServers the handler would
 // actually query. Matches filterNameServers without the warning logs, so
 // it's safe to call on every health-projection tick.
@@ -975,7 +2146,7 @@ func (s *DefaultServer) usableNameServers(nameServers []nbdns.NameServer) []neti
 	}
 	var out []netip.AddrPort
 	for _, ns := range nameServers {
-		if ns.NSType != nbdns.UDPNameServerType {
+		if !supportedNameServerType(ns.NSType) {
 			continue
 		}
 		if runtimeIP.IsValid() && ns.IP == runtimeIP {
@@ -986,10 +2157,63 @@ func (s *DefaultServer) usableNameServers(nameServers []nbdns.NameServer) []neti
 	return out
 }
 
+// updateMux replaces the registered handlers with muxUpdates, touching only
+// what changed. Registrations whose domain, priority and handler are the
+// same stay in place, and an upstream handler rebuilt from an unchanged
+// configuration is dropped for the registered one, which keeps its warm
+// connections and cache. Changed registrations are swapped in place: the
+// chain replaces the handler of a domain and priority atomically. Replaced
+// and removed handlers are stopped once the new set is registered.
 func (s *DefaultServer) updateMux(muxUpdates []handlerWrapper) {
-	// this will introduce a short period of time when the server is not able to handle DNS requests
+	type muxKey struct {
+		domain   string
+		priority int
+	}
+	current := make(map[muxKey]handlerWrapper, len(s.dnsMuxHandlers))
+	for _, existing := range s.dnsMuxHandlers {
+		current[muxKey{existing.domain, existing.priority}] = existing
+	}
+
+	updated := make([]handlerWrapper, 0, len(muxUpdates))
+	kept := make(map[handlerWithStop]struct{})
+	var changed []handlerWrapper
+	for _, update := range muxUpdates {
+		key := muxKey{update.domain, update.priority}
+		existing, ok := current[key]
+		if ok && existing.handler != update.handler && update.fingerprint != "" && existing.fingerprint == update.fingerprint {
+			// Rebuilt unchanged: keep the registered handler.
+			update.handler.Stop()
+			update.handler = existing.handler
+		}
+		if !ok || existing.handler != update.handler {
+			changed = append(changed, update)
+		}
+		kept[update.handler] = struct{}{}
+		delete(current, key)
+		updated = append(updated, update)
+	}
+
+	if len(changed) > 0 || len(current) > 0 {
+		// Queries arriving while the chain is being changed are queued and
+		// replayed once the new set is complete.
+		s.handlerChain.BeginSwap()
+		for _, update := range changed {
+			s.registerHandler([]string{update.domain}, update.handler, update.priority)
+		}
+		for _, removed := range current {
+			s.deregisterHandler([]string{removed.domain}, removed.priority)
+		}
+		s.handlerChain.EndSwap()
+	}
+
+	stopped := make(map[handlerWithStop]struct{})
 	for _, existing := range s.dnsMuxHandlers {
-		s.deregisterHandler([]string{existing.domain}, existing.priority)
+		if _, ok := kept[existing.handler]; ok {
+			continue
+		}
+		if _, ok := stopped[existing.handler]; ok {
+			continue
+		}
 		// The local resolver is a persistent singleton shared by every custom
 		// zone and reused across config updates. Its chain registrations are
 		// per-config and must be deregistered, but Stop() cancels its lookup
@@ -998,19 +2222,23 @@ func (s *DefaultServer) updateMux(muxUpdates []handlerWrapper) {
 		if existing.handler != s.localResolver {
 			existing.handler.Stop()
 		}
+		stopped[existing.handler] = struct{}{}
 	}
 
-	for _, update := range muxUpdates {
-		s.registerHandler([]string{update.domain}, update.handler, update.priority)
-	}
-
-	s.dnsMuxHandlers = muxUpdates
+	old := s.dnsMuxHandlers
+	s.dnsMuxHandlers = updated
+	s.notifyMuxChange(old, updated)
 }
 
 // updateNSGroupStates records the new group set and pokes the refresher.
 // Must hold s.mux; projection runs async (see refreshHealth for why).
 func (s *DefaultServer) updateNSGroupStates(groups []*nbdns.NameServerGroup) {
 	s.nsGroups = groups
+	s.requestHealthRefresh()
+}
+
+// requestHealthRefresh pokes the refresher without blocking.
+func (s *DefaultServer) requestHealthRefresh() {
 	select {
 	case s.healthRefresh <- struct{}{}:
 	default:
@@ -1023,6 +2251,10 @@ func (s *DefaultServer) refreshHealth() {
 	s.mux.Lock()
 	groups := s.nsGroups
 	merged := s.collectUpstreamHealth()
+	inflight := s.inflightCounts()
+	familyErrors := maps.Clone(s.familyErrors)
+	handlers := s.groupsDownHandlers()
+	probers := s.availabilityProbers()
 	selFn := s.selectedRoutes
 	actFn := s.activeRoutes
 	s.mux.Unlock()
@@ -1036,11 +2268,18 @@ func (s *DefaultServer) refreshHealth() {
 	}
 
 	s.projectNSGroupHealth(nsHealthSnapshot{
-		groups:   groups,
-		merged:   merged,
-		selected: selected,
-		active:   active,
+		groups:       groups,
+		merged:       merged,
+		selected:     selected,
+		active:       active,
+		inflight:     inflight,
+		familyErrors: familyErrors,
+		handlers:     handlers,
+		probers:      probers,
 	})
+	s.persistUpstreamHistory()
+	s.persistDeactivatedGroups()
+	s.persistResponseCache()
 }
 
 // projectNSGroupHealth applies the emission rules to the snapshot and
@@ -1066,6 +2305,9 @@ func (s *DefaultServer) projectNSGroupHealth(snap nsHealthSnapshot) {
 	if s.nsGroupProj == nil {
 		s.nsGroupProj = make(map[nsGroupID]*nsGroupProj)
 	}
+	if s.deactivatedGroups == nil {
+		s.deactivatedGroups = make(map[nsGroupID]time.Time)
+	}
 
 	now := time.Now()
 	delay := s.warningDelay(haMapRouteCount(snap.selected))
@@ -1076,16 +2318,27 @@ func (s *DefaultServer) projectNSGroupHealth(snap nsHealthSnapshot) {
 		if len(servers) == 0 {
 			continue
 		}
-		verdict, groupErr := evaluateNSGroupHealth(snap.merged, servers, now)
+		verdict, groupErr := evaluateNSGroupHealth(snap.merged, servers, group.DeactivationThreshold, now)
 		id := generateGroupKey(group)
 		seen[id] = struct{}{}
 
+		if err := snap.familyErrors[id]; err != nil {
+			states = append(states, peer.NSGroupState{
+				ID:      string(id),
+				Servers: servers,
+				Domains: group.Domains,
+				Error:   err,
+			})
+			continue
+		}
+
 		immediate := s.groupHasImmediateUpstream(servers, snap)
 
 		p, known := s.nsGroupProj[id]
 		if !known {
 			p = &nsGroupProj{}
 			s.nsGroupProj[id] = p
+			s.restoreGroup(id, p, group, servers, snap.probers)
 		}
 
 		enabled := true
@@ -1099,25 +2352,51 @@ func (s *DefaultServer) projectNSGroupHealth(snap nsHealthSnapshot) {
 			// warning is already active for this group. Also clear any
 			// prior Unhealthy streak so a later Unhealthy verdict starts
 			// a fresh grace window rather than inheriting a stale one.
+			// Restored groups wait for their probe.
 			p.unhealthySince = time.Time{}
-			enabled = !p.warningActive
+			enabled = !p.warningActive && !p.restored
 			groupErr = nil
 		}
 
+		if p.disabled == enabled {
+			p.disabled = !enabled
+			s.emitGroupEvent(id, group, enabled)
+			s.recordGroupState(id, enabled, now)
+			s.queueGroupFlap(id, group, enabled, groupErr)
+		}
+
 		states = append(states, peer.NSGroupState{
-			ID:      string(id),
-			Servers: servers,
-			Domains: group.Domains,
-			Enabled: enabled,
-			Error:   groupErr,
+			ID:       string(id),
+			Servers:  servers,
+			Domains:  group.Domains,
+			Enabled:  enabled,
+			Error:    groupErr,
+			InFlight: snap.inflight[id],
 		})
 	}
 	for id := range s.nsGroupProj {
 		if _, ok := seen[id]; !ok {
 			delete(s.nsGroupProj, id)
+			if _, ok := s.deactivatedGroups[id]; ok {
+				delete(s.deactivatedGroups, id)
+				s.deactivatedGroupsDirty = true
+			}
 		}
 	}
 	s.statusRecorder.UpdateDNSStates(states)
+	applyGroupsDown(snap.handlers, snap.groups, states)
+}
+
+// emitGroupEvent emits the deactivation or, with enabled, reactivation of
+// the group with id.
+func (s *DefaultServer) emitGroupEvent(id nsGroupID, group *nbdns.NameServerGroup, enabled bool) {
+	eventType := EventGroupDeactivated
+	if enabled {
+		eventType = EventGroupReactivated
+	} else {
+		s.metrics.recordGroupDeactivation()
+	}
+	s.emitEvent(ServiceEvent{Type: eventType, Group: string(id), Domains: slices.Clone(group.Domains)})
 }
 
 // projectHealthy records a healthy tick on p and publishes a recovery
@@ -1125,6 +2404,7 @@ func (s *DefaultServer) projectNSGroupHealth(snap nsHealthSnapshot) {
 // Enabled flag to record in NSGroupState.
 func (s *DefaultServer) projectHealthy(p *nsGroupProj, servers []netip.AddrPort) bool {
 	p.everHealthy = true
+	p.restored = false
 	p.unhealthySince = time.Time{}
 	if !p.warningActive {
 		return true
@@ -1256,6 +2536,7 @@ func (s *DefaultServer) collectUpstreamHealth() map[netip.AddrPort]UpstreamHealt
 				existing.LastFail = h.LastFail
 				existing.LastErr = h.LastErr
 			}
+			existing.ConsecutiveFails = max(existing.ConsecutiveFails, h.ConsecutiveFails)
 			merged[addr] = existing
 		}
 	}
@@ -1284,7 +2565,9 @@ func (s *DefaultServer) startHealthRefresher() {
 // alone. Per upstream, the most-recent-in-lookback observation wins.
 // Group is Healthy if any upstream is fresh-working, Unhealthy if any
 // is fresh-broken with no fresh-working sibling, Undecided otherwise.
-func evaluateNSGroupHealth(merged map[netip.AddrPort]UpstreamHealth, servers []netip.AddrPort, now time.Time) (nsGroupVerdict, error) {
+// An upstream only counts as broken once it failed threshold times in a
+// row.
+func evaluateNSGroupHealth(merged map[netip.AddrPort]UpstreamHealth, servers []netip.AddrPort, threshold int, now time.Time) (nsGroupVerdict, error) {
 	anyWorking := false
 	anyBroken := false
 	var mostRecentFail time.Time
@@ -1299,6 +2582,11 @@ func evaluateNSGroupHealth(merged map[netip.AddrPort]UpstreamHealth, servers []n
 		case upstreamFresh:
 			anyWorking = true
 		case upstreamBroken:
+			if h.ConsecutiveFails < threshold {
+				// Below the group's threshold a failing upstream counts
+				// as neither working nor broken.
+				continue
+			}
 			anyBroken = true
 			if h.LastFail.After(mostRecentFail) {
 				mostRecentFail = h.LastFail
@@ -1396,17 +2684,18 @@ func groupNSGroupsByDomain(nsGroups []*nbdns.NameServerGroup) []nsGroupsByDomain
 		})
 	}
 
+	slices.SortFunc(result, func(a, b nsGroupsByDomain) int {
+		return strings.Compare(a.domain, b.domain)
+	})
+
 	return result
 }
 
-func toZone(d domain.Domain) domain.Domain {
-	return domain.Domain(
-		nbdns.NormalizeZone(
-			dns.Fqdn(
-				strings.ToLower(d.PunycodeString()),
-			),
-		),
-	)
+// toZone returns the match domain d is configured on the host with,
+// normalized by the chain's NamePolicy so host zones and handler patterns
+// never disagree.
+func (s *DefaultServer) toZone(d domain.Domain) domain.Domain {
+	return domain.Domain(nbdns.NormalizeZone(s.handlerChain.NormalizeName(d.PunycodeString())))
 }
 
 // unhealthyEmitReason returns the tag of the rule that fires the
@@ -1426,8 +2715,21 @@ func unhealthyEmitReason(immediate, everHealthy bool, elapsed, delay time.Durati
 
 // PopulateManagementDomain populates the DNS cache with management domain
 func (s *DefaultServer) PopulateManagementDomain(mgmtURL *url.URL) error {
-	if s.mgmtCacheResolver != nil {
-		return s.mgmtCacheResolver.PopulateFromConfig(s.ctx, mgmtURL)
+	if s.mgmtCacheResolver == nil {
+		return nil
+	}
+	if err := s.mgmtCacheResolver.PopulateFromConfig(s.ctx, mgmtURL); err != nil {
+		return err
+	}
+
+	// Pinned infra records are answered as soon as they are learned, so the
+	// management name resolves before NetbirdConfig or any upstream arrives.
+	if s.mgmtCacheResolver.Pinned() {
+		s.mux.Lock()
+		defer s.mux.Unlock()
+		if domains := s.mgmtCacheResolver.GetCachedDomains(); len(domains) > 0 {
+			s.registerHandler(domains.ToPunycodeList(), s.mgmtCacheResolver, PriorityMgmtCache)
+		}
 	}
 	return nil
 }
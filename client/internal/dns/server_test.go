@@ -2,11 +2,16 @@ package dns
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"net"
 	"net/netip"
+	"net/url"
 	"os"
 	"runtime"
+	"slices"
+	"sync"
 	"testing"
 	"time"
 
@@ -550,6 +555,103 @@ func (m *mockService) RuntimeIP() netip.Addr           { return netip.MustParseA
 func (m *mockService) RuntimePort() int                { return 53 }
 func (m *mockService) RegisterMux(string, dns.Handler) {}
 func (m *mockService) DeregisterMux(string)            {}
+func (m *mockService) DefaultPortError() error         { return nil }
+
+// newTestServer returns a DefaultServer wired with test doubles and no
+// listener. A nil manager defaults to newNoopHostMocker.
+func newTestServer(manager hostManager) *DefaultServer {
+	if manager == nil {
+		manager = newNoopHostMocker()
+	}
+	resolver := local.NewResolver()
+	return &DefaultServer{
+		ctx:             context.Background(),
+		wgInterface:     &mocWGIface{},
+		service:         &mockService{},
+		localResolver:   resolver,
+		staticHosts:     &staticHostsHandler{resolver: resolver},
+		handlerChain:    NewHandlerChain(),
+		hostManager:     manager,
+		upstreamHistory: newUpstreamHistory(),
+		statusRecorder:  peer.NewRecorder("test"),
+		extraDomains:    make(map[domain.Domain]int),
+	}
+}
+
+type recordingHostManager struct {
+	applied  []HostDNSConfig
+	restored bool
+}
+
+func (m *recordingHostManager) ApplyDNSConfig(config HostDNSConfig, _ *statemanager.Manager) error {
+	m.applied = append(m.applied, config)
+	return nil
+}
+
+func (m *recordingHostManager) RestoreHostDNS() error {
+	m.restored = true
+	return nil
+}
+
+func (m *recordingHostManager) SupportCustomPort() bool { return false }
+
+func (m *recordingHostManager) GetOriginalNameservers() []netip.Addr {
+	return []netip.Addr{netip.MustParseAddr("192.0.2.53")}
+}
+
+func (m *recordingHostManager) String() string { return "recording" }
+
+func TestDefaultServer_SetHostManager(t *testing.T) {
+	custom := &recordingHostManager{}
+	server := &DefaultServer{
+		ctx:          context.Background(),
+		service:      &mockService{},
+		handlerChain: NewHandlerChain(),
+		hostManager:  &noopHostConfigurator{},
+		extraDomains: make(map[domain.Domain]int),
+	}
+	server.SetHostManager(custom)
+
+	require.NoError(t, server.enableDNS())
+	require.False(t, server.isUsingNoopHostManager(), "custom host manager should replace the noop one")
+
+	assert.Equal(t, "recording", server.hostManager.string())
+	assert.False(t, server.hostManager.supportCustomPort())
+	assert.Equal(t, []netip.Addr{netip.MustParseAddr("192.0.2.53")}, server.hostManager.getOriginalNameservers())
+
+	cfg := HostDNSConfig{ServerIP: netip.MustParseAddr("127.0.0.1"), ServerPort: 53}
+	require.NoError(t, server.hostManager.applyDNSConfig(cfg, nil))
+	require.Len(t, custom.applied, 1)
+	assert.Equal(t, cfg, custom.applied[0])
+
+	require.NoError(t, server.hostManager.restoreHostDNS())
+	assert.True(t, custom.restored)
+}
+
+func TestDefaultServer_RegisterFallbackStopsPrevious(t *testing.T) {
+	server := newTestServer(customHostManager{&recordingHostManager{}})
+	matchGroup := func(d string) nbdns.Config {
+		return nbdns.Config{
+			ServiceEnable: true,
+			NameServerGroups: []*nbdns.NameServerGroup{{
+				Domains:     []string{d},
+				NameServers: []nbdns.NameServer{{IP: netip.MustParseAddr("192.0.2.1"), NSType: nbdns.UDPNameServerType, Port: 53}},
+			}},
+		}
+	}
+
+	require.NoError(t, server.UpdateDNSServer(1, matchGroup("a.example.com")))
+	first, ok := server.fallbackHandler.(*upstreamResolver)
+	require.True(t, ok, "the first host config should register a fallback")
+
+	require.NoError(t, server.UpdateDNSServer(2, matchGroup("b.example.com")))
+	second, ok := server.fallbackHandler.(*upstreamResolver)
+	require.True(t, ok, "the second host config should register a fallback")
+	require.NotSame(t, first, second)
+
+	assert.ErrorIs(t, first.ctx.Err(), context.Canceled, "the replaced fallback should be stopped")
+	assert.NoError(t, second.ctx.Err(), "the registered fallback should keep running")
+}
 
 func TestDefaultServer_UpdateMux(t *testing.T) {
 	baseMatchHandlers := []handlerWrapper{
@@ -1053,6 +1155,53 @@ func TestDefaultServer_UpdateMux_PreservesLocalResolver(t *testing.T) {
 	assert.NotEmpty(t, response.Answer, "answer should contain the surviving record")
 }
 
+// stopCountHandler counts how often it was stopped.
+type stopCountHandler struct {
+	mockHandler
+	stops int
+}
+
+func (h *stopCountHandler) Stop() { h.stops++ }
+
+// TestDefaultServer_UpdateMux_KeepsUnchangedHandlers verifies that updateMux
+// keeps the registered upstream handler when an update rebuilds it from the
+// same configuration, so it keeps its connections and cache, and swaps in
+// the rebuilt one when the configuration changed.
+func TestDefaultServer_UpdateMux_KeepsUnchangedHandlers(t *testing.T) {
+	server := &DefaultServer{
+		handlerChain: NewHandlerChain(),
+		service:      &mockService{},
+	}
+	registered := func() dns.Handler {
+		for _, h := range server.handlerChain.handlers {
+			if h.OrigPattern == "example.com." && h.Priority == PriorityUpstream {
+				return h.Handler
+			}
+		}
+		return nil
+	}
+
+	first := &stopCountHandler{mockHandler: mockHandler{Id: "first"}}
+	server.updateMux([]handlerWrapper{{domain: "example.com", handler: first, priority: PriorityUpstream, fingerprint: "a"}})
+
+	rebuilt := &stopCountHandler{mockHandler: mockHandler{Id: "rebuilt"}}
+	server.updateMux([]handlerWrapper{{domain: "example.com", handler: rebuilt, priority: PriorityUpstream, fingerprint: "a"}})
+	assert.Same(t, first, registered(), "the unchanged handler stays registered")
+	assert.Same(t, first, server.dnsMuxHandlers[0].handler)
+	assert.Zero(t, first.stops)
+	assert.Equal(t, 1, rebuilt.stops, "the rebuilt duplicate is released")
+
+	changed := &stopCountHandler{mockHandler: mockHandler{Id: "changed"}}
+	server.updateMux([]handlerWrapper{{domain: "example.com", handler: changed, priority: PriorityUpstream, fingerprint: "b"}})
+	assert.Same(t, changed, registered(), "the changed handler is swapped in")
+	assert.Equal(t, 1, first.stops, "the replaced handler is stopped")
+	assert.Zero(t, changed.stops)
+
+	server.updateMux(nil)
+	assert.Nil(t, registered())
+	assert.Equal(t, 1, changed.stops)
+}
+
 func TestExtraDomains(t *testing.T) {
 	tests := []struct {
 		name                string
@@ -1175,17 +1324,15 @@ func TestExtraDomains(t *testing.T) {
 				"config.example.com.",
 				"extra.example.com.",
 				"other.example.com.",
-				"duplicate.example.com.",
 			},
 			expectedMatchOnly: []string{
 				"extra.example.com.",
 				"other.example.com.",
-				"duplicate.example.com.",
 			},
-			// Expect 3 calls instead of 4 because when deregistering duplicate.example.com,
-			// the domain remains in the config (ref count goes from 2 to 1), so the host
-			// config hash doesn't change and applyDNSConfig is not called.
-			applyHostConfigCall: 3,
+			// The second registration of duplicate.example.com at the same priority
+			// replaces the first instead of adding a reference, so a single
+			// deregister releases the domain and changes the host config.
+			applyHostConfigCall: 4,
 		},
 		{
 			name: "Config update with new domains after registration",
@@ -1313,7 +1460,7 @@ func TestExtraDomains(t *testing.T) {
 
 			// Apply initial configuration
 			if tt.initialConfig.ServiceEnable {
-				err := server.applyConfiguration(tt.initialConfig)
+				err := server.applyConfiguration(0, tt.initialConfig)
 				assert.NoError(t, err)
 			}
 
@@ -1329,7 +1476,7 @@ func TestExtraDomains(t *testing.T) {
 
 			// Apply final configuration if specified
 			if tt.finalConfig.ServiceEnable {
-				err := server.applyConfiguration(tt.finalConfig)
+				err := server.applyConfiguration(0, tt.finalConfig)
 				assert.NoError(t, err)
 			}
 
@@ -1401,7 +1548,7 @@ func TestExtraDomainsRefCounting(t *testing.T) {
 	server.RegisterHandler(domain.List{"shared.example.com."}, &MockHandler{}, PriorityUpstream)
 
 	// Verify refcount is 2
-	zoneKey := toZone("shared.example.com")
+	zoneKey := server.toZone("shared.example.com")
 	assert.Equal(t, 2, server.extraDomains[zoneKey], "Refcount should be 2 after registering same domain twice")
 
 	// Deregister one handler
@@ -1411,13 +1558,156 @@ func TestExtraDomainsRefCounting(t *testing.T) {
 	assert.Equal(t, 1, server.extraDomains[zoneKey], "Refcount should be 1 after deregistering one handler")
 
 	// Deregister the other handler
-	server.DeregisterHandler(domain.List{"shared.example.com"}, PriorityDNSRoute)
+	server.DeregisterHandler(domain.List{"*.shared.example.com"}, PriorityDNSRoute)
 
 	// Verify domain is removed
 	_, exists := server.extraDomains[zoneKey]
 	assert.False(t, exists, "Domain should be removed after deregistering all handlers")
 }
 
+type stoppableHandler struct {
+	MockHandler
+	stopped int
+}
+
+func (h *stoppableHandler) Stop() {
+	h.stopped++
+}
+
+func TestRegisterHandler_ReplaceStopsPreviousHandler(t *testing.T) {
+	server := newTestServer(&noopHostConfigurator{})
+	zoneKey := server.toZone("replace.example.com")
+
+	first := &stoppableHandler{}
+	second := &stoppableHandler{}
+	server.RegisterHandler(domain.List{"replace.example.com"}, first, PriorityDNSRoute)
+	server.RegisterHandler(domain.List{"replace.example.com"}, second, PriorityDNSRoute)
+
+	assert.Equal(t, 1, first.stopped, "replaced handler should be stopped")
+	assert.Equal(t, 0, second.stopped, "new handler must not be stopped")
+	assert.Equal(t, 1, server.extraDomains[zoneKey], "re-register must not add a reference")
+
+	// Re-registering the same handler is a no-op for both stop and refcount.
+	server.RegisterHandler(domain.List{"replace.example.com"}, second, PriorityDNSRoute)
+	assert.Equal(t, 0, second.stopped)
+	assert.Equal(t, 1, server.extraDomains[zoneKey])
+
+	server.DeregisterHandler(domain.List{"replace.example.com"}, PriorityDNSRoute)
+	_, exists := server.extraDomains[zoneKey]
+	assert.False(t, exists, "single deregister should release the domain")
+}
+
+func TestRegisterHandler_ReplaceKeepsHandlerServingOtherDomains(t *testing.T) {
+	server := newTestServer(&noopHostConfigurator{})
+
+	shared := &stoppableHandler{}
+	server.RegisterHandler(domain.List{"a.example.com", "b.example.com"}, shared, PriorityDNSRoute)
+	server.RegisterHandler(domain.List{"a.example.com"}, &stoppableHandler{}, PriorityDNSRoute)
+
+	assert.Equal(t, 0, shared.stopped, "handler still registered for b.example.com must not be stopped")
+
+	server.RegisterHandler(domain.List{"b.example.com"}, &stoppableHandler{}, PriorityDNSRoute)
+	assert.Equal(t, 1, shared.stopped, "handler should be stopped once fully replaced")
+}
+
+func TestRegisterHandler_IgnoresInternalRegistrations(t *testing.T) {
+	server := newTestServer(&noopHostConfigurator{})
+	zoneKey := server.toZone("owned.example.com")
+
+	// Simulates a handler owned by updateMux at the same priority.
+	internal := &stoppableHandler{}
+	server.registerHandler([]string{"owned.example.com"}, internal, PriorityUpstream)
+
+	server.RegisterHandler(domain.List{"owned.example.com"}, &stoppableHandler{}, PriorityUpstream)
+	assert.Equal(t, 0, internal.stopped, "handlers not registered through RegisterHandler must not be stopped")
+	assert.Equal(t, 1, server.extraDomains[zoneKey], "external registration should add a reference")
+
+	server.DeregisterHandler(domain.List{"owned.example.com"}, PriorityUpstream)
+	_, exists := server.extraDomains[zoneKey]
+	assert.False(t, exists, "refcount should return to zero")
+}
+
+func TestRegisterHandlerContext_DeregistersOnCancel(t *testing.T) {
+	server := newTestServer(&noopHostConfigurator{})
+	zoneKey := server.toZone("route.example.com")
+
+	server.RegisterHandler(domain.List{"route.example.com"}, &MockHandler{}, PriorityUpstream)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	server.RegisterHandlerContext(ctx, domain.List{"route.example.com", "*.route.example.com"}, &MockHandler{}, PriorityDNSRoute)
+	assert.Equal(t, 3, server.extraDomains[zoneKey])
+
+	cancel()
+	require.Eventually(t, func() bool {
+		server.mux.Lock()
+		defer server.mux.Unlock()
+		return server.extraDomains[zoneKey] == 1
+	}, time.Second, 10*time.Millisecond, "cancelling the context should release its domains")
+
+	server.mux.Lock()
+	defer server.mux.Unlock()
+	assert.NotContains(t, server.extraHandlers, server.extraHandlerKey("route.example.com", PriorityDNSRoute))
+	assert.NotContains(t, server.extraHandlers, server.extraHandlerKey("*.route.example.com", PriorityDNSRoute))
+	assert.Contains(t, server.extraHandlers, server.extraHandlerKey("route.example.com", PriorityUpstream))
+	require.Len(t, server.handlerChain.handlers, 1, "only the handler without a context should be left in the chain")
+	assert.Equal(t, PriorityUpstream, server.handlerChain.handlers[0].Priority)
+}
+
+func TestRegisterHandlerContext_KeepsReregisteredDomains(t *testing.T) {
+	server := newTestServer(&noopHostConfigurator{})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	server.RegisterHandlerContext(ctx, domain.List{"a.example.com", "b.example.com"}, &MockHandler{}, PriorityDNSRoute)
+	replacement := &MockHandler{}
+	server.RegisterHandler(domain.List{"b.example.com"}, replacement, PriorityDNSRoute)
+
+	cancel()
+	require.Eventually(t, func() bool {
+		server.mux.Lock()
+		defer server.mux.Unlock()
+		_, exists := server.extraDomains[server.toZone("a.example.com")]
+		return !exists
+	}, time.Second, 10*time.Millisecond)
+
+	server.mux.Lock()
+	defer server.mux.Unlock()
+	assert.Equal(t, 1, server.extraDomains[server.toZone("b.example.com")], "the registration replacing b.example.com should be kept")
+	assert.Same(t, replacement, server.extraHandlers[server.extraHandlerKey("b.example.com", PriorityDNSRoute)].handler)
+}
+
+func TestRegisterHandlerContext_ConcurrentDeregister(t *testing.T) {
+	server := newTestServer(&noopHostConfigurator{})
+	zoneKey := server.toZone("race.example.com")
+	server.RegisterHandler(domain.List{"race.example.com"}, &MockHandler{}, PriorityUpstream)
+	var callbacks sync.WaitGroup
+	server.handlerContextDone = callbacks.Done
+
+	for i := 0; i < 50; i++ {
+		ctx, cancel := context.WithCancel(context.Background())
+		callbacks.Add(1)
+		server.RegisterHandlerContext(ctx, domain.List{"race.example.com"}, &MockHandler{}, PriorityDNSRoute)
+
+		var wg sync.WaitGroup
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			cancel()
+		}()
+		go func() {
+			defer wg.Done()
+			server.DeregisterHandler(domain.List{"race.example.com"}, PriorityDNSRoute)
+		}()
+		wg.Wait()
+	}
+
+	// context callbacks run asynchronously, wait for the late ones
+	callbacks.Wait()
+
+	server.mux.Lock()
+	defer server.mux.Unlock()
+	assert.Equal(t, 1, server.extraDomains[zoneKey], "the registration without a context should keep its reference")
+}
+
 func TestUpdateConfigWithExistingExtraDomains(t *testing.T) {
 	var capturedConfig HostDNSConfig
 	mockHostConfig := &mockHostConfigurator{
@@ -1456,7 +1746,7 @@ func TestUpdateConfigWithExistingExtraDomains(t *testing.T) {
 			{Domain: "config.example.com"},
 		},
 	}
-	err := server.applyConfiguration(initialConfig)
+	err := server.applyConfiguration(0, initialConfig)
 	assert.NoError(t, err)
 
 	var domains []string
@@ -1474,7 +1764,7 @@ func TestUpdateConfigWithExistingExtraDomains(t *testing.T) {
 			{Domain: "extra.example.com"},
 		},
 	}
-	err = server.applyConfiguration(updatedConfig)
+	err = server.applyConfiguration(0, updatedConfig)
 	assert.NoError(t, err)
 
 	// Verify both domains are in config, but no duplicates
@@ -1542,7 +1832,7 @@ func TestDomainCaseHandling(t *testing.T) {
 			{Domain: "config.example.com"},
 		},
 	}
-	err := server.applyConfiguration(config)
+	err := server.applyConfiguration(0, config)
 	assert.NoError(t, err)
 
 	var domains []string
@@ -1707,6 +1997,49 @@ func TestBuildUpstreamHandler_MergesGroupsPerDomain(t *testing.T) {
 	}, handler.upstreamServers[1])
 }
 
+// TestBuildUpstreamHandler_DeterministicOrder verifies that handlers are
+// returned in domain order, independent of the nameserver group order.
+func TestBuildUpstreamHandler_DeterministicOrder(t *testing.T) {
+	groups := manyNSGroups(20)
+	reversed := slices.Clone(groups)
+	slices.Reverse(reversed)
+
+	var expected []string
+	for _, input := range [][]*nbdns.NameServerGroup{groups, reversed} {
+		server := newTestServer(&noopHostConfigurator{})
+
+		muxUpdates, err := server.buildUpstreamHandlerUpdate(input)
+		require.NoError(t, err)
+		require.Len(t, muxUpdates, len(groups))
+
+		var domains []string
+		for _, update := range muxUpdates {
+			domains = append(domains, update.domain)
+			update.handler.Stop()
+		}
+		assert.True(t, slices.IsSorted(domains), "handlers should be ordered by domain")
+		if expected == nil {
+			expected = domains
+			continue
+		}
+		assert.Equal(t, expected, domains, "order should not depend on the group order")
+	}
+}
+
+// manyNSGroups returns n nameserver groups, each for its own domain.
+func manyNSGroups(n int) []*nbdns.NameServerGroup {
+	groups := make([]*nbdns.NameServerGroup, 0, n)
+	for i := 0; i < n; i++ {
+		groups = append(groups, &nbdns.NameServerGroup{
+			NameServers: []nbdns.NameServer{
+				{IP: netip.AddrFrom4([4]byte{192, 0, 2, byte(i + 1)}), NSType: nbdns.UDPNameServerType, Port: 53},
+			},
+			Domains: []string{fmt.Sprintf("d%d.example.com", n-i)},
+		})
+	}
+	return groups
+}
+
 // TestEvaluateNSGroupHealth covers the records-only verdict. The gate
 // (overlay route selected-but-no-active-peer) is intentionally NOT an
 // input to the evaluator anymore: the verdict drives the Enabled flag,
@@ -1819,7 +2152,7 @@ func TestEvaluateNSGroupHealth(t *testing.T) {
 
 	for _, tc := range tests {
 		t.Run(tc.name, func(t *testing.T) {
-			verdict, err := evaluateNSGroupHealth(tc.health, tc.servers, now)
+			verdict, err := evaluateNSGroupHealth(tc.health, tc.servers, 0, now)
 			assert.Equal(t, tc.wantVerdict, verdict, "verdict mismatch")
 			if tc.wantErrSubst != "" {
 				require.Error(t, err)
@@ -2394,3 +2727,429 @@ func TestDNSLoopPrevention(t *testing.T) {
 		})
 	}
 }
+
+func TestDefaultServer_FreezeAppliesLatestUpdateOnUnfreeze(t *testing.T) {
+	server := newTestServer(nil)
+	var applied []HostDNSConfig
+	server.hostManager.(*mockHostConfigurator).applyDNSConfigFunc = func(config HostDNSConfig, _ *statemanager.Manager) error {
+		applied = append(applied, config)
+		return nil
+	}
+
+	configFor := func(zone string) nbdns.Config {
+		return nbdns.Config{
+			ServiceEnable: true,
+			CustomZones: []nbdns.CustomZone{{
+				Domain: zone,
+				Records: []nbdns.SimpleRecord{
+					{Name: "peer." + zone, Type: int(dns.TypeA), Class: nbdns.DefaultClass, TTL: 300, RData: "100.64.0.1"},
+				},
+			}},
+		}
+	}
+
+	server.Freeze()
+	assert.True(t, server.statusRecorder.GetDNSFrozen(), "frozen state should be visible in status")
+
+	require.NoError(t, server.UpdateDNSServer(1, configFor("first.cloud.")))
+	require.NoError(t, server.UpdateDNSServer(2, configFor("second.cloud.")))
+	require.NoError(t, server.UpdateDNSServer(3, configFor("final.cloud.")))
+	assert.Empty(t, applied, "no update should be applied while frozen")
+	assert.Equal(t, uint64(0), server.updateSerial)
+
+	assert.Error(t, server.UpdateDNSServer(2, configFor("stale.cloud.")), "older update must not replace the pending one")
+
+	snapshot, err := json.Marshal(configSnapshot{Version: snapshotVersion, Config: configFor("imported.cloud.")})
+	require.NoError(t, err)
+	assert.Error(t, server.ImportConfig(snapshot), "imports must not bypass the freeze")
+	assert.Empty(t, applied)
+
+	require.NoError(t, server.Unfreeze())
+	assert.False(t, server.statusRecorder.GetDNSFrozen())
+	assert.Equal(t, configFor("final.cloud."), server.appliedConfig, "only the final config should be applied")
+	assert.Equal(t, uint64(3), server.updateSerial)
+	require.Len(t, applied, 1)
+	require.Len(t, applied[0].Domains, 1)
+	assert.Equal(t, "final.cloud.", applied[0].Domains[0].Domain)
+
+	require.NoError(t, server.Unfreeze(), "unfreezing twice should be a no-op")
+	assert.Len(t, applied, 1)
+}
+
+func TestDefaultServer_BypassDNS(t *testing.T) {
+	server := newTestServer(nil)
+	hostManager := server.hostManager.(*mockHostConfigurator)
+	var applied []HostDNSConfig
+	restored := 0
+	hostManager.applyDNSConfigFunc = func(config HostDNSConfig, _ *statemanager.Manager) error {
+		applied = append(applied, config)
+		return nil
+	}
+	hostManager.restoreHostDNSFunc = func() error {
+		restored++
+		return nil
+	}
+
+	configFor := func(zone string) nbdns.Config {
+		return nbdns.Config{
+			ServiceEnable: true,
+			CustomZones: []nbdns.CustomZone{{
+				Domain: zone,
+				Records: []nbdns.SimpleRecord{
+					{Name: "peer." + zone, Type: int(dns.TypeA), Class: nbdns.DefaultClass, TTL: 300, RData: "100.64.0.1"},
+				},
+			}},
+		}
+	}
+
+	require.NoError(t, server.UpdateDNSServer(1, configFor("first.cloud.")))
+	require.Len(t, applied, 1)
+
+	require.NoError(t, server.BypassDNS(true))
+	assert.Equal(t, 1, restored, "the original nameservers should be restored")
+	assert.True(t, server.statusRecorder.GetDNSBypassed(), "bypassed state should be visible in status")
+	require.NoError(t, server.BypassDNS(true), "bypassing twice should be a no-op")
+	assert.Equal(t, 1, restored)
+
+	require.NoError(t, server.UpdateDNSServer(2, configFor("second.cloud.")))
+	assert.Len(t, applied, 1, "the host config must not be applied while bypassed")
+	assert.True(t, chainHasPattern(server, "second.cloud.", PriorityLocal), "handlers keep following management")
+
+	require.NoError(t, server.BypassDNS(false))
+	assert.False(t, server.statusRecorder.GetDNSBypassed())
+	require.Len(t, applied, 2, "re-engaging should reapply the host config")
+	require.Len(t, applied[1].Domains, 1)
+	assert.Equal(t, "second.cloud.", applied[1].Domains[0].Domain)
+
+	require.NoError(t, server.BypassDNS(false), "re-engaging twice should be a no-op")
+	assert.Len(t, applied, 2)
+
+	require.NoError(t, server.BypassDNS(true))
+	server.ctx, server.ctxCancel = context.WithCancel(context.Background())
+	server.Stop()
+	assert.Equal(t, 2, restored, "stopping a bypassed server must not restore the host again")
+	assert.False(t, server.statusRecorder.GetDNSBypassed(), "the next server starts without the bypass")
+}
+
+func TestDefaultServer_EffectiveSearchDomains(t *testing.T) {
+	server := newTestServer(nil)
+	hostManager := server.hostManager.(*mockHostConfigurator)
+	var applied []HostDNSConfig
+	hostManager.applyDNSConfigFunc = func(config HostDNSConfig, _ *statemanager.Manager) error {
+		applied = append(applied, config)
+		return nil
+	}
+	hostManager.restoreHostDNSFunc = func() error { return nil }
+
+	assert.Empty(t, server.EffectiveSearchDomains(), "nothing is applied before the first config")
+
+	server.RegisterHandler(domain.List{"route.example.com"}, &mockHandler{Id: "route"}, PriorityDNSRoute)
+	require.NoError(t, server.UpdateDNSServer(1, nbdns.Config{
+		ServiceEnable: true,
+		CustomZones: []nbdns.CustomZone{
+			{
+				Domain:  "netbird.cloud.",
+				Records: []nbdns.SimpleRecord{{Name: "peer.netbird.cloud.", Type: int(dns.TypeA), Class: nbdns.DefaultClass, TTL: 300, RData: "100.64.0.1"}},
+			},
+			{
+				Domain:               "internal.example.",
+				SearchDomainDisabled: true,
+				Records:              []nbdns.SimpleRecord{{Name: "db.internal.example.", Type: int(dns.TypeA), Class: nbdns.DefaultClass, TTL: 300, RData: "100.64.0.2"}},
+			},
+		},
+	}))
+	require.NotEmpty(t, applied)
+
+	effective := server.EffectiveSearchDomains()
+	assert.Equal(t, enabledDomains(applied[len(applied)-1].Domains), effective, "must match what the host manager applied")
+	assert.ElementsMatch(t, []DomainConfig{
+		{Domain: "netbird.cloud."},
+		{Domain: "internal.example.", MatchOnly: true},
+		{Domain: "route.example.com.", MatchOnly: true},
+	}, effective)
+	assert.Equal(t, []string{"netbird.cloud."}, server.SearchDomains(), "the search line leaves out match-only domains")
+
+	server.DeregisterHandler(domain.List{"route.example.com"}, PriorityDNSRoute)
+	assert.NotContains(t, server.EffectiveSearchDomains(), DomainConfig{Domain: "route.example.com.", MatchOnly: true})
+
+	require.NoError(t, server.BypassDNS(true))
+	assert.Empty(t, server.EffectiveSearchDomains(), "the host doesn't use NetBird DNS while bypassed")
+	require.NoError(t, server.BypassDNS(false))
+	assert.Equal(t, enabledDomains(applied[len(applied)-1].Domains), server.EffectiveSearchDomains())
+}
+
+func TestDefaultServer_BypassDNSRestoreFailure(t *testing.T) {
+	server := newTestServer(nil)
+	server.hostManager.(*mockHostConfigurator).restoreHostDNSFunc = func() error {
+		return errors.New("restore failed")
+	}
+
+	assert.Error(t, server.BypassDNS(true))
+	assert.False(t, server.bypassed, "a failed restore must not report the bypass as active")
+	assert.False(t, server.statusRecorder.GetDNSBypassed())
+}
+
+func TestDefaultServer_RestoreHostDNSPartialFailure(t *testing.T) {
+	// newHost returns a host manager reverting three settings, of which
+	// search domains fail to revert on the first given number of attempts.
+	newHost := func(failures int) (*mockHostConfigurator, map[string]int) {
+		restored := make(map[string]int)
+		step := func(name string, fail func() bool) restoreStep {
+			return restoreStep{name: name, restore: func() error {
+				if fail() {
+					return errors.New("permission denied")
+				}
+				restored[name]++
+				return nil
+			}}
+		}
+		never := func() bool { return false }
+		host := newNoopHostMocker().(*mockHostConfigurator)
+		host.restoreHostDNSFunc = func() error {
+			return restoreSteps(
+				step("nameservers", never),
+				step("search domains", func() bool {
+					failures--
+					return failures >= 0
+				}),
+				step("resolved link", never),
+			)
+		}
+		return host, restored
+	}
+
+	t.Run("settings after a failure are restored", func(t *testing.T) {
+		host, restored := newHost(hostRestoreAttempts)
+		server := newTestServer(host)
+
+		err := server.restoreHostDNS()
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "restore search domains: permission denied")
+		assert.NotContains(t, err.Error(), "nameservers")
+		assert.NotContains(t, err.Error(), "resolved link")
+		assert.Equal(t, map[string]int{"nameservers": hostRestoreAttempts, "resolved link": hostRestoreAttempts}, restored,
+			"every attempt should revert the remaining settings")
+	})
+
+	t.Run("retry restores the failed setting", func(t *testing.T) {
+		host, restored := newHost(1)
+		server := newTestServer(host)
+
+		require.NoError(t, server.disableDNS())
+		assert.Equal(t, 1, restored["search domains"])
+		assert.IsType(t, &noopHostConfigurator{}, server.hostManager)
+	})
+}
+
+func TestDefaultServer_PinnedMgmtCacheServesAfterPopulate(t *testing.T) {
+	server, err := NewDefaultServer(context.Background(), DefaultServerConfig{
+		WgInterface:     &mocWGIface{},
+		StatusRecorder:  peer.NewRecorder("mgm"),
+		MgmtCachePinned: true,
+	})
+	require.NoError(t, err)
+	t.Cleanup(server.ctxCancel)
+	require.True(t, server.mgmtCacheResolver.Pinned())
+
+	upstream := dns.HandlerFunc(func(w dns.ResponseWriter, r *dns.Msg) {
+		resp := &dns.Msg{}
+		resp.SetReply(r)
+		if r.Question[0].Qtype == dns.TypeA {
+			resp.Answer = []dns.RR{&dns.A{
+				Hdr: dns.RR_Header{Name: r.Question[0].Name, Rrtype: dns.TypeA, Class: dns.ClassINET, Ttl: 60},
+				A:   net.ParseIP("10.0.0.1").To4(),
+			}}
+		}
+		_ = w.WriteMsg(resp)
+	})
+	server.handlerChain.AddHandler(".", upstream, PriorityUpstream)
+
+	mgmtURL, err := url.Parse("https://api.example.com:443")
+	require.NoError(t, err)
+	require.NoError(t, server.PopulateManagementDomain(mgmtURL))
+
+	// Without the upstream only the pinned mgmt cache can answer, and no
+	// NetbirdConfig has been applied yet.
+	server.handlerChain.RemoveHandler(".", PriorityUpstream)
+
+	r := new(dns.Msg)
+	r.SetQuestion("api.example.com.", dns.TypeA)
+	w := &test.MockResponseWriter{}
+	server.handlerChain.ServeDNS(w, r)
+
+	resp := w.GetLastResponse()
+	require.NotNil(t, resp)
+	require.Len(t, resp.Answer, 1)
+	assert.Equal(t, "10.0.0.1", resp.Answer[0].(*dns.A).A.String())
+}
+
+func TestDefaultServer_UpdateDNSServerHashFailure(t *testing.T) {
+	server := newTestServer(nil)
+
+	config := func(ip string) nbdns.Config {
+		return nbdns.Config{
+			ServiceEnable: true,
+			CustomZones: []nbdns.CustomZone{{
+				Domain: "netbird.cloud.",
+				Records: []nbdns.SimpleRecord{
+					{Name: "peer.netbird.cloud.", Type: int(dns.TypeA), Class: nbdns.DefaultClass, TTL: 300, RData: ip},
+				},
+			}},
+		}
+	}
+	appliedIP := func() string {
+		var ips []string
+		for _, record := range server.localResolver.Records(local.SourceManagement) {
+			if record.Type == int(dns.TypeA) {
+				ips = append(ips, record.RData)
+			}
+		}
+		if len(ips) != 1 {
+			return ""
+		}
+		return ips[0]
+	}
+
+	server.hashUpdateFunc = func(nbdns.Config) (uint64, error) {
+		return 0, errors.New("hash failure")
+	}
+
+	// Without a hash every update is applied and no hash is stored.
+	require.NoError(t, server.UpdateDNSServer(1, config("100.64.0.1")))
+	assert.Equal(t, "100.64.0.1", appliedIP())
+	assert.Equal(t, ^uint64(0), server.previousConfigHash)
+
+	require.NoError(t, server.UpdateDNSServer(2, config("100.64.0.2")))
+	assert.Equal(t, "100.64.0.2", appliedIP())
+	assert.Equal(t, uint64(2), server.updateSerial)
+
+	// Once hashing recovers, the next update is applied even if it is
+	// identical, and its hash is stored.
+	server.hashUpdateFunc = nil
+	server.localResolver.Update(nil)
+	require.NoError(t, server.UpdateDNSServer(3, config("100.64.0.2")))
+	assert.Equal(t, "100.64.0.2", appliedIP())
+	want, err := hashConfig(config("100.64.0.2"))
+	require.NoError(t, err)
+	assert.Equal(t, want, server.previousConfigHash)
+
+	// Identical updates are skipped again.
+	server.localResolver.Update(nil)
+	require.NoError(t, server.UpdateDNSServer(4, config("100.64.0.2")))
+	assert.Empty(t, appliedIP(), "identical update must not be reapplied")
+	assert.Equal(t, uint64(4), server.updateSerial)
+}
+
+func TestDefaultServer_SetCustomZones(t *testing.T) {
+	server := newTestServer(nil)
+
+	zone := func(domain, name, ip string) nbdns.CustomZone {
+		return nbdns.CustomZone{
+			Domain: domain,
+			Records: []nbdns.SimpleRecord{
+				{Name: name, Type: int(dns.TypeA), Class: nbdns.DefaultClass, TTL: 300, RData: ip},
+			},
+		}
+	}
+	require.NoError(t, server.UpdateDNSServer(1, nbdns.Config{
+		ServiceEnable: true,
+		CustomZones:   []nbdns.CustomZone{zone("netbird.cloud.", "peer.netbird.cloud.", "100.64.0.1")},
+		NameServerGroups: []*nbdns.NameServerGroup{{
+			NameServers: []nbdns.NameServer{{IP: netip.MustParseAddr("192.0.2.1"), NSType: nbdns.UDPNameServerType, Port: 53}},
+			Domains:     []string{"corp.example.com"},
+			Enabled:     true,
+		}},
+	}))
+
+	var upstream handlerWithStop
+	for _, h := range server.dnsMuxHandlers {
+		if h.priority == PriorityUpstream {
+			upstream = h.handler
+		}
+	}
+	require.NotNil(t, upstream)
+
+	var changes []MuxChange
+	server.SubscribeMuxChanges(func(c MuxChange) {
+		changes = append(changes, c)
+	})
+
+	require.NoError(t, server.SetCustomZones([]nbdns.CustomZone{
+		zone("netbird.cloud.", "peer.netbird.cloud.", "100.64.0.2"),
+		zone("lab.internal.", "host.lab.internal.", "100.64.0.3"),
+	}))
+
+	require.Len(t, changes, 1)
+	assert.Equal(t, []MuxHandler{{Domain: "lab.internal.", Priority: PriorityLocal}}, changes[0].Added, "only the new zone is registered")
+	assert.Empty(t, changes[0].Removed)
+
+	var upstreams []handlerWithStop
+	for _, h := range server.dnsMuxHandlers {
+		if h.priority == PriorityUpstream {
+			upstreams = append(upstreams, h.handler)
+		}
+	}
+	assert.Equal(t, []handlerWithStop{upstream}, upstreams, "upstream handlers must be untouched")
+
+	query := func(name string) *dns.Msg {
+		w := &test.MockResponseWriter{}
+		server.handlerChain.ServeDNS(w, new(dns.Msg).SetQuestion(name, dns.TypeA))
+		resp := w.GetLastResponse()
+		require.NotNil(t, resp)
+		return resp
+	}
+	resp := query("peer.netbird.cloud.")
+	require.Len(t, resp.Answer, 1)
+	assert.Equal(t, "100.64.0.2", resp.Answer[0].(*dns.A).A.String(), "records of kept zones are replaced")
+	resp = query("host.lab.internal.")
+	require.Len(t, resp.Answer, 1)
+
+	require.NoError(t, server.SetCustomZones(nil))
+	require.Len(t, changes, 2)
+	assert.ElementsMatch(t, []MuxHandler{
+		{Domain: "netbird.cloud.", Priority: PriorityLocal},
+		{Domain: "lab.internal.", Priority: PriorityLocal},
+	}, changes[1].Removed)
+	assert.Len(t, server.dnsMuxHandlers, 1, "only the upstream handler remains")
+	assert.Equal(t, dns.RcodeRefused, query("host.lab.internal.").Rcode)
+}
+
+func TestDefaultServer_UpdateSerialReset(t *testing.T) {
+	server := newTestServer(nil)
+	config := func(ip string) nbdns.Config {
+		return nbdns.Config{
+			ServiceEnable: true,
+			CustomZones: []nbdns.CustomZone{{
+				Domain: "netbird.cloud.",
+				Records: []nbdns.SimpleRecord{
+					{Name: "peer.netbird.cloud.", Type: int(dns.TypeA), Class: nbdns.DefaultClass, TTL: 300, RData: ip},
+				},
+			}},
+		}
+	}
+
+	require.NoError(t, server.UpdateDNSServer(5000, config("100.64.0.1")))
+
+	// An out-of-order update a few serials back is stale.
+	err := server.UpdateDNSServer(4990, config("100.64.0.2"))
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "10 behind")
+	assert.Equal(t, uint64(5000), server.updateSerial)
+	assert.Equal(t, config("100.64.0.1"), server.appliedConfig)
+
+	// A serial far behind means management reset its serials.
+	require.NoError(t, server.UpdateDNSServer(30, config("100.64.0.3")))
+	assert.Equal(t, uint64(30), server.updateSerial)
+	assert.Equal(t, config("100.64.0.3"), server.appliedConfig)
+
+	// Updates following the reset are applied, older ones are stale again.
+	require.NoError(t, server.UpdateDNSServer(31, config("100.64.0.4")))
+	assert.Equal(t, config("100.64.0.4"), server.appliedConfig)
+	assert.ErrorIs(t, server.UpdateDNSServer(29, config("100.64.0.2")), ErrStaleSerial)
+	assert.Equal(t, uint64(31), server.updateSerial)
+
+	// Small accounts reset too, their serials never got large.
+	require.NoError(t, server.UpdateDNSServer(2, config("100.64.0.5")))
+	assert.Equal(t, uint64(2), server.updateSerial)
+	assert.Equal(t, config("100.64.0.5"), server.appliedConfig)
+}
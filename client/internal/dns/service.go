@@ -1,7 +1,11 @@
 package dns
 
 import (
+	"errors"
+	"fmt"
 	"net/netip"
+	"os"
+	"syscall"
 
 	"github.com/miekg/dns"
 
@@ -27,4 +31,60 @@ type service interface {
 	DeregisterMux(key string)
 	RuntimePort() int
 	RuntimeIP() netip.Addr
+	// DefaultPortError returns why the service couldn't bind DefaultPort
+	// when it listens on another port, nil otherwise.
+	DefaultPortError() error
+}
+
+// wsaeaddrinuse is the Windows error for an address already in use, which
+// syscall.EADDRINUSE doesn't match there.
+const wsaeaddrinuse = syscall.Errno(10048)
+
+// ListenFailure classifies why the DNS service couldn't bind an address.
+type ListenFailure int
+
+const (
+	ListenFailureOther ListenFailure = iota
+	// ListenFailurePortInUse means another process holds the address.
+	ListenFailurePortInUse
+	// ListenFailurePermission means the process isn't allowed to bind the
+	// port, typically a privileged port without CAP_NET_BIND_SERVICE.
+	ListenFailurePermission
+)
+
+func (f ListenFailure) String() string {
+	switch f {
+	case ListenFailurePortInUse:
+		return "port in use"
+	case ListenFailurePermission:
+		return "permission denied"
+	default:
+		return "other"
+	}
+}
+
+// ListenError is the error of the DNS service failing to bind an address.
+type ListenError struct {
+	Addr    netip.AddrPort
+	Failure ListenFailure
+	Err     error
+}
+
+func newListenError(addr netip.AddrPort, err error) *ListenError {
+	failure := ListenFailureOther
+	switch {
+	case errors.Is(err, syscall.EADDRINUSE), errors.Is(err, wsaeaddrinuse):
+		failure = ListenFailurePortInUse
+	case errors.Is(err, os.ErrPermission):
+		failure = ListenFailurePermission
+	}
+	return &ListenError{Addr: addr, Failure: failure, Err: err}
+}
+
+func (e *ListenError) Error() string {
+	return fmt.Sprintf("bind DNS on %s: %s: %v", e.Addr, e.Failure, e.Err)
+}
+
+func (e *ListenError) Unwrap() error {
+	return e.Err
 }
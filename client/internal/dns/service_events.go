@@ -0,0 +1,115 @@
+package dns
+
+import (
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// ServiceEventType identifies a state transition of the DNS server.
+type ServiceEventType string
+
+const (
+	// EventListenStarted: the DNS service started listening for queries.
+	EventListenStarted ServiceEventType = "listen_started"
+	// EventListenStopped: the DNS service stopped listening for queries.
+	EventListenStopped ServiceEventType = "listen_stopped"
+	// EventHostManagerActivated: a host manager took over the host DNS
+	// settings.
+	EventHostManagerActivated ServiceEventType = "host_manager_activated"
+	// EventHostManagerDeactivated: the host manager was released and the
+	// host DNS settings restored.
+	EventHostManagerDeactivated ServiceEventType = "host_manager_deactivated"
+	// EventConfigApplied: a DNS config was applied, Serial is the serial of
+	// its network map.
+	EventConfigApplied ServiceEventType = "config_applied"
+	// EventGroupDeactivated: the health projection deactivated a nameserver
+	// group.
+	EventGroupDeactivated ServiceEventType = "group_deactivated"
+	// EventGroupReactivated: a deactivated nameserver group became healthy
+	// again.
+	EventGroupReactivated ServiceEventType = "group_reactivated"
+	// EventBypassEngaged: BypassDNS put the host back on its original
+	// nameservers.
+	EventBypassEngaged ServiceEventType = "bypass_engaged"
+	// EventBypassReleased: BypassDNS routed the host DNS through NetBird
+	// again.
+	EventBypassReleased ServiceEventType = "bypass_released"
+)
+
+// ServiceEvent describes a state transition of the DNS server, as passed to
+// a ServiceEventSink. Fields not relevant to the event type are zero.
+type ServiceEvent struct {
+	Type ServiceEventType
+	Time time.Time
+	// Serial is the network map serial of EventConfigApplied, zero for
+	// configs that didn't come with one.
+	Serial uint64
+	// HostManager names the host manager of the host manager events.
+	HostManager string
+	// Group is the ID of the nameserver group of the group events, and
+	// Domains its match domains, empty for primary groups.
+	Group   string
+	Domains []string
+}
+
+// ServiceEventSink receives the state transitions of the DNS server in the
+// order they happen. Implementations are called synchronously, some with
+// the server lock held, and must neither block nor call back into the server.
+type ServiceEventSink interface {
+	OnServiceEvent(event ServiceEvent)
+}
+
+// ServiceEventChan is a ServiceEventSink delivering the events on a buffered
+// channel. Events arriving while the buffer is full are dropped.
+type ServiceEventChan chan ServiceEvent
+
+// OnServiceEvent implements ServiceEventSink.
+func (c ServiceEventChan) OnServiceEvent(event ServiceEvent) {
+	select {
+	case c <- event:
+	default:
+		log.Debugf("dropping DNS service event %s, the event channel is full", event.Type)
+	}
+}
+
+// SetServiceEventSink installs sink to be notified of the server's state
+// transitions. Pass nil to disable.
+func (s *DefaultServer) SetServiceEventSink(sink ServiceEventSink) {
+	s.eventSinkMu.Lock()
+	defer s.eventSinkMu.Unlock()
+	s.eventSink = sink
+}
+
+// emitEvent stamps event and passes it to the sink, if one is installed.
+func (s *DefaultServer) emitEvent(event ServiceEvent) {
+	s.eventSinkMu.RLock()
+	sink := s.eventSink
+	s.eventSinkMu.RUnlock()
+	if sink == nil {
+		return
+	}
+
+	event.Time = time.Now()
+	sink.OnServiceEvent(event)
+}
+
+// setListening records whether the DNS service listens and emits the
+// transition. Must be called with s.mux held.
+func (s *DefaultServer) setListening(listening bool) {
+	if s.listening == listening {
+		return
+	}
+	s.listening = listening
+	if listening {
+		s.emitEvent(ServiceEvent{Type: EventListenStarted})
+	} else {
+		s.emitEvent(ServiceEvent{Type: EventListenStopped})
+	}
+}
+
+// emitHostManagerEvent emits eventType for the current host manager. Must be
+// called with s.mux held.
+func (s *DefaultServer) emitHostManagerEvent(eventType ServiceEventType) {
+	s.emitEvent(ServiceEvent{Type: eventType, HostManager: s.hostManager.string()})
+}
@@ -0,0 +1,126 @@
+package dns
+
+import (
+	"context"
+	"net/netip"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	nbdns "github.com/netbirdio/netbird/dns"
+)
+
+// drainEvents returns the events received on events so far.
+func drainEvents(events ServiceEventChan) []ServiceEvent {
+	var received []ServiceEvent
+	for {
+		select {
+		case event := <-events:
+			received = append(received, event)
+		default:
+			return received
+		}
+	}
+}
+
+func serviceEventTypes(events []ServiceEvent) []ServiceEventType {
+	types := make([]ServiceEventType, 0, len(events))
+	for _, event := range events {
+		types = append(types, event.Type)
+	}
+	return types
+}
+
+func TestDefaultServer_ServiceEventsLifecycle(t *testing.T) {
+	server := newTestServer(nil)
+	server.hostManager = &noopHostConfigurator{}
+	server.ctx, server.ctxCancel = context.WithCancel(context.Background())
+	server.SetHostManager(&recordingHostManager{})
+
+	events := make(ServiceEventChan, 32)
+	server.SetServiceEventSink(events)
+
+	start := time.Now()
+	require.NoError(t, server.UpdateDNSServer(1, nbdns.Config{ServiceEnable: true}))
+	enabled := drainEvents(events)
+	require.Equal(t, []ServiceEventType{EventListenStarted, EventHostManagerActivated, EventConfigApplied}, serviceEventTypes(enabled))
+	assert.Equal(t, "recording", enabled[1].HostManager)
+	assert.Equal(t, uint64(1), enabled[2].Serial)
+	for _, event := range enabled {
+		assert.False(t, event.Time.Before(start), "events are stamped")
+	}
+
+	require.NoError(t, server.UpdateDNSServer(2, nbdns.Config{
+		ServiceEnable: true,
+		StaticHosts:   map[string][]netip.Addr{"host.example.com": {netip.MustParseAddr("192.0.2.10")}},
+	}))
+	updated := drainEvents(events)
+	require.Equal(t, []ServiceEventType{EventConfigApplied}, serviceEventTypes(updated), "an active service doesn't start again")
+	assert.Equal(t, uint64(2), updated[0].Serial)
+
+	require.NoError(t, server.BypassDNS(true))
+	require.NoError(t, server.BypassDNS(true))
+	require.NoError(t, server.BypassDNS(false))
+	assert.Equal(t, []ServiceEventType{EventBypassEngaged, EventBypassReleased}, serviceEventTypes(drainEvents(events)))
+
+	require.NoError(t, server.UpdateDNSServer(3, nbdns.Config{ServiceEnable: false}))
+	disabled := drainEvents(events)
+	require.Equal(t, []ServiceEventType{EventHostManagerDeactivated, EventListenStopped, EventConfigApplied}, serviceEventTypes(disabled))
+	assert.Equal(t, "recording", disabled[0].HostManager)
+	assert.Equal(t, uint64(3), disabled[2].Serial)
+
+	server.Stop()
+	assert.Empty(t, drainEvents(events), "a disabled service has nothing left to stop")
+}
+
+func TestDefaultServer_ServiceEventsGroupTransitions(t *testing.T) {
+	fx := newProjTestFixture(t)
+	events := make(ServiceEventChan, 8)
+	fx.server.SetServiceEventSink(events)
+
+	fx.setHealth(UpstreamHealth{LastOk: time.Now()})
+	fx.tick()
+	assert.Empty(t, drainEvents(events), "groups start out active")
+
+	fx.setHealth(UpstreamHealth{LastFail: time.Now(), LastErr: "timeout"})
+	fx.tick()
+	fx.tick()
+	deactivated := drainEvents(events)
+	require.Equal(t, []ServiceEventType{EventGroupDeactivated}, serviceEventTypes(deactivated), "one event per transition")
+	assert.Equal(t, string(generateGroupKey(fx.group)), deactivated[0].Group)
+	assert.Equal(t, []string{"example.com"}, deactivated[0].Domains)
+
+	fx.setHealth(UpstreamHealth{LastOk: time.Now()})
+	fx.tick()
+	assert.Equal(t, []ServiceEventType{EventGroupReactivated}, serviceEventTypes(drainEvents(events)))
+}
+
+func TestDefaultServer_ServiceEventsWithoutSink(t *testing.T) {
+	server := newTestServer(nil)
+	server.ctx, server.ctxCancel = context.WithCancel(context.Background())
+	server.SetServiceEventSink(nil)
+
+	assert.NotPanics(t, func() {
+		require.NoError(t, server.BypassDNS(true))
+		server.Stop()
+	})
+}
+
+func TestServiceEventChan_DropsWhenFull(t *testing.T) {
+	events := make(ServiceEventChan, 1)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		events.OnServiceEvent(ServiceEvent{Type: EventBypassEngaged})
+		events.OnServiceEvent(ServiceEvent{Type: EventBypassReleased})
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("a full channel must not block the server")
+	}
+	assert.Equal(t, []ServiceEventType{EventBypassEngaged}, serviceEventTypes(drainEvents(events)))
+}
@@ -0,0 +1,102 @@
+package dns
+
+import (
+	"errors"
+	"fmt"
+	"net/netip"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/netbirdio/netbird/client/iface/netstack"
+	nbnet "github.com/netbirdio/netbird/client/net"
+)
+
+// serviceIPCandidates is the number of addresses from the end of the NetBird
+// network tried for the in-memory DNS service before giving up.
+const serviceIPCandidates = 16
+
+// SelectServiceIP picks the fake resolver address the in-memory DNS service
+// answers on. The preferred address is used if it is valid, inside network
+// and not taken. Otherwise the addresses from the second last of network
+// downwards are tried, skipping taken ones. taken may be nil.
+func SelectServiceIP(network netip.Prefix, preferred netip.Addr, taken func(netip.Addr) bool) (netip.Addr, error) {
+	if taken == nil {
+		taken = func(netip.Addr) bool { return false }
+	}
+	network = network.Masked()
+
+	if preferred.IsValid() {
+		preferred = preferred.Unmap()
+		switch {
+		case !network.Contains(preferred):
+			log.Warnf("DNS service address %s is outside of the network %s, selecting another one", preferred, network)
+		case taken(preferred):
+			log.Warnf("DNS service address %s is used by a peer, selecting another one", preferred)
+		default:
+			return preferred, nil
+		}
+	}
+
+	for fromEnd := 1; fromEnd <= serviceIPCandidates; fromEnd++ {
+		ip, err := nbnet.GetLastIPFromNetwork(network, fromEnd)
+		if err != nil {
+			return netip.Addr{}, fmt.Errorf("get last ip from network: %w", err)
+		}
+		if !network.Contains(ip) || ip == network.Addr() {
+			break
+		}
+		if !taken(ip) {
+			return ip, nil
+		}
+	}
+	return netip.Addr{}, errors.New("no free DNS service address in " + network.String())
+}
+
+// serviceIPTaken returns the taken func for SelectServiceIP: the address of
+// the interface itself and every address in peers.
+func serviceIPTaken(own netip.Addr, peers []netip.Addr) func(netip.Addr) bool {
+	set := make(map[netip.Addr]struct{}, len(peers)+1)
+	set[own.Unmap()] = struct{}{}
+	for _, addr := range peers {
+		set[addr.Unmap()] = struct{}{}
+	}
+	return func(addr netip.Addr) bool {
+		_, ok := set[addr]
+		return ok
+	}
+}
+
+// SetPeerAddresses moves the in-memory DNS service off its address if one of
+// the peers in addrs uses it, and points the host configuration at the new
+// one. It has no effect for the listener service and on mobile platforms,
+// where the address is handed to the OS once.
+func (s *DefaultServer) SetPeerAddresses(addrs []netip.Addr) {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+
+	svc, ok := s.service.(*ServiceViaMemory)
+	if !ok {
+		return
+	}
+	taken := serviceIPTaken(s.wgInterface.Address().IP, addrs)
+	current := svc.RuntimeIP()
+	if !taken(current) {
+		return
+	}
+	if s.permanent || netstack.IsEnabled() {
+		log.Warnf("DNS service address %s is used by a peer, but can't be moved on this platform", current)
+		return
+	}
+
+	moved, err := svc.relocate(taken)
+	if err != nil {
+		log.Errorf("failed to move DNS service off %s: %v", current, err)
+	}
+	if !moved || !s.currentConfig.ServerIP.IsValid() {
+		return
+	}
+	s.currentConfig.ServerIP = svc.RuntimeIP()
+	if s.hostManager != nil {
+		s.applyHostConfig()
+	}
+}
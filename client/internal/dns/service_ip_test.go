@@ -0,0 +1,163 @@
+package dns
+
+import (
+	"net/netip"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/netbirdio/netbird/client/internal/statemanager"
+)
+
+func TestSelectServiceIP(t *testing.T) {
+	network := netip.MustParsePrefix("100.66.100.0/24")
+	addrs := func(s ...string) func(netip.Addr) bool {
+		var peers []netip.Addr
+		for _, a := range s {
+			peers = append(peers, netip.MustParseAddr(a))
+		}
+		return serviceIPTaken(netip.MustParseAddr("100.66.100.1"), peers)
+	}
+
+	tests := []struct {
+		name      string
+		network   netip.Prefix
+		preferred netip.Addr
+		taken     func(netip.Addr) bool
+		want      string
+		wantErr   bool
+	}{
+		{
+			name:    "second last address by default",
+			network: network,
+			taken:   addrs(),
+			want:    "100.66.100.254",
+		},
+		{
+			name:    "nil taken",
+			network: network,
+			want:    "100.66.100.254",
+		},
+		{
+			name:    "skips peer addresses",
+			network: network,
+			taken:   addrs("100.66.100.254", "100.66.100.253"),
+			want:    "100.66.100.252",
+		},
+		{
+			name:      "preferred address",
+			network:   network,
+			preferred: netip.MustParseAddr("100.66.100.200"),
+			taken:     addrs("100.66.100.254"),
+			want:      "100.66.100.200",
+		},
+		{
+			name:      "mapped preferred address",
+			network:   network,
+			preferred: netip.MustParseAddr("::ffff:100.66.100.200"),
+			taken:     addrs(),
+			want:      "100.66.100.200",
+		},
+		{
+			name:      "preferred address used by a peer",
+			network:   network,
+			preferred: netip.MustParseAddr("100.66.100.200"),
+			taken:     addrs("100.66.100.200"),
+			want:      "100.66.100.254",
+		},
+		{
+			name:      "preferred address outside of the network",
+			network:   network,
+			preferred: netip.MustParseAddr("192.0.2.53"),
+			taken:     addrs(),
+			want:      "100.66.100.254",
+		},
+		{
+			name:    "unmasked network",
+			network: netip.MustParsePrefix("100.66.100.1/24"),
+			taken:   addrs(),
+			want:    "100.66.100.254",
+		},
+		{
+			name:    "own address in a small network",
+			network: netip.MustParsePrefix("100.66.100.0/30"),
+			taken:   addrs(),
+			want:    "100.66.100.2",
+		},
+		{
+			name:    "small network exhausted",
+			network: netip.MustParsePrefix("100.66.100.0/30"),
+			taken:   addrs("100.66.100.2"),
+			wantErr: true,
+		},
+		{
+			name:    "candidates exhausted",
+			network: network,
+			taken: func(addr netip.Addr) bool {
+				return addr.Compare(netip.MustParseAddr("100.66.100.200")) > 0
+			},
+			wantErr: true,
+		},
+		{
+			name:    "ipv6 network",
+			network: netip.MustParsePrefix("fd00:1234::/64"),
+			taken:   addrs("fd00:1234::ffff:ffff:ffff:fffe"),
+			want:    "fd00:1234::ffff:ffff:ffff:fffd",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ip, err := SelectServiceIP(tt.network, tt.preferred, tt.taken)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, ip.String())
+		})
+	}
+}
+
+func TestDefaultServer_SetPeerAddresses(t *testing.T) {
+	var applied []HostDNSConfig
+	manager := &mockHostConfigurator{
+		applyDNSConfigFunc: func(config HostDNSConfig, _ *statemanager.Manager) error {
+			applied = append(applied, config)
+			return nil
+		},
+	}
+
+	server := newTestServer(manager)
+	service := NewServiceViaMemoryWithIP(server.wgInterface, netip.MustParseAddr("100.66.100.10"))
+	server.service = service
+	require.Equal(t, netip.MustParseAddr("100.66.100.10"), server.DnsIP())
+	server.currentConfig = HostDNSConfig{RouteAll: true, ServerIP: service.RuntimeIP(), ServerPort: DefaultPort}
+
+	server.SetPeerAddresses([]netip.Addr{netip.MustParseAddr("100.66.100.2")})
+	assert.Equal(t, netip.MustParseAddr("100.66.100.10"), server.DnsIP(), "no collision keeps the address")
+	assert.Empty(t, applied)
+
+	server.SetPeerAddresses([]netip.Addr{netip.MustParseAddr("100.66.100.10"), netip.MustParseAddr("100.66.100.254")})
+	assert.Equal(t, netip.MustParseAddr("100.66.100.253"), server.DnsIP(), "a peer on the address moves the service")
+	require.Len(t, applied, 1)
+	assert.Equal(t, netip.MustParseAddr("100.66.100.253"), applied[0].ServerIP, "the host config follows the service")
+
+	server.SetPeerAddresses(nil)
+	assert.Equal(t, netip.MustParseAddr("100.66.100.253"), server.DnsIP(), "the service doesn't move back on its own")
+
+	server.SetPeerAddresses([]netip.Addr{netip.MustParseAddr("100.66.100.253")})
+	assert.Equal(t, netip.MustParseAddr("100.66.100.10"), server.DnsIP(), "the configured address is preferred when free")
+	require.Len(t, applied, 2)
+	assert.Equal(t, netip.MustParseAddr("100.66.100.10"), applied[1].ServerIP)
+}
+
+func TestDefaultServer_SetPeerAddressesPermanent(t *testing.T) {
+	server := newTestServer(nil)
+	server.service = NewServiceViaMemory(server.wgInterface)
+	server.permanent = true
+
+	server.SetPeerAddresses([]netip.Addr{netip.MustParseAddr("100.66.100.254")})
+	assert.Equal(t, netip.MustParseAddr("100.66.100.254"), server.DnsIP(), "mobile platforms keep the address")
+}
@@ -43,6 +43,9 @@ type serviceViaListener struct {
 	ebpfService       ebpfMgr.Manager
 	firewall          Firewall
 	tcpDNATConfigured bool
+	// defaultPortErr is why DefaultPort couldn't be bound when listening
+	// on another port.
+	defaultPortErr *ListenError
 }
 
 func newServiceViaListener(wgIface WGIface, customAddr *netip.AddrPort, fw Firewall) *serviceViaListener {
@@ -184,10 +187,36 @@ func (s *serviceViaListener) RuntimePort() int {
 	}
 }
 
+func (s *serviceViaListener) DefaultPortError() error {
+	s.listenerFlagLock.Lock()
+	defer s.listenerFlagLock.Unlock()
+
+	if s.ebpfService != nil || s.defaultPortErr == nil {
+		return nil
+	}
+	return s.defaultPortErr
+}
+
 func (s *serviceViaListener) RuntimeIP() netip.Addr {
 	return s.listenIP
 }
 
+// peerPort returns the port other peers reach the listener on at the
+// WireGuard address, 0 while it doesn't listen there.
+func (s *serviceViaListener) peerPort() uint16 {
+	s.listenerFlagLock.Lock()
+	defer s.listenerFlagLock.Unlock()
+
+	if !s.listenerIsRunning || s.wgInterface == nil || s.listenIP != s.wgInterface.Address().IP {
+		return 0
+	}
+	// eBPF redirects port 53 of the WireGuard address to the listener
+	if s.ebpfService != nil {
+		return DefaultPort
+	}
+	return s.listenPort
+}
+
 // evalListenAddress figures out the listen address for the DNS server.
 // IPv4-only: all peers have a v4 overlay address, and DNS config points to v4.
 // First checks port 53 on WG interface or lo, then tries eBPF on a random port,
@@ -197,10 +226,13 @@ func (s *serviceViaListener) evalListenAddress() (netip.Addr, uint16, error) {
 		return s.customAddr.Addr(), s.customAddr.Port(), nil
 	}
 
-	ip, ok := s.testFreePort(DefaultPort)
-	if ok {
+	s.defaultPortErr = nil
+	ip, bindErr := s.testFreePort(DefaultPort)
+	if bindErr == nil {
 		return ip, DefaultPort, nil
 	}
+	s.defaultPortErr = bindErr
+	log.Infof("DNS port %d is not available (%s), falling back to another port", DefaultPort, bindErr.Failure)
 
 	ebpfSrv, port, ok := s.tryToUseeBPF()
 	if ok {
@@ -208,15 +240,18 @@ func (s *serviceViaListener) evalListenAddress() (netip.Addr, uint16, error) {
 		return s.wgInterface.Address().IP, port, nil
 	}
 
-	ip, ok = s.testFreePort(customPort)
-	if ok {
+	ip, err := s.testFreePort(customPort)
+	if err == nil {
 		return ip, customPort, nil
 	}
 
-	return netip.Addr{}, 0, fmt.Errorf("failed to find a free port for DNS server")
+	return netip.Addr{}, 0, fmt.Errorf("failed to find a free port for DNS server: %w", bindErr)
 }
 
-func (s *serviceViaListener) testFreePort(port int) (netip.Addr, bool) {
+// testFreePort returns the first address port can be bound on. If there's
+// none it returns the error of the first address failing for a known
+// reason, or else of the first address.
+func (s *serviceViaListener) testFreePort(port int) (netip.Addr, *ListenError) {
 	var ips []netip.Addr
 	if runtime.GOOS != "darwin" {
 		ips = []netip.Addr{s.wgInterface.Address().IP, defaultIP, customIP}
@@ -224,24 +259,27 @@ func (s *serviceViaListener) testFreePort(port int) (netip.Addr, bool) {
 		ips = []netip.Addr{defaultIP, customIP}
 	}
 
+	var bindErr *ListenError
 	for _, ip := range ips {
-		if !s.tryToBind(ip, port) {
-			continue
+		err := s.tryToBind(ip, port)
+		if err == nil {
+			return ip, nil
+		}
+		if bindErr == nil || (bindErr.Failure == ListenFailureOther && err.Failure != ListenFailureOther) {
+			bindErr = err
 		}
-
-		return ip, true
 	}
-	return netip.Addr{}, false
+	return netip.Addr{}, bindErr
 }
 
-func (s *serviceViaListener) tryToBind(ip netip.Addr, port int) bool {
+func (s *serviceViaListener) tryToBind(ip netip.Addr, port int) *ListenError {
 	addrPort := netip.AddrPortFrom(ip, uint16(port))
 
 	udpAddr := net.UDPAddrFromAddrPort(addrPort)
 	udpLn, err := net.ListenUDP("udp", udpAddr)
 	if err != nil {
 		log.Warnf("binding dns UDP on %s is not available: %s", addrPort, err)
-		return false
+		return newListenError(addrPort, err)
 	}
 	if err := udpLn.Close(); err != nil {
 		log.Debugf("close UDP probe listener: %s", err)
@@ -251,13 +289,13 @@ func (s *serviceViaListener) tryToBind(ip netip.Addr, port int) bool {
 	tcpLn, err := net.ListenTCP("tcp", tcpAddr)
 	if err != nil {
 		log.Warnf("binding dns TCP on %s is not available: %s", addrPort, err)
-		return false
+		return newListenError(addrPort, err)
 	}
 	if err := tcpLn.Close(); err != nil {
 		log.Debugf("close TCP probe listener: %s", err)
 	}
 
-	return true
+	return nil
 }
 
 // tryToUseeBPF decides whether to apply eBPF program to capture DNS traffic on port 53.
@@ -287,8 +325,7 @@ func (s *serviceViaListener) tryToUseeBPF() (ebpfMgr.Manager, uint16, bool) {
 }
 
 func (s *serviceViaListener) generateFreePort() (uint16, error) {
-	ok := s.tryToBind(s.wgInterface.Address().IP, customPort)
-	if ok {
+	if s.tryToBind(s.wgInterface.Address().IP, customPort) == nil {
 		return customPort, nil
 	}
 
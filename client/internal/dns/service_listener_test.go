@@ -1,9 +1,12 @@
 package dns
 
 import (
+	"errors"
 	"fmt"
 	"net"
 	"net/netip"
+	"os"
+	"syscall"
 	"testing"
 	"time"
 
@@ -84,3 +87,74 @@ func TestServiceViaListener_TCPAndUDP(t *testing.T) {
 	require.NotEmpty(t, tcpResp.Answer)
 	assert.Contains(t, tcpResp.Answer[0].String(), "192.0.2.1", "TCP response should contain expected IP")
 }
+
+func TestNewListenError(t *testing.T) {
+	addr := netip.MustParseAddrPort("127.0.0.1:53")
+	bindErr := func(errno syscall.Errno) error {
+		return &net.OpError{Op: "listen", Net: "udp", Err: os.NewSyscallError("bind", errno)}
+	}
+
+	assert.Equal(t, ListenFailurePortInUse, newListenError(addr, bindErr(syscall.EADDRINUSE)).Failure)
+	assert.Equal(t, ListenFailurePermission, newListenError(addr, bindErr(syscall.EACCES)).Failure)
+	assert.Equal(t, ListenFailureOther, newListenError(addr, bindErr(syscall.EADDRNOTAVAIL)).Failure)
+
+	var listenErr *ListenError
+	wrapped := fmt.Errorf("service listen: %w", newListenError(addr, bindErr(syscall.EACCES)))
+	require.True(t, errors.As(wrapped, &listenErr))
+	assert.Equal(t, addr, listenErr.Addr)
+	assert.ErrorIs(t, wrapped, syscall.EACCES)
+}
+
+func TestServiceViaListener_PortInUse(t *testing.T) {
+	udpConn, err := net.ListenUDP("udp", net.UDPAddrFromAddrPort(netip.AddrPortFrom(customIP, 0)))
+	if err != nil {
+		t.Skip("cannot bind to 127.0.0.153, skipping")
+	}
+	defer udpConn.Close()
+	port := udpConn.LocalAddr().(*net.UDPAddr).Port
+
+	svc := newServiceViaListener(nil, nil, nil)
+	listenErr := svc.tryToBind(customIP, port)
+	require.NotNil(t, listenErr)
+	assert.Equal(t, ListenFailurePortInUse, listenErr.Failure)
+	assert.Equal(t, netip.AddrPortFrom(customIP, uint16(port)), listenErr.Addr)
+}
+
+func TestServiceViaListener_PeerPort(t *testing.T) {
+	wgIface := &mocWGIface{}
+	wgIP := wgIface.Address().IP
+
+	tests := []struct {
+		name     string
+		running  bool
+		listenIP netip.Addr
+		port     uint16
+		ebpf     bool
+		want     uint16
+	}{
+		{name: "not listening", listenIP: wgIP, port: DefaultPort},
+		{name: "default port", running: true, listenIP: wgIP, port: DefaultPort, want: DefaultPort},
+		{name: "custom port", running: true, listenIP: wgIP, port: customPort, want: customPort},
+		{name: "ebpf redirect", running: true, listenIP: wgIP, port: 34567, ebpf: true, want: DefaultPort},
+		{name: "loopback", running: true, listenIP: customIP, port: DefaultPort},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			svc := newServiceViaListener(wgIface, nil, nil)
+			svc.listenerIsRunning = tc.running
+			svc.listenIP = tc.listenIP
+			svc.listenPort = tc.port
+			if tc.ebpf {
+				svc.ebpfService = &noopEbpfManager{}
+			}
+			assert.Equal(t, tc.want, svc.peerPort())
+		})
+	}
+}
+
+type noopEbpfManager struct{}
+
+func (noopEbpfManager) LoadDNSFwd(netip.Addr, int) error { return nil }
+func (noopEbpfManager) FreeDNSFwd() error                { return nil }
+func (noopEbpfManager) LoadWgProxy(int, int) error       { return nil }
+func (noopEbpfManager) FreeWGProxy() error               { return nil }
@@ -12,7 +12,6 @@ import (
 	log "github.com/sirupsen/logrus"
 
 	"github.com/netbirdio/netbird/client/iface"
-	nbnet "github.com/netbirdio/netbird/client/net"
 )
 
 type ServiceViaMemory struct {
@@ -24,19 +23,31 @@ type ServiceViaMemory struct {
 	tcpHookSet        bool
 	listenerIsRunning bool
 	listenerFlagLock  sync.Mutex
+
+	// preferredIP is the configured runtime IP, tried first when the
+	// service has to move to another address.
+	preferredIP netip.Addr
 }
 
 func NewServiceViaMemory(wgIface WGIface) *ServiceViaMemory {
-	lastIP, err := nbnet.GetLastIPFromNetwork(wgIface.Address().Network, 1)
+	return NewServiceViaMemoryWithIP(wgIface, netip.Addr{})
+}
+
+// NewServiceViaMemoryWithIP returns a service answering on preferredIP, or
+// on an address selected by SelectServiceIP if it is unset or unusable.
+func NewServiceViaMemoryWithIP(wgIface WGIface, preferredIP netip.Addr) *ServiceViaMemory {
+	wgAddress := wgIface.Address()
+	runtimeIP, err := SelectServiceIP(wgAddress.Network, preferredIP, serviceIPTaken(wgAddress.IP, nil))
 	if err != nil {
-		log.Errorf("get last ip from network: %v", err)
+		log.Errorf("select DNS service address: %v", err)
 	}
 
 	return &ServiceViaMemory{
 		wgInterface: wgIface,
 		dnsMux:      dns.NewServeMux(),
-		runtimeIP:   lastIP,
+		runtimeIP:   runtimeIP,
 		runtimePort: DefaultPort,
+		preferredIP: preferredIP,
 	}
 }
 
@@ -53,7 +64,7 @@ func (s *ServiceViaMemory) Listen() error {
 	}
 	s.listenerIsRunning = true
 
-	log.Debugf("dns service listening on: %s", s.RuntimeIP())
+	log.Debugf("dns service listening on: %s", s.runtimeIP)
 	return nil
 }
 
@@ -82,6 +93,46 @@ func (s *ServiceViaMemory) Stop() error {
 	return nil
 }
 
+// relocate moves the service off an address in taken, keeping the
+// configured one if possible. It returns whether the address changed.
+func (s *ServiceViaMemory) relocate(taken func(netip.Addr) bool) (bool, error) {
+	s.listenerFlagLock.Lock()
+	defer s.listenerFlagLock.Unlock()
+
+	if !taken(s.runtimeIP) {
+		return false, nil
+	}
+	ip, err := SelectServiceIP(s.wgInterface.Address().Network, s.preferredIP, taken)
+	if err != nil {
+		return false, err
+	}
+
+	if filter := s.wgInterface.GetFilter(); filter != nil && s.listenerIsRunning {
+		filter.SetUDPPacketHook(s.runtimeIP, uint16(s.runtimePort), nil)
+		if s.tcpHookSet {
+			filter.SetTCPPacketHook(s.runtimeIP, uint16(s.runtimePort), nil)
+			s.tcpHookSet = false
+		}
+	}
+	// the TCP server is bound to the old address, filterDNSTraffic creates
+	// a new one
+	if s.tcpDNS != nil {
+		s.tcpDNS.Stop()
+		s.tcpDNS = nil
+	}
+
+	log.Infof("moving DNS service from %s to %s", s.runtimeIP, ip)
+	s.runtimeIP = ip
+	if !s.listenerIsRunning {
+		return true, nil
+	}
+	if err := s.filterDNSTraffic(); err != nil {
+		s.listenerIsRunning = false
+		return true, fmt.Errorf("filter dns traffic: %w", err)
+	}
+	return true, nil
+}
+
 func (s *ServiceViaMemory) RegisterMux(pattern string, handler dns.Handler) {
 	s.dnsMux.Handle(pattern, handler)
 }
@@ -94,7 +145,14 @@ func (s *ServiceViaMemory) RuntimePort() int {
 	return s.runtimePort
 }
 
+// DefaultPortError returns nil, the service doesn't bind a port.
+func (s *ServiceViaMemory) DefaultPortError() error {
+	return nil
+}
+
 func (s *ServiceViaMemory) RuntimeIP() netip.Addr {
+	s.listenerFlagLock.Lock()
+	defer s.listenerFlagLock.Unlock()
 	return s.runtimeIP
 }
 
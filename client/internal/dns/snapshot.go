@@ -0,0 +1,89 @@
+package dns
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	nbdns "github.com/netbirdio/netbird/dns"
+)
+
+// snapshotVersion is the current ExportConfig format. ImportConfig rejects
+// snapshots written by a newer format it doesn't know.
+const snapshotVersion = 1
+
+// configSnapshot is the serialized form of the effective DNS configuration.
+// Host and Handlers describe the state derived from Config and are exported
+// for inspection only; ImportConfig rebuilds them from Config.
+type configSnapshot struct {
+	Version  int               `json:"version"`
+	Config   nbdns.Config      `json:"config"`
+	Host     HostDNSConfig     `json:"host"`
+	Handlers []snapshotHandler `json:"handlers,omitempty"`
+}
+
+type snapshotHandler struct {
+	Domain   string `json:"domain"`
+	Priority int    `json:"priority"`
+	ID       string `json:"id"`
+}
+
+// ExportConfig serializes the last applied DNS configuration, with the host
+// config and handlers derived from it, to a versioned JSON snapshot.
+func (s *DefaultServer) ExportConfig() ([]byte, error) {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+
+	snapshot := configSnapshot{
+		Version: snapshotVersion,
+		Config:  s.appliedConfig,
+		Host:    s.currentConfig,
+	}
+	for _, h := range s.dnsMuxHandlers {
+		snapshot.Handlers = append(snapshot.Handlers, snapshotHandler{
+			Domain:   h.domain,
+			Priority: h.priority,
+			ID:       string(h.handler.ID()),
+		})
+	}
+
+	data, err := json.Marshal(snapshot)
+	if err != nil {
+		return nil, fmt.Errorf("marshal dns config: %w", err)
+	}
+	return data, nil
+}
+
+// ImportConfig applies a snapshot produced by ExportConfig as if it came from
+// a management update. The update serial is left untouched, so the next
+// management update replaces the imported configuration. Imports are refused
+// while updates are frozen.
+func (s *DefaultServer) ImportConfig(data []byte) error {
+	var snapshot configSnapshot
+	if err := json.Unmarshal(data, &snapshot); err != nil {
+		return fmt.Errorf("unmarshal dns config: %w", err)
+	}
+	if snapshot.Version < 1 || snapshot.Version > snapshotVersion {
+		return fmt.Errorf("unsupported dns config snapshot version %d, expected at most %d", snapshot.Version, snapshotVersion)
+	}
+
+	s.mux.Lock()
+	defer s.mux.Unlock()
+
+	if s.frozen {
+		return fmt.Errorf("dns updates are frozen")
+	}
+
+	err := s.applyConfiguration(s.updateSerial, snapshot.Config)
+	if err != nil && !onlyHostConfigFailed(err) {
+		return fmt.Errorf("apply configuration: %w", err)
+	}
+	s.appliedConfig = snapshot.Config
+
+	hash, hashErr := s.hashUpdate(snapshot.Config)
+	s.setPreviousConfigHash(hash, errors.Join(hashErr, err))
+	if err != nil {
+		return fmt.Errorf("apply configuration: %w", err)
+	}
+	return nil
+}
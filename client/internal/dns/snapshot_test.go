@@ -0,0 +1,65 @@
+package dns
+
+import (
+	"encoding/json"
+	"net/netip"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	nbdns "github.com/netbirdio/netbird/dns"
+)
+
+func TestDefaultServer_ExportImportConfig(t *testing.T) {
+	config := nbdns.Config{
+		ServiceEnable: true,
+		CustomZones: []nbdns.CustomZone{
+			{
+				Domain: "netbird.cloud.",
+				Records: []nbdns.SimpleRecord{
+					{Name: "peer.netbird.cloud.", Type: 1, Class: nbdns.DefaultClass, TTL: 300, RData: "100.64.0.1"},
+				},
+			},
+		},
+		NameServerGroups: []*nbdns.NameServerGroup{
+			{
+				NameServers: []nbdns.NameServer{
+					{IP: netip.MustParseAddr("192.0.2.1"), NSType: nbdns.UDPNameServerType, Port: 53},
+				},
+				Domains: []string{"corp.example.com"},
+			},
+		},
+	}
+
+	source := newTestServer(nil)
+	require.NoError(t, source.UpdateDNSServer(1, config))
+
+	data, err := source.ExportConfig()
+	require.NoError(t, err)
+
+	var snapshot configSnapshot
+	require.NoError(t, json.Unmarshal(data, &snapshot))
+	assert.Equal(t, snapshotVersion, snapshot.Version)
+	assert.Len(t, snapshot.Handlers, 2, "local zone and nameserver group handlers should be exported")
+
+	target := newTestServer(nil)
+	require.NoError(t, target.ImportConfig(data))
+
+	assert.Equal(t, source.currentConfig, target.currentConfig, "host config should be rebuilt from the snapshot")
+	assert.Len(t, target.dnsMuxHandlers, 2)
+	assert.Equal(t, source.previousConfigHash, target.previousConfigHash, "re-sending the same config should be a no-op")
+	assert.Equal(t, uint64(0), target.updateSerial, "import must not advance the update serial")
+}
+
+func TestDefaultServer_ImportConfigRejectsUnknownVersion(t *testing.T) {
+	server := newTestServer(nil)
+
+	for _, version := range []int{0, snapshotVersion + 1} {
+		data, err := json.Marshal(configSnapshot{Version: version})
+		require.NoError(t, err)
+		assert.Error(t, server.ImportConfig(data), "version %d should be rejected", version)
+	}
+
+	assert.Error(t, server.ImportConfig([]byte("not json")))
+}
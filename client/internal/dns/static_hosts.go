@@ -0,0 +1,166 @@
+package dns
+
+import (
+	"net/netip"
+	"slices"
+	"strings"
+
+	"github.com/miekg/dns"
+	log "github.com/sirupsen/logrus"
+
+	"github.com/netbirdio/netbird/client/internal/dns/local"
+	"github.com/netbirdio/netbird/client/internal/dns/types"
+	nbdns "github.com/netbirdio/netbird/dns"
+	"github.com/netbirdio/netbird/shared/management/domain"
+)
+
+const (
+	// staticHostTTL is the TTL of static host records.
+	staticHostTTL = 300
+	// priorityStaticHosts is a sub-priority of TierLocal, so a static host
+	// named like a custom zone doesn't replace the zone's registration.
+	priorityStaticHosts = PriorityLocal - 1
+)
+
+// staticHostsHandler serves static hosts from the local resolver. Unlike the
+// custom zone registrations it matches the host names only, so subdomains of
+// a static host keep resolving through the handlers below.
+type staticHostsHandler struct {
+	resolver *local.Resolver
+}
+
+func (h *staticHostsHandler) ServeDNS(w dns.ResponseWriter, r *dns.Msg) {
+	h.resolver.ServeDNS(w, r)
+}
+
+func (h *staticHostsHandler) MatchSubdomains() bool {
+	return false
+}
+
+// Stop is a no-op: the local resolver is shared and outlives the handler's
+// registrations.
+func (h *staticHostsHandler) Stop() {}
+
+func (h *staticHostsHandler) ID() types.HandlerID {
+	return "static-hosts"
+}
+
+func (h *staticHostsHandler) String() string {
+	return "StaticHosts"
+}
+
+// staticHostRecords converts static hosts to A and AAAA records, keyed by
+// the lowercase, fully qualified host name. Invalid names and addresses are
+// logged and skipped.
+func staticHostRecords(hosts map[string][]netip.Addr) map[string][]nbdns.SimpleRecord {
+	records := make(map[string][]nbdns.SimpleRecord, len(hosts))
+	for host, addrs := range hosts {
+		if !domain.IsValidDomainNoWildcard(strings.TrimSuffix(host, ".")) {
+			log.Warnf("skipping static host with invalid name %q", host)
+			continue
+		}
+		name := strings.ToLower(dns.Fqdn(host))
+
+		for _, addr := range addrs {
+			if !addr.IsValid() {
+				log.Warnf("skipping invalid address of static host %s", name)
+				continue
+			}
+			addr = addr.Unmap()
+			rtype := dns.TypeA
+			if addr.Is6() {
+				rtype = dns.TypeAAAA
+			}
+			records[name] = append(records[name], nbdns.SimpleRecord{
+				Name:  name,
+				Type:  int(rtype),
+				Class: nbdns.DefaultClass,
+				TTL:   staticHostTTL,
+				RData: addr.String(),
+			})
+		}
+	}
+	return records
+}
+
+// buildStaticHostsUpdate returns the handler registrations and the records
+// of hosts.
+func (s *DefaultServer) buildStaticHostsUpdate(hosts map[string][]netip.Addr) ([]handlerWrapper, []nbdns.SimpleRecord) {
+	byName := staticHostRecords(hosts)
+
+	names := make([]string, 0, len(byName))
+	for name := range byName {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+
+	var muxUpdates []handlerWrapper
+	var records []nbdns.SimpleRecord
+	for _, name := range names {
+		if len(byName[name]) == 0 {
+			continue
+		}
+		muxUpdates = append(muxUpdates, handlerWrapper{
+			domain:   name,
+			handler:  s.staticHosts,
+			priority: priorityStaticHosts,
+		})
+		records = append(records, byName[name]...)
+	}
+	return muxUpdates, records
+}
+
+// SetStaticHosts replaces the static hosts served by the local resolver.
+// Custom zones, upstream handlers and the host DNS config are left
+// untouched, only hosts that were added or removed are re-registered in the
+// handler chain and only changed records are replaced. The next management
+// update replaces the hosts again.
+func (s *DefaultServer) SetStaticHosts(hosts map[string][]netip.Addr) {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+
+	hostUpdates, records := s.buildStaticHostsUpdate(hosts)
+
+	wanted := make(map[string]struct{}, len(hostUpdates))
+	for _, update := range hostUpdates {
+		wanted[update.domain] = struct{}{}
+	}
+
+	muxUpdates := make([]handlerWrapper, 0, len(s.dnsMuxHandlers)+len(hostUpdates))
+	registered := make(map[string]struct{})
+	for _, existing := range s.dnsMuxHandlers {
+		if existing.handler != s.staticHosts {
+			muxUpdates = append(muxUpdates, existing)
+			continue
+		}
+		if _, ok := wanted[existing.domain]; !ok {
+			s.deregisterHandler([]string{existing.domain}, existing.priority)
+			continue
+		}
+		muxUpdates = append(muxUpdates, existing)
+		registered[existing.domain] = struct{}{}
+	}
+	for _, update := range hostUpdates {
+		if _, ok := registered[update.domain]; ok {
+			continue
+		}
+		s.registerHandler([]string{update.domain}, update.handler, update.priority)
+		muxUpdates = append(muxUpdates, update)
+	}
+
+	old := s.dnsMuxHandlers
+	s.dnsMuxHandlers = muxUpdates
+	s.notifyMuxChange(old, muxUpdates)
+
+	s.localResolver.UpdateSourceRecords(local.SourceStaticHosts, records)
+
+	// keep the applied config in sync so an identical management update
+	// isn't skipped as a no-op and restores its own hosts
+	s.appliedConfig.StaticHosts = hosts
+	s.setPreviousConfigHash(s.hashUpdate(s.appliedConfig))
+}
+
+// StaticHosts returns the static host records currently served.
+func (s *DefaultServer) StaticHosts() []nbdns.SimpleRecord {
+	return s.localResolver.Records(local.SourceStaticHosts)
+}
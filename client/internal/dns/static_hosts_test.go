@@ -0,0 +1,118 @@
+package dns
+
+import (
+	"net/netip"
+	"testing"
+
+	"github.com/miekg/dns"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/netbirdio/netbird/client/internal/dns/test"
+	nbdns "github.com/netbirdio/netbird/dns"
+)
+
+func resolveAddrs(t *testing.T, server *DefaultServer, name string, qtype uint16) []string {
+	t.Helper()
+	w := &test.MockResponseWriter{}
+	server.handlerChain.ServeDNS(w, new(dns.Msg).SetQuestion(name, qtype))
+	resp := w.GetLastResponse()
+	require.NotNil(t, resp)
+	require.Equal(t, dns.RcodeSuccess, resp.Rcode, "%s %s", name, dns.TypeToString[qtype])
+
+	var addrs []string
+	for _, rr := range resp.Answer {
+		switch rr := rr.(type) {
+		case *dns.A:
+			addrs = append(addrs, rr.A.String())
+		case *dns.AAAA:
+			addrs = append(addrs, rr.AAAA.String())
+		}
+	}
+	return addrs
+}
+
+func TestStaticHosts_PrecedeUpstream(t *testing.T) {
+	server := newTestServer(nil)
+	server.handlerChain.AddHandler(".", dualStackUpstream, PriorityUpstream)
+
+	require.NoError(t, server.UpdateDNSServer(1, nbdns.Config{
+		ServiceEnable: true,
+		StaticHosts: map[string][]netip.Addr{
+			"App.Example.com": {netip.MustParseAddr("10.0.0.5"), netip.MustParseAddr("fd00::5")},
+			"v4.example.com.": {netip.MustParseAddr("::ffff:10.0.0.6")},
+			"bad name!":       {netip.MustParseAddr("10.0.0.7")},
+		},
+	}))
+
+	assert.Equal(t, []string{"10.0.0.5"}, resolveAddrs(t, server, "app.example.com.", dns.TypeA))
+	assert.Equal(t, []string{"fd00::5"}, resolveAddrs(t, server, "app.example.com.", dns.TypeAAAA))
+	assert.Equal(t, []string{"10.0.0.6"}, resolveAddrs(t, server, "v4.example.com.", dns.TypeA))
+	assert.Empty(t, resolveAddrs(t, server, "v4.example.com.", dns.TypeAAAA), "a host without IPv6 answers AAAA with NODATA")
+
+	assert.Equal(t, []string{"10.1.2.3"}, resolveAddrs(t, server, "sub.app.example.com.", dns.TypeA), "subdomains of a host are left to upstream")
+	assert.Equal(t, []string{"10.1.2.3"}, resolveAddrs(t, server, "other.example.com.", dns.TypeA))
+}
+
+func TestStaticHosts_CoexistWithCustomZones(t *testing.T) {
+	server := newTestServer(nil)
+	server.handlerChain.AddHandler(".", dualStackUpstream, PriorityUpstream)
+
+	require.NoError(t, server.UpdateDNSServer(1, nbdns.Config{
+		ServiceEnable: true,
+		CustomZones: []nbdns.CustomZone{{
+			Domain: "netbird.cloud.",
+			Records: []nbdns.SimpleRecord{
+				{Name: "peer.netbird.cloud.", Type: int(dns.TypeA), Class: nbdns.DefaultClass, TTL: 300, RData: "100.64.0.1"},
+			},
+		}},
+		StaticHosts: map[string][]netip.Addr{
+			"db.netbird.cloud":   {netip.MustParseAddr("10.0.0.8")},
+			"netbird.cloud":      {netip.MustParseAddr("10.0.0.9")},
+			"legacy.example.com": {netip.MustParseAddr("10.0.0.10")},
+		},
+	}))
+
+	assert.Equal(t, []string{"100.64.0.1"}, resolveAddrs(t, server, "peer.netbird.cloud.", dns.TypeA))
+	assert.Equal(t, []string{"10.0.0.8"}, resolveAddrs(t, server, "db.netbird.cloud.", dns.TypeA), "hosts inside a custom zone are served")
+	assert.Equal(t, []string{"10.0.0.9"}, resolveAddrs(t, server, "netbird.cloud.", dns.TypeA))
+	assert.Equal(t, []string{"10.0.0.10"}, resolveAddrs(t, server, "legacy.example.com.", dns.TypeA))
+
+	// Replacing the custom zones leaves the static hosts alone.
+	require.NoError(t, server.SetCustomZones(nil))
+	assert.Equal(t, []string{"10.0.0.8"}, resolveAddrs(t, server, "db.netbird.cloud.", dns.TypeA))
+	assert.Equal(t, []string{"10.0.0.9"}, resolveAddrs(t, server, "netbird.cloud.", dns.TypeA))
+	assert.Equal(t, []string{"10.1.2.3"}, resolveAddrs(t, server, "peer.netbird.cloud.", dns.TypeA), "the zone is gone")
+}
+
+func TestStaticHosts_IncrementalUpdate(t *testing.T) {
+	server := newTestServer(nil)
+	server.handlerChain.AddHandler(".", dualStackUpstream, PriorityUpstream)
+
+	require.NoError(t, server.UpdateDNSServer(1, nbdns.Config{
+		ServiceEnable: true,
+		CustomZones: []nbdns.CustomZone{{
+			Domain: "netbird.cloud.",
+			Records: []nbdns.SimpleRecord{
+				{Name: "peer.netbird.cloud.", Type: int(dns.TypeA), Class: nbdns.DefaultClass, TTL: 300, RData: "100.64.0.1"},
+			},
+		}},
+		StaticHosts: map[string][]netip.Addr{
+			"a.example.com": {netip.MustParseAddr("10.0.0.1")},
+			"b.example.com": {netip.MustParseAddr("10.0.0.2")},
+		},
+	}))
+
+	server.SetStaticHosts(map[string][]netip.Addr{
+		"a.example.com": {netip.MustParseAddr("10.0.0.1")},
+		"c.example.com": {netip.MustParseAddr("10.0.0.3"), netip.MustParseAddr("fd00::3")},
+	})
+
+	assert.Equal(t, []string{"10.0.0.1"}, resolveAddrs(t, server, "a.example.com.", dns.TypeA))
+	assert.Equal(t, []string{"10.1.2.3"}, resolveAddrs(t, server, "b.example.com.", dns.TypeA), "removed hosts resolve upstream again")
+	assert.Equal(t, []string{"fd00::3"}, resolveAddrs(t, server, "c.example.com.", dns.TypeAAAA))
+	assert.Equal(t, []string{"100.64.0.1"}, resolveAddrs(t, server, "peer.netbird.cloud.", dns.TypeA), "custom zones are untouched")
+
+	assert.False(t, chainHasPattern(server, "b.example.com.", priorityStaticHosts))
+	assert.Len(t, server.StaticHosts(), 3)
+}
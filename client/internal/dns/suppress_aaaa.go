@@ -0,0 +1,82 @@
+package dns
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/miekg/dns"
+	log "github.com/sirupsen/logrus"
+
+	"github.com/netbirdio/netbird/client/internal/dns/resutil"
+	"github.com/netbirdio/netbird/client/internal/dns/types"
+)
+
+// suppressAAAAResolver answers AAAA queries of its domains with NODATA
+// without asking an upstream, so applications on IPv4-only networks don't
+// wait for IPv6 addresses they can't use. Every other query falls through.
+type suppressAAAAResolver struct {
+	domains []string
+}
+
+func (r *suppressAAAAResolver) String() string {
+	return fmt.Sprintf("SuppressAAAAResolver %v", r.domains)
+}
+
+func (r *suppressAAAAResolver) ID() types.HandlerID {
+	return "suppress-aaaa"
+}
+
+func (r *suppressAAAAResolver) MatchSubdomains() bool {
+	return true
+}
+
+func (r *suppressAAAAResolver) Stop() {
+	// nothing to release
+}
+
+func (r *suppressAAAAResolver) ServeDNS(w dns.ResponseWriter, req *dns.Msg) {
+	if len(req.Question) == 0 {
+		return
+	}
+
+	resp := new(dns.Msg)
+	if req.Question[0].Qtype != dns.TypeAAAA {
+		resp.SetRcode(req, dns.RcodeNameError)
+		resp.MsgHdr.Zero = true
+	} else {
+		resp.SetReply(req)
+		resutil.SetMeta(w, "suppress_aaaa", "true")
+	}
+	if err := w.WriteMsg(resp); err != nil {
+		log.Errorf("failed to write suppressed AAAA response for %s: %v", req.Question[0].Name, err)
+	}
+}
+
+// enableAAAASuppression answers AAAA queries for domains and their
+// subdomains with NODATA, "." suppressing them for every name. It is
+// registered below custom zones, mirrored zones and DNS routes, so names
+// answered from NetBird's own records, where IPv6 is expected, keep their
+// AAAA records.
+func (s *DefaultServer) enableAAAASuppression(domains []string) {
+	var patterns []string
+	for _, d := range domains {
+		d = strings.TrimSpace(d)
+		if d == "" {
+			continue
+		}
+		d = strings.ToLower(dns.Fqdn(d))
+		if _, ok := dns.IsDomainName(d); !ok {
+			log.Warnf("invalid domain %q to suppress AAAA answers for, skipping", d)
+			continue
+		}
+		patterns = append(patterns, d)
+	}
+	if len(patterns) == 0 {
+		return
+	}
+
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	s.registerHandler(patterns, &suppressAAAAResolver{domains: patterns}, PrioritySuppressAAAA)
+	log.Debugf("answering AAAA queries for %v with NODATA", patterns)
+}
@@ -0,0 +1,86 @@
+package dns
+
+import (
+	"testing"
+
+	"github.com/miekg/dns"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/netbirdio/netbird/client/internal/dns/test"
+	nbdns "github.com/netbirdio/netbird/dns"
+)
+
+// dualStackUpstream answers A and AAAA queries with one address each and
+// other types with NODATA.
+var dualStackUpstream = dns.HandlerFunc(func(w dns.ResponseWriter, r *dns.Msg) {
+	q := r.Question[0]
+	msg := new(dns.Msg)
+	switch q.Qtype {
+	case dns.TypeA:
+		msg = addressAnswer(q.Name, 300, "10.1.2.3")
+	case dns.TypeAAAA:
+		msg = addressAnswer(q.Name, 300, "fd00::3")
+	}
+	msg.SetReply(r)
+	_ = w.WriteMsg(msg)
+})
+
+func TestSuppressAAAA(t *testing.T) {
+	server := newTestServer(nil)
+	server.enableAAAASuppression([]string{"Legacy.Example.com", "not a domain..", ""})
+	server.handlerChain.AddHandler(".", dualStackUpstream, PriorityUpstream)
+
+	query := func(name string, qtype uint16) *dns.Msg {
+		t.Helper()
+		w := &test.MockResponseWriter{}
+		server.handlerChain.ServeDNS(w, new(dns.Msg).SetQuestion(name, qtype))
+		resp := w.GetLastResponse()
+		require.NotNil(t, resp)
+		require.Equal(t, dns.RcodeSuccess, resp.Rcode)
+		return resp
+	}
+
+	for _, name := range []string{"legacy.example.com.", "app.legacy.example.com."} {
+		resp := query(name, dns.TypeAAAA)
+		assert.Empty(t, resp.Answer, "AAAA of %s must be NODATA", name)
+
+		resp = query(name, dns.TypeA)
+		require.Len(t, resp.Answer, 1, "A of %s is unaffected", name)
+		assert.Equal(t, "10.1.2.3", resp.Answer[0].(*dns.A).A.String())
+
+		assert.Len(t, query(name, dns.TypeMX).Answer, 0)
+	}
+
+	resp := query("other.example.com.", dns.TypeAAAA)
+	require.Len(t, resp.Answer, 1, "names outside the domains keep AAAA")
+	assert.Equal(t, "fd00::3", resp.Answer[0].(*dns.AAAA).AAAA.String())
+}
+
+func TestSuppressAAAA_CustomZoneKeepsAAAA(t *testing.T) {
+	server := newTestServer(nil)
+	server.enableAAAASuppression([]string{"."})
+	server.handlerChain.AddHandler(".", dualStackUpstream, PriorityUpstream)
+
+	require.NoError(t, server.UpdateDNSServer(1, nbdns.Config{
+		ServiceEnable: true,
+		CustomZones: []nbdns.CustomZone{{
+			Domain: "netbird.cloud.",
+			Records: []nbdns.SimpleRecord{
+				{Name: "peer.netbird.cloud.", Type: int(dns.TypeAAAA), Class: nbdns.DefaultClass, TTL: 300, RData: "fd00::10"},
+			},
+		}},
+	}))
+
+	w := &test.MockResponseWriter{}
+	server.handlerChain.ServeDNS(w, new(dns.Msg).SetQuestion("peer.netbird.cloud.", dns.TypeAAAA))
+	resp := w.GetLastResponse()
+	require.NotNil(t, resp)
+	require.Len(t, resp.Answer, 1, "custom zones keep their AAAA records")
+	assert.Equal(t, "fd00::10", resp.Answer[0].(*dns.AAAA).AAAA.String())
+
+	w = &test.MockResponseWriter{}
+	server.handlerChain.ServeDNS(w, new(dns.Msg).SetQuestion("example.org.", dns.TypeAAAA))
+	require.NotNil(t, w.GetLastResponse())
+	assert.Empty(t, w.GetLastResponse().Answer, "everything else is suppressed with \".\"")
+}
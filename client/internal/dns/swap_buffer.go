@@ -0,0 +1,104 @@
+package dns
+
+import (
+	"sync"
+	"time"
+)
+
+const (
+	// defaultSwapQueueSize is how many queries may wait for a handler swap
+	// when DefaultServerConfig.SwapQueueSize is unset.
+	defaultSwapQueueSize = 64
+	// defaultSwapQueueTimeout bounds how long a query waits for a handler
+	// swap when DefaultServerConfig.SwapQueueTimeout is unset.
+	defaultSwapQueueTimeout = 2 * time.Second
+)
+
+// swapBuffer holds queries back while the handler set of a chain is being
+// replaced, so they are served by the complete new set instead of the
+// partially torn down one. At most size queries wait, each for at most
+// timeout. A negative size disables buffering.
+type swapBuffer struct {
+	mu      sync.Mutex
+	size    int
+	timeout time.Duration
+	// done is closed when the running swap completes, nil outside a swap.
+	done    chan struct{}
+	waiting int
+}
+
+func newSwapBuffer() *swapBuffer {
+	return &swapBuffer{
+		size:    defaultSwapQueueSize,
+		timeout: defaultSwapQueueTimeout,
+	}
+}
+
+// configure sets the queue bounds. Zero values use the defaults; a negative
+// size disables buffering, letting queries through during swaps.
+func (b *swapBuffer) configure(size int, timeout time.Duration) {
+	if size == 0 {
+		size = defaultSwapQueueSize
+	}
+	if timeout <= 0 {
+		timeout = defaultSwapQueueTimeout
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.size = size
+	b.timeout = timeout
+}
+
+// begin starts holding queries back until end is called.
+func (b *swapBuffer) begin() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.size < 0 || b.done != nil {
+		return
+	}
+	b.done = make(chan struct{})
+}
+
+// end releases the queries held back since begin.
+func (b *swapBuffer) end() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.done != nil {
+		close(b.done)
+		b.done = nil
+	}
+}
+
+// wait blocks while a swap is running. It reports false if the query can't
+// be queued because the queue is full, or the swap outlasts the timeout.
+func (b *swapBuffer) wait() bool {
+	b.mu.Lock()
+	done := b.done
+	if done == nil || b.size < 0 {
+		b.mu.Unlock()
+		return true
+	}
+	if b.waiting >= b.size {
+		b.mu.Unlock()
+		return false
+	}
+	b.waiting++
+	timeout := b.timeout
+	b.mu.Unlock()
+
+	defer func() {
+		b.mu.Lock()
+		b.waiting--
+		b.mu.Unlock()
+	}()
+
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	select {
+	case <-done:
+		return true
+	case <-timer.C:
+		return false
+	}
+}
@@ -0,0 +1,146 @@
+package dns
+
+import (
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/miekg/dns"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/netbirdio/netbird/client/internal/dns/test"
+	"github.com/netbirdio/netbird/client/internal/dns/types"
+)
+
+// swapTestHandler answers A queries with ip. Stop signals stopping and then
+// takes stopDelay, keeping the handler swap of updateMux open.
+type swapTestHandler struct {
+	id        string
+	ip        net.IP
+	stopping  chan struct{}
+	stopDelay time.Duration
+}
+
+func (h *swapTestHandler) ServeDNS(w dns.ResponseWriter, r *dns.Msg) {
+	resp := new(dns.Msg).SetReply(r)
+	resp.Answer = append(resp.Answer, &dns.A{
+		Hdr: dns.RR_Header{Name: r.Question[0].Name, Rrtype: dns.TypeA, Class: dns.ClassINET, Ttl: 60},
+		A:   h.ip,
+	})
+	_ = w.WriteMsg(resp)
+}
+
+func (h *swapTestHandler) Stop() {
+	if h.stopping != nil {
+		close(h.stopping)
+	}
+	time.Sleep(h.stopDelay)
+}
+
+func (h *swapTestHandler) ID() types.HandlerID { return types.HandlerID(h.id) }
+
+func TestDefaultServer_UpdateMuxQueuesQueries(t *testing.T) {
+	server := &DefaultServer{
+		handlerChain: NewHandlerChain(),
+		service:      &mockService{},
+	}
+
+	stopping := make(chan struct{})
+	oldHandler := &swapTestHandler{id: "old", ip: net.ParseIP("10.0.0.1"), stopping: stopping, stopDelay: 100 * time.Millisecond}
+	newHandler := &swapTestHandler{id: "new", ip: net.ParseIP("10.0.0.2")}
+
+	server.updateMux([]handlerWrapper{{domain: "example.com", handler: oldHandler, priority: PriorityUpstream}})
+
+	swapped := make(chan struct{})
+	go func() {
+		defer close(swapped)
+		server.updateMux([]handlerWrapper{{domain: "example.com", handler: newHandler, priority: PriorityUpstream}})
+	}()
+
+	// The old handler is deregistered and the new one not yet registered.
+	<-stopping
+
+	const queries = 20
+	responses := make([]*dns.Msg, queries)
+	var wg sync.WaitGroup
+	for i := range queries {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			w := &test.MockResponseWriter{}
+			server.handlerChain.ServeDNS(w, new(dns.Msg).SetQuestion("example.com.", dns.TypeA))
+			responses[i] = w.GetLastResponse()
+		}()
+	}
+	wg.Wait()
+	<-swapped
+
+	for i, resp := range responses {
+		require.NotNil(t, resp, "query %d was dropped", i)
+		require.Equal(t, dns.RcodeSuccess, resp.Rcode, "query %d", i)
+		require.Len(t, resp.Answer, 1)
+		assert.Equal(t, "10.0.0.2", resp.Answer[0].(*dns.A).A.String(), "query %d must be served by the new handler", i)
+	}
+}
+
+func TestHandlerChain_SwapQueueOverflow(t *testing.T) {
+	chain := NewHandlerChain()
+	chain.SetSwapQueue(1, time.Second)
+	chain.AddHandler("example.com.", &swapTestHandler{id: "h", ip: net.ParseIP("10.0.0.1")}, PriorityUpstream)
+
+	chain.BeginSwap()
+
+	queued := &test.MockResponseWriter{}
+	served := make(chan struct{})
+	go func() {
+		defer close(served)
+		chain.ServeDNS(queued, new(dns.Msg).SetQuestion("example.com.", dns.TypeA))
+	}()
+	require.Eventually(t, func() bool {
+		chain.swap.mu.Lock()
+		defer chain.swap.mu.Unlock()
+		return chain.swap.waiting == 1
+	}, time.Second, time.Millisecond)
+
+	overflow := &test.MockResponseWriter{}
+	chain.ServeDNS(overflow, new(dns.Msg).SetQuestion("example.com.", dns.TypeA))
+	require.NotNil(t, overflow.GetLastResponse())
+	assert.Equal(t, dns.RcodeServerFailure, overflow.GetLastResponse().Rcode)
+
+	chain.EndSwap()
+	<-served
+	require.NotNil(t, queued.GetLastResponse())
+	assert.Equal(t, dns.RcodeSuccess, queued.GetLastResponse().Rcode)
+}
+
+func TestHandlerChain_SwapQueueTimeout(t *testing.T) {
+	chain := NewHandlerChain()
+	chain.SetSwapQueue(0, 50*time.Millisecond)
+	chain.AddHandler("example.com.", &swapTestHandler{id: "h", ip: net.ParseIP("10.0.0.1")}, PriorityUpstream)
+
+	chain.BeginSwap()
+	defer chain.EndSwap()
+
+	w := &test.MockResponseWriter{}
+	start := time.Now()
+	chain.ServeDNS(w, new(dns.Msg).SetQuestion("example.com.", dns.TypeA))
+	require.NotNil(t, w.GetLastResponse())
+	assert.Equal(t, dns.RcodeServerFailure, w.GetLastResponse().Rcode)
+	assert.GreaterOrEqual(t, time.Since(start), 50*time.Millisecond)
+}
+
+func TestHandlerChain_SwapQueueDisabled(t *testing.T) {
+	chain := NewHandlerChain()
+	chain.SetSwapQueue(-1, 0)
+	chain.AddHandler("example.com.", &swapTestHandler{id: "h", ip: net.ParseIP("10.0.0.1")}, PriorityUpstream)
+
+	chain.BeginSwap()
+	defer chain.EndSwap()
+
+	w := &test.MockResponseWriter{}
+	chain.ServeDNS(w, new(dns.Msg).SetQuestion("example.com.", dns.TypeA))
+	require.NotNil(t, w.GetLastResponse())
+	assert.Equal(t, dns.RcodeSuccess, w.GetLastResponse().Rcode, "queries go through unbuffered")
+}
@@ -193,18 +193,26 @@ func isSystemdLinkDefaultRoute(linkPath dbus.ObjectPath) bool {
 }
 
 func readSystemdLinkDNS(linkPath dbus.ObjectPath) []netip.Addr {
-	obj, closeConn, err := getDbusObject(systemdResolvedDest, linkPath)
+	servers, err := getSystemdLinkDNS(linkPath)
 	if err != nil {
 		return nil
 	}
+	return servers
+}
+
+func getSystemdLinkDNS(linkPath dbus.ObjectPath) ([]netip.Addr, error) {
+	obj, closeConn, err := getDbusObject(systemdResolvedDest, linkPath)
+	if err != nil {
+		return nil, fmt.Errorf("get dbus link object: %w", err)
+	}
 	defer closeConn()
 	v, err := obj.GetProperty(systemdDbusLinkDNSProperty)
 	if err != nil {
-		return nil
+		return nil, fmt.Errorf("get link DNS property: %w", err)
 	}
 	entries, ok := v.Value().([][]any)
 	if !ok {
-		return nil
+		return nil, fmt.Errorf("unexpected link DNS property type %T", v.Value())
 	}
 	var out []netip.Addr
 	for _, entry := range entries {
@@ -221,7 +229,17 @@ func readSystemdLinkDNS(linkPath dbus.ObjectPath) []netip.Addr {
 		}
 		out = append(out, addr)
 	}
-	return out
+	return out, nil
+}
+
+// hasDrift reports whether our link lost the NetBird DNS server, e.g. after
+// systemd-resolved was restarted or another tool reset the link.
+func (s *systemdDbusConfigurator) hasDrift(config HostDNSConfig) (bool, error) {
+	servers, err := getSystemdLinkDNS(s.dbusLinkObject)
+	if err != nil {
+		return false, err
+	}
+	return !slices.Contains(servers, config.ServerIP), nil
 }
 
 func (s *systemdDbusConfigurator) getOriginalNameservers() []netip.Addr {
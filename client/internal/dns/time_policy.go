@@ -0,0 +1,299 @@
+package dns
+
+import (
+	"fmt"
+	"net/netip"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/miekg/dns"
+	log "github.com/sirupsen/logrus"
+
+	"github.com/netbirdio/netbird/client/internal/dns/resutil"
+	"github.com/netbirdio/netbird/client/internal/dns/types"
+)
+
+// timePolicyTTL is the TTL of blocked answers, short so clients pick up the
+// next schedule change soon.
+const timePolicyTTL = 60
+
+var weekdays = map[string]time.Weekday{
+	"sun": time.Sunday,
+	"mon": time.Monday,
+	"tue": time.Tuesday,
+	"wed": time.Wednesday,
+	"thu": time.Thursday,
+	"fri": time.Friday,
+	"sat": time.Saturday,
+}
+
+// TimePolicy lets Domains resolve only within a daily schedule. Outside it,
+// queries are answered with NXDOMAIN, or Redirect if set.
+type TimePolicy struct {
+	// Domains the policy applies to, each including its subdomains.
+	Domains []string
+	// Days the schedule is open on, every day if empty. A window spanning
+	// midnight belongs to the day it starts on.
+	Days []time.Weekday
+	// Start and End bound the daily window as offsets from midnight. A
+	// window ending before it starts spans midnight.
+	Start time.Duration
+	End   time.Duration
+	// Location is the time zone of the schedule, UTC if nil.
+	Location *time.Location
+	// Redirect answers A or AAAA queries outside the schedule with this
+	// address, the other address type with NODATA. NXDOMAIN is returned
+	// if it is invalid.
+	Redirect netip.Addr
+}
+
+// Allows reports whether the schedule is open at t.
+func (p TimePolicy) Allows(t time.Time) bool {
+	loc := p.Location
+	if loc == nil {
+		loc = time.UTC
+	}
+	t = t.In(loc)
+	offset := time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute + time.Duration(t.Second())*time.Second
+	day := t.Weekday()
+
+	if p.Start <= p.End {
+		return offset >= p.Start && offset < p.End && p.openOn(day)
+	}
+	if offset >= p.Start {
+		return p.openOn(day)
+	}
+	// after midnight, in the window opened the day before
+	return offset < p.End && p.openOn((day+6)%7)
+}
+
+func (p TimePolicy) openOn(day time.Weekday) bool {
+	return len(p.Days) == 0 || slices.Contains(p.Days, day)
+}
+
+// ParseTimePolicies parses policy specs in format
+// "domain[,domain...] days hh:mm-hh:mm [timezone] [redirect-ip]", e.g.
+// "hr.example.com mon-fri 08:00-18:00 Europe/Berlin". Days are "*" or a
+// comma separated list of days and day ranges, e.g. "mon-fri,sun". Invalid
+// specs are logged and skipped.
+func ParseTimePolicies(specs []string) []TimePolicy {
+	var policies []TimePolicy
+	for _, spec := range specs {
+		policy, err := parseTimePolicy(spec)
+		if err != nil {
+			log.Warnf("invalid DNS time policy %q: %v", spec, err)
+			continue
+		}
+		policies = append(policies, policy)
+	}
+	return policies
+}
+
+func parseTimePolicy(spec string) (TimePolicy, error) {
+	fields := strings.Fields(spec)
+	if len(fields) < 3 || len(fields) > 5 {
+		return TimePolicy{}, fmt.Errorf("expected domains, days, window and optionally a timezone and redirect address")
+	}
+
+	var policy TimePolicy
+	for _, d := range strings.Split(fields[0], ",") {
+		d = strings.ToLower(dns.Fqdn(strings.TrimSpace(d)))
+		if _, ok := dns.IsDomainName(d); !ok || d == "." {
+			return TimePolicy{}, fmt.Errorf("invalid domain %q", d)
+		}
+		policy.Domains = append(policy.Domains, d)
+	}
+
+	days, err := parseWeekdays(fields[1])
+	if err != nil {
+		return TimePolicy{}, err
+	}
+	policy.Days = days
+
+	if policy.Start, policy.End, err = parseWindow(fields[2]); err != nil {
+		return TimePolicy{}, err
+	}
+
+	for _, field := range fields[3:] {
+		if addr, err := netip.ParseAddr(field); err == nil {
+			if policy.Redirect.IsValid() {
+				return TimePolicy{}, fmt.Errorf("more than one redirect address")
+			}
+			policy.Redirect = addr.Unmap()
+			continue
+		}
+		if policy.Location != nil || policy.Redirect.IsValid() {
+			return TimePolicy{}, fmt.Errorf("unexpected %q, the timezone comes before the redirect address", field)
+		}
+		loc, err := time.LoadLocation(field)
+		if err != nil {
+			return TimePolicy{}, fmt.Errorf("load timezone: %w", err)
+		}
+		policy.Location = loc
+	}
+	return policy, nil
+}
+
+func parseWeekdays(spec string) ([]time.Weekday, error) {
+	if spec == "*" {
+		return nil, nil
+	}
+	var days []time.Weekday
+	for _, part := range strings.Split(strings.ToLower(spec), ",") {
+		from, to, isRange := strings.Cut(part, "-")
+		first, ok := weekdays[from]
+		if !ok {
+			return nil, fmt.Errorf("invalid day %q", from)
+		}
+		last := first
+		if isRange {
+			if last, ok = weekdays[to]; !ok {
+				return nil, fmt.Errorf("invalid day %q", to)
+			}
+		}
+		for day := first; ; day = (day + 1) % 7 {
+			days = append(days, day)
+			if day == last {
+				break
+			}
+		}
+	}
+	return days, nil
+}
+
+// parseWindow parses "hh:mm-hh:mm", where the end may be 24:00.
+func parseWindow(spec string) (time.Duration, time.Duration, error) {
+	from, to, ok := strings.Cut(spec, "-")
+	if !ok {
+		return 0, 0, fmt.Errorf("invalid window %q, expected hh:mm-hh:mm", spec)
+	}
+	start, err := parseClock(from)
+	if err != nil {
+		return 0, 0, err
+	}
+	end, err := parseClock(to)
+	if err != nil {
+		return 0, 0, err
+	}
+	if start == end || start == 24*time.Hour {
+		return 0, 0, fmt.Errorf("invalid window %q", spec)
+	}
+	return start, end, nil
+}
+
+func parseClock(spec string) (time.Duration, error) {
+	h, m, ok := strings.Cut(spec, ":")
+	hours, herr := strconv.Atoi(h)
+	minutes, merr := strconv.Atoi(m)
+	if !ok || herr != nil || merr != nil || hours < 0 || minutes < 0 || minutes > 59 ||
+		hours > 24 || hours == 24 && minutes != 0 {
+		return 0, fmt.Errorf("invalid time %q, expected hh:mm", spec)
+	}
+	return time.Duration(hours)*time.Hour + time.Duration(minutes)*time.Minute, nil
+}
+
+// timePolicyHandler blocks the domains of its policies outside their
+// schedules. Within a schedule, queries fall through to the next handler.
+type timePolicyHandler struct {
+	policies []TimePolicy
+	// now returns the current time, overridden in tests.
+	now func() time.Time
+}
+
+func (h *timePolicyHandler) String() string {
+	return fmt.Sprintf("TimePolicyHandler (%d policies)", len(h.policies))
+}
+
+func (h *timePolicyHandler) ID() types.HandlerID {
+	return "time-policy"
+}
+
+func (h *timePolicyHandler) MatchSubdomains() bool {
+	return true
+}
+
+func (h *timePolicyHandler) Stop() {
+	// nothing to release
+}
+
+// match returns the policy with the most specific domain matching qname,
+// the first listed one if several are equally specific.
+func (h *timePolicyHandler) match(qname string) *TimePolicy {
+	var best *TimePolicy
+	bestLen := -1
+	for i := range h.policies {
+		for _, d := range h.policies[i].Domains {
+			if (qname == d || strings.HasSuffix(qname, "."+d)) && len(d) > bestLen {
+				best, bestLen = &h.policies[i], len(d)
+			}
+		}
+	}
+	return best
+}
+
+func (h *timePolicyHandler) ServeDNS(w dns.ResponseWriter, req *dns.Msg) {
+	if len(req.Question) == 0 {
+		return
+	}
+	q := req.Question[0]
+
+	policy := h.match(strings.ToLower(q.Name))
+	if policy == nil || policy.Allows(h.now()) {
+		resp := new(dns.Msg)
+		resp.SetRcode(req, dns.RcodeNameError)
+		resp.MsgHdr.Zero = true
+		_ = w.WriteMsg(resp)
+		return
+	}
+
+	resp := new(dns.Msg)
+	hdr := dns.RR_Header{Name: q.Name, Class: dns.ClassINET, Ttl: timePolicyTTL}
+	switch {
+	case !policy.Redirect.IsValid():
+		resp.SetRcode(req, dns.RcodeNameError)
+	case q.Qtype == dns.TypeA && policy.Redirect.Is4():
+		resp.SetReply(req)
+		hdr.Rrtype = dns.TypeA
+		resp.Answer = append(resp.Answer, &dns.A{Hdr: hdr, A: policy.Redirect.AsSlice()})
+	case q.Qtype == dns.TypeAAAA && policy.Redirect.Is6():
+		resp.SetReply(req)
+		hdr.Rrtype = dns.TypeAAAA
+		resp.Answer = append(resp.Answer, &dns.AAAA{Hdr: hdr, AAAA: policy.Redirect.AsSlice()})
+	default:
+		resp.SetReply(req)
+	}
+	resutil.SetMeta(w, "time_policy", "blocked")
+	if err := w.WriteMsg(resp); err != nil {
+		log.Errorf("failed to write time policy response for %s: %v", q.Name, err)
+	}
+}
+
+// enableTimePolicies blocks the domains of policies outside their
+// schedules. It is registered above every handler answering client
+// queries, local zones and DNS routes included, and below the management
+// cache only, so the client keeps reaching management at any time.
+func (s *DefaultServer) enableTimePolicies(policies []TimePolicy) {
+	policies = slices.Clone(policies)
+	var patterns []string
+	for i, policy := range policies {
+		domains := make([]string, 0, len(policy.Domains))
+		for _, d := range policy.Domains {
+			d = strings.ToLower(dns.Fqdn(d))
+			domains = append(domains, d)
+			if !slices.Contains(patterns, d) {
+				patterns = append(patterns, d)
+			}
+		}
+		policies[i].Domains = domains
+	}
+	if len(patterns) == 0 {
+		return
+	}
+
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	s.registerHandler(patterns, &timePolicyHandler{policies: policies, now: time.Now}, PriorityTimePolicy)
+	log.Debugf("restricting %v to their DNS time policy schedules", patterns)
+}
@@ -0,0 +1,144 @@
+package dns
+
+import (
+	"net/netip"
+	"testing"
+	"time"
+
+	"github.com/miekg/dns"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/netbirdio/netbird/client/internal/dns/test"
+)
+
+func TestTimePolicy_Allows(t *testing.T) {
+	berlin, err := time.LoadLocation("Europe/Berlin")
+	require.NoError(t, err)
+
+	office := TimePolicy{
+		Days:     []time.Weekday{time.Monday, time.Tuesday, time.Wednesday, time.Thursday, time.Friday},
+		Start:    8 * time.Hour,
+		End:      18 * time.Hour,
+		Location: berlin,
+	}
+	night := TimePolicy{
+		Days:  []time.Weekday{time.Friday},
+		Start: 22 * time.Hour,
+		End:   6 * time.Hour,
+	}
+
+	tests := []struct {
+		name   string
+		policy TimePolicy
+		at     time.Time
+		want   bool
+	}{
+		{"before opening", office, time.Date(2026, 3, 2, 7, 59, 59, 0, berlin), false},
+		{"at opening", office, time.Date(2026, 3, 2, 8, 0, 0, 0, berlin), true},
+		{"before closing", office, time.Date(2026, 3, 2, 17, 59, 59, 0, berlin), true},
+		{"at closing", office, time.Date(2026, 3, 2, 18, 0, 0, 0, berlin), false},
+		{"closed day", office, time.Date(2026, 3, 7, 12, 0, 0, 0, berlin), false},
+		// 07:30 UTC is 08:30 in Berlin in winter and 09:30 in summer.
+		{"timezone winter", office, time.Date(2026, 3, 2, 6, 30, 0, 0, time.UTC), false},
+		{"timezone converted", office, time.Date(2026, 3, 2, 7, 30, 0, 0, time.UTC), true},
+		{"timezone summer", office, time.Date(2026, 7, 6, 6, 30, 0, 0, time.UTC), true},
+		{"timezone day change", office, time.Date(2026, 3, 1, 23, 30, 0, 0, time.UTC), false},
+		{"overnight opening day", night, time.Date(2026, 3, 6, 22, 0, 0, 0, time.UTC), true},
+		{"overnight after midnight", night, time.Date(2026, 3, 7, 5, 59, 0, 0, time.UTC), true},
+		{"overnight closing", night, time.Date(2026, 3, 7, 6, 0, 0, 0, time.UTC), false},
+		{"overnight next evening", night, time.Date(2026, 3, 7, 22, 0, 0, 0, time.UTC), false},
+		{"overnight early opening day", night, time.Date(2026, 3, 6, 5, 0, 0, 0, time.UTC), false},
+		{"every day", TimePolicy{Start: 0, End: 24 * time.Hour}, time.Date(2026, 3, 7, 23, 59, 59, 0, time.UTC), true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, tt.policy.Allows(tt.at))
+		})
+	}
+}
+
+func TestParseTimePolicies(t *testing.T) {
+	policies := ParseTimePolicies([]string{
+		"HR.example.com,wiki.example.com mon-fri 08:00-18:00 Europe/Berlin",
+		"ops.example.com fri-mon,wed 22:00-24:00 10.0.0.1",
+		"lab.example.com * 20:00-06:00 UTC ::ffff:10.0.0.2",
+		"missing.example.com mon-fri",
+		"bad-day.example.com mon-xyz 08:00-18:00",
+		"bad-window.example.com * 08:00-08:00",
+		"bad-time.example.com * 8-18",
+		"bad-zone.example.com * 08:00-18:00 Nowhere/City",
+		"zone-last.example.com * 08:00-18:00 10.0.0.1 UTC",
+	})
+	require.Len(t, policies, 3)
+
+	assert.Equal(t, []string{"hr.example.com.", "wiki.example.com."}, policies[0].Domains)
+	assert.Equal(t, []time.Weekday{time.Monday, time.Tuesday, time.Wednesday, time.Thursday, time.Friday}, policies[0].Days)
+	assert.Equal(t, 8*time.Hour, policies[0].Start)
+	assert.Equal(t, 18*time.Hour, policies[0].End)
+	assert.Equal(t, "Europe/Berlin", policies[0].Location.String())
+
+	assert.Equal(t, []time.Weekday{time.Friday, time.Saturday, time.Sunday, time.Monday, time.Wednesday}, policies[1].Days)
+	assert.Equal(t, 24*time.Hour, policies[1].End)
+	assert.Nil(t, policies[1].Location)
+	assert.Equal(t, netip.MustParseAddr("10.0.0.1"), policies[1].Redirect)
+
+	assert.Nil(t, policies[2].Days)
+	assert.Equal(t, netip.MustParseAddr("10.0.0.2"), policies[2].Redirect, "mapped addresses are unmapped")
+}
+
+func TestTimePolicy_ResolveBlockTransition(t *testing.T) {
+	server := newTestServer(nil)
+	server.enableTimePolicies([]TimePolicy{
+		{Domains: []string{"Example.com"}, Start: 8 * time.Hour, End: 18 * time.Hour},
+		{Domains: []string{"redirect.example.com"}, Start: 8 * time.Hour, End: 18 * time.Hour, Redirect: netip.MustParseAddr("10.0.0.1")},
+	})
+	server.handlerChain.AddHandler(".", dualStackUpstream, PriorityUpstream)
+	server.handlerChain.AddHandler("example.com.", dualStackUpstream, PriorityLocal)
+
+	var handler *timePolicyHandler
+	for _, h := range server.handlerChain.handlers {
+		if h.Priority == PriorityTimePolicy {
+			handler = h.Handler.(*timePolicyHandler)
+		}
+	}
+	require.NotNil(t, handler)
+	now := time.Date(2026, 3, 2, 17, 59, 0, 0, time.UTC)
+	handler.now = func() time.Time { return now }
+
+	query := func(name string, qtype uint16) *dns.Msg {
+		t.Helper()
+		w := &test.MockResponseWriter{}
+		server.handlerChain.ServeDNS(w, new(dns.Msg).SetQuestion(name, qtype))
+		resp := w.GetLastResponse()
+		require.NotNil(t, resp)
+		return resp
+	}
+
+	resp := query("app.example.com.", dns.TypeA)
+	assert.Equal(t, dns.RcodeSuccess, resp.Rcode, "within the schedule names resolve normally")
+	require.Len(t, resp.Answer, 1)
+	assert.Equal(t, "10.1.2.3", resp.Answer[0].(*dns.A).A.String())
+	assert.Len(t, query("other.test.", dns.TypeA).Answer, 1)
+
+	now = now.Add(time.Minute)
+
+	resp = query("app.example.com.", dns.TypeA)
+	assert.Equal(t, dns.RcodeNameError, resp.Rcode, "outside the schedule the higher priority local answer is blocked too")
+	assert.Empty(t, resp.Answer)
+	assert.Equal(t, dns.RcodeNameError, query("example.com.", dns.TypeMX).Rcode)
+	assert.Len(t, query("other.test.", dns.TypeA).Answer, 1, "names without a policy are unaffected")
+
+	resp = query("host.redirect.example.com.", dns.TypeA)
+	assert.Equal(t, dns.RcodeSuccess, resp.Rcode, "the most specific policy applies")
+	require.Len(t, resp.Answer, 1)
+	assert.Equal(t, "10.0.0.1", resp.Answer[0].(*dns.A).A.String())
+	assert.Equal(t, uint32(timePolicyTTL), resp.Answer[0].Header().Ttl)
+
+	resp = query("host.redirect.example.com.", dns.TypeAAAA)
+	assert.Equal(t, dns.RcodeSuccess, resp.Rcode)
+	assert.Empty(t, resp.Answer, "the other address type is NODATA")
+
+	now = now.Add(14 * time.Hour)
+	assert.Len(t, query("app.example.com.", dns.TypeA).Answer, 1, "names resolve again once the schedule opens")
+}
@@ -0,0 +1,74 @@
+package dns
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/miekg/dns"
+	log "github.com/sirupsen/logrus"
+
+	"github.com/netbirdio/netbird/client/internal/dns/resutil"
+	"github.com/netbirdio/netbird/client/internal/dns/types"
+	nbdns "github.com/netbirdio/netbird/dns"
+)
+
+// ParseUnmatchedAction returns the rcode answered for queries no other
+// handler answers: "refused", "nxdomain" or "servfail". An empty action
+// returns 0, leaving unmatched queries to the handler chain's default.
+func ParseUnmatchedAction(action string) (int, error) {
+	switch strings.ToLower(action) {
+	case "":
+		return 0, nil
+	case "refused":
+		return dns.RcodeRefused, nil
+	case "nxdomain":
+		return dns.RcodeNameError, nil
+	case "servfail":
+		return dns.RcodeServerFailure, nil
+	default:
+		return 0, fmt.Errorf("unknown unmatched query action %q", action)
+	}
+}
+
+// unmatchedResolver is a catch-all answering every query that reaches it
+// with a fixed rcode, so unmatched queries fail fast instead of depending on
+// whether a fallback is registered.
+type unmatchedResolver struct {
+	rcode int
+}
+
+func (u *unmatchedResolver) String() string {
+	return fmt.Sprintf("UnmatchedResolver (%s)", dns.RcodeToString[u.rcode])
+}
+
+func (u *unmatchedResolver) ID() types.HandlerID {
+	return "unmatched"
+}
+
+func (u *unmatchedResolver) Stop() {
+	// nothing to release
+}
+
+func (u *unmatchedResolver) ServeDNS(w dns.ResponseWriter, r *dns.Msg) {
+	if len(r.Question) == 0 {
+		return
+	}
+
+	resp := new(dns.Msg)
+	resp.SetRcode(r, u.rcode)
+	if u.rcode == dns.RcodeRefused {
+		resutil.SetEDE(resp, r, dns.ExtendedErrorCodeNotAuthoritative)
+	}
+	resutil.SetMeta(w, "unmatched", "true")
+	if err := w.WriteMsg(resp); err != nil {
+		log.Errorf("failed to write unmatched response for %s: %v", r.Question[0].Name, err)
+	}
+}
+
+// enableUnmatchedAction registers the catch-all answering unmatched queries
+// with rcode, below every other handler including the fallback.
+func (s *DefaultServer) enableUnmatchedAction(rcode int) {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	s.registerHandler([]string{nbdns.RootZone}, &unmatchedResolver{rcode: rcode}, PriorityUnmatched)
+}
@@ -0,0 +1,79 @@
+package dns
+
+import (
+	"testing"
+
+	"github.com/miekg/dns"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/netbirdio/netbird/client/internal/dns/test"
+)
+
+func TestParseUnmatchedAction(t *testing.T) {
+	for action, want := range map[string]int{
+		"":         0,
+		"refused":  dns.RcodeRefused,
+		"NXDOMAIN": dns.RcodeNameError,
+		"servfail": dns.RcodeServerFailure,
+	} {
+		rcode, err := ParseUnmatchedAction(action)
+		require.NoError(t, err, action)
+		assert.Equal(t, want, rcode, action)
+	}
+
+	_, err := ParseUnmatchedAction("drop")
+	assert.Error(t, err)
+}
+
+func TestDefaultServer_UnmatchedAction(t *testing.T) {
+	tests := []struct {
+		action string
+		rcode  int
+	}{
+		{action: "refused", rcode: dns.RcodeRefused},
+		{action: "nxdomain", rcode: dns.RcodeNameError},
+		{action: "servfail", rcode: dns.RcodeServerFailure},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.action, func(t *testing.T) {
+			rcode, err := ParseUnmatchedAction(tc.action)
+			require.NoError(t, err)
+
+			server := newTestServer(nil)
+			server.enableUnmatchedAction(rcode)
+
+			// A handler passing the query on must end at the catch-all as well.
+			server.registerHandler([]string{"corp.example."}, dns.HandlerFunc(func(w dns.ResponseWriter, r *dns.Msg) {
+				resp := new(dns.Msg)
+				resp.SetRcode(r, dns.RcodeNameError)
+				resp.MsgHdr.Zero = true
+				_ = w.WriteMsg(resp)
+			}), PriorityUpstream)
+
+			for _, name := range []string{"unmatched.example.", "host.corp.example."} {
+				w := &test.MockResponseWriter{}
+				server.handlerChain.ServeDNS(w, new(dns.Msg).SetQuestion(name, dns.TypeA))
+				resp := w.GetLastResponse()
+				require.NotNil(t, resp, name)
+				assert.Equal(t, tc.rcode, resp.Rcode, name)
+				assert.False(t, resp.MsgHdr.Zero, name)
+			}
+		})
+	}
+}
+
+func TestDefaultServer_UnmatchedActionBelowFallback(t *testing.T) {
+	server := newTestServer(nil)
+	server.enableUnmatchedAction(dns.RcodeServerFailure)
+	server.registerHandler([]string{"."}, dns.HandlerFunc(func(w dns.ResponseWriter, r *dns.Msg) {
+		_ = w.WriteMsg(new(dns.Msg).SetReply(r))
+	}), PriorityFallback)
+
+	w := &test.MockResponseWriter{}
+	server.handlerChain.ServeDNS(w, new(dns.Msg).SetQuestion("example.com.", dns.TypeA))
+	resp := w.GetLastResponse()
+	require.NotNil(t, resp)
+	assert.Equal(t, dns.RcodeSuccess, resp.Rcode, "the fallback must answer before the catch-all")
+}
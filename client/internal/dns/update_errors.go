@@ -0,0 +1,62 @@
+package dns
+
+import (
+	"errors"
+	"fmt"
+)
+
+// ErrStaleSerial is returned by UpdateDNSServer for a network update older
+// than the last applied or pending one. Retrying it is pointless, a newer
+// update already superseded it.
+var ErrStaleSerial = errors.New("stale network update serial")
+
+// LocalHandlerError is the error of building the local resolver handlers,
+// for the custom zones, of a network update. The update isn't applied.
+type LocalHandlerError struct {
+	Err error
+}
+
+func (e *LocalHandlerError) Error() string {
+	return fmt.Sprintf("local handler updater: %v", e.Err)
+}
+
+func (e *LocalHandlerError) Unwrap() error {
+	return e.Err
+}
+
+// UpstreamHandlerError is the error of building the upstream handlers, for
+// the nameserver groups, of a network update. The update isn't applied.
+type UpstreamHandlerError struct {
+	Err error
+}
+
+func (e *UpstreamHandlerError) Error() string {
+	return fmt.Sprintf("upstream handler updater: %v", e.Err)
+}
+
+func (e *UpstreamHandlerError) Unwrap() error {
+	return e.Err
+}
+
+// HostConfigError is the error of applying the DNS config of a network
+// update to the host. The handlers of the update are in place, but the host
+// may not resolve through them. The next update applies the host config
+// again, even if it is unchanged.
+type HostConfigError struct {
+	Err error
+}
+
+func (e *HostConfigError) Error() string {
+	return fmt.Sprintf("apply host config: %v", e.Err)
+}
+
+func (e *HostConfigError) Unwrap() error {
+	return e.Err
+}
+
+// onlyHostConfigFailed reports whether err of applyConfiguration only is the
+// failure to apply the host config, so the update itself is in place.
+func onlyHostConfigFailed(err error) bool {
+	var hostErr *HostConfigError
+	return errors.As(err, &hostErr)
+}
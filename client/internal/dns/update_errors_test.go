@@ -0,0 +1,60 @@
+package dns
+
+import (
+	"errors"
+	"net/netip"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/netbirdio/netbird/client/internal/statemanager"
+	nbdns "github.com/netbirdio/netbird/dns"
+)
+
+func TestDefaultServer_UpdateDNSServerErrors(t *testing.T) {
+	applyErr := errors.New("dbus unavailable")
+	applied := 0
+	server := newTestServer(&mockHostConfigurator{
+		applyDNSConfigFunc: func(HostDNSConfig, *statemanager.Manager) error {
+			applied++
+			return applyErr
+		},
+		restoreHostDNSFunc: func() error { return nil },
+	})
+
+	update := nbdns.Config{ServiceEnable: true}
+	err := server.UpdateDNSServer(2, update)
+	var hostErr *HostConfigError
+	require.ErrorAs(t, err, &hostErr)
+	assert.ErrorIs(t, err, applyErr)
+	assert.Equal(t, uint64(2), server.updateSerial, "the update is in place despite the host config")
+
+	require.ErrorAs(t, server.UpdateDNSServer(3, update), &hostErr)
+	assert.Equal(t, 2, applied, "an unchanged update retries the host config")
+
+	applyErr = nil
+	require.NoError(t, server.UpdateDNSServer(4, update))
+
+	err = server.UpdateDNSServer(1, update)
+	assert.ErrorIs(t, err, ErrStaleSerial)
+
+	err = server.UpdateDNSServer(5, nbdns.Config{
+		ServiceEnable: true,
+		NameServerGroups: []*nbdns.NameServerGroup{{
+			NameServers: []nbdns.NameServer{{IP: netip.MustParseAddr("100.64.0.1"), NSType: nbdns.UDPNameServerType, Port: 53}},
+		}},
+	})
+	var upstreamErr *UpstreamHandlerError
+	require.ErrorAs(t, err, &upstreamErr)
+	assert.NotErrorIs(t, err, ErrStaleSerial)
+	assert.Equal(t, uint64(4), server.updateSerial, "a failed update isn't recorded")
+}
+
+func TestDefaultServer_UpdateDNSServerStalePending(t *testing.T) {
+	server := newTestServer(nil)
+	server.Freeze()
+
+	require.NoError(t, server.UpdateDNSServer(3, nbdns.Config{ServiceEnable: true}))
+	assert.ErrorIs(t, server.UpdateDNSServer(2, nbdns.Config{ServiceEnable: true}), ErrStaleSerial)
+}
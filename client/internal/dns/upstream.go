@@ -19,6 +19,10 @@
 // goroutine per race and returns the first valid answer, cancelling the
 // rest. A handler with a single race skips the fan-out.
 //
+// Each race may carry an in-flight limit shared with the other handlers of
+// its nameserver group. A race whose group is saturated is skipped after a
+// short wait; a query only saturated groups could answer gets REFUSED.
+//
 // # Health projection
 //
 // Query outcomes are recorded per-upstream in UpstreamHealth. The server
@@ -40,6 +44,7 @@ import (
 	"slices"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/miekg/dns"
@@ -143,6 +148,8 @@ type UpstreamHealth struct {
 	LastOk   time.Time
 	LastFail time.Time
 	LastErr  string
+	// ConsecutiveFails counts the failures since the last success.
+	ConsecutiveFails int
 }
 
 type upstreamResolverBase struct {
@@ -150,11 +157,72 @@ type upstreamResolverBase struct {
 	cancel          context.CancelFunc
 	upstreamClient  upstreamClient
 	upstreamServers []upstreamRace
+	// raceLimits holds the in-flight limiter of each race, nil entries or a
+	// short slice meaning unlimited. Written only while the handler is built.
+	raceLimits []*inflightLimiter
+	// racePolicies holds the selection policy of each race, a short slice
+	// meaning failover. Written only while the handler is built.
+	racePolicies []SelectionPolicy
+	// raceTurns counts the queries of each SelectionRoundRobin race to pick
+	// the upstream the next one starts at. Written only while the handler
+	// is built.
+	raceTurns       []*atomic.Uint32
 	domain          domain.Domain
 	upstreamTimeout time.Duration
+	// nonRecursive holds authoritative-only upstreams that get queries with
+	// RD cleared. Written only while the handler is built.
+	nonRecursive map[netip.AddrPort]struct{}
+	// doqServers holds upstreams queried over DNS over QUIC through doq
+	// instead of upstreamClient. Written only while the handler is built.
+	doqServers map[netip.AddrPort]struct{}
+	doq        *doqClient
+	// dotServers holds upstreams queried over DNS over TLS through dot
+	// instead of upstreamClient. Written only while the handler is built.
+	dotServers map[netip.AddrPort]struct{}
+	dot        *dotClient
+	// queryTimeouts holds the timeouts of upstreams whose groups configure
+	// one, see setQueryTimeout. Written only while the handler is built.
+	queryTimeouts map[netip.AddrPort]time.Duration
+	// tcpServers holds upstreams that are queried over TCP only, skipping
+	// the UDP attempt. Written only while the handler is built.
+	tcpServers map[netip.AddrPort]struct{}
+	// ednsAllowlists holds the EDNS0 options let through to and from each
+	// upstream, see setEDNSAllowlist. Written only while the handler is built.
+	ednsAllowlists map[netip.AddrPort]EDNSAllowlist
+	// clientSubnets holds the client subnet policies of the upstreams whose
+	// groups opted in, see setClientSubnet. Upstreams without one get no
+	// client subnet. Written only while the handler is built.
+	clientSubnets map[netip.AddrPort]clientSubnetPolicy
+	// connPool keeps idle TCP connections to the upstreams for reuse, nil
+	// when pooling is disabled. See setConnPool.
+	connPool *connPool
+	// cache, if set, answers repeated questions until their TTL expires.
+	// noCache holds the upstreams whose answers it doesn't keep. Both are
+	// written only while the handler is built.
+	cache   *responseCache
+	noCache map[netip.AddrPort]struct{}
+	// metrics, when non-nil, records upstream latencies and cache lookups.
+	metrics *dnsMetrics
+	// reverseCache, if set, remembers the address answers for PTR lookups.
+	// Only set on handlers of nameserver groups with match domains.
+	reverseCache *reverseCache
+	// holdDown is how long an upstream that failed a question is skipped
+	// for it, see setServfailHoldDown. Zero disables the hold-down.
+	holdDown   time.Duration
+	holdDownMu sync.Mutex
+	holdDowns  map[holdDownKey]*holdDownEntry
+	// privateReverse restricts the upstreams queries for private reverse
+	// zones go to, see setPrivateReverse.
+	privateReverse PrivateReverseMode
+	// groupsDown, if set, answers queries while all nameserver groups of
+	// the handler are deactivated, see setGroupsDownPolicy.
+	groupsDown *groupsDownState
 
 	healthMu sync.RWMutex
 	health   map[netip.AddrPort]*UpstreamHealth
+	// history, shared with the server's other handlers, keeps the recent
+	// outcomes of each upstream, see setUpstreamHistory.
+	history *upstreamHistory
 
 	statusRecorder *peer.Status
 	// selectedRoutes returns the current set of client routes the admin
@@ -163,9 +231,18 @@ type upstreamResolverBase struct {
 	selectedRoutes func() route.HAMap
 }
 
+// failureReasonCanceled marks attempts aborted by the caller, e.g. race
+// losers; they say nothing about the upstream.
+const failureReasonCanceled = "canceled"
+
 type upstreamFailure struct {
 	upstream netip.AddrPort
 	reason   string
+	// network is set when the upstream couldn't be reached at all, as
+	// opposed to answering with a failure rcode.
+	network bool
+	// timeout is set for network failures caused by a timeout.
+	timeout bool
 }
 
 type raceResult struct {
@@ -228,17 +305,36 @@ func (u *upstreamResolverBase) String() string {
 // ID returns the unique handler ID. Race groupings and within-race
 // ordering are both part of the identity: [[A,B]] and [[A],[B]] query
 // the same servers but with different semantics (serial fallback vs
-// parallel race), so their handlers must not collide.
+// parallel race), so their handlers must not collide. The same holds for
+// the selection policy of each race.
 func (u *upstreamResolverBase) ID() types.HandlerID {
 	hash := sha256.New()
 	hash.Write([]byte(u.domain.PunycodeString() + ":"))
-	for _, race := range u.upstreamServers {
+	for i, race := range u.upstreamServers {
 		hash.Write([]byte("["))
 		for _, s := range race {
 			hash.Write([]byte(s.String()))
+			if _, ok := u.doqServers[s]; ok {
+				hash.Write([]byte("/" + protoDoQ))
+			}
+			if _, ok := u.dotServers[s]; ok {
+				hash.Write([]byte("/" + protoDoT))
+			}
+			if _, ok := u.tcpServers[s]; ok {
+				hash.Write([]byte("/" + protoTCP))
+			}
+			if timeout, ok := u.queryTimeouts[s]; ok {
+				hash.Write([]byte("/" + timeout.String()))
+			}
+			if _, ok := u.nonRecursive[s]; ok {
+				hash.Write([]byte("/norec"))
+			}
 			hash.Write([]byte("|"))
 		}
 		hash.Write([]byte("]"))
+		if policy := u.racePolicy(i); policy != SelectionFailover {
+			hash.Write([]byte(policy.String()))
+		}
 	}
 	return types.HandlerID("upstream-" + hex.EncodeToString(hash.Sum(nil)[:8]))
 }
@@ -250,6 +346,10 @@ func (u *upstreamResolverBase) MatchSubdomains() bool {
 func (u *upstreamResolverBase) Stop() {
 	log.Debugf("stopping serving DNS for upstreams %s", u.flatUpstreams())
 	u.cancel()
+	if u.doq != nil {
+		u.doq.close()
+	}
+	u.connPool.close()
 }
 
 // flatUpstreams is for logging and ID hashing only, not for dispatch.
@@ -269,10 +369,106 @@ func (u *upstreamResolverBase) setSelectedRoutes(selected func() route.HAMap) {
 }
 
 func (u *upstreamResolverBase) addRace(servers []netip.AddrPort) {
+	u.addLimitedRace(servers, nil)
+}
+
+// addLimitedRace adds a race whose queries in flight are bounded by limiter.
+func (u *upstreamResolverBase) addLimitedRace(servers []netip.AddrPort, limiter *inflightLimiter) {
 	if len(servers) == 0 {
 		return
 	}
 	u.upstreamServers = append(u.upstreamServers, slices.Clone(servers))
+	if limiter != nil {
+		u.raceLimits = append(u.raceLimits, make([]*inflightLimiter, len(u.upstreamServers)-1-len(u.raceLimits))...)
+		u.raceLimits = append(u.raceLimits, limiter)
+	}
+}
+
+// raceLimiter returns the in-flight limiter of the i-th race, nil if it
+// isn't limited.
+func (u *upstreamResolverBase) raceLimiter(i int) *inflightLimiter {
+	if i < len(u.raceLimits) {
+		return u.raceLimits[i]
+	}
+	return nil
+}
+
+// setNonRecursive marks servers as authoritative-only: queries forwarded to
+// them have the recursion-desired flag cleared. Referrals are not followed.
+func (u *upstreamResolverBase) setNonRecursive(servers []netip.AddrPort) {
+	if u.nonRecursive == nil {
+		u.nonRecursive = make(map[netip.AddrPort]struct{}, len(servers))
+	}
+	for _, s := range servers {
+		u.nonRecursive[s] = struct{}{}
+	}
+}
+
+// setDoQ marks servers to be queried over DNS over QUIC. Connections are
+// opened on first use and reused across queries.
+func (u *upstreamResolverBase) setDoQ(servers []netip.AddrPort) {
+	if u.doqServers == nil {
+		u.doqServers = make(map[netip.AddrPort]struct{}, len(servers))
+	}
+	if u.doq == nil {
+		u.doq = newDoQClient()
+	}
+	for _, s := range servers {
+		u.doqServers[s] = struct{}{}
+	}
+}
+
+// setDoT marks servers to be queried over DNS over TLS. Connections are
+// opened on first use and kept in the connection pool. The certificates of
+// servers with a hostname in serverNames are verified against it.
+func (u *upstreamResolverBase) setDoT(servers []netip.AddrPort, serverNames map[netip.AddrPort]string) {
+	if u.dotServers == nil {
+		u.dotServers = make(map[netip.AddrPort]struct{}, len(servers))
+	}
+	if u.dot == nil {
+		u.dot = newDoTClient(u.connPool)
+	}
+	for _, s := range servers {
+		u.dotServers[s] = struct{}{}
+		if name := serverNames[s]; name != "" {
+			if u.dot.serverNames == nil {
+				u.dot.serverNames = make(map[netip.AddrPort]string)
+			}
+			u.dot.serverNames[s] = name
+		}
+	}
+}
+
+// setTCP marks servers to be queried over TCP only, for upstreams that
+// refuse UDP. Other servers still retry truncated UDP replies over TCP.
+func (u *upstreamResolverBase) setTCP(servers []netip.AddrPort) {
+	if u.tcpServers == nil {
+		u.tcpServers = make(map[netip.AddrPort]struct{}, len(servers))
+	}
+	for _, s := range servers {
+		u.tcpServers[s] = struct{}{}
+	}
+}
+
+// setConnPool makes TCP queries reuse idle connections, keeping up to size
+// per upstream for idleTimeout. Zero values use the defaults, a negative size
+// disables pooling. Called only while the handler is built.
+func (u *upstreamResolverBase) setConnPool(size int, idleTimeout time.Duration) {
+	u.connPool = newConnPool(size, idleTimeout)
+	if u.dot != nil {
+		u.dot.pool = u.connPool
+	}
+}
+
+// clientFor returns the client used to query upstream.
+func (u *upstreamResolverBase) clientFor(upstream netip.AddrPort) upstreamClient {
+	if _, ok := u.doqServers[upstream]; ok {
+		return u.doq
+	}
+	if _, ok := u.dotServers[upstream]; ok {
+		return u.dot
+	}
+	return u.upstreamClient
 }
 
 // ServeDNS handles a DNS request
@@ -289,6 +485,22 @@ func (u *upstreamResolverBase) ServeDNS(w dns.ResponseWriter, r *dns.Msg) {
 		return
 	}
 
+	if u.passesPrivateReverse(r) {
+		resp := new(dns.Msg)
+		resp.SetRcode(r, dns.RcodeNameError)
+		resp.MsgHdr.Zero = true
+		_ = w.WriteMsg(resp)
+		return
+	}
+
+	if u.answerFromCache(w, r, logger) {
+		return
+	}
+
+	if u.answerGroupsDown(w, r, logger) {
+		return
+	}
+
 	// Propagate inbound protocol so upstream exchange can use TCP directly
 	// when the request came in over TCP.
 	ctx := u.ctx
@@ -299,11 +511,16 @@ func (u *upstreamResolverBase) ServeDNS(w dns.ResponseWriter, r *dns.Msg) {
 	}
 
 	ok, failures := u.tryUpstreamServers(ctx, w, r, logger)
-	if len(failures) > 0 {
+	if !ok && allHeldDown(failures) {
+		// Retries during an outage are expected; the first failure was logged.
+		logger.Tracef("upstreams held down for domain=%s", r.Question[0].Name)
+	} else if !ok && allInflightLimited(failures) {
+		logger.Debugf("nameserver groups at their in-flight limit for domain=%s", r.Question[0].Name)
+	} else if len(failures) > 0 {
 		u.logUpstreamFailures(r.Question[0].Name, failures, ok, logger)
 	}
 	if !ok {
-		u.writeErrorResponse(w, r, logger)
+		u.writeErrorResponse(w, r, failures, logger)
 	}
 }
 
@@ -319,21 +536,21 @@ func (u *upstreamResolverBase) tryUpstreamServers(ctx context.Context, w dns.Res
 	case 0:
 		return false, nil
 	case 1:
-		return u.tryOnlyRace(ctx, w, r, groups[0], logger)
+		return u.tryOnlyRace(ctx, w, r, u.raceOrder(0, groups[0]), u.raceLimiter(0), u.racePolicy(0), logger)
 	default:
 		return u.raceAll(ctx, w, r, groups, logger)
 	}
 }
 
-func (u *upstreamResolverBase) tryOnlyRace(ctx context.Context, w dns.ResponseWriter, r *dns.Msg, group upstreamRace, logger *log.Entry) (bool, []upstreamFailure) {
-	res := u.tryRace(ctx, r, group)
+func (u *upstreamResolverBase) tryOnlyRace(ctx context.Context, w dns.ResponseWriter, r *dns.Msg, group upstreamRace, limiter *inflightLimiter, policy SelectionPolicy, logger *log.Entry) (bool, []upstreamFailure) {
+	res := u.tryRace(ctx, r, group, limiter, policy)
 	if res.msg == nil {
 		return false, res.failures
 	}
 	if res.ede != "" {
 		resutil.SetMeta(w, "ede", res.ede)
 	}
-	u.writeSuccessResponse(w, res.msg, res.upstream, r.Question[0].Name, res.protocol, logger)
+	u.writeSuccessResponse(w, r, res.msg, res.upstream, res.protocol, logger)
 	return true, res.failures
 }
 
@@ -346,12 +563,12 @@ func (u *upstreamResolverBase) raceAll(ctx context.Context, w dns.ResponseWriter
 	// Buffer sized to len(groups) so workers never block on send, even
 	// after the coordinator has returned.
 	results := make(chan raceResult, len(groups))
-	for _, g := range groups {
+	for i, g := range groups {
 		// tryRace clones the request per attempt, so workers never share
 		// a *dns.Msg and concurrent EDNS0 mutations can't race.
-		go func(g upstreamRace) {
-			results <- u.tryRace(raceCtx, r, g)
-		}(g)
+		go func(g upstreamRace, limiter *inflightLimiter, policy SelectionPolicy) {
+			results <- u.tryRace(raceCtx, r, g, limiter, policy)
+		}(u.raceOrder(i, g), u.raceLimiter(i), u.racePolicy(i))
 	}
 
 	var failures []upstreamFailure
@@ -363,7 +580,7 @@ func (u *upstreamResolverBase) raceAll(ctx context.Context, w dns.ResponseWriter
 				if res.ede != "" {
 					resutil.SetMeta(w, "ede", res.ede)
 				}
-				u.writeSuccessResponse(w, res.msg, res.upstream, r.Question[0].Name, res.protocol, logger)
+				u.writeSuccessResponse(w, r, res.msg, res.upstream, res.protocol, logger)
 				return true, failures
 			}
 		case <-ctx.Done():
@@ -373,7 +590,23 @@ func (u *upstreamResolverBase) raceAll(ctx context.Context, w dns.ResponseWriter
 	return false, failures
 }
 
-func (u *upstreamResolverBase) tryRace(ctx context.Context, r *dns.Msg, group upstreamRace) raceResult {
+func (u *upstreamResolverBase) tryRace(ctx context.Context, r *dns.Msg, group upstreamRace, limiter *inflightLimiter, policy SelectionPolicy) raceResult {
+	if group = u.privateReverseRace(r, group); len(group) == 0 {
+		return raceResult{}
+	}
+	if !limiter.acquire(ctx) {
+		failures := make([]upstreamFailure, 0, len(group))
+		for _, upstream := range group {
+			failures = append(failures, upstreamFailure{upstream: upstream, reason: failureReasonInflightLimit})
+		}
+		return raceResult{failures: failures}
+	}
+	defer limiter.release()
+
+	if policy == SelectionQueryAll && len(group) > 1 {
+		return u.queryAll(ctx, r, group)
+	}
+
 	timeout := u.upstreamTimeout
 	if len(group) > 1 {
 		// Cap the whole walk at raceMaxTotalTimeout: per-upstream timeouts
@@ -387,16 +620,23 @@ func (u *upstreamResolverBase) tryRace(ctx context.Context, r *dns.Msg, group up
 	}
 
 	var failures []upstreamFailure
-	for _, upstream := range group {
+	for _, upstream := range u.history.order(group) {
 		if ctx.Err() != nil {
 			return raceResult{failures: failures}
 		}
+		if u.heldDown(r, upstream) {
+			failures = append(failures, upstreamFailure{upstream: upstream, reason: failureReasonHeldDown})
+			continue
+		}
 		// Clone the request per attempt: the exchange path mutates EDNS0
 		// options in-place, so reusing the same *dns.Msg across sequential
 		// upstreams would carry those mutations (e.g. a reduced UDP size)
 		// into the next attempt.
-		res, failure := u.queryUpstream(ctx, r.Copy(), upstream, timeout)
+		res, failure := u.queryUpstream(ctx, r.Copy(), upstream, u.timeoutFor(upstream, timeout))
 		if failure != nil {
+			if failure.reason != failureReasonCanceled {
+				u.recordFailure(r, upstream)
+			}
 			failures = append(failures, *failure)
 			continue
 		}
@@ -410,6 +650,11 @@ func (u *upstreamResolverBase) queryUpstream(parentCtx context.Context, r *dns.M
 	ctx, cancel := context.WithTimeout(parentCtx, timeout)
 	defer cancel()
 	ctx, upstreamProto := contextWithUpstreamProtocolResult(ctx)
+	if _, ok := u.tcpServers[upstream]; ok {
+		// The clients go straight to TCP for queries that came in over TCP,
+		// which covers every platform's dialer.
+		ctx = contextWithDNSProtocol(ctx, protoTCP)
+	}
 
 	// Advertise EDNS0 so the upstream may include Extended DNS Errors
 	// (RFC 8914) in failure responses; we use those to short-circuit
@@ -421,9 +666,15 @@ func (u *upstreamResolverBase) queryUpstream(parentCtx context.Context, r *dns.M
 	if !hadEdns {
 		r.SetEdns0(upstreamUDPSize(), false)
 	}
+	if _, ok := u.nonRecursive[upstream]; ok {
+		r.RecursionDesired = false
+	}
+	addedSubnet := u.clientSubnets[upstream].apply(r)
+	allow := u.ednsAllowlists[upstream]
+	allow.filter(r)
 
 	startTime := time.Now()
-	rm, _, err := u.upstreamClient.exchange(ctx, upstream.String(), r)
+	rm, _, err := u.clientFor(upstream).exchange(ctx, upstream.String(), r)
 
 	if err != nil {
 		// A parent cancellation (e.g., another race won and the coordinator
@@ -431,7 +682,7 @@ func (u *upstreamResolverBase) queryUpstream(parentCtx context.Context, r *dns.M
 		// error chain and the parent context: a transport may surface the
 		// cancellation as a read/deadline error rather than context.Canceled.
 		if errors.Is(err, context.Canceled) || errors.Is(parentCtx.Err(), context.Canceled) {
-			return raceResult{}, &upstreamFailure{upstream: upstream, reason: "canceled"}
+			return raceResult{}, &upstreamFailure{upstream: upstream, reason: failureReasonCanceled}
 		}
 		failure := u.handleUpstreamError(err, upstream, startTime)
 		u.markUpstreamFail(upstream, failure.reason)
@@ -440,11 +691,12 @@ func (u *upstreamResolverBase) queryUpstream(parentCtx context.Context, r *dns.M
 
 	if rm == nil || !rm.Response {
 		u.markUpstreamFail(upstream, "no response")
-		return raceResult{}, &upstreamFailure{upstream: upstream, reason: "no response"}
+		return raceResult{}, &upstreamFailure{upstream: upstream, reason: "no response", network: true}
 	}
 
 	// A valid response means the upstream is reachable, whatever the Rcode.
 	u.markUpstreamOk(upstream)
+	u.metrics.recordUpstreamLatency(u.domain.PunycodeString(), time.Since(startTime))
 
 	proto := ""
 	if upstreamProto != nil {
@@ -456,6 +708,10 @@ func (u *upstreamResolverBase) queryUpstream(parentCtx context.Context, r *dns.M
 		// refused zones, transient recursion errors), not reachability
 		// problems: fail over for a better answer but keep the upstream healthy.
 		if code, ok := nonRetryableEDE(rm); ok {
+			allow.filter(rm)
+			if addedSubnet {
+				stripClientSubnet(rm)
+			}
 			if !hadEdns {
 				resutil.StripOPT(rm)
 			}
@@ -465,6 +721,10 @@ func (u *upstreamResolverBase) queryUpstream(parentCtx context.Context, r *dns.M
 		return raceResult{}, &upstreamFailure{upstream: upstream, reason: reason}
 	}
 
+	allow.filter(rm)
+	if addedSubnet {
+		stripClientSubnet(rm)
+	}
 	if !hadEdns {
 		resutil.StripOPT(rm)
 	}
@@ -493,6 +753,8 @@ func (u *upstreamResolverBase) markUpstreamOk(addr netip.AddrPort) {
 	h.LastOk = time.Now()
 	h.LastFail = time.Time{}
 	h.LastErr = ""
+	h.ConsecutiveFails = 0
+	u.history.record(addr, true)
 }
 
 func (u *upstreamResolverBase) markUpstreamFail(addr netip.AddrPort, reason string) {
@@ -501,6 +763,8 @@ func (u *upstreamResolverBase) markUpstreamFail(addr netip.AddrPort, reason stri
 	h := u.healthEntry(addr)
 	h.LastFail = time.Now()
 	h.LastErr = reason
+	h.ConsecutiveFails++
+	u.history.record(addr, false)
 }
 
 // UpstreamHealth returns a snapshot of per-upstream query outcomes.
@@ -525,7 +789,7 @@ func upstreamUDPSize() uint16 {
 
 func (u *upstreamResolverBase) handleUpstreamError(err error, upstream netip.AddrPort, startTime time.Time) *upstreamFailure {
 	if !errors.Is(err, context.DeadlineExceeded) && !isTimeout(err) {
-		return &upstreamFailure{upstream: upstream, reason: err.Error()}
+		return &upstreamFailure{upstream: upstream, reason: err.Error(), network: true}
 	}
 
 	elapsed := time.Since(startTime)
@@ -533,7 +797,7 @@ func (u *upstreamResolverBase) handleUpstreamError(err error, upstream netip.Add
 	if peerInfo := u.debugUpstreamTimeout(upstream); peerInfo != "" {
 		reason += " " + peerInfo
 	}
-	return &upstreamFailure{upstream: upstream, reason: reason}
+	return &upstreamFailure{upstream: upstream, reason: reason, network: true, timeout: true}
 }
 
 func (u *upstreamResolverBase) debugUpstreamTimeout(upstream netip.AddrPort) string {
@@ -549,7 +813,7 @@ func (u *upstreamResolverBase) debugUpstreamTimeout(upstream netip.AddrPort) str
 	return fmt.Sprintf("(routes through NetBird peer %s)", FormatPeerStatus(peerInfo))
 }
 
-func (u *upstreamResolverBase) writeSuccessResponse(w dns.ResponseWriter, rm *dns.Msg, upstream netip.AddrPort, domain string, proto string, logger *log.Entry) {
+func (u *upstreamResolverBase) writeSuccessResponse(w dns.ResponseWriter, r, rm *dns.Msg, upstream netip.AddrPort, proto string, logger *log.Entry) {
 	resutil.SetMeta(w, "upstream", upstream.String())
 	if proto != "" {
 		resutil.SetMeta(w, "upstream_protocol", proto)
@@ -558,9 +822,18 @@ func (u *upstreamResolverBase) writeSuccessResponse(w dns.ResponseWriter, rm *dn
 	// Clear Zero bit from external responses to prevent upstream servers from
 	// manipulating our internal fallthrough signaling mechanism
 	rm.MsgHdr.Zero = false
+	// Forwarded answers aren't authoritative from the client's point of
+	// view, even when the upstream is authoritative for the zone.
+	rm.Authoritative = false
+
+	if u.reverseCache != nil {
+		u.reverseCache.record(u.domain.PunycodeString(), rm)
+	}
+	u.rememberAnswer(rm)
+	u.cacheAnswer(r, rm, upstream)
 
 	if err := w.WriteMsg(rm); err != nil {
-		logger.Errorf("failed to write DNS response for question domain=%s: %s", domain, err)
+		logger.Errorf("failed to write DNS response for question domain=%s: %s", r.Question[0].Name, err)
 	}
 }
 
@@ -576,9 +849,19 @@ func (u *upstreamResolverBase) logUpstreamFailures(domain string, failures []ups
 	}
 }
 
-func (u *upstreamResolverBase) writeErrorResponse(w dns.ResponseWriter, r *dns.Msg, logger *log.Entry) {
+func (u *upstreamResolverBase) writeErrorResponse(w dns.ResponseWriter, r *dns.Msg, failures []upstreamFailure, logger *log.Entry) {
 	m := new(dns.Msg)
-	m.SetRcode(r, dns.RcodeServerFailure)
+	if allInflightLimited(failures) {
+		// Saturated groups say nothing about the domain; REFUSED makes
+		// clients move on to another server instead of failing the name.
+		m.SetRcode(r, dns.RcodeRefused)
+	} else {
+		m.SetRcode(r, dns.RcodeServerFailure)
+		if code, ok := failureEDE(failures); ok {
+			resutil.SetEDE(m, r, code)
+			resutil.SetMeta(w, "ede", edeName(code))
+		}
+	}
 	if err := w.WriteMsg(m); err != nil {
 		logger.Errorf("write error response for domain=%s: %s", r.Question[0].Name, err)
 	}
@@ -592,6 +875,38 @@ func formatFailures(failures []upstreamFailure) string {
 	return strings.Join(parts, ", ")
 }
 
+// failureEDE picks the EDE code explaining why no upstream answered: cached
+// error when every upstream is held down, no reachable authority when every
+// upstream timed out, network error when at least one couldn't be reached.
+// Failures where an upstream did answer (e.g. with SERVFAIL) carry no code of
+// our own.
+func failureEDE(failures []upstreamFailure) (uint16, bool) {
+	if allHeldDown(failures) {
+		return dns.ExtendedErrorCodeCachedError, true
+	}
+	var network, timeouts, considered int
+	for _, f := range failures {
+		if f.reason == failureReasonCanceled {
+			continue
+		}
+		considered++
+		if f.network {
+			network++
+		}
+		if f.timeout {
+			timeouts++
+		}
+	}
+	switch {
+	case considered == 0 || network == 0:
+		return 0, false
+	case timeouts == considered:
+		return dns.ExtendedErrorCodeNoReachableAuthority, true
+	default:
+		return dns.ExtendedErrorCodeNetworkError, true
+	}
+}
+
 // nonRetryableEDE returns the first non-retryable EDE code carried in the
 // response, if any.
 func nonRetryableEDE(rm *dns.Msg) (uint16, bool) {
@@ -643,9 +958,15 @@ func clientUDPMaxSize(r *dns.Msg) int {
 // It first tries to use UDP, and if it is truncated, it falls back to TCP.
 // If the inbound request came over TCP (via context), it skips the UDP attempt.
 func ExchangeWithFallback(ctx context.Context, client *dns.Client, r *dns.Msg, upstream string) (*dns.Msg, time.Duration, error) {
+	return exchangeWithFallback(ctx, client, nil, r, upstream)
+}
+
+// exchangeWithFallback is ExchangeWithFallback sending TCP queries on
+// connections from pool, which may be nil.
+func exchangeWithFallback(ctx context.Context, client *dns.Client, pool *connPool, r *dns.Msg, upstream string) (*dns.Msg, time.Duration, error) {
 	// If the request came in over TCP, go straight to TCP upstream.
 	if dnsProtocolFromContext(ctx) == protoTCP {
-		rm, t, err := toTCPClient(client).ExchangeContext(ctx, r, upstream)
+		rm, t, err := pool.exchange(ctx, toTCPClient(client), r, upstream)
 		if err != nil {
 			return nil, t, fmt.Errorf("with tcp: %w", err)
 		}
@@ -679,7 +1000,7 @@ func ExchangeWithFallback(ctx context.Context, client *dns.Client, r *dns.Msg, u
 	// data than the client's buffer, we could truncate locally and skip
 	// the TCP retry.
 
-	rm, t, err = toTCPClient(client).ExchangeContext(ctx, r, upstream)
+	rm, t, err = pool.exchange(ctx, toTCPClient(client), r, upstream)
 	if err != nil {
 		return nil, t, fmt.Errorf("with tcp: %w", err)
 	}
@@ -87,6 +87,18 @@ func (u *upstreamResolver) isLocalResolver(upstream string) bool {
 	return false
 }
 
+// doqSupported reports whether DNS over QUIC upstreams can be used. The QUIC
+// dial would bypass the VPN socket protection done in exchangeWithoutVPN.
+func doqSupported() bool {
+	return false
+}
+
+// dotSupported reports whether DNS over TLS upstreams can be used. The TLS
+// dial would bypass the VPN socket protection as well.
+func dotSupported() bool {
+	return false
+}
+
 func GetClientPrivate(_ privateClientIface, _ netip.Addr, dialTimeout time.Duration) (*dns.Client, error) {
 	return &dns.Client{
 		Timeout: dialTimeout,
@@ -0,0 +1,256 @@
+package dns
+
+import (
+	"container/list"
+	"net/netip"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/miekg/dns"
+	log "github.com/sirupsen/logrus"
+
+	"github.com/netbirdio/netbird/client/internal/dns/resutil"
+	nbdns "github.com/netbirdio/netbird/dns"
+)
+
+// responseCacheMaxTTL caps how long an answer is cached, whatever its TTL.
+const responseCacheMaxTTL = time.Hour
+
+type responseCacheEntry struct {
+	key     staleKey
+	msg     *dns.Msg
+	stored  time.Time
+	expires time.Time
+}
+
+// responseCache keeps the answers of an upstream handler until their TTL
+// expires, so repeated questions are answered without asking the upstreams.
+// It keeps at most size answers, evicting the least recently used one.
+type responseCache struct {
+	size int
+	// policies bound the TTLs answers are cached for, see cacheTTLPolicyFor.
+	policies []CacheTTLPolicy
+
+	mu      sync.Mutex
+	entries map[staleKey]*list.Element
+	order   *list.List
+	// changed is set when an answer is stored, see snapshot.
+	changed bool
+}
+
+func newResponseCache(size int) *responseCache {
+	return &responseCache{
+		size:    size,
+		entries: make(map[staleKey]*list.Element),
+		order:   list.New(),
+	}
+}
+
+// cacheTTL returns how long rm may be cached: the lowest TTL of its answer
+// and authority records for positive answers, the SOA minimum for negative
+// ones (RFC 2308), bounded by policy. Zero means rm must not be cached.
+func cacheTTL(rm *dns.Msg, policy CacheTTLPolicy) time.Duration {
+	if policy.NoCache || rm.Truncated || len(rm.Question) != 1 {
+		return 0
+	}
+
+	negative := rm.Rcode == dns.RcodeNameError || (rm.Rcode == dns.RcodeSuccess && len(rm.Answer) == 0)
+	switch {
+	case negative:
+		for _, rr := range rm.Ns {
+			if soa, ok := rr.(*dns.SOA); ok {
+				ttl := min(soa.Hdr.Ttl, soa.Minttl)
+				return policy.bound(min(time.Duration(ttl)*time.Second, responseCacheMaxTTL))
+			}
+		}
+		return 0
+	case rm.Rcode == dns.RcodeSuccess:
+		ttl := uint32(responseCacheMaxTTL / time.Second)
+		for _, rrs := range [][]dns.RR{rm.Answer, rm.Ns} {
+			for _, rr := range rrs {
+				ttl = min(ttl, rr.Header().Ttl)
+			}
+		}
+		return policy.bound(time.Duration(ttl) * time.Second)
+	default:
+		return 0
+	}
+}
+
+// cacheable reports whether the answer to r may be served from or stored in
+// the cache. DNSSEC answers depend on the DO and CD bits of the query and
+// tailored answers on its client subnet, so such queries always go to the
+// upstreams.
+func cacheable(r *dns.Msg) bool {
+	if len(r.Question) != 1 || r.CheckingDisabled {
+		return false
+	}
+	opt := r.IsEdns0()
+	return opt == nil || !opt.Do() && !hasClientSubnet(r)
+}
+
+// store caches rm as the answer to its question, with the TTLs bounded by
+// the policy for it.
+func (c *responseCache) store(rm *dns.Msg) {
+	if len(rm.Question) != 1 {
+		return
+	}
+	policy := cacheTTLPolicyFor(c.policies, rm.Question[0])
+	ttl := cacheTTL(rm, policy)
+	if ttl <= 0 {
+		return
+	}
+
+	msg := rm.Copy()
+	resutil.StripOPT(msg)
+	policy.boundRecords(msg)
+	now := time.Now()
+	entry := &responseCacheEntry{key: newStaleKey(rm.Question[0]), msg: msg, stored: now, expires: now.Add(ttl)}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.changed = true
+	if elem, ok := c.entries[entry.key]; ok {
+		elem.Value = entry
+		c.order.MoveToFront(elem)
+		return
+	}
+	c.entries[entry.key] = c.order.PushFront(entry)
+	for c.order.Len() > c.size {
+		c.remove(c.order.Back())
+	}
+}
+
+// lookup returns the cached answer to the question of r, adjusted to reply
+// to r with the TTLs counted down, or nil if there is none.
+func (c *responseCache) lookup(r *dns.Msg) *dns.Msg {
+	key := newStaleKey(r.Question[0])
+	now := time.Now()
+
+	c.mu.Lock()
+	elem, ok := c.entries[key]
+	if !ok {
+		c.mu.Unlock()
+		return nil
+	}
+	entry := elem.Value.(*responseCacheEntry)
+	if !now.Before(entry.expires) {
+		c.remove(elem)
+		c.mu.Unlock()
+		return nil
+	}
+	c.order.MoveToFront(elem)
+	c.mu.Unlock()
+
+	resp := entry.msg.Copy()
+	resp.Id = r.Id
+	resp.Question = r.Question
+	elapsed := uint32(now.Sub(entry.stored) / time.Second)
+	for _, rrs := range [][]dns.RR{resp.Answer, resp.Ns, resp.Extra} {
+		for _, rr := range rrs {
+			hdr := rr.Header()
+			if hdr.Ttl > elapsed {
+				hdr.Ttl -= elapsed
+			} else {
+				hdr.Ttl = 0
+			}
+		}
+	}
+	return resp
+}
+
+// remove drops elem with the lock already held.
+func (c *responseCache) remove(elem *list.Element) {
+	c.order.Remove(elem)
+	delete(c.entries, elem.Value.(*responseCacheEntry).key)
+}
+
+func (c *responseCache) len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.order.Len()
+}
+
+// setResponseCache makes the handler cache up to size answers. Called only
+// while the handler is built.
+func (u *upstreamResolverBase) setResponseCache(size int) {
+	if size <= 0 {
+		u.cache = nil
+		return
+	}
+	u.cache = newResponseCache(size)
+}
+
+// setCacheTTLPolicies bounds the TTLs answers are cached for by policies.
+// Called only while the handler is built, after setResponseCache.
+func (u *upstreamResolverBase) setCacheTTLPolicies(policies []CacheTTLPolicy) {
+	if u.cache != nil {
+		u.cache.policies = policies
+	}
+}
+
+// setNoCache keeps the answers of servers out of the cache. Called only
+// while the handler is built.
+func (u *upstreamResolverBase) setNoCache(servers []netip.AddrPort) {
+	if u.noCache == nil {
+		u.noCache = make(map[netip.AddrPort]struct{}, len(servers))
+	}
+	for _, s := range servers {
+		u.noCache[s] = struct{}{}
+	}
+}
+
+// answerFromCache answers r from the cache if it holds an answer, and
+// reports whether it did. Cache hits don't count as upstream successes.
+func (u *upstreamResolverBase) answerFromCache(w dns.ResponseWriter, r *dns.Msg, logger *log.Entry) bool {
+	if u.cache == nil || !cacheable(r) {
+		return false
+	}
+	resp := u.cache.lookup(r)
+	u.metrics.recordCacheLookup(resp != nil)
+	if resp == nil {
+		return false
+	}
+
+	resutil.SetMeta(w, "cache", "hit")
+	if err := w.WriteMsg(resp); err != nil {
+		logger.Errorf("failed to write cached response for domain=%s: %v", r.Question[0].Name, err)
+	}
+	return true
+}
+
+// cacheAnswer stores rm, the answer of upstream to r, in the cache.
+func (u *upstreamResolverBase) cacheAnswer(r, rm *dns.Msg, upstream netip.AddrPort) {
+	if u.cache == nil || !cacheable(r) {
+		return
+	}
+	if _, ok := u.noCache[upstream]; ok {
+		return
+	}
+	u.cache.store(rm)
+}
+
+// cacheDisabledFor reports whether the answers of group are kept out of the
+// response cache.
+func (s *DefaultServer) cacheDisabledFor(group *nbdns.NameServerGroup) bool {
+	for _, key := range groupKeys(group) {
+		if _, ok := s.noCacheGroups[key]; ok {
+			return true
+		}
+	}
+	return false
+}
+
+// ParseNoCacheGroups parses the keys of the groups whose answers aren't
+// cached: match domains or nameserver addresses, "." for primary groups.
+func ParseNoCacheGroups(keys []string) map[string]struct{} {
+	groups := make(map[string]struct{}, len(keys))
+	for _, key := range keys {
+		if key = strings.TrimSpace(key); key != "" {
+			groups[normalizeInflightKey(key)] = struct{}{}
+		}
+	}
+	return groups
+}
@@ -0,0 +1,150 @@
+package dns
+
+import (
+	"time"
+
+	"github.com/miekg/dns"
+	log "github.com/sirupsen/logrus"
+)
+
+// ResponseCacheState persists the answers cached by the upstream handlers,
+// so their caches start warm after a restart.
+type ResponseCacheState struct {
+	// Zones maps the match domains of the handlers to their answers, least
+	// recently used first.
+	Zones map[string][]persistedAnswer `json:"zones"`
+}
+
+func (s *ResponseCacheState) Name() string {
+	return "dns_response_cache_state"
+}
+
+// persistedAnswer is a cached answer in wire format. Its expiry is absolute,
+// so answers expiring while the client is down are dropped on load.
+type persistedAnswer struct {
+	Msg     []byte    `json:"msg"`
+	Stored  time.Time `json:"stored"`
+	Expires time.Time `json:"expires"`
+}
+
+// snapshot returns the answers that haven't expired by now, least recently
+// used first, and whether the cache changed since the last snapshot.
+func (c *responseCache) snapshot(now time.Time) ([]persistedAnswer, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	changed := c.changed
+	c.changed = false
+	answers := make([]persistedAnswer, 0, c.order.Len())
+	for elem := c.order.Back(); elem != nil; elem = elem.Prev() {
+		entry := elem.Value.(*responseCacheEntry)
+		if !now.Before(entry.expires) {
+			continue
+		}
+		msg, err := entry.msg.Pack()
+		if err != nil {
+			log.Debugf("failed to pack cached DNS answer for %s: %v", entry.key.name, err)
+			continue
+		}
+		answers = append(answers, persistedAnswer{Msg: msg, Stored: entry.stored, Expires: entry.expires})
+	}
+	return answers, changed
+}
+
+// restore seeds the cache with answers, least recently used first, skipping
+// the ones that expired by now.
+func (c *responseCache) restore(answers []persistedAnswer, now time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for _, a := range answers {
+		if !now.Before(a.Expires) {
+			continue
+		}
+		msg := new(dns.Msg)
+		if err := msg.Unpack(a.Msg); err != nil || len(msg.Question) != 1 {
+			continue
+		}
+		entry := &responseCacheEntry{key: newStaleKey(msg.Question[0]), msg: msg, stored: a.Stored, expires: a.Expires}
+		if elem, ok := c.entries[entry.key]; ok {
+			c.remove(elem)
+		}
+		c.entries[entry.key] = c.order.PushFront(entry)
+		for c.order.Len() > c.size {
+			c.remove(c.order.Back())
+		}
+	}
+}
+
+// cachingHandler is implemented by the handlers with a response cache.
+type cachingHandler interface {
+	answerCache() *responseCache
+}
+
+func (u *upstreamResolverBase) answerCache() *responseCache {
+	return u.cache
+}
+
+// loadResponseCache restores the answers the upstream handlers cached in
+// the previous run, to seed the handlers built next with. Caller must hold
+// s.mux.
+func (s *DefaultServer) loadResponseCache() {
+	if !s.persistCache || s.responseCacheSize <= 0 {
+		return
+	}
+	state := &ResponseCacheState{}
+	s.stateManager.RegisterState(state)
+	if err := s.stateManager.LoadState(state); err != nil {
+		log.Warnf("failed to load the DNS response cache: %v", err)
+		return
+	}
+	if loaded, ok := s.stateManager.GetState(state).(*ResponseCacheState); ok && loaded != nil {
+		s.restoredCache = loaded.Zones
+	}
+}
+
+// warmResponseCache seeds the cache of handler, the upstream handler for
+// zone, with the answers restored for it. They are handed out once, so
+// handlers rebuilt later start cold like before. Caller must hold s.mux.
+func (s *DefaultServer) warmResponseCache(zone string, handler cachingHandler) {
+	answers, ok := s.restoredCache[zone]
+	if !ok {
+		return
+	}
+	delete(s.restoredCache, zone)
+	if cache := handler.answerCache(); cache != nil {
+		cache.restore(answers, time.Now())
+	}
+}
+
+// persistResponseCache hands the answers cached by the upstream handlers to
+// the state manager if any changed since the last call.
+func (s *DefaultServer) persistResponseCache() {
+	if !s.persistCache || s.responseCacheSize <= 0 {
+		return
+	}
+
+	now := time.Now()
+	state := &ResponseCacheState{Zones: make(map[string][]persistedAnswer)}
+	changed := false
+	s.mux.Lock()
+	for _, entry := range s.dnsMuxHandlers {
+		h, ok := entry.handler.(cachingHandler)
+		if !ok || h.answerCache() == nil {
+			continue
+		}
+		answers, zoneChanged := h.answerCache().snapshot(now)
+		changed = changed || zoneChanged
+		if len(answers) > 0 {
+			state.Zones[entry.domain] = answers
+		}
+	}
+	s.mux.Unlock()
+
+	if !changed {
+		return
+	}
+	if err := s.stateManager.UpdateState(state); err != nil {
+		log.Warnf("failed to persist the DNS response cache: %v", err)
+	}
+}
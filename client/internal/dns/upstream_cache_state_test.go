@@ -0,0 +1,83 @@
+package dns
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/miekg/dns"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/netbirdio/netbird/client/internal/statemanager"
+)
+
+func cacheTestAnswer(name string, ttl uint32) *dns.Msg {
+	m := new(dns.Msg).SetReply(new(dns.Msg).SetQuestion(name, dns.TypeA))
+	m.Answer = []dns.RR{cacheTestA(name, ttl)}
+	return m
+}
+
+func TestResponseCache_SnapshotRestore(t *testing.T) {
+	cache := newResponseCache(16)
+	cache.store(cacheTestAnswer("short.example.com.", 30))
+	cache.store(cacheTestAnswer("long.example.com.", 300))
+
+	key := newStaleKey(dns.Question{Name: "long.example.com.", Qtype: dns.TypeA, Qclass: dns.ClassINET})
+	entry := cache.entries[key].Value.(*responseCacheEntry)
+	entry.stored = entry.stored.Add(-100 * time.Second)
+
+	now := time.Now()
+	answers, changed := cache.snapshot(now)
+	require.Len(t, answers, 2)
+	assert.True(t, changed)
+	_, changed = cache.snapshot(now)
+	assert.False(t, changed, "nothing was stored since the last snapshot")
+
+	restored := newResponseCache(16)
+	restored.restore(answers, now.Add(time.Minute))
+	assert.Equal(t, 1, restored.len(), "answers expired by the time they are loaded are dropped")
+	assert.Nil(t, restored.lookup(new(dns.Msg).SetQuestion("short.example.com.", dns.TypeA)))
+
+	resp := restored.lookup(new(dns.Msg).SetQuestion("long.example.com.", dns.TypeA))
+	require.NotNil(t, resp)
+	assert.Equal(t, uint32(200), resp.Answer[0].Header().Ttl, "TTLs keep counting down from when the answer was cached")
+
+	small := newResponseCache(1)
+	small.restore(answers, now)
+	assert.NotNil(t, small.lookup(new(dns.Msg).SetQuestion("long.example.com.", dns.TypeA)), "the most recently used answer is kept")
+}
+
+func TestDefaultServer_ResponseCachePersisted(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "state.json")
+	newServer := func() *DefaultServer {
+		server := newTestServer(nil)
+		server.stateManager = statemanager.New(path)
+		server.responseCacheSize = 16
+		server.persistCache = true
+		return server
+	}
+
+	resolver := &upstreamResolverBase{}
+	resolver.setResponseCache(16)
+	resolver.cache.store(cacheTestAnswer("host.example.com.", 300))
+
+	server := newServer()
+	server.loadResponseCache()
+	server.dnsMuxHandlers = []handlerWrapper{{domain: "example.com", handler: resolver, priority: PriorityUpstream}}
+	server.persistResponseCache()
+	require.NoError(t, server.stateManager.PersistState(context.Background()))
+
+	restarted := newServer()
+	restarted.loadResponseCache()
+	warmed := &upstreamResolverBase{}
+	warmed.setResponseCache(16)
+	restarted.warmResponseCache("example.com", warmed)
+	assert.NotNil(t, warmed.cache.lookup(new(dns.Msg).SetQuestion("host.example.com.", dns.TypeA)))
+
+	rebuilt := &upstreamResolverBase{}
+	rebuilt.setResponseCache(16)
+	restarted.warmResponseCache("example.com", rebuilt)
+	assert.Zero(t, rebuilt.cache.len(), "restored answers seed only the first handler built")
+}
@@ -0,0 +1,222 @@
+package dns
+
+import (
+	"context"
+	"net"
+	"net/netip"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/miekg/dns"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/netbirdio/netbird/client/internal/dns/test"
+	nbdns "github.com/netbirdio/netbird/dns"
+)
+
+func cacheTestA(name string, ttl uint32) *dns.A {
+	return &dns.A{
+		Hdr: dns.RR_Header{Name: name, Rrtype: dns.TypeA, Class: dns.ClassINET, Ttl: ttl},
+		A:   net.IPv4(192, 0, 2, 10),
+	}
+}
+
+func cacheTestSOA(ttl, minttl uint32) *dns.SOA {
+	return &dns.SOA{
+		Hdr:    dns.RR_Header{Name: "example.com.", Rrtype: dns.TypeSOA, Class: dns.ClassINET, Ttl: ttl},
+		Ns:     "ns.example.com.",
+		Mbox:   "admin.example.com.",
+		Minttl: minttl,
+	}
+}
+
+func TestCacheTTL(t *testing.T) {
+	q := new(dns.Msg).SetQuestion("host.example.com.", dns.TypeA)
+	reply := func(rcode int, answer, ns []dns.RR) *dns.Msg {
+		m := new(dns.Msg).SetRcode(q, rcode)
+		m.Answer, m.Ns = answer, ns
+		return m
+	}
+
+	tests := []struct {
+		name string
+		msg  *dns.Msg
+		want time.Duration
+	}{
+		{
+			name: "lowest answer ttl",
+			msg:  reply(dns.RcodeSuccess, []dns.RR{cacheTestA("host.example.com.", 300), cacheTestA("host.example.com.", 60)}, nil),
+			want: 60 * time.Second,
+		},
+		{
+			name: "authority ttl counts",
+			msg:  reply(dns.RcodeSuccess, []dns.RR{cacheTestA("host.example.com.", 300)}, []dns.RR{&dns.NS{Hdr: dns.RR_Header{Name: "example.com.", Rrtype: dns.TypeNS, Class: dns.ClassINET, Ttl: 30}, Ns: "ns.example.com."}}),
+			want: 30 * time.Second,
+		},
+		{
+			name: "capped",
+			msg:  reply(dns.RcodeSuccess, []dns.RR{cacheTestA("host.example.com.", 86400)}, nil),
+			want: responseCacheMaxTTL,
+		},
+		{
+			name: "nxdomain uses soa minimum",
+			msg:  reply(dns.RcodeNameError, nil, []dns.RR{cacheTestSOA(3600, 120)}),
+			want: 120 * time.Second,
+		},
+		{
+			name: "nodata uses soa ttl when lower",
+			msg:  reply(dns.RcodeSuccess, nil, []dns.RR{cacheTestSOA(45, 120)}),
+			want: 45 * time.Second,
+		},
+		{
+			name: "negative without soa",
+			msg:  reply(dns.RcodeNameError, nil, nil),
+		},
+		{
+			name: "servfail",
+			msg:  reply(dns.RcodeServerFailure, nil, nil),
+		},
+		{
+			name: "zero ttl",
+			msg:  reply(dns.RcodeSuccess, []dns.RR{cacheTestA("host.example.com.", 0)}, nil),
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, cacheTTL(tt.msg, CacheTTLPolicy{}))
+		})
+	}
+
+	truncated := reply(dns.RcodeSuccess, []dns.RR{cacheTestA("host.example.com.", 60)}, nil)
+	truncated.Truncated = true
+	assert.Zero(t, cacheTTL(truncated, CacheTTLPolicy{}), "truncated answers are incomplete")
+}
+
+func TestResponseCache_LookupAndEviction(t *testing.T) {
+	cache := newResponseCache(2)
+	answer := func(name string) *dns.Msg {
+		m := new(dns.Msg).SetReply(new(dns.Msg).SetQuestion(name, dns.TypeA))
+		m.Answer = []dns.RR{cacheTestA(name, 60)}
+		return m
+	}
+
+	cache.store(answer("a.example.com."))
+	cache.store(answer("b.example.com."))
+
+	q := new(dns.Msg).SetQuestion("A.Example.com.", dns.TypeA)
+	resp := cache.lookup(q)
+	require.NotNil(t, resp, "names are matched case-insensitively")
+	assert.Equal(t, q.Id, resp.Id)
+	assert.Equal(t, "A.Example.com.", resp.Question[0].Name, "the question is echoed as asked")
+	assert.Nil(t, cache.lookup(new(dns.Msg).SetQuestion("a.example.com.", dns.TypeAAAA)), "types are cached apart")
+
+	cache.store(answer("c.example.com."))
+	assert.Equal(t, 2, cache.len())
+	assert.Nil(t, cache.lookup(new(dns.Msg).SetQuestion("b.example.com.", dns.TypeA)), "the least recently used answer is evicted")
+	assert.NotNil(t, cache.lookup(new(dns.Msg).SetQuestion("a.example.com.", dns.TypeA)))
+
+	// Age the entry: TTLs count down, then it expires.
+	elem := cache.entries[newStaleKey(dns.Question{Name: "a.example.com.", Qtype: dns.TypeA, Qclass: dns.ClassINET})]
+	entry := elem.Value.(*responseCacheEntry)
+	entry.stored = entry.stored.Add(-20 * time.Second)
+	resp = cache.lookup(new(dns.Msg).SetQuestion("a.example.com.", dns.TypeA))
+	require.NotNil(t, resp)
+	assert.Equal(t, uint32(40), resp.Answer[0].Header().Ttl)
+
+	entry.expires = time.Now().Add(-time.Second)
+	assert.Nil(t, cache.lookup(new(dns.Msg).SetQuestion("a.example.com.", dns.TypeA)))
+	assert.Equal(t, 1, cache.len(), "expired answers are dropped")
+}
+
+// countingUpstream answers every query with an A record and counts them.
+type countingUpstream struct {
+	queries atomic.Int32
+}
+
+func (c *countingUpstream) exchange(_ context.Context, _ string, r *dns.Msg) (*dns.Msg, time.Duration, error) {
+	c.queries.Add(1)
+	m := new(dns.Msg).SetReply(r)
+	m.Answer = []dns.RR{cacheTestA(r.Question[0].Name, 60)}
+	return m, 0, nil
+}
+
+func TestUpstreamResolver_ResponseCache(t *testing.T) {
+	upstream := netip.MustParseAddrPort("192.0.2.1:53")
+	client := &countingUpstream{}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	resolver := &upstreamResolverBase{
+		ctx:             ctx,
+		cancel:          cancel,
+		upstreamClient:  client,
+		upstreamTimeout: UpstreamTimeout,
+	}
+	resolver.addRace([]netip.AddrPort{upstream})
+	resolver.setResponseCache(16)
+
+	serve := func(r *dns.Msg) *dns.Msg {
+		var written *dns.Msg
+		resolver.ServeDNS(&test.MockResponseWriter{
+			WriteMsgFunc: func(m *dns.Msg) error {
+				written = m
+				return nil
+			},
+		}, r)
+		require.NotNil(t, written)
+		return written
+	}
+
+	serve(new(dns.Msg).SetQuestion("host.example.com.", dns.TypeA))
+	require.Equal(t, int32(1), client.queries.Load())
+
+	// A cache hit must not count as an upstream success.
+	resolver.markUpstreamFail(upstream, "timeout")
+	health := resolver.UpstreamHealth()[upstream]
+
+	resp := serve(new(dns.Msg).SetQuestion("host.example.com.", dns.TypeA))
+	assert.Equal(t, int32(1), client.queries.Load(), "the repeated question is answered from the cache")
+	require.Len(t, resp.Answer, 1)
+	assert.Equal(t, health, resolver.UpstreamHealth()[upstream])
+
+	do := new(dns.Msg).SetQuestion("host.example.com.", dns.TypeA)
+	do.SetEdns0(1232, true)
+	serve(do)
+	assert.Equal(t, int32(2), client.queries.Load(), "DNSSEC queries bypass the cache")
+}
+
+func TestUpstreamResolver_NoCacheServers(t *testing.T) {
+	upstream := netip.MustParseAddrPort("192.0.2.1:53")
+	client := &countingUpstream{}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	resolver := &upstreamResolverBase{
+		ctx:             ctx,
+		cancel:          cancel,
+		upstreamClient:  client,
+		upstreamTimeout: UpstreamTimeout,
+	}
+	resolver.addRace([]netip.AddrPort{upstream})
+	resolver.setResponseCache(16)
+	resolver.setNoCache([]netip.AddrPort{upstream})
+
+	for i := 0; i < 2; i++ {
+		resolver.ServeDNS(&test.MockResponseWriter{}, new(dns.Msg).SetQuestion("host.example.com.", dns.TypeA))
+	}
+	assert.Equal(t, int32(2), client.queries.Load())
+	assert.Zero(t, resolver.cache.len())
+}
+
+func TestDefaultServer_CacheDisabledFor(t *testing.T) {
+	server := &DefaultServer{noCacheGroups: ParseNoCacheGroups([]string{"Corp.Example.com.", " 192.0.2.53 ", ""})}
+
+	assert.True(t, server.cacheDisabledFor(&nbdns.NameServerGroup{Domains: []string{"corp.example.com"}}))
+	assert.True(t, server.cacheDisabledFor(&nbdns.NameServerGroup{
+		Primary:     true,
+		NameServers: []nbdns.NameServer{{IP: netip.MustParseAddr("192.0.2.53"), NSType: nbdns.UDPNameServerType, Port: 53}},
+	}))
+	assert.False(t, server.cacheDisabledFor(&nbdns.NameServerGroup{Primary: true}))
+}
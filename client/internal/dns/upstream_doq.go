@@ -0,0 +1,195 @@
+package dns
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/miekg/dns"
+	"github.com/quic-go/quic-go"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	protoDoQ = "doq"
+
+	// doqALPN is the ALPN token identifying DNS over QUIC (RFC 9250 §4.1.1).
+	doqALPN = "doq"
+	// doqNoError is the application error code for a clean close (RFC 9250 §4.3).
+	doqNoError = 0x0
+	// doqIdleTimeout closes connections to upstreams that stopped being queried.
+	doqIdleTimeout = 2 * time.Minute
+)
+
+// doqClient exchanges queries with DNS-over-QUIC upstreams. It keeps one QUIC
+// connection per upstream and sends every query on its own stream, so
+// concurrent queries don't block each other.
+type doqClient struct {
+	mu    sync.Mutex
+	conns map[string]*quic.Conn
+	// closed is set by close so a dial finishing afterwards isn't cached.
+	closed bool
+
+	// tlsConfig returns the TLS config for an upstream host. Overridden in tests.
+	tlsConfig func(host string) *tls.Config
+}
+
+func newDoQClient() *doqClient {
+	return &doqClient{
+		conns:     make(map[string]*quic.Conn),
+		tlsConfig: doqTLSConfig,
+	}
+}
+
+// doqTLSConfig verifies the upstream certificate against its IP address,
+// since nameservers are configured by IP.
+func doqTLSConfig(host string) *tls.Config {
+	return &tls.Config{
+		ServerName: host,
+		NextProtos: []string{doqALPN},
+		MinVersion: tls.VersionTLS13,
+	}
+}
+
+func (c *doqClient) exchange(ctx context.Context, upstream string, r *dns.Msg) (*dns.Msg, time.Duration, error) {
+	start := time.Now()
+
+	conn, err := c.conn(ctx, upstream)
+	if err != nil {
+		return nil, time.Since(start), fmt.Errorf("with doq: %w", err)
+	}
+
+	rm, err := doqRoundTrip(ctx, conn, r)
+	if err != nil {
+		// Drop the connection so the next query redials instead of reusing
+		// a connection the upstream may have closed.
+		c.drop(upstream, conn)
+		return nil, time.Since(start), fmt.Errorf("with doq: %w", err)
+	}
+
+	setUpstreamProtocol(ctx, protoDoQ)
+	return rm, time.Since(start), nil
+}
+
+// conn returns the cached connection to upstream, dialing a new one when none
+// is open. The dial runs without the lock so one unreachable upstream doesn't
+// stall queries to the others.
+func (c *doqClient) conn(ctx context.Context, upstream string) (*quic.Conn, error) {
+	c.mu.Lock()
+	existing := c.conns[upstream]
+	c.mu.Unlock()
+	if existing != nil && existing.Context().Err() == nil {
+		return existing, nil
+	}
+
+	host, _, err := net.SplitHostPort(upstream)
+	if err != nil {
+		return nil, fmt.Errorf("parse upstream %s: %w", upstream, err)
+	}
+
+	conn, err := quic.DialAddr(ctx, upstream, c.tlsConfig(host), &quic.Config{
+		MaxIdleTimeout: doqIdleTimeout,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("dial: %w", err)
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.closed {
+		_ = conn.CloseWithError(doqNoError, "")
+		return nil, errors.New("client closed")
+	}
+	if err := ctx.Err(); err != nil {
+		_ = conn.CloseWithError(doqNoError, "")
+		return nil, err
+	}
+	if current := c.conns[upstream]; current != nil && current.Context().Err() == nil {
+		// Lost a dial race, keep the connection already shared by others.
+		_ = conn.CloseWithError(doqNoError, "")
+		return current, nil
+	}
+	c.conns[upstream] = conn
+	return conn, nil
+}
+
+func (c *doqClient) drop(upstream string, conn *quic.Conn) {
+	c.mu.Lock()
+	if c.conns[upstream] == conn {
+		delete(c.conns, upstream)
+	}
+	c.mu.Unlock()
+	_ = conn.CloseWithError(doqNoError, "")
+}
+
+// close closes all upstream connections.
+func (c *doqClient) close() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.closed = true
+	for upstream, conn := range c.conns {
+		if err := conn.CloseWithError(doqNoError, ""); err != nil {
+			log.Debugf("close doq connection to %s: %v", upstream, err)
+		}
+		delete(c.conns, upstream)
+	}
+}
+
+// doqRoundTrip sends r on a new stream and reads the response. Per RFC 9250
+// §4.2 the message is length-prefixed, sent with ID 0, and the stream's send
+// side is closed after the query.
+func doqRoundTrip(ctx context.Context, conn *quic.Conn, r *dns.Msg) (*dns.Msg, error) {
+	stream, err := conn.OpenStreamSync(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("open stream: %w", err)
+	}
+	defer stream.CancelRead(doqNoError)
+
+	if deadline, ok := ctx.Deadline(); ok {
+		if err := stream.SetDeadline(deadline); err != nil {
+			return nil, fmt.Errorf("set deadline: %w", err)
+		}
+	}
+
+	query := r.Copy()
+	query.Id = 0
+	packed, err := query.Pack()
+	if err != nil {
+		return nil, fmt.Errorf("pack query: %w", err)
+	}
+
+	buf := make([]byte, 2+len(packed))
+	binary.BigEndian.PutUint16(buf, uint16(len(packed)))
+	copy(buf[2:], packed)
+	if _, err := stream.Write(buf); err != nil {
+		return nil, fmt.Errorf("write query: %w", err)
+	}
+	if err := stream.Close(); err != nil {
+		return nil, fmt.Errorf("close send side: %w", err)
+	}
+
+	var length [2]byte
+	if _, err := io.ReadFull(stream, length[:]); err != nil {
+		return nil, fmt.Errorf("read response length: %w", err)
+	}
+	resp := make([]byte, binary.BigEndian.Uint16(length[:]))
+	if _, err := io.ReadFull(stream, resp); err != nil {
+		return nil, fmt.Errorf("read response: %w", err)
+	}
+
+	rm := new(dns.Msg)
+	if err := rm.Unpack(resp); err != nil {
+		return nil, fmt.Errorf("unpack response: %w", err)
+	}
+	if rm.Id != 0 {
+		return nil, errors.New("response has non-zero message id")
+	}
+	rm.Id = r.Id
+	return rm, nil
+}
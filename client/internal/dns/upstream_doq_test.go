@@ -0,0 +1,193 @@
+package dns
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/binary"
+	"io"
+	"math/big"
+	"net"
+	"net/netip"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/miekg/dns"
+	"github.com/quic-go/quic-go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/netbirdio/netbird/client/internal/dns/test"
+)
+
+// startDoQServer runs a DoQ server on loopback that answers A queries with
+// 192.0.2.10 and records the IDs of received queries. It returns the server
+// address and a client TLS config trusting its certificate.
+func startDoQServer(t *testing.T, conns *atomic.Int32, ids chan<- uint16) (netip.AddrPort, *tls.Config) {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "doq-test"},
+		IPAddresses:  []net.IP{net.IPv4(127, 0, 0, 1)},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	require.NoError(t, err)
+	cert, err := x509.ParseCertificate(der)
+	require.NoError(t, err)
+
+	listener, err := quic.ListenAddr("127.0.0.1:0", &tls.Config{
+		Certificates: []tls.Certificate{{Certificate: [][]byte{der}, PrivateKey: key}},
+		NextProtos:   []string{doqALPN},
+	}, nil)
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = listener.Close() })
+
+	go func() {
+		for {
+			conn, err := listener.Accept(context.Background())
+			if err != nil {
+				return
+			}
+			conns.Add(1)
+			go serveDoQConn(conn, ids)
+		}
+	}()
+
+	roots := x509.NewCertPool()
+	roots.AddCert(cert)
+	clientTLS := &tls.Config{
+		RootCAs:    roots,
+		ServerName: "127.0.0.1",
+		NextProtos: []string{doqALPN},
+		MinVersion: tls.VersionTLS13,
+	}
+	return netip.MustParseAddrPort(listener.Addr().String()), clientTLS
+}
+
+func serveDoQConn(conn *quic.Conn, ids chan<- uint16) {
+	for {
+		stream, err := conn.AcceptStream(context.Background())
+		if err != nil {
+			return
+		}
+		go func() {
+			defer stream.Close()
+
+			var length [2]byte
+			if _, err := io.ReadFull(stream, length[:]); err != nil {
+				return
+			}
+			buf := make([]byte, binary.BigEndian.Uint16(length[:]))
+			if _, err := io.ReadFull(stream, buf); err != nil {
+				return
+			}
+			query := new(dns.Msg)
+			if err := query.Unpack(buf); err != nil {
+				return
+			}
+			ids <- query.Id
+
+			resp := new(dns.Msg).SetReply(query)
+			resp.Answer = []dns.RR{&dns.A{
+				Hdr: dns.RR_Header{Name: query.Question[0].Name, Rrtype: dns.TypeA, Class: dns.ClassINET, Ttl: 60},
+				A:   net.IPv4(192, 0, 2, 10),
+			}}
+			packed, err := resp.Pack()
+			if err != nil {
+				return
+			}
+			out := make([]byte, 2+len(packed))
+			binary.BigEndian.PutUint16(out, uint16(len(packed)))
+			copy(out[2:], packed)
+			_, _ = stream.Write(out)
+		}()
+	}
+}
+
+func TestDoQClient_ExchangeReusesConnection(t *testing.T) {
+	var conns atomic.Int32
+	ids := make(chan uint16, 10)
+	addr, clientTLS := startDoQServer(t, &conns, ids)
+
+	client := newDoQClient()
+	client.tlsConfig = func(string) *tls.Config { return clientTLS }
+	defer client.close()
+
+	for i := 0; i < 3; i++ {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		q := new(dns.Msg).SetQuestion("example.com.", dns.TypeA)
+		q.Id = uint16(1000 + i)
+
+		rm, _, err := client.exchange(ctx, addr.String(), q)
+		cancel()
+		require.NoError(t, err)
+		assert.Equal(t, q.Id, rm.Id, "response must carry the client's message id")
+		require.Len(t, rm.Answer, 1)
+		assert.Equal(t, "192.0.2.10", rm.Answer[0].(*dns.A).A.String())
+		assert.Equal(t, uint16(0), <-ids, "queries must be sent with message id 0")
+	}
+
+	assert.Equal(t, int32(1), conns.Load(), "queries should share one QUIC connection")
+}
+
+func TestUpstreamResolver_DoQServers(t *testing.T) {
+	var conns atomic.Int32
+	ids := make(chan uint16, 10)
+	addr, clientTLS := startDoQServer(t, &conns, ids)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	resolver := &upstreamResolverBase{
+		ctx:             ctx,
+		cancel:          cancel,
+		upstreamClient:  &mockUpstreamResolverPerServer{responses: map[string]mockUpstreamResponse{}},
+		upstreamTimeout: UpstreamTimeout,
+	}
+	resolver.addRace([]netip.AddrPort{addr})
+	resolver.setDoQ([]netip.AddrPort{addr})
+	resolver.doq.tlsConfig = func(string) *tls.Config { return clientTLS }
+	defer resolver.Stop()
+
+	var written *dns.Msg
+	w := &test.MockResponseWriter{
+		WriteMsgFunc: func(m *dns.Msg) error {
+			written = m
+			return nil
+		},
+	}
+	resolver.ServeDNS(w, new(dns.Msg).SetQuestion("example.com.", dns.TypeA))
+
+	require.NotNil(t, written)
+	assert.Equal(t, dns.RcodeSuccess, written.Rcode, "query should be answered over DoQ, not the UDP client")
+	require.Len(t, written.Answer, 1)
+}
+
+func TestDoQClient_NoConnectionCachedAfterClose(t *testing.T) {
+	var conns atomic.Int32
+	ids := make(chan uint16, 10)
+	addr, clientTLS := startDoQServer(t, &conns, ids)
+
+	client := newDoQClient()
+	client.tlsConfig = func(string) *tls.Config { return clientTLS }
+	client.close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	_, _, err := client.exchange(ctx, addr.String(), new(dns.Msg).SetQuestion("example.com.", dns.TypeA))
+	require.Error(t, err)
+
+	client.mu.Lock()
+	defer client.mu.Unlock()
+	assert.Empty(t, client.conns, "a dial finishing after close must not be cached")
+}
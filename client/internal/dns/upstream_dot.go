@@ -0,0 +1,73 @@
+package dns
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"net"
+	"net/netip"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+const (
+	protoDoT = "dot"
+	// netDoT is the miekg/dns client network for DNS over TLS.
+	netDoT = "tcp-tls"
+)
+
+// dotClient exchanges queries with DNS-over-TLS upstreams (RFC 7858). TLS
+// connections are kept in the handler's connection pool, so consecutive
+// queries skip the handshake.
+type dotClient struct {
+	// pool keeps the connections between queries, nil dials one per query.
+	pool *connPool
+	// serverNames are the configured hostnames of the upstreams, verified
+	// in place of their IP address. Set only while the handler is built.
+	serverNames map[netip.AddrPort]string
+
+	// tlsConfig returns the TLS config for an upstream host. Overridden in tests.
+	tlsConfig func(host string) *tls.Config
+}
+
+func newDoTClient(pool *connPool) *dotClient {
+	return &dotClient{
+		pool:      pool,
+		tlsConfig: dotTLSConfig,
+	}
+}
+
+// dotTLSConfig sends host as SNI and verifies the upstream certificate
+// against it: the nameserver hostname if configured, else its IP address.
+func dotTLSConfig(host string) *tls.Config {
+	return &tls.Config{
+		ServerName: host,
+		MinVersion: tls.VersionTLS12,
+	}
+}
+
+func (c *dotClient) exchange(ctx context.Context, upstream string, r *dns.Msg) (*dns.Msg, time.Duration, error) {
+	host, _, err := net.SplitHostPort(upstream)
+	if err != nil {
+		return nil, 0, fmt.Errorf("with dot: parse upstream %s: %w", upstream, err)
+	}
+	if addr, err := netip.ParseAddrPort(upstream); err == nil {
+		if name := c.serverNames[addr]; name != "" {
+			host = name
+		}
+	}
+
+	client := &dns.Client{
+		Net:       netDoT,
+		Timeout:   ClientTimeout,
+		TLSConfig: c.tlsConfig(host),
+	}
+	rm, t, err := c.pool.exchange(ctx, client, r, upstream)
+	if err != nil {
+		return nil, t, fmt.Errorf("with dot: %w", err)
+	}
+
+	setUpstreamProtocol(ctx, protoDoT)
+	return rm, t, nil
+}
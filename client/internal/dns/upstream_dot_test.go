@@ -0,0 +1,240 @@
+package dns
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"math/big"
+	"net"
+	"net/netip"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/miekg/dns"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/netbirdio/netbird/client/internal/dns/test"
+	nbdns "github.com/netbirdio/netbird/dns"
+	"github.com/netbirdio/netbird/route"
+)
+
+// dotCountingListener counts the connections accepted by a listener.
+type dotCountingListener struct {
+	net.Listener
+	conns *atomic.Int32
+}
+
+func (l dotCountingListener) Accept() (net.Conn, error) {
+	conn, err := l.Listener.Accept()
+	if err == nil {
+		l.conns.Add(1)
+	}
+	return conn, err
+}
+
+// startDoTServer runs a DoT server on loopback that answers A queries with
+// 192.0.2.10. Its certificate is valid for 127.0.0.1 and dot.test. It returns
+// the server address and a client TLS config trusting the certificate.
+func startDoTServer(t *testing.T, conns *atomic.Int32) (netip.AddrPort, *tls.Config) {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "dot-test"},
+		IPAddresses:  []net.IP{net.IPv4(127, 0, 0, 1)},
+		DNSNames:     []string{"dot.test"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	require.NoError(t, err)
+	cert, err := x509.ParseCertificate(der)
+	require.NoError(t, err)
+
+	tcp, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	listener := tls.NewListener(dotCountingListener{Listener: tcp, conns: conns}, &tls.Config{
+		Certificates: []tls.Certificate{{Certificate: [][]byte{der}, PrivateKey: key}},
+	})
+
+	server := &dns.Server{
+		Listener: listener,
+		Net:      netDoT,
+		Handler: dns.HandlerFunc(func(w dns.ResponseWriter, r *dns.Msg) {
+			resp := new(dns.Msg).SetReply(r)
+			resp.Answer = []dns.RR{&dns.A{
+				Hdr: dns.RR_Header{Name: r.Question[0].Name, Rrtype: dns.TypeA, Class: dns.ClassINET, Ttl: 60},
+				A:   net.IPv4(192, 0, 2, 10),
+			}}
+			_ = w.WriteMsg(resp)
+		}),
+	}
+	go func() { _ = server.ActivateAndServe() }()
+	t.Cleanup(func() { _ = server.Shutdown() })
+
+	roots := x509.NewCertPool()
+	roots.AddCert(cert)
+	clientTLS := &tls.Config{
+		RootCAs:    roots,
+		ServerName: "127.0.0.1",
+		MinVersion: tls.VersionTLS12,
+	}
+	return netip.MustParseAddrPort(tcp.Addr().String()), clientTLS
+}
+
+func TestDoTClient_ExchangeReusesConnection(t *testing.T) {
+	var conns atomic.Int32
+	addr, clientTLS := startDoTServer(t, &conns)
+
+	pool := newConnPool(0, 0)
+	defer pool.close()
+	client := newDoTClient(pool)
+	client.tlsConfig = func(host string) *tls.Config {
+		assert.Equal(t, "127.0.0.1", host, "the certificate is verified against the upstream address")
+		return clientTLS
+	}
+
+	for i := 0; i < 3; i++ {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		ctx, proto := contextWithUpstreamProtocolResult(ctx)
+		q := new(dns.Msg).SetQuestion("example.com.", dns.TypeA)
+
+		rm, _, err := client.exchange(ctx, addr.String(), q)
+		cancel()
+		require.NoError(t, err)
+		assert.Equal(t, q.Id, rm.Id)
+		require.Len(t, rm.Answer, 1)
+		assert.Equal(t, "192.0.2.10", rm.Answer[0].(*dns.A).A.String())
+		assert.Equal(t, protoDoT, proto.protocol)
+	}
+
+	assert.Equal(t, int32(1), conns.Load(), "queries should share one TLS connection")
+}
+
+func TestDoTClient_ServerName(t *testing.T) {
+	var conns atomic.Int32
+	addr, clientTLS := startDoTServer(t, &conns)
+
+	exchange := func(hostname string) error {
+		client := newDoTClient(nil)
+		client.serverNames = map[netip.AddrPort]string{addr: hostname}
+		client.tlsConfig = func(host string) *tls.Config {
+			config := dotTLSConfig(host)
+			config.RootCAs = clientTLS.RootCAs
+			return config
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		_, _, err := client.exchange(ctx, addr.String(), new(dns.Msg).SetQuestion("example.com.", dns.TypeA))
+		return err
+	}
+
+	require.NoError(t, exchange("dot.test"), "the certificate is verified against the configured hostname")
+	assert.Error(t, exchange("other.test"), "a certificate not valid for the hostname is rejected")
+}
+
+func TestDefaultServer_DoTHandshakeFailureDisablesGroup(t *testing.T) {
+	var conns atomic.Int32
+	addr, _ := startDoTServer(t, &conns)
+	groups := []*nbdns.NameServerGroup{{
+		Domains: []string{"corp.example.com"},
+		NameServers: []nbdns.NameServer{{
+			IP:       addr.Addr(),
+			NSType:   nbdns.DOTNameServerType,
+			Port:     int(addr.Port()),
+			Hostname: "dot.test",
+		}},
+	}}
+
+	server := newTestServer(nil)
+	server.selectedRoutes = func() route.HAMap { return nil }
+	server.activeRoutes = func() route.HAMap { return nil }
+	server.warningDelayBase = defaultWarningDelayBase
+
+	updates, err := server.buildUpstreamHandlerUpdate(groups)
+	require.NoError(t, err)
+	require.Len(t, updates, 1)
+	resolver, ok := updates[0].handler.(*upstreamResolver)
+	require.True(t, ok)
+	handler := resolver.upstreamResolverBase
+	t.Cleanup(handler.Stop)
+	require.NotNil(t, handler.dot)
+	assert.Equal(t, "dot.test", handler.dot.serverNames[addr])
+
+	server.mux.Lock()
+	server.dnsMuxHandlers = updates
+	server.updateNSGroupStates(groups)
+	server.mux.Unlock()
+
+	// The system roots don't trust the test certificate, so the handshake
+	// fails.
+	var resp *dns.Msg
+	w := &test.MockResponseWriter{WriteMsgFunc: func(m *dns.Msg) error { resp = m; return nil }}
+	handler.ServeDNS(w, new(dns.Msg).SetQuestion("host.corp.example.com.", dns.TypeA))
+	require.NotNil(t, resp)
+	assert.Equal(t, dns.RcodeServerFailure, resp.Rcode)
+
+	server.refreshHealth()
+	states := server.statusRecorder.GetDNSStates()
+	require.Len(t, states, 1)
+	assert.False(t, states[0].Enabled, "a failed handshake disables the group like a timeout")
+}
+
+func TestUpstreamResolver_DoTServers(t *testing.T) {
+	var conns atomic.Int32
+	addr, clientTLS := startDoTServer(t, &conns)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	resolver := &upstreamResolverBase{
+		ctx:             ctx,
+		cancel:          cancel,
+		upstreamClient:  &mockUpstreamResolverPerServer{responses: map[string]mockUpstreamResponse{}},
+		upstreamTimeout: UpstreamTimeout,
+	}
+	resolver.addRace([]netip.AddrPort{addr})
+	plainID := resolver.ID()
+	resolver.setDoT([]netip.AddrPort{addr}, nil)
+	resolver.setConnPool(0, 0)
+	require.Same(t, resolver.connPool, resolver.dot.pool, "the DoT client uses the handler's pool")
+	assert.NotEqual(t, plainID, resolver.ID(), "the transport is part of the handler identity")
+	defer resolver.Stop()
+
+	serve := func() *dns.Msg {
+		var written *dns.Msg
+		w := &test.MockResponseWriter{
+			WriteMsgFunc: func(m *dns.Msg) error {
+				written = m
+				return nil
+			},
+		}
+		resolver.ServeDNS(w, new(dns.Msg).SetQuestion("example.com.", dns.TypeA))
+		require.NotNil(t, written)
+		return written
+	}
+
+	// The default config verifies against the system roots, which don't
+	// trust the test certificate: the handshake fails like a timeout would.
+	resp := serve()
+	assert.Equal(t, dns.RcodeServerFailure, resp.Rcode)
+	health := resolver.UpstreamHealth()[addr]
+	assert.False(t, health.LastFail.IsZero(), "a failed handshake marks the upstream failed")
+	assert.Contains(t, health.LastErr, "dot")
+
+	resolver.dot.tlsConfig = func(string) *tls.Config { return clientTLS }
+	resp = serve()
+	assert.Equal(t, dns.RcodeSuccess, resp.Rcode, "query should be answered over DoT, not the UDP client")
+	require.Len(t, resp.Answer, 1)
+	health = resolver.UpstreamHealth()[addr]
+	assert.True(t, health.LastFail.IsZero(), "a successful query recovers the upstream")
+}
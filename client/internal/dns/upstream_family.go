@@ -0,0 +1,70 @@
+package dns
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/netip"
+
+	log "github.com/sirupsen/logrus"
+
+	nbdns "github.com/netbirdio/netbird/dns"
+)
+
+// errNoReachableFamily is recorded for nameserver groups none of whose
+// servers the peer can reach with its address families, e.g. a group of
+// IPv6 servers on a peer without IPv6 connectivity.
+var errNoReachableFamily = errors.New("no reachable servers for address family")
+
+// familyReachable reports whether the peer has the address family to reach
+// a nameserver at addr: IPv4 always, IPv6 through its IPv6 overlay address
+// or a route of the host.
+func (s *DefaultServer) familyReachable(addr netip.Addr) bool {
+	if addr.Unmap().Is4() || s.wgInterface.Address().HasIPv6() {
+		return true
+	}
+	return hostRoutesTo(addr)
+}
+
+// hostRoutesTo reports whether the host has a route to addr. Connecting a
+// UDP socket only looks up the route, nothing is sent.
+func hostRoutesTo(addr netip.Addr) bool {
+	conn, err := net.DialUDP("udp", nil, net.UDPAddrFromAddrPort(netip.AddrPortFrom(addr, DefaultPort)))
+	if err != nil {
+		return false
+	}
+	_ = conn.Close()
+	return true
+}
+
+// reachableServers returns the servers of nsGroup the peer can reach with
+// its address families. If there are none, the group's error is recorded
+// for its status until the next configuration update. Caller must hold
+// s.mux.
+func (s *DefaultServer) reachableServers(nsGroup *nbdns.NameServerGroup, servers []netip.AddrPort) []netip.AddrPort {
+	if s.serverReachable == nil {
+		return servers
+	}
+
+	var reachable, unreachable []netip.AddrPort
+	for _, server := range servers {
+		if s.serverReachable(server.Addr()) {
+			reachable = append(reachable, server)
+		} else {
+			unreachable = append(unreachable, server)
+		}
+	}
+	switch {
+	case len(unreachable) == 0:
+	case len(reachable) == 0:
+		err := fmt.Errorf("%w: the peer has no IPv6 connectivity to nameservers [%s]", errNoReachableFamily, joinAddrPorts(unreachable))
+		log.Warnf("skipping nameserver group for domains %v: %v", nsGroup.Domains, err)
+		if s.familyErrors == nil {
+			s.familyErrors = make(map[nsGroupID]error)
+		}
+		s.familyErrors[generateGroupKey(nsGroup)] = err
+	default:
+		log.Infof("skipping nameservers [%s] of group for domains %v, the peer has no IPv6 connectivity", joinAddrPorts(unreachable), nsGroup.Domains)
+	}
+	return reachable
+}
@@ -0,0 +1,75 @@
+package dns
+
+import (
+	"net/netip"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/netbirdio/netbird/client/internal/peer"
+	nbdns "github.com/netbirdio/netbird/dns"
+)
+
+func TestDefaultServer_NoReachableFamily(t *testing.T) {
+	nameServer := func(ip string) nbdns.NameServer {
+		return nbdns.NameServer{IP: netip.MustParseAddr(ip), NSType: nbdns.UDPNameServerType, Port: 53}
+	}
+	v6Only := &nbdns.NameServerGroup{
+		Domains:     []string{"v6.example.com"},
+		NameServers: []nbdns.NameServer{nameServer("2001:db8::53"), nameServer("2001:db8::54")},
+	}
+	mixed := &nbdns.NameServerGroup{
+		Domains:     []string{"mixed.example.com"},
+		NameServers: []nbdns.NameServer{nameServer("2001:db8::55"), nameServer("192.0.2.53")},
+	}
+
+	server := newTestServer(nil)
+	// an IPv4-only peer
+	server.serverReachable = func(addr netip.Addr) bool { return addr.Is4() }
+
+	server.mux.Lock()
+	updates, err := server.buildUpstreamHandlerUpdate([]*nbdns.NameServerGroup{v6Only, mixed})
+	server.updateNSGroupStates([]*nbdns.NameServerGroup{v6Only, mixed})
+	server.mux.Unlock()
+	require.NoError(t, err)
+
+	require.Len(t, updates, 1, "the IPv6-only group gets no handler")
+	assert.Equal(t, "mixed.example.com", updates[0].domain)
+	handler, ok := updates[0].handler.(*upstreamResolver)
+	require.True(t, ok)
+	assert.Equal(t, []upstreamRace{{netip.MustParseAddrPort("192.0.2.53:53")}}, handler.upstreamServers,
+		"unreachable servers of a mixed group are skipped")
+
+	server.refreshHealth()
+	states := make(map[string]peer.NSGroupState)
+	for _, state := range server.statusRecorder.GetDNSStates() {
+		states[state.Domains[0]] = state
+	}
+
+	require.Contains(t, states, "v6.example.com")
+	assert.False(t, states["v6.example.com"].Enabled)
+	assert.ErrorIs(t, states["v6.example.com"].Error, errNoReachableFamily)
+	assert.Contains(t, states["v6.example.com"].Error.Error(), "[2001:db8::53]:53")
+	require.Contains(t, states, "mixed.example.com")
+	assert.NoError(t, states["mixed.example.com"].Error)
+
+	// Once the peer reaches IPv6, the group is served and the error cleared.
+	server.serverReachable = func(netip.Addr) bool { return true }
+	server.mux.Lock()
+	updates, err = server.buildUpstreamHandlerUpdate([]*nbdns.NameServerGroup{v6Only, mixed})
+	server.mux.Unlock()
+	require.NoError(t, err)
+	assert.Len(t, updates, 2)
+
+	server.refreshHealth()
+	for _, state := range server.statusRecorder.GetDNSStates() {
+		assert.NoError(t, state.Error, "group %v", state.Domains)
+	}
+}
+
+func TestDefaultServer_FamilyReachable(t *testing.T) {
+	server := newTestServer(nil)
+	assert.True(t, server.familyReachable(netip.MustParseAddr("192.0.2.53")))
+	assert.True(t, server.familyReachable(netip.MustParseAddr("::ffff:192.0.2.53")))
+}
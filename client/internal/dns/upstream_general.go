@@ -50,7 +50,19 @@ func (u *upstreamResolver) exchange(ctx context.Context, upstream string, r *dns
 	client := &dns.Client{
 		Timeout: ClientTimeout,
 	}
-	return ExchangeWithFallback(ctx, client, r, upstream)
+	return exchangeWithFallback(ctx, client, u.connPool, r, upstream)
+}
+
+// doqSupported reports whether DNS over QUIC upstreams can be used. The QUIC
+// dial doesn't go through the netstack exchange path used on JS.
+func doqSupported() bool {
+	return runtime.GOOS != "js"
+}
+
+// dotSupported reports whether DNS over TLS upstreams can be used. Like the
+// QUIC dial, the TLS dial doesn't go through the netstack exchange path.
+func dotSupported() bool {
+	return runtime.GOOS != "js"
 }
 
 func GetClientPrivate(_ privateClientIface, _ netip.Addr, dialTimeout time.Duration) (*dns.Client, error) {
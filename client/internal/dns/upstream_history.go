@@ -0,0 +1,232 @@
+package dns
+
+import (
+	"math/bits"
+	"net/netip"
+	"slices"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	// upstreamHistoryWindow is the number of recent query outcomes kept per
+	// upstream.
+	upstreamHistoryWindow = 32
+	// upstreamHistoryMinSamples is the number of outcomes needed before an
+	// upstream may be considered failing.
+	upstreamHistoryMinSamples = 8
+	// upstreamFailingSuccessPercent is the share of successful queries in
+	// the window at or below which an upstream is failing rather than flaky.
+	upstreamFailingSuccessPercent = 10
+	// upstreamRetryInterval is how often a failing upstream gets a client
+	// query again at its configured place, to notice its recovery.
+	upstreamRetryInterval = 30 * time.Second
+)
+
+// upstreamOutcomes is the sliding window of recent query outcomes of an
+// upstream.
+type upstreamOutcomes struct {
+	// Failures has a bit set per failed query, the most recent in bit 0.
+	Failures uint32 `json:"failures"`
+	// Count is the number of outcomes in the window.
+	Count int `json:"count"`
+
+	// lastTried is when the upstream was last queried, or let through for
+	// a retry.
+	lastTried time.Time
+}
+
+func (o *upstreamOutcomes) record(ok bool) {
+	o.Failures <<= 1
+	if !ok {
+		o.Failures |= 1
+	}
+	o.Count = min(o.Count+1, upstreamHistoryWindow)
+}
+
+// failing reports whether nearly every query in a full enough window
+// failed. Upstreams failing intermittently are flaky, not failing.
+func (o *upstreamOutcomes) failing() bool {
+	if o.Count < upstreamHistoryMinSamples {
+		return false
+	}
+	failures := bits.OnesCount32(o.Failures & (1<<o.Count - 1))
+	return (o.Count-failures)*100 <= o.Count*upstreamFailingSuccessPercent
+}
+
+// upstreamHistory keeps the outcome windows of every upstream, shared by
+// all upstream handlers of a server so it outlives configuration changes.
+// A nil history records nothing and keeps the configured order.
+type upstreamHistory struct {
+	mu        sync.Mutex
+	upstreams map[netip.AddrPort]*upstreamOutcomes
+	// dirty is set when outcomes changed since the last persisted state.
+	dirty bool
+	// now returns the current time, overridden in tests.
+	now func() time.Time
+}
+
+func newUpstreamHistory() *upstreamHistory {
+	return &upstreamHistory{
+		upstreams: make(map[netip.AddrPort]*upstreamOutcomes),
+		now:       time.Now,
+	}
+}
+
+// record adds the outcome of a query to upstream.
+func (h *upstreamHistory) record(upstream netip.AddrPort, ok bool) {
+	if h == nil {
+		return
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	o := h.upstreams[upstream]
+	if o == nil {
+		o = &upstreamOutcomes{}
+		h.upstreams[upstream] = o
+	}
+	wasFailing := o.failing()
+	o.record(ok)
+	o.lastTried = h.now()
+	h.dirty = true
+
+	switch isFailing := o.failing(); {
+	case isFailing && !wasFailing:
+		log.Infof("upstream %s keeps failing, trying it after the other nameservers of its group", upstream)
+	case !isFailing && wasFailing:
+		log.Infof("upstream %s answers again, restoring its place in its group", upstream)
+	}
+}
+
+// order returns race with its failing upstreams moved behind the others, so
+// they are only tried as a last resort. A failing upstream not queried for
+// upstreamRetryInterval keeps its place for one query to probe it. The race
+// is returned unchanged if all or none of its upstreams are failing.
+func (h *upstreamHistory) order(race upstreamRace) upstreamRace {
+	if h == nil || len(race) < 2 {
+		return race
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	now := h.now()
+	var demoted []netip.AddrPort
+	for _, upstream := range race {
+		o := h.upstreams[upstream]
+		if o == nil || !o.failing() {
+			continue
+		}
+		if now.Sub(o.lastTried) >= upstreamRetryInterval {
+			o.lastTried = now
+			continue
+		}
+		demoted = append(demoted, upstream)
+	}
+	if len(demoted) == 0 || len(demoted) == len(race) {
+		return race
+	}
+
+	ordered := make(upstreamRace, 0, len(race))
+	for _, upstream := range race {
+		if !slices.Contains(demoted, upstream) {
+			ordered = append(ordered, upstream)
+		}
+	}
+	return append(ordered, demoted...)
+}
+
+// failing reports whether upstream is considered failing.
+func (h *upstreamHistory) failing(upstream netip.AddrPort) bool {
+	if h == nil {
+		return false
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	o := h.upstreams[upstream]
+	return o != nil && o.failing()
+}
+
+// state returns the outcomes to persist and whether they changed since the
+// last call.
+func (h *upstreamHistory) state() (*UpstreamHistoryState, bool) {
+	if h == nil {
+		return nil, false
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	dirty := h.dirty
+	h.dirty = false
+	state := &UpstreamHistoryState{Upstreams: make(map[netip.AddrPort]upstreamOutcomes, len(h.upstreams))}
+	for upstream, o := range h.upstreams {
+		state.Upstreams[upstream] = *o
+	}
+	return state, dirty
+}
+
+// restore seeds the history with persisted outcomes. Restored upstreams
+// count as just tried, so a failing one is probed after
+// upstreamRetryInterval rather than on the first query.
+func (h *upstreamHistory) restore(state *UpstreamHistoryState) {
+	if h == nil {
+		return
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	now := h.now()
+	for upstream, o := range state.Upstreams {
+		if !upstream.IsValid() {
+			continue
+		}
+		o.Count = min(max(o.Count, 0), upstreamHistoryWindow)
+		o.lastTried = now
+		h.upstreams[upstream] = &o
+	}
+}
+
+// UpstreamHistoryState persists the recent query outcomes of the upstream
+// nameservers, so failing ones stay demoted across restarts.
+type UpstreamHistoryState struct {
+	Upstreams map[netip.AddrPort]upstreamOutcomes `json:"upstreams"`
+}
+
+func (s *UpstreamHistoryState) Name() string {
+	return "dns_upstream_history_state"
+}
+
+// setUpstreamHistory records the query outcomes of the handler's upstreams
+// in h and orders its races by them. Called only while the handler is
+// built.
+func (u *upstreamResolverBase) setUpstreamHistory(h *upstreamHistory) {
+	u.history = h
+}
+
+// loadUpstreamHistory restores the upstream history persisted by a previous
+// run. Caller must hold s.mux.
+func (s *DefaultServer) loadUpstreamHistory() {
+	state := &UpstreamHistoryState{}
+	s.stateManager.RegisterState(state)
+	if err := s.stateManager.LoadState(state); err != nil {
+		log.Warnf("failed to load DNS upstream history: %v", err)
+		return
+	}
+	if loaded, ok := s.stateManager.GetState(state).(*UpstreamHistoryState); ok && loaded != nil {
+		s.upstreamHistory.restore(loaded)
+	}
+}
+
+// persistUpstreamHistory hands the upstream history to the state manager
+// if it changed since the last call.
+func (s *DefaultServer) persistUpstreamHistory() {
+	state, dirty := s.upstreamHistory.state()
+	if !dirty {
+		return
+	}
+	if err := s.stateManager.UpdateState(state); err != nil {
+		log.Warnf("failed to persist DNS upstream history: %v", err)
+	}
+}
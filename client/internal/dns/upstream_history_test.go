@@ -0,0 +1,185 @@
+package dns
+
+import (
+	"context"
+	"errors"
+	"net/netip"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/miekg/dns"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/netbirdio/netbird/client/internal/dns/test"
+	"github.com/netbirdio/netbird/client/internal/statemanager"
+)
+
+func TestUpstreamOutcomes_Failing(t *testing.T) {
+	outcomes := func(pattern ...bool) *upstreamOutcomes {
+		o := &upstreamOutcomes{}
+		for _, ok := range pattern {
+			o.record(ok)
+		}
+		return o
+	}
+	repeat := func(n int, ok bool) []bool {
+		out := make([]bool, n)
+		for i := range out {
+			out[i] = ok
+		}
+		return out
+	}
+
+	assert.False(t, outcomes(repeat(upstreamHistoryMinSamples-1, false)...).failing(), "too few samples")
+	assert.True(t, outcomes(repeat(upstreamHistoryMinSamples, false)...).failing())
+	assert.False(t, outcomes(true, false, true, false, true, false, true, false, true, false).failing(), "flaky is not failing")
+	assert.True(t, outcomes(append(repeat(upstreamHistoryWindow, true), repeat(upstreamHistoryWindow, false)...)...).failing(),
+		"old successes leave the window")
+	assert.True(t, outcomes(append([]bool{true, true, true}, repeat(upstreamHistoryWindow-3, false)...)...).failing(),
+		"a rare success doesn't save a failing upstream")
+	assert.False(t, outcomes(append(repeat(upstreamHistoryWindow, false), repeat(4, true)...)...).failing(), "recovering")
+
+	o := outcomes(repeat(100, false)...)
+	assert.Equal(t, upstreamHistoryWindow, o.Count)
+}
+
+// scriptedUpstreamClient answers per upstream: broken ones always fail,
+// flaky ones fail every other query.
+type scriptedUpstreamClient struct {
+	mu     sync.Mutex
+	broken map[string]bool
+	flaky  map[string]bool
+	calls  map[string]int
+}
+
+func (c *scriptedUpstreamClient) exchange(_ context.Context, upstream string, r *dns.Msg) (*dns.Msg, time.Duration, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.calls[upstream]++
+	if c.broken[upstream] || c.flaky[upstream] && c.calls[upstream]%2 == 0 {
+		return nil, 0, errors.New("connection refused")
+	}
+	m := buildMockResponse(dns.RcodeSuccess, "192.0.2.100")
+	m.SetReply(r)
+	return m, time.Millisecond, nil
+}
+
+func (c *scriptedUpstreamClient) takeCalls() map[string]int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	calls := c.calls
+	c.calls = make(map[string]int)
+	return calls
+}
+
+func TestUpstreamResolver_History(t *testing.T) {
+	primary := netip.MustParseAddrPort("192.0.2.1:53")
+	secondary := netip.MustParseAddrPort("192.0.2.2:53")
+
+	now := time.Date(2026, 3, 2, 12, 0, 0, 0, time.UTC)
+	history := newUpstreamHistory()
+	history.now = func() time.Time { return now }
+
+	client := &scriptedUpstreamClient{
+		broken: map[string]bool{},
+		flaky:  map[string]bool{},
+		calls:  map[string]int{},
+	}
+	resolver := &upstreamResolverBase{
+		ctx:             context.Background(),
+		upstreamClient:  client,
+		upstreamTimeout: UpstreamTimeout,
+	}
+	resolver.addRace([]netip.AddrPort{primary, secondary})
+	resolver.setUpstreamHistory(history)
+
+	query := func(n int) {
+		for range n {
+			w := &test.MockResponseWriter{}
+			resolver.ServeDNS(w, new(dns.Msg).SetQuestion("example.com.", dns.TypeA))
+			require.NotNil(t, w.GetLastResponse())
+			require.Equal(t, dns.RcodeSuccess, w.GetLastResponse().Rcode, "the group keeps answering")
+		}
+	}
+
+	// A flaky primary keeps its place: every query tries it first.
+	client.flaky[primary.String()] = true
+	query(40)
+	assert.False(t, history.failing(primary))
+	assert.Equal(t, 40, client.takeCalls()[primary.String()])
+
+	// A broken primary is tried after the secondary once its window is
+	// full of failures.
+	delete(client.flaky, primary.String())
+	client.broken[primary.String()] = true
+	query(upstreamHistoryWindow)
+	require.True(t, history.failing(primary))
+	client.takeCalls()
+	query(10)
+	calls := client.takeCalls()
+	assert.Zero(t, calls[primary.String()], "the failing primary isn't tried while the secondary answers")
+	assert.Equal(t, 10, calls[secondary.String()])
+
+	// After the retry interval one query probes the primary again.
+	now = now.Add(upstreamRetryInterval)
+	query(5)
+	assert.Equal(t, 1, client.takeCalls()[primary.String()])
+
+	// Once it answers again, it is back in front after a few probes.
+	delete(client.broken, primary.String())
+	for history.failing(primary) {
+		now = now.Add(upstreamRetryInterval)
+		query(1)
+	}
+	client.takeCalls()
+	query(10)
+	assert.Equal(t, 10, client.takeCalls()[primary.String()])
+}
+
+func TestUpstreamHistory_Order(t *testing.T) {
+	a := netip.MustParseAddrPort("192.0.2.1:53")
+	b := netip.MustParseAddrPort("192.0.2.2:53")
+	c := netip.MustParseAddrPort("192.0.2.3:53")
+
+	history := newUpstreamHistory()
+	for range upstreamHistoryWindow {
+		history.record(a, false)
+		history.record(b, false)
+		history.record(c, true)
+	}
+
+	assert.Equal(t, upstreamRace{c, a, b}, history.order(upstreamRace{a, b, c}))
+	assert.Equal(t, upstreamRace{a, b}, history.order(upstreamRace{a, b}), "a race of failing upstreams keeps its order")
+	assert.Equal(t, upstreamRace{a}, history.order(upstreamRace{a}))
+
+	var nilHistory *upstreamHistory
+	nilHistory.record(a, false)
+	assert.Equal(t, upstreamRace{a, c}, nilHistory.order(upstreamRace{a, c}))
+}
+
+func TestDefaultServer_UpstreamHistoryPersisted(t *testing.T) {
+	broken := netip.MustParseAddrPort("192.0.2.1:53")
+	good := netip.MustParseAddrPort("192.0.2.2:53")
+	path := filepath.Join(t.TempDir(), "state.json")
+
+	server := newTestServer(nil)
+	server.stateManager = statemanager.New(path)
+	server.loadUpstreamHistory()
+	for range upstreamHistoryWindow {
+		server.upstreamHistory.record(broken, false)
+		server.upstreamHistory.record(good, true)
+	}
+	server.persistUpstreamHistory()
+	require.NoError(t, server.stateManager.PersistState(context.Background()))
+
+	restarted := newTestServer(nil)
+	restarted.stateManager = statemanager.New(path)
+	restarted.loadUpstreamHistory()
+	assert.True(t, restarted.upstreamHistory.failing(broken))
+	assert.False(t, restarted.upstreamHistory.failing(good))
+	assert.Equal(t, upstreamRace{good, broken}, restarted.upstreamHistory.order(upstreamRace{broken, good}),
+		"a restored failing upstream isn't probed right away")
+}
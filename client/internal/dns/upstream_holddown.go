@@ -0,0 +1,158 @@
+package dns
+
+import (
+	"net/netip"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/miekg/dns"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	// envServfailHoldDown enables the SERVFAIL hold-down with a Go duration,
+	// e.g. "5s". Unset or zero keeps it disabled.
+	envServfailHoldDown = "NB_DNS_SERVFAIL_HOLDDOWN"
+	// maxHoldDownEntries bounds the number of held (question, upstream)
+	// pairs per handler so a burst of failing random names can't grow it
+	// without limit.
+	maxHoldDownEntries = 4096
+	// failureReasonHeldDown marks upstreams skipped because they recently
+	// failed the same question.
+	failureReasonHeldDown = "held down"
+)
+
+// holdDownKey identifies a question sent to one upstream.
+type holdDownKey struct {
+	name     string
+	qtype    uint16
+	upstream netip.AddrPort
+}
+
+// holdDownEntry tracks a (question, upstream) pair that recently failed.
+// While it exists, queries for the pair are answered from it instead of
+// contacting the upstream; a background probe removes it once the upstream
+// answers again.
+type holdDownEntry struct {
+	// hit is set when a client query was held since the last probe, so
+	// probing stops once clients stop asking.
+	hit bool
+}
+
+// servfailHoldDownFromEnv returns the hold-down configured through
+// envServfailHoldDown, zero when disabled or invalid.
+func servfailHoldDownFromEnv() time.Duration {
+	val := os.Getenv(envServfailHoldDown)
+	if val == "" {
+		return 0
+	}
+	d, err := time.ParseDuration(val)
+	if err != nil || d < 0 {
+		log.Warnf("invalid %s value %q, SERVFAIL hold-down disabled", envServfailHoldDown, val)
+		return 0
+	}
+	return d
+}
+
+// setServfailHoldDown enables the hold-down: after an upstream fails a
+// question, further queries for it skip that upstream for d while a
+// background probe checks for recovery. Zero disables it. Called only while
+// the handler is built.
+func (u *upstreamResolverBase) setServfailHoldDown(d time.Duration) {
+	u.holdDown = d
+}
+
+func newHoldDownKey(r *dns.Msg, upstream netip.AddrPort) holdDownKey {
+	q := r.Question[0]
+	return holdDownKey{name: strings.ToLower(q.Name), qtype: q.Qtype, upstream: upstream}
+}
+
+// heldDown reports whether upstream recently failed the question in r and
+// marks the entry as still in demand.
+func (u *upstreamResolverBase) heldDown(r *dns.Msg, upstream netip.AddrPort) bool {
+	if u.holdDown <= 0 {
+		return false
+	}
+	u.holdDownMu.Lock()
+	defer u.holdDownMu.Unlock()
+	e, ok := u.holdDowns[newHoldDownKey(r, upstream)]
+	if ok {
+		e.hit = true
+	}
+	return ok
+}
+
+// recordFailure holds down the question in r for upstream and starts a
+// background probe for it, unless one is already running.
+func (u *upstreamResolverBase) recordFailure(r *dns.Msg, upstream netip.AddrPort) {
+	if u.holdDown <= 0 {
+		return
+	}
+	key := newHoldDownKey(r, upstream)
+
+	u.holdDownMu.Lock()
+	defer u.holdDownMu.Unlock()
+	if _, ok := u.holdDowns[key]; ok {
+		return
+	}
+	if u.holdDowns == nil {
+		u.holdDowns = make(map[holdDownKey]*holdDownEntry)
+	}
+	if len(u.holdDowns) >= maxHoldDownEntries {
+		return
+	}
+	u.holdDowns[key] = &holdDownEntry{}
+
+	probe := r.Copy()
+	go u.probeHeldDown(key, probe)
+}
+
+// probeHeldDown re-asks the held upstream once per hold-down period until it
+// answers again or clients stop asking, then releases the entry.
+func (u *upstreamResolverBase) probeHeldDown(key holdDownKey, r *dns.Msg) {
+	ticker := time.NewTicker(u.holdDown)
+	defer ticker.Stop()
+	defer func() {
+		u.holdDownMu.Lock()
+		delete(u.holdDowns, key)
+		u.holdDownMu.Unlock()
+	}()
+
+	for {
+		select {
+		case <-u.ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		if _, failure := u.queryUpstream(u.ctx, r.Copy(), key.upstream, u.timeoutFor(key.upstream, u.upstreamTimeout)); failure == nil {
+			log.Debugf("upstream %s recovered for %s, releasing hold-down", key.upstream, key.name)
+			return
+		}
+
+		u.holdDownMu.Lock()
+		e, ok := u.holdDowns[key]
+		idle := !ok || !e.hit
+		if ok {
+			e.hit = false
+		}
+		u.holdDownMu.Unlock()
+		if idle {
+			return
+		}
+	}
+}
+
+// allHeldDown reports whether every attempt was skipped by the hold-down.
+func allHeldDown(failures []upstreamFailure) bool {
+	if len(failures) == 0 {
+		return false
+	}
+	for _, f := range failures {
+		if f.reason != failureReasonHeldDown {
+			return false
+		}
+	}
+	return true
+}
@@ -84,6 +84,18 @@ func (u *upstreamResolverIOS) exchange(ctx context.Context, upstream string, r *
 	return ExchangeWithFallback(ctx, client, r, upstream)
 }
 
+// doqSupported reports whether DNS over QUIC upstreams can be used. The QUIC
+// dial would bypass the interface binding done in GetClientPrivate.
+func doqSupported() bool {
+	return false
+}
+
+// dotSupported reports whether DNS over TLS upstreams can be used. The TLS
+// dial would bypass the interface binding as well.
+func dotSupported() bool {
+	return false
+}
+
 // GetClientPrivate returns a new DNS client bound to the local IP of the Netbird interface.
 // It selects the v6 bind address when the upstream is IPv6 and the interface has one, otherwise v4.
 func GetClientPrivate(iface privateClientIface, upstreamIP netip.Addr, dialTimeout time.Duration) (*dns.Client, error) {
@@ -0,0 +1,192 @@
+package dns
+
+import (
+	"context"
+	"net/netip"
+	"strconv"
+	"strings"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+
+	nbdns "github.com/netbirdio/netbird/dns"
+)
+
+const (
+	// defaultUpstreamMaxInflight is how many queries may be forwarded to a
+	// nameserver group at once when DefaultServerConfig.UpstreamMaxInflight
+	// is unset.
+	defaultUpstreamMaxInflight = 64
+	// inflightQueueTimeout is how long a query waits for a saturated group
+	// before the group is skipped for it.
+	inflightQueueTimeout = 500 * time.Millisecond
+)
+
+// failureReasonInflightLimit marks groups skipped because they had the
+// maximum number of queries in flight. It says nothing about the upstream.
+const failureReasonInflightLimit = "in-flight limit reached"
+
+// inflightLimiter bounds the queries in flight to the nameservers of one
+// group. It is shared by every handler the group's domains are served by,
+// so a noisy domain can't exhaust a resolver the other domains rely on. A nil
+// limiter doesn't limit.
+type inflightLimiter struct {
+	slots chan struct{}
+}
+
+func newInflightLimiter(limit int) *inflightLimiter {
+	if limit <= 0 {
+		return nil
+	}
+	return &inflightLimiter{slots: make(chan struct{}, limit)}
+}
+
+// acquire takes a slot, waiting at most inflightQueueTimeout for one. It
+// reports false if no slot became free.
+func (l *inflightLimiter) acquire(ctx context.Context) bool {
+	if l == nil {
+		return true
+	}
+	select {
+	case l.slots <- struct{}{}:
+		return true
+	default:
+	}
+
+	timer := time.NewTimer(inflightQueueTimeout)
+	defer timer.Stop()
+	select {
+	case l.slots <- struct{}{}:
+		return true
+	case <-timer.C:
+		return false
+	case <-ctx.Done():
+		return false
+	}
+}
+
+func (l *inflightLimiter) release() {
+	if l != nil {
+		<-l.slots
+	}
+}
+
+// inflight returns the number of queries currently in flight.
+func (l *inflightLimiter) inflight() int {
+	if l == nil {
+		return 0
+	}
+	return len(l.slots)
+}
+
+// limit returns the maximum number of queries in flight, zero if unlimited.
+func (l *inflightLimiter) limit() int {
+	if l == nil {
+		return 0
+	}
+	return cap(l.slots)
+}
+
+// ParseInflightLimits parses per-group limit specs in format key=limit. The
+// key is a match domain or a nameserver address of the groups the limit
+// applies to, "." for primary groups. Invalid specs are logged and skipped.
+func ParseInflightLimits(specs []string) map[string]int {
+	limits := make(map[string]int)
+	for _, spec := range specs {
+		key, value, ok := strings.Cut(spec, "=")
+		key = strings.TrimSpace(key)
+		limit, err := strconv.Atoi(strings.TrimSpace(value))
+		if !ok || key == "" || err != nil {
+			log.Warnf("invalid in-flight limit %q, expected domain=limit or ip=limit", spec)
+			continue
+		}
+		limits[normalizeInflightKey(key)] = limit
+	}
+	return limits
+}
+
+func normalizeInflightKey(key string) string {
+	if addr, err := netip.ParseAddr(key); err == nil {
+		return addr.Unmap().String()
+	}
+	if key == nbdns.RootZone {
+		return key
+	}
+	return strings.ToLower(strings.TrimSuffix(key, "."))
+}
+
+// groupKeys returns the keys per-group settings match group by: "." for a
+// primary group, its match domains and its nameserver addresses, normalized
+// like normalizeInflightKey.
+func groupKeys(group *nbdns.NameServerGroup) []string {
+	var keys []string
+	if group.Primary {
+		keys = append(keys, nbdns.RootZone)
+	}
+	for _, d := range group.Domains {
+		keys = append(keys, normalizeInflightKey(d))
+	}
+	for _, ns := range group.NameServers {
+		keys = append(keys, ns.IP.Unmap().String())
+	}
+	return keys
+}
+
+// inflightLimitFor returns the limit configured for group: the lowest
+// matching per-group limit, or the default. Zero or negative disables the
+// limit.
+func (s *DefaultServer) inflightLimitFor(group *nbdns.NameServerGroup) int {
+	limit, found := 0, false
+	for _, key := range groupKeys(group) {
+		if l, ok := s.groupMaxInflight[key]; ok && (!found || l < limit) {
+			limit, found = l, true
+		}
+	}
+	if found {
+		return limit
+	}
+	if s.upstreamMaxInflight == 0 {
+		return defaultUpstreamMaxInflight
+	}
+	return s.upstreamMaxInflight
+}
+
+// inflightLimiterFor returns the limiter of group, reusing the one of the
+// previous config so queries still in flight keep counting. Must hold s.mux.
+func (s *DefaultServer) inflightLimiterFor(group *nbdns.NameServerGroup, next map[nsGroupID]*inflightLimiter) *inflightLimiter {
+	id := generateGroupKey(group)
+	if l, ok := next[id]; ok {
+		return l
+	}
+
+	limit := s.inflightLimitFor(group)
+	l, ok := s.inflightLimiters[id]
+	if !ok || l.limit() != max(limit, 0) {
+		l = newInflightLimiter(limit)
+	}
+	next[id] = l
+	return l
+}
+
+// inflightCounts returns the queries in flight per group. Must hold s.mux.
+func (s *DefaultServer) inflightCounts() map[nsGroupID]int {
+	counts := make(map[nsGroupID]int, len(s.inflightLimiters))
+	for id, l := range s.inflightLimiters {
+		counts[id] = l.inflight()
+	}
+	return counts
+}
+
+// allInflightLimited reports whether every failure is a group skipped for
+// its in-flight limit.
+func allInflightLimited(failures []upstreamFailure) bool {
+	if len(failures) == 0 {
+		return false
+	}
+	for _, f := range failures {
+		if f.reason != failureReasonInflightLimit {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,200 @@
+package dns
+
+import (
+	"context"
+	"net/netip"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/miekg/dns"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/netbirdio/netbird/client/internal/dns/test"
+	nbdns "github.com/netbirdio/netbird/dns"
+)
+
+// blockingUpstreamClient answers once unblock is closed, or after delay if
+// unblock is nil, and records the most exchanges it saw at once.
+type blockingUpstreamClient struct {
+	unblock  chan struct{}
+	delay    time.Duration
+	answer   *dns.Msg
+	inflight atomic.Int32
+	peak     atomic.Int32
+}
+
+func (c *blockingUpstreamClient) exchange(ctx context.Context, _ string, r *dns.Msg) (*dns.Msg, time.Duration, error) {
+	n := c.inflight.Add(1)
+	defer c.inflight.Add(-1)
+	for {
+		peak := c.peak.Load()
+		if n <= peak || c.peak.CompareAndSwap(peak, n) {
+			break
+		}
+	}
+
+	wait := c.unblock
+	if wait == nil {
+		timer := time.NewTimer(c.delay)
+		defer timer.Stop()
+		wait = make(chan struct{})
+		go func() {
+			<-timer.C
+			close(wait)
+		}()
+	}
+	select {
+	case <-wait:
+	case <-ctx.Done():
+		return nil, 0, ctx.Err()
+	}
+
+	resp := c.answer.Copy()
+	resp.SetReply(r)
+	return resp, time.Millisecond, nil
+}
+
+func newLimitedUpstream(t *testing.T, client upstreamClient, limiter *inflightLimiter) *upstreamResolverBase {
+	t.Helper()
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	handler := &upstreamResolverBase{
+		ctx:             ctx,
+		domain:          "example.com",
+		upstreamClient:  client,
+		upstreamTimeout: UpstreamTimeout,
+	}
+	handler.addLimitedRace([]netip.AddrPort{netip.MustParseAddrPort("192.0.2.1:53")}, limiter)
+	return handler
+}
+
+func serveConcurrently(handler dns.Handler, n int) []*dns.Msg {
+	responses := make([]*dns.Msg, n)
+	var wg sync.WaitGroup
+	for i := range n {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			w := &test.MockResponseWriter{}
+			handler.ServeDNS(w, new(dns.Msg).SetQuestion("app.example.com.", dns.TypeA))
+			responses[i] = w.GetLastResponse()
+		}()
+	}
+	wg.Wait()
+	return responses
+}
+
+func TestUpstreamResolver_InflightLimitEnforced(t *testing.T) {
+	client := &blockingUpstreamClient{
+		unblock: make(chan struct{}),
+		answer:  addressAnswer("app.example.com.", 300, "10.1.2.3"),
+	}
+	limiter := newInflightLimiter(2)
+	handler := newLimitedUpstream(t, client, limiter)
+
+	// Hold the two slots until the queued queries gave up waiting.
+	time.AfterFunc(inflightQueueTimeout+200*time.Millisecond, func() { close(client.unblock) })
+
+	responses := serveConcurrently(handler, 6)
+
+	var answered, refused int
+	for _, resp := range responses {
+		require.NotNil(t, resp, "excess queries must be answered, not dropped")
+		switch resp.Rcode {
+		case dns.RcodeSuccess:
+			answered++
+		case dns.RcodeRefused:
+			refused++
+		default:
+			t.Errorf("unexpected rcode %s", dns.RcodeToString[resp.Rcode])
+		}
+	}
+	assert.Equal(t, 2, answered)
+	assert.Equal(t, 4, refused)
+	assert.EqualValues(t, 2, client.peak.Load(), "at most the limit may be in flight")
+	assert.Zero(t, limiter.inflight(), "slots are released")
+}
+
+func TestUpstreamResolver_InflightLimitQueues(t *testing.T) {
+	client := &blockingUpstreamClient{
+		delay:  50 * time.Millisecond,
+		answer: addressAnswer("app.example.com.", 300, "10.1.2.3"),
+	}
+	handler := newLimitedUpstream(t, client, newInflightLimiter(1))
+
+	for _, resp := range serveConcurrently(handler, 3) {
+		require.NotNil(t, resp)
+		assert.Equal(t, dns.RcodeSuccess, resp.Rcode, "queries waiting for a slot are answered once one frees")
+	}
+	assert.EqualValues(t, 1, client.peak.Load())
+}
+
+func TestParseInflightLimits(t *testing.T) {
+	limits := ParseInflightLimits([]string{
+		"Corp.Example.com.=8",
+		"::ffff:192.0.2.1=4",
+		".=16",
+		"no-limit",
+		"example.org=many",
+		"=3",
+	})
+	assert.Equal(t, map[string]int{
+		"corp.example.com": 8,
+		"192.0.2.1":        4,
+		".":                16,
+	}, limits)
+}
+
+func TestDefaultServer_InflightLimitFor(t *testing.T) {
+	server := newTestServer(nil)
+	server.groupMaxInflight = ParseInflightLimits([]string{"corp.example.com=8", "192.0.2.1=4", ".=16"})
+
+	group := func(primary bool, ip string, domains ...string) *nbdns.NameServerGroup {
+		return &nbdns.NameServerGroup{
+			Primary:     primary,
+			Domains:     domains,
+			NameServers: []nbdns.NameServer{{IP: netip.MustParseAddr(ip), NSType: nbdns.UDPNameServerType, Port: 53}},
+		}
+	}
+
+	assert.Equal(t, defaultUpstreamMaxInflight, server.inflightLimitFor(group(false, "192.0.2.9", "example.org")))
+	assert.Equal(t, 8, server.inflightLimitFor(group(false, "192.0.2.9", "CORP.example.com")))
+	assert.Equal(t, 4, server.inflightLimitFor(group(false, "192.0.2.1", "corp.example.com")), "the lowest match wins")
+	assert.Equal(t, 16, server.inflightLimitFor(group(true, "192.0.2.9")), "\".\" applies to primary groups")
+
+	server.upstreamMaxInflight = -1
+	assert.Equal(t, -1, server.inflightLimitFor(group(false, "192.0.2.9", "example.org")))
+	assert.Nil(t, newInflightLimiter(server.inflightLimitFor(group(false, "192.0.2.9", "example.org"))))
+}
+
+func TestDefaultServer_InflightLimiterSharedByGroup(t *testing.T) {
+	server := newTestServer(nil)
+	server.groupMaxInflight = map[string]int{"corp.example.com": 3}
+
+	groups := []*nbdns.NameServerGroup{{
+		Domains:     []string{"corp.example.com", "lab.example.com"},
+		NameServers: []nbdns.NameServer{{IP: netip.MustParseAddr("192.0.2.1"), NSType: nbdns.UDPNameServerType, Port: 53}},
+	}}
+	updates, err := server.buildUpstreamHandlerUpdate(groups)
+	require.NoError(t, err)
+	require.Len(t, updates, 2)
+
+	require.Len(t, server.inflightLimiters, 1)
+	limiter := server.inflightLimiters[generateGroupKey(groups[0])]
+	require.NotNil(t, limiter)
+	assert.Equal(t, 3, limiter.limit())
+	for _, update := range updates {
+		handler, ok := update.handler.(*upstreamResolver)
+		require.True(t, ok)
+		assert.Same(t, limiter, handler.raceLimiter(0), "both domains share the group's limiter")
+	}
+
+	// A rebuild with the same limit keeps the limiter, so queries in flight
+	// keep counting.
+	_, err = server.buildUpstreamHandlerUpdate(groups)
+	require.NoError(t, err)
+	assert.Same(t, limiter, server.inflightLimiters[generateGroupKey(groups[0])])
+}
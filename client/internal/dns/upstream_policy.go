@@ -0,0 +1,209 @@
+package dns
+
+import (
+	"context"
+	"math/rand/v2"
+	"net/netip"
+	"slices"
+	"strings"
+	"sync/atomic"
+
+	"github.com/miekg/dns"
+	log "github.com/sirupsen/logrus"
+
+	nbdns "github.com/netbirdio/netbird/dns"
+)
+
+// SelectionPolicy is how the nameservers of a group are queried.
+type SelectionPolicy int
+
+const (
+	// SelectionFailover queries the nameservers one at a time, the next
+	// only when the previous one failed. The default.
+	SelectionFailover SelectionPolicy = iota
+	// SelectionQueryAll queries every nameserver at once and takes the
+	// first valid answer, cancelling the other queries.
+	SelectionQueryAll
+	// SelectionRoundRobin fails over like SelectionFailover, but starts
+	// each query at the next nameserver in turn to spread the load.
+	SelectionRoundRobin
+	// SelectionRandom fails over like SelectionFailover, in a random order
+	// per query.
+	SelectionRandom
+)
+
+func (p SelectionPolicy) String() string {
+	switch p {
+	case SelectionQueryAll:
+		return "all"
+	case SelectionRoundRobin:
+		return nbdns.SelectionPolicyRoundRobin
+	case SelectionRandom:
+		return nbdns.SelectionPolicyRandom
+	default:
+		return nbdns.SelectionPolicyFailover
+	}
+}
+
+func parseSelectionPolicy(name string) (SelectionPolicy, bool) {
+	switch strings.ToLower(strings.TrimSpace(name)) {
+	case nbdns.SelectionPolicyFailover:
+		return SelectionFailover, true
+	case "all":
+		return SelectionQueryAll, true
+	case nbdns.SelectionPolicyRoundRobin:
+		return SelectionRoundRobin, true
+	case nbdns.SelectionPolicyRandom:
+		return SelectionRandom, true
+	default:
+		return SelectionFailover, false
+	}
+}
+
+// ParseSelectionPolicies parses per-group policy specs in format key=policy,
+// policy being "failover", "all", "round-robin" or "random". Keys are
+// matched like those of ParseInflightLimits. Invalid specs are logged and
+// skipped.
+func ParseSelectionPolicies(specs []string) map[string]SelectionPolicy {
+	policies := make(map[string]SelectionPolicy)
+	for _, spec := range specs {
+		key, name, ok := strings.Cut(spec, "=")
+		key = strings.TrimSpace(key)
+		policy, valid := parseSelectionPolicy(name)
+		if !ok || key == "" || !valid {
+			log.Warnf("invalid selection policy %q, expected domain=policy or ip=policy with policy failover|all|round-robin|random", spec)
+			continue
+		}
+		policies[normalizeInflightKey(key)] = policy
+	}
+	return policies
+}
+
+// selectionPolicyFor returns the policy configured locally for group, or
+// else the one management set on it. A group matching keys with different
+// policies fails over, querying all of its nameservers must be asked for by
+// every matching key.
+func (s *DefaultServer) selectionPolicyFor(group *nbdns.NameServerGroup) SelectionPolicy {
+	policy, found := SelectionFailover, false
+	for _, key := range groupKeys(group) {
+		p, ok := s.groupSelectionPolicies[key]
+		if !ok {
+			continue
+		}
+		if found && p != policy {
+			return SelectionFailover
+		}
+		policy, found = p, true
+	}
+	if found || group.SelectionPolicy == "" {
+		return policy
+	}
+
+	policy, ok := parseSelectionPolicy(group.SelectionPolicy)
+	if !ok {
+		log.Warnf("unknown selection policy %q of nameserver group for %v, failing over", group.SelectionPolicy, group.Domains)
+	}
+	return policy
+}
+
+// setRacePolicy sets the selection policy of the i-th race. Called only
+// while the handler is built.
+func (u *upstreamResolverBase) setRacePolicy(i int, policy SelectionPolicy) {
+	if policy == SelectionFailover || i >= len(u.upstreamServers) {
+		return
+	}
+	if len(u.racePolicies) <= i {
+		u.racePolicies = append(u.racePolicies, make([]SelectionPolicy, i+1-len(u.racePolicies))...)
+	}
+	u.racePolicies[i] = policy
+	if policy != SelectionRoundRobin {
+		return
+	}
+	if len(u.raceTurns) <= i {
+		u.raceTurns = append(u.raceTurns, make([]*atomic.Uint32, i+1-len(u.raceTurns))...)
+	}
+	u.raceTurns[i] = new(atomic.Uint32)
+}
+
+// raceOrder returns the upstreams of the i-th race in the order the next
+// query tries them: rotated to the next upstream in turn with
+// SelectionRoundRobin, shuffled with SelectionRandom. Failing upstreams are
+// still moved behind the others by the upstream history.
+func (u *upstreamResolverBase) raceOrder(i int, group upstreamRace) upstreamRace {
+	if len(group) < 2 {
+		return group
+	}
+	switch u.racePolicy(i) {
+	case SelectionRoundRobin:
+		start := int((u.raceTurns[i].Add(1) - 1) % uint32(len(group)))
+		if start == 0 {
+			return group
+		}
+		ordered := make(upstreamRace, 0, len(group))
+		ordered = append(ordered, group[start:]...)
+		return append(ordered, group[:start]...)
+	case SelectionRandom:
+		ordered := slices.Clone(group)
+		rand.Shuffle(len(ordered), func(a, b int) {
+			ordered[a], ordered[b] = ordered[b], ordered[a]
+		})
+		return ordered
+	default:
+		return group
+	}
+}
+
+// racePolicy returns the selection policy of the i-th race.
+func (u *upstreamResolverBase) racePolicy(i int) SelectionPolicy {
+	if i < len(u.racePolicies) {
+		return u.racePolicies[i]
+	}
+	return SelectionFailover
+}
+
+type queryAllAttempt struct {
+	res      raceResult
+	upstream netip.AddrPort
+	failure  *upstreamFailure
+}
+
+// queryAll queries every upstream of group that isn't held down at once,
+// taking the first valid answer and cancelling the rest. If none answers,
+// the failures of all of them are returned.
+func (u *upstreamResolverBase) queryAll(ctx context.Context, r *dns.Msg, group upstreamRace) raceResult {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var failures []upstreamFailure
+	// Buffered so the losers never block on send after we returned.
+	attempts := make(chan queryAllAttempt, len(group))
+	pending := 0
+	for _, upstream := range group {
+		if u.heldDown(r, upstream) {
+			failures = append(failures, upstreamFailure{upstream: upstream, reason: failureReasonHeldDown})
+			continue
+		}
+		pending++
+		// Each attempt gets its own copy of the request, the exchange path
+		// mutates EDNS0 options in place.
+		req := r.Copy()
+		go func(upstream netip.AddrPort) {
+			res, failure := u.queryUpstream(ctx, req, upstream, u.timeoutFor(upstream, u.upstreamTimeout))
+			attempts <- queryAllAttempt{res: res, upstream: upstream, failure: failure}
+		}(upstream)
+	}
+
+	for ; pending > 0; pending-- {
+		a := <-attempts
+		if a.failure != nil {
+			if a.failure.reason != failureReasonCanceled {
+				u.recordFailure(r, a.upstream)
+			}
+			failures = append(failures, *a.failure)
+			continue
+		}
+		a.res.failures = failures
+		return a.res
+	}
+	return raceResult{failures: failures}
+}
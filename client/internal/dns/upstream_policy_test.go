@@ -0,0 +1,240 @@
+package dns
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/netip"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/miekg/dns"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/netbirdio/netbird/client/internal/dns/test"
+	nbdns "github.com/netbirdio/netbird/dns"
+)
+
+// cancelTrackingClient wraps mockUpstreamResolverPerServer, recording the
+// upstreams queried and those whose query was cancelled.
+type cancelTrackingClient struct {
+	inner     *mockUpstreamResolverPerServer
+	mu        sync.Mutex
+	queried   []string
+	cancelled []string
+}
+
+func (c *cancelTrackingClient) exchange(ctx context.Context, upstream string, r *dns.Msg) (*dns.Msg, time.Duration, error) {
+	c.mu.Lock()
+	c.queried = append(c.queried, upstream)
+	c.mu.Unlock()
+
+	msg, rtt, err := c.inner.exchange(ctx, upstream, r)
+	if ctx.Err() != nil {
+		c.mu.Lock()
+		c.cancelled = append(c.cancelled, upstream)
+		c.mu.Unlock()
+	}
+	return msg, rtt, err
+}
+
+func TestUpstreamResolver_QueryAll(t *testing.T) {
+	slow := netip.MustParseAddrPort("192.0.2.1:53")
+	failing := netip.MustParseAddrPort("192.0.2.2:53")
+	fast := netip.MustParseAddrPort("192.0.2.3:53")
+	timeoutErr := &net.OpError{Op: "read", Err: fmt.Errorf("i/o timeout")}
+
+	serve := func(t *testing.T, responses map[string]mockUpstreamResponse, policy SelectionPolicy) (*dns.Msg, *cancelTrackingClient, time.Duration) {
+		t.Helper()
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		client := &cancelTrackingClient{inner: &mockUpstreamResolverPerServer{responses: responses, rtt: time.Millisecond}}
+		resolver := &upstreamResolverBase{
+			ctx:             ctx,
+			upstreamClient:  client,
+			upstreamTimeout: 500 * time.Millisecond,
+		}
+		resolver.addRace([]netip.AddrPort{slow, failing, fast})
+		resolver.setRacePolicy(0, policy)
+
+		var resp *dns.Msg
+		w := &test.MockResponseWriter{WriteMsgFunc: func(m *dns.Msg) error { resp = m; return nil }}
+		start := time.Now()
+		resolver.ServeDNS(w, new(dns.Msg).SetQuestion("example.com.", dns.TypeA))
+		require.NotNil(t, resp)
+		return resp, client, time.Since(start)
+	}
+
+	t.Run("first answer wins", func(t *testing.T) {
+		resp, client, elapsed := serve(t, map[string]mockUpstreamResponse{
+			slow.String():    {msg: buildMockResponse(dns.RcodeSuccess, "192.0.2.101"), delay: 300 * time.Millisecond},
+			failing.String(): {msg: buildMockResponse(dns.RcodeServerFailure, "")},
+			fast.String():    {msg: buildMockResponse(dns.RcodeSuccess, "192.0.2.103"), delay: 10 * time.Millisecond},
+		}, SelectionQueryAll)
+
+		assert.Equal(t, dns.RcodeSuccess, resp.Rcode)
+		require.NotEmpty(t, resp.Answer)
+		assert.Contains(t, resp.Answer[0].String(), "192.0.2.103")
+		assert.Less(t, elapsed, 200*time.Millisecond, "must not wait for the slow upstream")
+
+		// The cancelled query returns after ServeDNS, give it a moment.
+		require.Eventually(t, func() bool {
+			client.mu.Lock()
+			defer client.mu.Unlock()
+			return len(client.cancelled) == 1
+		}, time.Second, 5*time.Millisecond)
+		client.mu.Lock()
+		defer client.mu.Unlock()
+		assert.ElementsMatch(t, []string{slow.String(), failing.String(), fast.String()}, client.queried, "every upstream is queried")
+		assert.Equal(t, []string{slow.String()}, client.cancelled, "the losers are cancelled")
+	})
+
+	t.Run("all fail", func(t *testing.T) {
+		resp, client, elapsed := serve(t, map[string]mockUpstreamResponse{
+			slow.String():    {err: timeoutErr, delay: 50 * time.Millisecond},
+			failing.String(): {msg: buildMockResponse(dns.RcodeServerFailure, "")},
+			fast.String():    {msg: buildMockResponse(dns.RcodeRefused, "")},
+		}, SelectionQueryAll)
+
+		assert.Equal(t, dns.RcodeServerFailure, resp.Rcode)
+		assert.Empty(t, resp.Answer)
+		assert.Less(t, elapsed, 200*time.Millisecond, "the failures are reported once every upstream failed")
+		assert.Len(t, client.queried, 3)
+	})
+
+	t.Run("failover queries one at a time", func(t *testing.T) {
+		resp, client, _ := serve(t, map[string]mockUpstreamResponse{
+			slow.String():    {msg: buildMockResponse(dns.RcodeSuccess, "192.0.2.101"), delay: 10 * time.Millisecond},
+			failing.String(): {msg: buildMockResponse(dns.RcodeServerFailure, "")},
+			fast.String():    {msg: buildMockResponse(dns.RcodeSuccess, "192.0.2.103")},
+		}, SelectionFailover)
+
+		assert.Equal(t, dns.RcodeSuccess, resp.Rcode)
+		assert.Equal(t, []string{slow.String()}, client.queried)
+	})
+}
+
+func TestParseSelectionPolicies(t *testing.T) {
+	policies := ParseSelectionPolicies([]string{
+		"Corp.Example.com.=all",
+		"192.0.2.1 = failover",
+		".=ALL",
+		"bogus",
+		"example.org=random",
+		"example.net=Round-Robin",
+		"example.com=sticky",
+		"=all",
+	})
+	assert.Equal(t, map[string]SelectionPolicy{
+		"corp.example.com": SelectionQueryAll,
+		"192.0.2.1":        SelectionFailover,
+		".":                SelectionQueryAll,
+		"example.org":      SelectionRandom,
+		"example.net":      SelectionRoundRobin,
+	}, policies)
+}
+
+func TestDefaultServer_SelectionPolicyFor(t *testing.T) {
+	server := newTestServer(nil)
+	server.groupSelectionPolicies = map[string]SelectionPolicy{
+		"corp.example.com": SelectionQueryAll,
+		"192.0.2.1":        SelectionQueryAll,
+		"192.0.2.2":        SelectionFailover,
+	}
+	group := func(ip string, domains ...string) *nbdns.NameServerGroup {
+		return &nbdns.NameServerGroup{
+			Domains:     domains,
+			NameServers: []nbdns.NameServer{{IP: netip.MustParseAddr(ip), NSType: nbdns.UDPNameServerType, Port: 53}},
+		}
+	}
+
+	assert.Equal(t, SelectionQueryAll, server.selectionPolicyFor(group("192.0.2.9", "corp.example.com")))
+	assert.Equal(t, SelectionQueryAll, server.selectionPolicyFor(group("192.0.2.1", "corp.example.com")))
+	assert.Equal(t, SelectionFailover, server.selectionPolicyFor(group("192.0.2.2", "corp.example.com")), "conflicting keys fail over")
+	assert.Equal(t, SelectionFailover, server.selectionPolicyFor(group("192.0.2.9", "example.org")))
+
+	managed := group("192.0.2.9", "example.org")
+	managed.SelectionPolicy = nbdns.SelectionPolicyRoundRobin
+	assert.Equal(t, SelectionRoundRobin, server.selectionPolicyFor(managed), "the group's own policy applies without a local one")
+	managed.SelectionPolicy = "sticky"
+	assert.Equal(t, SelectionFailover, server.selectionPolicyFor(managed), "unknown policies fail over")
+	overridden := group("192.0.2.9", "corp.example.com")
+	overridden.SelectionPolicy = nbdns.SelectionPolicyRandom
+	assert.Equal(t, SelectionQueryAll, server.selectionPolicyFor(overridden), "the local policy overrides the group's")
+
+	handler := &upstreamResolverBase{}
+	handler.addRace([]netip.AddrPort{netip.MustParseAddrPort("192.0.2.1:53"), netip.MustParseAddrPort("192.0.2.9:53")})
+	failoverID := handler.ID()
+	handler.setRacePolicy(0, SelectionQueryAll)
+	assert.Equal(t, SelectionQueryAll, handler.racePolicy(0))
+	assert.NotEqual(t, failoverID, handler.ID(), "the policy is part of the handler identity")
+}
+
+func TestUpstreamResolver_RoundRobin(t *testing.T) {
+	first := netip.MustParseAddrPort("192.0.2.1:53")
+	dead := netip.MustParseAddrPort("192.0.2.2:53")
+	third := netip.MustParseAddrPort("192.0.2.3:53")
+	timeoutErr := &net.OpError{Op: "read", Err: fmt.Errorf("i/o timeout")}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	client := &cancelTrackingClient{inner: &mockUpstreamResolverPerServer{responses: map[string]mockUpstreamResponse{
+		first.String(): {msg: buildMockResponse(dns.RcodeSuccess, "192.0.2.101")},
+		dead.String():  {err: timeoutErr},
+		third.String(): {msg: buildMockResponse(dns.RcodeSuccess, "192.0.2.103")},
+	}, rtt: time.Millisecond}}
+	resolver := &upstreamResolverBase{
+		ctx:             ctx,
+		upstreamClient:  client,
+		upstreamTimeout: 100 * time.Millisecond,
+	}
+	resolver.addRace([]netip.AddrPort{first, dead, third})
+	resolver.setRacePolicy(0, SelectionRoundRobin)
+
+	answers := make(map[string]int)
+	for i := 0; i < 6; i++ {
+		var resp *dns.Msg
+		w := &test.MockResponseWriter{WriteMsgFunc: func(m *dns.Msg) error { resp = m; return nil }}
+		resolver.ServeDNS(w, new(dns.Msg).SetQuestion(fmt.Sprintf("q%d.example.com.", i), dns.TypeA))
+		require.NotNil(t, resp)
+		require.Equal(t, dns.RcodeSuccess, resp.Rcode, "a timing out upstream moves the query on to the next one")
+		answers[resp.Answer[0].(*dns.A).A.String()]++
+	}
+
+	assert.Equal(t, []string{
+		first.String(),
+		dead.String(), third.String(),
+		third.String(),
+		first.String(),
+		dead.String(), third.String(),
+		third.String(),
+	}, client.queried, "each query starts at the next upstream in turn")
+	assert.Equal(t, map[string]int{"192.0.2.101": 2, "192.0.2.103": 4}, answers)
+
+	verdict, _ := evaluateNSGroupHealth(resolver.UpstreamHealth(), []netip.AddrPort{first, dead, third}, 0, time.Now())
+	assert.Equal(t, nsVerdictHealthy, verdict, "a single dead upstream doesn't deactivate the group")
+}
+
+func TestUpstreamResolver_RandomOrder(t *testing.T) {
+	upstreams := []netip.AddrPort{
+		netip.MustParseAddrPort("192.0.2.1:53"),
+		netip.MustParseAddrPort("192.0.2.2:53"),
+		netip.MustParseAddrPort("192.0.2.3:53"),
+	}
+	resolver := &upstreamResolverBase{}
+	resolver.addRace(upstreams)
+	resolver.setRacePolicy(0, SelectionRandom)
+
+	firsts := make(map[netip.AddrPort]struct{})
+	for i := 0; i < 50; i++ {
+		order := resolver.raceOrder(0, resolver.upstreamServers[0])
+		assert.ElementsMatch(t, upstreams, order, "every upstream is tried once")
+		firsts[order[0]] = struct{}{}
+	}
+	assert.Greater(t, len(firsts), 1, "queries start at different upstreams")
+	assert.Equal(t, upstreamRace(upstreams), resolver.upstreamServers[0], "the configured order is left alone")
+}
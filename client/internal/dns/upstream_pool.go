@@ -0,0 +1,207 @@
+package dns
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/miekg/dns"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	// defaultUpstreamPoolSize is how many idle connections are kept per
+	// upstream and transport when DefaultServerConfig.UpstreamPoolSize is unset.
+	defaultUpstreamPoolSize = 4
+	// defaultUpstreamIdleTimeout closes pooled connections that weren't used
+	// for this long. It stays below the common server-side idle timeouts
+	// (RFC 7766 §6.2.3 suggests 10s) so reuse rarely hits a closed connection.
+	defaultUpstreamIdleTimeout = 8 * time.Second
+)
+
+// connPoolKey identifies the connections to one upstream over one transport.
+type connPoolKey struct {
+	upstream string
+	network  string
+}
+
+type idleConn struct {
+	conn  *dns.Conn
+	since time.Time
+}
+
+// connPool keeps idle stream connections to upstreams so consecutive queries
+// skip the connect (and TLS) handshake. A connection is used by one exchange
+// at a time; concurrent queries dial extra connections, of which at most size
+// per key are kept once they are done.
+type connPool struct {
+	size        int
+	idleTimeout time.Duration
+
+	mu     sync.Mutex
+	idle   map[connPoolKey][]idleConn
+	sweep  *time.Timer
+	closed bool
+}
+
+// newConnPool returns a pool keeping up to size idle connections per key for
+// idleTimeout. Zero values use the defaults; a negative size disables
+// pooling and returns nil, which is safe to use.
+func newConnPool(size int, idleTimeout time.Duration) *connPool {
+	if size < 0 {
+		return nil
+	}
+	if size == 0 {
+		size = defaultUpstreamPoolSize
+	}
+	if idleTimeout <= 0 {
+		idleTimeout = defaultUpstreamIdleTimeout
+	}
+	return &connPool{
+		size:        size,
+		idleTimeout: idleTimeout,
+		idle:        make(map[connPoolKey][]idleConn),
+	}
+}
+
+// exchange sends r to upstream over client's transport on a pooled
+// connection, dialing one when none is idle. A reused connection the upstream
+// closed in the meantime is discarded and the query retried on the next one.
+// A nil pool exchanges on a fresh connection.
+func (p *connPool) exchange(ctx context.Context, client *dns.Client, r *dns.Msg, upstream string) (*dns.Msg, time.Duration, error) {
+	if p == nil {
+		return client.ExchangeContext(ctx, r, upstream)
+	}
+
+	key := connPoolKey{upstream: upstream, network: client.Net}
+	for {
+		conn := p.get(key)
+		reused := conn != nil
+		if !reused {
+			var err error
+			if conn, err = client.DialContext(ctx, upstream); err != nil {
+				return nil, 0, err
+			}
+		}
+
+		rm, t, err := client.ExchangeWithConnContext(ctx, r, conn)
+		if err != nil {
+			_ = conn.Close()
+			if reused && !isTimeout(err) && ctx.Err() == nil {
+				log.Tracef("pooled connection to %s failed, retrying: %v", upstream, err)
+				continue
+			}
+			return nil, t, err
+		}
+
+		p.put(key, conn)
+		return rm, t, nil
+	}
+}
+
+// get returns the most recently used idle connection for key, nil if none
+// is left that hasn't expired.
+func (p *connPool) get(key connPoolKey) *dns.Conn {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	conns := p.idle[key]
+	if len(conns) == 0 {
+		return nil
+	}
+	last := conns[len(conns)-1]
+	if time.Since(last.since) >= p.idleTimeout {
+		// Connections are ordered by last use, so all of them expired.
+		closeIdle(conns)
+		delete(p.idle, key)
+		return nil
+	}
+	p.idle[key] = conns[:len(conns)-1]
+	return last.conn
+}
+
+// put returns conn to the pool, closing the least recently used connection
+// of key when it is full.
+func (p *connPool) put(key connPoolKey, conn *dns.Conn) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.closed {
+		_ = conn.Close()
+		return
+	}
+
+	conns := append(p.idle[key], idleConn{conn: conn, since: time.Now()})
+	if len(conns) > p.size {
+		_ = conns[0].conn.Close()
+		conns = conns[1:]
+	}
+	p.idle[key] = conns
+
+	if p.sweep == nil {
+		p.sweep = time.AfterFunc(p.idleTimeout, p.evict)
+	}
+}
+
+// evict closes expired idle connections and reschedules itself while any
+// connection is left.
+func (p *connPool) evict() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.sweep = nil
+	if p.closed {
+		return
+	}
+
+	var next time.Duration
+	for key, conns := range p.idle {
+		expired := 0
+		for _, c := range conns {
+			if time.Since(c.since) < p.idleTimeout {
+				break
+			}
+			expired++
+		}
+		closeIdle(conns[:expired])
+		if expired == len(conns) {
+			delete(p.idle, key)
+			continue
+		}
+		p.idle[key] = conns[expired:]
+		if left := p.idleTimeout - time.Since(conns[expired].since); next == 0 || left < next {
+			next = left
+		}
+	}
+	if len(p.idle) > 0 {
+		p.sweep = time.AfterFunc(next, p.evict)
+	}
+}
+
+// close closes all idle connections. Connections returned afterwards are
+// closed instead of pooled.
+func (p *connPool) close() {
+	if p == nil {
+		return
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.closed = true
+	if p.sweep != nil {
+		p.sweep.Stop()
+		p.sweep = nil
+	}
+	for key, conns := range p.idle {
+		closeIdle(conns)
+		delete(p.idle, key)
+	}
+}
+
+func closeIdle(conns []idleConn) {
+	for _, c := range conns {
+		if err := c.conn.Close(); err != nil {
+			log.Debugf("close idle upstream connection: %v", err)
+		}
+	}
+}
@@ -0,0 +1,170 @@
+package dns
+
+import (
+	"context"
+	"net"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/miekg/dns"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// countingListener counts the connections accepted from it.
+type countingListener struct {
+	net.Listener
+	accepted atomic.Int32
+}
+
+func (l *countingListener) Accept() (net.Conn, error) {
+	conn, err := l.Listener.Accept()
+	if err == nil {
+		l.accepted.Add(1)
+	}
+	return conn, err
+}
+
+// startPoolTestServer serves A answers over TCP and returns its address and
+// the listener counting accepted connections.
+func startPoolTestServer(tb testing.TB) (string, *countingListener) {
+	tb.Helper()
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(tb, err)
+	counting := &countingListener{Listener: ln}
+
+	server := &dns.Server{
+		Listener: counting,
+		Net:      "tcp",
+		Handler: dns.HandlerFunc(func(w dns.ResponseWriter, r *dns.Msg) {
+			m := new(dns.Msg)
+			m.SetReply(r)
+			m.Answer = append(m.Answer, &dns.A{
+				Hdr: dns.RR_Header{Name: r.Question[0].Name, Rrtype: dns.TypeA, Class: dns.ClassINET, Ttl: 60},
+				A:   net.ParseIP("10.0.0.1"),
+			})
+			_ = w.WriteMsg(m)
+		}),
+	}
+	go func() {
+		_ = server.ActivateAndServe()
+	}()
+	tb.Cleanup(func() {
+		_ = server.Shutdown()
+	})
+
+	return ln.Addr().String(), counting
+}
+
+func TestConnPool_ReusesConnection(t *testing.T) {
+	upstream, listener := startPoolTestServer(t)
+
+	pool := newConnPool(2, time.Minute)
+	defer pool.close()
+
+	client := &dns.Client{Net: protoTCP, Timeout: 2 * time.Second}
+	for i := 0; i < 5; i++ {
+		r := new(dns.Msg).SetQuestion("example.com.", dns.TypeA)
+		rm, _, err := pool.exchange(context.Background(), client, r, upstream)
+		require.NoError(t, err)
+		require.Len(t, rm.Answer, 1)
+	}
+
+	assert.Equal(t, int32(1), listener.accepted.Load(), "sequential queries should share one connection")
+}
+
+func TestConnPool_RetriesClosedConnection(t *testing.T) {
+	upstream, listener := startPoolTestServer(t)
+
+	pool := newConnPool(2, time.Minute)
+	defer pool.close()
+
+	client := &dns.Client{Net: protoTCP, Timeout: 2 * time.Second}
+	r := new(dns.Msg).SetQuestion("example.com.", dns.TypeA)
+	_, _, err := pool.exchange(context.Background(), client, r, upstream)
+	require.NoError(t, err)
+
+	// Simulate the upstream dropping the idle connection.
+	key := connPoolKey{upstream: upstream, network: protoTCP}
+	conn := pool.get(key)
+	require.NotNil(t, conn)
+	require.NoError(t, conn.Close())
+	pool.put(key, conn)
+
+	rm, _, err := pool.exchange(context.Background(), client, r, upstream)
+	require.NoError(t, err)
+	require.Len(t, rm.Answer, 1)
+	assert.Equal(t, int32(2), listener.accepted.Load())
+}
+
+func TestConnPool_EvictsIdleConnections(t *testing.T) {
+	upstream, _ := startPoolTestServer(t)
+
+	pool := newConnPool(2, 50*time.Millisecond)
+	defer pool.close()
+
+	client := &dns.Client{Net: protoTCP, Timeout: 2 * time.Second}
+	r := new(dns.Msg).SetQuestion("example.com.", dns.TypeA)
+	_, _, err := pool.exchange(context.Background(), client, r, upstream)
+	require.NoError(t, err)
+
+	require.Eventually(t, func() bool {
+		pool.mu.Lock()
+		defer pool.mu.Unlock()
+		return len(pool.idle) == 0
+	}, 2*time.Second, 10*time.Millisecond)
+}
+
+func TestConnPool_LimitsIdleConnections(t *testing.T) {
+	upstream, _ := startPoolTestServer(t)
+
+	pool := newConnPool(2, time.Minute)
+	defer pool.close()
+
+	client := &dns.Client{Net: protoTCP, Timeout: 2 * time.Second}
+	key := connPoolKey{upstream: upstream, network: protoTCP}
+	for i := 0; i < 4; i++ {
+		conn, err := client.Dial(upstream)
+		require.NoError(t, err)
+		pool.put(key, conn)
+	}
+
+	pool.mu.Lock()
+	defer pool.mu.Unlock()
+	assert.Len(t, pool.idle[key], 2)
+}
+
+func TestNewConnPool_Disabled(t *testing.T) {
+	assert.Nil(t, newConnPool(-1, 0))
+
+	pool := newConnPool(0, 0)
+	require.NotNil(t, pool)
+	assert.Equal(t, defaultUpstreamPoolSize, pool.size)
+	assert.Equal(t, defaultUpstreamIdleTimeout, pool.idleTimeout)
+}
+
+func BenchmarkExchangeTCP(b *testing.B) {
+	upstream, _ := startPoolTestServer(b)
+	client := &dns.Client{Net: protoTCP, Timeout: 2 * time.Second}
+	r := new(dns.Msg).SetQuestion("example.com.", dns.TypeA)
+
+	for _, bc := range []struct {
+		name string
+		pool *connPool
+	}{
+		{name: "fresh connection", pool: nil},
+		{name: "pooled connection", pool: newConnPool(defaultUpstreamPoolSize, time.Minute)},
+	} {
+		b.Run(bc.name, func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				if _, _, err := bc.pool.exchange(context.Background(), client, r, upstream); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+		bc.pool.close()
+	}
+}
@@ -2,10 +2,12 @@ package dns
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"net"
 	"net/netip"
 	"strings"
+	"sync"
 	"sync/atomic"
 	"testing"
 	"time"
@@ -17,7 +19,9 @@ import (
 
 	"github.com/netbirdio/netbird/client/iface/device"
 	"github.com/netbirdio/netbird/client/iface/wgaddr"
+	"github.com/netbirdio/netbird/client/internal/dns/resutil"
 	"github.com/netbirdio/netbird/client/internal/dns/test"
+	nbdns "github.com/netbirdio/netbird/dns"
 )
 
 func TestUpstreamResolver_ServeDNS(t *testing.T) {
@@ -1035,3 +1039,427 @@ func TestUpstreamResolver_NonRetryableEDEShortCircuits(t *testing.T) {
 		assert.False(t, isOPT, "synthetic OPT must not leak to a non-EDNS0 client")
 	}
 }
+
+func TestFailureEDE(t *testing.T) {
+	upstream := netip.MustParseAddrPort("192.0.2.1:53")
+	timeout := upstreamFailure{upstream: upstream, reason: "timeout after 2s", network: true, timeout: true}
+	refused := upstreamFailure{upstream: upstream, reason: "connection refused", network: true}
+	servfail := upstreamFailure{upstream: upstream, reason: "SERVFAIL"}
+	canceled := upstreamFailure{upstream: upstream, reason: failureReasonCanceled}
+
+	tests := []struct {
+		name     string
+		failures []upstreamFailure
+		wantOK   bool
+		wantCode uint16
+	}{
+		{name: "no failures"},
+		{name: "only canceled", failures: []upstreamFailure{canceled}},
+		{name: "rcode failures only", failures: []upstreamFailure{servfail, servfail}},
+		{name: "all timeouts", failures: []upstreamFailure{timeout, timeout}, wantOK: true, wantCode: dns.ExtendedErrorCodeNoReachableAuthority},
+		{name: "timeouts and canceled", failures: []upstreamFailure{timeout, canceled}, wantOK: true, wantCode: dns.ExtendedErrorCodeNoReachableAuthority},
+		{name: "connection error", failures: []upstreamFailure{refused}, wantOK: true, wantCode: dns.ExtendedErrorCodeNetworkError},
+		{name: "timeout and servfail", failures: []upstreamFailure{timeout, servfail}, wantOK: true, wantCode: dns.ExtendedErrorCodeNetworkError},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			code, ok := failureEDE(tc.failures)
+			assert.Equal(t, tc.wantOK, ok)
+			assert.Equal(t, tc.wantCode, code)
+		})
+	}
+}
+
+func TestUpstreamResolver_ErrorResponseCarriesEDE(t *testing.T) {
+	upstream1 := netip.MustParseAddrPort("192.0.2.1:53")
+	upstream2 := netip.MustParseAddrPort("192.0.2.2:53")
+
+	tests := []struct {
+		name      string
+		responses map[string]mockUpstreamResponse
+		edns      bool
+		wantEDE   bool
+		wantCode  uint16
+	}{
+		{
+			name: "all upstreams time out",
+			responses: map[string]mockUpstreamResponse{
+				upstream1.String(): {err: context.DeadlineExceeded},
+				upstream2.String(): {err: context.DeadlineExceeded},
+			},
+			edns:     true,
+			wantEDE:  true,
+			wantCode: dns.ExtendedErrorCodeNoReachableAuthority,
+		},
+		{
+			name: "upstream unreachable",
+			responses: map[string]mockUpstreamResponse{
+				upstream1.String(): {err: errors.New("connection refused")},
+				upstream2.String(): {err: context.DeadlineExceeded},
+			},
+			edns:     true,
+			wantEDE:  true,
+			wantCode: dns.ExtendedErrorCodeNetworkError,
+		},
+		{
+			name: "upstreams answer servfail",
+			responses: map[string]mockUpstreamResponse{
+				upstream1.String(): {msg: buildMockResponse(dns.RcodeServerFailure, "")},
+				upstream2.String(): {msg: buildMockResponse(dns.RcodeServerFailure, "")},
+			},
+			edns: true,
+		},
+		{
+			name: "client without edns0",
+			responses: map[string]mockUpstreamResponse{
+				upstream1.String(): {err: context.DeadlineExceeded},
+				upstream2.String(): {err: context.DeadlineExceeded},
+			},
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+
+			resolver := &upstreamResolverBase{
+				ctx:             ctx,
+				upstreamClient:  &mockUpstreamResolverPerServer{responses: tc.responses, rtt: time.Millisecond},
+				upstreamServers: []upstreamRace{{upstream1, upstream2}},
+				upstreamTimeout: UpstreamTimeout,
+			}
+
+			var written *dns.Msg
+			w := &test.MockResponseWriter{
+				WriteMsgFunc: func(m *dns.Msg) error {
+					written = m
+					return nil
+				},
+			}
+
+			q := new(dns.Msg).SetQuestion("example.com.", dns.TypeA)
+			if tc.edns {
+				q.SetEdns0(dns.DefaultMsgSize, false)
+			}
+			resolver.ServeDNS(w, q)
+
+			require.NotNil(t, written, "response must be written")
+			assert.Equal(t, dns.RcodeServerFailure, written.Rcode)
+
+			ede, ok := resutil.ExtractEDE(written)
+			require.Equal(t, tc.wantEDE, ok, "EDE presence")
+			if tc.wantEDE {
+				assert.Equal(t, tc.wantCode, ede.InfoCode)
+			}
+			if !tc.edns {
+				assert.Nil(t, written.IsEdns0(), "OPT must not leak to a non-EDNS0 client")
+			}
+		})
+	}
+}
+
+// recordingRDClient records the recursion-desired flag of each forwarded query.
+type recordingRDClient struct {
+	mu sync.Mutex
+	rd map[string]bool
+}
+
+func (c *recordingRDClient) exchange(_ context.Context, upstream string, r *dns.Msg) (*dns.Msg, time.Duration, error) {
+	c.mu.Lock()
+	c.rd[upstream] = r.RecursionDesired
+	c.mu.Unlock()
+	return nil, 0, errors.New("connection refused")
+}
+
+func TestUpstreamResolver_NonRecursiveClearsRD(t *testing.T) {
+	recursive := netip.MustParseAddrPort("192.0.2.1:53")
+	authoritative := netip.MustParseAddrPort("192.0.2.2:53")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	client := &recordingRDClient{rd: make(map[string]bool)}
+	resolver := &upstreamResolverBase{
+		ctx:             ctx,
+		upstreamClient:  client,
+		upstreamTimeout: UpstreamTimeout,
+	}
+	resolver.addRace([]netip.AddrPort{recursive})
+	resolver.addRace([]netip.AddrPort{authoritative})
+	resolver.setNonRecursive([]netip.AddrPort{authoritative})
+
+	q := new(dns.Msg).SetQuestion("example.com.", dns.TypeA)
+	resolver.ServeDNS(&test.MockResponseWriter{}, q)
+
+	client.mu.Lock()
+	defer client.mu.Unlock()
+	require.Len(t, client.rd, 2, "both upstreams should be queried")
+	assert.True(t, client.rd[recursive.String()], "RD should be kept for recursive upstreams")
+	assert.False(t, client.rd[authoritative.String()], "RD should be cleared for authoritative-only upstreams")
+	assert.True(t, q.RecursionDesired, "client request must not be mutated")
+}
+
+func TestDefaultServer_AuthoritativeBit(t *testing.T) {
+	upstream := netip.MustParseAddrPort("192.0.2.1:53")
+	authoritativeAnswer := func(rcode int, answer string) *dns.Msg {
+		m := buildMockResponse(rcode, answer)
+		m.Authoritative = true
+		return m
+	}
+
+	server := newTestServer(nil)
+	require.NoError(t, server.UpdateDNSServer(1, nbdns.Config{
+		ServiceEnable: true,
+		CustomZones: []nbdns.CustomZone{{
+			Domain:  "netbird.cloud.",
+			Records: []nbdns.SimpleRecord{{Name: "peer.netbird.cloud.", Type: int(dns.TypeA), Class: nbdns.DefaultClass, TTL: 300, RData: "100.64.0.1"}},
+		}},
+	}))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	for name, resp := range map[string]*dns.Msg{
+		"example.com.": authoritativeAnswer(dns.RcodeSuccess, "192.0.2.100"),
+		"missing.com.": authoritativeAnswer(dns.RcodeNameError, ""),
+	} {
+		handler := &upstreamResolverBase{
+			ctx: ctx,
+			upstreamClient: &mockUpstreamResolverPerServer{
+				responses: map[string]mockUpstreamResponse{upstream.String(): {msg: resp}},
+			},
+			upstreamTimeout: UpstreamTimeout,
+		}
+		handler.addRace([]netip.AddrPort{upstream})
+		server.handlerChain.AddHandler(name, handler, PriorityUpstream)
+	}
+
+	query := func(name string, qtype uint16) *dns.Msg {
+		t.Helper()
+		w := &test.MockResponseWriter{}
+		server.handlerChain.ServeDNS(w, new(dns.Msg).SetQuestion(name, qtype))
+		resp := w.GetLastResponse()
+		require.NotNil(t, resp)
+		return resp
+	}
+
+	for _, tc := range []struct {
+		name  string
+		qtype uint16
+		rcode int
+	}{
+		{"peer.netbird.cloud.", dns.TypeA, dns.RcodeSuccess},
+		{"peer.netbird.cloud.", dns.TypeAAAA, dns.RcodeSuccess},
+		{"missing.netbird.cloud.", dns.TypeA, dns.RcodeNameError},
+	} {
+		resp := query(tc.name, tc.qtype)
+		assert.Equal(t, tc.rcode, resp.Rcode, tc.name)
+		assert.True(t, resp.Authoritative, "local zone answer for %s %s must set AA", tc.name, dns.TypeToString[tc.qtype])
+	}
+
+	for _, tc := range []struct {
+		name  string
+		rcode int
+	}{
+		{"example.com.", dns.RcodeSuccess},
+		{"missing.com.", dns.RcodeNameError},
+	} {
+		resp := query(tc.name, dns.TypeA)
+		assert.Equal(t, tc.rcode, resp.Rcode, tc.name)
+		assert.False(t, resp.Authoritative, "forwarded answer for %s must clear AA", tc.name)
+	}
+}
+
+func TestUpstreamResolver_IDIncludesNonRecursive(t *testing.T) {
+	server := netip.MustParseAddrPort("192.0.2.1:53")
+	newResolver := func() *upstreamResolverBase {
+		r := &upstreamResolverBase{domain: "example.com"}
+		r.addRace([]netip.AddrPort{server})
+		return r
+	}
+
+	recursive := newResolver()
+	authoritative := newResolver()
+	authoritative.setNonRecursive([]netip.AddrPort{server})
+
+	assert.Equal(t, recursive.ID(), newResolver().ID())
+	assert.NotEqual(t, recursive.ID(), authoritative.ID(), "handlers differing only in RD behaviour need distinct IDs")
+}
+
+type switchableUpstreamClient struct {
+	mu      sync.Mutex
+	resp    *dns.Msg
+	queries int
+}
+
+func (c *switchableUpstreamClient) exchange(context.Context, string, *dns.Msg) (*dns.Msg, time.Duration, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.queries++
+	return c.resp.Copy(), time.Millisecond, nil
+}
+
+func (c *switchableUpstreamClient) set(resp *dns.Msg) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.resp = resp
+}
+
+func (c *switchableUpstreamClient) count() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.queries
+}
+
+func TestUpstreamResolver_ServfailHoldDown(t *testing.T) {
+	upstream := netip.MustParseAddrPort("192.0.2.1:53")
+	client := &switchableUpstreamClient{resp: buildMockResponse(dns.RcodeServerFailure, "")}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	resolver := &upstreamResolverBase{
+		ctx:             ctx,
+		upstreamClient:  client,
+		upstreamTimeout: UpstreamTimeout,
+	}
+	resolver.setServfailHoldDown(200 * time.Millisecond)
+	resolver.addRace([]netip.AddrPort{upstream})
+
+	query := func() *dns.Msg {
+		var resp *dns.Msg
+		w := &test.MockResponseWriter{
+			WriteMsgFunc: func(m *dns.Msg) error {
+				resp = m
+				return nil
+			},
+		}
+		r := new(dns.Msg).SetQuestion("example.com.", dns.TypeA)
+		r.SetEdns0(dns.DefaultMsgSize, false)
+		resolver.ServeDNS(w, r)
+		require.NotNil(t, resp, "should write a response")
+		return resp
+	}
+
+	// A client retrying rapidly against the dead upstream only reaches it once.
+	for range 20 {
+		resp := query()
+		assert.Equal(t, dns.RcodeServerFailure, resp.Rcode)
+	}
+	assert.Equal(t, 1, client.count(), "retries during the hold-down must not reach the upstream")
+
+	held := query()
+	opt := held.IsEdns0()
+	require.NotNil(t, opt, "held answer should carry an EDE")
+	require.Len(t, opt.Option, 1)
+	assert.Equal(t, dns.ExtendedErrorCodeCachedError, opt.Option[0].(*dns.EDNS0_EDE).InfoCode)
+
+	// Other questions are not affected by the hold-down.
+	client.set(buildMockResponse(dns.RcodeSuccess, "192.0.2.100"))
+	w := &test.MockResponseWriter{}
+	resolver.ServeDNS(w, new(dns.Msg).SetQuestion("example.com.", dns.TypeAAAA))
+	require.NotNil(t, w.GetLastResponse())
+	assert.Equal(t, dns.RcodeSuccess, w.GetLastResponse().Rcode)
+
+	// The background probe releases the hold-down once the upstream recovers.
+	assert.Eventually(t, func() bool {
+		return query().Rcode == dns.RcodeSuccess
+	}, 2*time.Second, 50*time.Millisecond)
+}
+
+func TestUpstreamResolver_ServfailHoldDownDisabled(t *testing.T) {
+	upstream := netip.MustParseAddrPort("192.0.2.1:53")
+	client := &switchableUpstreamClient{resp: buildMockResponse(dns.RcodeServerFailure, "")}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	resolver := &upstreamResolverBase{
+		ctx:             ctx,
+		upstreamClient:  client,
+		upstreamTimeout: UpstreamTimeout,
+	}
+	resolver.addRace([]netip.AddrPort{upstream})
+
+	for range 5 {
+		resolver.ServeDNS(&test.MockResponseWriter{}, new(dns.Msg).SetQuestion("example.com.", dns.TypeA))
+	}
+	assert.Equal(t, 5, client.count(), "every retry should reach the upstream without a hold-down")
+}
+
+// fallbackExchangeClient queries like the platform clients do, through
+// exchangeWithFallback.
+type fallbackExchangeClient struct {
+	udpQueries atomic.Int32
+}
+
+func (c *fallbackExchangeClient) exchange(ctx context.Context, upstream string, r *dns.Msg) (*dns.Msg, time.Duration, error) {
+	if dnsProtocolFromContext(ctx) != protoTCP {
+		c.udpQueries.Add(1)
+	}
+	return ExchangeWithFallback(ctx, &dns.Client{Timeout: 2 * time.Second}, r, upstream)
+}
+
+func TestUpstreamResolver_TCPServers(t *testing.T) {
+	tcpLn, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	tcpServer := &dns.Server{
+		Listener: tcpLn,
+		Net:      "tcp",
+		Handler: dns.HandlerFunc(func(w dns.ResponseWriter, r *dns.Msg) {
+			m := new(dns.Msg).SetReply(r)
+			m.Answer = []dns.RR{&dns.A{
+				Hdr: dns.RR_Header{Name: r.Question[0].Name, Rrtype: dns.TypeA, Class: dns.ClassINET, Ttl: 60},
+				A:   net.ParseIP("10.0.0.4"),
+			}}
+			_ = w.WriteMsg(m)
+		}),
+	}
+	go func() { _ = tcpServer.ActivateAndServe() }()
+	defer func() { _ = tcpServer.Shutdown() }()
+	addr := netip.MustParseAddrPort(tcpLn.Addr().String())
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	client := &fallbackExchangeClient{}
+	resolver := &upstreamResolverBase{
+		ctx:             ctx,
+		cancel:          cancel,
+		upstreamClient:  client,
+		upstreamTimeout: UpstreamTimeout,
+	}
+	resolver.addRace([]netip.AddrPort{addr})
+	udpID := resolver.ID()
+	resolver.setTCP([]netip.AddrPort{addr})
+	assert.NotEqual(t, udpID, resolver.ID(), "the transport is part of the handler identity")
+
+	var written *dns.Msg
+	w := &test.MockResponseWriter{
+		WriteMsgFunc: func(m *dns.Msg) error {
+			written = m
+			return nil
+		},
+	}
+	resolver.ServeDNS(w, new(dns.Msg).SetQuestion("example.com.", dns.TypeA))
+
+	require.NotNil(t, written)
+	assert.Equal(t, dns.RcodeSuccess, written.Rcode)
+	require.Len(t, written.Answer, 1)
+	assert.Equal(t, "10.0.0.4", written.Answer[0].(*dns.A).A.String())
+	assert.Zero(t, client.udpQueries.Load(), "tcp servers must not be queried over UDP")
+	assert.True(t, resolver.UpstreamHealth()[addr].LastFail.IsZero())
+}
+
+func TestNameServerType_TCP(t *testing.T) {
+	assert.Equal(t, nbdns.TCPNameServerType, nbdns.ToNameServerType("tcp"))
+	assert.Equal(t, "tcp", nbdns.TCPNameServerType.String())
+	assert.True(t, supportedNameServerType(nbdns.TCPNameServerType))
+
+	ns := []nbdns.NameServer{
+		{IP: netip.MustParseAddr("192.0.2.1"), NSType: nbdns.UDPNameServerType, Port: 53},
+		{IP: netip.MustParseAddr("192.0.2.2"), NSType: nbdns.TCPNameServerType, Port: 53},
+	}
+	filtered := []netip.AddrPort{ns[0].AddrPort(), ns[1].AddrPort()}
+	assert.Equal(t, []netip.AddrPort{ns[1].AddrPort()}, nameServersOfType(ns, filtered, nbdns.TCPNameServerType))
+}
@@ -0,0 +1,31 @@
+package dns
+
+import (
+	"net/netip"
+	"time"
+)
+
+// setQueryTimeout makes each of servers get timeout to answer a query
+// instead of the handler's default. Timeouts are capped at UpstreamTimeout,
+// zero keeps the default. Called only while the handler is built.
+func (u *upstreamResolverBase) setQueryTimeout(servers []netip.AddrPort, timeout time.Duration) {
+	if timeout <= 0 {
+		return
+	}
+	timeout = min(timeout, UpstreamTimeout)
+	if u.queryTimeouts == nil {
+		u.queryTimeouts = make(map[netip.AddrPort]time.Duration, len(servers))
+	}
+	for _, s := range servers {
+		u.queryTimeouts[s] = timeout
+	}
+}
+
+// timeoutFor returns the timeout configured for upstream, or fallback if
+// there is none.
+func (u *upstreamResolverBase) timeoutFor(upstream netip.AddrPort, fallback time.Duration) time.Duration {
+	if timeout, ok := u.queryTimeouts[upstream]; ok {
+		return timeout
+	}
+	return fallback
+}
@@ -0,0 +1,99 @@
+package dns
+
+import (
+	"context"
+	"net/netip"
+	"testing"
+	"time"
+
+	"github.com/miekg/dns"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/netbirdio/netbird/client/internal/dns/test"
+)
+
+func TestUpstreamResolver_QueryTimeout(t *testing.T) {
+	slow := netip.MustParseAddrPort("192.0.2.1:53")
+	fast := netip.MustParseAddrPort("192.0.2.2:53")
+	answer := new(dns.Msg).SetReply(new(dns.Msg).SetQuestion("example.com.", dns.TypeA))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	resolver := &upstreamResolverBase{
+		ctx:    ctx,
+		cancel: cancel,
+		upstreamClient: &mockUpstreamResolverPerServer{responses: map[string]mockUpstreamResponse{
+			slow.String(): {msg: answer, delay: time.Second},
+			fast.String(): {msg: answer},
+		}},
+		upstreamTimeout: UpstreamTimeout,
+	}
+	resolver.addRace([]netip.AddrPort{slow, fast})
+	defaultID := resolver.ID()
+	resolver.setQueryTimeout([]netip.AddrPort{slow}, 100*time.Millisecond)
+	assert.NotEqual(t, defaultID, resolver.ID(), "the timeout is part of the handler identity")
+
+	var written *dns.Msg
+	start := time.Now()
+	resolver.ServeDNS(&test.MockResponseWriter{
+		WriteMsgFunc: func(m *dns.Msg) error {
+			written = m
+			return nil
+		},
+	}, new(dns.Msg).SetQuestion("example.com.", dns.TypeA))
+
+	require.NotNil(t, written)
+	assert.Equal(t, dns.RcodeSuccess, written.Rcode)
+	assert.Less(t, time.Since(start), time.Second, "the slow upstream is given up on after its group's timeout")
+	health := resolver.UpstreamHealth()
+	assert.Contains(t, health[slow].LastErr, "timeout")
+	assert.Equal(t, 1, health[slow].ConsecutiveFails)
+	assert.Zero(t, health[fast].ConsecutiveFails)
+}
+
+func TestUpstreamResolver_QueryTimeoutBounds(t *testing.T) {
+	upstream := netip.MustParseAddrPort("192.0.2.1:53")
+	resolver := &upstreamResolverBase{upstreamTimeout: UpstreamTimeout}
+
+	resolver.setQueryTimeout([]netip.AddrPort{upstream}, 0)
+	assert.Equal(t, time.Second, resolver.timeoutFor(upstream, time.Second), "unset keeps the default")
+
+	resolver.setQueryTimeout([]netip.AddrPort{upstream}, time.Minute)
+	assert.Equal(t, UpstreamTimeout, resolver.timeoutFor(upstream, time.Second))
+}
+
+func TestUpstreamHealth_ConsecutiveFails(t *testing.T) {
+	upstream := netip.MustParseAddrPort("192.0.2.1:53")
+	resolver := &upstreamResolverBase{}
+
+	resolver.markUpstreamFail(upstream, "timeout")
+	resolver.markUpstreamFail(upstream, "timeout")
+	assert.Equal(t, 2, resolver.UpstreamHealth()[upstream].ConsecutiveFails)
+
+	resolver.markUpstreamOk(upstream)
+	assert.Zero(t, resolver.UpstreamHealth()[upstream].ConsecutiveFails, "a success resets the count")
+}
+
+func TestEvaluateNSGroupHealth_DeactivationThreshold(t *testing.T) {
+	now := time.Now()
+	a := netip.MustParseAddrPort("192.0.2.1:53")
+	b := netip.MustParseAddrPort("192.0.2.2:53")
+	failing := func(fails int) UpstreamHealth {
+		return UpstreamHealth{LastFail: now.Add(-time.Second), LastErr: "timeout", ConsecutiveFails: fails}
+	}
+
+	verdict, err := evaluateNSGroupHealth(map[netip.AddrPort]UpstreamHealth{a: failing(2)}, []netip.AddrPort{a}, 3, now)
+	assert.Equal(t, nsVerdictUndecided, verdict, "failures below the threshold don't deactivate the group")
+	assert.NoError(t, err)
+
+	verdict, err = evaluateNSGroupHealth(map[netip.AddrPort]UpstreamHealth{a: failing(3)}, []netip.AddrPort{a}, 3, now)
+	assert.Equal(t, nsVerdictUnhealthy, verdict)
+	assert.Error(t, err)
+
+	verdict, _ = evaluateNSGroupHealth(map[netip.AddrPort]UpstreamHealth{a: failing(1), b: failing(5)}, []netip.AddrPort{a, b}, 3, now)
+	assert.Equal(t, nsVerdictUnhealthy, verdict, "one upstream over the threshold is enough")
+
+	verdict, _ = evaluateNSGroupHealth(map[netip.AddrPort]UpstreamHealth{a: failing(1)}, []netip.AddrPort{a}, 0, now)
+	assert.Equal(t, nsVerdictUnhealthy, verdict, "without a threshold the first failure counts")
+}
@@ -0,0 +1,232 @@
+package dns
+
+import (
+	"context"
+	"fmt"
+	"net/netip"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/miekg/dns"
+	log "github.com/sirupsen/logrus"
+
+	"github.com/netbirdio/netbird/client/internal/dns/local"
+	nbdns "github.com/netbirdio/netbird/dns"
+	"github.com/netbirdio/netbird/shared/management/domain"
+)
+
+const (
+	// defaultMirrorRefreshInterval is how often mirrored zones are transferred
+	// again when DefaultServerConfig.MirrorRefreshInterval is unset.
+	defaultMirrorRefreshInterval = 5 * time.Minute
+	// minMirrorRefreshInterval bounds how often the authoritative server is asked for a transfer.
+	minMirrorRefreshInterval = 10 * time.Second
+	// mirrorTransferTimeout bounds a single zone transfer.
+	mirrorTransferTimeout = 10 * time.Second
+)
+
+// MirroredZone is a zone answered from a local copy that is kept in sync with
+// an authoritative server through zone transfers (AXFR). It is meant for an
+// authoritative server running on the same host, so lookups for the zone
+// don't go through the loopback path to it.
+type MirroredZone struct {
+	// Domain is the zone apex, e.g. "corp.example.com".
+	Domain string
+	// Server is the address of the authoritative server, e.g. 127.0.0.1:5353.
+	// It must allow zone transfers to this host.
+	Server netip.AddrPort
+}
+
+// ParseMirroredZones parses zone specs in format zone=ip:port. Invalid specs
+// are logged and skipped.
+func ParseMirroredZones(specs []string) []MirroredZone {
+	var zones []MirroredZone
+	for _, spec := range specs {
+		zone, server, ok := strings.Cut(spec, "=")
+		if !ok || zone == "" {
+			log.Warnf("invalid mirrored zone %q, expected zone=ip:port", spec)
+			continue
+		}
+		addr, err := netip.ParseAddrPort(server)
+		if err != nil {
+			log.Warnf("invalid mirrored zone %q: %v", spec, err)
+			continue
+		}
+		zones = append(zones, MirroredZone{Domain: zone, Server: addr})
+	}
+	return zones
+}
+
+// zoneTransferFunc fetches all records of zone from server.
+type zoneTransferFunc func(ctx context.Context, zone string, server netip.AddrPort) ([]dns.RR, error)
+
+// zoneMirror keeps the last successfully transferred copy of each mirrored
+// zone and serves them through its own local resolver. A failed transfer keeps
+// serving the previous copy.
+type zoneMirror struct {
+	zones    []MirroredZone
+	interval time.Duration
+	transfer zoneTransferFunc
+	resolver *local.Resolver
+	// onReady is called once per zone after its first successful transfer.
+	onReady func(zone domain.Domain)
+
+	mu     sync.Mutex
+	copies map[domain.Domain][]nbdns.SimpleRecord
+}
+
+func newZoneMirror(zones []MirroredZone, interval time.Duration) *zoneMirror {
+	if interval <= 0 {
+		interval = defaultMirrorRefreshInterval
+	}
+	if interval < minMirrorRefreshInterval {
+		log.Warnf("zone mirror refresh interval %v is below the minimum, using %v", interval, minMirrorRefreshInterval)
+		interval = minMirrorRefreshInterval
+	}
+	return &zoneMirror{
+		zones:    zones,
+		interval: interval,
+		transfer: axfr,
+		resolver: local.NewResolver(),
+		copies:   make(map[domain.Domain][]nbdns.SimpleRecord),
+	}
+}
+
+// run syncs all zones immediately and then every interval until ctx is done.
+func (m *zoneMirror) run(ctx context.Context) {
+	m.sync(ctx)
+
+	ticker := time.NewTicker(m.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			m.sync(ctx)
+		}
+	}
+}
+
+// sync transfers every zone and applies the resulting copies to the resolver.
+func (m *zoneMirror) sync(ctx context.Context) {
+	var ready []domain.Domain
+	for _, zone := range m.zones {
+		apex := domain.Domain(strings.ToLower(dns.Fqdn(zone.Domain)))
+
+		tctx, cancel := context.WithTimeout(ctx, mirrorTransferTimeout)
+		rrs, err := m.transfer(tctx, string(apex), zone.Server)
+		cancel()
+		if err != nil {
+			log.Warnf("mirror zone %s from %s: %v", apex.SafeString(), zone.Server, err)
+			continue
+		}
+
+		m.mu.Lock()
+		_, had := m.copies[apex]
+		m.copies[apex] = toSimpleRecords(rrs)
+		m.mu.Unlock()
+
+		if !had {
+			ready = append(ready, apex)
+		}
+		log.Debugf("mirrored zone %s from %s: %d records", apex.SafeString(), zone.Server, len(rrs))
+	}
+
+	m.resolver.Update(m.customZones())
+
+	if m.onReady != nil {
+		for _, apex := range ready {
+			m.onReady(apex)
+		}
+	}
+}
+
+func (m *zoneMirror) customZones() []nbdns.CustomZone {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	zones := make([]nbdns.CustomZone, 0, len(m.copies))
+	for apex, records := range m.copies {
+		zones = append(zones, nbdns.CustomZone{Domain: string(apex), Records: records})
+	}
+	return zones
+}
+
+// toSimpleRecords converts transferred records to the local resolver format.
+func toSimpleRecords(rrs []dns.RR) []nbdns.SimpleRecord {
+	records := make([]nbdns.SimpleRecord, 0, len(rrs))
+	for _, rr := range rrs {
+		hdr := rr.Header()
+		records = append(records, nbdns.SimpleRecord{
+			Name:  strings.ToLower(hdr.Name),
+			Type:  int(hdr.Rrtype),
+			Class: dns.ClassToString[hdr.Class],
+			TTL:   int(hdr.Ttl),
+			RData: strings.TrimSpace(strings.TrimPrefix(rr.String(), hdr.String())),
+		})
+	}
+	return records
+}
+
+// axfr transfers zone from server over TCP.
+func axfr(ctx context.Context, zone string, server netip.AddrPort) ([]dns.RR, error) {
+	msg := new(dns.Msg)
+	msg.SetAxfr(zone)
+
+	tr := &dns.Transfer{}
+	if deadline, ok := ctx.Deadline(); ok {
+		timeout := time.Until(deadline)
+		tr.DialTimeout, tr.ReadTimeout, tr.WriteTimeout = timeout, timeout, timeout
+	}
+
+	envelopes, err := tr.In(msg, server.String())
+	if err != nil {
+		return nil, fmt.Errorf("start transfer: %w", err)
+	}
+
+	// Drain the channel even after an error so the transfer goroutine exits.
+	var rrs []dns.RR
+	var transferErr error
+	for env := range envelopes {
+		if env.Error != nil {
+			transferErr = env.Error
+			continue
+		}
+		rrs = append(rrs, env.RR...)
+	}
+	if transferErr != nil {
+		return nil, fmt.Errorf("transfer: %w", transferErr)
+	}
+	if len(rrs) == 0 {
+		return nil, fmt.Errorf("transfer returned no records")
+	}
+	return rrs, nil
+}
+
+// startZoneMirror starts syncing the configured mirrored zones. Each zone is
+// registered in the handler chain once its first transfer succeeded, so the
+// zone keeps going to its upstream until a local copy exists.
+func (s *DefaultServer) startZoneMirror() {
+	if s.zoneMirror == nil {
+		return
+	}
+
+	mirror := s.zoneMirror
+	mirror.onReady = s.registerMirroredZone
+
+	log.Infof("mirroring %d zone(s), refreshing every %v", len(mirror.zones), mirror.interval)
+	s.shutdownWg.Add(1)
+	go func() {
+		defer s.shutdownWg.Done()
+		mirror.run(s.ctx)
+	}()
+}
+
+// registerMirroredZone routes zone to the mirror's local copy.
+func (s *DefaultServer) registerMirroredZone(zone domain.Domain) {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	s.registerHandler([]string{zone.PunycodeString()}, s.zoneMirror.resolver, PriorityMirror)
+}
@@ -0,0 +1,82 @@
+package dns
+
+import (
+	"context"
+	"errors"
+	"net/netip"
+	"testing"
+
+	"github.com/miekg/dns"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/netbirdio/netbird/client/internal/dns/test"
+)
+
+func TestParseMirroredZones(t *testing.T) {
+	zones := ParseMirroredZones([]string{
+		"corp.example.com=127.0.0.1:5353",
+		"missing-server",
+		"bad.example.com=localhost:53",
+		"=127.0.0.1:53",
+		"lab.example.com=[::1]:53",
+	})
+
+	assert.Equal(t, []MirroredZone{
+		{Domain: "corp.example.com", Server: netip.MustParseAddrPort("127.0.0.1:5353")},
+		{Domain: "lab.example.com", Server: netip.MustParseAddrPort("[::1]:53")},
+	}, zones)
+}
+
+func TestZoneMirror_ServesLastGoodCopy(t *testing.T) {
+	server := newTestServer(nil)
+	mirror := newZoneMirror([]MirroredZone{
+		{Domain: "corp.example.com", Server: netip.MustParseAddrPort("127.0.0.1:5353")},
+	}, 0)
+	server.zoneMirror = mirror
+	mirror.onReady = server.registerMirroredZone
+
+	query := func() *dns.Msg {
+		t.Helper()
+		r := new(dns.Msg).SetQuestion("host.corp.example.com.", dns.TypeA)
+		w := &test.MockResponseWriter{}
+		server.handlerChain.ServeDNS(w, r)
+		return w.GetLastResponse()
+	}
+
+	// Nothing is registered until the first transfer succeeds, so the zone
+	// keeps going to its upstream instead of being answered with NXDOMAIN.
+	mirror.transfer = func(context.Context, string, netip.AddrPort) ([]dns.RR, error) {
+		return nil, errors.New("connection refused")
+	}
+	mirror.sync(context.Background())
+	resp := query()
+	require.NotNil(t, resp)
+	assert.Equal(t, dns.RcodeRefused, resp.Rcode, "zone must not be answered before its first transfer")
+
+	mirror.transfer = func(_ context.Context, zone string, _ netip.AddrPort) ([]dns.RR, error) {
+		assert.Equal(t, "corp.example.com.", zone)
+		soa, err := dns.NewRR("corp.example.com. 3600 IN SOA ns.corp.example.com. admin.corp.example.com. 1 7200 3600 1209600 300")
+		require.NoError(t, err)
+		a, err := dns.NewRR("host.corp.example.com. 300 IN A 10.1.2.3")
+		require.NoError(t, err)
+		return []dns.RR{soa, a, soa}, nil
+	}
+	mirror.sync(context.Background())
+
+	resp = query()
+	require.NotNil(t, resp)
+	require.Len(t, resp.Answer, 1)
+	assert.Equal(t, "10.1.2.3", resp.Answer[0].(*dns.A).A.String())
+
+	// A failed refresh keeps serving the previous copy.
+	mirror.transfer = func(context.Context, string, netip.AddrPort) ([]dns.RR, error) {
+		return nil, errors.New("connection refused")
+	}
+	mirror.sync(context.Background())
+
+	resp = query()
+	require.NotNil(t, resp)
+	require.Len(t, resp.Answer, 1)
+	assert.Equal(t, "10.1.2.3", resp.Answer[0].(*dns.A).A.String())
+}
@@ -0,0 +1,205 @@
+package dns
+
+import (
+	"context"
+	"fmt"
+	"net/netip"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/miekg/dns"
+	log "github.com/sirupsen/logrus"
+
+	nbdns "github.com/netbirdio/netbird/dns"
+)
+
+const (
+	// notifyTimeout bounds a single NOTIFY exchange with a secondary.
+	notifyTimeout = 5 * time.Second
+	// notifyAttempts is how often a NOTIFY is sent before giving up, RFC 1996
+	// expects retries until the secondary answers.
+	notifyAttempts = 3
+	// notifyRetryInterval is the wait between NOTIFY attempts.
+	notifyRetryInterval = 2 * time.Second
+)
+
+// ZoneNotify lists the secondaries that are sent a DNS NOTIFY (RFC 1996)
+// whenever the records of a local custom zone change.
+type ZoneNotify struct {
+	// Domain is the zone apex, e.g. "corp.example.com".
+	Domain      string
+	Secondaries []netip.AddrPort
+}
+
+// ParseZoneNotify parses specs in format zone=ip:port[,ip:port...]. Invalid
+// specs are logged and skipped.
+func ParseZoneNotify(specs []string) []ZoneNotify {
+	var zones []ZoneNotify
+	for _, spec := range specs {
+		zone, list, ok := strings.Cut(spec, "=")
+		if !ok || zone == "" || list == "" {
+			log.Warnf("invalid zone notify %q, expected zone=ip:port[,ip:port]", spec)
+			continue
+		}
+
+		notify := ZoneNotify{Domain: zone}
+		for _, s := range strings.Split(list, ",") {
+			addr, err := netip.ParseAddrPort(strings.TrimSpace(s))
+			if err != nil {
+				log.Warnf("invalid zone notify %q: %v", spec, err)
+				notify.Secondaries = nil
+				break
+			}
+			notify.Secondaries = append(notify.Secondaries, addr)
+		}
+		if len(notify.Secondaries) > 0 {
+			zones = append(zones, notify)
+		}
+	}
+	return zones
+}
+
+// notifyFunc sends one NOTIFY for zone with serial to secondary.
+type notifyFunc func(ctx context.Context, zone string, serial uint32, secondary netip.AddrPort) error
+
+// zoneNotifier keeps the SOA serial of each configured zone and notifies the
+// zone's secondaries when its records change.
+type zoneNotifier struct {
+	secondaries map[string][]netip.AddrPort
+	send        notifyFunc
+	wg          *sync.WaitGroup
+
+	mu      sync.Mutex
+	hashes  map[string]uint64
+	serials map[string]uint32
+}
+
+func newZoneNotifier(zones []ZoneNotify, wg *sync.WaitGroup) *zoneNotifier {
+	secondaries := make(map[string][]netip.AddrPort, len(zones))
+	for _, z := range zones {
+		apex := strings.ToLower(dns.Fqdn(z.Domain))
+		secondaries[apex] = append(secondaries[apex], z.Secondaries...)
+	}
+	return &zoneNotifier{
+		secondaries: secondaries,
+		send:        sendNotify,
+		wg:          wg,
+		hashes:      make(map[string]uint64),
+		serials:     make(map[string]uint32),
+	}
+}
+
+// update compares the configured zones in zones with the previous update and
+// notifies the secondaries of every zone that was loaded, changed or removed.
+// The NOTIFYs are sent in the background until ctx is done.
+func (n *zoneNotifier) update(ctx context.Context, zones []nbdns.CustomZone) {
+	records := make(map[string][]nbdns.SimpleRecord, len(zones))
+	for _, z := range zones {
+		apex := strings.ToLower(dns.Fqdn(z.Domain))
+		if _, ok := n.secondaries[apex]; ok {
+			records[apex] = z.Records
+		}
+	}
+
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	for apex, secondaries := range n.secondaries {
+		zoneRecords, present := records[apex]
+		prevHash, known := n.hashes[apex]
+		if !present && !known {
+			continue
+		}
+
+		hash, err := hashConfig(zoneRecords)
+		if err != nil {
+			log.Errorf("failed to hash records of zone %s: %v", apex, err)
+			continue
+		}
+		if known && hash == prevHash {
+			continue
+		}
+
+		// Send the serial the zone is served with, see zoneSerials.
+		serial, ok := zoneSOASerial(zoneRecords)
+		if !ok {
+			serial, ok = n.serials[apex]
+			if ok {
+				serial++
+			} else {
+				serial = uint32(time.Now().Unix())
+			}
+		}
+		n.serials[apex] = serial
+		if present {
+			n.hashes[apex] = hash
+		} else {
+			delete(n.hashes, apex)
+		}
+
+		for _, secondary := range secondaries {
+			n.notify(ctx, apex, serial, secondary)
+		}
+	}
+}
+
+// serial returns the current SOA serial of zone, zero if none was assigned.
+func (n *zoneNotifier) serial(zone string) uint32 {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	return n.serials[strings.ToLower(dns.Fqdn(zone))]
+}
+
+func (n *zoneNotifier) notify(ctx context.Context, zone string, serial uint32, secondary netip.AddrPort) {
+	n.wg.Add(1)
+	go func() {
+		defer n.wg.Done()
+		var err error
+		for attempt := 0; attempt < notifyAttempts; attempt++ {
+			if attempt > 0 {
+				select {
+				case <-ctx.Done():
+					return
+				case <-time.After(notifyRetryInterval):
+				}
+			}
+			if err = n.send(ctx, zone, serial, secondary); err == nil {
+				log.Debugf("notified %s of zone %s serial %d", secondary, zone, serial)
+				return
+			}
+		}
+		log.Warnf("failed to notify %s of zone %s serial %d: %v", secondary, zone, serial, err)
+	}()
+}
+
+// sendNotify sends a NOTIFY carrying the zone's SOA with serial to secondary
+// and waits for its acknowledgement.
+func sendNotify(ctx context.Context, zone string, serial uint32, secondary netip.AddrPort) error {
+	msg := new(dns.Msg)
+	msg.SetNotify(zone)
+	msg.Authoritative = true
+	msg.Answer = []dns.RR{&dns.SOA{
+		Hdr:     dns.RR_Header{Name: zone, Rrtype: dns.TypeSOA, Class: dns.ClassINET},
+		Ns:      zone,
+		Mbox:    "hostmaster." + zone,
+		Serial:  serial,
+		Refresh: 3600,
+		Retry:   600,
+		Expire:  86400,
+		Minttl:  60,
+	}}
+
+	ctx, cancel := context.WithTimeout(ctx, notifyTimeout)
+	defer cancel()
+
+	client := &dns.Client{Timeout: notifyTimeout}
+	resp, _, err := client.ExchangeContext(ctx, msg, secondary.String())
+	if err != nil {
+		return fmt.Errorf("exchange: %w", err)
+	}
+	if resp.Rcode != dns.RcodeSuccess {
+		return fmt.Errorf("secondary answered %s", dns.RcodeToString[resp.Rcode])
+	}
+	return nil
+}
@@ -0,0 +1,93 @@
+package dns
+
+import (
+	"context"
+	"net"
+	"net/netip"
+	"testing"
+	"time"
+
+	"github.com/miekg/dns"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	nbdns "github.com/netbirdio/netbird/dns"
+)
+
+func TestParseZoneNotify(t *testing.T) {
+	zones := ParseZoneNotify([]string{
+		"corp.example.com=10.0.0.2:53, 10.0.0.3:5353",
+		"invalid",
+		"bad.example.com=10.0.0.2",
+	})
+	assert.Equal(t, []ZoneNotify{{
+		Domain:      "corp.example.com",
+		Secondaries: []netip.AddrPort{netip.MustParseAddrPort("10.0.0.2:53"), netip.MustParseAddrPort("10.0.0.3:5353")},
+	}}, zones)
+}
+
+func TestDefaultServer_ZoneNotify(t *testing.T) {
+	notifies := make(chan *dns.Msg, 10)
+	pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+	require.NoError(t, err)
+	secondary := &dns.Server{PacketConn: pc, Net: "udp", Handler: dns.HandlerFunc(func(w dns.ResponseWriter, r *dns.Msg) {
+		notifies <- r
+		_ = w.WriteMsg(new(dns.Msg).SetReply(r))
+	})}
+	go func() { _ = secondary.ActivateAndServe() }()
+	t.Cleanup(func() { _ = secondary.Shutdown() })
+
+	server := newTestServer(nil)
+	server.ctx, server.ctxCancel = context.WithCancel(context.Background())
+	t.Cleanup(server.ctxCancel)
+	server.zoneNotifier = newZoneNotifier([]ZoneNotify{{
+		Domain:      "corp.example.com",
+		Secondaries: []netip.AddrPort{netip.MustParseAddrPort(pc.LocalAddr().String())},
+	}}, &server.shutdownWg)
+
+	zones := func(ip string) []nbdns.CustomZone {
+		return []nbdns.CustomZone{
+			{
+				Domain:  "corp.example.com.",
+				Records: []nbdns.SimpleRecord{{Name: "app.corp.example.com.", Type: int(dns.TypeA), Class: nbdns.DefaultClass, TTL: 300, RData: ip}},
+			},
+			{
+				Domain:  "other.example.com.",
+				Records: []nbdns.SimpleRecord{{Name: "app.other.example.com.", Type: int(dns.TypeA), Class: nbdns.DefaultClass, TTL: 300, RData: ip}},
+			},
+		}
+	}
+	nextNotify := func() *dns.Msg {
+		t.Helper()
+		select {
+		case msg := <-notifies:
+			return msg
+		case <-time.After(5 * time.Second):
+			t.Fatal("no NOTIFY received")
+			return nil
+		}
+	}
+
+	require.NoError(t, server.SetCustomZones(zones("100.64.0.1")))
+	msg := nextNotify()
+	assert.Equal(t, dns.OpcodeNotify, msg.Opcode)
+	require.Len(t, msg.Question, 1)
+	assert.Equal(t, "corp.example.com.", msg.Question[0].Name)
+	assert.Equal(t, dns.TypeSOA, msg.Question[0].Qtype)
+	require.Len(t, msg.Answer, 1)
+	serial := msg.Answer[0].(*dns.SOA).Serial
+	assert.Equal(t, server.zoneNotifier.serial("corp.example.com"), serial)
+
+	// Unchanged records don't notify again.
+	require.NoError(t, server.SetCustomZones(zones("100.64.0.1")))
+	server.shutdownWg.Wait()
+	assert.Empty(t, notifies)
+
+	require.NoError(t, server.SetCustomZones(zones("100.64.0.2")))
+	msg = nextNotify()
+	require.Len(t, msg.Answer, 1)
+	assert.Equal(t, serial+1, msg.Answer[0].(*dns.SOA).Serial, "a change increments the serial")
+
+	server.shutdownWg.Wait()
+	assert.Empty(t, notifies, "zones without secondaries are never notified")
+}
@@ -0,0 +1,124 @@
+package dns
+
+import (
+	"slices"
+	"strings"
+
+	"github.com/miekg/dns"
+	log "github.com/sirupsen/logrus"
+
+	"github.com/netbirdio/netbird/shared/management/domain"
+)
+
+// ZoneOverlap is a handler registered through RegisterHandler for a domain
+// that overlaps a custom zone served by the local resolver.
+type ZoneOverlap struct {
+	// Domain is the registered domain, Zone the custom zone it overlaps.
+	Domain   string
+	Zone     string
+	Priority int
+	// Shadows is set when the handler outranks the local resolver, so it
+	// answers the overlapping names instead of the custom zone.
+	Shadows bool
+	// Rejected is set when the registration was refused, see
+	// DefaultServerConfig.RejectZoneOverlap.
+	Rejected bool
+}
+
+// ZoneOverlaps returns the overlaps recorded for handlers currently
+// registered through RegisterHandler, and for rejected registrations.
+func (s *DefaultServer) ZoneOverlaps() []ZoneOverlap {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+
+	overlaps := make([]ZoneOverlap, 0, len(s.zoneOverlaps))
+	for _, o := range s.zoneOverlaps {
+		overlaps = append(overlaps, o)
+	}
+	slices.SortFunc(overlaps, func(a, b ZoneOverlap) int {
+		if c := strings.Compare(a.Domain, b.Domain); c != 0 {
+			return c
+		}
+		return b.Priority - a.Priority
+	})
+	return overlaps
+}
+
+// checkZoneOverlaps records domains overlapping a local custom zone and
+// returns the domains to register. With rejectZoneOverlap set, domains whose
+// handler would shadow a custom zone are left out. Must hold s.mux.
+func (s *DefaultServer) checkZoneOverlaps(domains domain.List, priority int, qtypes []uint16) domain.List {
+	zones := s.localZones()
+	accepted := make(domain.List, 0, len(domains))
+	for _, d := range domains {
+		key := s.extraHandlerKey(d, priority, qtypes...)
+		delete(s.zoneOverlaps, key)
+
+		name := string(s.toZone(d))
+		zone, ok := overlappingZone(name, zones)
+		if !ok {
+			accepted = append(accepted, d)
+			continue
+		}
+
+		overlap := ZoneOverlap{
+			Domain:   d.SafeString(),
+			Zone:     zone,
+			Priority: priority,
+			Shadows:  shadowsZone(name, zone, priority),
+		}
+		overlap.Rejected = overlap.Shadows && s.rejectZoneOverlap
+
+		switch {
+		case overlap.Rejected:
+			log.Errorf("not registering handler for %s with priority %d: it would shadow custom zone %s", overlap.Domain, priority, zone)
+		case overlap.Shadows:
+			log.Warnf("handler for %s with priority %d takes precedence over custom zone %s", overlap.Domain, priority, zone)
+		default:
+			log.Debugf("handler for %s with priority %d overlaps custom zone %s and only gets its fallthrough", overlap.Domain, priority, zone)
+		}
+
+		if s.zoneOverlaps == nil {
+			s.zoneOverlaps = make(map[extraHandlerKey]ZoneOverlap)
+		}
+		s.zoneOverlaps[key] = overlap
+		if !overlap.Rejected {
+			accepted = append(accepted, d)
+		}
+	}
+	return accepted
+}
+
+// localZones returns the custom zones currently served by the local
+// resolver, normalized like toZone. Must hold s.mux.
+func (s *DefaultServer) localZones() []string {
+	var zones []string
+	for _, h := range s.dnsMuxHandlers {
+		if h.handler == s.localResolver {
+			zones = append(zones, s.handlerChain.NormalizeName(h.domain))
+		}
+	}
+	return zones
+}
+
+// shadowsZone reports whether a handler for the zone name, see toZone, at
+// priority is tried before the local resolver serving zone: it outranks it,
+// or has its priority and lies below zone, as the chain tries the more
+// specific pattern first.
+func shadowsZone(name, zone string, priority int) bool {
+	if priority != PriorityLocal {
+		return priority > PriorityLocal
+	}
+	return name != zone && dns.IsSubDomain(zone, name)
+}
+
+// overlappingZone returns the first zone that contains the zone name, see
+// toZone, or lies below it.
+func overlappingZone(name string, zones []string) (string, bool) {
+	for _, zone := range zones {
+		if dns.IsSubDomain(zone, name) || dns.IsSubDomain(name, zone) {
+			return zone, true
+		}
+	}
+	return "", false
+}
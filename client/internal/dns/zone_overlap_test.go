@@ -0,0 +1,73 @@
+package dns
+
+import (
+	"testing"
+
+	"github.com/miekg/dns"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/netbirdio/netbird/client/internal/dns/test"
+	nbdns "github.com/netbirdio/netbird/dns"
+	"github.com/netbirdio/netbird/shared/management/domain"
+)
+
+func newZoneOverlapTestServer(t *testing.T, reject bool) *DefaultServer {
+	t.Helper()
+	server := newTestServer(nil)
+	server.rejectZoneOverlap = reject
+	require.NoError(t, server.UpdateDNSServer(1, nbdns.Config{
+		ServiceEnable: true,
+		CustomZones: []nbdns.CustomZone{{
+			Domain: "corp.example.",
+			Records: []nbdns.SimpleRecord{
+				{Name: "app.corp.example.", Type: int(dns.TypeA), Class: nbdns.DefaultClass, TTL: 300, RData: "100.64.0.10"},
+			},
+		}},
+	}))
+	return server
+}
+
+func TestDefaultServer_RegisterHandlerZoneOverlap(t *testing.T) {
+	server := newZoneOverlapTestServer(t, false)
+
+	server.RegisterHandler(domain.List{"other.example"}, &MockHandler{}, PriorityDNSRoute)
+	assert.Empty(t, server.ZoneOverlaps(), "unrelated domains must not be recorded")
+
+	server.RegisterHandler(domain.List{"*.app.corp.example"}, &MockHandler{}, PriorityDNSRoute)
+	server.RegisterHandler(domain.List{"example"}, &MockHandler{}, PriorityUpstream)
+
+	assert.Equal(t, []ZoneOverlap{
+		{Domain: "*.app.corp.example", Zone: "corp.example.", Priority: PriorityDNSRoute, Shadows: true},
+		{Domain: "example", Zone: "corp.example.", Priority: PriorityUpstream},
+	}, server.ZoneOverlaps())
+
+	server.DeregisterHandler(domain.List{"*.app.corp.example"}, PriorityDNSRoute)
+	assert.Equal(t, []ZoneOverlap{
+		{Domain: "example", Zone: "corp.example.", Priority: PriorityUpstream},
+	}, server.ZoneOverlaps(), "deregistering must clear the overlap")
+}
+
+func TestDefaultServer_RegisterHandlerRejectsShadowingOverlap(t *testing.T) {
+	server := newZoneOverlapTestServer(t, true)
+
+	route := &MockHandler{}
+	server.RegisterHandler(domain.List{"app.corp.example", "other.example"}, route, PriorityDNSRoute)
+	server.RegisterHandler(domain.List{"corp.example"}, &MockHandler{}, PriorityUpstream)
+
+	assert.Equal(t, []ZoneOverlap{
+		{Domain: "app.corp.example", Zone: "corp.example.", Priority: PriorityDNSRoute, Shadows: true, Rejected: true},
+		{Domain: "corp.example", Zone: "corp.example.", Priority: PriorityUpstream},
+	}, server.ZoneOverlaps())
+
+	// The custom zone keeps answering the rejected name.
+	w := &test.MockResponseWriter{}
+	server.handlerChain.ServeDNS(w, new(dns.Msg).SetQuestion("app.corp.example.", dns.TypeA))
+	resp := w.GetLastResponse()
+	require.NotNil(t, resp)
+	require.Len(t, resp.Answer, 1)
+	assert.Equal(t, "100.64.0.10", resp.Answer[0].(*dns.A).A.String())
+
+	assert.Contains(t, server.extraHandlers, server.extraHandlerKey("other.example", PriorityDNSRoute), "non-overlapping domains are still registered")
+	assert.NotContains(t, server.extraHandlers, server.extraHandlerKey("app.corp.example", PriorityDNSRoute))
+}
@@ -0,0 +1,129 @@
+package dns
+
+import (
+	"fmt"
+	"math"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/miekg/dns"
+	log "github.com/sirupsen/logrus"
+
+	nbdns "github.com/netbirdio/netbird/dns"
+)
+
+// Timers of the SOA records synthesized for local zones. The local resolver
+// has no secondaries of its own, they only matter to the ones pulling the
+// zones from a peer.
+const (
+	zoneSOATTL     = 60
+	zoneSOARefresh = 3600
+	zoneSOARetry   = 600
+	zoneSOAExpire  = 86400
+)
+
+// zoneSerials keeps the SOA serial of every authoritative local zone. A
+// zone's serial only moves when its records change: to the serial of the
+// config that changed them, or one past the previous serial if that isn't
+// higher, so it never goes backwards. Reapplying the same records keeps it.
+// Guarded by the server's mux.
+type zoneSerials struct {
+	hashes  map[string]uint64
+	serials map[string]uint32
+}
+
+// withSOA returns zones with an SOA record carrying the zone's serial added
+// to every authoritative zone that doesn't define one. Non-authoritative
+// zones get none: their names fall through to other resolvers, an SOA at the
+// apex would answer it NODATA instead. zones is modified in place, their
+// records are copied.
+func (z *zoneSerials) withSOA(zones []nbdns.CustomZone, configSerial uint64) []nbdns.CustomZone {
+	if z.hashes == nil {
+		z.hashes = make(map[string]uint64)
+		z.serials = make(map[string]uint32)
+	}
+
+	present := make(map[string]struct{}, len(zones))
+	for i, zone := range zones {
+		if zone.NonAuthoritative {
+			continue
+		}
+		apex := strings.ToLower(dns.Fqdn(zone.Domain))
+		if _, ok := zoneSOASerial(zone.Records); ok {
+			continue
+		}
+		present[apex] = struct{}{}
+
+		serial, err := z.update(apex, zone, configSerial)
+		if err != nil {
+			log.Errorf("failed to hash records of zone %s: %v", apex, err)
+			continue
+		}
+		zones[i].Records = append(slices.Clip(zone.Records), zoneSOARecord(apex, serial))
+	}
+
+	// Forget the records of removed zones but keep their serial, so a zone
+	// coming back continues where it left off.
+	for apex := range z.hashes {
+		if _, ok := present[apex]; !ok {
+			delete(z.hashes, apex)
+		}
+	}
+	return zones
+}
+
+// update returns the serial of zone apex, moving it if the records changed.
+func (z *zoneSerials) update(apex string, zone nbdns.CustomZone, configSerial uint64) (uint32, error) {
+	hash, err := hashConfig(struct {
+		Records       []nbdns.SimpleRecord
+		SubnetRecords []nbdns.SubnetRecordSet
+	}{zone.Records, zone.SubnetRecords})
+	if err != nil {
+		return 0, err
+	}
+
+	serial, known := z.serials[apex]
+	if prev, ok := z.hashes[apex]; ok && prev == hash {
+		return serial, nil
+	}
+	next := uint32(min(configSerial, math.MaxUint32))
+	if known && next <= serial {
+		next = serial + 1
+	}
+	next = max(next, 1)
+
+	z.hashes[apex] = hash
+	z.serials[apex] = next
+	return next, nil
+}
+
+// zoneSOARecord returns the SOA record of zone apex with serial.
+func zoneSOARecord(apex string, serial uint32) nbdns.SimpleRecord {
+	return nbdns.SimpleRecord{
+		Name:  apex,
+		Type:  int(dns.TypeSOA),
+		Class: nbdns.DefaultClass,
+		TTL:   zoneSOATTL,
+		RData: fmt.Sprintf("%s hostmaster.%s %d %d %d %d %d", apex, apex, serial, zoneSOARefresh, zoneSOARetry, zoneSOAExpire, zoneSOATTL),
+	}
+}
+
+// zoneSOASerial returns the serial of the SOA record in records, if any.
+func zoneSOASerial(records []nbdns.SimpleRecord) (uint32, bool) {
+	for _, record := range records {
+		if record.Type != int(dns.TypeSOA) {
+			continue
+		}
+		fields := strings.Fields(record.RData)
+		if len(fields) != 7 {
+			continue
+		}
+		serial, err := strconv.ParseUint(fields[2], 10, 32)
+		if err != nil {
+			continue
+		}
+		return uint32(serial), true
+	}
+	return 0, false
+}
@@ -0,0 +1,111 @@
+package dns
+
+import (
+	"testing"
+
+	"github.com/miekg/dns"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/netbirdio/netbird/client/internal/dns/test"
+	nbdns "github.com/netbirdio/netbird/dns"
+)
+
+func serialZone(domain, ip string) nbdns.CustomZone {
+	return nbdns.CustomZone{
+		Domain:  domain,
+		Records: []nbdns.SimpleRecord{{Name: "app." + domain, Type: int(dns.TypeA), Class: nbdns.DefaultClass, TTL: 300, RData: ip}},
+	}
+}
+
+func TestZoneSerials(t *testing.T) {
+	var serials zoneSerials
+	apply := func(configSerial uint64, zones ...nbdns.CustomZone) []nbdns.CustomZone {
+		t.Helper()
+		return serials.withSOA(zones, configSerial)
+	}
+	serialOf := func(zone nbdns.CustomZone) uint32 {
+		t.Helper()
+		serial, ok := zoneSOASerial(zone.Records)
+		require.True(t, ok, "zone %s has no SOA", zone.Domain)
+		return serial
+	}
+
+	zone := serialZone("corp.example.com.", "100.64.0.1")
+	zones := apply(10, zone)
+	assert.Equal(t, uint32(10), serialOf(zones[0]), "the serial follows the config serial")
+	assert.Len(t, zone.Records, 1, "the input records must not be modified")
+
+	zones = apply(11, serialZone("corp.example.com.", "100.64.0.1"))
+	assert.Equal(t, uint32(10), serialOf(zones[0]), "reapplying the same records keeps the serial")
+
+	zones = apply(12, serialZone("corp.example.com.", "100.64.0.2"))
+	assert.Equal(t, uint32(12), serialOf(zones[0]))
+
+	zones = apply(3, serialZone("corp.example.com.", "100.64.0.3"))
+	assert.Equal(t, uint32(13), serialOf(zones[0]), "the serial never goes backwards")
+
+	zones = apply(0, serialZone("corp.example.com.", "100.64.0.4"))
+	assert.Equal(t, uint32(14), serialOf(zones[0]), "changes without a config serial increment it")
+
+	apply(15)
+	zones = apply(0, serialZone("corp.example.com.", "100.64.0.4"))
+	assert.Equal(t, uint32(15), serialOf(zones[0]), "a removed zone continues where it left off")
+
+	zones = apply(20, serialZone("other.example.com.", "100.64.0.1"))
+	assert.Equal(t, uint32(20), serialOf(zones[0]))
+
+	nonAuth := serialZone("match.example.com.", "100.64.0.1")
+	nonAuth.NonAuthoritative = true
+	zones = apply(21, nonAuth)
+	_, ok := zoneSOASerial(zones[0].Records)
+	assert.False(t, ok, "non-authoritative zones get no SOA")
+
+	own := serialZone("own.example.com.", "100.64.0.1")
+	own.Records = append(own.Records, zoneSOARecord("own.example.com.", 7))
+	zones = apply(22, own)
+	assert.Len(t, zones[0].Records, 2, "a zone's own SOA is kept")
+	assert.Equal(t, uint32(7), serialOf(zones[0]))
+}
+
+func TestDefaultServer_ZoneSOA(t *testing.T) {
+	server := newTestServer(nil)
+
+	querySOA := func(name string) *dns.Msg {
+		t.Helper()
+		w := &test.MockResponseWriter{}
+		server.localResolver.ServeDNS(w, new(dns.Msg).SetQuestion(name, dns.TypeSOA))
+		resp := w.GetLastResponse()
+		require.NotNil(t, resp)
+		return resp
+	}
+	serial := func() uint32 {
+		t.Helper()
+		resp := querySOA("corp.example.com.")
+		require.Equal(t, dns.RcodeSuccess, resp.Rcode)
+		require.Len(t, resp.Answer, 1)
+		soa, ok := resp.Answer[0].(*dns.SOA)
+		require.True(t, ok)
+		assert.True(t, resp.Authoritative)
+		return soa.Serial
+	}
+	config := func(ip string) nbdns.Config {
+		return nbdns.Config{ServiceEnable: true, CustomZones: []nbdns.CustomZone{serialZone("corp.example.com.", ip)}}
+	}
+
+	require.NoError(t, server.UpdateDNSServer(5, config("100.64.0.1")))
+	assert.Equal(t, uint32(5), serial())
+
+	require.NoError(t, server.UpdateDNSServer(6, config("100.64.0.1")))
+	assert.Equal(t, uint32(5), serial(), "a no-op update keeps the serial")
+
+	require.NoError(t, server.UpdateDNSServer(7, config("100.64.0.2")))
+	assert.Equal(t, uint32(7), serial(), "a record change moves the serial")
+
+	require.NoError(t, server.SetCustomZones(config("100.64.0.2").CustomZones))
+	assert.Equal(t, uint32(7), serial(), "reapplying the zones keeps the serial")
+
+	resp := querySOA("app.corp.example.com.")
+	assert.Equal(t, dns.RcodeSuccess, resp.Rcode)
+	assert.Empty(t, resp.Answer, "only the apex has an SOA")
+}
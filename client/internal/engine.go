@@ -19,9 +19,13 @@ import (
 	"github.com/hashicorp/go-multierror"
 	"github.com/pion/ice/v4"
 	"github.com/pion/stun/v3"
+	"github.com/prometheus/client_golang/prometheus"
 	log "github.com/sirupsen/logrus"
 	"golang.zx2c4.com/wireguard/tun/netstack"
 	"golang.zx2c4.com/wireguard/wgctrl/wgtypes"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
 
 	nberrors "github.com/netbirdio/netbird/client/errors"
 	"github.com/netbirdio/netbird/client/firewall"
@@ -44,6 +48,7 @@ import (
 	"github.com/netbirdio/netbird/client/internal/metrics"
 	"github.com/netbirdio/netbird/client/internal/netflow"
 	nftypes "github.com/netbirdio/netbird/client/internal/netflow/types"
+	"github.com/netbirdio/netbird/client/internal/netserial"
 	"github.com/netbirdio/netbird/client/internal/networkmonitor"
 	"github.com/netbirdio/netbird/client/internal/peer"
 	"github.com/netbirdio/netbird/client/internal/peer/guard"
@@ -129,7 +134,57 @@ type EngineConfig struct {
 
 	NATExternalIPs []string
 
-	CustomDNSAddress string
+	CustomDNSAddress   string
+	DNSMirroredZones   []string
+	DNSZoneNotify      []string
+	DNSAnswerLoopback  bool
+	DNSSortAnswers     bool
+	DNSUnmatchedAction string
+	DNSPrivateReverse  string
+	DNSDnstapOutput    string
+
+	DNSCaptivePortalPolicy    string
+	DNSCaptivePortalDomains   []string
+	DNSCaptivePortalAddresses []string
+
+	DNSUpstreamPoolSize     int
+	DNSUpstreamIdleTimeout  time.Duration
+	DNSReverseCacheSize     int
+	DNSDisablePeerReverse   bool
+	DNSResponseCacheSize    int
+	DNSNoCacheGroups        []string
+	DNSCacheTTLPolicies     []string
+	DNSPersistResponseCache bool
+	DNSSwapQueueSize        int
+	DNSSwapQueueTimeout     time.Duration
+	DNSSuppressAAAADomains  []string
+	DNSSealedZones          []string
+	DNSDefaultRecordTTL     time.Duration
+	DNSRewriteRules         []string
+	DNSUpstreamMaxInflight  int
+	DNSGroupMaxInflight     []string
+	DNSEDNSAllowlist        []string
+	DNSGroupEDNSAllowlist   []string
+	DNSGroupSelectionPolicy []string
+	DNSGroupsDownPolicy     []string
+	DNSStripDNSSEC          bool
+	DNSMaxUDPResponseSize   int
+	DNSTimePolicies         []string
+	DNSDoHPort              int
+	DNSDoHCertFile          string
+	DNSDoHKeyFile           string
+	DNSExpandSearchDomains  bool
+	DNSProbeInterval        time.Duration
+
+	DNSPostureRemediationAddress string
+	DNSPostureRemediationDomains []string
+	DNSPostureChecks             []string
+
+	DNSServiceIP          string
+	DNSConfigOverrideFile string
+	DNSMgmtCachePinned    bool
+	DNSNameCaseFolding    string
+	DNSRejectZoneOverlap  bool
 
 	RosenpassEnabled    bool
 	RosenpassPermissive bool
@@ -167,6 +222,18 @@ type EngineConfig struct {
 	// StateDir is the directory holding the state file. The sync response
 	// (network map) is serialized here on platforms that persist it to disk.
 	StateDir string
+
+	// DNSHostManager, if set, replaces the auto-detected host DNS manager.
+	DNSHostManager dns.HostManager
+	// DNSAuditSink, if set, is notified of every query answered by the DNS server.
+	DNSAuditSink        dns.AuditSink
+	DNSAuditFullAnswers bool
+	// DNSServiceEventSink, if set, is notified of the DNS server's state transitions.
+	DNSServiceEventSink dns.ServiceEventSink
+	// DNSMetricsRegisterer, if set, gets the Prometheus collectors of the DNS server.
+	DNSMetricsRegisterer prometheus.Registerer
+	// DNSBootstrapResolver, if set, is told the host's original nameservers.
+	DNSBootstrapResolver *dns.BootstrapResolver
 }
 
 // EngineServices holds the external service dependencies required by the Engine.
@@ -231,6 +298,11 @@ type Engine struct {
 	// peers. Guarded by syncMsgMux.
 	latestComponents *types.NetworkMapComponents
 
+	// lastValidNetworkMap is the latest network map that passed validation,
+	// used in place of an invalid one where a map is required. Guarded by
+	// syncMsgMux.
+	lastValidNetworkMap *mgmProto.NetworkMap
+
 	networkMonitor *networkmonitor.NetworkMonitor
 
 	sshServer sshServer
@@ -244,6 +316,10 @@ type Engine struct {
 	ingressGatewayMgr *ingressgw.Manager
 
 	dnsServer dns.Server
+	// dnsApplyReported is the DNS config and outcome last reported to management
+	dnsApplyReported *dnsApplyReport
+	// dnsServicePortReported is the DNS service port last reported to management
+	dnsServicePortReported uint16
 
 	// checks are the client-applied posture checks that need to be evaluated on the client
 	checks []*mgmProto.Checks
@@ -583,7 +659,11 @@ func (e *Engine) Start(netbirdConfig *mgmProto.NetbirdConfig, mgmtURL *url.URL)
 	}
 	e.dnsServer = dnsServer
 
-	// Populate DNS cache with NetbirdConfig and management URL for early resolution
+	// Populate DNS cache with NetbirdConfig and management URL for early resolution.
+	// Without one from the caller, use the config of the management client's last login.
+	if netbirdConfig == nil && e.mgmClient != nil {
+		netbirdConfig = e.mgmClient.InfraConfig()
+	}
 	if err := e.PopulateNetbirdConfig(netbirdConfig, mgmtURL); err != nil {
 		log.Warnf("failed to populate DNS cache: %v", err)
 	}
@@ -659,6 +739,7 @@ func (e *Engine) Start(netbirdConfig *mgmProto.NetbirdConfig, mgmtURL *url.URL)
 	if err := e.dnsServer.Initialize(); err != nil {
 		return fmt.Errorf("initialize dns server: %w", err)
 	}
+	e.loadDNSConfigOverrideFile()
 
 	iceCfg := e.createICEConfig()
 
@@ -1050,6 +1131,13 @@ func (e *Engine) handleSync(update *mgmProto.SyncResponse) error {
 		return nil
 	}
 
+	// Keep running on the last known good map rather than applying a
+	// partial or corrupt one.
+	if err := e.acceptNetworkMap(nm); err != nil {
+		e.statusRecorder.PublishEvent(cProto.SystemEvent_WARNING, cProto.SystemEvent_SYSTEM, "Invalid network map ignored", err.Error(), nil)
+		return fmt.Errorf("ignore network map with serial %d: %w", nm.GetSerial(), err)
+	}
+
 	done = e.phase("checks")
 	err = e.updateChecksIfNew(update.Checks)
 	done()
@@ -1064,6 +1152,7 @@ func (e *Engine) handleSync(update *mgmProto.SyncResponse) error {
 	// incremental-delta base on a future envelope sync.
 	if components != nil {
 		e.latestComponents = components
+		e.updateDNSPostureState(components)
 	}
 
 	e.persistSyncResponse(update)
@@ -1231,13 +1320,86 @@ func (e *Engine) updateChecksIfNew(checks []*mgmProto.Checks) error {
 		return nil
 	}
 	e.applyInfoFlags(info)
+	info.DNSServicePort = e.dnsServicePort()
 
 	if err := e.mgmClient.SyncMeta(info); err != nil {
 		return fmt.Errorf("could not sync meta: error %s", err)
 	}
+	e.dnsServicePortReported = info.DNSServicePort
 	return nil
 }
 
+type dnsServicePorter interface {
+	PeerServicePort() uint16
+}
+
+// dnsServicePort returns the port other peers reach our DNS service on, see
+// dns.DefaultServer.PeerServicePort. Caller must hold syncMsgMux.
+func (e *Engine) dnsServicePort() uint16 {
+	porter, ok := e.dnsServer.(dnsServicePorter)
+	if !ok {
+		return 0
+	}
+	return porter.PeerServicePort()
+}
+
+// syncDNSServicePort reports the DNS service port to management when it
+// changed since it was last reported, so peers relaying DNS queries through
+// this peer send them to the right port. Caller must hold syncMsgMux.
+func (e *Engine) syncDNSServicePort() {
+	port := e.dnsServicePort()
+	if port == e.dnsServicePortReported {
+		return
+	}
+
+	info, ok := system.GetInfoWithChecksTimeout(e.ctx, systemInfoTimeout, e.checks, e.overlayAddresses()...)
+	if !ok {
+		// retried with the next network map
+		return
+	}
+	e.applyInfoFlags(info)
+	info.DNSServicePort = port
+
+	if err := e.mgmClient.SyncMeta(info); err != nil {
+		log.Warnf("failed to report DNS service port %d: %v", port, err)
+		return
+	}
+	e.dnsServicePortReported = port
+}
+
+type dnsApplyReport struct {
+	config *mgmProto.DNSConfig
+	errs   []string
+}
+
+// reportDNSApplyStatus tells management whether the DNS config received with
+// the network map of serial took effect. A config that didn't change since
+// the last report is only reported again when the outcome changed.
+func (e *Engine) reportDNSApplyStatus(serial uint64, config *mgmProto.DNSConfig, applyErr error) {
+	var errs []string
+	if applyErr != nil {
+		errs = []string{applyErr.Error()}
+	}
+
+	if last := e.dnsApplyReported; last != nil && proto.Equal(last.config, config) && slices.Equal(last.errs, errs) {
+		return
+	}
+	e.dnsApplyReported = &dnsApplyReport{config: config, errs: errs}
+
+	e.shutdownWg.Add(1)
+	go func() {
+		defer e.shutdownWg.Done()
+		err := e.mgmClient.ReportDNSApplyStatus(serial, applyErr == nil, errs)
+		switch {
+		case err == nil:
+		case status.Code(err) == codes.Unimplemented:
+			log.Debugf("management doesn't support DNS apply status reports")
+		default:
+			log.Warnf("failed to report DNS apply status for serial %d: %v", serial, err)
+		}
+	}()
+}
+
 // applyInfoFlags sets the engine's config-derived feature flags on the gathered system info.
 func (e *Engine) applyInfoFlags(info *system.Info) {
 	info.SetFlags(
@@ -1414,6 +1576,10 @@ func (e *Engine) handleBundle(params *mgmProto.BundleParameters) (*mgmProto.JobR
 // receiveManagementEvents connects to the Management Service event stream to receive updates from the management service
 // E.g. when a new peer has been registered and we are allowed to connect to it.
 func (e *Engine) receiveManagementEvents() {
+	// Start holds syncMsgMux
+	dnsServicePort := e.dnsServicePort()
+	e.dnsServicePortReported = dnsServicePort
+
 	e.shutdownWg.Add(1)
 	go func() {
 		defer e.shutdownWg.Done()
@@ -1424,6 +1590,7 @@ func (e *Engine) receiveManagementEvents() {
 			info = system.GetInfo(e.ctx)
 		}
 		e.applyInfoFlags(info)
+		info.DNSServicePort = dnsServicePort
 
 		err := e.mgmClient.Sync(e.ctx, info, e.handleSync)
 		if err != nil {
@@ -1486,10 +1653,14 @@ func (e *Engine) updateNetworkMap(networkMap *mgmProto.NetworkMap) error {
 	}
 
 	serial := networkMap.GetSerial()
-	if e.networkSerial > serial {
+	if netserial.Stale(serial, e.networkSerial) {
 		log.Debugf("received outdated NetworkMap with serial %d, ignoring", serial)
 		return nil
 	}
+	if netserial.Reset(serial, e.networkSerial) {
+		log.Warnf("NetworkMap serial %d is %d behind the last serial %d, assuming the management serials were reset",
+			serial, e.networkSerial-serial, e.networkSerial)
+	}
 
 	if err := e.connMgr.UpdatedRemoteFeatureFlag(e.ctx, networkMap.GetPeerConfig().GetLazyConnectionEnabled()); err != nil {
 		log.Errorf("failed to update lazy connection feature flag: %v", err)
@@ -1519,10 +1690,13 @@ func (e *Engine) updateNetworkMap(networkMap *mgmProto.NetworkMap) error {
 	dnsConfig := toDNSConfig(protoDNSConfig, e.wgInterface.Address())
 
 	done := e.phase("dns_server")
-	if err := e.dnsServer.UpdateDNSServer(serial, dnsConfig); err != nil {
-		log.Errorf("failed to update dns server, err: %v", err)
+	dnsErr := e.dnsServer.UpdateDNSServer(serial, dnsConfig)
+	if dnsErr != nil {
+		log.Errorf("failed to update dns server, err: %v", dnsErr)
 	}
 	done()
+	e.reportDNSApplyStatus(serial, protoDNSConfig, dnsErr)
+	e.syncDNSServicePort()
 
 	e.routeManager.SetDNSForwarderPort(dnsConfig.ForwarderPort)
 
@@ -1570,6 +1744,8 @@ func (e *Engine) updateNetworkMap(networkMap *mgmProto.NetworkMap) error {
 	e.updateOfflinePeers(networkMap.GetOfflinePeers())
 	done()
 
+	e.updateDNSPeerAddresses(networkMap)
+
 	remotePeers, err := e.reconcilePeers(networkMap)
 	if err != nil {
 		return err
@@ -1717,6 +1893,14 @@ func toDNSConfig(protoDNSConfig *mgmProto.DNSConfig, addr wgaddr.Address) nbdns.
 		CustomZones:      make([]nbdns.CustomZone, 0),
 		NameServerGroups: make([]*nbdns.NameServerGroup, 0),
 		ForwarderPort:    forwarderPort,
+		DNS64:            protoDNSConfig.GetDNS64(),
+	}
+	if prefix := protoDNSConfig.GetDNS64Prefix(); dnsUpdate.DNS64 && prefix != "" {
+		parsed, err := netip.ParsePrefix(prefix)
+		if err != nil {
+			log.Warnf("invalid DNS64 prefix %q, using %s: %v", prefix, nbdns.DefaultDNS64Prefix, err)
+		}
+		dnsUpdate.DNS64Prefix = parsed
 	}
 
 	protoZones := protoDNSConfig.GetCustomZones()
@@ -1729,6 +1913,7 @@ func toDNSConfig(protoDNSConfig *mgmProto.DNSConfig, addr wgaddr.Address) nbdns.
 			Domain:               zone.GetDomain(),
 			SearchDomainDisabled: zone.GetSearchDomainDisabled(),
 			NonAuthoritative:     zone.GetNonAuthoritative() && !singleZoneCompat,
+			NoDataFallthrough:    zone.GetNoDataFallthrough(),
 		}
 		for _, record := range zone.Records {
 			dnsRecord := nbdns.SimpleRecord{
@@ -1745,15 +1930,28 @@ func toDNSConfig(protoDNSConfig *mgmProto.DNSConfig, addr wgaddr.Address) nbdns.
 
 	for _, nsGroup := range protoDNSConfig.GetNameServerGroups() {
 		dnsNSGroup := &nbdns.NameServerGroup{
-			Primary:              nsGroup.GetPrimary(),
-			Domains:              nsGroup.GetDomains(),
-			SearchDomainsEnabled: nsGroup.GetSearchDomainsEnabled(),
+			Primary:               nsGroup.GetPrimary(),
+			Domains:               nsGroup.GetDomains(),
+			SearchDomainsEnabled:  nsGroup.GetSearchDomainsEnabled(),
+			AuthoritativeOnly:     nsGroup.GetAuthoritativeOnly(),
+			QueryTimeout:          time.Duration(nsGroup.GetQueryTimeout()),
+			DeactivationThreshold: int(nsGroup.GetDeactivationThreshold()),
+			ForwardClientSubnet:   nsGroup.GetForwardClientSubnet(),
+			SelectionPolicy:       nsGroup.GetSelectionPolicy(),
+		}
+		if subnet := nsGroup.GetDefaultClientSubnet(); subnet != "" {
+			prefix, err := netip.ParsePrefix(subnet)
+			if err != nil {
+				log.Warnf("invalid default client subnet %q of nameserver group, not sending one: %v", subnet, err)
+			}
+			dnsNSGroup.DefaultClientSubnet = prefix.Masked()
 		}
 		for _, ns := range nsGroup.GetNameServers() {
 			dnsNS := nbdns.NameServer{
-				IP:     netip.MustParseAddr(ns.GetIP()),
-				NSType: nbdns.NameServerType(ns.GetNSType()),
-				Port:   int(ns.GetPort()),
+				IP:       netip.MustParseAddr(ns.GetIP()),
+				NSType:   nbdns.NameServerType(ns.GetNSType()),
+				Port:     int(ns.GetPort()),
+				Hostname: ns.GetHostname(),
 			}
 			dnsNSGroup.NameServers = append(dnsNSGroup.NameServers, dnsNS)
 		}
@@ -2132,6 +2330,13 @@ func (e *Engine) readInitialSettings() ([]*route.Route, *nbdns.Config, bool, err
 	if err != nil {
 		return nil, nil, false, err
 	}
+	if err := e.acceptNetworkMap(netMap); err != nil {
+		if e.lastValidNetworkMap == nil {
+			return nil, nil, false, err
+		}
+		log.Warnf("using the last known good network map with serial %d: %v", e.lastValidNetworkMap.GetSerial(), err)
+		netMap = e.lastValidNetworkMap
+	}
 	routes := toRoutes(netMap.GetRoutes())
 	dnsCfg := toDNSConfig(netMap.GetDNSConfig(), e.wgInterface.Address())
 	dnsFeatureFlag := toDNSFeatureFlag(netMap)
@@ -2202,26 +2407,115 @@ func (e *Engine) newDnsServer(dnsConfig *nbdns.Config) (dns.Server, error) {
 			e.statusRecorder,
 			e.config.DisableDNS,
 		)
+		if e.config.DNSExpandSearchDomains {
+			dnsServer.EnableSearchDomainExpansion()
+		}
 		go e.mobileDep.DnsReadyListener.OnReady()
 		return dnsServer, nil
 
 	case "ios":
 		dnsServer := dns.NewDefaultServerIos(e.ctx, e.wgInterface, e.mobileDep.DnsManager, e.statusRecorder, e.config.DisableDNS)
+		if e.config.DNSExpandSearchDomains {
+			dnsServer.EnableSearchDomainExpansion()
+		}
 		return dnsServer, nil
 
 	default:
+		captivePortal, err := dns.ParseCaptivePortalConfig(e.config.DNSCaptivePortalPolicy, e.config.DNSCaptivePortalDomains, e.config.DNSCaptivePortalAddresses)
+		if err != nil {
+			log.Warnf("captive portal DNS handling disabled: %v", err)
+		}
+
+		postureRemediation, err := dns.ParsePostureRemediationConfig(e.config.DNSPostureRemediationAddress, e.config.DNSPostureRemediationDomains)
+		if err != nil {
+			log.Warnf("posture remediation DNS redirect disabled: %v", err)
+		}
+
+		var serviceIP netip.Addr
+		if e.config.DNSServiceIP != "" {
+			if serviceIP, err = netip.ParseAddr(e.config.DNSServiceIP); err != nil {
+				log.Warnf("selecting the DNS service address: %v", err)
+			}
+		}
+
+		unmatchedRcode, err := dns.ParseUnmatchedAction(e.config.DNSUnmatchedAction)
+		if err != nil {
+			log.Warnf("using default answer for unmatched DNS queries: %v", err)
+		}
+
+		privateReverse, err := dns.ParsePrivateReverseMode(e.config.DNSPrivateReverse)
+		if err != nil {
+			log.Warnf("forwarding private reverse DNS queries: %v", err)
+		}
+		namePolicy, err := dns.ParseNamePolicy(e.config.DNSNameCaseFolding)
+		if err != nil {
+			log.Warnf("matching DNS names case-insensitively: %v", err)
+		}
 
 		dnsServer, err := dns.NewDefaultServer(e.ctx, dns.DefaultServerConfig{
-			WgInterface:    e.wgInterface,
-			CustomAddress:  e.config.CustomDNSAddress,
-			StatusRecorder: e.statusRecorder,
-			StateManager:   e.stateManager,
-			DisableSys:     e.config.DisableDNS,
+			WgInterface:            e.wgInterface,
+			CustomAddress:          e.config.CustomDNSAddress,
+			StatusRecorder:         e.statusRecorder,
+			StateManager:           e.stateManager,
+			DisableSys:             e.config.DisableDNS,
+			ServiceIP:              serviceIP,
+			MirroredZones:          dns.ParseMirroredZones(e.config.DNSMirroredZones),
+			ZoneNotify:             dns.ParseZoneNotify(e.config.DNSZoneNotify),
+			AnswerLoopback:         e.config.DNSAnswerLoopback,
+			SortAnswers:            e.config.DNSSortAnswers,
+			UnmatchedRcode:         unmatchedRcode,
+			PrivateReverse:         privateReverse,
+			DnstapOutput:           e.config.DNSDnstapOutput,
+			UpstreamPoolSize:       e.config.DNSUpstreamPoolSize,
+			UpstreamIdleTimeout:    e.config.DNSUpstreamIdleTimeout,
+			ReverseCacheSize:       e.config.DNSReverseCacheSize,
+			DisablePeerReverse:     e.config.DNSDisablePeerReverse,
+			ResponseCacheSize:      e.config.DNSResponseCacheSize,
+			NoCacheGroups:          dns.ParseNoCacheGroups(e.config.DNSNoCacheGroups),
+			CacheTTLPolicies:       dns.ParseCacheTTLPolicies(e.config.DNSCacheTTLPolicies),
+			PersistResponseCache:   e.config.DNSPersistResponseCache,
+			SwapQueueSize:          e.config.DNSSwapQueueSize,
+			SwapQueueTimeout:       e.config.DNSSwapQueueTimeout,
+			SuppressAAAADomains:    e.config.DNSSuppressAAAADomains,
+			SealedZones:            e.config.DNSSealedZones,
+			DefaultRecordTTL:       e.config.DNSDefaultRecordTTL,
+			RewriteRules:           dns.ParseRewriteRules(e.config.DNSRewriteRules),
+			UpstreamMaxInflight:    e.config.DNSUpstreamMaxInflight,
+			GroupMaxInflight:       dns.ParseInflightLimits(e.config.DNSGroupMaxInflight),
+			EDNSAllowlist:          dns.ParseEDNSAllowlist(e.config.DNSEDNSAllowlist),
+			GroupEDNSAllowlists:    dns.ParseGroupEDNSAllowlists(e.config.DNSGroupEDNSAllowlist),
+			GroupSelectionPolicies: dns.ParseSelectionPolicies(e.config.DNSGroupSelectionPolicy),
+			GroupsDownPolicies:     dns.ParseGroupsDownPolicies(e.config.DNSGroupsDownPolicy),
+			StripDNSSEC:            e.config.DNSStripDNSSEC,
+			MaxUDPResponseSize:     e.config.DNSMaxUDPResponseSize,
+			TimePolicies:           dns.ParseTimePolicies(e.config.DNSTimePolicies),
+			DoHPort:                e.config.DNSDoHPort,
+			DoHCertFile:            e.config.DNSDoHCertFile,
+			DoHKeyFile:             e.config.DNSDoHKeyFile,
+			ExpandSearchDomains:    e.config.DNSExpandSearchDomains,
+			ProbeInterval:          e.config.DNSProbeInterval,
+			MgmtCachePinned:        e.config.DNSMgmtCachePinned,
+			NamePolicy:             namePolicy,
+			RejectZoneOverlap:      e.config.DNSRejectZoneOverlap,
+			CaptivePortal:          captivePortal,
+			PostureRemediation:     postureRemediation,
+			BootstrapResolver:      e.config.DNSBootstrapResolver,
+			MetricsRegisterer:      e.config.DNSMetricsRegisterer,
 		})
 		if err != nil {
 			return nil, err
 		}
 
+		if e.config.DNSHostManager != nil {
+			dnsServer.SetHostManager(e.config.DNSHostManager)
+		}
+		if e.config.DNSAuditSink != nil {
+			dnsServer.SetAuditSink(e.config.DNSAuditSink, e.config.DNSAuditFullAnswers)
+		}
+		if e.config.DNSServiceEventSink != nil {
+			dnsServer.SetServiceEventSink(e.config.DNSServiceEventSink)
+		}
+
 		return dnsServer, nil
 	}
 }
@@ -2426,6 +2720,216 @@ func (e *Engine) stopDNSServer() {
 	e.statusRecorder.UpdateDNSStates(nsGroupStates)
 }
 
+// ExportDNSConfig returns a snapshot of the applied DNS configuration, see
+// dns.DefaultServer.ExportConfig.
+func (e *Engine) ExportDNSConfig() ([]byte, error) {
+	server, err := e.dnsSnapshotter()
+	if err != nil {
+		return nil, err
+	}
+	return server.ExportConfig()
+}
+
+// ImportDNSConfig applies a snapshot produced by ExportDNSConfig, see
+// dns.DefaultServer.ImportConfig.
+func (e *Engine) ImportDNSConfig(data []byte) error {
+	server, err := e.dnsSnapshotter()
+	if err != nil {
+		return err
+	}
+	return server.ImportConfig(data)
+}
+
+// BypassDNS points the host at its original nameservers or back at NetBird,
+// see dns.DefaultServer.BypassDNS.
+func (e *Engine) BypassDNS(enable bool) error {
+	e.syncMsgMux.Lock()
+	server := e.dnsServer
+	e.syncMsgMux.Unlock()
+
+	if server == nil {
+		return errors.New("dns server is not running")
+	}
+	return server.BypassDNS(enable)
+}
+
+// FreezeDNS holds back the DNS updates from management while freeze is true
+// and applies the latest one held back once it is false, see
+// dns.DefaultServer.Freeze and Unfreeze.
+func (e *Engine) FreezeDNS(freeze bool) error {
+	e.syncMsgMux.Lock()
+	server := e.dnsServer
+	e.syncMsgMux.Unlock()
+
+	if server == nil {
+		return errors.New("dns server is not running")
+	}
+	if freeze {
+		server.Freeze()
+		return nil
+	}
+	return server.Unfreeze()
+}
+
+type dnsSnapshotter interface {
+	ExportConfig() ([]byte, error)
+	ImportConfig([]byte) error
+}
+
+func (e *Engine) dnsSnapshotter() (dnsSnapshotter, error) {
+	e.syncMsgMux.Lock()
+	server := e.dnsServer
+	e.syncMsgMux.Unlock()
+
+	snapshotter, ok := server.(dnsSnapshotter)
+	if !ok {
+		return nil, errors.New("dns server does not support config snapshots")
+	}
+	return snapshotter, nil
+}
+
+// DialDNS connects to the DNS handler chain in process, for use as the Dial
+// function of a net.Resolver, see dns.DefaultServer.DialResolver.
+func (e *Engine) DialDNS(ctx context.Context, network, address string) (net.Conn, error) {
+	e.syncMsgMux.Lock()
+	server := e.dnsServer
+	e.syncMsgMux.Unlock()
+
+	dialer, ok := server.(dnsDialer)
+	if !ok {
+		return nil, errors.New("dns server does not support in-process queries")
+	}
+	return dialer.DialResolver(ctx, network, address)
+}
+
+type dnsDialer interface {
+	DialResolver(ctx context.Context, network, address string) (net.Conn, error)
+}
+
+// LoadDNSConfigOverride applies a local DNS config file in place of the
+// management one, see dns.DefaultServer.LoadConfigOverride.
+func (e *Engine) LoadDNSConfigOverride(path string) error {
+	server, err := e.dnsConfigOverrider()
+	if err != nil {
+		return err
+	}
+	return server.LoadConfigOverride(path)
+}
+
+// ClearDNSConfigOverride returns to the management DNS config, see
+// dns.DefaultServer.ClearConfigOverride.
+func (e *Engine) ClearDNSConfigOverride() error {
+	server, err := e.dnsConfigOverrider()
+	if err != nil {
+		return err
+	}
+	return server.ClearConfigOverride()
+}
+
+// loadDNSConfigOverrideFile applies the DNS config override file of the
+// engine config, see dns.DefaultServer.LoadConfigOverride. Caller must hold
+// syncMsgMux.
+func (e *Engine) loadDNSConfigOverrideFile() {
+	path := e.config.DNSConfigOverrideFile
+	if path == "" {
+		return
+	}
+	overrider, ok := e.dnsServer.(dnsConfigOverrider)
+	if !ok {
+		log.Warnf("dns server does not support config overrides, ignoring %s", path)
+		return
+	}
+	if err := overrider.LoadConfigOverride(path); err != nil {
+		log.Errorf("failed to load DNS config override from %s: %v", path, err)
+	}
+}
+
+type dnsConfigOverrider interface {
+	LoadConfigOverride(path string) error
+	ClearConfigOverride() error
+}
+
+func (e *Engine) dnsConfigOverrider() (dnsConfigOverrider, error) {
+	e.syncMsgMux.Lock()
+	server := e.dnsServer
+	e.syncMsgMux.Unlock()
+
+	overrider, ok := server.(dnsConfigOverrider)
+	if !ok {
+		return nil, errors.New("dns server does not support config overrides")
+	}
+	return overrider, nil
+}
+
+// RunDNSDiagnostics probes every configured nameserver without touching the
+// live DNS state, see dns.DefaultServer.RunDiagnostics.
+func (e *Engine) RunDNSDiagnostics(ctx context.Context) (dns.DiagnosticsReport, error) {
+	e.syncMsgMux.Lock()
+	server := e.dnsServer
+	e.syncMsgMux.Unlock()
+
+	diagnoser, ok := server.(dnsDiagnoser)
+	if !ok {
+		return dns.DiagnosticsReport{}, errors.New("dns server does not support diagnostics")
+	}
+	return diagnoser.RunDiagnostics(ctx), nil
+}
+
+type dnsDiagnoser interface {
+	RunDiagnostics(ctx context.Context) dns.DiagnosticsReport
+}
+
+type dnsPostureGate interface {
+	SetPostureBlocked(blocked bool)
+}
+
+// updateDNSPostureState switches the DNS remediation redirect on while the
+// local peer fails one of the posture checks configured for DNS. Caller must
+// hold syncMsgMux.
+func (e *Engine) updateDNSPostureState(components *types.NetworkMapComponents) {
+	gate, ok := e.dnsServer.(dnsPostureGate)
+	if !ok {
+		return
+	}
+
+	blocked := false
+	for _, checkID := range e.config.DNSPostureChecks {
+		if _, ok := components.PostureFailedPeers[checkID][components.PeerID]; ok {
+			blocked = true
+			break
+		}
+	}
+	gate.SetPostureBlocked(blocked)
+}
+
+type dnsPeerAddressTracker interface {
+	SetPeerAddresses(addrs []netip.Addr)
+}
+
+// updateDNSPeerAddresses hands the overlay addresses of every peer in
+// networkMap to the DNS server, so its fake resolver address for userspace
+// interfaces doesn't shadow a peer. Caller must hold syncMsgMux.
+func (e *Engine) updateDNSPeerAddresses(networkMap *mgmProto.NetworkMap) {
+	tracker, ok := e.dnsServer.(dnsPeerAddressTracker)
+	if !ok {
+		return
+	}
+
+	ourV6Net := e.wgInterface.Address().IPv6Net
+	var addrs []netip.Addr
+	for _, peers := range [][]*mgmProto.RemotePeerConfig{networkMap.GetRemotePeers(), networkMap.GetOfflinePeers()} {
+		for _, p := range peers {
+			v4, v6 := overlayAddrsFromAllowedIPs(p.GetAllowedIps(), ourV6Net)
+			for _, addr := range []netip.Addr{v4, v6} {
+				if addr.IsValid() {
+					addrs = append(addrs, addr)
+				}
+			}
+		}
+	}
+	tracker.SetPeerAddresses(addrs)
+}
+
 // SetSyncResponsePersistence enables or disables sync response persistence.
 // The store is only instantiated while persistence is enabled; construction
 // itself drops any stale data left over from an earlier run (see syncstore).
@@ -31,11 +31,13 @@ import (
 	icemaker "github.com/netbirdio/netbird/client/internal/peer/ice"
 	"github.com/netbirdio/netbird/client/internal/profilemanager"
 	"github.com/netbirdio/netbird/client/internal/routemanager"
+	"github.com/netbirdio/netbird/client/system"
 	nbdns "github.com/netbirdio/netbird/dns"
 	"github.com/netbirdio/netbird/monotime"
 	"github.com/netbirdio/netbird/route"
 	mgmt "github.com/netbirdio/netbird/shared/management/client"
 	mgmtProto "github.com/netbirdio/netbird/shared/management/proto"
+	"github.com/netbirdio/netbird/shared/management/types"
 	"github.com/netbirdio/netbird/shared/netiputil"
 	relayClient "github.com/netbirdio/netbird/shared/relay/client"
 	signal "github.com/netbirdio/netbird/shared/signal/client"
@@ -304,8 +306,12 @@ func TestEngine_UpdateNetworkMap(t *testing.T) {
 	})
 	err = engine.routeManager.Init()
 	require.NoError(t, err)
+	var dnsSerial uint64
 	engine.dnsServer = &dns.MockServer{
-		UpdateDNSServerFunc: func(serial uint64, update nbdns.Config) error { return nil },
+		UpdateDNSServerFunc: func(serial uint64, update nbdns.Config) error {
+			dnsSerial = serial
+			return nil
+		},
 	}
 	conn, err := net.ListenUDP("udp4", nil)
 	if err != nil {
@@ -435,7 +441,23 @@ func TestEngine_UpdateNetworkMap(t *testing.T) {
 		expectedSerial: 5,
 	}
 
-	for _, c := range []testCase{case1, case2, case3, case4, case5, case6} {
+	// serial closer to zero than to the last one => management reset its serials, apply the update
+	case7 := testCase{
+		name: "input after a management serial reset",
+		networkMap: &mgmtProto.NetworkMap{
+			Serial:     2,
+			PeerConfig: nil,
+			RemotePeers: []*mgmtProto.RemotePeerConfig{
+				peer1,
+			},
+			RemotePeersIsEmpty: false,
+		},
+		expectedLen:    1,
+		expectedPeers:  []*mgmtProto.RemotePeerConfig{peer1},
+		expectedSerial: 2,
+	}
+
+	for _, c := range []testCase{case1, case2, case3, case4, case5, case6, case7} {
 		t.Run(c.name, func(t *testing.T) {
 			err = engine.updateNetworkMap(c.networkMap)
 			if err != nil {
@@ -451,6 +473,10 @@ func TestEngine_UpdateNetworkMap(t *testing.T) {
 				t.Errorf("expecting Engine.networkSerial to be equal to %d, actual %d", c.expectedSerial, engine.networkSerial)
 			}
 
+			if dnsSerial != c.expectedSerial {
+				t.Errorf("expecting the DNS server serial to be equal to %d, actual %d", c.expectedSerial, dnsSerial)
+			}
+
 			for _, p := range c.expectedPeers {
 				conn, ok := engine.peerStore.PeerConn(p.GetWgPubKey())
 				if !ok {
@@ -849,6 +875,177 @@ func TestEngine_UpdateNetworkMapWithDNSUpdate(t *testing.T) {
 	}
 }
 
+func TestEngine_ReportDNSApplyStatus(t *testing.T) {
+	type report struct {
+		serial  uint64
+		applied bool
+		errs    []string
+	}
+	var mu sync.Mutex
+	var reports []report
+	engine := &Engine{
+		mgmClient: &mgmt.MockClient{
+			ReportDNSApplyStatusFunc: func(serial uint64, applied bool, errs []string) error {
+				mu.Lock()
+				defer mu.Unlock()
+				reports = append(reports, report{serial, applied, errs})
+				return nil
+			},
+		},
+	}
+
+	config := &mgmtProto.DNSConfig{ServiceEnable: true}
+	engine.reportDNSApplyStatus(1, config, nil)
+	engine.reportDNSApplyStatus(2, &mgmtProto.DNSConfig{ServiceEnable: true}, nil)
+	engine.reportDNSApplyStatus(3, config, fmt.Errorf("apply configuration: boom"))
+	engine.reportDNSApplyStatus(4, &mgmtProto.DNSConfig{}, nil)
+	engine.shutdownWg.Wait()
+
+	mu.Lock()
+	defer mu.Unlock()
+	assert.ElementsMatch(t, []report{
+		{serial: 1, applied: true},
+		{serial: 3, applied: false, errs: []string{"apply configuration: boom"}},
+		{serial: 4, applied: true},
+	}, reports, "unchanged config with unchanged outcome must not be reported again")
+}
+
+type servicePortServer struct {
+	dns.MockServer
+	port uint16
+}
+
+func (s *servicePortServer) PeerServicePort() uint16 {
+	return s.port
+}
+
+func TestEngine_SyncDNSServicePort(t *testing.T) {
+	var reported []uint16
+	server := &servicePortServer{}
+	engine := &Engine{
+		ctx:       context.Background(),
+		config:    &EngineConfig{},
+		dnsServer: server,
+		mgmClient: &mgmt.MockClient{
+			SyncMetaFunc: func(info *system.Info) error {
+				reported = append(reported, info.DNSServicePort)
+				return nil
+			},
+		},
+	}
+
+	engine.syncDNSServicePort()
+	server.port = 5053
+	engine.syncDNSServicePort()
+	engine.syncDNSServicePort()
+	server.port = 0
+	engine.syncDNSServicePort()
+
+	assert.Equal(t, []uint16{5053, 0}, reported, "the port must only be reported when it changed")
+}
+
+type configOverrideServer struct {
+	dns.MockServer
+	loaded []string
+}
+
+func (s *configOverrideServer) LoadConfigOverride(path string) error {
+	s.loaded = append(s.loaded, path)
+	return nil
+}
+
+func (s *configOverrideServer) ClearConfigOverride() error {
+	return nil
+}
+
+func TestEngine_LoadDNSConfigOverrideFile(t *testing.T) {
+	server := &configOverrideServer{}
+	engine := &Engine{config: &EngineConfig{}, dnsServer: server}
+
+	engine.loadDNSConfigOverrideFile()
+	assert.Empty(t, server.loaded, "no override must be loaded without a file configured")
+
+	engine.config.DNSConfigOverrideFile = "/etc/netbird/dns-override.json"
+	engine.loadDNSConfigOverrideFile()
+	assert.Equal(t, []string{"/etc/netbird/dns-override.json"}, server.loaded)
+}
+
+type postureGateServer struct {
+	dns.MockServer
+	blocked []bool
+}
+
+func (s *postureGateServer) SetPostureBlocked(blocked bool) {
+	s.blocked = append(s.blocked, blocked)
+}
+
+func TestEngine_UpdateDNSPostureState(t *testing.T) {
+	server := &postureGateServer{}
+	engine := &Engine{
+		config:    &EngineConfig{DNSPostureChecks: []string{"geo-location"}},
+		dnsServer: server,
+	}
+
+	components := &types.NetworkMapComponents{
+		PeerID: "local",
+		PostureFailedPeers: map[string]map[string]struct{}{
+			"geo-location": {"other": {}},
+		},
+	}
+	engine.updateDNSPostureState(components)
+
+	components.PostureFailedPeers["os-version"] = map[string]struct{}{"local": {}}
+	engine.updateDNSPostureState(components)
+
+	components.PostureFailedPeers["geo-location"]["local"] = struct{}{}
+	engine.updateDNSPostureState(components)
+
+	components.PostureFailedPeers = nil
+	engine.updateDNSPostureState(components)
+
+	assert.Equal(t, []bool{false, false, true, false}, server.blocked, "only a failed check configured for DNS must block it")
+}
+
+type peerAddressServer struct {
+	dns.MockServer
+	addrs []netip.Addr
+}
+
+func (s *peerAddressServer) SetPeerAddresses(addrs []netip.Addr) {
+	s.addrs = addrs
+}
+
+func TestEngine_UpdateDNSPeerAddresses(t *testing.T) {
+	server := &peerAddressServer{}
+	engine := &Engine{
+		dnsServer: server,
+		wgInterface: &MockWGIface{
+			AddressFunc: func() wgaddr.Address {
+				return wgaddr.Address{
+					IP:      netip.MustParseAddr("100.64.0.1"),
+					Network: netip.MustParsePrefix("100.64.0.0/16"),
+					IPv6Net: netip.MustParsePrefix("fd00:1234::/64"),
+				}
+			},
+		},
+	}
+
+	engine.updateDNSPeerAddresses(&mgmtProto.NetworkMap{
+		RemotePeers: []*mgmtProto.RemotePeerConfig{
+			{AllowedIps: []string{"100.64.255.254/32", "fd00:1234::2/128", "10.0.0.0/8"}},
+		},
+		OfflinePeers: []*mgmtProto.RemotePeerConfig{
+			{AllowedIps: []string{"100.64.255.253/32"}},
+		},
+	})
+
+	assert.Equal(t, []netip.Addr{
+		netip.MustParseAddr("100.64.255.254"),
+		netip.MustParseAddr("fd00:1234::2"),
+		netip.MustParseAddr("100.64.255.253"),
+	}, server.addrs, "routed networks aren't peer addresses")
+}
+
 func Test_ParseNATExternalIPMappings(t *testing.T) {
 	ifaceList, err := net.Interfaces()
 	if err != nil {
@@ -0,0 +1,28 @@
+// Package netserial orders the network update serials sent by management.
+package netserial
+
+// Stale reports whether an update with serial is an out-of-order message
+// older than the update with last, and must be ignored.
+//
+// A serial behind last is either a late message or a serial reset, e.g.
+// after management was reprovisioned and its account counters restarted.
+// Management sends updates in order and a late message trails the one that
+// superseded it by a few serials, while restarted counters start over near
+// zero. So a serial that is closer to zero than to last is taken for a
+// reset, whatever the size of last. Serial 0 is never a reset: management
+// doesn't number any real update with it.
+func Stale(serial, last uint64) bool {
+	if serial >= last {
+		return false
+	}
+	return !Reset(serial, last)
+}
+
+// Reset reports whether an update with serial, behind last, means the
+// management serials were reset. See Stale.
+func Reset(serial, last uint64) bool {
+	if serial == 0 || serial >= last {
+		return false
+	}
+	return serial <= last-serial
+}
@@ -0,0 +1,35 @@
+package netserial
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestStale(t *testing.T) {
+	tests := []struct {
+		name   string
+		serial uint64
+		last   uint64
+		stale  bool
+		reset  bool
+	}{
+		{name: "first update", serial: 1, last: 0},
+		{name: "newer", serial: 5, last: 4},
+		{name: "same", serial: 4, last: 4},
+		{name: "one behind", serial: 4, last: 5, stale: true},
+		{name: "few behind large serial", serial: 4990, last: 5000, stale: true},
+		{name: "zero", serial: 0, last: 2, stale: true},
+		{name: "reset large account", serial: 3, last: 5000, reset: true},
+		{name: "reset small account", serial: 2, last: 40, reset: true},
+		{name: "reset to half", serial: 20, last: 40, reset: true},
+		{name: "just past half", serial: 21, last: 40, stale: true},
+		{name: "reset tiny account", serial: 1, last: 2, reset: true},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.stale, Stale(tc.serial, tc.last), "stale")
+			assert.Equal(t, tc.reset, Reset(tc.serial, tc.last), "reset")
+		})
+	}
+}
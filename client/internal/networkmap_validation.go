@@ -0,0 +1,127 @@
+package internal
+
+import (
+	"fmt"
+	"net/netip"
+
+	mgmProto "github.com/netbirdio/netbird/shared/management/proto"
+)
+
+// NetworkMapValidationError reports the part of a network map received from
+// management that can't be applied.
+type NetworkMapValidationError struct {
+	// Field locates the invalid value, e.g. "RemotePeers[2].AllowedIps[0]"
+	Field string
+	// Value is the offending value, empty if the field is missing
+	Value  string
+	Reason string
+}
+
+func (e *NetworkMapValidationError) Error() string {
+	if e.Value == "" {
+		return fmt.Sprintf("invalid network map: %s: %s", e.Field, e.Reason)
+	}
+	return fmt.Sprintf("invalid network map: %s %q: %s", e.Field, e.Value, e.Reason)
+}
+
+// validateNetworkMap checks the parts of nm the engine parses and hands to
+// the DNS server, route manager and peer connections, so a partial or
+// corrupt map is rejected as a whole instead of being applied half-way. A
+// nil map has nothing to validate.
+func validateNetworkMap(nm *mgmProto.NetworkMap) error {
+	if nm == nil {
+		return nil
+	}
+
+	// tunnel addresses of the peers, to catch one assigned to two peers
+	owners := make(map[netip.Addr]string)
+	for i, p := range nm.GetRemotePeers() {
+		if err := validatePeerAllowedIPs(fmt.Sprintf("RemotePeers[%d]", i), p, owners); err != nil {
+			return err
+		}
+	}
+	for i, p := range nm.GetOfflinePeers() {
+		if err := validatePeerAllowedIPs(fmt.Sprintf("OfflinePeers[%d]", i), p, owners); err != nil {
+			return err
+		}
+	}
+
+	for i, r := range nm.GetRoutes() {
+		if len(r.GetDomains()) > 0 {
+			continue
+		}
+		if _, err := netip.ParsePrefix(r.GetNetwork()); err != nil {
+			return &NetworkMapValidationError{Field: fmt.Sprintf("Routes[%d].Network", i), Value: r.GetNetwork(), Reason: "invalid CIDR"}
+		}
+	}
+
+	for i, rule := range nm.GetRoutesFirewallRules() {
+		for j, source := range rule.GetSourceRanges() {
+			if _, err := netip.ParsePrefix(source); err != nil {
+				return &NetworkMapValidationError{Field: fmt.Sprintf("RoutesFirewallRules[%d].SourceRanges[%d]", i, j), Value: source, Reason: "invalid CIDR"}
+			}
+		}
+	}
+
+	return validateDNSConfig(nm.GetDNSConfig())
+}
+
+// validatePeerAllowedIPs checks the allowed IPs of peer p and records its
+// single-address ones in owners, keyed to the peer's key.
+func validatePeerAllowedIPs(field string, p *mgmProto.RemotePeerConfig, owners map[netip.Addr]string) error {
+	for i, allowed := range p.GetAllowedIps() {
+		prefix, err := netip.ParsePrefix(allowed)
+		if err != nil {
+			return &NetworkMapValidationError{Field: fmt.Sprintf("%s.AllowedIps[%d]", field, i), Value: allowed, Reason: "invalid CIDR"}
+		}
+		if !prefix.IsSingleIP() {
+			continue
+		}
+		addr := prefix.Addr().Unmap()
+		if owner, ok := owners[addr]; ok && owner != p.GetWgPubKey() {
+			return &NetworkMapValidationError{
+				Field:  fmt.Sprintf("%s.AllowedIps[%d]", field, i),
+				Value:  allowed,
+				Reason: fmt.Sprintf("address also assigned to peer %s", owner),
+			}
+		}
+		owners[addr] = p.GetWgPubKey()
+	}
+	return nil
+}
+
+// validateDNSConfig checks the DNS config of a network map, which management
+// always sends, even with the DNS service disabled.
+func validateDNSConfig(config *mgmProto.DNSConfig) error {
+	if config == nil {
+		return &NetworkMapValidationError{Field: "DNSConfig", Reason: "missing"}
+	}
+
+	for i, zone := range config.GetCustomZones() {
+		if zone.GetDomain() == "" {
+			return &NetworkMapValidationError{Field: fmt.Sprintf("DNSConfig.CustomZones[%d].Domain", i), Reason: "missing"}
+		}
+	}
+
+	for i, group := range config.GetNameServerGroups() {
+		for j, ns := range group.GetNameServers() {
+			if _, err := netip.ParseAddr(ns.GetIP()); err != nil {
+				return &NetworkMapValidationError{Field: fmt.Sprintf("DNSConfig.NameServerGroups[%d].NameServers[%d].IP", i, j), Value: ns.GetIP(), Reason: "invalid IP address"}
+			}
+		}
+	}
+	return nil
+}
+
+// acceptNetworkMap validates nm and remembers it as the last known good
+// network map. An invalid map is not remembered, the previous one stays in
+// place. The caller must hold syncMsgMux.
+func (e *Engine) acceptNetworkMap(nm *mgmProto.NetworkMap) error {
+	if err := validateNetworkMap(nm); err != nil {
+		return err
+	}
+	if nm != nil {
+		e.lastValidNetworkMap = nm
+	}
+	return nil
+}
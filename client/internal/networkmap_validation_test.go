@@ -0,0 +1,122 @@
+package internal
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	mgmProto "github.com/netbirdio/netbird/shared/management/proto"
+)
+
+func validNetworkMap(serial uint64) *mgmProto.NetworkMap {
+	return &mgmProto.NetworkMap{
+		Serial: serial,
+		RemotePeers: []*mgmProto.RemotePeerConfig{
+			{WgPubKey: "peer-a", AllowedIps: []string{"100.64.0.1/32", "fd00::1/128"}},
+			{WgPubKey: "peer-b", AllowedIps: []string{"100.64.0.2/32", "10.10.0.0/16"}},
+		},
+		OfflinePeers: []*mgmProto.RemotePeerConfig{
+			{WgPubKey: "peer-c", AllowedIps: []string{"100.64.0.3/32"}},
+		},
+		Routes: []*mgmProto.Route{
+			{ID: "net", Network: "10.10.0.0/16", Peer: "peer-b"},
+			{ID: "dom", Domains: []string{"example.com"}, Peer: "peer-b"},
+		},
+		RoutesFirewallRules: []*mgmProto.RouteFirewallRule{
+			{SourceRanges: []string{"100.64.0.0/10"}, Destination: "10.10.0.0/16"},
+		},
+		DNSConfig: &mgmProto.DNSConfig{
+			ServiceEnable: true,
+			CustomZones:   []*mgmProto.CustomZone{{Domain: "netbird.cloud."}},
+			NameServerGroups: []*mgmProto.NameServerGroup{
+				{NameServers: []*mgmProto.NameServer{{IP: "1.1.1.1", NSType: 1, Port: 53}}},
+			},
+		},
+	}
+}
+
+func TestValidateNetworkMap(t *testing.T) {
+	require.NoError(t, validateNetworkMap(nil))
+	require.NoError(t, validateNetworkMap(validNetworkMap(1)))
+
+	tests := []struct {
+		name    string
+		corrupt func(nm *mgmProto.NetworkMap)
+		field   string
+	}{
+		{
+			name:    "duplicate peer IP",
+			corrupt: func(nm *mgmProto.NetworkMap) { nm.RemotePeers[1].AllowedIps[0] = "100.64.0.1/32" },
+			field:   "RemotePeers[1].AllowedIps[0]",
+		},
+		{
+			name:    "offline peer reusing a peer IP",
+			corrupt: func(nm *mgmProto.NetworkMap) { nm.OfflinePeers[0].AllowedIps[0] = "100.64.0.2/32" },
+			field:   "OfflinePeers[0].AllowedIps[0]",
+		},
+		{
+			name:    "invalid peer CIDR",
+			corrupt: func(nm *mgmProto.NetworkMap) { nm.RemotePeers[0].AllowedIps[1] = "fd00::1/200" },
+			field:   "RemotePeers[0].AllowedIps[1]",
+		},
+		{
+			name:    "invalid route network",
+			corrupt: func(nm *mgmProto.NetworkMap) { nm.Routes[0].Network = "10.10.0.0" },
+			field:   "Routes[0].Network",
+		},
+		{
+			name:    "invalid route firewall source",
+			corrupt: func(nm *mgmProto.NetworkMap) { nm.RoutesFirewallRules[0].SourceRanges = []string{"bogus"} },
+			field:   "RoutesFirewallRules[0].SourceRanges[0]",
+		},
+		{
+			name:    "missing DNS config",
+			corrupt: func(nm *mgmProto.NetworkMap) { nm.DNSConfig = nil },
+			field:   "DNSConfig",
+		},
+		{
+			name:    "custom zone without domain",
+			corrupt: func(nm *mgmProto.NetworkMap) { nm.DNSConfig.CustomZones[0].Domain = "" },
+			field:   "DNSConfig.CustomZones[0].Domain",
+		},
+		{
+			name:    "invalid nameserver IP",
+			corrupt: func(nm *mgmProto.NetworkMap) { nm.DNSConfig.NameServerGroups[0].NameServers[0].IP = "1.1.1" },
+			field:   "DNSConfig.NameServerGroups[0].NameServers[0].IP",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			nm := validNetworkMap(1)
+			tt.corrupt(nm)
+
+			err := validateNetworkMap(nm)
+			var validationErr *NetworkMapValidationError
+			require.True(t, errors.As(err, &validationErr), "expected a validation error, got %v", err)
+			assert.Equal(t, tt.field, validationErr.Field)
+		})
+	}
+}
+
+func TestEngine_AcceptNetworkMapKeepsLastKnownGood(t *testing.T) {
+	engine := &Engine{}
+
+	good := validNetworkMap(1)
+	require.NoError(t, engine.acceptNetworkMap(good))
+	assert.Same(t, good, engine.lastValidNetworkMap)
+
+	bad := validNetworkMap(2)
+	bad.RemotePeers[1].AllowedIps[0] = "100.64.0.1/32"
+	var validationErr *NetworkMapValidationError
+	require.ErrorAs(t, engine.acceptNetworkMap(bad), &validationErr)
+	assert.Same(t, good, engine.lastValidNetworkMap, "the last known good map must be retained")
+
+	require.NoError(t, engine.acceptNetworkMap(nil))
+	assert.Same(t, good, engine.lastValidNetworkMap, "a missing map doesn't replace the good one")
+
+	newer := validNetworkMap(3)
+	require.NoError(t, engine.acceptNetworkMap(newer))
+	assert.Same(t, newer, engine.lastValidNetworkMap)
+}
@@ -150,6 +150,9 @@ type NSGroupState struct {
 	Domains []string
 	Enabled bool
 	Error   error
+	// InFlight is the number of queries currently forwarded to the group's
+	// nameservers.
+	InFlight int
 }
 
 // FullStatus contains the full state held by the Status instance
@@ -163,6 +166,9 @@ type FullStatus struct {
 	NSGroupStates         []NSGroupState
 	NumOfForwardingRules  int
 	LazyConnectionEnabled bool
+	DNSFrozen             bool
+	DNSBypassed           bool
+	DNSConfigOverride     string
 	Events                []*proto.SystemEvent
 }
 
@@ -219,6 +225,13 @@ type Status struct {
 	nsGroupStates         []NSGroupState
 	resolvedDomainsStates map[domain.Domain]ResolvedDomainInfo
 	lazyConnectionEnabled bool
+	// dnsFrozen is set while the DNS server holds back management updates.
+	dnsFrozen bool
+	// dnsBypassed is set while the host uses its original nameservers.
+	dnsBypassed bool
+	// dnsConfigOverride is the file of the local DNS config override
+	// superseding management, empty when none is loaded.
+	dnsConfigOverride string
 
 	// To reduce the number of notification invocation this bool will be true when need to call the notification
 	// Some Peer actions mostly used by in a batch when the network map has been synchronized. In these type of events
@@ -1004,6 +1017,27 @@ func (d *Status) UpdateDNSStates(dnsStates []NSGroupState) {
 	d.nsGroupStates = dnsStates
 }
 
+// UpdateDNSFrozen records whether DNS config updates are currently frozen
+func (d *Status) UpdateDNSFrozen(frozen bool) {
+	d.mux.Lock()
+	defer d.mux.Unlock()
+	d.dnsFrozen = frozen
+}
+
+// UpdateDNSBypassed records whether the host DNS is bypassing NetBird
+func (d *Status) UpdateDNSBypassed(bypassed bool) {
+	d.mux.Lock()
+	defer d.mux.Unlock()
+	d.dnsBypassed = bypassed
+}
+
+// UpdateDNSConfigOverride records the file of the active local DNS config override
+func (d *Status) UpdateDNSConfigOverride(path string) {
+	d.mux.Lock()
+	defer d.mux.Unlock()
+	d.dnsConfigOverride = path
+}
+
 func (d *Status) UpdateResolvedDomainsStates(originalDomain domain.Domain, resolvedDomain domain.Domain, prefixes []netip.Prefix, resourceId route.ResID) {
 	d.mux.Lock()
 	defer d.mux.Unlock()
@@ -1161,6 +1195,27 @@ func (d *Status) GetDNSStates() []NSGroupState {
 	return slices.Clone(d.nsGroupStates)
 }
 
+// GetDNSFrozen returns whether DNS config updates are currently frozen
+func (d *Status) GetDNSFrozen() bool {
+	d.mux.RLock()
+	defer d.mux.RUnlock()
+	return d.dnsFrozen
+}
+
+// GetDNSBypassed returns whether the host DNS is bypassing NetBird
+func (d *Status) GetDNSBypassed() bool {
+	d.mux.RLock()
+	defer d.mux.RUnlock()
+	return d.dnsBypassed
+}
+
+// GetDNSConfigOverride returns the file of the active local DNS config override
+func (d *Status) GetDNSConfigOverride() string {
+	d.mux.RLock()
+	defer d.mux.RUnlock()
+	return d.dnsConfigOverride
+}
+
 func (d *Status) GetResolvedDomainsStates() map[domain.Domain]ResolvedDomainInfo {
 	d.mux.RLock()
 	defer d.mux.RUnlock()
@@ -1177,6 +1232,9 @@ func (d *Status) GetFullStatus() FullStatus {
 		NSGroupStates:         d.GetDNSStates(),
 		NumOfForwardingRules:  len(d.ForwardingRules()),
 		LazyConnectionEnabled: d.GetLazyConnection(),
+		DNSFrozen:             d.GetDNSFrozen(),
+		DNSBypassed:           d.GetDNSBypassed(),
+		DNSConfigOverride:     d.GetDNSConfigOverride(),
 	}
 
 	d.mux.RLock()
@@ -165,6 +165,163 @@ type Config struct {
 	NATExternalIPs []string
 	// CustomDNSAddress sets the DNS resolver listening address in format ip:port
 	CustomDNSAddress string
+	// DNSMirroredZones are answered from local copies synced from a co-located
+	// authoritative server, each in format zone=ip:port,
+	// e.g. "corp.example.com=127.0.0.1:5353"
+	DNSMirroredZones []string
+	// DNSZoneNotify are secondaries sent a DNS NOTIFY when the records of a custom
+	// zone change, each in format zone=ip:port[,ip:port],
+	// e.g. "corp.example.com=10.0.0.2:53,10.0.0.3:53"
+	DNSZoneNotify []string
+	// DNSAnswerLoopback answers localhost and the host's own name directly
+	// instead of forwarding them to upstream nameservers
+	DNSAnswerLoopback bool
+	// DNSSortAnswers orders A and AAAA answers by RFC 6724 address selection
+	// relative to the peer's own tunnel addresses
+	DNSSortAnswers bool
+	// DNSUnmatchedAction answers queries no nameserver group, route, zone or fallback
+	// handles with "refused", "nxdomain" or "servfail". Empty keeps the default REFUSED
+	DNSUnmatchedAction string
+	// DNSPrivateReverse keeps reverse queries for private address ranges from public upstreams:
+	// "private" forwards them to private upstreams only, "nxdomain" answers them locally. Empty or
+	// "forward" forwards them like any other query
+	DNSPrivateReverse string
+	// DNSDnstapOutput streams answered DNS queries in dnstap format to a collector,
+	// in format unix:///path or tcp://host:port. Empty disables it
+	DNSDnstapOutput string
+	// DNSUpstreamPoolSize is how many idle TCP connections are kept per upstream
+	// nameserver for reuse. Zero uses the default, negative disables reuse
+	DNSUpstreamPoolSize int
+	// DNSUpstreamIdleTimeout closes pooled upstream connections unused for this
+	// long. Zero uses the default
+	DNSUpstreamIdleTimeout time.Duration
+	// DNSReverseCacheSize answers PTR queries for addresses names of nameserver group
+	// match domains resolved to, remembering up to this many addresses. Zero disables it
+	DNSReverseCacheSize int
+	// DNSDisablePeerReverse stops answering PTR queries for addresses of the NetBird
+	// network with the FQDNs of the peers holding them
+	DNSDisablePeerReverse bool
+	// DNSResponseCacheSize makes every nameserver group handler cache up to this many
+	// answers for their TTL, negative answers for the SOA minimum. Zero disables it
+	DNSResponseCacheSize int
+	// DNSNoCacheGroups keeps the answers of nameserver groups out of the response cache.
+	// Entries are match domains or nameserver addresses, "." for primary groups
+	DNSNoCacheGroups []string
+	// DNSCacheTTLPolicies bound how long the response cache keeps answers per zone and query
+	// type, in format "zone types policy", e.g. "example.com NS,SOA min=1h" or ". TXT no-cache".
+	// The policy is "honor", "no-cache" or "min=duration" and/or "max=duration"
+	DNSCacheTTLPolicies []string
+	// DNSPersistResponseCache keeps the answers of the response cache in the state file, so the
+	// cache is warm after a restart. Answers expiring while the client is down are dropped
+	DNSPersistResponseCache bool
+	// DNSSwapQueueSize is how many queries are held back while the DNS handlers are
+	// replaced on a config update. Zero uses the default, negative disables it
+	DNSSwapQueueSize int
+	// DNSSwapQueueTimeout answers held back queries with SERVFAIL after this long.
+	// Zero uses the default
+	DNSSwapQueueTimeout time.Duration
+	// DNSSuppressAAAADomains answers AAAA queries for these domains and their subdomains
+	// with NODATA, for legacy applications on IPv4-only networks. "." applies to every
+	// name. Custom zones, mirrored zones and DNS routes keep their AAAA records
+	DNSSuppressAAAADomains []string
+	// DNSSealedZones never fall back to the host's original nameservers, names in them
+	// no custom zone or nameserver group answers get NXDOMAIN
+	DNSSealedZones []string
+	// DNSDefaultRecordTTL is the TTL custom zone records without one are answered with.
+	// Zero uses the default, negative answers them with TTL 0 so clients don't cache them
+	DNSDefaultRecordTTL time.Duration
+	// DNSRewriteRules rewrite answers of upstream nameservers, in format pattern=ip to
+	// replace the addresses or pattern=name to answer with a CNAME to name. The pattern
+	// is a name or a wildcard like *.cdn.example.com
+	DNSRewriteRules []string
+	// DNSUpstreamMaxInflight is how many queries may be forwarded to a nameserver group
+	// at once; queries beyond it wait briefly for a slot and are then answered REFUSED.
+	// Zero uses the default, negative disables the limit
+	DNSUpstreamMaxInflight int
+	// DNSGroupMaxInflight overrides DNSUpstreamMaxInflight for the nameserver groups
+	// matching a key, in format key=limit. The key is a match domain, a nameserver IP
+	// or "." for primary groups
+	DNSGroupMaxInflight []string
+	// DNSEDNSAllowlist lists the EDNS0 options, by name (nsid, ecs, expire, cookie,
+	// keepalive, padding, ede) or code, forwarded to upstream nameservers and returned
+	// from them; the others are stripped. Empty lets every option through
+	DNSEDNSAllowlist []string
+	// DNSGroupEDNSAllowlist overrides DNSEDNSAllowlist for the nameserver groups matching
+	// a key, in format key=option,option; key= strips every option. Keys are as for
+	// DNSGroupMaxInflight
+	DNSGroupEDNSAllowlist []string
+	// DNSGroupSelectionPolicy selects how the nameservers of the groups matching a key
+	// are queried, in format key=policy: "failover" tries them one at a time, "all"
+	// queries them at once and takes the first answer. Keys are as for
+	// DNSGroupMaxInflight
+	DNSGroupSelectionPolicy []string
+	// DNSGroupsDownPolicy selects how queries for a match domain are answered while every
+	// nameserver group serving it is deactivated, in format domain=policy: "query" keeps
+	// querying the groups, "stale" answers with their last answers, "servfail" fails the
+	// queries and "fallthrough" passes them on to the next nameservers. "." is the domain
+	// of primary groups
+	DNSGroupsDownPolicy []string
+	// DNSStripDNSSEC removes RRSIG, NSEC and NSEC3 records from responses to clients that
+	// didn't set the DO bit, for legacy stub resolvers that choke on them
+	DNSStripDNSSEC bool
+	// DNSMaxUDPResponseSize caps the responses to clients over UDP, larger ones are
+	// truncated so the client retries over TCP. Zero derives it from the tunnel MTU
+	DNSMaxUDPResponseSize int
+	// DNSTimePolicies let domains resolve only within a daily schedule and answer NXDOMAIN,
+	// or a redirect address, outside it. Format "domain[,domain...] days hh:mm-hh:mm
+	// [timezone] [redirect-ip]", e.g. "hr.example.com mon-fri 08:00-18:00 Europe/Berlin"
+	DNSTimePolicies []string
+	// DNSDoHPort serves DNS over HTTPS (RFC 8484) queries at /dns-query on this port of
+	// the netbird interface address, for netstack mode. Zero disables it
+	DNSDoHPort int
+	// DNSDoHCertFile and DNSDoHKeyFile are the PEM certificate and key served for DNS over HTTPS.
+	// Empty serves a self-signed certificate for the netbird interface address, its SHA-256
+	// fingerprint is logged on start
+	DNSDoHCertFile string
+	DNSDoHKeyFile  string
+	// DNSExpandSearchDomains answers single-label queries, e.g. "printer", with the
+	// records of the first search domain the name resolves in, for clients that send
+	// bare names without expanding them
+	DNSExpandSearchDomains bool
+	// DNSProbeInterval probes the nameservers of deactivated nameserver groups this often,
+	// reactivating a group once they answer. Zero disables it
+	DNSProbeInterval time.Duration
+	// DNSCaptivePortalPolicy short-circuits captive-portal-detection domains: "passthrough"
+	// forwards them to the host's original nameservers, "fixed" answers them with
+	// DNSCaptivePortalAddresses. Empty disables it
+	DNSCaptivePortalPolicy string
+	// DNSCaptivePortalDomains overrides the built-in list of captive-portal-detection domains
+	DNSCaptivePortalDomains []string
+	// DNSCaptivePortalAddresses are the answers of the "fixed" captive portal policy
+	DNSCaptivePortalAddresses []string
+	// DNSPostureRemediationAddress is the remediation page's address DNSPostureRemediationDomains
+	// resolve to while the peer fails one of DNSPostureChecks, every other name answering NXDOMAIN.
+	// Empty disables it
+	DNSPostureRemediationAddress string
+	// DNSPostureRemediationDomains are the domains, with their subdomains, resolving to
+	// DNSPostureRemediationAddress
+	DNSPostureRemediationDomains []string
+	// DNSPostureChecks are the IDs of the posture checks restricting DNS. Failing any other posture
+	// check leaves DNS untouched
+	DNSPostureChecks []string
+	// DNSServiceIP is the fake resolver address inside the NetBird network the DNS service answers
+	// on with a userspace interface. Empty, or used by a peer, selects a free address from the end
+	// of the network
+	DNSServiceIP string
+	// DNSConfigOverrideFile is a JSON file with a DNS config the client applies in place of the
+	// management one on startup, e.g. to test nameserver groups on a single peer. Empty disables it
+	DNSConfigOverrideFile string
+	// DNSMgmtCachePinned answers the NetBird infrastructure hostnames, i.e. management, signal,
+	// relay, STUN and TURN, with the addresses learned at login instead of refreshing them through
+	// the upstream nameservers, so they resolve while no upstream is reachable
+	DNSMgmtCachePinned bool
+	// DNSNameCaseFolding selects how DNS names are case-folded before they are matched to
+	// handlers: "ascii" matches them case-insensitively, "none" only matches names spelled with
+	// the configured case. Empty uses "ascii"
+	DNSNameCaseFolding string
+	// DNSRejectZoneOverlap refuses routed domains that would take queries for a custom zone away
+	// from the local resolver serving it. They are logged either way
+	DNSRejectZoneOverlap bool
 
 	// DisableAutoConnect determines whether the client should not start with the service
 	// it's set to false by default due to backwards compatibility
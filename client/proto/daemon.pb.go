@@ -2158,8 +2158,16 @@ type FullStatus struct {
 	// on it to know when to re-fetch ListNetworks via the push stream, instead
 	// of polling on every status snapshot.
 	NetworksRevision uint64 `protobuf:"varint,11,opt,name=networksRevision,proto3" json:"networksRevision,omitempty"`
-	unknownFields    protoimpl.UnknownFields
-	sizeCache        protoimpl.SizeCache
+	// dnsFrozen is set while DNS config updates from management are held back.
+	DnsFrozen bool `protobuf:"varint,12,opt,name=dnsFrozen,proto3" json:"dnsFrozen,omitempty"`
+	// dnsBypassed is set while the host uses its original nameservers instead
+	// of NetBird DNS.
+	DnsBypassed bool `protobuf:"varint,13,opt,name=dnsBypassed,proto3" json:"dnsBypassed,omitempty"`
+	// dnsConfigOverride is the file of the local DNS config override applied in
+	// place of the management DNS config, empty if none is active.
+	DnsConfigOverride string `protobuf:"bytes,14,opt,name=dnsConfigOverride,proto3" json:"dnsConfigOverride,omitempty"`
+	unknownFields     protoimpl.UnknownFields
+	sizeCache         protoimpl.SizeCache
 }
 
 func (x *FullStatus) Reset() {
@@ -2269,6 +2277,27 @@ func (x *FullStatus) GetNetworksRevision() uint64 {
 	return 0
 }
 
+func (x *FullStatus) GetDnsFrozen() bool {
+	if x != nil {
+		return x.DnsFrozen
+	}
+	return false
+}
+
+func (x *FullStatus) GetDnsBypassed() bool {
+	if x != nil {
+		return x.DnsBypassed
+	}
+	return false
+}
+
+func (x *FullStatus) GetDnsConfigOverride() string {
+	if x != nil {
+		return x.DnsConfigOverride
+	}
+	return ""
+}
+
 // Networks
 type ListNetworksRequest struct {
 	state         protoimpl.MessageState `protogen:"open.v1"`
@@ -6930,6 +6959,443 @@ func (*StopBundleCaptureResponse) Descriptor() ([]byte, []int) {
 	return file_daemon_proto_rawDescGZIP(), []int{106}
 }
 
+type SetDNSFreezeRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Frozen        bool                   `protobuf:"varint,1,opt,name=frozen,proto3" json:"frozen,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *SetDNSFreezeRequest) Reset() {
+	*x = SetDNSFreezeRequest{}
+	mi := &file_daemon_proto_msgTypes[107]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *SetDNSFreezeRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*SetDNSFreezeRequest) ProtoMessage() {}
+
+func (x *SetDNSFreezeRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_daemon_proto_msgTypes[107]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use SetDNSFreezeRequest.ProtoReflect.Descriptor instead.
+func (*SetDNSFreezeRequest) Descriptor() ([]byte, []int) {
+	return file_daemon_proto_rawDescGZIP(), []int{107}
+}
+
+func (x *SetDNSFreezeRequest) GetFrozen() bool {
+	if x != nil {
+		return x.Frozen
+	}
+	return false
+}
+
+type SetDNSFreezeResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *SetDNSFreezeResponse) Reset() {
+	*x = SetDNSFreezeResponse{}
+	mi := &file_daemon_proto_msgTypes[108]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *SetDNSFreezeResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*SetDNSFreezeResponse) ProtoMessage() {}
+
+func (x *SetDNSFreezeResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_daemon_proto_msgTypes[108]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use SetDNSFreezeResponse.ProtoReflect.Descriptor instead.
+func (*SetDNSFreezeResponse) Descriptor() ([]byte, []int) {
+	return file_daemon_proto_rawDescGZIP(), []int{108}
+}
+
+type SetDNSBypassRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Bypassed      bool                   `protobuf:"varint,1,opt,name=bypassed,proto3" json:"bypassed,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *SetDNSBypassRequest) Reset() {
+	*x = SetDNSBypassRequest{}
+	mi := &file_daemon_proto_msgTypes[109]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *SetDNSBypassRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*SetDNSBypassRequest) ProtoMessage() {}
+
+func (x *SetDNSBypassRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_daemon_proto_msgTypes[109]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use SetDNSBypassRequest.ProtoReflect.Descriptor instead.
+func (*SetDNSBypassRequest) Descriptor() ([]byte, []int) {
+	return file_daemon_proto_rawDescGZIP(), []int{109}
+}
+
+func (x *SetDNSBypassRequest) GetBypassed() bool {
+	if x != nil {
+		return x.Bypassed
+	}
+	return false
+}
+
+type SetDNSBypassResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *SetDNSBypassResponse) Reset() {
+	*x = SetDNSBypassResponse{}
+	mi := &file_daemon_proto_msgTypes[110]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *SetDNSBypassResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*SetDNSBypassResponse) ProtoMessage() {}
+
+func (x *SetDNSBypassResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_daemon_proto_msgTypes[110]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use SetDNSBypassResponse.ProtoReflect.Descriptor instead.
+func (*SetDNSBypassResponse) Descriptor() ([]byte, []int) {
+	return file_daemon_proto_rawDescGZIP(), []int{110}
+}
+
+type RunDNSDiagnosticsRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *RunDNSDiagnosticsRequest) Reset() {
+	*x = RunDNSDiagnosticsRequest{}
+	mi := &file_daemon_proto_msgTypes[111]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *RunDNSDiagnosticsRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*RunDNSDiagnosticsRequest) ProtoMessage() {}
+
+func (x *RunDNSDiagnosticsRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_daemon_proto_msgTypes[111]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use RunDNSDiagnosticsRequest.ProtoReflect.Descriptor instead.
+func (*RunDNSDiagnosticsRequest) Descriptor() ([]byte, []int) {
+	return file_daemon_proto_rawDescGZIP(), []int{111}
+}
+
+type RunDNSDiagnosticsResponse struct {
+	state    protoimpl.MessageState `protogen:"open.v1"`
+	Started  *timestamppb.Timestamp `protobuf:"bytes,1,opt,name=started,proto3" json:"started,omitempty"`
+	Duration *durationpb.Duration   `protobuf:"bytes,2,opt,name=duration,proto3" json:"duration,omitempty"`
+	// groups are the nameserver groups in configuration order, followed by the
+	// fallback servers if any.
+	Groups        []*DNSGroupDiagnostics `protobuf:"bytes,3,rep,name=groups,proto3" json:"groups,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *RunDNSDiagnosticsResponse) Reset() {
+	*x = RunDNSDiagnosticsResponse{}
+	mi := &file_daemon_proto_msgTypes[112]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *RunDNSDiagnosticsResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*RunDNSDiagnosticsResponse) ProtoMessage() {}
+
+func (x *RunDNSDiagnosticsResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_daemon_proto_msgTypes[112]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use RunDNSDiagnosticsResponse.ProtoReflect.Descriptor instead.
+func (*RunDNSDiagnosticsResponse) Descriptor() ([]byte, []int) {
+	return file_daemon_proto_rawDescGZIP(), []int{112}
+}
+
+func (x *RunDNSDiagnosticsResponse) GetStarted() *timestamppb.Timestamp {
+	if x != nil {
+		return x.Started
+	}
+	return nil
+}
+
+func (x *RunDNSDiagnosticsResponse) GetDuration() *durationpb.Duration {
+	if x != nil {
+		return x.Duration
+	}
+	return nil
+}
+
+func (x *RunDNSDiagnosticsResponse) GetGroups() []*DNSGroupDiagnostics {
+	if x != nil {
+		return x.Groups
+	}
+	return nil
+}
+
+type DNSGroupDiagnostics struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// id matches NSGroupState.id, empty for the fallback servers.
+	Id            string                    `protobuf:"bytes,1,opt,name=id,proto3" json:"id,omitempty"`
+	Domains       []string                  `protobuf:"bytes,2,rep,name=domains,proto3" json:"domains,omitempty"`
+	Primary       bool                      `protobuf:"varint,3,opt,name=primary,proto3" json:"primary,omitempty"`
+	Fallback      bool                      `protobuf:"varint,4,opt,name=fallback,proto3" json:"fallback,omitempty"`
+	Servers       []*DNSUpstreamDiagnostics `protobuf:"bytes,5,rep,name=servers,proto3" json:"servers,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *DNSGroupDiagnostics) Reset() {
+	*x = DNSGroupDiagnostics{}
+	mi := &file_daemon_proto_msgTypes[113]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *DNSGroupDiagnostics) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*DNSGroupDiagnostics) ProtoMessage() {}
+
+func (x *DNSGroupDiagnostics) ProtoReflect() protoreflect.Message {
+	mi := &file_daemon_proto_msgTypes[113]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use DNSGroupDiagnostics.ProtoReflect.Descriptor instead.
+func (*DNSGroupDiagnostics) Descriptor() ([]byte, []int) {
+	return file_daemon_proto_rawDescGZIP(), []int{113}
+}
+
+func (x *DNSGroupDiagnostics) GetId() string {
+	if x != nil {
+		return x.Id
+	}
+	return ""
+}
+
+func (x *DNSGroupDiagnostics) GetDomains() []string {
+	if x != nil {
+		return x.Domains
+	}
+	return nil
+}
+
+func (x *DNSGroupDiagnostics) GetPrimary() bool {
+	if x != nil {
+		return x.Primary
+	}
+	return false
+}
+
+func (x *DNSGroupDiagnostics) GetFallback() bool {
+	if x != nil {
+		return x.Fallback
+	}
+	return false
+}
+
+func (x *DNSGroupDiagnostics) GetServers() []*DNSUpstreamDiagnostics {
+	if x != nil {
+		return x.Servers
+	}
+	return nil
+}
+
+type DNSUpstreamDiagnostics struct {
+	state  protoimpl.MessageState `protogen:"open.v1"`
+	Server string                 `protobuf:"bytes,1,opt,name=server,proto3" json:"server,omitempty"`
+	// query is the sample query, e.g. "example.com. SOA".
+	Query string `protobuf:"bytes,2,opt,name=query,proto3" json:"query,omitempty"`
+	// reachable is set if the nameserver answered, whatever the rcode.
+	Reachable     bool                 `protobuf:"varint,3,opt,name=reachable,proto3" json:"reachable,omitempty"`
+	Latency       *durationpb.Duration `protobuf:"bytes,4,opt,name=latency,proto3" json:"latency,omitempty"`
+	Protocol      string               `protobuf:"bytes,5,opt,name=protocol,proto3" json:"protocol,omitempty"`
+	Rcode         string               `protobuf:"bytes,6,opt,name=rcode,proto3" json:"rcode,omitempty"`
+	Answers       []string             `protobuf:"bytes,7,rep,name=answers,proto3" json:"answers,omitempty"`
+	Error         string               `protobuf:"bytes,8,opt,name=error,proto3" json:"error,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *DNSUpstreamDiagnostics) Reset() {
+	*x = DNSUpstreamDiagnostics{}
+	mi := &file_daemon_proto_msgTypes[114]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *DNSUpstreamDiagnostics) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*DNSUpstreamDiagnostics) ProtoMessage() {}
+
+func (x *DNSUpstreamDiagnostics) ProtoReflect() protoreflect.Message {
+	mi := &file_daemon_proto_msgTypes[114]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use DNSUpstreamDiagnostics.ProtoReflect.Descriptor instead.
+func (*DNSUpstreamDiagnostics) Descriptor() ([]byte, []int) {
+	return file_daemon_proto_rawDescGZIP(), []int{114}
+}
+
+func (x *DNSUpstreamDiagnostics) GetServer() string {
+	if x != nil {
+		return x.Server
+	}
+	return ""
+}
+
+func (x *DNSUpstreamDiagnostics) GetQuery() string {
+	if x != nil {
+		return x.Query
+	}
+	return ""
+}
+
+func (x *DNSUpstreamDiagnostics) GetReachable() bool {
+	if x != nil {
+		return x.Reachable
+	}
+	return false
+}
+
+func (x *DNSUpstreamDiagnostics) GetLatency() *durationpb.Duration {
+	if x != nil {
+		return x.Latency
+	}
+	return nil
+}
+
+func (x *DNSUpstreamDiagnostics) GetProtocol() string {
+	if x != nil {
+		return x.Protocol
+	}
+	return ""
+}
+
+func (x *DNSUpstreamDiagnostics) GetRcode() string {
+	if x != nil {
+		return x.Rcode
+	}
+	return ""
+}
+
+func (x *DNSUpstreamDiagnostics) GetAnswers() []string {
+	if x != nil {
+		return x.Answers
+	}
+	return nil
+}
+
+func (x *DNSUpstreamDiagnostics) GetError() string {
+	if x != nil {
+		return x.Error
+	}
+	return ""
+}
+
 type PortInfo_Range struct {
 	state         protoimpl.MessageState `protogen:"open.v1"`
 	Start         uint32                 `protobuf:"varint,1,opt,name=start,proto3" json:"start,omitempty"`
@@ -6940,7 +7406,7 @@ type PortInfo_Range struct {
 
 func (x *PortInfo_Range) Reset() {
 	*x = PortInfo_Range{}
-	mi := &file_daemon_proto_msgTypes[108]
+	mi := &file_daemon_proto_msgTypes[116]
 	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 	ms.StoreMessageInfo(mi)
 }
@@ -6952,7 +7418,7 @@ func (x *PortInfo_Range) String() string {
 func (*PortInfo_Range) ProtoMessage() {}
 
 func (x *PortInfo_Range) ProtoReflect() protoreflect.Message {
-	mi := &file_daemon_proto_msgTypes[108]
+	mi := &file_daemon_proto_msgTypes[116]
 	if x != nil {
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		if ms.LoadMessageInfo() == nil {
@@ -7191,7 +7657,7 @@ const file_daemon_proto_rawDesc = "" +
 	"\fportForwards\x18\x05 \x03(\tR\fportForwards\"^\n" +
 	"\x0eSSHServerState\x12\x18\n" +
 	"\aenabled\x18\x01 \x01(\bR\aenabled\x122\n" +
-	"\bsessions\x18\x02 \x03(\v2\x16.daemon.SSHSessionInfoR\bsessions\"\xdb\x04\n" +
+	"\bsessions\x18\x02 \x03(\v2\x16.daemon.SSHSessionInfoR\bsessions\"\xc9\x05\n" +
 	"\n" +
 	"FullStatus\x12A\n" +
 	"\x0fmanagementState\x18\x01 \x01(\v2\x17.daemon.ManagementStateR\x0fmanagementState\x125\n" +
@@ -7206,7 +7672,10 @@ const file_daemon_proto_rawDesc = "" +
 	"\x15lazyConnectionEnabled\x18\t \x01(\bR\x15lazyConnectionEnabled\x12>\n" +
 	"\x0esshServerState\x18\n" +
 	" \x01(\v2\x16.daemon.SSHServerStateR\x0esshServerState\x12*\n" +
-	"\x10networksRevision\x18\v \x01(\x04R\x10networksRevision\"\x15\n" +
+	"\x10networksRevision\x18\v \x01(\x04R\x10networksRevision\x12\x1c\n" +
+	"\tdnsFrozen\x18\f \x01(\bR\tdnsFrozen\x12 \n" +
+	"\vdnsBypassed\x18\r \x01(\bR\vdnsBypassed\x12,\n" +
+	"\x11dnsConfigOverride\x18\x0e \x01(\tR\x11dnsConfigOverride\"\x15\n" +
 	"\x13ListNetworksRequest\"?\n" +
 	"\x14ListNetworksResponse\x12'\n" +
 	"\x06routes\x18\x01 \x03(\v2\x0f.daemon.NetworkR\x06routes\"a\n" +
@@ -7565,7 +8034,33 @@ const file_daemon_proto_rawDesc = "" +
 	"\atimeout\x18\x01 \x01(\v2\x19.google.protobuf.DurationR\atimeout\"\x1c\n" +
 	"\x1aStartBundleCaptureResponse\"\x1a\n" +
 	"\x18StopBundleCaptureRequest\"\x1b\n" +
-	"\x19StopBundleCaptureResponse*b\n" +
+	"\x19StopBundleCaptureResponse\"-\n" +
+	"\x13SetDNSFreezeRequest\x12\x16\n" +
+	"\x06frozen\x18\x01 \x01(\bR\x06frozen\"\x16\n" +
+	"\x14SetDNSFreezeResponse\"1\n" +
+	"\x13SetDNSBypassRequest\x12\x1a\n" +
+	"\bbypassed\x18\x01 \x01(\bR\bbypassed\"\x16\n" +
+	"\x14SetDNSBypassResponse\"\x1a\n" +
+	"\x18RunDNSDiagnosticsRequest\"\xbd\x01\n" +
+	"\x19RunDNSDiagnosticsResponse\x124\n" +
+	"\astarted\x18\x01 \x01(\v2\x1a.google.protobuf.TimestampR\astarted\x125\n" +
+	"\bduration\x18\x02 \x01(\v2\x19.google.protobuf.DurationR\bduration\x123\n" +
+	"\x06groups\x18\x03 \x03(\v2\x1b.daemon.DNSGroupDiagnosticsR\x06groups\"\xaf\x01\n" +
+	"\x13DNSGroupDiagnostics\x12\x0e\n" +
+	"\x02id\x18\x01 \x01(\tR\x02id\x12\x18\n" +
+	"\adomains\x18\x02 \x03(\tR\adomains\x12\x18\n" +
+	"\aprimary\x18\x03 \x01(\bR\aprimary\x12\x1a\n" +
+	"\bfallback\x18\x04 \x01(\bR\bfallback\x128\n" +
+	"\aservers\x18\x05 \x03(\v2\x1e.daemon.DNSUpstreamDiagnosticsR\aservers\"\xfb\x01\n" +
+	"\x16DNSUpstreamDiagnostics\x12\x16\n" +
+	"\x06server\x18\x01 \x01(\tR\x06server\x12\x14\n" +
+	"\x05query\x18\x02 \x01(\tR\x05query\x12\x1c\n" +
+	"\treachable\x18\x03 \x01(\bR\treachable\x123\n" +
+	"\alatency\x18\x04 \x01(\v2\x19.google.protobuf.DurationR\alatency\x12\x1a\n" +
+	"\bprotocol\x18\x05 \x01(\tR\bprotocol\x12\x14\n" +
+	"\x05rcode\x18\x06 \x01(\tR\x05rcode\x12\x18\n" +
+	"\aanswers\x18\a \x03(\tR\aanswers\x12\x14\n" +
+	"\x05error\x18\b \x01(\tR\x05error*b\n" +
 	"\bLogLevel\x12\v\n" +
 	"\aUNKNOWN\x10\x00\x12\t\n" +
 	"\x05PANIC\x10\x01\x12\t\n" +
@@ -7583,7 +8078,7 @@ const file_daemon_proto_rawDesc = "" +
 	"\n" +
 	"EXPOSE_UDP\x10\x03\x12\x0e\n" +
 	"\n" +
-	"EXPOSE_TLS\x10\x042\xa3\x1c\n" +
+	"EXPOSE_TLS\x10\x042\x99\x1e\n" +
 	"\rDaemonService\x126\n" +
 	"\x05Login\x12\x14.daemon.LoginRequest\x1a\x15.daemon.LoginResponse\"\x00\x12K\n" +
 	"\fWaitSSOLogin\x12\x1b.daemon.WaitSSOLoginRequest\x1a\x1c.daemon.WaitSSOLoginResponse\"\x00\x12-\n" +
@@ -7633,7 +8128,10 @@ const file_daemon_proto_rawDesc = "" +
 	"\x0eStopCPUProfile\x12\x1d.daemon.StopCPUProfileRequest\x1a\x1e.daemon.StopCPUProfileResponse\"\x00\x12W\n" +
 	"\x12GetInstallerResult\x12\x1e.daemon.InstallerResultRequest\x1a\x1f.daemon.InstallerResultResponse\"\x00\x12M\n" +
 	"\rExposeService\x12\x1c.daemon.ExposeServiceRequest\x1a\x1a.daemon.ExposeServiceEvent\"\x000\x01\x12K\n" +
-	"\fWailsUIReady\x12\x1b.daemon.WailsUIReadyRequest\x1a\x1c.daemon.WailsUIReadyResponse\"\x00B\bZ\x06/protob\x06proto3"
+	"\fWailsUIReady\x12\x1b.daemon.WailsUIReadyRequest\x1a\x1c.daemon.WailsUIReadyResponse\"\x00\x12K\n" +
+	"\fSetDNSFreeze\x12\x1b.daemon.SetDNSFreezeRequest\x1a\x1c.daemon.SetDNSFreezeResponse\"\x00\x12K\n" +
+	"\fSetDNSBypass\x12\x1b.daemon.SetDNSBypassRequest\x1a\x1c.daemon.SetDNSBypassResponse\"\x00\x12Z\n" +
+	"\x11RunDNSDiagnostics\x12 .daemon.RunDNSDiagnosticsRequest\x1a!.daemon.RunDNSDiagnosticsResponse\"\x00B\bZ\x06/protob\x06proto3"
 
 var (
 	file_daemon_proto_rawDescOnce sync.Once
@@ -7648,7 +8146,7 @@ func file_daemon_proto_rawDescGZIP() []byte {
 }
 
 var file_daemon_proto_enumTypes = make([]protoimpl.EnumInfo, 4)
-var file_daemon_proto_msgTypes = make([]protoimpl.MessageInfo, 110)
+var file_daemon_proto_msgTypes = make([]protoimpl.MessageInfo, 118)
 var file_daemon_proto_goTypes = []any{
 	(LogLevel)(0),                              // 0: daemon.LogLevel
 	(ExposeProtocol)(0),                        // 1: daemon.ExposeProtocol
@@ -7761,19 +8259,27 @@ var file_daemon_proto_goTypes = []any{
 	(*StartBundleCaptureResponse)(nil),         // 108: daemon.StartBundleCaptureResponse
 	(*StopBundleCaptureRequest)(nil),           // 109: daemon.StopBundleCaptureRequest
 	(*StopBundleCaptureResponse)(nil),          // 110: daemon.StopBundleCaptureResponse
-	nil,                                        // 111: daemon.Network.ResolvedIPsEntry
-	(*PortInfo_Range)(nil),                     // 112: daemon.PortInfo.Range
-	nil,                                        // 113: daemon.SystemEvent.MetadataEntry
-	(*durationpb.Duration)(nil),                // 114: google.protobuf.Duration
-	(*timestamppb.Timestamp)(nil),              // 115: google.protobuf.Timestamp
+	(*SetDNSFreezeRequest)(nil),                // 111: daemon.SetDNSFreezeRequest
+	(*SetDNSFreezeResponse)(nil),               // 112: daemon.SetDNSFreezeResponse
+	(*SetDNSBypassRequest)(nil),                // 113: daemon.SetDNSBypassRequest
+	(*SetDNSBypassResponse)(nil),               // 114: daemon.SetDNSBypassResponse
+	(*RunDNSDiagnosticsRequest)(nil),           // 115: daemon.RunDNSDiagnosticsRequest
+	(*RunDNSDiagnosticsResponse)(nil),          // 116: daemon.RunDNSDiagnosticsResponse
+	(*DNSGroupDiagnostics)(nil),                // 117: daemon.DNSGroupDiagnostics
+	(*DNSUpstreamDiagnostics)(nil),             // 118: daemon.DNSUpstreamDiagnostics
+	nil,                                        // 119: daemon.Network.ResolvedIPsEntry
+	(*PortInfo_Range)(nil),                     // 120: daemon.PortInfo.Range
+	nil,                                        // 121: daemon.SystemEvent.MetadataEntry
+	(*durationpb.Duration)(nil),                // 122: google.protobuf.Duration
+	(*timestamppb.Timestamp)(nil),              // 123: google.protobuf.Timestamp
 }
 var file_daemon_proto_depIdxs = []int32{
-	114, // 0: daemon.LoginRequest.dnsRouteInterval:type_name -> google.protobuf.Duration
+	122, // 0: daemon.LoginRequest.dnsRouteInterval:type_name -> google.protobuf.Duration
 	25,  // 1: daemon.StatusResponse.fullStatus:type_name -> daemon.FullStatus
-	115, // 2: daemon.StatusResponse.sessionExpiresAt:type_name -> google.protobuf.Timestamp
-	115, // 3: daemon.PeerState.connStatusUpdate:type_name -> google.protobuf.Timestamp
-	115, // 4: daemon.PeerState.lastWireguardHandshake:type_name -> google.protobuf.Timestamp
-	114, // 5: daemon.PeerState.latency:type_name -> google.protobuf.Duration
+	123, // 2: daemon.StatusResponse.sessionExpiresAt:type_name -> google.protobuf.Timestamp
+	123, // 3: daemon.PeerState.connStatusUpdate:type_name -> google.protobuf.Timestamp
+	123, // 4: daemon.PeerState.lastWireguardHandshake:type_name -> google.protobuf.Timestamp
+	122, // 5: daemon.PeerState.latency:type_name -> google.protobuf.Duration
 	23,  // 6: daemon.SSHServerState.sessions:type_name -> daemon.SSHSessionInfo
 	20,  // 7: daemon.FullStatus.managementState:type_name -> daemon.ManagementState
 	19,  // 8: daemon.FullStatus.signalState:type_name -> daemon.SignalState
@@ -7784,8 +8290,8 @@ var file_daemon_proto_depIdxs = []int32{
 	57,  // 13: daemon.FullStatus.events:type_name -> daemon.SystemEvent
 	24,  // 14: daemon.FullStatus.sshServerState:type_name -> daemon.SSHServerState
 	31,  // 15: daemon.ListNetworksResponse.routes:type_name -> daemon.Network
-	111, // 16: daemon.Network.resolvedIPs:type_name -> daemon.Network.ResolvedIPsEntry
-	112, // 17: daemon.PortInfo.range:type_name -> daemon.PortInfo.Range
+	119, // 16: daemon.Network.resolvedIPs:type_name -> daemon.Network.ResolvedIPsEntry
+	120, // 17: daemon.PortInfo.range:type_name -> daemon.PortInfo.Range
 	32,  // 18: daemon.ForwardingRule.destinationPort:type_name -> daemon.PortInfo
 	32,  // 19: daemon.ForwardingRule.translatedPort:type_name -> daemon.PortInfo
 	33,  // 20: daemon.ForwardingRulesResponse.rules:type_name -> daemon.ForwardingRule
@@ -7796,114 +8302,125 @@ var file_daemon_proto_depIdxs = []int32{
 	54,  // 25: daemon.TracePacketResponse.stages:type_name -> daemon.TraceStage
 	2,   // 26: daemon.SystemEvent.severity:type_name -> daemon.SystemEvent.Severity
 	3,   // 27: daemon.SystemEvent.category:type_name -> daemon.SystemEvent.Category
-	115, // 28: daemon.SystemEvent.timestamp:type_name -> google.protobuf.Timestamp
-	113, // 29: daemon.SystemEvent.metadata:type_name -> daemon.SystemEvent.MetadataEntry
+	123, // 28: daemon.SystemEvent.timestamp:type_name -> google.protobuf.Timestamp
+	121, // 29: daemon.SystemEvent.metadata:type_name -> daemon.SystemEvent.MetadataEntry
 	57,  // 30: daemon.GetEventsResponse.events:type_name -> daemon.SystemEvent
-	114, // 31: daemon.SetConfigRequest.dnsRouteInterval:type_name -> google.protobuf.Duration
+	122, // 31: daemon.SetConfigRequest.dnsRouteInterval:type_name -> google.protobuf.Duration
 	72,  // 32: daemon.ListProfilesResponse.profiles:type_name -> daemon.Profile
-	115, // 33: daemon.WaitExtendAuthSessionResponse.sessionExpiresAt:type_name -> google.protobuf.Timestamp
+	123, // 33: daemon.WaitExtendAuthSessionResponse.sessionExpiresAt:type_name -> google.protobuf.Timestamp
 	1,   // 34: daemon.ExposeServiceRequest.protocol:type_name -> daemon.ExposeProtocol
 	104, // 35: daemon.ExposeServiceEvent.ready:type_name -> daemon.ExposeServiceReady
-	114, // 36: daemon.StartCaptureRequest.duration:type_name -> google.protobuf.Duration
-	114, // 37: daemon.StartBundleCaptureRequest.timeout:type_name -> google.protobuf.Duration
-	30,  // 38: daemon.Network.ResolvedIPsEntry.value:type_name -> daemon.IPList
-	5,   // 39: daemon.DaemonService.Login:input_type -> daemon.LoginRequest
-	7,   // 40: daemon.DaemonService.WaitSSOLogin:input_type -> daemon.WaitSSOLoginRequest
-	9,   // 41: daemon.DaemonService.Up:input_type -> daemon.UpRequest
-	11,  // 42: daemon.DaemonService.Status:input_type -> daemon.StatusRequest
-	11,  // 43: daemon.DaemonService.SubscribeStatus:input_type -> daemon.StatusRequest
-	13,  // 44: daemon.DaemonService.Down:input_type -> daemon.DownRequest
-	15,  // 45: daemon.DaemonService.GetConfig:input_type -> daemon.GetConfigRequest
-	26,  // 46: daemon.DaemonService.ListNetworks:input_type -> daemon.ListNetworksRequest
-	28,  // 47: daemon.DaemonService.SelectNetworks:input_type -> daemon.SelectNetworksRequest
-	28,  // 48: daemon.DaemonService.DeselectNetworks:input_type -> daemon.SelectNetworksRequest
-	4,   // 49: daemon.DaemonService.ForwardingRules:input_type -> daemon.EmptyRequest
-	35,  // 50: daemon.DaemonService.DebugBundle:input_type -> daemon.DebugBundleRequest
-	37,  // 51: daemon.DaemonService.GetLogLevel:input_type -> daemon.GetLogLevelRequest
-	39,  // 52: daemon.DaemonService.SetLogLevel:input_type -> daemon.SetLogLevelRequest
-	44,  // 53: daemon.DaemonService.ListStates:input_type -> daemon.ListStatesRequest
-	46,  // 54: daemon.DaemonService.CleanState:input_type -> daemon.CleanStateRequest
-	48,  // 55: daemon.DaemonService.DeleteState:input_type -> daemon.DeleteStateRequest
-	50,  // 56: daemon.DaemonService.SetSyncResponsePersistence:input_type -> daemon.SetSyncResponsePersistenceRequest
-	53,  // 57: daemon.DaemonService.TracePacket:input_type -> daemon.TracePacketRequest
-	105, // 58: daemon.DaemonService.StartCapture:input_type -> daemon.StartCaptureRequest
-	107, // 59: daemon.DaemonService.StartBundleCapture:input_type -> daemon.StartBundleCaptureRequest
-	109, // 60: daemon.DaemonService.StopBundleCapture:input_type -> daemon.StopBundleCaptureRequest
-	56,  // 61: daemon.DaemonService.SubscribeEvents:input_type -> daemon.SubscribeRequest
-	58,  // 62: daemon.DaemonService.GetEvents:input_type -> daemon.GetEventsRequest
-	41,  // 63: daemon.DaemonService.RegisterUILog:input_type -> daemon.RegisterUILogRequest
-	60,  // 64: daemon.DaemonService.SwitchProfile:input_type -> daemon.SwitchProfileRequest
-	62,  // 65: daemon.DaemonService.SetConfig:input_type -> daemon.SetConfigRequest
-	64,  // 66: daemon.DaemonService.AddProfile:input_type -> daemon.AddProfileRequest
-	66,  // 67: daemon.DaemonService.RenameProfile:input_type -> daemon.RenameProfileRequest
-	68,  // 68: daemon.DaemonService.RemoveProfile:input_type -> daemon.RemoveProfileRequest
-	70,  // 69: daemon.DaemonService.ListProfiles:input_type -> daemon.ListProfilesRequest
-	73,  // 70: daemon.DaemonService.GetActiveProfile:input_type -> daemon.GetActiveProfileRequest
-	75,  // 71: daemon.DaemonService.Logout:input_type -> daemon.LogoutRequest
-	79,  // 72: daemon.DaemonService.GetFeatures:input_type -> daemon.GetFeaturesRequest
-	82,  // 73: daemon.DaemonService.TriggerUpdate:input_type -> daemon.TriggerUpdateRequest
-	84,  // 74: daemon.DaemonService.GetPeerSSHHostKey:input_type -> daemon.GetPeerSSHHostKeyRequest
-	86,  // 75: daemon.DaemonService.RequestJWTAuth:input_type -> daemon.RequestJWTAuthRequest
-	88,  // 76: daemon.DaemonService.WaitJWTToken:input_type -> daemon.WaitJWTTokenRequest
-	90,  // 77: daemon.DaemonService.RequestExtendAuthSession:input_type -> daemon.RequestExtendAuthSessionRequest
-	92,  // 78: daemon.DaemonService.WaitExtendAuthSession:input_type -> daemon.WaitExtendAuthSessionRequest
-	94,  // 79: daemon.DaemonService.DismissSessionWarning:input_type -> daemon.DismissSessionWarningRequest
-	96,  // 80: daemon.DaemonService.StartCPUProfile:input_type -> daemon.StartCPUProfileRequest
-	98,  // 81: daemon.DaemonService.StopCPUProfile:input_type -> daemon.StopCPUProfileRequest
-	100, // 82: daemon.DaemonService.GetInstallerResult:input_type -> daemon.InstallerResultRequest
-	102, // 83: daemon.DaemonService.ExposeService:input_type -> daemon.ExposeServiceRequest
-	77,  // 84: daemon.DaemonService.WailsUIReady:input_type -> daemon.WailsUIReadyRequest
-	6,   // 85: daemon.DaemonService.Login:output_type -> daemon.LoginResponse
-	8,   // 86: daemon.DaemonService.WaitSSOLogin:output_type -> daemon.WaitSSOLoginResponse
-	10,  // 87: daemon.DaemonService.Up:output_type -> daemon.UpResponse
-	12,  // 88: daemon.DaemonService.Status:output_type -> daemon.StatusResponse
-	12,  // 89: daemon.DaemonService.SubscribeStatus:output_type -> daemon.StatusResponse
-	14,  // 90: daemon.DaemonService.Down:output_type -> daemon.DownResponse
-	16,  // 91: daemon.DaemonService.GetConfig:output_type -> daemon.GetConfigResponse
-	27,  // 92: daemon.DaemonService.ListNetworks:output_type -> daemon.ListNetworksResponse
-	29,  // 93: daemon.DaemonService.SelectNetworks:output_type -> daemon.SelectNetworksResponse
-	29,  // 94: daemon.DaemonService.DeselectNetworks:output_type -> daemon.SelectNetworksResponse
-	34,  // 95: daemon.DaemonService.ForwardingRules:output_type -> daemon.ForwardingRulesResponse
-	36,  // 96: daemon.DaemonService.DebugBundle:output_type -> daemon.DebugBundleResponse
-	38,  // 97: daemon.DaemonService.GetLogLevel:output_type -> daemon.GetLogLevelResponse
-	40,  // 98: daemon.DaemonService.SetLogLevel:output_type -> daemon.SetLogLevelResponse
-	45,  // 99: daemon.DaemonService.ListStates:output_type -> daemon.ListStatesResponse
-	47,  // 100: daemon.DaemonService.CleanState:output_type -> daemon.CleanStateResponse
-	49,  // 101: daemon.DaemonService.DeleteState:output_type -> daemon.DeleteStateResponse
-	51,  // 102: daemon.DaemonService.SetSyncResponsePersistence:output_type -> daemon.SetSyncResponsePersistenceResponse
-	55,  // 103: daemon.DaemonService.TracePacket:output_type -> daemon.TracePacketResponse
-	106, // 104: daemon.DaemonService.StartCapture:output_type -> daemon.CapturePacket
-	108, // 105: daemon.DaemonService.StartBundleCapture:output_type -> daemon.StartBundleCaptureResponse
-	110, // 106: daemon.DaemonService.StopBundleCapture:output_type -> daemon.StopBundleCaptureResponse
-	57,  // 107: daemon.DaemonService.SubscribeEvents:output_type -> daemon.SystemEvent
-	59,  // 108: daemon.DaemonService.GetEvents:output_type -> daemon.GetEventsResponse
-	42,  // 109: daemon.DaemonService.RegisterUILog:output_type -> daemon.RegisterUILogResponse
-	61,  // 110: daemon.DaemonService.SwitchProfile:output_type -> daemon.SwitchProfileResponse
-	63,  // 111: daemon.DaemonService.SetConfig:output_type -> daemon.SetConfigResponse
-	65,  // 112: daemon.DaemonService.AddProfile:output_type -> daemon.AddProfileResponse
-	67,  // 113: daemon.DaemonService.RenameProfile:output_type -> daemon.RenameProfileResponse
-	69,  // 114: daemon.DaemonService.RemoveProfile:output_type -> daemon.RemoveProfileResponse
-	71,  // 115: daemon.DaemonService.ListProfiles:output_type -> daemon.ListProfilesResponse
-	74,  // 116: daemon.DaemonService.GetActiveProfile:output_type -> daemon.GetActiveProfileResponse
-	76,  // 117: daemon.DaemonService.Logout:output_type -> daemon.LogoutResponse
-	80,  // 118: daemon.DaemonService.GetFeatures:output_type -> daemon.GetFeaturesResponse
-	83,  // 119: daemon.DaemonService.TriggerUpdate:output_type -> daemon.TriggerUpdateResponse
-	85,  // 120: daemon.DaemonService.GetPeerSSHHostKey:output_type -> daemon.GetPeerSSHHostKeyResponse
-	87,  // 121: daemon.DaemonService.RequestJWTAuth:output_type -> daemon.RequestJWTAuthResponse
-	89,  // 122: daemon.DaemonService.WaitJWTToken:output_type -> daemon.WaitJWTTokenResponse
-	91,  // 123: daemon.DaemonService.RequestExtendAuthSession:output_type -> daemon.RequestExtendAuthSessionResponse
-	93,  // 124: daemon.DaemonService.WaitExtendAuthSession:output_type -> daemon.WaitExtendAuthSessionResponse
-	95,  // 125: daemon.DaemonService.DismissSessionWarning:output_type -> daemon.DismissSessionWarningResponse
-	97,  // 126: daemon.DaemonService.StartCPUProfile:output_type -> daemon.StartCPUProfileResponse
-	99,  // 127: daemon.DaemonService.StopCPUProfile:output_type -> daemon.StopCPUProfileResponse
-	101, // 128: daemon.DaemonService.GetInstallerResult:output_type -> daemon.InstallerResultResponse
-	103, // 129: daemon.DaemonService.ExposeService:output_type -> daemon.ExposeServiceEvent
-	78,  // 130: daemon.DaemonService.WailsUIReady:output_type -> daemon.WailsUIReadyResponse
-	85,  // [85:131] is the sub-list for method output_type
-	39,  // [39:85] is the sub-list for method input_type
-	39,  // [39:39] is the sub-list for extension type_name
-	39,  // [39:39] is the sub-list for extension extendee
-	0,   // [0:39] is the sub-list for field type_name
+	122, // 36: daemon.StartCaptureRequest.duration:type_name -> google.protobuf.Duration
+	122, // 37: daemon.StartBundleCaptureRequest.timeout:type_name -> google.protobuf.Duration
+	123, // 38: daemon.RunDNSDiagnosticsResponse.started:type_name -> google.protobuf.Timestamp
+	122, // 39: daemon.RunDNSDiagnosticsResponse.duration:type_name -> google.protobuf.Duration
+	117, // 40: daemon.RunDNSDiagnosticsResponse.groups:type_name -> daemon.DNSGroupDiagnostics
+	118, // 41: daemon.DNSGroupDiagnostics.servers:type_name -> daemon.DNSUpstreamDiagnostics
+	122, // 42: daemon.DNSUpstreamDiagnostics.latency:type_name -> google.protobuf.Duration
+	30,  // 43: daemon.Network.ResolvedIPsEntry.value:type_name -> daemon.IPList
+	5,   // 44: daemon.DaemonService.Login:input_type -> daemon.LoginRequest
+	7,   // 45: daemon.DaemonService.WaitSSOLogin:input_type -> daemon.WaitSSOLoginRequest
+	9,   // 46: daemon.DaemonService.Up:input_type -> daemon.UpRequest
+	11,  // 47: daemon.DaemonService.Status:input_type -> daemon.StatusRequest
+	11,  // 48: daemon.DaemonService.SubscribeStatus:input_type -> daemon.StatusRequest
+	13,  // 49: daemon.DaemonService.Down:input_type -> daemon.DownRequest
+	15,  // 50: daemon.DaemonService.GetConfig:input_type -> daemon.GetConfigRequest
+	26,  // 51: daemon.DaemonService.ListNetworks:input_type -> daemon.ListNetworksRequest
+	28,  // 52: daemon.DaemonService.SelectNetworks:input_type -> daemon.SelectNetworksRequest
+	28,  // 53: daemon.DaemonService.DeselectNetworks:input_type -> daemon.SelectNetworksRequest
+	4,   // 54: daemon.DaemonService.ForwardingRules:input_type -> daemon.EmptyRequest
+	35,  // 55: daemon.DaemonService.DebugBundle:input_type -> daemon.DebugBundleRequest
+	37,  // 56: daemon.DaemonService.GetLogLevel:input_type -> daemon.GetLogLevelRequest
+	39,  // 57: daemon.DaemonService.SetLogLevel:input_type -> daemon.SetLogLevelRequest
+	44,  // 58: daemon.DaemonService.ListStates:input_type -> daemon.ListStatesRequest
+	46,  // 59: daemon.DaemonService.CleanState:input_type -> daemon.CleanStateRequest
+	48,  // 60: daemon.DaemonService.DeleteState:input_type -> daemon.DeleteStateRequest
+	50,  // 61: daemon.DaemonService.SetSyncResponsePersistence:input_type -> daemon.SetSyncResponsePersistenceRequest
+	53,  // 62: daemon.DaemonService.TracePacket:input_type -> daemon.TracePacketRequest
+	105, // 63: daemon.DaemonService.StartCapture:input_type -> daemon.StartCaptureRequest
+	107, // 64: daemon.DaemonService.StartBundleCapture:input_type -> daemon.StartBundleCaptureRequest
+	109, // 65: daemon.DaemonService.StopBundleCapture:input_type -> daemon.StopBundleCaptureRequest
+	56,  // 66: daemon.DaemonService.SubscribeEvents:input_type -> daemon.SubscribeRequest
+	58,  // 67: daemon.DaemonService.GetEvents:input_type -> daemon.GetEventsRequest
+	41,  // 68: daemon.DaemonService.RegisterUILog:input_type -> daemon.RegisterUILogRequest
+	60,  // 69: daemon.DaemonService.SwitchProfile:input_type -> daemon.SwitchProfileRequest
+	62,  // 70: daemon.DaemonService.SetConfig:input_type -> daemon.SetConfigRequest
+	64,  // 71: daemon.DaemonService.AddProfile:input_type -> daemon.AddProfileRequest
+	66,  // 72: daemon.DaemonService.RenameProfile:input_type -> daemon.RenameProfileRequest
+	68,  // 73: daemon.DaemonService.RemoveProfile:input_type -> daemon.RemoveProfileRequest
+	70,  // 74: daemon.DaemonService.ListProfiles:input_type -> daemon.ListProfilesRequest
+	73,  // 75: daemon.DaemonService.GetActiveProfile:input_type -> daemon.GetActiveProfileRequest
+	75,  // 76: daemon.DaemonService.Logout:input_type -> daemon.LogoutRequest
+	79,  // 77: daemon.DaemonService.GetFeatures:input_type -> daemon.GetFeaturesRequest
+	82,  // 78: daemon.DaemonService.TriggerUpdate:input_type -> daemon.TriggerUpdateRequest
+	84,  // 79: daemon.DaemonService.GetPeerSSHHostKey:input_type -> daemon.GetPeerSSHHostKeyRequest
+	86,  // 80: daemon.DaemonService.RequestJWTAuth:input_type -> daemon.RequestJWTAuthRequest
+	88,  // 81: daemon.DaemonService.WaitJWTToken:input_type -> daemon.WaitJWTTokenRequest
+	90,  // 82: daemon.DaemonService.RequestExtendAuthSession:input_type -> daemon.RequestExtendAuthSessionRequest
+	92,  // 83: daemon.DaemonService.WaitExtendAuthSession:input_type -> daemon.WaitExtendAuthSessionRequest
+	94,  // 84: daemon.DaemonService.DismissSessionWarning:input_type -> daemon.DismissSessionWarningRequest
+	96,  // 85: daemon.DaemonService.StartCPUProfile:input_type -> daemon.StartCPUProfileRequest
+	98,  // 86: daemon.DaemonService.StopCPUProfile:input_type -> daemon.StopCPUProfileRequest
+	100, // 87: daemon.DaemonService.GetInstallerResult:input_type -> daemon.InstallerResultRequest
+	102, // 88: daemon.DaemonService.ExposeService:input_type -> daemon.ExposeServiceRequest
+	77,  // 89: daemon.DaemonService.WailsUIReady:input_type -> daemon.WailsUIReadyRequest
+	111, // 90: daemon.DaemonService.SetDNSFreeze:input_type -> daemon.SetDNSFreezeRequest
+	113, // 91: daemon.DaemonService.SetDNSBypass:input_type -> daemon.SetDNSBypassRequest
+	115, // 92: daemon.DaemonService.RunDNSDiagnostics:input_type -> daemon.RunDNSDiagnosticsRequest
+	6,   // 93: daemon.DaemonService.Login:output_type -> daemon.LoginResponse
+	8,   // 94: daemon.DaemonService.WaitSSOLogin:output_type -> daemon.WaitSSOLoginResponse
+	10,  // 95: daemon.DaemonService.Up:output_type -> daemon.UpResponse
+	12,  // 96: daemon.DaemonService.Status:output_type -> daemon.StatusResponse
+	12,  // 97: daemon.DaemonService.SubscribeStatus:output_type -> daemon.StatusResponse
+	14,  // 98: daemon.DaemonService.Down:output_type -> daemon.DownResponse
+	16,  // 99: daemon.DaemonService.GetConfig:output_type -> daemon.GetConfigResponse
+	27,  // 100: daemon.DaemonService.ListNetworks:output_type -> daemon.ListNetworksResponse
+	29,  // 101: daemon.DaemonService.SelectNetworks:output_type -> daemon.SelectNetworksResponse
+	29,  // 102: daemon.DaemonService.DeselectNetworks:output_type -> daemon.SelectNetworksResponse
+	34,  // 103: daemon.DaemonService.ForwardingRules:output_type -> daemon.ForwardingRulesResponse
+	36,  // 104: daemon.DaemonService.DebugBundle:output_type -> daemon.DebugBundleResponse
+	38,  // 105: daemon.DaemonService.GetLogLevel:output_type -> daemon.GetLogLevelResponse
+	40,  // 106: daemon.DaemonService.SetLogLevel:output_type -> daemon.SetLogLevelResponse
+	45,  // 107: daemon.DaemonService.ListStates:output_type -> daemon.ListStatesResponse
+	47,  // 108: daemon.DaemonService.CleanState:output_type -> daemon.CleanStateResponse
+	49,  // 109: daemon.DaemonService.DeleteState:output_type -> daemon.DeleteStateResponse
+	51,  // 110: daemon.DaemonService.SetSyncResponsePersistence:output_type -> daemon.SetSyncResponsePersistenceResponse
+	55,  // 111: daemon.DaemonService.TracePacket:output_type -> daemon.TracePacketResponse
+	106, // 112: daemon.DaemonService.StartCapture:output_type -> daemon.CapturePacket
+	108, // 113: daemon.DaemonService.StartBundleCapture:output_type -> daemon.StartBundleCaptureResponse
+	110, // 114: daemon.DaemonService.StopBundleCapture:output_type -> daemon.StopBundleCaptureResponse
+	57,  // 115: daemon.DaemonService.SubscribeEvents:output_type -> daemon.SystemEvent
+	59,  // 116: daemon.DaemonService.GetEvents:output_type -> daemon.GetEventsResponse
+	42,  // 117: daemon.DaemonService.RegisterUILog:output_type -> daemon.RegisterUILogResponse
+	61,  // 118: daemon.DaemonService.SwitchProfile:output_type -> daemon.SwitchProfileResponse
+	63,  // 119: daemon.DaemonService.SetConfig:output_type -> daemon.SetConfigResponse
+	65,  // 120: daemon.DaemonService.AddProfile:output_type -> daemon.AddProfileResponse
+	67,  // 121: daemon.DaemonService.RenameProfile:output_type -> daemon.RenameProfileResponse
+	69,  // 122: daemon.DaemonService.RemoveProfile:output_type -> daemon.RemoveProfileResponse
+	71,  // 123: daemon.DaemonService.ListProfiles:output_type -> daemon.ListProfilesResponse
+	74,  // 124: daemon.DaemonService.GetActiveProfile:output_type -> daemon.GetActiveProfileResponse
+	76,  // 125: daemon.DaemonService.Logout:output_type -> daemon.LogoutResponse
+	80,  // 126: daemon.DaemonService.GetFeatures:output_type -> daemon.GetFeaturesResponse
+	83,  // 127: daemon.DaemonService.TriggerUpdate:output_type -> daemon.TriggerUpdateResponse
+	85,  // 128: daemon.DaemonService.GetPeerSSHHostKey:output_type -> daemon.GetPeerSSHHostKeyResponse
+	87,  // 129: daemon.DaemonService.RequestJWTAuth:output_type -> daemon.RequestJWTAuthResponse
+	89,  // 130: daemon.DaemonService.WaitJWTToken:output_type -> daemon.WaitJWTTokenResponse
+	91,  // 131: daemon.DaemonService.RequestExtendAuthSession:output_type -> daemon.RequestExtendAuthSessionResponse
+	93,  // 132: daemon.DaemonService.WaitExtendAuthSession:output_type -> daemon.WaitExtendAuthSessionResponse
+	95,  // 133: daemon.DaemonService.DismissSessionWarning:output_type -> daemon.DismissSessionWarningResponse
+	97,  // 134: daemon.DaemonService.StartCPUProfile:output_type -> daemon.StartCPUProfileResponse
+	99,  // 135: daemon.DaemonService.StopCPUProfile:output_type -> daemon.StopCPUProfileResponse
+	101, // 136: daemon.DaemonService.GetInstallerResult:output_type -> daemon.InstallerResultResponse
+	103, // 137: daemon.DaemonService.ExposeService:output_type -> daemon.ExposeServiceEvent
+	78,  // 138: daemon.DaemonService.WailsUIReady:output_type -> daemon.WailsUIReadyResponse
+	112, // 139: daemon.DaemonService.SetDNSFreeze:output_type -> daemon.SetDNSFreezeResponse
+	114, // 140: daemon.DaemonService.SetDNSBypass:output_type -> daemon.SetDNSBypassResponse
+	116, // 141: daemon.DaemonService.RunDNSDiagnostics:output_type -> daemon.RunDNSDiagnosticsResponse
+	93,  // [93:142] is the sub-list for method output_type
+	44,  // [44:93] is the sub-list for method input_type
+	44,  // [44:44] is the sub-list for extension type_name
+	44,  // [44:44] is the sub-list for extension extendee
+	0,   // [0:44] is the sub-list for field type_name
 }
 
 func init() { file_daemon_proto_init() }
@@ -7935,7 +8452,7 @@ func file_daemon_proto_init() {
 			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
 			RawDescriptor: unsafe.Slice(unsafe.StringData(file_daemon_proto_rawDesc), len(file_daemon_proto_rawDesc)),
 			NumEnums:      4,
-			NumMessages:   110,
+			NumMessages:   118,
 			NumExtensions: 0,
 			NumServices:   1,
 		},
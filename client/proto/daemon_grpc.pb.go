@@ -65,6 +65,9 @@ const (
 	DaemonService_GetInstallerResult_FullMethodName         = "/daemon.DaemonService/GetInstallerResult"
 	DaemonService_ExposeService_FullMethodName              = "/daemon.DaemonService/ExposeService"
 	DaemonService_WailsUIReady_FullMethodName               = "/daemon.DaemonService/WailsUIReady"
+	DaemonService_SetDNSFreeze_FullMethodName               = "/daemon.DaemonService/SetDNSFreeze"
+	DaemonService_SetDNSBypass_FullMethodName               = "/daemon.DaemonService/SetDNSBypass"
+	DaemonService_RunDNSDiagnostics_FullMethodName          = "/daemon.DaemonService/RunDNSDiagnostics"
 )
 
 // DaemonServiceClient is the client API for DaemonService service.
@@ -171,6 +174,15 @@ type DaemonServiceClient interface {
 	// only cares whether the daemon implements it: an Unimplemented response
 	// means the daemon predates this UI and is too old to drive it.
 	WailsUIReady(ctx context.Context, in *WailsUIReadyRequest, opts ...grpc.CallOption) (*WailsUIReadyResponse, error)
+	// SetDNSFreeze holds back the DNS config updates from management, e.g. during a
+	// rollout, and applies the latest one held back once unfrozen
+	SetDNSFreeze(ctx context.Context, in *SetDNSFreezeRequest, opts ...grpc.CallOption) (*SetDNSFreezeResponse, error)
+	// SetDNSBypass points the host back at its original nameservers, bypassing
+	// NetBird DNS until the bypass is turned off again
+	SetDNSBypass(ctx context.Context, in *SetDNSBypassRequest, opts ...grpc.CallOption) (*SetDNSBypassResponse, error)
+	// RunDNSDiagnostics sends a sample query to every configured nameserver,
+	// including the fallback servers, without touching the live DNS state
+	RunDNSDiagnostics(ctx context.Context, in *RunDNSDiagnosticsRequest, opts ...grpc.CallOption) (*RunDNSDiagnosticsResponse, error)
 }
 
 type daemonServiceClient struct {
@@ -677,6 +689,36 @@ func (c *daemonServiceClient) WailsUIReady(ctx context.Context, in *WailsUIReady
 	return out, nil
 }
 
+func (c *daemonServiceClient) SetDNSFreeze(ctx context.Context, in *SetDNSFreezeRequest, opts ...grpc.CallOption) (*SetDNSFreezeResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(SetDNSFreezeResponse)
+	err := c.cc.Invoke(ctx, DaemonService_SetDNSFreeze_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *daemonServiceClient) SetDNSBypass(ctx context.Context, in *SetDNSBypassRequest, opts ...grpc.CallOption) (*SetDNSBypassResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(SetDNSBypassResponse)
+	err := c.cc.Invoke(ctx, DaemonService_SetDNSBypass_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *daemonServiceClient) RunDNSDiagnostics(ctx context.Context, in *RunDNSDiagnosticsRequest, opts ...grpc.CallOption) (*RunDNSDiagnosticsResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(RunDNSDiagnosticsResponse)
+	err := c.cc.Invoke(ctx, DaemonService_RunDNSDiagnostics_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
 // DaemonServiceServer is the server API for DaemonService service.
 // All implementations must embed UnimplementedDaemonServiceServer
 // for forward compatibility.
@@ -781,6 +823,15 @@ type DaemonServiceServer interface {
 	// only cares whether the daemon implements it: an Unimplemented response
 	// means the daemon predates this UI and is too old to drive it.
 	WailsUIReady(context.Context, *WailsUIReadyRequest) (*WailsUIReadyResponse, error)
+	// SetDNSFreeze holds back the DNS config updates from management, e.g. during a
+	// rollout, and applies the latest one held back once unfrozen
+	SetDNSFreeze(context.Context, *SetDNSFreezeRequest) (*SetDNSFreezeResponse, error)
+	// SetDNSBypass points the host back at its original nameservers, bypassing
+	// NetBird DNS until the bypass is turned off again
+	SetDNSBypass(context.Context, *SetDNSBypassRequest) (*SetDNSBypassResponse, error)
+	// RunDNSDiagnostics sends a sample query to every configured nameserver,
+	// including the fallback servers, without touching the live DNS state
+	RunDNSDiagnostics(context.Context, *RunDNSDiagnosticsRequest) (*RunDNSDiagnosticsResponse, error)
 	mustEmbedUnimplementedDaemonServiceServer()
 }
 
@@ -929,6 +980,15 @@ func (UnimplementedDaemonServiceServer) ExposeService(*ExposeServiceRequest, grp
 func (UnimplementedDaemonServiceServer) WailsUIReady(context.Context, *WailsUIReadyRequest) (*WailsUIReadyResponse, error) {
 	return nil, status.Error(codes.Unimplemented, "method WailsUIReady not implemented")
 }
+func (UnimplementedDaemonServiceServer) SetDNSFreeze(context.Context, *SetDNSFreezeRequest) (*SetDNSFreezeResponse, error) {
+	return nil, status.Error(codes.Unimplemented, "method SetDNSFreeze not implemented")
+}
+func (UnimplementedDaemonServiceServer) SetDNSBypass(context.Context, *SetDNSBypassRequest) (*SetDNSBypassResponse, error) {
+	return nil, status.Error(codes.Unimplemented, "method SetDNSBypass not implemented")
+}
+func (UnimplementedDaemonServiceServer) RunDNSDiagnostics(context.Context, *RunDNSDiagnosticsRequest) (*RunDNSDiagnosticsResponse, error) {
+	return nil, status.Error(codes.Unimplemented, "method RunDNSDiagnostics not implemented")
+}
 func (UnimplementedDaemonServiceServer) mustEmbedUnimplementedDaemonServiceServer() {}
 func (UnimplementedDaemonServiceServer) testEmbeddedByValue()                       {}
 
@@ -1750,6 +1810,60 @@ func _DaemonService_WailsUIReady_Handler(srv interface{}, ctx context.Context, d
 	return interceptor(ctx, in, info, handler)
 }
 
+func _DaemonService_SetDNSFreeze_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(SetDNSFreezeRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(DaemonServiceServer).SetDNSFreeze(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: DaemonService_SetDNSFreeze_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(DaemonServiceServer).SetDNSFreeze(ctx, req.(*SetDNSFreezeRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _DaemonService_SetDNSBypass_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(SetDNSBypassRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(DaemonServiceServer).SetDNSBypass(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: DaemonService_SetDNSBypass_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(DaemonServiceServer).SetDNSBypass(ctx, req.(*SetDNSBypassRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _DaemonService_RunDNSDiagnostics_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(RunDNSDiagnosticsRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(DaemonServiceServer).RunDNSDiagnostics(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: DaemonService_RunDNSDiagnostics_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(DaemonServiceServer).RunDNSDiagnostics(ctx, req.(*RunDNSDiagnosticsRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
 // DaemonService_ServiceDesc is the grpc.ServiceDesc for DaemonService service.
 // It's only intended for direct use with grpc.RegisterService,
 // and not to be introspected or modified (even as a copy)
@@ -1925,6 +2039,18 @@ var DaemonService_ServiceDesc = grpc.ServiceDesc{
 			MethodName: "WailsUIReady",
 			Handler:    _DaemonService_WailsUIReady_Handler,
 		},
+		{
+			MethodName: "SetDNSFreeze",
+			Handler:    _DaemonService_SetDNSFreeze_Handler,
+		},
+		{
+			MethodName: "SetDNSBypass",
+			Handler:    _DaemonService_SetDNSBypass_Handler,
+		},
+		{
+			MethodName: "RunDNSDiagnostics",
+			Handler:    _DaemonService_RunDNSDiagnostics_Handler,
+		},
 	},
 	Streams: []grpc.StreamDesc{
 		{
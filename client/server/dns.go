@@ -0,0 +1,104 @@
+package server
+
+import (
+	"context"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/durationpb"
+	"google.golang.org/protobuf/types/known/timestamppb"
+
+	"github.com/netbirdio/netbird/client/internal"
+	"github.com/netbirdio/netbird/client/internal/dns"
+	"github.com/netbirdio/netbird/client/proto"
+)
+
+// SetDNSFreeze holds back the DNS config updates from management or, with
+// frozen unset, applies the latest one held back and resumes applying them.
+func (s *Server) SetDNSFreeze(_ context.Context, req *proto.SetDNSFreezeRequest) (*proto.SetDNSFreezeResponse, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	engine, err := s.getDNSEngineLocked()
+	if err != nil {
+		return nil, err
+	}
+	if err := engine.FreezeDNS(req.GetFrozen()); err != nil {
+		return nil, status.Errorf(codes.Internal, "set dns freeze: %v", err)
+	}
+	return &proto.SetDNSFreezeResponse{}, nil
+}
+
+// SetDNSBypass points the host back at its original nameservers or, with
+// bypassed unset, routes the host DNS through NetBird again.
+func (s *Server) SetDNSBypass(_ context.Context, req *proto.SetDNSBypassRequest) (*proto.SetDNSBypassResponse, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	engine, err := s.getDNSEngineLocked()
+	if err != nil {
+		return nil, err
+	}
+	if err := engine.BypassDNS(req.GetBypassed()); err != nil {
+		return nil, status.Errorf(codes.Internal, "set dns bypass: %v", err)
+	}
+	return &proto.SetDNSBypassResponse{}, nil
+}
+
+// RunDNSDiagnostics sends a sample query to every configured nameserver
+// without touching the live DNS state. The server lock isn't held while
+// probing, so slow nameservers don't block other calls.
+func (s *Server) RunDNSDiagnostics(ctx context.Context, _ *proto.RunDNSDiagnosticsRequest) (*proto.RunDNSDiagnosticsResponse, error) {
+	s.mutex.Lock()
+	engine, err := s.getDNSEngineLocked()
+	s.mutex.Unlock()
+	if err != nil {
+		return nil, err
+	}
+
+	report, err := engine.RunDNSDiagnostics(ctx)
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "run dns diagnostics: %v", err)
+	}
+	return toProtoDNSDiagnostics(report), nil
+}
+
+func toProtoDNSDiagnostics(report dns.DiagnosticsReport) *proto.RunDNSDiagnosticsResponse {
+	resp := &proto.RunDNSDiagnosticsResponse{
+		Started:  timestamppb.New(report.Started),
+		Duration: durationpb.New(report.Duration),
+	}
+	for _, group := range report.Groups {
+		pbGroup := &proto.DNSGroupDiagnostics{
+			Id:       group.ID,
+			Domains:  group.Domains,
+			Primary:  group.Primary,
+			Fallback: group.Fallback,
+		}
+		for _, server := range group.Servers {
+			pbGroup.Servers = append(pbGroup.Servers, &proto.DNSUpstreamDiagnostics{
+				Server:    server.Server.String(),
+				Query:     server.Query,
+				Reachable: server.Reachable,
+				Latency:   durationpb.New(server.Latency),
+				Protocol:  server.Protocol,
+				Rcode:     server.Rcode,
+				Answers:   server.Answers,
+				Error:     server.Error,
+			})
+		}
+		resp.Groups = append(resp.Groups, pbGroup)
+	}
+	return resp
+}
+
+func (s *Server) getDNSEngineLocked() (*internal.Engine, error) {
+	if s.connectClient == nil {
+		return nil, status.Error(codes.FailedPrecondition, "client not connected")
+	}
+	engine := s.connectClient.Engine()
+	if engine == nil {
+		return nil, status.Error(codes.FailedPrecondition, "engine not initialized")
+	}
+	return engine, nil
+}
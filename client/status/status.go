@@ -159,6 +159,9 @@ type OutputOverview struct {
 	LazyConnectionEnabled   bool                       `json:"lazyConnectionEnabled" yaml:"lazyConnectionEnabled"`
 	ProfileName             string                     `json:"profileName" yaml:"profileName"`
 	SSHServerState          SSHServerStateOutput       `json:"sshServer" yaml:"sshServer"`
+	DNSFrozen               bool                       `json:"dnsFrozen,omitempty" yaml:"dnsFrozen,omitempty"`
+	DNSBypassed             bool                       `json:"dnsBypassed,omitempty" yaml:"dnsBypassed,omitempty"`
+	DNSConfigOverride       string                     `json:"dnsConfigOverride,omitempty" yaml:"dnsConfigOverride,omitempty"`
 	// SessionExpiresAt is the absolute UTC instant at which the peer's SSO
 	// session expires. nil when the peer is not SSO-tracked or login
 	// expiration is disabled. Pointer (rather than zero-value time.Time) so
@@ -209,6 +212,9 @@ func ConvertToStatusOutputOverview(pbFullStatus *proto.FullStatus, opts ConvertO
 		LazyConnectionEnabled:   pbFullStatus.GetLazyConnectionEnabled(),
 		ProfileName:             opts.ProfileName,
 		SSHServerState:          sshServerOverview,
+		DNSFrozen:               pbFullStatus.GetDnsFrozen(),
+		DNSBypassed:             pbFullStatus.GetDnsBypassed(),
+		DNSConfigOverride:       pbFullStatus.GetDnsConfigOverride(),
 	}
 	if !opts.SessionExpiresAt.IsZero() {
 		t := opts.SessionExpiresAt
@@ -507,6 +513,17 @@ func (o *OutputOverview) GeneralSummary(showURL bool, showRelays bool, showNameS
 		dnsServersString = fmt.Sprintf("%d/%d Available", countEnabled(o.NSServerGroups), len(o.NSServerGroups))
 	}
 
+	var dnsStateString string
+	if o.DNSFrozen {
+		dnsStateString = "DNS updates: frozen\n"
+	}
+	if o.DNSBypassed {
+		dnsStateString += "DNS bypass: on, the host uses its original nameservers\n"
+	}
+	if o.DNSConfigOverride != "" {
+		dnsStateString += fmt.Sprintf("DNS config: local override from %s, management updates held back\n", o.DNSConfigOverride)
+	}
+
 	rosenpassEnabledStatus := "false"
 	if o.RosenpassEnabled {
 		rosenpassEnabledStatus = "true"
@@ -605,6 +622,7 @@ func (o *OutputOverview) GeneralSummary(showURL bool, showRelays bool, showNameS
 			"Signal: %s\n"+
 			"Relays: %s\n"+
 			"Nameservers: %s\n"+
+			"%s"+
 			"FQDN: %s\n"+
 			"NetBird IP: %s\n"+
 			"%s"+
@@ -625,6 +643,7 @@ func (o *OutputOverview) GeneralSummary(showURL bool, showRelays bool, showNameS
 		signalConnString,
 		relaysString,
 		dnsServersString,
+		dnsStateString,
 		domain.Domain(o.FQDN).SafeString(),
 		interfaceIP,
 		ipv6Line,
@@ -689,6 +708,9 @@ func ToProtoFullStatus(fullStatus peer.FullStatus) *proto.FullStatus {
 	pbFullStatus.LocalPeerState.Networks = maps.Keys(fullStatus.LocalPeerState.Routes)
 	pbFullStatus.NumberOfForwardingRules = int32(fullStatus.NumOfForwardingRules)
 	pbFullStatus.LazyConnectionEnabled = fullStatus.LazyConnectionEnabled
+	pbFullStatus.DnsFrozen = fullStatus.DNSFrozen
+	pbFullStatus.DnsBypassed = fullStatus.DNSBypassed
+	pbFullStatus.DnsConfigOverride = fullStatus.DNSConfigOverride
 
 	for _, peerState := range fullStatus.Peers {
 		pbPeerState := &proto.PeerState{
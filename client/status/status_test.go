@@ -695,6 +695,22 @@ func TestSessionExpiresLineOmittedWhenNil(t *testing.T) {
 	assert.NotContains(t, out, "Session expires")
 }
 
+func TestDNSStateLines(t *testing.T) {
+	in := overview
+	out := in.GeneralSummary(false, false, false, false)
+	assert.NotContains(t, out, "DNS updates")
+	assert.NotContains(t, out, "DNS bypass")
+	assert.NotContains(t, out, "DNS config")
+
+	in.DNSFrozen = true
+	in.DNSBypassed = true
+	in.DNSConfigOverride = "/etc/netbird/dns-override.json"
+	out = in.GeneralSummary(false, false, false, false)
+	assert.Contains(t, out, "DNS updates: frozen\n")
+	assert.Contains(t, out, "DNS bypass: on, the host uses its original nameservers\n")
+	assert.Contains(t, out, "DNS config: local override from /etc/netbird/dns-override.json, management updates held back\n")
+}
+
 func TestMapRelaysTransport(t *testing.T) {
 	out := mapRelays([]*proto.RelayState{
 		{URI: "rels://relay.example:443", Available: true, Transport: "quic"},
@@ -81,6 +81,10 @@ type Info struct {
 	DisableSSHAuth                bool
 
 	SyncMessageVersion *int
+
+	// DNSServicePort is the port other peers reach the DNS service on at the
+	// overlay address, 0 when it doesn't listen there.
+	DNSServicePort uint16
 }
 
 func (i *Info) SetFlags(
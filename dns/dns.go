@@ -5,7 +5,9 @@ package dns
 import (
 	"fmt"
 	"net"
+	"net/netip"
 	"regexp"
+	"strconv"
 	"strings"
 
 	"github.com/miekg/dns"
@@ -27,6 +29,9 @@ const (
 
 const invalidHostLabel = "[^a-zA-Z0-9-]+"
 
+// DefaultDNS64Prefix is the well-known NAT64 prefix of RFC 6052
+var DefaultDNS64Prefix = netip.MustParsePrefix("64:ff9b::/96")
+
 // Config represents a dns configuration that is exchanged between management and peers
 type Config struct {
 	// ServiceEnable indicates if the service should be enabled
@@ -37,6 +42,15 @@ type Config struct {
 	CustomZones []CustomZone
 	// ForwarderPort is the port clients should connect to on routing peers for DNS forwarding
 	ForwarderPort uint16
+	// StaticHosts maps host names to their addresses, like a distributed hosts file.
+	// Unlike CustomZones they cover the listed names only, not the zones around them
+	StaticHosts map[string][]netip.Addr
+	// DNS64 makes the local resolver synthesize AAAA records from the A records
+	// of CustomZones names that have no AAAA record of their own (RFC 6147)
+	DNS64 bool
+	// DNS64Prefix is the NAT64 prefix the synthesized addresses are built from.
+	// DefaultDNS64Prefix is used if it's invalid
+	DNS64Prefix netip.Prefix
 }
 
 // CustomZone represents a custom zone to be resolved by the dns server
@@ -49,22 +63,89 @@ type CustomZone struct {
 	SearchDomainDisabled bool
 	// NonAuthoritative marks user-created zones
 	NonAuthoritative bool
+	// NoDataFallthrough lets NODATA answers of a non-authoritative zone fall
+	// through to lower-priority handlers, like NXDOMAIN does. Off by default
+	// so names that legitimately lack a record type aren't sent elsewhere.
+	NoDataFallthrough bool
+	// SubnetRecords answer clients within a subnet with different records
+	// than Records. A client is matched by the EDNS Client Subnet option of
+	// its query, or its source address without one. Names and types a
+	// matching set has no records for are answered from Records.
+	SubnetRecords []SubnetRecordSet
 }
 
-// SimpleRecord provides a simple DNS record specification for CNAME, A and AAAA records
+// SubnetRecordSet holds the records of a custom zone served to the clients
+// within Subnet, see CustomZone.SubnetRecords
+type SubnetRecordSet struct {
+	// Subnet the clients are matched against, the most specific set wins
+	Subnet netip.Prefix
+	// Records replace the zone's records of the same name and type
+	Records []SimpleRecord
+}
+
+// SimpleRecord provides a simple DNS record specification for CNAME, A, AAAA, SRV, SVCB and HTTPS records
 type SimpleRecord struct {
 	// Name domain name
 	Name string
-	// Type of record, 1 for A, 5 for CNAME, 28 for AAAA. see https://pkg.go.dev/github.com/miekg/dns@v1.1.41#pkg-constants
+	// Type of record, 1 for A, 5 for CNAME, 28 for AAAA, 33 for SRV, 64 for SVCB, 65 for HTTPS. see https://pkg.go.dev/github.com/miekg/dns@v1.1.41#pkg-constants
 	Type int
 	// Class dns class, currently use the DefaultClass for all records
 	Class string
 	// TTL time-to-live for the record
 	TTL int
-	// RData is the actual value resolved in a dns query
+	// RData is the actual value resolved in a dns query. For SRV records it holds
+	// "<priority> <weight> <port> <target>", see NewSRVRecord, and for SVCB and HTTPS
+	// records "<priority> <target> <key>=<value>...", see NewSVCBRecord
 	RData string
 }
 
+// SVCBParam is a service parameter of an SVCB or HTTPS record (RFC 9460), e.g. key "alpn"
+// with value "h2,h3", "port" or "ipv4hint"/"ipv6hint" with comma separated addresses.
+// Parameters without a registered name are given as "key<N>", with N the numeric key, and
+// passed on verbatim. Value is empty for parameters without one, e.g. "no-default-alpn"
+type SVCBParam struct {
+	Key   string
+	Value string
+}
+
+// NewSRVRecord returns an SRV record for name (e.g. "_sip._tcp.example.com") pointing at
+// target:port. Clients pick among records by lowest priority first, then randomly
+// weighted by weight (RFC 2782)
+func NewSRVRecord(name string, ttl int, priority, weight, port uint16, target string) SimpleRecord {
+	return SimpleRecord{
+		Name:  name,
+		Type:  int(dns.TypeSRV),
+		Class: DefaultClass,
+		TTL:   ttl,
+		RData: fmt.Sprintf("%d %d %d %s", priority, weight, port, dns.Fqdn(target)),
+	}
+}
+
+// NewSVCBRecord returns an SVCB record, or with rrType dns.TypeHTTPS an HTTPS record, for
+// name pointing clients at target with params. Priority 0 makes it an alias for target,
+// and target "." stands for name itself
+func NewSVCBRecord(name string, ttl int, rrType uint16, priority uint16, target string, params ...SVCBParam) SimpleRecord {
+	rdata := fmt.Sprintf("%d %s", priority, dns.Fqdn(target))
+	for _, p := range params {
+		rdata += " " + p.Key
+		if p.Value == "" {
+			continue
+		}
+		if strings.ContainsAny(p.Value, " \t\"\\") {
+			rdata += "=" + strconv.Quote(p.Value)
+		} else {
+			rdata += "=" + p.Value
+		}
+	}
+	return SimpleRecord{
+		Name:  name,
+		Type:  int(rrType),
+		Class: DefaultClass,
+		TTL:   ttl,
+		RData: rdata,
+	}
+}
+
 // String returns a string of the simple record formatted as:
 // <Name> <TTL> <Class> <Type> <RDATA>
 func (s SimpleRecord) String() string {
@@ -91,6 +172,24 @@ func (s SimpleRecord) Len() uint16 {
 			return 0
 		}
 		return net.IPv6len
+	case int(dns.TypeSRV):
+		fields := strings.Fields(s.RData)
+		if len(fields) != 4 {
+			return 0
+		}
+		// priority, weight and port, followed by the target name
+		target := fields[3]
+		if target == "." {
+			return 6 + 1
+		}
+		return uint16(6 + len(dns.Fqdn(target)) + 1)
+	case int(dns.TypeSVCB), int(dns.TypeHTTPS):
+		rr, err := dns.NewRR(s.String())
+		if err != nil || rr == nil {
+			return 0
+		}
+		// the record length without the length of its header
+		return uint16(dns.Len(rr) - dns.Len(&dns.ANY{Hdr: *rr.Header()}))
 	default:
 		return 0
 	}
@@ -4,8 +4,10 @@ import (
 	"fmt"
 	"net/netip"
 	"net/url"
+	"slices"
 	"strconv"
 	"strings"
+	"time"
 )
 
 const (
@@ -13,6 +15,12 @@ const (
 	InvalidNameServerType NameServerType = iota
 	// UDPNameServerType udp nameserver type
 	UDPNameServerType
+	// DOQNameServerType DNS over QUIC (RFC 9250) nameserver type
+	DOQNameServerType
+	// DOTNameServerType DNS over TLS (RFC 7858) nameserver type
+	DOTNameServerType
+	// TCPNameServerType tcp-only nameserver type
+	TCPNameServerType
 )
 
 const (
@@ -22,6 +30,12 @@ const (
 	InvalidNameServerTypeString = "invalid"
 	// UDPNameServerTypeString udp nameserver type as string
 	UDPNameServerTypeString = "udp"
+	// DOQNameServerTypeString DNS over QUIC nameserver type as string
+	DOQNameServerTypeString = "doq"
+	// DOTNameServerTypeString DNS over TLS nameserver type as string
+	DOTNameServerTypeString = "dot"
+	// TCPNameServerTypeString tcp nameserver type as string
+	TCPNameServerTypeString = "tcp"
 )
 
 // NameServerType nameserver type
@@ -32,6 +46,12 @@ func (n NameServerType) String() string {
 	switch n {
 	case UDPNameServerType:
 		return UDPNameServerTypeString
+	case DOQNameServerType:
+		return DOQNameServerTypeString
+	case DOTNameServerType:
+		return DOTNameServerTypeString
+	case TCPNameServerType:
+		return TCPNameServerTypeString
 	default:
 		return InvalidNameServerTypeString
 	}
@@ -42,11 +62,27 @@ func ToNameServerType(typeString string) NameServerType {
 	switch typeString {
 	case UDPNameServerTypeString:
 		return UDPNameServerType
+	case DOQNameServerTypeString:
+		return DOQNameServerType
+	case DOTNameServerTypeString:
+		return DOTNameServerType
+	case TCPNameServerTypeString:
+		return TCPNameServerType
 	default:
 		return InvalidNameServerType
 	}
 }
 
+const (
+	// SelectionPolicyFailover queries the nameservers of a group in order, the next one only
+	// when the previous one failed
+	SelectionPolicyFailover = "failover"
+	// SelectionPolicyRoundRobin starts each query at the next nameserver of a group in turn
+	SelectionPolicyRoundRobin = "round-robin"
+	// SelectionPolicyRandom starts each query at a random nameserver of a group
+	SelectionPolicyRandom = "random"
+)
+
 // NameServerGroup group of nameservers and with group ids
 type NameServerGroup struct {
 	// ID identifier of group
@@ -70,6 +106,30 @@ type NameServerGroup struct {
 	Enabled bool
 	// SearchDomainsEnabled indicates whether to add match domains to search domains list or not
 	SearchDomainsEnabled bool
+	// AuthoritativeOnly indicates the nameservers only serve their own zones and don't recurse,
+	// so forwarded queries are sent with the recursion-desired flag cleared
+	AuthoritativeOnly bool
+	// RelayPeers list of peer IDs that relay the group's queries. Only these peers query the
+	// nameservers directly; every other peer sends its queries to a relay peer's DNS service
+	// over WireGuard instead. Used when only some peers can reach the nameservers
+	RelayPeers []string `gorm:"serializer:json"`
+	// RelayPeerGroups list of peer group IDs whose members relay the group's queries, see RelayPeers
+	RelayPeerGroups []string `gorm:"serializer:json"`
+	// QueryTimeout is how long each nameserver of the group gets to answer a query before the
+	// next one is tried. Zero uses the client default
+	QueryTimeout time.Duration
+	// DeactivationThreshold is how many consecutive failures of a nameserver it takes for them
+	// to count against the group's health. Zero or one counts the first failure
+	DeactivationThreshold int
+	// ForwardClientSubnet lets the EDNS0 client subnet option of client queries through to the
+	// nameservers. Without it the option is stripped, so client addresses don't leak to them
+	ForwardClientSubnet bool
+	// DefaultClientSubnet is the client subnet sent to the nameservers for queries without one.
+	// The zero value sends none
+	DefaultClientSubnet netip.Prefix `gorm:"serializer:json"`
+	// SelectionPolicy is how queries are spread across the nameservers: SelectionPolicyFailover,
+	// SelectionPolicyRoundRobin or SelectionPolicyRandom. Empty fails over
+	SelectionPolicy string
 }
 
 // NameServer represents a DNS nameserver
@@ -80,6 +140,9 @@ type NameServer struct {
 	NSType NameServerType
 	// Port nameserver listening port
 	Port int
+	// Hostname of the nameserver, verified against its certificate for DNS over TLS. Empty
+	// verifies the IP address
+	Hostname string
 }
 
 // EventMeta returns activity event meta related to the nameserver group
@@ -90,9 +153,10 @@ func (g *NameServerGroup) EventMeta() map[string]any {
 // Copy copies a nameserver object
 func (n *NameServer) Copy() *NameServer {
 	return &NameServer{
-		IP:     n.IP,
-		NSType: n.NSType,
-		Port:   n.Port,
+		IP:       n.IP,
+		NSType:   n.NSType,
+		Port:     n.Port,
+		Hostname: n.Hostname,
 	}
 }
 
@@ -100,7 +164,8 @@ func (n *NameServer) Copy() *NameServer {
 func (n *NameServer) IsEqual(other *NameServer) bool {
 	return other.IP == n.IP &&
 		other.NSType == n.NSType &&
-		other.Port == n.Port
+		other.Port == n.Port &&
+		other.Hostname == n.Hostname
 }
 
 // AddrPort returns the nameserver as a netip.AddrPort
@@ -141,15 +206,23 @@ func ParseNameServerURL(nsURL string) (NameServer, error) {
 // Copy copies a nameserver group object
 func (g *NameServerGroup) Copy() *NameServerGroup {
 	nsGroup := &NameServerGroup{
-		ID:                   g.ID,
-		Name:                 g.Name,
-		Description:          g.Description,
-		NameServers:          make([]NameServer, len(g.NameServers)),
-		Groups:               make([]string, len(g.Groups)),
-		Enabled:              g.Enabled,
-		Primary:              g.Primary,
-		Domains:              make([]string, len(g.Domains)),
-		SearchDomainsEnabled: g.SearchDomainsEnabled,
+		ID:                    g.ID,
+		Name:                  g.Name,
+		Description:           g.Description,
+		NameServers:           make([]NameServer, len(g.NameServers)),
+		Groups:                make([]string, len(g.Groups)),
+		Enabled:               g.Enabled,
+		Primary:               g.Primary,
+		Domains:               make([]string, len(g.Domains)),
+		SearchDomainsEnabled:  g.SearchDomainsEnabled,
+		AuthoritativeOnly:     g.AuthoritativeOnly,
+		RelayPeers:            slices.Clone(g.RelayPeers),
+		RelayPeerGroups:       slices.Clone(g.RelayPeerGroups),
+		QueryTimeout:          g.QueryTimeout,
+		DeactivationThreshold: g.DeactivationThreshold,
+		ForwardClientSubnet:   g.ForwardClientSubnet,
+		DefaultClientSubnet:   g.DefaultClientSubnet,
+		SelectionPolicy:       g.SelectionPolicy,
 	}
 
 	copy(nsGroup.NameServers, g.NameServers)
@@ -166,9 +239,22 @@ func (g *NameServerGroup) IsEqual(other *NameServerGroup) bool {
 		other.Description == g.Description &&
 		other.Primary == g.Primary &&
 		other.SearchDomainsEnabled == g.SearchDomainsEnabled &&
+		other.AuthoritativeOnly == g.AuthoritativeOnly &&
+		other.QueryTimeout == g.QueryTimeout &&
+		other.DeactivationThreshold == g.DeactivationThreshold &&
+		other.ForwardClientSubnet == g.ForwardClientSubnet &&
+		other.DefaultClientSubnet == g.DefaultClientSubnet &&
+		other.SelectionPolicy == g.SelectionPolicy &&
 		compareNameServerList(g.NameServers, other.NameServers) &&
 		compareGroupsList(g.Groups, other.Groups) &&
-		compareGroupsList(g.Domains, other.Domains)
+		compareGroupsList(g.Domains, other.Domains) &&
+		compareGroupsList(g.RelayPeers, other.RelayPeers) &&
+		compareGroupsList(g.RelayPeerGroups, other.RelayPeerGroups)
+}
+
+// HasRelay reports whether the group's queries are relayed through peers.
+func (g *NameServerGroup) HasRelay() bool {
+	return len(g.RelayPeers) > 0 || len(g.RelayPeerGroups) > 0
 }
 
 func compareNameServerList(list, other []NameServer) bool {
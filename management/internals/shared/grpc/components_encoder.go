@@ -450,13 +450,27 @@ func (e *componentEncoder) encodeNameServerGroups(nsgs []*nbdns.NameServerGroup)
 			continue
 		}
 		entry := &proto.NameServerGroupRaw{
-			Id:                   nsg.PublicID,
-			Nameservers:          encodeNameServers(nsg.NameServers),
-			GroupIds:             e.groupPublicXids(nsg.Groups),
-			Primary:              nsg.Primary,
-			Domains:              nsg.Domains,
-			Enabled:              nsg.Enabled,
-			SearchDomainsEnabled: nsg.SearchDomainsEnabled,
+			Id:                    nsg.PublicID,
+			Nameservers:           encodeNameServers(nsg.NameServers),
+			GroupIds:              e.groupPublicXids(nsg.Groups),
+			Primary:               nsg.Primary,
+			Domains:               nsg.Domains,
+			Enabled:               nsg.Enabled,
+			SearchDomainsEnabled:  nsg.SearchDomainsEnabled,
+			AuthoritativeOnly:     nsg.AuthoritativeOnly,
+			QueryTimeoutNs:        int64(nsg.QueryTimeout),
+			DeactivationThreshold: int64(nsg.DeactivationThreshold),
+			ForwardClientSubnet:   nsg.ForwardClientSubnet,
+			SelectionPolicy:       nsg.SelectionPolicy,
+			RelayGroupIds:         e.groupPublicXids(nsg.RelayPeerGroups),
+		}
+		if nsg.DefaultClientSubnet.IsValid() {
+			entry.DefaultClientSubnet = nsg.DefaultClientSubnet.String()
+		}
+		for _, peerID := range nsg.RelayPeers {
+			if idx, ok := e.peerOrder[peerID]; ok {
+				entry.RelayPeerIndexes = append(entry.RelayPeerIndexes, idx)
+			}
 		}
 		out = append(out, entry)
 	}
@@ -470,9 +484,10 @@ func encodeNameServers(servers []nbdns.NameServer) []*proto.NameServer {
 	out := make([]*proto.NameServer, 0, len(servers))
 	for _, s := range servers {
 		out = append(out, &proto.NameServer{
-			IP:     s.IP.String(),
-			NSType: int64(s.NSType),
-			Port:   int64(s.Port),
+			IP:       s.IP.String(),
+			NSType:   int64(s.NSType),
+			Port:     int64(s.Port),
+			Hostname: s.Hostname,
 		})
 	}
 	return out
@@ -506,6 +521,7 @@ func encodeCustomZones(zones []nbdns.CustomZone) []*proto.CustomZone {
 			Records:              encodeSimpleRecords(z.Records),
 			SearchDomainDisabled: z.SearchDomainDisabled,
 			NonAuthoritative:     z.NonAuthoritative,
+			NoDataFallthrough:    z.NoDataFallthrough,
 		})
 	}
 	return out
@@ -701,6 +717,7 @@ func toPeerCompact(p *types.ComponentPeer) *proto.PeerCompact {
 		SupportsIpv6:           p.SupportsIPv6,
 		SupportsSourcePrefixes: p.SupportsSourcePrefixes,
 		ServerSshAllowed:       p.ServerSSHAllowed,
+		DnsServicePort:         uint32(p.DNSServicePort),
 	}
 	if !p.LastLogin.IsZero() {
 		pc.LastLoginUnixNano = p.LastLogin.UnixNano()
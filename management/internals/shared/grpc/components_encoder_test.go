@@ -583,11 +583,16 @@ func TestEncodeNetworkMapEnvelope_NameServerGroups(t *testing.T) {
 		ID: "nsg-1", PublicID: "50", Name: "Main", Description: "primary",
 		NameServers: []nbdns.NameServer{{
 			IP: netip.MustParseAddr("8.8.8.8"), NSType: nbdns.UDPNameServerType, Port: 53,
+		}, {
+			IP: netip.MustParseAddr("1.1.1.1"), NSType: nbdns.DOTNameServerType, Port: 853, Hostname: "one.one.one.one",
 		}},
 		Groups:  []string{"group-src", "group-not-persisted"},
 		Primary: true, Enabled: true,
-		Domains: []string{"corp.example"},
+		Domains:         []string{"corp.example"},
+		RelayPeers:      []string{"peer-a", "peer-not-in-account"},
+		RelayPeerGroups: []string{"group-src"},
 	}}
+	c.Peers["peer-a"].DNSServicePort = 5053
 
 	full := EncodeNetworkMapEnvelope(ComponentsEnvelopeInput{Components: c}).GetFull()
 
@@ -595,9 +600,14 @@ func TestEncodeNetworkMapEnvelope_NameServerGroups(t *testing.T) {
 	nsg := full.NameserverGroups[0]
 	assert.EqualValues(t, "50", nsg.Id)
 	assert.True(t, nsg.Primary)
-	require.Len(t, nsg.Nameservers, 1)
+	require.Len(t, nsg.Nameservers, 2)
 	assert.Equal(t, "8.8.8.8", nsg.Nameservers[0].IP)
+	assert.Equal(t, "one.one.one.one", nsg.Nameservers[1].Hostname, "DoT nameservers carry their hostname")
 	assert.Equal(t, []string{"1"}, nsg.GroupIds)
+	assert.Equal(t, []string{"1"}, nsg.RelayGroupIds)
+	assert.Len(t, nsg.RelayPeerIndexes, 1, "relay peers missing from the map are dropped")
+	require.Less(t, int(nsg.RelayPeerIndexes[0]), len(full.Peers))
+	assert.EqualValues(t, 5053, full.Peers[nsg.RelayPeerIndexes[0]].DnsServicePort, "relay peers carry their DNS service port")
 }
 
 func TestEncodeNetworkMapEnvelope_PostureFailedPeers(t *testing.T) {
@@ -56,6 +56,11 @@ const (
 	envConcurrentSyncs = "NB_MAX_CONCURRENT_SYNCS"
 
 	defaultSyncLim = 1000
+
+	// maxDNSApplyErrors and maxDNSApplyErrorLen cap the errors stored from
+	// a peer's DNS apply status report.
+	maxDNSApplyErrors   = 10
+	maxDNSApplyErrorLen = 256
 )
 
 // Server an instance of a Management gRPC API server
@@ -688,6 +693,7 @@ func extractPeerMeta(ctx context.Context, meta *proto.PeerSystemMeta) nbpeer.Pee
 		Files:              files,
 		Capabilities:       capabilitiesToInt32(meta.GetCapabilities()),
 		SyncMessageVersion: int(meta.GetSyncMessageVersion()),
+		DNSServicePort:     uint16(meta.GetDnsServicePort()),
 	}
 }
 
@@ -1263,6 +1269,58 @@ func (s *Server) SyncMeta(ctx context.Context, req *proto.EncryptedMessage) (*pr
 	return &proto.Empty{}, nil
 }
 
+// ReportDNSApplyStatus endpoint is used by peers to report whether the DNS config of a network map took effect.
+// The status is stored on the peer status, with the reported errors capped.
+func (s *Server) ReportDNSApplyStatus(ctx context.Context, req *proto.EncryptedMessage) (*proto.Empty, error) {
+	statusReq := &proto.DNSApplyStatusRequest{}
+	peerKey, err := s.parseRequest(ctx, req, statusReq)
+	if err != nil {
+		return nil, err
+	}
+
+	peer, err := s.accountManager.GetStore().GetPeerByPeerPubKey(ctx, store.LockingStrengthNone, peerKey.String())
+	if err != nil {
+		log.WithContext(ctx).Debugf("peer %s is not registered for DNS apply status", peerKey.String())
+		return nil, mapError(ctx, err)
+	}
+
+	reportedAt := time.Now().UTC()
+	peerStatus := nbpeer.PeerStatus{
+		DNSSerial:     statusReq.GetSerial(),
+		DNSApplied:    statusReq.GetApplied(),
+		DNSErrors:     capDNSApplyErrors(statusReq.GetErrors()),
+		DNSReportedAt: &reportedAt,
+	}
+	if err := s.accountManager.GetStore().SavePeerDNSStatus(ctx, peer.AccountID, peer.ID, peerStatus); err != nil {
+		return nil, mapError(ctx, err)
+	}
+
+	if peerStatus.DNSApplied {
+		log.WithContext(ctx).Debugf("peer %s applied DNS config of serial %d", peer.ID, peerStatus.DNSSerial)
+	} else {
+		log.WithContext(ctx).Debugf("peer %s failed to apply DNS config of serial %d with %d errors: %s",
+			peer.ID, peerStatus.DNSSerial, len(statusReq.GetErrors()), strings.Join(peerStatus.DNSErrors, "; "))
+	}
+
+	return &proto.Empty{}, nil
+}
+
+// capDNSApplyErrors bounds the peer-supplied errors of a DNS apply status
+// report to maxDNSApplyErrors entries of maxDNSApplyErrorLen bytes.
+func capDNSApplyErrors(errs []string) []string {
+	if len(errs) == 0 {
+		return nil
+	}
+	capped := make([]string, 0, min(len(errs), maxDNSApplyErrors))
+	for _, e := range errs[:min(len(errs), maxDNSApplyErrors)] {
+		if len(e) > maxDNSApplyErrorLen {
+			e = strings.ToValidUTF8(e[:maxDNSApplyErrorLen], "")
+		}
+		capped = append(capped, e)
+	}
+	return capped
+}
+
 func (s *Server) Logout(ctx context.Context, req *proto.EncryptedMessage) (*proto.Empty, error) {
 	log.WithContext(ctx).Debugf("Logout request from peer [%s]", req.WgPubKey)
 	start := time.Now()
@@ -2,14 +2,23 @@ package grpc
 
 import (
 	"context"
+	"strings"
 	"testing"
 
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 	"golang.zx2c4.com/wireguard/wgctrl/wgtypes"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
 
 	"github.com/netbirdio/netbird/encryption"
 	"github.com/netbirdio/netbird/management/internals/server/config"
+	"github.com/netbirdio/netbird/management/server/mock_server"
+	nbpeer "github.com/netbirdio/netbird/management/server/peer"
+	"github.com/netbirdio/netbird/management/server/store"
 	mgmtProto "github.com/netbirdio/netbird/shared/management/proto"
+	internalStatus "github.com/netbirdio/netbird/shared/management/status"
 )
 
 func TestServer_GetDeviceAuthorizationFlow(t *testing.T) {
@@ -106,3 +115,64 @@ func TestServer_GetDeviceAuthorizationFlow(t *testing.T) {
 		})
 	}
 }
+
+func TestServer_ReportDNSApplyStatus(t *testing.T) {
+	serverKey, err := wgtypes.GeneratePrivateKey()
+	require.NoError(t, err)
+	peerKey, err := wgtypes.GeneratePrivateKey()
+	require.NoError(t, err)
+
+	ctrl := gomock.NewController(t)
+	mockStore := store.NewMockStore(ctrl)
+	mgmtServer := &Server{
+		secretsManager: &TimeBasedAuthSecretsManager{wgKey: serverKey},
+		accountManager: &mock_server.MockAccountManager{
+			GetStoreFunc: func() store.Store { return mockStore },
+		},
+	}
+
+	report := func(t *testing.T, msg *mgmtProto.DNSApplyStatusRequest) error {
+		t.Helper()
+		body, err := encryption.EncryptMessage(serverKey.PublicKey(), peerKey, msg)
+		require.NoError(t, err)
+		_, err = mgmtServer.ReportDNSApplyStatus(context.Background(), &mgmtProto.EncryptedMessage{
+			WgPubKey: peerKey.PublicKey().String(),
+			Body:     body,
+		})
+		return err
+	}
+
+	t.Run("unregistered peer", func(t *testing.T) {
+		mockStore.EXPECT().
+			GetPeerByPeerPubKey(gomock.Any(), store.LockingStrengthNone, peerKey.PublicKey().String()).
+			Return(nil, internalStatus.NewPeerNotFoundError(peerKey.PublicKey().String()))
+
+		err := report(t, &mgmtProto.DNSApplyStatusRequest{Serial: 3, Applied: true})
+		assert.Equal(t, codes.NotFound, status.Code(err))
+	})
+
+	t.Run("errors are capped", func(t *testing.T) {
+		errs := make([]string, 50)
+		for i := range errs {
+			errs[i] = strings.Repeat("x", 10*maxDNSApplyErrorLen)
+		}
+
+		mockStore.EXPECT().
+			GetPeerByPeerPubKey(gomock.Any(), store.LockingStrengthNone, peerKey.PublicKey().String()).
+			Return(&nbpeer.Peer{ID: "peer1", AccountID: "account1"}, nil)
+		mockStore.EXPECT().
+			SavePeerDNSStatus(gomock.Any(), "account1", "peer1", gomock.Any()).
+			DoAndReturn(func(_ context.Context, _, _ string, peerStatus nbpeer.PeerStatus) error {
+				assert.Equal(t, uint64(7), peerStatus.DNSSerial)
+				assert.False(t, peerStatus.DNSApplied)
+				assert.Len(t, peerStatus.DNSErrors, maxDNSApplyErrors)
+				for _, e := range peerStatus.DNSErrors {
+					assert.Len(t, e, maxDNSApplyErrorLen)
+				}
+				assert.NotNil(t, peerStatus.DNSReportedAt)
+				return nil
+			})
+
+		require.NoError(t, report(t, &mgmtProto.DNSApplyStatusRequest{Serial: 7, Errors: errs}))
+	})
+}
@@ -604,6 +604,7 @@ func toSinglePeerResponse(peer *nbpeer.Peer, groupsInfo []api.GroupMinimum, dnsD
 		SerialNumber:                peer.Meta.SystemSerialNumber,
 		InactivityExpirationEnabled: peer.InactivityExpirationEnabled,
 		Ephemeral:                   peer.Ephemeral,
+		DnsApplyStatus:              toDNSApplyStatusResponse(peer.Status),
 		LocalFlags: &api.PeerLocalFlags{
 			BlockInbound:          &peer.Meta.Flags.BlockInbound,
 			BlockLanAccess:        &peer.Meta.Flags.BlockLANAccess,
@@ -625,6 +626,24 @@ func toSinglePeerResponse(peer *nbpeer.Peer, groupsInfo []api.GroupMinimum, dnsD
 	return apiPeer
 }
 
+// toDNSApplyStatusResponse returns the DNS apply status the peer last
+// reported, nil if it never reported one.
+func toDNSApplyStatusResponse(peerStatus *nbpeer.PeerStatus) *api.PeerDNSApplyStatus {
+	if peerStatus == nil || peerStatus.DNSReportedAt == nil {
+		return nil
+	}
+	errs := peerStatus.DNSErrors
+	if errs == nil {
+		errs = []string{}
+	}
+	return &api.PeerDNSApplyStatus{
+		Serial:     int64(peerStatus.DNSSerial),
+		Applied:    peerStatus.DNSApplied,
+		Errors:     errs,
+		ReportedAt: *peerStatus.DNSReportedAt,
+	}
+}
+
 func toPeerListItemResponse(peer *nbpeer.Peer, groupsInfo []api.GroupMinimum, dnsDomain string, accessiblePeersCount int) *api.PeerBatch {
 	osVersion := peer.Meta.OSVersion
 	if osVersion == "" {
@@ -659,6 +678,7 @@ func toPeerListItemResponse(peer *nbpeer.Peer, groupsInfo []api.GroupMinimum, dn
 		SerialNumber:                peer.Meta.SystemSerialNumber,
 		InactivityExpirationEnabled: peer.InactivityExpirationEnabled,
 		Ephemeral:                   peer.Ephemeral,
+		DnsApplyStatus:              toDNSApplyStatusResponse(peer.Status),
 		LocalFlags: &api.PeerLocalFlags{
 			BlockInbound:          &peer.Meta.Flags.BlockInbound,
 			BlockLanAccess:        &peer.Meta.Flags.BlockLANAccess,
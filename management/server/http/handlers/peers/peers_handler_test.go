@@ -602,3 +602,17 @@ func TestPeersHandlerUpdatePeerIP(t *testing.T) {
 		})
 	}
 }
+
+func TestToDNSApplyStatusResponse(t *testing.T) {
+	assert.Nil(t, toDNSApplyStatusResponse(&nbpeer.PeerStatus{Connected: true}), "peers that never reported have no status")
+
+	reportedAt := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+	resp := toDNSApplyStatusResponse(&nbpeer.PeerStatus{DNSSerial: 9, DNSApplied: true, DNSReportedAt: &reportedAt})
+	require.NotNil(t, resp)
+	assert.Equal(t, api.PeerDNSApplyStatus{Serial: 9, Applied: true, Errors: []string{}, ReportedAt: reportedAt}, *resp)
+
+	resp = toDNSApplyStatusResponse(&nbpeer.PeerStatus{DNSSerial: 10, DNSErrors: []string{"upstream: timeout"}, DNSReportedAt: &reportedAt})
+	require.NotNil(t, resp)
+	assert.False(t, resp.Applied)
+	assert.Equal(t, []string{"upstream: timeout"}, resp.Errors)
+}
@@ -99,6 +99,15 @@ type PeerStatus struct { //nolint:revive
 	LoginExpired bool
 	// RequiresApproval indicates whether peer requires approval or not
 	RequiresApproval bool
+	// DNSSerial is the network map serial of the DNS config the peer last
+	// reported on, zero if it never reported.
+	DNSSerial uint64
+	// DNSApplied indicates whether the peer applied that DNS config
+	DNSApplied bool
+	// DNSErrors are the errors the peer reported applying it, capped
+	DNSErrors []string `gorm:"serializer:json"`
+	// DNSReportedAt is when the peer last reported on its DNS config
+	DNSReportedAt *time.Time
 }
 
 // Location is a geo location information of a Peer based on public connection IP
@@ -175,6 +184,9 @@ type PeerSystemMeta struct { //nolint:revive
 	Files              []File      `gorm:"serializer:json"`
 	Capabilities       []int32     `gorm:"serializer:json"`
 	SyncMessageVersion int
+	// DNSServicePort is the port other peers reach the peer's DNS service on
+	// at its overlay address, 0 when the service doesn't listen there.
+	DNSServicePort uint16
 }
 
 func (p PeerSystemMeta) isEqual(other PeerSystemMeta) bool {
@@ -228,6 +240,7 @@ func (p *Peer) ToComponent() *sharedTypes.ComponentPeer {
 		SupportsIPv6:           p.SupportsIPv6(),
 		LoginExpirationEnabled: p.LoginExpirationEnabled,
 		AddedWithSSOLogin:      p.AddedWithSSOLogin(),
+		DNSServicePort:         p.Meta.DNSServicePort,
 	}
 	if p.LastLogin != nil {
 		cp.LastLogin = *p.LastLogin
@@ -370,6 +383,11 @@ func (d *MetaDiff) HostnameChanged() bool {
 	return d.OldMeta.Hostname != d.NewMeta.Hostname
 }
 
+// DNSServicePortChanged reports whether the port other peers reach the peer's DNS service on changed.
+func (d *MetaDiff) DNSServicePortChanged() bool {
+	return d.OldMeta.DNSServicePort != d.NewMeta.DNSServicePort
+}
+
 // LogSummary renders the changed fields as a single human-readable line.
 func (d *MetaDiff) LogSummary() string {
 	return fmt.Sprintf("peer meta updated, %d field(s) changed: %s",
@@ -449,6 +467,9 @@ func diffMeta(oldMeta, newMeta PeerSystemMeta, oldLocation, newLocation Location
 	if oldMeta.SyncMessageVersion != newMeta.SyncMessageVersion {
 		add("sync_meta_version", fmt.Sprintf("%d", oldMeta.SyncMessageVersion), fmt.Sprintf("%d", newMeta.SyncMessageVersion))
 	}
+	if oldMeta.DNSServicePort != newMeta.DNSServicePort {
+		add("dns_service_port", oldMeta.DNSServicePort, newMeta.DNSServicePort)
+	}
 
 	if !oldLocation.equal(newLocation) {
 		add("connection_ip", oldLocation.ConnectionIP, newLocation.ConnectionIP)
@@ -574,6 +595,10 @@ func (p *PeerStatus) Copy() *PeerStatus {
 		Connected:        p.Connected,
 		LoginExpired:     p.LoginExpired,
 		RequiresApproval: p.RequiresApproval,
+		DNSSerial:        p.DNSSerial,
+		DNSApplied:       p.DNSApplied,
+		DNSErrors:        slices.Clone(p.DNSErrors),
+		DNSReportedAt:    p.DNSReportedAt,
 	}
 }
 
@@ -523,6 +523,31 @@ func (s *SqlStore) SavePeerStatus(ctx context.Context, accountID, peerID string,
 	return nil
 }
 
+// SavePeerDNSStatus stores the DNS apply status a peer reported, leaving the
+// rest of its status untouched.
+func (s *SqlStore) SavePeerDNSStatus(ctx context.Context, accountID, peerID string, peerStatus nbpeer.PeerStatus) error {
+	var peerCopy nbpeer.Peer
+	peerCopy.Status = &peerStatus
+
+	fieldsToUpdate := []string{
+		"peer_status_dns_serial", "peer_status_dns_applied",
+		"peer_status_dns_errors", "peer_status_dns_reported_at",
+	}
+	result := s.db.Model(&nbpeer.Peer{}).
+		Select(fieldsToUpdate).
+		Where(accountAndIDQueryCondition, accountID, peerID).
+		Updates(&peerCopy)
+	if result.Error != nil {
+		return status.Errorf(status.Internal, "failed to save peer DNS status to store: %v", result.Error)
+	}
+
+	if result.RowsAffected == 0 {
+		return status.Errorf(status.NotFound, peerNotFoundFMT, peerID)
+	}
+
+	return nil
+}
+
 // MarkPeerConnectedIfNewerSession is an atomic optimistic-locked update.
 // The peer is marked connected with the given session token only when
 // the stored SessionStartedAt is strictly smaller than the incoming
@@ -1869,7 +1894,8 @@ func (s *SqlStore) getPeers(ctx context.Context, accountID string) ([]nbpeer.Pee
 	meta_kernel_version, meta_network_addresses, meta_system_serial_number, meta_system_product_name, meta_system_manufacturer,
 	meta_environment, meta_flags, meta_files, meta_capabilities, peer_status_last_seen, peer_status_session_started_at,
 	peer_status_connected, peer_status_login_expired, peer_status_requires_approval, location_connection_ip,
-	location_country_code, location_city_name, location_geo_name_id, proxy_meta_embedded, proxy_meta_cluster, ipv6, meta_sync_message_version
+	location_country_code, location_city_name, location_geo_name_id, proxy_meta_embedded, proxy_meta_cluster, ipv6, meta_sync_message_version,
+	meta_dns_service_port, peer_status_dns_serial, peer_status_dns_applied, peer_status_dns_errors, peer_status_dns_reported_at
 	FROM peers WHERE account_id = $1`
 	rows, err := s.pool.Query(ctx, query, accountID)
 	if err != nil {
@@ -1882,16 +1908,17 @@ func (s *SqlStore) getPeers(ctx context.Context, accountID string) ([]nbpeer.Pee
 		var (
 			lastLogin, createdAt                                                                            sql.NullTime
 			sshEnabled, loginExpirationEnabled, inactivityExpirationEnabled, ephemeral, allowExtraDNSLabels sql.NullBool
-			peerStatusLastSeen                                                                              sql.NullTime
-			peerStatusSessionStartedAt                                                                      sql.NullInt64
+			peerStatusLastSeen, peerStatusDNSReportedAt                                                     sql.NullTime
+			peerStatusSessionStartedAt, peerStatusDNSSerial                                                 sql.NullInt64
 			peerStatusConnected, peerStatusLoginExpired, peerStatusRequiresApproval, proxyEmbedded          sql.NullBool
-			ip, extraDNS, netAddr, env, flags, files, capabilities, connIP, ipv6                            []byte
+			peerStatusDNSApplied                                                                            sql.NullBool
+			ip, extraDNS, netAddr, env, flags, files, capabilities, connIP, ipv6, peerStatusDNSErrors       []byte
 			metaHostname, metaGoOS, metaKernel, metaCore, metaPlatform                                      sql.NullString
 			metaOS, metaOSVersion, metaWtVersion, metaUIVersion, metaKernelVersion                          sql.NullString
 			metaSystemSerialNumber, metaSystemProductName, metaSystemManufacturer                           sql.NullString
 			locationCountryCode, locationCityName, proxyCluster                                             sql.NullString
 			locationGeoNameID                                                                               sql.NullInt64
-			metaSyncMessageVersion                                                                          sql.NullInt32
+			metaSyncMessageVersion, metaDNSServicePort                                                      sql.NullInt32
 		)
 
 		err := row.Scan(&p.ID, &p.AccountID, &p.Key, &ip, &p.Name, &p.DNSLabel, &p.UserID, &p.SSHKey, &sshEnabled,
@@ -1901,7 +1928,8 @@ func (s *SqlStore) getPeers(ctx context.Context, accountID string) ([]nbpeer.Pee
 			&metaSystemSerialNumber, &metaSystemProductName, &metaSystemManufacturer, &env, &flags, &files, &capabilities,
 			&peerStatusLastSeen, &peerStatusSessionStartedAt, &peerStatusConnected, &peerStatusLoginExpired,
 			&peerStatusRequiresApproval, &connIP, &locationCountryCode, &locationCityName, &locationGeoNameID,
-			&proxyEmbedded, &proxyCluster, &ipv6, &metaSyncMessageVersion)
+			&proxyEmbedded, &proxyCluster, &ipv6, &metaSyncMessageVersion, &metaDNSServicePort, &peerStatusDNSSerial,
+			&peerStatusDNSApplied, &peerStatusDNSErrors, &peerStatusDNSReportedAt)
 
 		if err == nil {
 			if lastLogin.Valid {
@@ -1940,6 +1968,15 @@ func (s *SqlStore) getPeers(ctx context.Context, accountID string) ([]nbpeer.Pee
 			if peerStatusRequiresApproval.Valid {
 				p.Status.RequiresApproval = peerStatusRequiresApproval.Bool
 			}
+			if peerStatusDNSSerial.Valid {
+				p.Status.DNSSerial = uint64(peerStatusDNSSerial.Int64)
+			}
+			if peerStatusDNSApplied.Valid {
+				p.Status.DNSApplied = peerStatusDNSApplied.Bool
+			}
+			if peerStatusDNSReportedAt.Valid {
+				p.Status.DNSReportedAt = &peerStatusDNSReportedAt.Time
+			}
 			if metaHostname.Valid {
 				p.Meta.Hostname = metaHostname.String
 			}
@@ -2021,9 +2058,15 @@ func (s *SqlStore) getPeers(ctx context.Context, accountID string) ([]nbpeer.Pee
 			if connIP != nil {
 				_ = json.Unmarshal(connIP, &p.Location.ConnectionIP)
 			}
+			if peerStatusDNSErrors != nil {
+				_ = json.Unmarshal(peerStatusDNSErrors, &p.Status.DNSErrors)
+			}
 			if metaSyncMessageVersion.Valid {
 				p.Meta.SyncMessageVersion = int(metaSyncMessageVersion.Int32)
 			}
+			if metaDNSServicePort.Valid {
+				p.Meta.DNSServicePort = uint16(metaDNSServicePort.Int32)
+			}
 		}
 		return p, err
 	})
@@ -80,6 +80,58 @@ func assertGetAccountLoadsCustomDomains(t *testing.T, store Store) {
 	assert.Equal(t, "us.proxy.netbird.io", byDomain["apps.acme.io"], "custom domain must carry its target cluster")
 }
 
+// TestGetAccount_LoadsPeerDNSServicePort verifies GetAccount loads the port a
+// peer serves DNS on. relayNSGroup skips relays without one, so losing it drops
+// every relayed nameserver group.
+func TestGetAccount_LoadsPeerDNSServicePort(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("The SQLite store is not properly supported by Windows yet")
+	}
+
+	store, cleanup, err := NewTestStoreFromSQL(context.Background(), "", t.TempDir())
+	require.NoError(t, err)
+	defer cleanup()
+
+	assertGetAccountLoadsPeerDNSServicePort(t, store)
+}
+
+func TestPostgresql_GetAccount_LoadsPeerDNSServicePort(t *testing.T) {
+	if (os.Getenv("CI") == "true" && runtime.GOOS == "darwin") || runtime.GOOS == "windows" {
+		t.Skip("skip CI tests on darwin and windows")
+	}
+
+	t.Setenv("NETBIRD_STORE_ENGINE", string(types.PostgresStoreEngine))
+	store, cleanup, err := NewTestStoreFromSQL(context.Background(), "", t.TempDir())
+	require.NoError(t, err)
+	t.Cleanup(cleanup)
+
+	assertGetAccountLoadsPeerDNSServicePort(t, store)
+}
+
+func assertGetAccountLoadsPeerDNSServicePort(t *testing.T, store Store) {
+	t.Helper()
+	ctx := context.Background()
+
+	accountID := "acct-dns-service-port"
+	account := newAccountWithId(ctx, accountID, "user-1", "")
+	account.Peers["relay"] = &nbpeer.Peer{
+		ID:        "relay",
+		AccountID: accountID,
+		Key:       "relay-key",
+		IP:        netip.MustParseAddr("100.64.0.1"),
+		Name:      "relay",
+		DNSLabel:  "relay",
+		Meta:      nbpeer.PeerSystemMeta{Hostname: "relay", DNSServicePort: 5053},
+		Status:    &nbpeer.PeerStatus{},
+	}
+	require.NoError(t, store.SaveAccount(ctx, account))
+
+	account, err := store.GetAccount(ctx, accountID)
+	require.NoError(t, err)
+	require.Contains(t, account.Peers, "relay")
+	assert.Equal(t, uint16(5053), account.Peers["relay"].Meta.DNSServicePort, "GetAccount must load the peer's DNS service port")
+}
+
 // TestGetAccount_ComprehensiveFieldValidation validates that GetAccount properly loads
 // all fields and nested objects from the database, including deeply nested structures.
 func TestGetAccount_ComprehensiveFieldValidation(t *testing.T) {
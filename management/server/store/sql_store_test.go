@@ -675,6 +675,50 @@ func TestSqlStore_SavePeerStatus(t *testing.T) {
 	assert.WithinDurationf(t, newStatus.LastSeen, actual.LastSeen.UTC(), time.Millisecond, "LastSeen should be equal")
 }
 
+func TestSqlStore_SavePeerDNSStatus(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("The SQLite store is not properly supported by Windows yet")
+	}
+
+	runTestForAllEngines(t, "../testdata/store.sql", func(t *testing.T, store Store) {
+		ctx := context.Background()
+		account, err := store.GetAccount(ctx, "bf1c8084-ba50-4ce7-9439-34653001fc3b")
+		require.NoError(t, err)
+
+		reportedAt := time.Now().UTC()
+		dnsStatus := nbpeer.PeerStatus{
+			DNSSerial:     12,
+			DNSErrors:     []string{"configure host dns: permission denied"},
+			DNSReportedAt: &reportedAt,
+		}
+		err = store.SavePeerDNSStatus(ctx, account.Id, "non-existing-peer", dnsStatus)
+		parsedErr, ok := status.FromError(err)
+		require.True(t, ok)
+		require.Equal(t, status.NotFound, parsedErr.Type(), "should return not found error")
+
+		account.Peers["testpeer"] = &nbpeer.Peer{
+			Key:    "peerkey",
+			ID:     "testpeer",
+			IP:     netip.AddrFrom4([4]byte{127, 0, 0, 1}),
+			Name:   "peer name",
+			Status: &nbpeer.PeerStatus{Connected: true, LastSeen: time.Now().UTC()},
+		}
+		require.NoError(t, store.SaveAccount(ctx, account))
+
+		require.NoError(t, store.SavePeerDNSStatus(ctx, account.Id, "testpeer", dnsStatus))
+
+		account, err = store.GetAccount(ctx, account.Id)
+		require.NoError(t, err)
+		actual := account.Peers["testpeer"].Status
+		assert.True(t, actual.Connected, "the rest of the status is kept")
+		assert.Equal(t, uint64(12), actual.DNSSerial)
+		assert.False(t, actual.DNSApplied)
+		assert.Equal(t, dnsStatus.DNSErrors, actual.DNSErrors)
+		require.NotNil(t, actual.DNSReportedAt)
+		assert.WithinDuration(t, reportedAt, actual.DNSReportedAt.UTC(), time.Millisecond)
+	})
+}
+
 func Test_TestGetAccountByPrivateDomain(t *testing.T) {
 	if runtime.GOOS == "windows" {
 		t.Skip("The SQLite store is not properly supported by Windows yet")
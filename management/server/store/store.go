@@ -171,6 +171,8 @@ type Store interface {
 	GetAllEphemeralPeers(ctx context.Context, lockStrength LockingStrength) ([]*nbpeer.Peer, error)
 	SavePeer(ctx context.Context, accountID string, peer *nbpeer.Peer) error
 	SavePeerStatus(ctx context.Context, accountID, peerID string, status nbpeer.PeerStatus) error
+	// SavePeerDNSStatus stores only the DNS apply status fields of status.
+	SavePeerDNSStatus(ctx context.Context, accountID, peerID string, status nbpeer.PeerStatus) error
 	// MarkPeerConnectedIfNewerSession sets the peer to connected with the
 	// given session token, but only when the stored SessionStartedAt is
 	// strictly less than newSessionStartedAt (the sentinel zero counts as
@@ -3483,6 +3483,20 @@ func (mr *MockStoreMockRecorder) SavePeer(ctx, accountID, peer interface{}) *gom
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SavePeer", reflect.TypeOf((*MockStore)(nil).SavePeer), ctx, accountID, peer)
 }
 
+// SavePeerDNSStatus mocks base method.
+func (m *MockStore) SavePeerDNSStatus(ctx context.Context, accountID, peerID string, status peer.PeerStatus) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "SavePeerDNSStatus", ctx, accountID, peerID, status)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// SavePeerDNSStatus indicates an expected call of SavePeerDNSStatus.
+func (mr *MockStoreMockRecorder) SavePeerDNSStatus(ctx, accountID, peerID, status interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SavePeerDNSStatus", reflect.TypeOf((*MockStore)(nil).SavePeerDNSStatus), ctx, accountID, peerID, status)
+}
+
 // SavePeerStatus mocks base method.
 func (m *MockStore) SavePeerStatus(ctx context.Context, accountID, peerID string, status peer.PeerStatus) error {
 	m.ctrl.T.Helper()
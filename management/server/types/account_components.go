@@ -192,6 +192,22 @@ func (a *Account) GetPeerNetworkMapComponents(
 		}
 	}
 
+	// Relay groups select the peers queries are relayed through, so their
+	// members are needed even when the groups aren't otherwise relevant.
+	for _, nsGroup := range components.NameServerGroups {
+		for _, gID := range nsGroup.RelayPeerGroups {
+			if _, ok := components.Groups[gID]; ok {
+				continue
+			}
+			if g, ok := a.Groups[gID]; ok {
+				if components.Groups == nil {
+					components.Groups = make(map[string]*ComponentGroup)
+				}
+				components.Groups[gID] = g.ToComponent()
+			}
+		}
+	}
+
 	for _, resource := range a.NetworkResources {
 		if !resource.Enabled {
 			continue
@@ -366,6 +366,99 @@ func TestNetworkMapComponents_NameServerGroups(t *testing.T) {
 	assert.True(t, hasNSGroup, "peer in NS group should receive nameserver configuration")
 }
 
+func TestNetworkMapComponents_RelayedNameServerGroups(t *testing.T) {
+	internalNS := nbdns.NameServer{IP: netip.MustParseAddr("10.0.0.53"), NSType: nbdns.UDPNameServerType, Port: 53}
+	relayNS := nbdns.NameServer{IP: netip.AddrFrom4([4]byte{100, 64, 0, 3}), NSType: nbdns.UDPNameServerType, Port: 53}
+	customPortRelayNS := relayNS
+	customPortRelayNS.Port = 5053
+
+	findGroup := func(nm *types.NetworkMap) *nbdns.NameServerGroup {
+		for _, ns := range nm.DNSConfig.NameServerGroups {
+			if ns.ID == "ns-relay" {
+				return ns
+			}
+		}
+		return nil
+	}
+
+	tests := []struct {
+		name        string
+		relayPeers  []string
+		relayGroups []string
+		servicePort uint16
+		peerID      string
+		expectNS    []nbdns.NameServer
+	}{
+		{
+			name:        "peer queries the relay peer",
+			relayPeers:  []string{"peer-dst-1"},
+			servicePort: 53,
+			peerID:      "peer-src-1",
+			expectNS:    []nbdns.NameServer{relayNS},
+		},
+		{
+			name:        "relay selected by group",
+			relayGroups: []string{"group-dst"},
+			servicePort: 53,
+			peerID:      "peer-src-1",
+			expectNS:    []nbdns.NameServer{relayNS},
+		},
+		{
+			name:        "relay listening on a custom port",
+			relayPeers:  []string{"peer-dst-1"},
+			servicePort: 5053,
+			peerID:      "peer-src-1",
+			expectNS:    []nbdns.NameServer{customPortRelayNS},
+		},
+		{
+			name:        "relay peer queries the nameservers itself",
+			relayPeers:  []string{"peer-dst-1"},
+			servicePort: 53,
+			peerID:      "peer-dst-1",
+			expectNS:    []nbdns.NameServer{internalNS},
+		},
+		{
+			name:        "unreachable relay drops the group",
+			relayPeers:  []string{"peer-src-2"},
+			servicePort: 53,
+			peerID:      "peer-src-1",
+		},
+		{
+			name:       "relay without a DNS service on its overlay address drops the group",
+			relayPeers: []string{"peer-dst-1"},
+			peerID:     "peer-src-1",
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			account := createComponentTestAccount()
+			account.DNSSettings.DisabledManagementGroups = nil
+			for _, p := range account.Peers {
+				p.Meta.DNSServicePort = tc.servicePort
+			}
+			account.NameServerGroups["ns-relay"] = &nbdns.NameServerGroup{
+				ID: "ns-relay", Name: "Relayed NS", Enabled: true,
+				Groups:          []string{"group-src", "group-dst"},
+				Domains:         []string{"corp.internal"},
+				NameServers:     []nbdns.NameServer{internalNS},
+				RelayPeers:      tc.relayPeers,
+				RelayPeerGroups: tc.relayGroups,
+			}
+
+			nm := networkMapFromComponents(t, account, tc.peerID, allPeersValidated(account))
+			group := findGroup(nm)
+			if tc.expectNS == nil {
+				assert.Nil(t, group, "group without a reachable relay should not be distributed")
+				return
+			}
+			require.NotNil(t, group)
+			assert.Equal(t, tc.expectNS, group.NameServers)
+			assert.Equal(t, []string{"corp.internal"}, group.Domains)
+		})
+	}
+}
+
 func TestNetworkMapComponents_RoutesWithHADeduplication(t *testing.T) {
 	account := createComponentTestAccount()
 	validated := allPeersValidated(account)
@@ -31,6 +31,19 @@ type Client interface {
 	// Used to validate connectivity before committing configuration changes.
 	HealthCheck() error
 	SyncMeta(sysInfo *system.Info) error
+	// ReportDNSApplyStatus reports whether the DNS config received with the
+	// network map of the given serial was applied, and the errors if not.
+	ReportDNSApplyStatus(serial uint64, applied bool, errs []string) error
+	// SyncCheckpoint returns the serial of the last network map handled by Sync.
+	SyncCheckpoint() uint64
+	// SetSyncCheckpoint sets the serial Sync resumes from on the next connect.
+	SetSyncCheckpoint(serial uint64)
+	// InfraConfig returns the signal, relay, STUN/TURN and flow config of the
+	// last successful Login or Register, nil before one.
+	InfraConfig() *proto.NetbirdConfig
+	// ClearServerPublicKey drops the cached server public key, so the next
+	// call fetches it again.
+	ClearServerPublicKey()
 	Logout() error
 	CreateExpose(ctx context.Context, req ExposeRequest) (*ExposeResponse, error)
 	RenewExpose(ctx context.Context, domain string) error
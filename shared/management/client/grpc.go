@@ -6,6 +6,7 @@ import (
 	"fmt"
 	"io"
 	"os"
+	"slices"
 	"strconv"
 	"sync"
 	"time"
@@ -47,6 +48,10 @@ const (
 	errMsgNoMgmtConnection = "no connection to management"
 )
 
+// errResponseDecryption is returned when a response can't be decrypted with
+// the server key, e.g. because the server rotated it.
+var errResponseDecryption = errors.New("decrypt response")
+
 // ConnStateNotifier is a wrapper interface of the status recorders
 type ConnStateNotifier interface {
 	MarkManagementDisconnected(error)
@@ -69,6 +74,26 @@ type GrpcClient struct {
 	// connection while the Sync stream keeps failing.
 	syncStreamMu  sync.RWMutex
 	syncStreamErr error
+
+	// syncCheckpoint is the serial of the last network map handled without
+	// error. It is sent on reconnect so the server can resume the stream.
+	syncCheckpointMu sync.RWMutex
+	syncCheckpoint   uint64
+
+	// infraConfig is the NetbirdConfig of the last successful login, kept so
+	// the infrastructure endpoints can be looked up after the fact.
+	infraConfigMu sync.RWMutex
+	infraConfig   *proto.NetbirdConfig
+
+	// syncBackoff paces the Sync reconnection attempts, DefaultSyncBackoff
+	// unless replaced with SetSyncBackoff.
+	syncBackoffMu sync.RWMutex
+	syncBackoff   SyncBackoff
+
+	// serverKey caches the server's WireGuard public key after the first
+	// successful fetch, nil until then or once invalidated.
+	serverKeyMu sync.Mutex
+	serverKey   *wgtypes.Key
 }
 
 type ExposeRequest struct {
@@ -111,11 +136,13 @@ func MaxRecvMsgSize() int {
 	return size
 }
 
-// NewClient creates a new client to Management service
-func NewClient(ctx context.Context, addr string, ourPrivateKey wgtypes.Key, tlsEnabled bool) (*GrpcClient, error) {
+// NewClient creates a new client to Management service. opts are appended to
+// the default gRPC dial options, e.g. nbgrpc.WithDialer to connect through a
+// proxy. Sync, Register, Login and the other calls share the connection.
+func NewClient(ctx context.Context, addr string, ourPrivateKey wgtypes.Key, tlsEnabled bool, opts ...grpc.DialOption) (*GrpcClient, error) {
 	var conn *grpc.ClientConn
 
-	var extraOpts []grpc.DialOption
+	extraOpts := slices.Clone(opts)
 	if maxSize := MaxRecvMsgSize(); maxSize > 0 {
 		extraOpts = append(extraOpts, grpc.WithDefaultCallOptions(grpc.MaxCallRecvMsgSize(maxSize)))
 		log.Infof("management gRPC max receive message size set to %d bytes", maxSize)
@@ -145,6 +172,7 @@ func NewClient(ctx context.Context, addr string, ourPrivateKey wgtypes.Key, tlsE
 		conn:                  conn,
 		connStateCallbackLock: sync.RWMutex{},
 		serverURL:             addr,
+		syncBackoff:           DefaultSyncBackoff,
 	}, nil
 }
 
@@ -186,27 +214,30 @@ func (c *GrpcClient) ready() bool {
 
 // Sync wraps the real client's Sync endpoint call and takes care of retries and encryption/decryption of messages
 // Blocking request. The result will be sent via msgHandler callback function
+// Reconnection attempts are paced by the SyncBackoff set with SetSyncBackoff.
 func (c *GrpcClient) Sync(ctx context.Context, sysInfo *system.Info, msgHandler func(msg *proto.SyncResponse) error) error {
-	return c.withMgmtStream(ctx, func(ctx context.Context, serverPubKey wgtypes.Key, backOff backoff.BackOff) error {
-		return c.handleSyncStream(ctx, serverPubKey, sysInfo, msgHandler, backOff)
+	syncBackoff := c.getSyncBackoff()
+	return c.withMgmtStream(ctx, syncBackoff.newBackOff(ctx), func(ctx context.Context, serverPubKey wgtypes.Key, backOff backoff.BackOff) error {
+		return c.handleSyncStream(ctx, serverPubKey, sysInfo, msgHandler, backOff, syncBackoff.StableAfter)
 	})
 }
 
 // Job wraps the real client's Job endpoint call and takes care of retries and encryption/decryption of messages
 // Blocking request. The result will be sent via msgHandler callback function
 func (c *GrpcClient) Job(ctx context.Context, msgHandler func(msg *proto.JobRequest) *proto.JobResponse) error {
-	return c.withMgmtStream(ctx, func(ctx context.Context, serverPubKey wgtypes.Key, backOff backoff.BackOff) error {
+	return c.withMgmtStream(ctx, defaultBackoff(ctx), func(ctx context.Context, serverPubKey wgtypes.Key, backOff backoff.BackOff) error {
 		return c.handleJobStream(ctx, serverPubKey, msgHandler, backOff)
 	})
 }
 
 // withMgmtStream runs a streaming operation against the ManagementService
-// It takes care of retries, connection readiness, and fetching server public key.
+// It takes care of retries, paced by backOff, connection readiness, and fetching server public key.
 func (c *GrpcClient) withMgmtStream(
 	ctx context.Context,
+	backOff backoff.BackOff,
 	handler func(ctx context.Context, serverPubKey wgtypes.Key, backOff backoff.BackOff) error,
 ) error {
-	backOff := defaultBackoff(ctx)
+	reconnect := false
 	operation := func() error {
 		log.Debugf("management connection state %v", c.conn.GetState())
 		connState := c.conn.GetState()
@@ -218,6 +249,12 @@ func (c *GrpcClient) withMgmtStream(
 			return fmt.Errorf("connection to management is not ready and in %s state", connState)
 		}
 
+		// The server may have rotated its key while the stream was down.
+		if reconnect {
+			c.ClearServerPublicKey()
+		}
+		reconnect = true
+
 		serverPubKey, err := c.getServerPublicKey()
 		if err != nil {
 			log.Debugf(errMsgMgmtPublicKey, err)
@@ -385,11 +422,11 @@ func (c *GrpcClient) sendJobResponse(
 	return nil
 }
 
-func (c *GrpcClient) handleSyncStream(ctx context.Context, serverPubKey wgtypes.Key, sysInfo *system.Info, msgHandler func(msg *proto.SyncResponse) error, backOff backoff.BackOff) error {
+func (c *GrpcClient) handleSyncStream(ctx context.Context, serverPubKey wgtypes.Key, sysInfo *system.Info, msgHandler func(msg *proto.SyncResponse) error, backOff backoff.BackOff, stableAfter time.Duration) error {
 	ctx, cancelStream := context.WithCancel(ctx)
 	defer cancelStream()
 
-	stream, err := c.connectToSyncStream(ctx, serverPubKey, sysInfo)
+	stream, err := c.connectToSyncStream(ctx, serverPubKey, sysInfo, c.SyncCheckpoint())
 	if err != nil {
 		log.Debugf("failed to open Management Service stream: %s", err)
 		c.notifyDisconnected(err)
@@ -403,22 +440,20 @@ func (c *GrpcClient) handleSyncStream(ctx context.Context, serverPubKey wgtypes.
 	log.Infof("connected to the Management Service stream")
 	c.notifyConnected()
 	c.setSyncStreamConnected()
-
-	// The stream is up, so reset the backoff. This matters for two reasons,
-	// both caused by the backoff lib not resetting its state on a successful
-	// connection:
-	//  1. Without a reset, after a connect followed by an error the next retry
-	//     starts from the accumulated (large) interval instead of retrying
-	//     promptly, delaying reconnection.
-	//  2. Worse, once the accumulated elapsed time exceeds MaxElapsedTime, the
-	//     next stream error makes NextBackOff() return Stop, so the retry loop
-	//     exits immediately. That error is then mislabeled unrecoverable and
-	//     bubbles up to trigger a full engine restart / data-plane teardown
-	//     instead of a silent reconnection.
-	backOff.Reset()
+	connected := time.Now()
 
 	// blocking until error
 	err = c.receiveUpdatesEvents(stream, serverPubKey, msgHandler)
+
+	// The backoff lib doesn't reset its state on a successful connection, so
+	// reset it once the stream proved stable: the next retry then starts
+	// promptly instead of from the accumulated interval. A stream dropped
+	// right after connecting keeps backing off, so a server rejecting
+	// streams isn't hammered.
+	if time.Since(connected) >= stableAfter {
+		backOff.Reset()
+	}
+
 	if err != nil {
 		c.notifyDisconnected(err)
 		c.setSyncStreamDisconnected(err)
@@ -446,7 +481,7 @@ func (c *GrpcClient) GetNetworkMap(sysInfo *system.Info) (*proto.NetworkMap, err
 
 	ctx, cancelStream := context.WithCancel(c.ctx)
 	defer cancelStream()
-	stream, err := c.connectToSyncStream(ctx, *serverPubKey, sysInfo)
+	stream, err := c.connectToSyncStream(ctx, *serverPubKey, sysInfo, 0)
 	if err != nil {
 		log.Debugf("failed to open Management Service stream: %s", err)
 		return nil, err
@@ -479,8 +514,8 @@ func (c *GrpcClient) GetNetworkMap(sysInfo *system.Info) (*proto.NetworkMap, err
 	return decryptedResp.GetNetworkMap(), nil
 }
 
-func (c *GrpcClient) connectToSyncStream(ctx context.Context, serverPubKey wgtypes.Key, sysInfo *system.Info) (proto.ManagementService_SyncClient, error) {
-	req := &proto.SyncRequest{Meta: infoToMetaData(sysInfo)}
+func (c *GrpcClient) connectToSyncStream(ctx context.Context, serverPubKey wgtypes.Key, sysInfo *system.Info, resumeSerial uint64) (proto.ManagementService_SyncClient, error) {
+	req := &proto.SyncRequest{Meta: infoToMetaData(sysInfo), ResumeSerial: resumeSerial}
 
 	myPrivateKey := c.key
 	myPublicKey := myPrivateKey.PublicKey()
@@ -520,10 +555,49 @@ func (c *GrpcClient) receiveUpdatesEvents(stream proto.ManagementService_SyncCli
 
 		if err := msgHandler(decryptedResp); err != nil {
 			log.Errorf("failed handling an update message received from Management Service: %v", err.Error())
+			continue
+		}
+
+		if serial := syncResponseSerial(decryptedResp); serial > 0 {
+			c.SetSyncCheckpoint(serial)
 		}
 	}
 }
 
+// SyncCheckpoint returns the serial of the last network map handled without
+// error, or zero if none was. Callers may persist it and restore it with
+// SetSyncCheckpoint, provided they persist the applied state along with it.
+func (c *GrpcClient) SyncCheckpoint() uint64 {
+	c.syncCheckpointMu.RLock()
+	defer c.syncCheckpointMu.RUnlock()
+	return c.syncCheckpoint
+}
+
+// SetSyncCheckpoint sets the serial sent as resume point on the next Sync
+// stream. Zero requests a full sync.
+func (c *GrpcClient) SetSyncCheckpoint(serial uint64) {
+	c.syncCheckpointMu.Lock()
+	defer c.syncCheckpointMu.Unlock()
+	c.syncCheckpoint = serial
+}
+
+// InfraConfig returns the NetbirdConfig of the last successful Login or
+// Register, nil before one. Logins without one keep the previous config.
+func (c *GrpcClient) InfraConfig() *proto.NetbirdConfig {
+	c.infraConfigMu.RLock()
+	defer c.infraConfigMu.RUnlock()
+	return c.infraConfig
+}
+
+// syncResponseSerial returns the network map serial carried by resp in either
+// the legacy or the component format, or zero if it carries none.
+func syncResponseSerial(resp *proto.SyncResponse) uint64 {
+	if full := resp.GetNetworkMapEnvelope().GetFull(); full != nil {
+		return full.GetSerial()
+	}
+	return resp.GetNetworkMap().GetSerial()
+}
+
 // HealthCheck actively probes the management server and returns an error if unreachable.
 // Used to validate connectivity before committing configuration changes.
 func (c *GrpcClient) HealthCheck() error {
@@ -531,12 +605,46 @@ func (c *GrpcClient) HealthCheck() error {
 		return errors.New(errMsgNoMgmtConnection)
 	}
 
-	_, err := c.getServerPublicKey()
+	_, err := c.refreshServerPublicKey()
 	return err
 }
 
-// getServerPublicKey fetches the server's WireGuard public key.
+// getServerPublicKey returns the server's WireGuard public key, fetching it
+// unless it is cached.
 func (c *GrpcClient) getServerPublicKey() (*wgtypes.Key, error) {
+	c.serverKeyMu.Lock()
+	key := c.serverKey
+	c.serverKeyMu.Unlock()
+	if key != nil {
+		return key, nil
+	}
+	return c.refreshServerPublicKey()
+}
+
+// refreshServerPublicKey fetches the server's WireGuard public key and
+// caches it.
+func (c *GrpcClient) refreshServerPublicKey() (*wgtypes.Key, error) {
+	key, err := c.fetchServerPublicKey()
+	if err != nil {
+		return nil, err
+	}
+
+	c.serverKeyMu.Lock()
+	c.serverKey = key
+	c.serverKeyMu.Unlock()
+	return key, nil
+}
+
+// ClearServerPublicKey drops the cached server public key, so the next call
+// fetches it again, e.g. after the server rotated it.
+func (c *GrpcClient) ClearServerPublicKey() {
+	c.serverKeyMu.Lock()
+	defer c.serverKeyMu.Unlock()
+	c.serverKey = nil
+}
+
+// fetchServerPublicKey fetches the server's WireGuard public key.
+func (c *GrpcClient) fetchServerPublicKey() (*wgtypes.Key, error) {
 	mgmCtx, cancel := context.WithTimeout(c.ctx, 5*time.Second)
 	defer cancel()
 	resp, err := c.realClient.GetServerKey(mgmCtx, &proto.Empty{})
@@ -596,7 +704,31 @@ func (c *GrpcClient) login(req *proto.LoginRequest) (*proto.LoginResponse, error
 		return nil, err
 	}
 
-	loginReq, err := encryption.EncryptMessage(*serverKey, c.key, req)
+	loginResp, err := c.loginWithKey(*serverKey, req)
+	if isHandshakeFailure(err) {
+		// The cached key may predate a key rotation of the server.
+		log.Infof("login failed with the cached Management Service key, refreshing it: %v", err)
+		if serverKey, err = c.refreshServerPublicKey(); err != nil {
+			return nil, err
+		}
+		loginResp, err = c.loginWithKey(*serverKey, req)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if cfg := loginResp.GetNetbirdConfig(); cfg != nil {
+		c.infraConfigMu.Lock()
+		c.infraConfig = cfg
+		c.infraConfigMu.Unlock()
+	}
+
+	return loginResp, nil
+}
+
+// loginWithKey sends req to the Login endpoint, encrypted for serverKey.
+func (c *GrpcClient) loginWithKey(serverKey wgtypes.Key, req *proto.LoginRequest) (*proto.LoginResponse, error) {
+	loginReq, err := encryption.EncryptMessage(serverKey, c.key, req)
 	if err != nil {
 		log.Errorf("failed to encrypt message: %s", err)
 		return nil, err
@@ -630,15 +762,25 @@ func (c *GrpcClient) login(req *proto.LoginRequest) (*proto.LoginResponse, error
 	}
 
 	loginResp := &proto.LoginResponse{}
-	err = encryption.DecryptMessage(*serverKey, c.key, resp.Body, loginResp)
+	err = encryption.DecryptMessage(serverKey, c.key, resp.Body, loginResp)
 	if err != nil {
 		log.Errorf("failed to decrypt login response: %s", err)
-		return nil, err
+		return nil, fmt.Errorf("%w: %w", errResponseDecryption, err)
 	}
 
 	return loginResp, nil
 }
 
+// isHandshakeFailure reports whether err of a login means the server key
+// used doesn't match the server's: the server can't decrypt the request or
+// the client the response.
+func isHandshakeFailure(err error) bool {
+	if err == nil {
+		return false
+	}
+	return errors.Is(err, errResponseDecryption) || gstatus.Code(err) == codes.InvalidArgument
+}
+
 // Register registers peer on Management Server. It actually calls a Login endpoint with a provided setup key
 // Takes care of encrypting and decrypting messages.
 // This method will also collect system info and send it with the request (e.g. hostname, os, etc)
@@ -811,6 +953,35 @@ func (c *GrpcClient) SyncMeta(sysInfo *system.Info) error {
 	return err
 }
 
+// ReportDNSApplyStatus reports to the Management Service whether the DNS
+// config of the network map with the given serial took effect on the peer.
+func (c *GrpcClient) ReportDNSApplyStatus(serial uint64, applied bool, errs []string) error {
+	if !c.ready() {
+		return errors.New(errMsgNoMgmtConnection)
+	}
+
+	serverPubKey, err := c.getServerPublicKey()
+	if err != nil {
+		log.Debugf(errMsgMgmtPublicKey, err)
+		return err
+	}
+
+	req := &proto.DNSApplyStatusRequest{Serial: serial, Applied: applied, Errors: errs}
+	encReq, err := encryption.EncryptMessage(*serverPubKey, c.key, req)
+	if err != nil {
+		return fmt.Errorf("encrypt dns apply status request: %w", err)
+	}
+
+	mgmCtx, cancel := context.WithTimeout(c.ctx, ConnectTimeout)
+	defer cancel()
+
+	_, err = c.realClient.ReportDNSApplyStatus(mgmCtx, &proto.EncryptedMessage{
+		WgPubKey: c.key.PublicKey().String(),
+		Body:     encReq,
+	})
+	return err
+}
+
 func (c *GrpcClient) setSyncStreamConnected() {
 	c.syncStreamMu.Lock()
 	defer c.syncStreamMu.Unlock()
@@ -1056,6 +1227,8 @@ func infoToMetaData(info *system.Info) *proto.PeerSystemMeta {
 		Capabilities: peerCapabilities(*info),
 
 		SyncMessageVersion: syncMessageVersion(*info),
+
+		DnsServicePort: uint32(info.DNSServicePort),
 	}
 }
 
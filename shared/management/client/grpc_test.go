@@ -5,13 +5,20 @@ import (
 	"net"
 	"os"
 	"strings"
+	"sync"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+	"golang.zx2c4.com/wireguard/wgctrl/wgtypes"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/credentials/insecure"
+	gstatus "google.golang.org/grpc/status"
 
+	nbgrpc "github.com/netbirdio/netbird/client/grpc"
+	"github.com/netbirdio/netbird/client/system"
+	"github.com/netbirdio/netbird/encryption"
 	mgmtProto "github.com/netbirdio/netbird/shared/management/proto"
 )
 
@@ -93,3 +100,275 @@ func TestMaxRecvMsgSizeIntegration(t *testing.T) {
 		assert.Len(t, resp.Key, payloadSize)
 	})
 }
+
+// resumeSyncServer records the resume serial of every Sync request and
+// answers each with a single network map of the next serial.
+type resumeSyncServer struct {
+	mgmtProto.UnimplementedManagementServiceServer
+	key wgtypes.Key
+
+	mu      sync.Mutex
+	resumes []uint64
+	serial  uint64
+}
+
+func (s *resumeSyncServer) GetServerKey(_ context.Context, _ *mgmtProto.Empty) (*mgmtProto.ServerKeyResponse, error) {
+	return &mgmtProto.ServerKeyResponse{Key: s.key.PublicKey().String()}, nil
+}
+
+func (s *resumeSyncServer) Sync(msg *mgmtProto.EncryptedMessage, stream mgmtProto.ManagementService_SyncServer) error {
+	peerKey, err := wgtypes.ParseKey(msg.GetWgPubKey())
+	if err != nil {
+		return err
+	}
+	req := &mgmtProto.SyncRequest{}
+	if err := encryption.DecryptMessage(peerKey, s.key, msg.Body, req); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	s.resumes = append(s.resumes, req.GetResumeSerial())
+	s.serial++
+	resp := &mgmtProto.SyncResponse{NetworkMap: &mgmtProto.NetworkMap{Serial: s.serial}}
+	s.mu.Unlock()
+
+	body, err := encryption.EncryptMessage(peerKey, s.key, resp)
+	if err != nil {
+		return err
+	}
+	return stream.Send(&mgmtProto.EncryptedMessage{WgPubKey: s.key.PublicKey().String(), Body: body})
+}
+
+func TestClient_SyncResumesFromCheckpoint(t *testing.T) {
+	serverKey, err := wgtypes.GenerateKey()
+	require.NoError(t, err)
+	srv := &resumeSyncServer{key: serverKey}
+
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	s := grpc.NewServer()
+	mgmtProto.RegisterManagementServiceServer(s, srv)
+	go func() { _ = s.Serve(lis) }()
+	t.Cleanup(s.Stop)
+
+	clientKey, err := wgtypes.GenerateKey()
+	require.NoError(t, err)
+	client, err := NewClient(context.Background(), lis.Addr().String(), clientKey, false)
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = client.Close() })
+
+	runSync := func(handlerErr error) {
+		t.Helper()
+		stream, err := client.connectToSyncStream(context.Background(), serverKey.PublicKey(), nil, client.SyncCheckpoint())
+		require.NoError(t, err)
+		// The server closes the stream after one message, so this returns io.EOF.
+		_ = client.receiveUpdatesEvents(stream, serverKey.PublicKey(), func(*mgmtProto.SyncResponse) error {
+			return handlerErr
+		})
+	}
+
+	runSync(nil)
+	assert.Equal(t, uint64(1), client.SyncCheckpoint())
+
+	runSync(assert.AnError)
+	assert.Equal(t, uint64(1), client.SyncCheckpoint(), "a failed update must not advance the checkpoint")
+
+	runSync(nil)
+	assert.Equal(t, uint64(3), client.SyncCheckpoint())
+
+	client.SetSyncCheckpoint(0)
+	runSync(nil)
+
+	srv.mu.Lock()
+	defer srv.mu.Unlock()
+	assert.Equal(t, []uint64{0, 1, 1, 0}, srv.resumes)
+}
+
+// loginServer answers every Login with the same infrastructure config.
+type loginServer struct {
+	mgmtProto.UnimplementedManagementServiceServer
+	key    wgtypes.Key
+	config *mgmtProto.NetbirdConfig
+}
+
+func (s *loginServer) GetServerKey(_ context.Context, _ *mgmtProto.Empty) (*mgmtProto.ServerKeyResponse, error) {
+	return &mgmtProto.ServerKeyResponse{Key: s.key.PublicKey().String()}, nil
+}
+
+func (s *loginServer) Login(_ context.Context, msg *mgmtProto.EncryptedMessage) (*mgmtProto.EncryptedMessage, error) {
+	peerKey, err := wgtypes.ParseKey(msg.GetWgPubKey())
+	if err != nil {
+		return nil, err
+	}
+	body, err := encryption.EncryptMessage(peerKey, s.key, &mgmtProto.LoginResponse{NetbirdConfig: s.config})
+	if err != nil {
+		return nil, err
+	}
+	return &mgmtProto.EncryptedMessage{WgPubKey: s.key.PublicKey().String(), Body: body}, nil
+}
+
+func TestClient_InfraConfigAfterLogin(t *testing.T) {
+	serverKey, err := wgtypes.GenerateKey()
+	require.NoError(t, err)
+	srv := &loginServer{
+		key: serverKey,
+		config: &mgmtProto.NetbirdConfig{
+			Signal: &mgmtProto.HostConfig{Uri: "signal.example.com:443", Protocol: mgmtProto.HostConfig_HTTPS},
+			Relay:  &mgmtProto.RelayConfig{Urls: []string{"rels://relay.example.com:443"}},
+			Stuns:  []*mgmtProto.HostConfig{{Uri: "stun:stun.example.com:3478", Protocol: mgmtProto.HostConfig_UDP}},
+		},
+	}
+
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	s := grpc.NewServer()
+	mgmtProto.RegisterManagementServiceServer(s, srv)
+	go func() { _ = s.Serve(lis) }()
+	t.Cleanup(s.Stop)
+
+	clientKey, err := wgtypes.GenerateKey()
+	require.NoError(t, err)
+	client, err := NewClient(context.Background(), lis.Addr().String(), clientKey, false)
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = client.Close() })
+
+	assert.Nil(t, client.InfraConfig(), "no config before login")
+
+	_, err = client.Login(system.GetInfo(context.Background()), nil, nil)
+	require.NoError(t, err)
+	infra := client.InfraConfig()
+	require.NotNil(t, infra)
+	assert.Equal(t, "signal.example.com:443", infra.GetSignal().GetUri())
+	assert.Equal(t, []string{"rels://relay.example.com:443"}, infra.GetRelay().GetUrls())
+	assert.Equal(t, "stun:stun.example.com:3478", infra.GetStuns()[0].GetUri())
+
+	srv.config = nil
+	_, err = client.Register("setup-key", "", system.GetInfo(context.Background()), nil, nil)
+	require.NoError(t, err)
+	assert.Equal(t, infra, client.InfraConfig(), "a login without config keeps the previous one")
+}
+
+func TestClient_CustomDialer(t *testing.T) {
+	serverKey, err := wgtypes.GenerateKey()
+	require.NoError(t, err)
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	s := grpc.NewServer()
+	mgmtProto.RegisterManagementServiceServer(s, &loginServer{key: serverKey})
+	go func() { _ = s.Serve(lis) }()
+	t.Cleanup(s.Stop)
+
+	var mu sync.Mutex
+	var dialed []string
+	dialer := func(ctx context.Context, addr string) (net.Conn, error) {
+		mu.Lock()
+		dialed = append(dialed, addr)
+		mu.Unlock()
+		// stands in for a proxy: the target is reachable under another name
+		var d net.Dialer
+		return d.DialContext(ctx, "tcp", lis.Addr().String())
+	}
+
+	clientKey, err := wgtypes.GenerateKey()
+	require.NoError(t, err)
+	client, err := NewClient(context.Background(), "management.invalid:443", clientKey, false, nbgrpc.WithDialer(dialer))
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = client.Close() })
+
+	_, err = client.Login(system.GetInfo(context.Background()), nil, nil)
+	require.NoError(t, err)
+
+	mu.Lock()
+	defer mu.Unlock()
+	require.NotEmpty(t, dialed)
+	assert.Equal(t, "management.invalid:443", dialed[0], "the dialer gets the unresolved target")
+}
+
+// rotatingKeyServer counts key fetches and rejects Logins it can't decrypt,
+// like the management server does after a key rotation.
+type rotatingKeyServer struct {
+	mgmtProto.UnimplementedManagementServiceServer
+	mu      sync.Mutex
+	key     wgtypes.Key
+	fetches int
+}
+
+func (s *rotatingKeyServer) GetServerKey(_ context.Context, _ *mgmtProto.Empty) (*mgmtProto.ServerKeyResponse, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.fetches++
+	return &mgmtProto.ServerKeyResponse{Key: s.key.PublicKey().String()}, nil
+}
+
+func (s *rotatingKeyServer) Login(_ context.Context, msg *mgmtProto.EncryptedMessage) (*mgmtProto.EncryptedMessage, error) {
+	s.mu.Lock()
+	key := s.key
+	s.mu.Unlock()
+
+	peerKey, err := wgtypes.ParseKey(msg.GetWgPubKey())
+	if err != nil {
+		return nil, err
+	}
+	if err := encryption.DecryptMessage(peerKey, key, msg.GetBody(), &mgmtProto.LoginRequest{}); err != nil {
+		return nil, gstatus.Errorf(codes.InvalidArgument, "invalid request message")
+	}
+	body, err := encryption.EncryptMessage(peerKey, key, &mgmtProto.LoginResponse{})
+	if err != nil {
+		return nil, err
+	}
+	return &mgmtProto.EncryptedMessage{WgPubKey: key.PublicKey().String(), Body: body}, nil
+}
+
+func (s *rotatingKeyServer) rotate(t *testing.T) {
+	t.Helper()
+	key, err := wgtypes.GenerateKey()
+	require.NoError(t, err)
+	s.mu.Lock()
+	s.key = key
+	s.mu.Unlock()
+}
+
+func (s *rotatingKeyServer) getFetches() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.fetches
+}
+
+func TestClient_ServerPublicKeyCache(t *testing.T) {
+	srv := &rotatingKeyServer{}
+	srv.rotate(t)
+
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	s := grpc.NewServer()
+	mgmtProto.RegisterManagementServiceServer(s, srv)
+	go func() { _ = s.Serve(lis) }()
+	t.Cleanup(s.Stop)
+
+	clientKey, err := wgtypes.GenerateKey()
+	require.NoError(t, err)
+	client, err := NewClient(context.Background(), lis.Addr().String(), clientKey, false)
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = client.Close() })
+
+	info := system.GetInfo(context.Background())
+	for range 2 {
+		_, err = client.Login(info, nil, nil)
+		require.NoError(t, err)
+	}
+	assert.Equal(t, 1, srv.getFetches(), "the key is fetched once")
+
+	client.ClearServerPublicKey()
+	_, err = client.Login(info, nil, nil)
+	require.NoError(t, err)
+	assert.Equal(t, 2, srv.getFetches(), "a cleared key is fetched again")
+
+	srv.rotate(t)
+	_, err = client.Login(info, nil, nil)
+	require.NoError(t, err, "a rejected login refreshes the rotated key")
+	assert.Equal(t, 3, srv.getFetches())
+
+	_, err = client.Login(info, nil, nil)
+	require.NoError(t, err)
+	assert.Equal(t, 3, srv.getFetches(), "the refreshed key is cached")
+}
@@ -20,11 +20,16 @@ type MockClient struct {
 	GetServerURLFunc               func() string
 	HealthCheckFunc                func() error
 	SyncMetaFunc                   func(sysInfo *system.Info) error
+	ReportDNSApplyStatusFunc       func(serial uint64, applied bool, errs []string) error
 	LogoutFunc                     func() error
 	JobFunc                        func(ctx context.Context, msgHandler func(msg *proto.JobRequest) *proto.JobResponse) error
 	CreateExposeFunc               func(ctx context.Context, req ExposeRequest) (*ExposeResponse, error)
 	RenewExposeFunc                func(ctx context.Context, domain string) error
 	StopExposeFunc                 func(ctx context.Context, domain string) error
+	SyncCheckpointFunc             func() uint64
+	SetSyncCheckpointFunc          func(serial uint64)
+	InfraConfigFunc                func() *proto.NetbirdConfig
+	ClearServerPublicKeyFunc       func()
 }
 
 func (m *MockClient) IsHealthy() bool {
@@ -114,6 +119,13 @@ func (m *MockClient) SyncMeta(sysInfo *system.Info) error {
 	return m.SyncMetaFunc(sysInfo)
 }
 
+func (m *MockClient) ReportDNSApplyStatus(serial uint64, applied bool, errs []string) error {
+	if m.ReportDNSApplyStatusFunc == nil {
+		return nil
+	}
+	return m.ReportDNSApplyStatusFunc(serial, applied, errs)
+}
+
 func (m *MockClient) Logout() error {
 	if m.LogoutFunc == nil {
 		return nil
@@ -141,3 +153,29 @@ func (m *MockClient) StopExpose(ctx context.Context, domain string) error {
 	}
 	return m.StopExposeFunc(ctx, domain)
 }
+
+func (m *MockClient) SyncCheckpoint() uint64 {
+	if m.SyncCheckpointFunc == nil {
+		return 0
+	}
+	return m.SyncCheckpointFunc()
+}
+
+func (m *MockClient) SetSyncCheckpoint(serial uint64) {
+	if m.SetSyncCheckpointFunc != nil {
+		m.SetSyncCheckpointFunc(serial)
+	}
+}
+
+func (m *MockClient) InfraConfig() *proto.NetbirdConfig {
+	if m.InfraConfigFunc == nil {
+		return nil
+	}
+	return m.InfraConfigFunc()
+}
+
+func (m *MockClient) ClearServerPublicKey() {
+	if m.ClearServerPublicKeyFunc != nil {
+		m.ClearServerPublicKeyFunc()
+	}
+}
@@ -0,0 +1,83 @@
+package client
+
+import (
+	"context"
+	"time"
+
+	"github.com/cenkalti/backoff/v4"
+)
+
+// SyncBackoff configures how Sync reconnects to the management server. The
+// delay between attempts grows exponentially up to MaxInterval, each delay
+// randomized by Jitter so peers don't reconnect in lockstep.
+type SyncBackoff struct {
+	// InitialInterval is the delay before the first reconnection attempt.
+	InitialInterval time.Duration
+	// MaxInterval caps the delay between attempts.
+	MaxInterval time.Duration
+	// Multiplier grows the delay after every failed attempt.
+	Multiplier float64
+	// Jitter randomizes every delay by up to this fraction of it, between
+	// 0 and 1.
+	Jitter float64
+	// StableAfter is how long a stream must stay up to reset the delay, so
+	// a server dropping streams right after accepting them isn't hammered.
+	StableAfter time.Duration
+}
+
+// DefaultSyncBackoff is the SyncBackoff of new clients.
+var DefaultSyncBackoff = SyncBackoff{
+	InitialInterval: 800 * time.Millisecond,
+	MaxInterval:     10 * time.Second,
+	Multiplier:      1.7,
+	Jitter:          1,
+	StableAfter:     30 * time.Second,
+}
+
+// withDefaults returns b with the unset durations and multiplier taken from
+// DefaultSyncBackoff and Jitter clamped to [0, 1].
+func (b SyncBackoff) withDefaults() SyncBackoff {
+	if b.InitialInterval <= 0 {
+		b.InitialInterval = DefaultSyncBackoff.InitialInterval
+	}
+	if b.MaxInterval <= 0 {
+		b.MaxInterval = DefaultSyncBackoff.MaxInterval
+	}
+	if b.Multiplier < 1 {
+		b.Multiplier = DefaultSyncBackoff.Multiplier
+	}
+	b.Jitter = min(max(b.Jitter, 0), 1)
+	if b.StableAfter <= 0 {
+		b.StableAfter = DefaultSyncBackoff.StableAfter
+	}
+	return b
+}
+
+// newBackOff returns the backoff for the Sync retry loop. It never gives up,
+// the loop only ends with ctx or an unrecoverable error.
+func (b SyncBackoff) newBackOff(ctx context.Context) backoff.BackOff {
+	return backoff.WithContext(&backoff.ExponentialBackOff{
+		InitialInterval:     b.InitialInterval,
+		RandomizationFactor: b.Jitter,
+		Multiplier:          b.Multiplier,
+		MaxInterval:         b.MaxInterval,
+		MaxElapsedTime:      0,
+		Stop:                backoff.Stop,
+		Clock:               backoff.SystemClock,
+	}, ctx)
+}
+
+// SetSyncBackoff replaces the reconnection backoff of Sync. Unset durations
+// and multiplier keep the values of DefaultSyncBackoff, a zero Jitter
+// disables it. It applies to the next Sync call.
+func (c *GrpcClient) SetSyncBackoff(b SyncBackoff) {
+	c.syncBackoffMu.Lock()
+	defer c.syncBackoffMu.Unlock()
+	c.syncBackoff = b.withDefaults()
+}
+
+func (c *GrpcClient) getSyncBackoff() SyncBackoff {
+	c.syncBackoffMu.RLock()
+	defer c.syncBackoffMu.RUnlock()
+	return c.syncBackoff.withDefaults()
+}
@@ -0,0 +1,139 @@
+package client
+
+import (
+	"context"
+	"net"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.zx2c4.com/wireguard/wgctrl/wgtypes"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	gstatus "google.golang.org/grpc/status"
+
+	mgmtProto "github.com/netbirdio/netbird/shared/management/proto"
+)
+
+func TestSyncBackoff_Intervals(t *testing.T) {
+	b := SyncBackoff{
+		InitialInterval: 100 * time.Millisecond,
+		MaxInterval:     300 * time.Millisecond,
+		Multiplier:      2,
+	}.withDefaults().newBackOff(context.Background())
+	b.Reset()
+
+	var got []time.Duration
+	for range 4 {
+		got = append(got, b.NextBackOff())
+	}
+	assert.Equal(t, []time.Duration{100 * time.Millisecond, 200 * time.Millisecond, 300 * time.Millisecond, 300 * time.Millisecond}, got)
+
+	jittered := SyncBackoff{InitialInterval: 100 * time.Millisecond, Jitter: 0.5}.withDefaults().newBackOff(context.Background())
+	jittered.Reset()
+	next := jittered.NextBackOff()
+	assert.GreaterOrEqual(t, next, 50*time.Millisecond)
+	assert.LessOrEqual(t, next, 150*time.Millisecond)
+}
+
+func TestSyncBackoff_WithDefaults(t *testing.T) {
+	assert.Equal(t, DefaultSyncBackoff, DefaultSyncBackoff.withDefaults())
+
+	b := SyncBackoff{MaxInterval: time.Minute, Jitter: 3}.withDefaults()
+	assert.Equal(t, DefaultSyncBackoff.InitialInterval, b.InitialInterval)
+	assert.Equal(t, time.Minute, b.MaxInterval)
+	assert.Equal(t, DefaultSyncBackoff.Multiplier, b.Multiplier)
+	assert.Equal(t, 1.0, b.Jitter)
+	assert.Equal(t, DefaultSyncBackoff.StableAfter, b.StableAfter)
+}
+
+// droppingSyncServer drops every Sync stream right after accepting it.
+type droppingSyncServer struct {
+	mgmtProto.UnimplementedManagementServiceServer
+	key   wgtypes.Key
+	syncs atomic.Int32
+}
+
+func (s *droppingSyncServer) GetServerKey(_ context.Context, _ *mgmtProto.Empty) (*mgmtProto.ServerKeyResponse, error) {
+	return &mgmtProto.ServerKeyResponse{Key: s.key.PublicKey().String()}, nil
+}
+
+func (s *droppingSyncServer) Sync(_ *mgmtProto.EncryptedMessage, _ mgmtProto.ManagementService_SyncServer) error {
+	s.syncs.Add(1)
+	return gstatus.Error(codes.Unavailable, "try again later")
+}
+
+func newDroppingSyncClient(t *testing.T) (*GrpcClient, *droppingSyncServer) {
+	t.Helper()
+	serverKey, err := wgtypes.GenerateKey()
+	require.NoError(t, err)
+	srv := &droppingSyncServer{key: serverKey}
+
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	s := grpc.NewServer()
+	mgmtProto.RegisterManagementServiceServer(s, srv)
+	go func() { _ = s.Serve(lis) }()
+	t.Cleanup(s.Stop)
+
+	clientKey, err := wgtypes.GenerateKey()
+	require.NoError(t, err)
+	client, err := NewClient(context.Background(), lis.Addr().String(), clientKey, false)
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = client.Close() })
+	return client, srv
+}
+
+func TestClient_DefaultSyncBackoffIsJittered(t *testing.T) {
+	client, _ := newDroppingSyncClient(t)
+	syncBackoff := client.getSyncBackoff()
+	assert.Equal(t, DefaultSyncBackoff, syncBackoff, "new clients use the default backoff")
+	require.Greater(t, syncBackoff.Jitter, 0.0)
+
+	delays := make(map[time.Duration]struct{})
+	for range 20 {
+		b := syncBackoff.newBackOff(context.Background())
+		b.Reset()
+		delays[b.NextBackOff()] = struct{}{}
+	}
+	assert.Greater(t, len(delays), 1, "clients must not reconnect in lockstep")
+}
+
+func TestClient_SyncBacksOffDroppedStreams(t *testing.T) {
+	client, srv := newDroppingSyncClient(t)
+	client.SetSyncBackoff(SyncBackoff{
+		InitialInterval: 10 * time.Millisecond,
+		MaxInterval:     time.Hour,
+		Multiplier:      2,
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 300*time.Millisecond)
+	defer cancel()
+	_ = client.Sync(ctx, nil, func(*mgmtProto.SyncResponse) error { return nil })
+
+	// 10+20+40+80+160ms of backoff fit in the deadline, resetting the
+	// backoff on every accepted stream would allow dozens of attempts.
+	assert.LessOrEqual(t, srv.syncs.Load(), int32(7))
+}
+
+func TestClient_SyncCancelInterruptsBackoff(t *testing.T) {
+	client, srv := newDroppingSyncClient(t)
+	client.SetSyncBackoff(SyncBackoff{InitialInterval: time.Hour, MaxInterval: time.Hour})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() {
+		done <- client.Sync(ctx, nil, func(*mgmtProto.SyncResponse) error { return nil })
+	}()
+
+	require.Eventually(t, func() bool { return srv.syncs.Load() == 1 }, 5*time.Second, 10*time.Millisecond)
+	cancel()
+
+	select {
+	case <-done:
+	case <-time.After(2 * time.Second):
+		t.Fatal("Sync kept sleeping after the context was canceled")
+	}
+}
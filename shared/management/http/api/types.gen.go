@@ -3986,6 +3986,9 @@ type Peer struct {
 	// DisapprovalReason (Cloud only) Reason why the peer requires approval
 	DisapprovalReason *string `json:"disapproval_reason,omitempty"`
 
+	// DnsApplyStatus Outcome of the last DNS configuration the peer reported on. Absent if the peer never reported.
+	DnsApplyStatus *PeerDNSApplyStatus `json:"dns_apply_status,omitempty"`
+
 	// DnsLabel Peer's DNS label is the parsed peer name for domain resolution. It is used to form an FQDN by appending the account's domain to the peer label. e.g. peer-dns-label.netbird.cloud
 	DnsLabel string `json:"dns_label"`
 
@@ -4080,6 +4083,9 @@ type PeerBatch struct {
 	// DisapprovalReason (Cloud only) Reason why the peer requires approval
 	DisapprovalReason *string `json:"disapproval_reason,omitempty"`
 
+	// DnsApplyStatus Outcome of the last DNS configuration the peer reported on. Absent if the peer never reported.
+	DnsApplyStatus *PeerDNSApplyStatus `json:"dns_apply_status,omitempty"`
+
 	// DnsLabel Peer's DNS label is the parsed peer name for domain resolution. It is used to form an FQDN by appending the account's domain to the peer label. e.g. peer-dns-label.netbird.cloud
 	DnsLabel string `json:"dns_label"`
 
@@ -4148,6 +4154,21 @@ type PeerBatch struct {
 	Version string `json:"version"`
 }
 
+// PeerDNSApplyStatus Outcome of the last DNS configuration the peer reported on. Absent if the peer never reported.
+type PeerDNSApplyStatus struct {
+	// Applied Indicates whether the peer applied the DNS configuration
+	Applied bool `json:"applied"`
+
+	// Errors Errors the peer reported applying the DNS configuration, capped by the management service
+	Errors []string `json:"errors"`
+
+	// ReportedAt Last time the peer reported on its DNS configuration
+	ReportedAt time.Time `json:"reported_at"`
+
+	// Serial Network map serial the DNS configuration was received with
+	Serial int64 `json:"serial"`
+}
+
 // PeerLocalFlags defines model for PeerLocalFlags.
 type PeerLocalFlags struct {
 	// BlockInbound Indicates whether inbound traffic is blocked on this peer
@@ -134,7 +134,7 @@ func DecodeEnvelope(env *proto.NetworkMapEnvelope) (*types.NetworkMapComponents,
 		if nsg == nil {
 			return nil, fmt.Errorf("invalid envelope: nameserver_groups[%d] is nil", i)
 		}
-		c.NameServerGroups = append(c.NameServerGroups, decodeNameServerGroupRaw(nsg))
+		c.NameServerGroups = append(c.NameServerGroups, decodeNameServerGroupRaw(nsg, peerIDByIndex))
 	}
 
 	// Phase 6: network resources.
@@ -273,6 +273,7 @@ func decodePeerCompact(pc *proto.PeerCompact, peerID string) *types.ComponentPee
 		SupportsIPv6:           pc.SupportsIpv6,
 		ServerSSHAllowed:       pc.ServerSshAllowed,
 		AddedWithSSOLogin:      pc.AddedWithSsoLogin,
+		DNSServicePort:         uint16(pc.DnsServicePort),
 	}
 	if pc.LastLoginUnixNano != 0 {
 		peer.LastLogin = time.Unix(0, pc.LastLoginUnixNano)
@@ -379,23 +380,40 @@ func decodeRouteRaw(rr *proto.RouteRaw, peerIDByIndex []string) *nbroute.Route {
 	return r
 }
 
-func decodeNameServerGroupRaw(nsg *proto.NameServerGroupRaw) *nbdns.NameServerGroup {
+func decodeNameServerGroupRaw(nsg *proto.NameServerGroupRaw, peerIDByIndex []string) *nbdns.NameServerGroup {
 	out := &nbdns.NameServerGroup{
-		ID:                   nsg.Id,
-		PublicID:             nsg.Id,
-		Groups:               nsg.GroupIds,
-		Primary:              nsg.Primary,
-		Domains:              nsg.Domains,
-		Enabled:              nsg.Enabled,
-		SearchDomainsEnabled: nsg.SearchDomainsEnabled,
-		NameServers:          make([]nbdns.NameServer, 0, len(nsg.Nameservers)),
+		ID:                    nsg.Id,
+		PublicID:              nsg.Id,
+		Groups:                nsg.GroupIds,
+		Primary:               nsg.Primary,
+		Domains:               nsg.Domains,
+		Enabled:               nsg.Enabled,
+		SearchDomainsEnabled:  nsg.SearchDomainsEnabled,
+		AuthoritativeOnly:     nsg.AuthoritativeOnly,
+		QueryTimeout:          time.Duration(nsg.QueryTimeoutNs),
+		DeactivationThreshold: int(nsg.DeactivationThreshold),
+		ForwardClientSubnet:   nsg.ForwardClientSubnet,
+		SelectionPolicy:       nsg.SelectionPolicy,
+		RelayPeerGroups:       nsg.RelayGroupIds,
+		NameServers:           make([]nbdns.NameServer, 0, len(nsg.Nameservers)),
+	}
+	if nsg.DefaultClientSubnet != "" {
+		if prefix, err := netip.ParsePrefix(nsg.DefaultClientSubnet); err == nil {
+			out.DefaultClientSubnet = prefix
+		}
+	}
+	for _, idx := range nsg.RelayPeerIndexes {
+		if int(idx) < len(peerIDByIndex) && peerIDByIndex[idx] != "" {
+			out.RelayPeers = append(out.RelayPeers, peerIDByIndex[idx])
+		}
 	}
 	for _, ns := range nsg.Nameservers {
 		if addr, err := netip.ParseAddr(ns.IP); err == nil {
 			out.NameServers = append(out.NameServers, nbdns.NameServer{
-				IP:     addr,
-				NSType: nbdns.NameServerType(ns.NSType),
-				Port:   int(ns.Port),
+				IP:       addr,
+				NSType:   nbdns.NameServerType(ns.NSType),
+				Port:     int(ns.Port),
+				Hostname: ns.Hostname,
 			})
 		}
 	}
@@ -444,6 +462,7 @@ func decodeCustomZones(zones []*proto.CustomZone) []nbdns.CustomZone {
 			Records:              decodeSimpleRecords(z.Records),
 			SearchDomainDisabled: z.SearchDomainDisabled,
 			NonAuthoritative:     z.NonAuthoritative,
+			NoDataFallthrough:    z.NoDataFallthrough,
 		})
 	}
 	return out
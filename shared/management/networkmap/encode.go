@@ -199,6 +199,7 @@ func ConvertToProtoCustomZone(zone nbdns.CustomZone) *proto.CustomZone {
 		Records:              make([]*proto.SimpleRecord, 0, len(zone.Records)),
 		SearchDomainDisabled: zone.SearchDomainDisabled,
 		NonAuthoritative:     zone.NonAuthoritative,
+		NoDataFallthrough:    zone.NoDataFallthrough,
 	}
 	for _, record := range zone.Records {
 		protoZone.Records = append(protoZone.Records, &proto.SimpleRecord{
@@ -215,16 +216,25 @@ func ConvertToProtoCustomZone(zone nbdns.CustomZone) *proto.CustomZone {
 // ConvertToProtoNameServerGroup converts a NameServerGroup to its proto form.
 func ConvertToProtoNameServerGroup(nsGroup *nbdns.NameServerGroup) *proto.NameServerGroup {
 	protoGroup := &proto.NameServerGroup{
-		Primary:              nsGroup.Primary,
-		Domains:              nsGroup.Domains,
-		SearchDomainsEnabled: nsGroup.SearchDomainsEnabled,
-		NameServers:          make([]*proto.NameServer, 0, len(nsGroup.NameServers)),
+		Primary:               nsGroup.Primary,
+		Domains:               nsGroup.Domains,
+		SearchDomainsEnabled:  nsGroup.SearchDomainsEnabled,
+		AuthoritativeOnly:     nsGroup.AuthoritativeOnly,
+		QueryTimeout:          int64(nsGroup.QueryTimeout),
+		DeactivationThreshold: int64(nsGroup.DeactivationThreshold),
+		ForwardClientSubnet:   nsGroup.ForwardClientSubnet,
+		SelectionPolicy:       nsGroup.SelectionPolicy,
+		NameServers:           make([]*proto.NameServer, 0, len(nsGroup.NameServers)),
+	}
+	if nsGroup.DefaultClientSubnet.IsValid() {
+		protoGroup.DefaultClientSubnet = nsGroup.DefaultClientSubnet.String()
 	}
 	for _, ns := range nsGroup.NameServers {
 		protoGroup.NameServers = append(protoGroup.NameServers, &proto.NameServer{
-			IP:     ns.IP.String(),
-			Port:   int64(ns.Port),
-			NSType: int64(ns.NSType),
+			IP:       ns.IP.String(),
+			Port:     int64(ns.Port),
+			NSType:   int64(ns.NSType),
+			Hostname: ns.Hostname,
 		})
 	}
 	return protoGroup
@@ -248,6 +258,10 @@ func ToProtocolDNSConfig(update nbdns.Config, cache DNSConfigCache, forwardPort
 		CustomZones:      make([]*proto.CustomZone, 0, len(update.CustomZones)),
 		NameServerGroups: make([]*proto.NameServerGroup, 0, len(update.NameServerGroups)),
 		ForwarderPort:    forwardPort,
+		DNS64:            update.DNS64,
+	}
+	if update.DNS64 && update.DNS64Prefix.IsValid() {
+		protoUpdate.DNS64Prefix = update.DNS64Prefix.String()
 	}
 
 	for _, zone := range update.CustomZones {
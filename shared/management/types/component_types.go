@@ -25,6 +25,9 @@ type ComponentPeer struct {
 	LoginExpirationEnabled bool
 	AddedWithSSOLogin      bool
 	LastLogin              time.Time
+	// DNSServicePort is the port the peer's DNS service listens on at IP, 0
+	// when it doesn't listen there.
+	DNSServicePort uint16
 }
 
 // FQDN returns the peer's FQDN combined of the peer's DNS label and the system's DNS domain.
@@ -472,7 +472,11 @@ func (c *NetworkMapComponents) getPeerNSGroupsFromGroups(peerID string, groupLis
 		}
 		for _, gID := range nsGroup.Groups {
 			if _, found := groupList[gID]; found {
-				if !c.peerIsNameserver(peerIPStr, nsGroup) {
+				if nsGroup.HasRelay() && !c.isRelayPeer(peerID, nsGroup) {
+					if relayed := c.relayNSGroup(peerID, nsGroup); relayed != nil {
+						peerNSGroups = append(peerNSGroups, relayed)
+					}
+				} else if !c.peerIsNameserver(peerIPStr, nsGroup) {
 					peerNSGroups = append(peerNSGroups, nsGroup.Copy())
 				}
 				break
@@ -483,6 +487,70 @@ func (c *NetworkMapComponents) getPeerNSGroupsFromGroups(peerID string, groupLis
 	return peerNSGroups
 }
 
+// relayPeers returns the peers relaying nsGroup's queries that are known to
+// this map, explicitly listed peers first, then relay group members by ID.
+func (c *NetworkMapComponents) relayPeers(nsGroup *nbdns.NameServerGroup) []*ComponentPeer {
+	seen := make(map[string]struct{})
+	var relays []*ComponentPeer
+	add := func(id string) {
+		if _, ok := seen[id]; ok {
+			return
+		}
+		seen[id] = struct{}{}
+		if p := c.GetPeerInfo(id); p != nil {
+			relays = append(relays, p)
+		}
+	}
+
+	for _, id := range nsGroup.RelayPeers {
+		add(id)
+	}
+	var members []string
+	for _, gID := range nsGroup.RelayPeerGroups {
+		if g := c.GetGroupInfo(gID); g != nil {
+			members = append(members, g.Peers...)
+		}
+	}
+	slices.Sort(members)
+	for _, id := range members {
+		add(id)
+	}
+	return relays
+}
+
+func (c *NetworkMapComponents) isRelayPeer(peerID string, nsGroup *nbdns.NameServerGroup) bool {
+	return slices.ContainsFunc(c.relayPeers(nsGroup), func(p *ComponentPeer) bool {
+		return p.ID == peerID
+	})
+}
+
+// relayNSGroup returns a copy of nsGroup whose nameservers are the DNS
+// services of its relay peers, which forward the queries to the configured
+// nameservers. Relay peers whose DNS service doesn't listen on their overlay
+// address are skipped. Nil when no relay peer is reachable.
+func (c *NetworkMapComponents) relayNSGroup(peerID string, nsGroup *nbdns.NameServerGroup) *nbdns.NameServerGroup {
+	var nameServers []nbdns.NameServer
+	for _, relay := range c.relayPeers(nsGroup) {
+		if relay.ID == peerID || !relay.IP.IsValid() || relay.DNSServicePort == 0 {
+			continue
+		}
+		nameServers = append(nameServers, nbdns.NameServer{
+			IP:     relay.IP,
+			NSType: nbdns.UDPNameServerType,
+			Port:   int(relay.DNSServicePort),
+		})
+	}
+	if len(nameServers) == 0 {
+		return nil
+	}
+
+	relayed := nsGroup.Copy()
+	relayed.NameServers = nameServers
+	// The relay's own DNS service recurses as configured for the group.
+	relayed.AuthoritativeOnly = false
+	return relayed
+}
+
 func (c *NetworkMapComponents) peerIsNameserver(peerIPStr string, nsGroup *nbdns.NameServerGroup) bool {
 	for _, ns := range nsGroup.NameServers {
 		if peerIPStr == ns.IP.String() {